@@ -2,6 +2,7 @@ package bg
 
 import "io"
 import "fmt"
+import "time"
 import "github.com/dadleyy/beacon.api/beacon/defs"
 
 // ChannelPublisher defines an interface that sends an io.Reader interface to a consumer
@@ -9,22 +10,37 @@ type ChannelPublisher interface {
 	PublishReader(string, io.Reader) error
 }
 
-// ChannelStore defines a map of channel names to the channel that will send/receivers readers
-type ChannelStore map[string]chan io.Reader
+// ChannelStore holds a map of channel names to the channel that will send/receivers readers.
+type ChannelStore struct {
+	Channels map[string]chan io.Reader
 
-// PublishReader publishes an instance of an io.Reader to a channel it owns.
+	// Timeout is how long publishing waits for room in a full channel before giving up w/ a device busy error.
+	Timeout time.Duration
+}
+
+// PublishReader publishes an instance of an io.Reader to a channel it owns. If the channel stays full for longer than
+// the store's timeout a device busy error is returned instead of blocking.
 func (s *ChannelStore) PublishReader(name string, reader io.Reader) error {
 	if s == nil {
 		return fmt.Errorf("invalid-store")
 	}
 
-	c, e := (*s)[name]
+	c, e := s.Channels[name]
 
 	if e != true {
 		return fmt.Errorf(defs.ErrInvalidBackgroundChannel)
 	}
 
-	c <- reader
+	timeout := s.Timeout
 
-	return nil
+	if timeout <= 0 {
+		timeout = defs.DefaultChannelPublishTimeout
+	}
+
+	select {
+	case c <- reader:
+		return nil
+	case <-time.After(timeout):
+		return defs.Error(defs.ErrDeviceBusy)
+	}
 }
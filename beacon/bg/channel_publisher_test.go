@@ -0,0 +1,66 @@
+package bg
+
+import "io"
+import "time"
+import "bytes"
+import "testing"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+func Test_ChannelStore(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("ChannelStore", func() {
+		var store *ChannelStore
+		var commands chan io.Reader
+
+		g.BeforeEach(func() {
+			commands = make(chan io.Reader, 1)
+			store = &ChannelStore{
+				Channels: map[string]chan io.Reader{defs.DeviceControlChannelName: commands},
+				Timeout:  time.Millisecond * 10,
+			}
+		})
+
+		g.It("fails to publish to an unknown channel", func() {
+			e := store.PublishReader("not-a-channel", bytes.NewBuffer([]byte{}))
+			g.Assert(e.Error()).Equal(defs.ErrInvalidBackgroundChannel)
+		})
+
+		g.It("publishes the reader while the channel has room in its buffer", func() {
+			g.Assert(store.PublishReader(defs.DeviceControlChannelName, bytes.NewBuffer([]byte{}))).Equal(nil)
+			g.Assert(len(commands)).Equal(1)
+		})
+
+		g.It("times out w/ a device busy error rather than blocking once the buffer is full", func() {
+			g.Assert(store.PublishReader(defs.DeviceControlChannelName, bytes.NewBuffer([]byte{}))).Equal(nil)
+
+			done := make(chan error, 1)
+
+			go func() {
+				done <- store.PublishReader(defs.DeviceControlChannelName, bytes.NewBuffer([]byte{}))
+			}()
+
+			select {
+			case e := <-done:
+				g.Assert(e).Equal(defs.Error(defs.ErrDeviceBusy))
+			case <-time.After(time.Second):
+				g.Fail("publishing to a full channel blocked past its timeout")
+			}
+
+			g.Assert(len(commands)).Equal(1)
+		})
+
+		g.It("publishes once the consumer makes room before the timeout", func() {
+			store.Timeout = time.Second
+			g.Assert(store.PublishReader(defs.DeviceControlChannelName, bytes.NewBuffer([]byte{}))).Equal(nil)
+
+			go func() {
+				<-commands
+			}()
+
+			g.Assert(store.PublishReader(defs.DeviceControlChannelName, bytes.NewBuffer([]byte{}))).Equal(nil)
+		})
+	})
+}
@@ -0,0 +1,125 @@
+package bg
+
+import "io"
+import "sync"
+import "time"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// CircuitBreaker wraps a channel publisher, tracking consecutive failures to publish to its channel. Once the failures
+// reach the threshold the breaker opens and publishes fail fast w/ a control unavailable error. After the cooldown a
+// single probe publish is let through; its success closes the breaker while its failure opens it again.
+type CircuitBreaker struct {
+	ChannelPublisher
+
+	// Channel is the name of the channel guarded by the breaker; publishes to any other channel are passed through.
+	Channel string
+
+	// Threshold is the amount of consecutive failures that open the breaker; the default threshold is used if zero.
+	Threshold int
+
+	// Cooldown is how long the breaker stays open before probing; the default cooldown is used if zero.
+	Cooldown time.Duration
+
+	mutex    sync.Mutex
+	state    string
+	failures int
+	opened   time.Time
+}
+
+// PublishReader publishes the reader through the wrapped publisher unless the breaker is open.
+func (breaker *CircuitBreaker) PublishReader(name string, reader io.Reader) error {
+	if name != breaker.Channel {
+		return breaker.ChannelPublisher.PublishReader(name, reader)
+	}
+
+	if breaker.allow() != true {
+		return defs.Error(defs.ErrControlUnavailable)
+	}
+
+	e := breaker.ChannelPublisher.PublishReader(name, reader)
+	breaker.record(e)
+	return e
+}
+
+// State returns the current state of the breaker.
+func (breaker *CircuitBreaker) State() string {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if breaker.state == "" {
+		return defs.CircuitBreakerClosed
+	}
+
+	return breaker.state
+}
+
+// allow determines whether a publish may go through, moving an open breaker whose cooldown has elapsed to half-open.
+// Only the publish that moves the breaker to half-open is let through as the probe.
+func (breaker *CircuitBreaker) allow() bool {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if breaker.state == defs.CircuitBreakerHalfOpen {
+		return false
+	}
+
+	if breaker.state != defs.CircuitBreakerOpen {
+		return true
+	}
+
+	cooldown := breaker.Cooldown
+
+	if cooldown <= 0 {
+		cooldown = defs.DefaultCircuitBreakerCooldown
+	}
+
+	if time.Since(breaker.opened) < cooldown {
+		return false
+	}
+
+	breaker.state = defs.CircuitBreakerHalfOpen
+	return true
+}
+
+// record updates the breaker w/ the result of a publish it let through. Errors specific to a single device (e.g a
+// busy device) say nothing about the health of the channel; they are not counted as failures, but a probe that hits
+// one did reach the channel and closes the breaker.
+func (breaker *CircuitBreaker) record(failure error) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if failure == nil {
+		breaker.state, breaker.failures = defs.CircuitBreakerClosed, 0
+		return
+	}
+
+	if deviceError(failure) {
+		if breaker.state == defs.CircuitBreakerHalfOpen {
+			breaker.state, breaker.failures = defs.CircuitBreakerClosed, 0
+		}
+
+		return
+	}
+
+	threshold := breaker.Threshold
+
+	if threshold <= 0 {
+		threshold = defs.DefaultCircuitBreakerThreshold
+	}
+
+	breaker.failures++
+
+	if breaker.state == defs.CircuitBreakerHalfOpen || breaker.failures >= threshold {
+		breaker.state, breaker.opened = defs.CircuitBreakerOpen, time.Now()
+	}
+}
+
+// deviceError determines whether the publish error is specific to a single device rather than the channel.
+func deviceError(e error) bool {
+	switch e {
+	case defs.Error(defs.ErrDeviceBusy), defs.Error(defs.ErrDeviceLocked), defs.Error(defs.ErrNotFound):
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,148 @@
+package bg
+
+import "io"
+import "fmt"
+import "time"
+import "bytes"
+import "testing"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+type testBreakerPublisher struct {
+	failing   bool
+	failure   error
+	published []string
+}
+
+func (p *testBreakerPublisher) PublishReader(name string, reader io.Reader) error {
+	if p.failure != nil {
+		return p.failure
+	}
+
+	if p.failing {
+		return fmt.Errorf("bad-publish")
+	}
+
+	p.published = append(p.published, name)
+	return nil
+}
+
+func Test_CircuitBreaker(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("CircuitBreaker", func() {
+		var publisher *testBreakerPublisher
+		var breaker *CircuitBreaker
+
+		publish := func() error {
+			return breaker.PublishReader(defs.DeviceControlChannelName, bytes.NewBuffer([]byte{}))
+		}
+
+		g.BeforeEach(func() {
+			publisher = &testBreakerPublisher{}
+			breaker = &CircuitBreaker{
+				ChannelPublisher: publisher,
+				Channel:          defs.DeviceControlChannelName,
+				Threshold:        3,
+				Cooldown:         time.Millisecond * 20,
+			}
+		})
+
+		g.It("starts closed, publishing through the wrapped publisher", func() {
+			g.Assert(breaker.State()).Equal(defs.CircuitBreakerClosed)
+			g.Assert(publish()).Equal(nil)
+			g.Assert(len(publisher.published)).Equal(1)
+		})
+
+		g.It("stays closed while the consecutive failures are below the threshold", func() {
+			publisher.failing = true
+			publish()
+			publish()
+			publisher.failing = false
+			g.Assert(publish()).Equal(nil)
+			publisher.failing = true
+			publish()
+			publish()
+			g.Assert(breaker.State()).Equal(defs.CircuitBreakerClosed)
+		})
+
+		g.It("does not count busy devices as failures", func() {
+			publisher.failure = defs.Error(defs.ErrDeviceBusy)
+
+			for i := 0; i < breaker.Threshold*2; i++ {
+				g.Assert(publish()).Equal(defs.Error(defs.ErrDeviceBusy))
+			}
+
+			g.Assert(breaker.State()).Equal(defs.CircuitBreakerClosed)
+		})
+
+		g.It("does not reset the consecutive failures on a per-device error", func() {
+			publisher.failing = true
+			publish()
+			publish()
+			publisher.failure = defs.Error(defs.ErrDeviceLocked)
+			publish()
+			publisher.failure = nil
+			publish()
+			g.Assert(breaker.State()).Equal(defs.CircuitBreakerOpen)
+		})
+
+		g.Describe("having failed to publish as many times as the threshold", func() {
+			g.BeforeEach(func() {
+				publisher.failing = true
+
+				for i := 0; i < breaker.Threshold; i++ {
+					g.Assert(publish().Error()).Equal("bad-publish")
+				}
+			})
+
+			g.It("opens, failing fast w/o publishing", func() {
+				publisher.failing = false
+				g.Assert(breaker.State()).Equal(defs.CircuitBreakerOpen)
+				g.Assert(publish()).Equal(defs.Error(defs.ErrControlUnavailable))
+				g.Assert(len(publisher.published)).Equal(0)
+			})
+
+			g.It("passes publishes to other channels through", func() {
+				publisher.failing = false
+				e := breaker.PublishReader(defs.DeviceFeedbackChannelName, bytes.NewBuffer([]byte{}))
+				g.Assert(e).Equal(nil)
+				g.Assert(publisher.published).Equal([]string{defs.DeviceFeedbackChannelName})
+			})
+
+			g.Describe("once the cooldown has elapsed", func() {
+				g.BeforeEach(func() {
+					time.Sleep(breaker.Cooldown * 2)
+				})
+
+				g.It("half-opens for a single probe, failing the others fast while it is in flight", func() {
+					g.Assert(breaker.allow()).Equal(true)
+					g.Assert(breaker.State()).Equal(defs.CircuitBreakerHalfOpen)
+					g.Assert(publish()).Equal(defs.Error(defs.ErrControlUnavailable))
+				})
+
+				g.It("recovers once the probe publishes successfully", func() {
+					publisher.failing = false
+					g.Assert(publish()).Equal(nil)
+					g.Assert(breaker.State()).Equal(defs.CircuitBreakerClosed)
+					g.Assert(publish()).Equal(nil)
+					g.Assert(len(publisher.published)).Equal(2)
+				})
+
+				g.It("closes once the probe reaches a busy device", func() {
+					publisher.failure = defs.Error(defs.ErrDeviceBusy)
+					g.Assert(publish()).Equal(defs.Error(defs.ErrDeviceBusy))
+					g.Assert(breaker.State()).Equal(defs.CircuitBreakerClosed)
+				})
+
+				g.It("opens again after a single failed probe", func() {
+					g.Assert(publish().Error()).Equal("bad-publish")
+					g.Assert(breaker.State()).Equal(defs.CircuitBreakerOpen)
+					publisher.failing = false
+					g.Assert(publish()).Equal(defs.Error(defs.ErrControlUnavailable))
+				})
+			})
+		})
+	})
+}
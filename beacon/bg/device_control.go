@@ -1,8 +1,10 @@
 package bg
 
 import "io"
+import "fmt"
 import "sync"
 import "time"
+import "bytes"
 import "io/ioutil"
 
 import "github.com/golang/protobuf/proto"
@@ -27,10 +29,25 @@ type DeviceChannels struct {
 }
 
 // NewDeviceControlProcessor returns a new DeviceControlProcessor
-func NewDeviceControlProcessor(c *DeviceChannels, s device.Index, k *security.ServerKey) *DeviceControlProcessor {
+func NewDeviceControlProcessor(
+	c *DeviceChannels,
+	s device.Index,
+	k *security.ServerKey,
+	events device.EventDispatcher,
+) *DeviceControlProcessor {
 	logger := logging.New(defs.DeviceControlLogPrefix, logging.Yellow)
 	var pool []device.Connection
-	return &DeviceControlProcessor{logger, k, c, s, pool}
+	return &DeviceControlProcessor{
+		Logger:        logger,
+		key:           k,
+		channels:      c,
+		index:         s,
+		pool:          pool,
+		events:        events,
+		pending:       make(map[string]interchange.DeviceMessage),
+		DrainTimeout:  defs.DefaultControlDrainTimeout,
+		MaxCommandAge: defs.DefaultMaxCommandAge,
+	}
 }
 
 // The DeviceControlProcessor is used by the server to maintain the pool of websocket connections, register new device
@@ -41,54 +58,230 @@ type DeviceControlProcessor struct {
 	channels *DeviceChannels
 	index    device.Index
 	pool     []device.Connection
+	poolLock sync.Mutex
+	events   device.EventDispatcher
+
+	// retained holds the connections closed by Disconnect, whose devices remain registered once they are unsubscribed.
+	retained map[device.Connection]bool
+
+	// pending holds the latest command received for each device whose coalesce window is open.
+	pending     map[string]interchange.DeviceMessage
+	pendingLock sync.Mutex
+
+	// DrainTimeout is how long commands still buffered when stopping are relayed for before connections are closed.
+	DrainTimeout time.Duration
+
+	// Commands, if provided, is used to record the acknowledgement (or failure) of the commands sent to devices.
+	Commands device.CommandStore
+
+	// MaxCommandAge is how long after being issued a command is still relayed to its device; older commands are dropped.
+	MaxCommandAge time.Duration
+
+	// Resumes, if provided, is used to issue the resume token devices are welcomed w/.
+	Resumes device.ResumeStore
+
+	// Feedback, if provided, is used to record commands that could not be sent to their device as error feedback.
+	Feedback device.FeedbackStore
+
+	// ConnectionEvents, if provided, is used to record the connections accepted into and dropped from the pool.
+	ConnectionEvents device.ConnectionEventLog
+
+	// MaxConnections is the capacity of the pool; once exceeded the least recently active connection is closed and
+	// evicted. Zero leaves the pool unbounded.
+	MaxConnections int
+
+	// MaxDeviceConnections is the amount of concurrent connections a single device id can hold in the pool. Zero uses
+	// the default of a single connection per device.
+	MaxDeviceConnections int
+
+	// DeviceConnectionPolicy decides what happens to a new connection of a device already at its connection limit; the
+	// oldest connection of the device is evicted unless set to the reject-new policy.
+	DeviceConnectionPolicy string
+
+	// CoalesceWindow is how long commands for a device are held before sending; only the latest command received for
+	// the device during the window is sent. Zero sends every command immediately.
+	CoalesceWindow time.Duration
+
+	// Workers is the amount of workers started to receive from the device channels. Zero starts a single worker.
+	Workers int
+}
+
+// PoolSize returns the amount of device connections currently held in the pool.
+func (processor *DeviceControlProcessor) PoolSize() int {
+	processor.poolLock.Lock()
+	defer processor.poolLock.Unlock()
+	return len(processor.pool)
+}
+
+// Connected returns whether the device has a connection held in the pool.
+func (processor *DeviceControlProcessor) Connected(deviceID string) bool {
+	return processor.find(deviceID) != nil
+}
+
+// PoolCapacity returns the maximum amount of device connections held in the pool, zero meaning unbounded.
+func (processor *DeviceControlProcessor) PoolCapacity() int {
+	return processor.MaxConnections
 }
 
 // Start will continuously loop over registration & command channels delegating to private methods as necessary.
 func (processor *DeviceControlProcessor) Start(wg *sync.WaitGroup, stop KillSwitch) {
+	processor.StartWorkers(processor.Workers, processor.channels, wg, stop)
+}
+
+// StartWorkers launches n workers receiving from the same device channels, sharing the pool of connections. Each
+// command or registration is received by exactly one worker. Once the kill switch is sent (or a channel is closed)
+// every worker is stopped, any buffered commands are drained and the connections in the pool are closed. Commands and
+// registrations are received from the given channels (the processor's own when nil); feedback is always sent along the
+// processor's feedback channel.
+func (processor *DeviceControlProcessor) StartWorkers(
+	n int,
+	channels *DeviceChannels,
+	wg *sync.WaitGroup,
+	kill KillSwitch,
+) {
 	defer wg.Done()
 
-	processor.Infof("device control processor starting")
+	if n <= 0 {
+		n = defs.DefaultDeviceControlWorkers
+	}
+
+	if channels == nil {
+		channels = processor.channels
+	}
+
+	processor.Infof("device control processor starting w/ %d worker(s)", n)
+
+	wait, workers := sync.WaitGroup{}, sync.WaitGroup{}
+	done, finished := make(chan struct{}), make(chan struct{})
+
+	// Commands are tracked separately so that they can be drained before the connections are closed.
+	commands := sync.WaitGroup{}
+
+	for i := 0; i < n; i++ {
+		workers.Add(1)
+		go processor.work(channels, done, &workers, &commands, &wait)
+	}
+
+	// The kill switch is only sent once; closing the done channel relays it to every worker.
+	go processor.watch(kill, done, finished)
+
+	workers.Wait()
+	close(finished)
 
-	wait, timer, running := sync.WaitGroup{}, time.NewTicker(time.Minute), true
+	processor.drain(channels, &commands)
+
+	processor.poolLock.Lock()
+	pool := processor.pool
+	processor.poolLock.Unlock()
+
+	for _, c := range pool {
+		processor.Infof("closing connection: %s", c.GetID())
+		c.Close()
+	}
+
+	commands.Wait()
+	wait.Wait()
+}
+
+// watch closes the done channel once the kill switch has been sent, logging the size of the pool periodically until
+// then. It returns w/o closing the done channel if the workers finish on their own (e.g a channel was closed).
+func (processor *DeviceControlProcessor) watch(stop KillSwitch, done chan<- struct{}, finished <-chan struct{}) {
+	timer := time.NewTicker(time.Minute)
 	defer timer.Stop()
 
-	for running {
+	for {
 		select {
-		case message, ok := <-processor.channels.Commands:
+		case <-timer.C:
+			processor.Infof("pool size[%d] capacity[%d]", processor.PoolSize(), processor.PoolCapacity())
+		case <-stop:
+			processor.Infof("received kill signal, breaking")
+			close(done)
+			return
+		case <-finished:
+			return
+		}
+	}
+}
+
+// work receives from the registration & command channels until the done channel is closed or either channel is.
+func (processor *DeviceControlProcessor) work(
+	channels *DeviceChannels,
+	done <-chan struct{},
+	workers, commands, wait *sync.WaitGroup,
+) {
+	defer workers.Done()
+
+	for {
+		select {
+		case message, ok := <-channels.Commands:
 			if !ok {
-				running = false
-				break
+				return
 			}
 
-			wait.Add(1)
+			commands.Add(1)
 			processor.Infof("received message on read channel")
-			go processor.handle(message, &wait)
-		case connection, ok := <-processor.channels.Registrations:
+			go processor.handle(message, commands)
+		case connection, ok := <-channels.Registrations:
 			if ok != true {
-				running = false
+				return
+			}
+
+			// Connections rejected by the connection policy of their device are closed w/o being welcomed.
+			if processor.track(connection) != true {
+				connection.Close()
 				break
 			}
 
 			wait.Add(2)
 
 			// If we've received a welcome message, send our shared secret to the device and start polling for feedback msgs.
-			go processor.welcome(connection, &wait)
-			go processor.subscribe(connection, &wait)
-		case <-timer.C:
-			processor.Infof("pool len[%d] cap[%d]", len(processor.pool), cap(processor.pool))
-		case <-stop:
-			processor.Infof("received kill signal, breaking")
-			running = false
-			break
+			go processor.welcome(connection, wait)
+			go processor.subscribe(connection, wait)
+		case <-done:
+			return
 		}
 	}
+}
 
-	for _, c := range processor.pool {
-		processor.Infof("closing connection: %s", c.GetID())
-		c.Close()
+// drain relays any commands still buffered in the command channel, waiting for them (and any commands already being
+// handled) to be sent until the drain timeout has elapsed.
+func (processor *DeviceControlProcessor) drain(channels *DeviceChannels, commands *sync.WaitGroup) {
+	timeout := processor.DrainTimeout
+
+	if timeout <= 0 {
+		timeout = defs.DefaultControlDrainTimeout
 	}
 
-	wait.Wait()
+	deadline, buffered := time.After(timeout), true
+
+	for buffered {
+		select {
+		case message, ok := <-channels.Commands:
+			if ok != true {
+				buffered = false
+				break
+			}
+
+			commands.Add(1)
+			go processor.handle(message, commands)
+		default:
+			buffered = false
+		}
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		commands.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		processor.Infof("finished relaying buffered commands")
+	case <-deadline:
+		processor.Warnf("drain timeout reached before all buffered commands were relayed")
+	}
 }
 
 // handle receives a reader interface that contains a serialized device message and attempts
@@ -109,57 +302,328 @@ func (processor *DeviceControlProcessor) handle(message io.Reader, wg *sync.Wait
 		return
 	}
 
-	var device device.Connection
-	targetID := controlMessage.GetAuthentication().GetDeviceID()
+	targetID, requestID := controlMessage.GetAuthentication().GetDeviceID(), controlMessage.GetRequestID()
 
-	// Attempt to find a device in our pool associated with the message we've received.
-	for _, d := range processor.pool {
-		processor.Infof("comparing d[%s]", d.GetID())
-
-		if deviceID := d.GetID(); deviceID != targetID {
-			continue
-		}
+	if age, stale := processor.stale(controlMessage); stale {
+		processor.Warnf("dropping stale command for device[%s], age: %s (request: %s)", targetID, age, requestID)
+		processor.updateCommand(controlMessage.GetCommandID(), targetID, defs.CommandStatusFailed)
+		return
+	}
 
-		device = d
-		break
+	if processor.CoalesceWindow > 0 {
+		processor.coalesce(controlMessage, wg)
+		return
 	}
 
+	processor.relay(controlMessage)
+}
+
+// relay writes the command to the connection of its device, marking the command as failed if it cannot be sent.
+func (processor *DeviceControlProcessor) relay(controlMessage interchange.DeviceMessage) {
+	targetID, requestID := controlMessage.GetAuthentication().GetDeviceID(), controlMessage.GetRequestID()
+
+	// Attempt to find a device in our pool associated with the message we've received.
+	device := processor.find(targetID)
+
 	if device == nil {
-		processor.Warnf("unable to locate device for command, command device id: %s", targetID)
+		processor.Warnf("unable to locate device for command, command device id: %s (request: %s)", targetID, requestID)
+		processor.updateCommand(controlMessage.GetCommandID(), targetID, defs.CommandStatusFailed)
 		return
 	}
 
 	// At this point we've found a device to send to, write our message into it.
 	if e := device.Send(controlMessage); e != nil {
-		processor.Warnf("unable to write command to device (closing device): %s", e.Error())
+		processor.Warnf("unable to write command to device (closing device, request: %s): %s", requestID, e.Error())
+		processor.updateCommand(controlMessage.GetCommandID(), targetID, defs.CommandStatusFailed)
+		processor.logSendFailure(controlMessage, e)
 		processor.unsubscribe(device)
 		return
 	}
 
-	processor.Infof("relayed command to device[%s]", device.GetID())
+	processor.touch(device)
+	processor.Infof("relayed command to device[%s] (request: %s)", device.GetID(), requestID)
+}
+
+// logSendFailure records the failure to send a command as error feedback of its device so that it shows up in the
+// feedback history of the device. Failures to log the feedback are only logged; they are never recorded themselves.
+func (processor *DeviceControlProcessor) logSendFailure(message interchange.DeviceMessage, failure error) {
+	if processor.Feedback == nil {
+		return
+	}
+
+	deviceID, requestID := message.GetAuthentication().GetDeviceID(), message.GetRequestID()
+
+	feedback := interchange.FeedbackMessage{
+		Type:           interchange.FeedbackMessageType_ERROR,
+		Level:          interchange.FeedbackLevel_LEVEL_ERROR,
+		Authentication: &interchange.DeviceMessageAuthentication{DeviceID: deviceID},
+		CommandID:      message.GetCommandID(),
+		Payload:        []byte(fmt.Sprintf("unable to send command (request: %s): %s", requestID, failure.Error())),
+	}
+
+	if e := processor.Feedback.RecordFeedback(feedback); e != nil {
+		processor.Warnf("unable to log send failure of device[%s] (request: %s): %s", deviceID, requestID, e.Error())
+	}
+}
+
+// coalesce holds the command until the coalesce window of its device closes, at which point only the latest command
+// received for the device during the window is relayed. The window opens w/ the first command and is closed by a single
+// timer per device; commands arriving while it is open replace the pending command, which is marked as superseded, so a
+// device receiving a steady stream of commands is still sent one per window. The wait group is held until the window
+// closes so that draining the command channel waits for the pending commands to be relayed.
+func (processor *DeviceControlProcessor) coalesce(message interchange.DeviceMessage, wg *sync.WaitGroup) {
+	deviceID := message.GetAuthentication().GetDeviceID()
+
+	processor.pendingLock.Lock()
+
+	if processor.pending == nil {
+		processor.pending = make(map[string]interchange.DeviceMessage)
+	}
+
+	previous, open := processor.pending[deviceID]
+	processor.pending[deviceID] = message
+
+	if open != true {
+		wg.Add(1)
+
+		time.AfterFunc(processor.CoalesceWindow, func() {
+			defer wg.Done()
+			processor.relay(processor.flush(deviceID))
+		})
+	}
+
+	processor.pendingLock.Unlock()
+
+	if open {
+		processor.Infof("coalesced command for device[%s] (request: %s)", deviceID, previous.GetRequestID())
+		processor.updateCommand(previous.GetCommandID(), deviceID, defs.CommandStatusSuperseded)
+	}
+}
+
+// flush closes the coalesce window of the device, returning the latest command received for it during the window.
+func (processor *DeviceControlProcessor) flush(deviceID string) interchange.DeviceMessage {
+	processor.pendingLock.Lock()
+	defer processor.pendingLock.Unlock()
+
+	latest := processor.pending[deviceID]
+	delete(processor.pending, deviceID)
+	return latest
+}
+
+// stale returns the age of a message along w/ whether or not it is older than the max command age. Messages published
+// w/o an issued at timestamp are never considered stale.
+func (processor *DeviceControlProcessor) stale(message interchange.DeviceMessage) (time.Duration, bool) {
+	if message.GetIssuedAt() == 0 {
+		return 0, false
+	}
+
+	maxAge, age := processor.MaxCommandAge, time.Since(time.Unix(message.GetIssuedAt(), 0))
+
+	if maxAge <= 0 {
+		maxAge = defs.DefaultMaxCommandAge
+	}
+
+	processor.Debugf("command age: %s (max: %s)", age, maxAge)
+
+	return age, age > maxAge
+}
+
+// find returns the most recently active connection in the pool associated w/ the device id, or nil if none exists.
+func (processor *DeviceControlProcessor) find(deviceID string) device.Connection {
+	processor.poolLock.Lock()
+	defer processor.poolLock.Unlock()
+
+	for i := len(processor.pool) - 1; i >= 0; i-- {
+		if processor.pool[i].GetID() == deviceID {
+			return processor.pool[i]
+		}
+	}
+
+	return nil
+}
+
+// track adds the connection to the pool, returning false if the connection was rejected by the connection policy. A
+// device already at its connection limit (e.g a resumed device whose previous connection has not yet been dropped)
+// either has its least recently active connections closed or the new connection rejected. The least recently active
+// connections are also closed and evicted while the pool is over capacity; the pool is kept ordered from least to
+// most recently active.
+func (processor *DeviceControlProcessor) track(connection device.Connection) bool {
+	processor.poolLock.Lock()
+
+	var evicted []device.Connection
+	deviceID, limit := connection.GetID(), processor.deviceConnectionLimit()
+	existing := processor.connections(deviceID)
+
+	if len(existing) >= limit && processor.DeviceConnectionPolicy == defs.DeviceConnectionPolicyRejectNew {
+		processor.poolLock.Unlock()
+		processor.Warnf("device[%s] at connection limit[%d], rejecting new connection", deviceID, limit)
+		return false
+	}
+
+	var replaced []device.Connection
+
+	if overflow := len(existing) - limit + 1; overflow > 0 {
+		replaced = existing[:overflow]
+	}
+
+	for _, c := range replaced {
+		processor.remove(c)
+	}
+
+	processor.pool = append(processor.pool, connection)
+
+	for processor.MaxConnections > 0 && len(processor.pool) > processor.MaxConnections {
+		evicted = append(evicted, processor.pool[0])
+		processor.pool = processor.pool[1:]
+	}
+
+	processor.poolLock.Unlock()
+
+	processor.recordConnectionEvent(deviceID, defs.ConnectionEventConnected)
+
+	// The subscriptions of the replaced connections will end w/o removing the device since it is still in the pool.
+	for _, c := range replaced {
+		processor.Infof("device[%s] at connection limit[%d], closing oldest connection", deviceID, limit)
+		c.Close()
+		processor.recordConnectionEvent(c.GetID(), defs.ConnectionEventDisconnected)
+	}
+
+	// Closing the connection will cause its subscription to end, removing it from the index.
+	for _, c := range evicted {
+		processor.Warnf("pool capacity[%d] exceeded, evicting device[%s]", processor.MaxConnections, c.GetID())
+		c.Close()
+		processor.recordConnectionEvent(c.GetID(), defs.ConnectionEventDisconnected)
+	}
+
+	return true
+}
+
+// deviceConnectionLimit returns the amount of concurrent connections a single device can hold in the pool.
+func (processor *DeviceControlProcessor) deviceConnectionLimit() int {
+	if processor.MaxDeviceConnections <= 0 {
+		return defs.DefaultMaxDeviceConnections
+	}
+
+	return processor.MaxDeviceConnections
+}
+
+// connections returns the connections of the device held in the pool, least recently active first. The pool lock must
+// be held.
+func (processor *DeviceControlProcessor) connections(deviceID string) []device.Connection {
+	var result []device.Connection
+
+	for _, d := range processor.pool {
+		if d.GetID() == deviceID {
+			result = append(result, d)
+		}
+	}
+
+	return result
+}
+
+// remove takes the connection out of the pool, returning whether it was found. The pool lock must be held.
+func (processor *DeviceControlProcessor) remove(connection device.Connection) bool {
+	for i, d := range processor.pool {
+		if d != connection {
+			continue
+		}
+
+		processor.pool = append(processor.pool[:i:i], processor.pool[i+1:]...)
+		return true
+	}
+
+	return false
+}
+
+// Disconnect closes every connection the device holds in the pool, forcing it to reconnect (and handshake again)
+// while leaving it registered, returning the amount of connections closed.
+func (processor *DeviceControlProcessor) Disconnect(deviceID string) int {
+	processor.poolLock.Lock()
+	closing := processor.connections(deviceID)
+
+	if processor.retained == nil {
+		processor.retained = make(map[device.Connection]bool)
+	}
+
+	for _, c := range closing {
+		processor.remove(c)
+		processor.retained[c] = true
+	}
+
+	processor.poolLock.Unlock()
+
+	for _, c := range closing {
+		processor.Infof("disconnecting device[%s]", deviceID)
+		c.Close()
+		processor.recordConnectionEvent(deviceID, defs.ConnectionEventDisconnected)
+	}
+
+	return len(closing)
+}
+
+// touch moves the connection to the end of the pool, marking it as the most recently active.
+func (processor *DeviceControlProcessor) touch(connection device.Connection) {
+	processor.poolLock.Lock()
+	defer processor.poolLock.Unlock()
+
+	if processor.remove(connection) {
+		processor.pool = append(processor.pool, connection)
+	}
 }
 
 func (processor *DeviceControlProcessor) unsubscribe(connection device.Connection) error {
 	defer connection.Close()
-	pool, targetID := make([]device.Connection, 0, len(processor.pool)-1), connection.GetID()
+	targetID := connection.GetID()
+
+	processor.poolLock.Lock()
+	removed := processor.remove(connection)
+	remaining := len(processor.connections(targetID))
+	retained := processor.retained[connection]
+	delete(processor.retained, connection)
+	processor.poolLock.Unlock()
+
+	// Connections evicted or replaced by track have already been taken out of the pool and had their event recorded.
+	if removed {
+		processor.recordConnectionEvent(targetID, defs.ConnectionEventDisconnected)
+	}
+
+	// The device is still connected on other connections (e.g it has reconnected); it should remain registered.
+	if remaining > 0 {
+		processor.Infof("closing connection of device[%s], %d connection(s) remaining", targetID, remaining)
+		return nil
+	}
+
+	if retained {
+		processor.Infof("closing disconnected connection of device[%s], keeping its registration", targetID)
+		return nil
+	}
 
 	if e := processor.index.RemoveDevice(targetID); e != nil {
 		processor.Errorf("unable to remove target from device index: %s", e.Error())
 		return e
 	}
 
-	for _, device := range processor.pool {
-		if deviceID := device.GetID(); deviceID == targetID {
-			continue
-		}
-
-		pool = append(pool, device)
+	if processor.events != nil {
+		processor.events.Dispatch(defs.WebhookDeviceDisconnectedEvent, targetID, nil)
 	}
 
-	processor.pool = pool
 	return nil
 }
 
+// recordConnectionEvent adds the event to the connection events of the device. Like the feedback of send failures,
+// failing to record the event is only logged.
+func (processor *DeviceControlProcessor) recordConnectionEvent(deviceID, eventType string) {
+	if processor.ConnectionEvents == nil {
+		return
+	}
+
+	event := device.ConnectionEvent{Type: eventType, Timestamp: time.Now()}
+
+	if e := processor.ConnectionEvents.RecordConnectionEvent(deviceID, event); e != nil {
+		processor.Warnf("unable to record %s event of device[%s]: %s", eventType, deviceID, e.Error())
+	}
+}
+
 func (processor *DeviceControlProcessor) welcome(connection device.Connection, wg *sync.WaitGroup) {
 	defer wg.Done()
 	secret, e := processor.key.SharedSecret()
@@ -173,6 +637,7 @@ func (processor *DeviceControlProcessor) welcome(connection device.Connection, w
 		DeviceID:     connection.GetID(),
 		Body:         defs.WelcomeMessageBody,
 		SharedSecret: secret,
+		ResumeToken:  processor.resumeToken(connection.GetID()),
 	})
 
 	if e != nil {
@@ -193,15 +658,30 @@ func (processor *DeviceControlProcessor) welcome(connection device.Connection, w
 		return
 	}
 
+	processor.touch(connection)
 	processor.Infof("welcomed device[%s]", connection.GetID())
 }
 
+// resumeToken issues the token the device can reconnect w/ to keep its id, returning an empty string if unable to.
+func (processor *DeviceControlProcessor) resumeToken(deviceID string) string {
+	if processor.Resumes == nil {
+		return ""
+	}
+
+	token, e := processor.Resumes.IssueResumeToken(deviceID)
+
+	if e != nil {
+		processor.Warnf("unable to issue resume token for device[%s]: %s", deviceID, e.Error())
+		return ""
+	}
+
+	return token
+}
+
 func (processor *DeviceControlProcessor) subscribe(connection device.Connection, wg *sync.WaitGroup) error {
 	defer wg.Done()
 	defer processor.unsubscribe(connection)
 
-	// Immediately add this connection to our processor pool.
-	processor.pool = append(processor.pool, connection)
 	processor.Infof("subscribing to device[%s]", connection.GetID())
 
 	for {
@@ -212,6 +692,99 @@ func (processor *DeviceControlProcessor) subscribe(connection device.Connection,
 			return e
 		}
 
-		processor.channels.Feedback <- reader
+		processor.touch(connection)
+		feedback, e := processor.bind(connection.GetID(), reader)
+
+		if e != nil {
+			processor.Warnf("dropping feedback from device[%s]: %s", connection.GetID(), e.Error())
+			continue
+		}
+
+		processor.channels.Feedback <- processor.acknowledge(connection.GetID(), feedback)
+	}
+}
+
+// bind ties feedback received on a connection to the device the connection belongs to; feedback sent on behalf of
+// another device is rejected, while feedback w/o a device id is given the id of the connection's device. Data that
+// is not a feedback message is passed along as-is, to be dropped by the feedback processor.
+func (processor *DeviceControlProcessor) bind(deviceID string, reader io.Reader) (io.Reader, error) {
+	data, e := ioutil.ReadAll(reader)
+
+	if e != nil {
+		return nil, e
+	}
+
+	message := interchange.FeedbackMessage{}
+
+	if e := proto.Unmarshal(data, &message); e != nil {
+		return bytes.NewBuffer(data), nil
+	}
+
+	claimed := message.GetAuthentication().GetDeviceID()
+
+	if claimed == deviceID {
+		return bytes.NewBuffer(data), nil
 	}
+
+	if claimed != "" {
+		processor.Warnf("device[%s] sent feedback on behalf of device[%s]", deviceID, claimed)
+		return nil, defs.Error(defs.ErrFeedbackDeviceMismatch)
+	}
+
+	if message.Authentication == nil {
+		message.Authentication = &interchange.DeviceMessageAuthentication{}
+	}
+
+	message.Authentication.DeviceID = deviceID
+	bound, e := proto.Marshal(&message)
+
+	if e != nil {
+		return nil, e
+	}
+
+	return bytes.NewBuffer(bound), nil
+}
+
+// acknowledge records the status of the command referenced by a feedback message from the device, if any, returning a
+// reader w/ the same contents for the feedback channel. Error feedback marks the command as failed.
+func (processor *DeviceControlProcessor) acknowledge(deviceID string, reader io.Reader) io.Reader {
+	if processor.Commands == nil {
+		return reader
+	}
+
+	data, e := ioutil.ReadAll(reader)
+
+	if e != nil {
+		processor.Warnf("unable to read feedback from device[%s]: %s", deviceID, e.Error())
+		return bytes.NewBuffer(data)
+	}
+
+	message := interchange.FeedbackMessage{}
+
+	if e := proto.Unmarshal(data, &message); e != nil || message.GetCommandID() == "" {
+		return bytes.NewBuffer(data)
+	}
+
+	status := defs.CommandStatusAcknowledged
+
+	if message.GetType() == interchange.FeedbackMessageType_ERROR {
+		status = defs.CommandStatusFailed
+	}
+
+	processor.updateCommand(message.GetCommandID(), deviceID, status)
+	return bytes.NewBuffer(data)
+}
+
+// updateCommand sets the status of a command sent to a device, ignoring messages that were sent w/o a command id.
+func (processor *DeviceControlProcessor) updateCommand(commandID, deviceID, status string) {
+	if processor.Commands == nil || commandID == "" {
+		return
+	}
+
+	if e := processor.Commands.UpdateCommandStatus(commandID, deviceID, status); e != nil {
+		processor.Warnf("unable to mark command[%s] as %s: %s", commandID, status, e.Error())
+		return
+	}
+
+	processor.Infof("command[%s] sent to device[%s] %s", commandID, deviceID, status)
 }
@@ -4,13 +4,16 @@ import "io"
 import "fmt"
 import "log"
 import "sync"
+import "time"
 import "bytes"
 import "strings"
+import "io/ioutil"
 import "testing"
 import "crypto/rsa"
 import "crypto/rand"
 import "github.com/franela/goblin"
 import "github.com/golang/protobuf/proto"
+import "github.com/dadleyy/beacon.api/beacon/defs"
 import "github.com/dadleyy/beacon.api/beacon/device"
 import "github.com/dadleyy/beacon.api/beacon/logging"
 import "github.com/dadleyy/beacon.api/beacon/security"
@@ -27,6 +30,7 @@ type deviceControlScaffold struct {
 	log           *bytes.Buffer
 	connections   []device.Connection
 	index         *testDeviceIndex
+	events        *testEventDispatcher
 	channels      []chan io.Reader
 	registrations device.RegistrationStream
 	processor     *DeviceControlProcessor
@@ -41,6 +45,8 @@ func (s *deviceControlScaffold) Reset() {
 
 	s.index = &testDeviceIndex{}
 
+	s.events = &testEventDispatcher{}
+
 	s.channels = []chan io.Reader{
 		make(chan io.Reader, 1),
 		make(chan io.Reader, 1),
@@ -66,8 +72,9 @@ func (s *deviceControlScaffold) Reset() {
 			Feedback:      s.channels[1],
 			Registrations: s.registrations,
 		},
-		index: s.index,
-		pool:  s.connections,
+		index:  s.index,
+		pool:   s.connections,
+		events: s.events,
 	}
 
 	s.wg = &sync.WaitGroup{}
@@ -117,8 +124,165 @@ func (i testDeviceIndex) FindDevice(string) (device.RegistrationDetails, error)
 	return device.RegistrationDetails{}, i.lastErrorOrNotFound(i.errors)
 }
 
+type testEventDispatcher struct {
+	sync.Mutex
+	kinds     []string
+	deviceIDs []string
+}
+
+func (d *testEventDispatcher) Dispatch(kind, deviceID string, payload interface{}) {
+	d.Lock()
+	defer d.Unlock()
+	d.kinds = append(d.kinds, kind)
+	d.deviceIDs = append(d.deviceIDs, deviceID)
+}
+
+type testCommandStore struct {
+	sync.Mutex
+	statuses map[string]string
+	devices  map[string]string
+}
+
+func (s *testCommandStore) TrackCommand(commandID, deviceID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.statuses == nil {
+		s.statuses, s.devices = make(map[string]string), make(map[string]string)
+	}
+
+	s.statuses[commandID], s.devices[commandID] = defs.CommandStatusPending, deviceID
+	return nil
+}
+
+func (s *testCommandStore) UpdateCommandStatus(commandID, deviceID, status string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if owner, ok := s.devices[commandID]; ok != true || owner != deviceID {
+		return fmt.Errorf("not-found")
+	}
+
+	s.statuses[commandID] = status
+	return nil
+}
+
+func (s *testCommandStore) GetCommandStatus(commandID string) (device.CommandStatus, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	status, ok := s.statuses[commandID]
+
+	if ok != true {
+		return device.CommandStatus{}, fmt.Errorf("not-found")
+	}
+
+	return device.CommandStatus{CommandID: commandID, DeviceID: s.devices[commandID], Status: status}, nil
+}
+
+func (s *testCommandStore) status(commandID string) string {
+	status, _ := s.GetCommandStatus(commandID)
+	return status.Status
+}
+
+type testResumeStore struct {
+	token string
+}
+
+func (s *testResumeStore) IssueResumeToken(string) (string, error) {
+	return s.token, nil
+}
+
+func (s *testResumeStore) ResumeDevice(string, string) (string, error) {
+	return "", fmt.Errorf("not-found")
+}
+
+type testFeedbackStore struct {
+	sync.Mutex
+	logged   []interchange.FeedbackMessage
+	recorded []interchange.FeedbackMessage
+	errors   []error
+}
+
+func (s *testFeedbackStore) LogFeedback(message interchange.FeedbackMessage) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.errors) >= 1 {
+		return s.errors[0]
+	}
+
+	s.logged = append(s.logged, message)
+	return nil
+}
+
+func (s *testFeedbackStore) RecordFeedback(message interchange.FeedbackMessage) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.errors) >= 1 {
+		return s.errors[0]
+	}
+
+	s.recorded = append(s.recorded, message)
+	return nil
+}
+
+func (s *testFeedbackStore) LogFeedbackBatch([]interchange.FeedbackMessage) error {
+	return fmt.Errorf("not-implemented")
+}
+
+func (s *testFeedbackStore) ListFeedback(string, int) ([]interchange.FeedbackMessage, error) {
+	return nil, fmt.Errorf("not-implemented")
+}
+
+func (s *testFeedbackStore) ListFeedbackPage(string, string, int) ([]interchange.FeedbackMessage, string, error) {
+	return nil, "", fmt.Errorf("not-implemented")
+}
+
+func (s *testFeedbackStore) ListFeedbackByLevel(
+	string, int, interchange.FeedbackLevel,
+) ([]interchange.FeedbackMessage, error) {
+	return nil, fmt.Errorf("not-implemented")
+}
+
+func (s *testFeedbackStore) FeedbackStats(string, time.Duration) (map[string]int, error) {
+	return nil, fmt.Errorf("not-implemented")
+}
+
+func (s *testFeedbackStore) QueryFeedback(string, device.FeedbackQuery) ([]interchange.FeedbackMessage, error) {
+	return nil, fmt.Errorf("not-implemented")
+}
+
+type testConnectionEventLog struct {
+	sync.Mutex
+	devices []string
+	events  []string
+	errors  []error
+}
+
+func (l *testConnectionEventLog) RecordConnectionEvent(deviceID string, event device.ConnectionEvent) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.errors) >= 1 {
+		return l.errors[0]
+	}
+
+	l.devices = append(l.devices, deviceID)
+	l.events = append(l.events, event.Type)
+	return nil
+}
+
+func (l *testConnectionEventLog) ListConnectionEvents(string, int) ([]device.ConnectionEvent, error) {
+	return nil, fmt.Errorf("not-implemented")
+}
+
 type testConnection struct {
 	lastErrorLister
+	sync.Mutex
+	block        chan struct{}
+	sentAtClose  int
 	closed       bool
 	id           string
 	sentMessages []interchange.DeviceMessage
@@ -131,6 +295,13 @@ func (c *testConnection) GetID() string {
 }
 
 func (c *testConnection) Send(m interchange.DeviceMessage) error {
+	if c.block != nil {
+		<-c.block
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
 	if c.sentMessages == nil {
 		c.sentMessages = make([]interchange.DeviceMessage, 0)
 	}
@@ -151,7 +322,15 @@ func (c *testConnection) Receive() (io.Reader, error) {
 }
 
 func (c *testConnection) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.block != nil && c.closed != true {
+		close(c.block)
+	}
+
 	c.closed = true
+	c.sentAtClose = len(c.sentMessages)
 	return nil
 }
 
@@ -200,6 +379,131 @@ func Test_DeviceControl(t *testing.T) {
 				g.Assert(ok).Equal(true)
 				g.Assert(reader.String()).Equal("hello world")
 			})
+
+			g.Describe("w/ a command store", func() {
+				var commands *testCommandStore
+
+				feedback := func(kind interchange.FeedbackMessageType, commandID string) io.Reader {
+					data, _ := proto.Marshal(&interchange.FeedbackMessage{Type: kind, CommandID: commandID})
+					return bytes.NewBuffer(data)
+				}
+
+				g.BeforeEach(func() {
+					commands = &testCommandStore{}
+					commands.TrackCommand("command-id", "some-device")
+					scaffold.processor.Commands = commands
+					connection.id = "some-device"
+				})
+
+				g.It("acknowledges the command referenced by feedback from the device", func() {
+					wg.Add(1)
+					connection.readers = append(connection.readers, feedback(interchange.FeedbackMessageType_REPORT, "command-id"))
+					scaffold.processor.subscribe(connection, wg)
+					wg.Wait()
+					g.Assert(commands.status("command-id")).Equal(defs.CommandStatusAcknowledged)
+				})
+
+				g.It("fails the command referenced by error feedback from the device", func() {
+					wg.Add(1)
+					connection.readers = append(connection.readers, feedback(interchange.FeedbackMessageType_ERROR, "command-id"))
+					scaffold.processor.subscribe(connection, wg)
+					wg.Wait()
+					g.Assert(commands.status("command-id")).Equal(defs.CommandStatusFailed)
+				})
+
+				g.It("does not acknowledge commands sent to other devices", func() {
+					wg.Add(1)
+					connection.id = "other-device"
+					connection.readers = append(connection.readers, feedback(interchange.FeedbackMessageType_REPORT, "command-id"))
+					scaffold.processor.subscribe(connection, wg)
+					wg.Wait()
+					g.Assert(commands.status("command-id")).Equal(defs.CommandStatusPending)
+				})
+
+				g.It("still sends the feedback along to the feedback channel", func() {
+					wg.Add(1)
+					connection.readers = append(connection.readers, feedback(interchange.FeedbackMessageType_REPORT, "command-id"))
+					scaffold.processor.subscribe(connection, wg)
+					wg.Wait()
+					message := interchange.FeedbackMessage{}
+					data, _ := ioutil.ReadAll(<-scaffold.channels[1])
+					g.Assert(proto.Unmarshal(data, &message)).Equal(nil)
+					g.Assert(message.CommandID).Equal("command-id")
+				})
+			})
+
+			g.Describe("w/ feedback identifying a device", func() {
+				var commands *testCommandStore
+
+				feedback := func(deviceID string) io.Reader {
+					data, _ := proto.Marshal(&interchange.FeedbackMessage{
+						Type:      interchange.FeedbackMessageType_REPORT,
+						CommandID: "command-id",
+						Authentication: &interchange.DeviceMessageAuthentication{
+							DeviceID:      deviceID,
+							MessageDigest: "digest",
+						},
+					})
+					return bytes.NewBuffer(data)
+				}
+
+				received := func() interchange.FeedbackMessage {
+					message := interchange.FeedbackMessage{}
+					data, _ := ioutil.ReadAll(<-scaffold.channels[1])
+					g.Assert(proto.Unmarshal(data, &message)).Equal(nil)
+					return message
+				}
+
+				g.BeforeEach(func() {
+					commands = &testCommandStore{}
+					commands.TrackCommand("command-id", "some-device")
+					scaffold.processor.Commands = commands
+					connection.id = "some-device"
+				})
+
+				g.It("sends feedback matching the connection's device along to the feedback channel", func() {
+					wg.Add(1)
+					connection.readers = append(connection.readers, feedback("some-device"))
+					scaffold.processor.subscribe(connection, wg)
+					wg.Wait()
+					message := received()
+					g.Assert(message.GetAuthentication().GetDeviceID()).Equal("some-device")
+					g.Assert(commands.status("command-id")).Equal(defs.CommandStatusAcknowledged)
+				})
+
+				g.It("drops feedback sent on behalf of another device", func() {
+					wg.Add(1)
+					connection.readers = append(connection.readers, feedback("other-device"))
+					scaffold.processor.subscribe(connection, wg)
+					wg.Wait()
+					g.Assert(len(scaffold.channels[1])).Equal(0)
+					g.Assert(commands.status("command-id")).Equal(defs.CommandStatusPending)
+				})
+
+				g.It("rejects feedback claimed by another device w/ the feedback device mismatch error", func() {
+					_, e := scaffold.processor.bind("some-device", feedback("other-device"))
+					g.Assert(e == defs.Error(defs.ErrFeedbackDeviceMismatch)).Equal(true)
+				})
+
+				g.It("continues receiving from the connection after dropping spoofed feedback", func() {
+					wg.Add(1)
+					connection.readers = append(connection.readers, feedback("other-device"), feedback("some-device"))
+					scaffold.processor.subscribe(connection, wg)
+					wg.Wait()
+					message := received()
+					g.Assert(message.GetAuthentication().GetDeviceID()).Equal("some-device")
+				})
+
+				g.It("fills in the connection's device id when the feedback does not identify a device", func() {
+					wg.Add(1)
+					connection.readers = append(connection.readers, feedback(""))
+					scaffold.processor.subscribe(connection, wg)
+					wg.Wait()
+					message := received()
+					g.Assert(message.GetAuthentication().GetDeviceID()).Equal("some-device")
+					g.Assert(message.GetAuthentication().GetMessageDigest()).Equal("digest")
+				})
+			})
 		})
 
 		g.Describe("#unsubscribe", func() {
@@ -231,6 +535,390 @@ func Test_DeviceControl(t *testing.T) {
 				g.Assert(len(scaffold.processor.pool)).Equal(2)
 			})
 
+			g.It("dispatches a disconnected event for the evicted device", func() {
+				scaffold.processor.unsubscribe(connection)
+				g.Assert(scaffold.events.kinds).Equal([]string{defs.WebhookDeviceDisconnectedEvent})
+				g.Assert(scaffold.events.deviceIDs).Equal([]string{"patriots"})
+			})
+
+			g.It("does not dispatch a disconnected event if unable to remove from the index", func() {
+				scaffold.index.errors = []error{fmt.Errorf("bad-remove")}
+				scaffold.processor.unsubscribe(connection)
+				g.Assert(len(scaffold.events.kinds)).Equal(0)
+			})
+
+		})
+
+		g.Describe("pool capacity", func() {
+			connections := make([]*testConnection, 3)
+
+			g.BeforeEach(func() {
+				for i := range connections {
+					connections[i] = &testConnection{id: fmt.Sprintf("device-%d", i)}
+				}
+			})
+
+			g.It("reports whether a device has a connection in the pool", func() {
+				scaffold.processor.track(connections[0])
+				g.Assert(scaffold.processor.Connected("device-0")).Equal(true)
+				g.Assert(scaffold.processor.Connected("device-1")).Equal(false)
+			})
+
+			g.It("leaves the pool unbounded w/o a max connection count", func() {
+				for _, c := range connections {
+					scaffold.processor.track(c)
+				}
+
+				g.Assert(scaffold.processor.PoolSize()).Equal(3)
+				g.Assert(scaffold.processor.PoolCapacity()).Equal(0)
+				g.Assert(connections[0].closed).Equal(false)
+			})
+
+			g.Describe("w/ a max connection count", func() {
+				g.BeforeEach(func() {
+					scaffold.processor.MaxConnections = 2
+				})
+
+				g.It("closes and evicts the oldest connection once over capacity", func() {
+					for _, c := range connections {
+						scaffold.processor.track(c)
+					}
+
+					g.Assert(scaffold.processor.PoolSize()).Equal(2)
+					g.Assert(scaffold.processor.PoolCapacity()).Equal(2)
+					g.Assert(connections[0].closed).Equal(true)
+					g.Assert(connections[1].closed).Equal(false)
+					g.Assert(scaffold.processor.find("device-0") == nil).Equal(true)
+					g.Assert(strings.Contains(scaffold.log.String(), "evicting device[device-0]")).Equal(true)
+				})
+
+				g.It("evicts the least recently active connection rather than the oldest", func() {
+					scaffold.processor.track(connections[0])
+					scaffold.processor.track(connections[1])
+					scaffold.processor.touch(connections[0])
+					scaffold.processor.track(connections[2])
+
+					g.Assert(connections[0].closed).Equal(false)
+					g.Assert(connections[1].closed).Equal(true)
+					g.Assert(scaffold.processor.find("device-0") != nil).Equal(true)
+				})
+
+				g.It("marks a connection as active after relaying a command to it", func() {
+					scaffold.processor.track(connections[0])
+					scaffold.processor.track(connections[1])
+
+					message, e := proto.Marshal(&interchange.DeviceMessage{
+						Authentication: &interchange.DeviceMessageAuthentication{DeviceID: "device-0"},
+					})
+					g.Assert(e).Equal(nil)
+
+					wg := &sync.WaitGroup{}
+					wg.Add(1)
+					scaffold.processor.handle(bytes.NewBuffer(message), wg)
+					scaffold.processor.track(connections[2])
+
+					g.Assert(connections[0].closed).Equal(false)
+					g.Assert(connections[1].closed).Equal(true)
+				})
+			})
+		})
+
+		g.Describe("w/ a connection event log", func() {
+			var events *testConnectionEventLog
+			var connections []*testConnection
+
+			g.BeforeEach(func() {
+				events = &testConnectionEventLog{}
+				scaffold.processor.ConnectionEvents = events
+				scaffold.processor.MaxConnections = 1
+				connections = []*testConnection{{id: "device-0"}, {id: "device-1"}}
+			})
+
+			g.It("records a connected event for each registered connection", func() {
+				scaffold.processor.track(connections[0])
+				g.Assert(events.devices).Equal([]string{"device-0"})
+				g.Assert(events.events).Equal([]string{defs.ConnectionEventConnected})
+			})
+
+			g.It("records a disconnected event after the connected event of an evicted connection", func() {
+				scaffold.processor.track(connections[0])
+				scaffold.processor.track(connections[1])
+				g.Assert(connections[0].closed).Equal(true)
+				g.Assert(events.devices).Equal([]string{"device-0", "device-1", "device-0"})
+				g.Assert(events.events).Equal([]string{
+					defs.ConnectionEventConnected,
+					defs.ConnectionEventConnected,
+					defs.ConnectionEventDisconnected,
+				})
+			})
+
+			g.It("does not record the eviction again once the evicted connection is unsubscribed", func() {
+				scaffold.processor.track(connections[0])
+				scaffold.processor.track(connections[1])
+				scaffold.processor.unsubscribe(connections[0])
+				g.Assert(len(events.events)).Equal(3)
+			})
+
+			g.It("records a disconnected event when a pooled connection is unsubscribed", func() {
+				scaffold.processor.track(connections[0])
+				g.Assert(scaffold.processor.unsubscribe(connections[0])).Equal(nil)
+				g.Assert(events.events).Equal([]string{defs.ConnectionEventConnected, defs.ConnectionEventDisconnected})
+			})
+
+			g.It("does not reject the connection if unable to record the event", func() {
+				events.errors = []error{fmt.Errorf("bad-record")}
+				g.Assert(scaffold.processor.track(connections[0])).Equal(true)
+				g.Assert(strings.Contains(scaffold.log.String(), "bad-record")).Equal(true)
+			})
+		})
+
+		g.Describe("resumed connections", func() {
+			var previous, resumed *testConnection
+
+			g.BeforeEach(func() {
+				previous, resumed = &testConnection{id: "device-1"}, &testConnection{id: "device-1"}
+				scaffold.processor.track(&testConnection{id: "device-0"})
+				scaffold.processor.track(previous)
+				scaffold.processor.track(resumed)
+			})
+
+			g.It("replaces the pool entry of the previous connection, closing it", func() {
+				g.Assert(scaffold.processor.PoolSize()).Equal(2)
+				g.Assert(scaffold.processor.find("device-1") == device.Connection(resumed)).Equal(true)
+				g.Assert(previous.closed).Equal(true)
+				g.Assert(resumed.closed).Equal(false)
+			})
+
+			g.It("keeps the device registered once the previous connection is unsubscribed", func() {
+				g.Assert(scaffold.processor.unsubscribe(previous)).Equal(nil)
+				g.Assert(scaffold.processor.find("device-1") == device.Connection(resumed)).Equal(true)
+				g.Assert(len(scaffold.events.kinds)).Equal(0)
+			})
+		})
+
+		g.Describe("#Disconnect", func() {
+			var first, second, other *testConnection
+
+			g.BeforeEach(func() {
+				scaffold.processor.MaxDeviceConnections = 2
+				first, second = &testConnection{id: "device-1"}, &testConnection{id: "device-1"}
+				other = &testConnection{id: "device-2"}
+				scaffold.processor.track(first)
+				scaffold.processor.track(other)
+				scaffold.processor.track(second)
+			})
+
+			g.It("closes every connection of the device, taking them out of the pool", func() {
+				g.Assert(scaffold.processor.Disconnect("device-1")).Equal(2)
+				g.Assert(first.closed && second.closed).Equal(true)
+				g.Assert(other.closed).Equal(false)
+				g.Assert(scaffold.processor.Connected("device-1")).Equal(false)
+				g.Assert(scaffold.processor.PoolSize()).Equal(1)
+			})
+
+			g.It("returns zero for devices w/o a connection", func() {
+				g.Assert(scaffold.processor.Disconnect("device-3")).Equal(0)
+				g.Assert(scaffold.processor.PoolSize()).Equal(3)
+			})
+
+			g.It("keeps the device registered once its closed connections are unsubscribed", func() {
+				scaffold.index.errors = []error{fmt.Errorf("bad-remove")}
+				scaffold.processor.Disconnect("device-1")
+				g.Assert(scaffold.processor.unsubscribe(first)).Equal(nil)
+				g.Assert(scaffold.processor.unsubscribe(second)).Equal(nil)
+				g.Assert(len(scaffold.events.kinds)).Equal(0)
+				g.Assert(len(scaffold.processor.retained)).Equal(0)
+			})
+
+			g.It("removes the device once a connection made after the disconnect is unsubscribed", func() {
+				scaffold.processor.Disconnect("device-1")
+				reconnected := &testConnection{id: "device-1"}
+				scaffold.processor.track(reconnected)
+				g.Assert(scaffold.processor.unsubscribe(reconnected)).Equal(nil)
+				g.Assert(scaffold.events.kinds).Equal([]string{defs.WebhookDeviceDisconnectedEvent})
+			})
+		})
+
+		g.Describe("per device connection limits", func() {
+			connections := make([]*testConnection, 3)
+
+			g.BeforeEach(func() {
+				for i := range connections {
+					connections[i] = &testConnection{id: "limited-device"}
+				}
+
+				scaffold.processor.MaxDeviceConnections = 2
+			})
+
+			g.Describe("w/ the evict oldest policy", func() {
+				g.BeforeEach(func() {
+					scaffold.processor.DeviceConnectionPolicy = defs.DeviceConnectionPolicyEvictOldest
+				})
+
+				g.It("holds connections for the device up to the limit", func() {
+					g.Assert(scaffold.processor.track(connections[0])).Equal(true)
+					g.Assert(scaffold.processor.track(connections[1])).Equal(true)
+					g.Assert(scaffold.processor.PoolSize()).Equal(2)
+					g.Assert(connections[0].closed).Equal(false)
+					g.Assert(connections[1].closed).Equal(false)
+				})
+
+				g.It("closes the least recently active connection of the device once beyond the limit", func() {
+					for _, c := range connections {
+						g.Assert(scaffold.processor.track(c)).Equal(true)
+					}
+
+					g.Assert(scaffold.processor.PoolSize()).Equal(2)
+					g.Assert(connections[0].closed).Equal(true)
+					g.Assert(connections[1].closed).Equal(false)
+					g.Assert(connections[2].closed).Equal(false)
+					g.Assert(scaffold.processor.find("limited-device") == device.Connection(connections[2])).Equal(true)
+				})
+
+				g.It("keeps the device registered while it has other connections", func() {
+					for _, c := range connections {
+						scaffold.processor.track(c)
+					}
+
+					g.Assert(scaffold.processor.unsubscribe(connections[0])).Equal(nil)
+					g.Assert(scaffold.processor.unsubscribe(connections[1])).Equal(nil)
+					g.Assert(len(scaffold.events.kinds)).Equal(0)
+					g.Assert(scaffold.processor.unsubscribe(connections[2])).Equal(nil)
+					g.Assert(scaffold.events.kinds).Equal([]string{defs.WebhookDeviceDisconnectedEvent})
+					g.Assert(scaffold.processor.PoolSize()).Equal(0)
+				})
+			})
+
+			g.Describe("w/ the reject new policy", func() {
+				g.BeforeEach(func() {
+					scaffold.processor.DeviceConnectionPolicy = defs.DeviceConnectionPolicyRejectNew
+				})
+
+				g.It("rejects connections for the device once beyond the limit, leaving existing ones open", func() {
+					g.Assert(scaffold.processor.track(connections[0])).Equal(true)
+					g.Assert(scaffold.processor.track(connections[1])).Equal(true)
+					g.Assert(scaffold.processor.track(connections[2])).Equal(false)
+
+					g.Assert(scaffold.processor.PoolSize()).Equal(2)
+					g.Assert(connections[0].closed).Equal(false)
+					g.Assert(connections[1].closed).Equal(false)
+					g.Assert(scaffold.processor.find("limited-device") == device.Connection(connections[1])).Equal(true)
+					g.Assert(strings.Contains(scaffold.log.String(), "rejecting new connection")).Equal(true)
+				})
+
+				g.It("does not count connections of other devices against the limit", func() {
+					scaffold.processor.track(connections[0])
+					scaffold.processor.track(connections[1])
+					g.Assert(scaffold.processor.track(&testConnection{id: "other-device"})).Equal(true)
+					g.Assert(scaffold.processor.PoolSize()).Equal(3)
+				})
+
+				g.It("closes rejected registrations w/o welcoming them", func() {
+					scaffold.processor.track(connections[0])
+					scaffold.processor.track(connections[1])
+
+					scaffold.wg.Add(1)
+					scaffold.registrations <- connections[2]
+					go scaffold.processor.Start(scaffold.wg, scaffold.kill)
+					close(scaffold.registrations)
+					scaffold.wg.Wait()
+
+					g.Assert(connections[2].closed).Equal(true)
+					g.Assert(len(connections[2].sentMessages)).Equal(0)
+				})
+			})
+		})
+
+		g.Describe("#handle w/ a coalesce window", func() {
+			var commands *testCommandStore
+			var connections []*testConnection
+			var wg *sync.WaitGroup
+
+			command := func(deviceID, commandID string) io.Reader {
+				b, _ := proto.Marshal(&interchange.DeviceMessage{
+					Authentication: &interchange.DeviceMessageAuthentication{DeviceID: deviceID},
+					RequestID:      commandID,
+					CommandID:      commandID,
+				})
+				commands.TrackCommand(commandID, deviceID)
+				return bytes.NewBuffer(b)
+			}
+
+			// opened waits until the first command for the device has opened its coalesce window.
+			opened := func(deviceID string) {
+				for {
+					scaffold.processor.pendingLock.Lock()
+					_, open := scaffold.processor.pending[deviceID]
+					scaffold.processor.pendingLock.Unlock()
+
+					if open {
+						return
+					}
+
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			g.BeforeEach(func() {
+				commands, wg = &testCommandStore{}, &sync.WaitGroup{}
+				connections = []*testConnection{{id: "device-1"}, {id: "device-2"}}
+				scaffold.processor.Commands = commands
+				scaffold.processor.CoalesceWindow = 50 * time.Millisecond
+				scaffold.processor.pool = []device.Connection{connections[0], connections[1]}
+			})
+
+			g.It("only sends the final command received for a device during the window", func() {
+				wg.Add(3)
+				go scaffold.processor.handle(command("device-1", "command-1"), wg)
+				opened("device-1")
+				scaffold.processor.handle(command("device-1", "command-2"), wg)
+				scaffold.processor.handle(command("device-1", "command-3"), wg)
+				wg.Wait()
+
+				g.Assert(len(connections[0].sentMessages)).Equal(1)
+				g.Assert(connections[0].sentMessages[0].CommandID).Equal("command-3")
+				g.Assert(commands.status("command-1")).Equal(defs.CommandStatusSuperseded)
+				g.Assert(commands.status("command-2")).Equal(defs.CommandStatusSuperseded)
+				g.Assert(commands.status("command-3")).Equal(defs.CommandStatusPending)
+			})
+
+			g.It("returns from handling commands w/o waiting for the window to close", func() {
+				wg.Add(2)
+				started := time.Now()
+				scaffold.processor.handle(command("device-1", "command-1"), wg)
+				scaffold.processor.handle(command("device-1", "command-2"), wg)
+				g.Assert(time.Since(started) < scaffold.processor.CoalesceWindow).Equal(true)
+				wg.Wait()
+
+				g.Assert(len(connections[0].sentMessages)).Equal(1)
+				g.Assert(connections[0].sentMessages[0].CommandID).Equal("command-2")
+			})
+
+			g.It("does not coalesce the commands of other devices", func() {
+				wg.Add(3)
+				go scaffold.processor.handle(command("device-1", "command-1"), wg)
+				opened("device-1")
+				go scaffold.processor.handle(command("device-2", "command-2"), wg)
+				opened("device-2")
+				scaffold.processor.handle(command("device-1", "command-3"), wg)
+				wg.Wait()
+
+				g.Assert(len(connections[0].sentMessages)).Equal(1)
+				g.Assert(connections[0].sentMessages[0].CommandID).Equal("command-3")
+				g.Assert(len(connections[1].sentMessages)).Equal(1)
+				g.Assert(connections[1].sentMessages[0].CommandID).Equal("command-2")
+			})
+
+			g.It("sends commands received after the window has closed", func() {
+				wg.Add(1)
+				scaffold.processor.handle(command("device-1", "command-1"), wg)
+				wg.Wait()
+				wg.Add(1)
+				scaffold.processor.handle(command("device-1", "command-2"), wg)
+				wg.Wait()
+
+				g.Assert(len(connections[0].sentMessages)).Equal(2)
+			})
 		})
 
 		g.Describe("#Start", func() {
@@ -261,6 +949,20 @@ func Test_DeviceControl(t *testing.T) {
 					g.Assert(welcome.GetDeviceID()).Equal("some-device")
 				})
 
+				g.It("includes a resume token in the welcome message when given a resume store", func() {
+					connection := &testConnection{
+						id: "some-device",
+					}
+					scaffold.processor.Resumes = &testResumeStore{token: "resume-token"}
+					scaffold.registrations <- connection
+					go scaffold.processor.Start(scaffold.wg, scaffold.kill)
+					close(scaffold.registrations)
+					scaffold.wg.Wait()
+					welcome := interchange.WelcomeMessage{}
+					g.Assert(proto.Unmarshal(connection.sentMessages[0].GetPayload(), &welcome)).Equal(nil)
+					g.Assert(welcome.GetResumeToken()).Equal("resume-token")
+				})
+
 				g.It("logs any errors that come out of the connection's message delivery", func() {
 					connection := &testConnection{
 						errors: []error{fmt.Errorf("bad-welcome-send")},
@@ -309,10 +1011,43 @@ func Test_DeviceControl(t *testing.T) {
 							Authentication: &interchange.DeviceMessageAuthentication{
 								DeviceID: "some-device",
 							},
+							RequestID: "some-request-id",
+							CommandID: "command-id",
 						})
 						scaffold.channels[0] <- bytes.NewBuffer(b)
 					})
 
+					g.It("fails the command if unable to find the device", func() {
+						commands := &testCommandStore{}
+						commands.TrackCommand("command-id", "some-device")
+						scaffold.processor.Commands = commands
+						go scaffold.processor.Start(scaffold.wg, scaffold.kill)
+						close(scaffold.channels[0])
+						scaffold.wg.Wait()
+						g.Assert(commands.status("command-id")).Equal(defs.CommandStatusFailed)
+					})
+
+					g.It("leaves the command pending until acknowledged once relayed to the device", func() {
+						commands := &testCommandStore{}
+						commands.TrackCommand("command-id", "some-device")
+						scaffold.processor.Commands = commands
+						connection := &testConnection{id: "some-device"}
+						scaffold.processor.pool = append(scaffold.processor.pool, connection)
+						go scaffold.processor.Start(scaffold.wg, scaffold.kill)
+						close(scaffold.channels[0])
+						scaffold.wg.Wait()
+						g.Assert(len(connection.sentMessages)).Equal(1)
+						g.Assert(connection.sentMessages[0].CommandID).Equal("command-id")
+						g.Assert(commands.status("command-id")).Equal(defs.CommandStatusPending)
+
+						ack, _ := proto.Marshal(&interchange.FeedbackMessage{
+							Type:      interchange.FeedbackMessageType_REPORT,
+							CommandID: "command-id",
+						})
+						scaffold.processor.acknowledge("some-device", bytes.NewBuffer(ack))
+						g.Assert(commands.status("command-id")).Equal(defs.CommandStatusAcknowledged)
+					})
+
 					g.It("logs it's inability to find a device if none are found in the index", func() {
 						g.Assert(strings.Contains(scaffold.log.String(), "unable to locate")).Equal(false)
 						go scaffold.processor.Start(scaffold.wg, scaffold.kill)
@@ -333,6 +1068,17 @@ func Test_DeviceControl(t *testing.T) {
 						g.Assert(len(connection.sentMessages)).Equal(1)
 					})
 
+					g.It("logs the request id of the command once relayed to the device", func() {
+						connection := &testConnection{
+							id: "some-device",
+						}
+						scaffold.processor.pool = append(scaffold.processor.pool, connection)
+						go scaffold.processor.Start(scaffold.wg, scaffold.kill)
+						close(scaffold.channels[0])
+						scaffold.wg.Wait()
+						g.Assert(strings.Contains(scaffold.log.String(), "request: some-request-id")).Equal(true)
+					})
+
 					g.It("logs the error returned from the device, if exists", func() {
 						connection := &testConnection{
 							id:     "some-device",
@@ -348,6 +1094,87 @@ func Test_DeviceControl(t *testing.T) {
 						g.Assert(strings.Contains(scaffold.log.String(), "some-bad-write")).Equal(true)
 					})
 
+					g.Describe("w/ a feedback store and a device that fails to receive the command", func() {
+						var feedback *testFeedbackStore
+
+						g.BeforeEach(func() {
+							feedback = &testFeedbackStore{}
+							scaffold.processor.Feedback = feedback
+							scaffold.processor.pool = append(scaffold.processor.pool, &testConnection{
+								id:     "some-device",
+								errors: []error{fmt.Errorf("some-bad-write")},
+							})
+						})
+
+						g.It("records an error feedback message w/ the command context for the device", func() {
+							go scaffold.processor.Start(scaffold.wg, scaffold.kill)
+							close(scaffold.channels[0])
+							scaffold.wg.Wait()
+							g.Assert(len(feedback.recorded)).Equal(1)
+							g.Assert(len(feedback.logged)).Equal(0)
+							logged := feedback.recorded[0]
+							g.Assert(logged.GetAuthentication().GetDeviceID()).Equal("some-device")
+							g.Assert(logged.GetType()).Equal(interchange.FeedbackMessageType_ERROR)
+							g.Assert(logged.GetLevel()).Equal(interchange.FeedbackLevel_LEVEL_ERROR)
+							g.Assert(logged.GetCommandID()).Equal("command-id")
+							g.Assert(strings.Contains(string(logged.GetPayload()), "some-request-id")).Equal(true)
+							g.Assert(strings.Contains(string(logged.GetPayload()), "some-bad-write")).Equal(true)
+						})
+
+						g.It("only logs its inability to record the feedback w/o retrying", func() {
+							feedback.errors = append(feedback.errors, fmt.Errorf("bad-feedback-log"))
+							go scaffold.processor.Start(scaffold.wg, scaffold.kill)
+							close(scaffold.channels[0])
+							scaffold.wg.Wait()
+							g.Assert(len(feedback.recorded)).Equal(0)
+							g.Assert(strings.Count(scaffold.log.String(), "bad-feedback-log")).Equal(1)
+						})
+					})
+
+				})
+
+				g.Describe("having been given a control message w/ an issued at timestamp", func() {
+					var connection *testConnection
+					var commands *testCommandStore
+
+					send := func(issued time.Time) {
+						b, _ := proto.Marshal(&interchange.DeviceMessage{
+							Authentication: &interchange.DeviceMessageAuthentication{
+								DeviceID: "some-device",
+							},
+							CommandID: "command-id",
+							IssuedAt:  issued.Unix(),
+						})
+						scaffold.channels[0] <- bytes.NewBuffer(b)
+					}
+
+					g.BeforeEach(func() {
+						commands = &testCommandStore{}
+						commands.TrackCommand("command-id", "some-device")
+						connection = &testConnection{id: "some-device"}
+						scaffold.processor.Commands = commands
+						scaffold.processor.MaxCommandAge = time.Minute
+						scaffold.processor.pool = append(scaffold.processor.pool, connection)
+					})
+
+					g.It("relays commands issued within the max command age", func() {
+						send(time.Now())
+						go scaffold.processor.Start(scaffold.wg, scaffold.kill)
+						close(scaffold.channels[0])
+						scaffold.wg.Wait()
+						g.Assert(len(connection.sentMessages)).Equal(1)
+						g.Assert(commands.status("command-id")).Equal(defs.CommandStatusPending)
+					})
+
+					g.It("drops and fails commands older than the max command age", func() {
+						send(time.Now().Add(-time.Minute * 5))
+						go scaffold.processor.Start(scaffold.wg, scaffold.kill)
+						close(scaffold.channels[0])
+						scaffold.wg.Wait()
+						g.Assert(len(connection.sentMessages)).Equal(0)
+						g.Assert(commands.status("command-id")).Equal(defs.CommandStatusFailed)
+						g.Assert(strings.Contains(scaffold.log.String(), "dropping stale command")).Equal(true)
+					})
 				})
 
 				g.It("immediately stops when the command stream channel is closed", func() {
@@ -385,9 +1212,117 @@ func Test_DeviceControl(t *testing.T) {
 					scaffold.wg.Wait()
 					g.Assert(connection.closed).Equal(true)
 				})
+
+				g.Describe("having buffered commands", func() {
+					var commands chan io.Reader
+
+					g.BeforeEach(func() {
+						commands = make(chan io.Reader, 3)
+						scaffold.processor.channels.Commands = commands
+
+						for i := 0; i < 3; i++ {
+							b, _ := proto.Marshal(&interchange.DeviceMessage{
+								Authentication: &interchange.DeviceMessageAuthentication{DeviceID: "some-device"},
+							})
+							commands <- bytes.NewBuffer(b)
+						}
+					})
+
+					g.It("relays the buffered commands before closing the connections", func() {
+						connection := &testConnection{id: "some-device"}
+						scaffold.processor.pool = append(scaffold.processor.pool, connection)
+						scaffold.processor.Start(scaffold.wg, scaffold.kill)
+						scaffold.wg.Wait()
+						g.Assert(connection.closed).Equal(true)
+						g.Assert(connection.sentAtClose).Equal(3)
+						g.Assert(len(commands)).Equal(0)
+					})
+
+					g.It("closes the connections once the drain timeout has elapsed", func() {
+						connection := &testConnection{id: "some-device", block: make(chan struct{})}
+						scaffold.processor.pool = append(scaffold.processor.pool, connection)
+						scaffold.processor.DrainTimeout = time.Millisecond * 10
+						scaffold.processor.Start(scaffold.wg, scaffold.kill)
+						scaffold.wg.Wait()
+						g.Assert(connection.closed).Equal(true)
+						g.Assert(connection.sentAtClose).Equal(0)
+						g.Assert(strings.Contains(scaffold.log.String(), "drain timeout")).Equal(true)
+					})
+				})
 			})
 
 		})
 
+		g.Describe("#StartWorkers", func() {
+			g.BeforeEach(func() {
+				scaffold.wg.Add(1)
+			})
+
+			g.It("starts a single worker when given less than one", func() {
+				close(scaffold.registrations)
+				scaffold.processor.StartWorkers(0, nil, scaffold.wg, scaffold.kill)
+				scaffold.wg.Wait()
+				g.Assert(strings.Contains(scaffold.log.String(), "w/ 1 worker(s)")).Equal(true)
+			})
+
+			g.It("stops every worker once the kill switch is sent", func() {
+				go scaffold.sendKillSignal()
+				scaffold.processor.StartWorkers(4, nil, scaffold.wg, scaffold.kill)
+				scaffold.wg.Wait()
+				g.Assert(strings.Contains(scaffold.log.String(), "received kill signal")).Equal(true)
+			})
+
+			g.It("relays each command to its device exactly once", func() {
+				connection, commands := &testConnection{id: "some-device"}, make(chan io.Reader, 20)
+				scaffold.processor.pool = append(scaffold.processor.pool, connection)
+				channels := &DeviceChannels{Commands: commands, Registrations: scaffold.registrations}
+
+				for i := 0; i < 20; i++ {
+					b, _ := proto.Marshal(&interchange.DeviceMessage{
+						Authentication: &interchange.DeviceMessageAuthentication{DeviceID: "some-device"},
+						RequestID:      fmt.Sprintf("request-%d", i),
+					})
+					commands <- bytes.NewBuffer(b)
+				}
+
+				close(commands)
+				scaffold.processor.StartWorkers(4, channels, scaffold.wg, scaffold.kill)
+				scaffold.wg.Wait()
+
+				received := make(map[string]int)
+
+				for _, m := range connection.sentMessages {
+					received[m.GetRequestID()]++
+				}
+
+				g.Assert(len(connection.sentMessages)).Equal(20)
+
+				for i := 0; i < 20; i++ {
+					g.Assert(received[fmt.Sprintf("request-%d", i)]).Equal(1)
+				}
+			})
+
+			g.It("welcomes each registered connection exactly once", func() {
+				registrations := make(device.RegistrationStream, 5)
+				scaffold.processor.channels.Registrations = registrations
+				connections := make([]*testConnection, 0, 5)
+
+				for i := 0; i < 5; i++ {
+					connection := &testConnection{id: fmt.Sprintf("device-%d", i)}
+					connections = append(connections, connection)
+					registrations <- connection
+				}
+
+				close(registrations)
+				scaffold.processor.StartWorkers(3, nil, scaffold.wg, scaffold.kill)
+				scaffold.wg.Wait()
+
+				for _, c := range connections {
+					g.Assert(len(c.sentMessages)).Equal(1)
+					g.Assert(c.sentMessages[0].GetType()).Equal(interchange.DeviceMessageType_WELCOME)
+				}
+			})
+		})
+
 	})
 }
@@ -2,20 +2,26 @@ package bg
 
 import "io"
 import "sync"
+import "io/ioutil"
+
+import "github.com/golang/protobuf/proto"
 
 import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
 import "github.com/dadleyy/beacon.api/beacon/logging"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
 
 // NewDeviceFeedbackProcessor is responsible for receiving from the device feedback stream
-func NewDeviceFeedbackProcessor(feedback ReadStream) *DeviceFeedbackProcessor {
+func NewDeviceFeedbackProcessor(feedback ReadStream, stream device.FeedbackStream) *DeviceFeedbackProcessor {
 	logger := logging.New(defs.DeviceFeedbackLogPrefix, logging.Cyan)
-	return &DeviceFeedbackProcessor{logger, feedback}
+	return &DeviceFeedbackProcessor{logger, feedback, stream}
 }
 
 // DeviceFeedbackProcessor is responsible for receiving from the device feedback stream
 type DeviceFeedbackProcessor struct {
 	*logging.Logger
 	feedback <-chan io.Reader
+	stream   device.FeedbackStream
 }
 
 // Start is the Processor#Start implementation
@@ -27,12 +33,13 @@ func (processor *DeviceFeedbackProcessor) Start(wg *sync.WaitGroup, stop KillSwi
 
 	for running {
 		select {
-		case _, ok := <-processor.feedback:
+		case reader, ok := <-processor.feedback:
 			if ok != true {
 				return
 			}
 
 			processor.Debugf("receieved message from device")
+			processor.publish(reader)
 		case <-stop:
 			processor.Warnf("received kill signal, breaking")
 			running = false
@@ -40,3 +47,26 @@ func (processor *DeviceFeedbackProcessor) Start(wg *sync.WaitGroup, stop KillSwi
 		}
 	}
 }
+
+// publish attempts to unmarshal the feedback message from the reader and send it along to the feedback stream.
+func (processor *DeviceFeedbackProcessor) publish(reader io.Reader) {
+	if processor.stream == nil || reader == nil {
+		return
+	}
+
+	data, e := ioutil.ReadAll(reader)
+
+	if e != nil {
+		processor.Warnf("unable to read feedback message: %s", e.Error())
+		return
+	}
+
+	message := interchange.FeedbackMessage{}
+
+	if e := proto.Unmarshal(data, &message); e != nil {
+		processor.Warnf("unable to unmarshal feedback message: %s", e.Error())
+		return
+	}
+
+	processor.stream.Publish(message)
+}
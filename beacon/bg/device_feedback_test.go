@@ -6,12 +6,16 @@ import "bytes"
 import "strings"
 import "testing"
 import "github.com/franela/goblin"
+import "github.com/golang/protobuf/proto"
+
+import "github.com/dadleyy/beacon.api/beacon/interchange"
 
 type deviceFeedbackScaffold struct {
 	receiver  chan io.Reader
 	wg        *sync.WaitGroup
 	kill      KillSwitch
 	processor *DeviceFeedbackProcessor
+	broker    *FeedbackBroker
 	log       *bytes.Buffer
 }
 
@@ -20,9 +24,11 @@ func (s *deviceFeedbackScaffold) Reset() {
 	s.kill = make(KillSwitch, 1)
 	s.wg = &sync.WaitGroup{}
 	s.log = bytes.NewBuffer([]byte{})
+	s.broker = NewFeedbackBroker()
 	s.processor = &DeviceFeedbackProcessor{
 		Logger:   newTestLogger(s.log),
 		feedback: s.receiver,
+		stream:   s.broker,
 	}
 }
 
@@ -51,5 +57,31 @@ func Test_DeviceFeedback(t *testing.T) {
 			g.Assert(strings.Contains(s.log.String(), "kill signal")).Equal(true)
 		})
 
+		g.It("publishes valid feedback messages to the feedback stream", func() {
+			subscription := s.broker.Subscribe("device-123")
+			data, _ := proto.Marshal(&interchange.FeedbackMessage{
+				Authentication: &interchange.DeviceMessageAuthentication{DeviceID: "device-123"},
+				Payload:        []byte("hello"),
+			})
+			s.wg.Add(1)
+			go s.processor.Start(s.wg, s.kill)
+			s.receiver <- bytes.NewBuffer(data)
+			close(s.receiver)
+			s.wg.Wait()
+			message := <-subscription
+			g.Assert(string(message.Payload)).Equal("hello")
+		})
+
+		g.It("warns and skips feedback messages that cannot be unmarshalled", func() {
+			subscription := s.broker.Subscribe("device-123")
+			s.wg.Add(1)
+			go s.processor.Start(s.wg, s.kill)
+			s.receiver <- bytes.NewBuffer([]byte("}{"))
+			close(s.receiver)
+			s.wg.Wait()
+			g.Assert(len(subscription)).Equal(0)
+			g.Assert(strings.Contains(s.log.String(), "unable to unmarshal")).Equal(true)
+		})
+
 	})
 }
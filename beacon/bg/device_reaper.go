@@ -0,0 +1,138 @@
+package bg
+
+import "sync"
+import "time"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+
+// NewDeviceReaper returns a processor that periodically flags or removes (based on the action) the devices that have
+// not been seen within the threshold.
+func NewDeviceReaper(
+	registry device.Registry,
+	activity device.ActivityStore,
+	interval time.Duration,
+	threshold time.Duration,
+	action string,
+) *DeviceReaper {
+	logger := logging.New(defs.DeviceReaperLogPrefix, logging.Red)
+
+	return &DeviceReaper{
+		Logger:    logger,
+		registry:  registry,
+		activity:  activity,
+		interval:  interval,
+		threshold: threshold,
+		action:    action,
+		now:       time.Now,
+	}
+}
+
+// DevicePool defines the interface used to check whether a device has a connection held in the control pool.
+type DevicePool interface {
+	Connected(string) bool
+}
+
+// DeviceReaper is responsible for cleaning up registered devices that never reconnect.
+type DeviceReaper struct {
+	*logging.Logger
+
+	// Pool, if provided, is checked before a device is reaped; devices w/ an open connection are never reaped, even if
+	// they have not sent anything within the threshold.
+	Pool DevicePool
+
+	registry  device.Registry
+	activity  device.ActivityStore
+	interval  time.Duration
+	threshold time.Duration
+	action    string
+	now       func() time.Time
+}
+
+// Start is the Processor#Start implementation
+func (reaper *DeviceReaper) Start(wg *sync.WaitGroup, stop KillSwitch) {
+	defer wg.Done()
+
+	reaper.Infof("device reaper starting (interval: %s, threshold: %s)", reaper.interval, reaper.threshold)
+
+	ticker := time.NewTicker(reaper.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reaper.reap()
+		case <-stop:
+			reaper.Infof("received kill signal, breaking")
+			return
+		}
+	}
+}
+
+// reap checks the last seen time of every registered device, applying the reaper action to those beyond the threshold.
+func (reaper *DeviceReaper) reap() {
+	registrations, e := reaper.registry.ListRegistrations()
+
+	if e != nil {
+		reaper.Errorf("unable to list registrations: %s", e.Error())
+		return
+	}
+
+	cutoff := reaper.now().Add(-reaper.threshold)
+
+	for _, details := range registrations {
+		lastSeen, e := reaper.activity.LastSeen(details.DeviceID)
+
+		if e != nil {
+			reaper.Warnf("unable to load last seen time of device[%s]: %s", details.DeviceID, e.Error())
+			continue
+		}
+
+		// Devices registered before their activity was tracked have never been seen; their clock starts now.
+		if lastSeen.IsZero() {
+			if e := reaper.activity.TouchDevice(details.DeviceID); e != nil {
+				reaper.Warnf("unable to touch device[%s]: %s", details.DeviceID, e.Error())
+			}
+
+			continue
+		}
+
+		if lastSeen.After(cutoff) {
+			continue
+		}
+
+		if reaper.Pool != nil && reaper.Pool.Connected(details.DeviceID) {
+			reaper.Debugf("skipping connected device[%s] (last seen: %s)", details.DeviceID, lastSeen)
+			continue
+		}
+
+		reaper.apply(details.DeviceID, lastSeen)
+	}
+}
+
+func (reaper *DeviceReaper) apply(deviceID string, lastSeen time.Time) {
+	if reaper.action == defs.ReaperActionRemove {
+		reaper.Infof("removing device[%s] (last seen: %s)", deviceID, lastSeen)
+
+		// Unlike a disconnect, reaping is final; the device is removed along w/ its resume tokens so that it is not
+		// restored the next time it reconnects.
+		failures, e := reaper.registry.RemoveDevices([]string{deviceID})
+
+		if e == nil {
+			e = failures[deviceID]
+		}
+
+		if e != nil {
+			reaper.Errorf("unable to remove idle device[%s]: %s", deviceID, e.Error())
+		}
+
+		return
+	}
+
+	reaper.Infof("flagging device[%s] as idle (last seen: %s)", deviceID, lastSeen)
+
+	if e := reaper.activity.FlagIdleDevice(deviceID); e != nil {
+		reaper.Errorf("unable to flag idle device[%s]: %s", deviceID, e.Error())
+	}
+}
@@ -0,0 +1,215 @@
+package bg
+
+import "fmt"
+import "sync"
+import "time"
+import "bytes"
+import "strings"
+import "testing"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+
+type testReaperRegistry struct {
+	testDeviceIndex
+	registrations []device.RegistrationDetails
+	listErrors    []error
+	lastSeen      map[string]time.Time
+	removed       []string
+	reaped        []string
+	reapFailures  map[string]error
+	flagged       []string
+	touched       []string
+}
+
+func (r *testReaperRegistry) RemoveDevice(id string) error {
+	r.removed = append(r.removed, id)
+	return nil
+}
+
+func (r *testReaperRegistry) RemoveDevices(ids []string) (map[string]error, error) {
+	r.reaped = append(r.reaped, ids...)
+	return r.reapFailures, nil
+}
+
+func (r *testReaperRegistry) ReissueRegistration(string, string) error {
+	return nil
+}
+
+func (r *testReaperRegistry) ListRegistrations() ([]device.RegistrationDetails, error) {
+	if len(r.listErrors) >= 1 {
+		return nil, r.listErrors[0]
+	}
+
+	return r.registrations, nil
+}
+
+func (r *testReaperRegistry) FindDevices(string) ([]device.RegistrationDetails, error) {
+	return nil, nil
+}
+
+func (r *testReaperRegistry) SetDeviceMeta(string, map[string]string) error {
+	return nil
+}
+
+func (r *testReaperRegistry) RenameDevice(string, string) error {
+	return nil
+}
+
+func (r *testReaperRegistry) GetDeviceMeta(string) (map[string]string, error) {
+	return nil, nil
+}
+
+func (r *testReaperRegistry) DeviceExists(string) (bool, error) {
+	return len(r.registrations) >= 1, nil
+}
+
+func (r *testReaperRegistry) FillRegistration(secret, id string) (string, error) {
+	return id, nil
+}
+
+func (r *testReaperRegistry) AllocateRegistration(device.RegistrationRequest) error {
+	return nil
+}
+
+func (r *testReaperRegistry) ListPendingRegistrations() ([]device.RegistrationRequest, error) {
+	return nil, nil
+}
+
+func (r *testReaperRegistry) TouchDevice(id string) error {
+	r.touched = append(r.touched, id)
+	return nil
+}
+
+func (r *testReaperRegistry) LastSeen(id string) (time.Time, error) {
+	seen, ok := r.lastSeen[id]
+
+	if ok != true {
+		return time.Time{}, fmt.Errorf("not-found")
+	}
+
+	return seen, nil
+}
+
+func (r *testReaperRegistry) FlagIdleDevice(id string) error {
+	r.flagged = append(r.flagged, id)
+	return nil
+}
+
+type testReaperPool struct {
+	connected map[string]bool
+}
+
+func (p *testReaperPool) Connected(id string) bool {
+	return p.connected[id]
+}
+
+type deviceReaperScaffold struct {
+	registry *testReaperRegistry
+	reaper   *DeviceReaper
+	log      *bytes.Buffer
+	now      time.Time
+}
+
+func (s *deviceReaperScaffold) Reset() {
+	s.now = time.Unix(1500000000, 0)
+	s.log = bytes.NewBuffer([]byte{})
+	s.registry = &testReaperRegistry{
+		registrations: []device.RegistrationDetails{
+			{DeviceID: "stale"},
+			{DeviceID: "fresh"},
+			{DeviceID: "unseen"},
+			{DeviceID: "unknown"},
+		},
+		lastSeen: map[string]time.Time{
+			"stale":  s.now.Add(-time.Hour * 3),
+			"fresh":  s.now.Add(-time.Minute),
+			"unseen": time.Time{},
+		},
+	}
+	s.reaper = &DeviceReaper{
+		Logger:    newTestLogger(s.log),
+		registry:  s.registry,
+		activity:  s.registry,
+		interval:  time.Millisecond,
+		threshold: time.Hour,
+		action:    defs.ReaperActionFlag,
+		now: func() time.Time {
+			return s.now
+		},
+	}
+}
+
+func Test_DeviceReaper(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("DeviceReaper", func() {
+		s := &deviceReaperScaffold{}
+
+		g.BeforeEach(s.Reset)
+
+		g.It("flags only the devices that have not been seen within the threshold", func() {
+			s.reaper.reap()
+			g.Assert(s.registry.flagged).Equal([]string{"stale"})
+			g.Assert(len(s.registry.reaped)).Equal(0)
+		})
+
+		g.It("removes only the stale devices when configured to remove", func() {
+			s.reaper.action = defs.ReaperActionRemove
+			s.reaper.reap()
+			g.Assert(s.registry.reaped).Equal([]string{"stale"})
+			g.Assert(len(s.registry.flagged)).Equal(0)
+		})
+
+		g.It("removes stale devices along w/ their resume tokens rather than as if they had disconnected", func() {
+			s.reaper.action = defs.ReaperActionRemove
+			s.reaper.reap()
+			g.Assert(len(s.registry.removed)).Equal(0)
+		})
+
+		g.It("logs the devices that could not be removed", func() {
+			s.reaper.action = defs.ReaperActionRemove
+			s.registry.reapFailures = map[string]error{"stale": fmt.Errorf("bad-remove")}
+			s.reaper.reap()
+			g.Assert(strings.Contains(s.log.String(), "bad-remove")).Equal(true)
+		})
+
+		g.It("does not reap stale devices that hold an open connection", func() {
+			s.reaper.action = defs.ReaperActionRemove
+			s.reaper.Pool = &testReaperPool{connected: map[string]bool{"stale": true}}
+			s.reaper.reap()
+			g.Assert(len(s.registry.reaped)).Equal(0)
+			g.Assert(len(s.registry.flagged)).Equal(0)
+		})
+
+		g.It("reaps stale devices w/o an open connection when given a pool", func() {
+			s.reaper.Pool = &testReaperPool{connected: map[string]bool{"fresh": true}}
+			s.reaper.reap()
+			g.Assert(s.registry.flagged).Equal([]string{"stale"})
+		})
+
+		g.It("starts the clock for devices that have never been seen", func() {
+			s.reaper.reap()
+			g.Assert(s.registry.touched).Equal([]string{"unseen"})
+		})
+
+		g.It("does nothing if unable to list the registrations", func() {
+			s.registry.listErrors = append(s.registry.listErrors, fmt.Errorf("bad-list"))
+			s.reaper.reap()
+			g.Assert(len(s.registry.flagged)).Equal(0)
+			g.Assert(len(s.registry.touched)).Equal(0)
+		})
+
+		g.It("reaps on each interval until the kill signal is sent", func() {
+			wg, kill := &sync.WaitGroup{}, make(KillSwitch)
+			wg.Add(1)
+			go s.reaper.Start(wg, kill)
+			time.Sleep(time.Millisecond * 20)
+			kill <- struct{}{}
+			wg.Wait()
+			g.Assert(len(s.registry.flagged) >= 1).Equal(true)
+			g.Assert(s.registry.flagged[0]).Equal("stale")
+		})
+	})
+}
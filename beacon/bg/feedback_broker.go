@@ -0,0 +1,61 @@
+package bg
+
+import "sync"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+// NewFeedbackBroker returns a broker w/ no subscribers.
+func NewFeedbackBroker() *FeedbackBroker {
+	return &FeedbackBroker{subscribers: make(map[device.FeedbackSubscription]string)}
+}
+
+// FeedbackBroker implements the device.FeedbackStream interface, relaying published feedback messages to each of the
+// subscriptions registered for the device the message was sent from.
+type FeedbackBroker struct {
+	sync.Mutex
+	subscribers map[device.FeedbackSubscription]string
+}
+
+// Subscribe returns a new subscription that will receive feedback messages for the given device id.
+func (broker *FeedbackBroker) Subscribe(deviceID string) device.FeedbackSubscription {
+	broker.Lock()
+	defer broker.Unlock()
+	subscription := make(device.FeedbackSubscription, defs.DefaultFeedbackSubscriptionBuffer)
+	broker.subscribers[subscription] = deviceID
+	return subscription
+}
+
+// Unsubscribe removes the subscription from the broker, closing it.
+func (broker *FeedbackBroker) Unsubscribe(subscription device.FeedbackSubscription) {
+	broker.Lock()
+	defer broker.Unlock()
+
+	if _, ok := broker.subscribers[subscription]; ok != true {
+		return
+	}
+
+	delete(broker.subscribers, subscription)
+	close(subscription)
+}
+
+// Publish sends the message to every subscription for the message's device. Subscribers that are not keeping up w/
+// the messages (full buffer) will miss the message rather than block the publisher.
+func (broker *FeedbackBroker) Publish(message interchange.FeedbackMessage) {
+	broker.Lock()
+	defer broker.Unlock()
+
+	deviceID := message.GetAuthentication().GetDeviceID()
+
+	for subscription, target := range broker.subscribers {
+		if target != deviceID {
+			continue
+		}
+
+		select {
+		case subscription <- message:
+		default:
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package bg
+
+import "testing"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+func feedbackFrom(deviceID string) interchange.FeedbackMessage {
+	return interchange.FeedbackMessage{
+		Authentication: &interchange.DeviceMessageAuthentication{DeviceID: deviceID},
+	}
+}
+
+func Test_FeedbackBroker(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("FeedbackBroker", func() {
+		var broker *FeedbackBroker
+
+		g.BeforeEach(func() {
+			broker = NewFeedbackBroker()
+		})
+
+		g.It("only sends messages to subscriptions for the message's device", func() {
+			first, second := broker.Subscribe("device-1"), broker.Subscribe("device-2")
+			broker.Publish(feedbackFrom("device-1"))
+			g.Assert(len(first)).Equal(1)
+			g.Assert(len(second)).Equal(0)
+		})
+
+		g.It("sends messages to every subscription for the device", func() {
+			first, second := broker.Subscribe("device-1"), broker.Subscribe("device-1")
+			broker.Publish(feedbackFrom("device-1"))
+			g.Assert(len(first)).Equal(1)
+			g.Assert(len(second)).Equal(1)
+		})
+
+		g.It("closes and stops sending to subscriptions that have been unsubscribed", func() {
+			subscription := broker.Subscribe("device-1")
+			broker.Unsubscribe(subscription)
+			broker.Publish(feedbackFrom("device-1"))
+			_, ok := <-subscription
+			g.Assert(ok).Equal(false)
+			broker.Unsubscribe(subscription)
+		})
+
+		g.It("drops messages for subscriptions that are not keeping up rather than blocking", func() {
+			subscription := broker.Subscribe("device-1")
+
+			for i := 0; i < defs.DefaultFeedbackSubscriptionBuffer+5; i++ {
+				broker.Publish(feedbackFrom("device-1"))
+			}
+
+			g.Assert(len(subscription)).Equal(defs.DefaultFeedbackSubscriptionBuffer)
+		})
+	})
+}
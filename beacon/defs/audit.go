@@ -0,0 +1,15 @@
+package defs
+
+const (
+	// AuditTokenCreatedAction is recorded when a device token has been created.
+	AuditTokenCreatedAction = "token-created"
+
+	// AuditDeviceRemovedAction is recorded when a device has been removed from the registry.
+	AuditDeviceRemovedAction = "device-removed"
+
+	// AuditDeviceReissuedAction is recorded when the shared secret of a registered device has been replaced.
+	AuditDeviceReissuedAction = "device-reissued"
+
+	// AuditLogMaxLimit is the maximum amount of audit entries that can be requested at once.
+	AuditLogMaxLimit = 100
+)
@@ -0,0 +1,24 @@
+package defs
+
+import "time"
+
+const (
+	// CircuitBreakerClosed is the state of a circuit breaker that is letting every publish through.
+	CircuitBreakerClosed = "closed"
+
+	// CircuitBreakerOpen is the state of a circuit breaker that is failing publishes fast after repeated failures.
+	CircuitBreakerOpen = "open"
+
+	// CircuitBreakerHalfOpen is the state of a circuit breaker that is letting a single probe publish through to test
+	// whether the channel has recovered.
+	CircuitBreakerHalfOpen = "half-open"
+
+	// DefaultCircuitBreakerThreshold is the amount of consecutive publish failures that open the control breaker.
+	DefaultCircuitBreakerThreshold = 5
+
+	// SystemControlStateKey is the system info metadata key holding the state of the control channel breaker.
+	SystemControlStateKey = "control"
+
+	// DefaultCircuitBreakerCooldown is how long the control breaker stays open before probing the channel again.
+	DefaultCircuitBreakerCooldown = time.Second * 10
+)
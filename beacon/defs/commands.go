@@ -0,0 +1,21 @@
+package defs
+
+import "time"
+
+const (
+	// CommandStatusPending is the status of a control command that has not been acknowledged by its device yet.
+	CommandStatusPending = "pending"
+
+	// CommandStatusAcknowledged is the status of a control command that its device has acknowledged applying.
+	CommandStatusAcknowledged = "acked"
+
+	// CommandStatusFailed is the status of a control command that could not be relayed to, or applied by, its device.
+	CommandStatusFailed = "failed"
+
+	// CommandStatusSuperseded is the status of a control command replaced by a later command to the same device before
+	// it was relayed (see the coalesce window of the device control processor).
+	CommandStatusSuperseded = "superseded"
+
+	// DefaultCommandStatusTTL is how long the status of a control command is kept around for.
+	DefaultCommandStatusTTL = time.Hour * 24
+)
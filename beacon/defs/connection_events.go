@@ -0,0 +1,12 @@
+package defs
+
+const (
+	// ConnectionEventConnected is logged when a device connection has been accepted into the control pool.
+	ConnectionEventConnected = "connected"
+
+	// ConnectionEventDisconnected is logged when a device connection has been evicted from (or closed by) the pool.
+	ConnectionEventDisconnected = "disconnected"
+
+	// DefaultConnectionEventCount is the amount of connection events returned when a count is not provided.
+	DefaultConnectionEventCount = 10
+)
@@ -1,5 +1,7 @@
 package defs
 
+import "time"
+
 const (
 	// DefaultPort is the port that the application will listen on unless otherwise specified.
 	DefaultPort = "8080"
@@ -9,4 +11,129 @@ const (
 
 	// DefaultHostname is the default hostname that will be bound to.
 	DefaultHostname = "0.0.0.0"
+
+	// DefaultRedisHost is the host connected to when a redis url does not include one.
+	DefaultRedisHost = "localhost"
+
+	// DefaultRedisPort is the port connected to when a redis url does not include one.
+	DefaultRedisPort = "6379"
+
+	// DefaultRedisMaxIdle is the maximum amount of idle connections held by the redis connection pool.
+	DefaultRedisMaxIdle = 10
+
+	// DefaultRedisMaxActive is the maximum amount of connections the redis connection pool will open at once.
+	DefaultRedisMaxActive = 100
+
+	// DefaultRedisIdleTimeout is how long a connection can sit idle in the redis connection pool before being closed.
+	DefaultRedisIdleTimeout = time.Minute * 4
+
+	// DefaultRedisRetries is the amount of times a redis command failing w/ a connection error will be retried.
+	DefaultRedisRetries = 2
+
+	// DefaultRedisRetryBackoff is the delay before the first retry of a redis command; it doubles w/ each retry.
+	DefaultRedisRetryBackoff = time.Millisecond * 100
+
+	// DefaultGzipThreshold is the size (in bytes) of a rendered response past which it is gzip compressed for clients
+	// that accept gzip encoded responses.
+	DefaultGzipThreshold = 1024
+
+	// DefaultMaxRequestBodySize is the size (in bytes) request bodies are limited to when read by route handlers.
+	DefaultMaxRequestBodySize = 1 << 20
+
+	// DefaultMaxDecompressedSize is the size (in bytes) compressed device payloads may expand to when received.
+	DefaultMaxDecompressedSize = 1 << 20
+
+	// DefaultMaxDeviceTokens is the maximum amount of tokens that can be created for a single device.
+	DefaultMaxDeviceTokens = 50
+
+	// DefaultTokenGenerationAttempts is the amount of tokens generated while creating a token before giving up on
+	// finding one that is not already in use.
+	DefaultTokenGenerationAttempts = 5
+
+	// DefaultMaxCommandHistory is the amount of control commands kept in the command history of each device.
+	DefaultMaxCommandHistory = 50
+
+	// DefaultCommandHistoryCount is the amount of command history entries returned when a count is not provided.
+	DefaultCommandHistoryCount = 10
+
+	// DefaultRegistrationRequestTTL is how long a pending registration request will remain in the registry.
+	DefaultRegistrationRequestTTL = time.Hour * 24
+
+	// DefaultTokenIdempotencyWindow is how long the token created w/ an idempotency key is returned for retried requests.
+	DefaultTokenIdempotencyWindow = time.Hour * 24
+
+	// DefaultTokenIdempotencyReservation is how long an idempotency key is reserved for while its token is created.
+	DefaultTokenIdempotencyReservation = time.Minute
+
+	// DefaultResumeTokenTTL is how long a device has to reconnect w/ the resume token it was welcomed w/.
+	DefaultResumeTokenTTL = time.Hour * 24
+
+	// DefaultFeedbackSubscriptionBuffer is the number of feedback messages held for a slow feedback stream subscriber.
+	DefaultFeedbackSubscriptionBuffer = 10
+
+	// DefaultFeedbackStatsWindow is how far back feedback entries are counted when a stats window is not provided.
+	DefaultFeedbackStatsWindow = time.Hour
+
+	// DefaultFirmwareVersion is the firmware version of devices that have not reported one along w/ their feedback.
+	DefaultFirmwareVersion = "unknown"
+
+	// DefaultFeedbackQueryLimit is the amount of feedback entries returned by a query that does not provide a limit.
+	DefaultFeedbackQueryLimit = 10
+
+	// DefaultFeedbackListCount is the amount of feedback entries listed for a device when no count is provided.
+	DefaultFeedbackListCount = 10
+
+	// MaxFeedbackListCount is the most feedback entries that can be listed for a device in a single request.
+	MaxFeedbackListCount = 100
+
+	// DefaultDeviceMessageBatchLimit is the maximum number of device messages that can be created in a single request.
+	DefaultDeviceMessageBatchLimit = 50
+
+	// DefaultControlFrameLimit is the maximum number of frames that can be sent to a device in a single control message.
+	DefaultControlFrameLimit = 100
+
+	// DefaultFeedbackBatchLimit is the maximum number of feedback messages that can be logged in a single request.
+	DefaultFeedbackBatchLimit = 50
+
+	// DefaultDeviceRemovalBatchLimit is the maximum number of devices that can be removed in a single request.
+	DefaultDeviceRemovalBatchLimit = 50
+
+	// DefaultControlDrainTimeout is how long the control processor will spend relaying buffered commands on shutdown.
+	DefaultControlDrainTimeout = time.Second * 5
+
+	// DefaultMaxCommandAge is how old a control command can be before the control processor drops it w/o relaying it.
+	DefaultMaxCommandAge = time.Second * 30
+
+	// DefaultDeviceControlWorkers is the amount of workers the control processor receives from the device channels w/.
+	DefaultDeviceControlWorkers = 1
+
+	// DefaultCommandBufferSize is the amount of commands buffered for the control processor before publishing blocks.
+	DefaultCommandBufferSize = 10
+
+	// DefaultChannelPublishTimeout is how long publishing to a full background channel waits before failing.
+	DefaultChannelPublishTimeout = time.Second * 2
+
+	// DefaultDevicePageSize is the amount of devices returned per page when listing devices.
+	DefaultDevicePageSize = 25
+
+	// MaxDevicePageSize is the maximum amount of devices that can be requested per page when listing devices.
+	MaxDevicePageSize = 100
+
+	// DefaultTokenListLimit is the amount of tokens returned when listing the tokens of every device w/o a limit.
+	DefaultTokenListLimit = 100
+
+	// MaxTokenListLimit is the maximum amount of tokens that can be requested when listing the tokens of every device.
+	MaxTokenListLimit = 1000
+
+	// DefaultDeviceLockTTL is how long the lock taken by a registry mutation is held before it expires on its own.
+	DefaultDeviceLockTTL = time.Second * 5
+
+	// DefaultDeviceLockWait is how long a registry mutation waits for the lock of a device held by another mutation.
+	DefaultDeviceLockWait = time.Second * 2
+
+	// DeviceLockRetryInterval is how long a registry mutation waiting for the lock of a device sleeps between attempts.
+	DeviceLockRetryInterval = time.Millisecond * 50
+
+	// RegistryExportVersion is the version written to (and expected of) registry export documents.
+	RegistryExportVersion = 1
 )
@@ -0,0 +1,14 @@
+package defs
+
+const (
+	// DeviceConnectionPolicyEvictOldest is the connection policy that closes the least recently active connection of a
+	// device already at its connection limit in favor of the new one.
+	DeviceConnectionPolicyEvictOldest = "evict-oldest"
+
+	// DeviceConnectionPolicyRejectNew is the connection policy that closes new connections of a device already at its
+	// connection limit, leaving its existing connections open.
+	DeviceConnectionPolicyRejectNew = "reject-new"
+
+	// DefaultMaxDeviceConnections is the amount of concurrent connections a single device id can hold.
+	DefaultMaxDeviceConnections = 1
+)
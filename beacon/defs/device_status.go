@@ -0,0 +1,19 @@
+package defs
+
+import "time"
+
+const (
+	// DeviceStatusOnline is reported for devices whose connection is in the control pool and that have been seen
+	// within the heartbeat interval.
+	DeviceStatusOnline = "online"
+
+	// DeviceStatusSilent is reported for devices whose connection lingers in the control pool w/o the device having
+	// been seen within the heartbeat interval.
+	DeviceStatusSilent = "silent"
+
+	// DeviceStatusDisconnected is reported for devices w/o a connection in the control pool.
+	DeviceStatusDisconnected = "disconnected"
+
+	// DefaultHeartbeatInterval is how long a device can go w/o sending feedback before it is reported as silent.
+	DefaultHeartbeatInterval = time.Minute * 5
+)
@@ -1,5 +1,14 @@
 package defs
 
+// Error is a string based error type. Stores return the message constants below wrapped in it so that callers are able
+// to compare against them directly (e.g `e == defs.Error(defs.ErrNotFound)`) rather than matching on error messages.
+type Error string
+
+// Error returns the message of the error, which is identical to the constant it was created from.
+func (e Error) Error() string {
+	return string(e)
+}
+
 const (
 	// ErrInvalidDeviceID is returned when a user submits an invalid device id to a route that requires one.
 	ErrInvalidDeviceID = "invalid-device-id"
@@ -37,12 +46,177 @@ const (
 	// ErrInvalidBackgroundChannel returned when attempting to publish to an invalid background channel
 	ErrInvalidBackgroundChannel = "invalid-background-channel"
 
+	// ErrDeviceBusy returned when a command could not be queued because the control processor is backed up.
+	ErrDeviceBusy = "device-busy"
+
 	// ErrInvalidDeviceSharedSecret returned when attempting to use an invalid shared secret during registration.
 	ErrInvalidDeviceSharedSecret = "invalid-shared-secret"
 
+	// ErrInvalidDeviceSharedSecretHex returned when a shared secret has an odd length or non-hexadecimal characters.
+	ErrInvalidDeviceSharedSecretHex = "invalid-hex"
+
+	// ErrDeviceSharedSecretTooShort returned when a shared secret is shorter than the minimum shared secret size.
+	ErrDeviceSharedSecretTooShort = "key-too-short"
+
 	// ErrDuplicateRegistrationName returned when registering a name that already exists.
 	ErrDuplicateRegistrationName = "duplicate-name"
 
+	// ErrInvalidHSL returned when an hsl color is malformed or has components outside of their ranges.
+	ErrInvalidHSL = "invalid-hsl"
+
 	// ErrInvalidColorShorthand returned when the color shorthand request by the client is invalid.
 	ErrInvalidColorShorthand = "invalid-color-shorthand"
+
+	// ErrWebhookDelivery returned when the webhook url responds w/ a non-success status code.
+	ErrWebhookDelivery = "webhook-delivery"
+
+	// ErrStreamingUnsupported returned when the response writer is unable to flush server-sent events.
+	ErrStreamingUnsupported = "streaming-unsupported"
+
+	// ErrMQTTConnectionClosed returned when attempting to read or write along a closed mqtt device connection.
+	ErrMQTTConnectionClosed = "mqtt-connection-closed"
+
+	// ErrMQTTConnectionRefused returned when the mqtt broker does not accept the server's connect packet.
+	ErrMQTTConnectionRefused = "mqtt-connection-refused"
+
+	// ErrMQTTMalformedPacket returned when a packet received from the mqtt broker cannot be decoded.
+	ErrMQTTMalformedPacket = "mqtt-malformed-packet"
+
+	// ErrMQTTPacketTooLarge returned when a packet received from the mqtt broker is larger than the maximum packet size.
+	ErrMQTTPacketTooLarge = "mqtt-packet-too-large"
+
+	// ErrInvalidDeviceMessageType returned when a device message is requested w/ an unknown message type.
+	ErrInvalidDeviceMessageType = "invalid-message-type"
+
+	// ErrInvalidControlTermination returned when a control message is requested w/ an unknown termination.
+	ErrInvalidControlTermination = "invalid-termination"
+
+	// ErrTooManyControlFrames returned when a control message is requested w/ more than the maximum amount of frames.
+	ErrTooManyControlFrames = "too-many-frames"
+
+	// ErrInvalidDeviceTag returned when attempting to tag a device w/ an invalid tag.
+	ErrInvalidDeviceTag = "invalid-tag"
+
+	// ErrInvalidTokenPermission returned when a token is requested w/ an unknown permission name or mask.
+	ErrInvalidTokenPermission = "invalid-permission"
+
+	// ErrInvalidToken returned when the user token of a request is missing or not authorized for the device.
+	ErrInvalidToken = "invalid-token"
+
+	// ErrPermissionEscalation returned when a token attempts to create a token w/ permissions it does not hold itself.
+	ErrPermissionEscalation = "permission-escalation"
+
+	// ErrInvalidResumeToken returned when a device attempts to resume w/ an unknown token or w/ a different secret.
+	ErrInvalidResumeToken = "invalid-resume-token"
+
+	// ErrInvalidFeedbackLevel returned when feedback is requested w/ an unknown minimum level.
+	ErrInvalidFeedbackLevel = "invalid-level"
+
+	// ErrInvalidFeedbackWindow returned when feedback stats are requested w/ an unparsable or non-positive window.
+	ErrInvalidFeedbackWindow = "invalid-window"
+
+	// ErrRegistryClosed returned when a command is sent through a registry after it has been closed.
+	ErrRegistryClosed = "registry-closed"
+
+	// ErrInvalidSchemaVersion returned when migrating a registry from an unknown schema version.
+	ErrInvalidSchemaVersion = "invalid-schema-version"
+
+	// ErrInvalidFeedbackRange returned when feedback is queried w/ a since time that is after the until time.
+	ErrInvalidFeedbackRange = "invalid-range"
+
+	// ErrInvalidFeedbackCursor returned when feedback is paged through w/ a cursor not issued by the feedback backend.
+	ErrInvalidFeedbackCursor = "invalid-cursor"
+
+	// ErrRequestTooLarge returned when a request body is larger than the maximum request body size.
+	ErrRequestTooLarge = "request-too-large"
+
+	// ErrPayloadTooLarge returned when a compressed device payload expands past the maximum decompressed payload size.
+	ErrPayloadTooLarge = "payload-too-large"
+
+	// ErrNoDeviceState returned when reading the state of a device that has not been sent a control frame.
+	ErrNoDeviceState = "no-device-state"
+
+	// ErrInvalidCommandStatus returned when attempting to set a command to a status other than acked, failed or
+	// superseded.
+	ErrInvalidCommandStatus = "invalid-command-status"
+
+	// ErrUnsupportedFrameType returned when a device sends a websocket frame that is neither text nor binary.
+	ErrUnsupportedFrameType = "unsupported-frame-type"
+
+	// ErrInvalidRegistryExport returned when attempting to import a registry export that cannot be parsed.
+	ErrInvalidRegistryExport = "invalid-registry-export"
+
+	// ErrUnsupportedRegistryExport returned when attempting to import a registry export w/ an unknown version.
+	ErrUnsupportedRegistryExport = "unsupported-registry-export"
+
+	// ErrTokenLimitReached returned when attempting to create a token for a device that already has the maximum amount.
+	ErrTokenLimitReached = "token-limit-reached"
+
+	// ErrDuplicateTokenName returned when creating a token named the same as an existing token of the device.
+	ErrDuplicateTokenName = "duplicate-token-name"
+
+	// ErrTokenGenerationFailed returned when every token generated while creating a token was already in use.
+	ErrTokenGenerationFailed = "token-generation-failed"
+
+	// ErrInvalidDeviceKey returned when the public key a device registered w/ is unable to be parsed.
+	ErrInvalidDeviceKey = "invalid-device-key"
+
+	// ErrInvalidDeviceSignature returned when a signature sent by a device does not match its payload.
+	ErrInvalidDeviceSignature = "invalid-device-signature"
+
+	// ErrInvalidRedisURL returned when the redis url has an unknown scheme or an invalid database.
+	ErrInvalidRedisURL = "invalid-redis-url"
+
+	// ErrInvalidDeviceMeta returned when device metadata has an empty key, or a key or value that is too long.
+	ErrInvalidDeviceMeta = "invalid-meta"
+
+	// ErrPartialFeedbackBatch returned when some of the messages in a feedback batch could not be logged.
+	ErrPartialFeedbackBatch = "partial-feedback-batch"
+
+	// ErrDeviceCertificateRequired returned when a device registers w/o a client certificate while one is required.
+	ErrDeviceCertificateRequired = "device-certificate-required"
+
+	// ErrDeviceCertificateMismatch returned when a device's client certificate is not for the device's shared secret.
+	ErrDeviceCertificateMismatch = "device-certificate-mismatch"
+
+	// ErrDanglingToken returned when a token list entry's registration hash is missing or has an unparsable mask.
+	ErrDanglingToken = "dangling-token"
+
+	// ErrInvalidIdempotencyKey returned when a token is requested w/ an idempotency key that is not safe to store.
+	ErrInvalidIdempotencyKey = "invalid-idempotency-key"
+
+	// ErrIdempotencyKeyReused returned when an idempotency key is reused for a token request w/ a different name or
+	// permission than the request it was first used w/.
+	ErrIdempotencyKeyReused = "idempotency-key-reused"
+
+	// ErrIdempotencyKeyPending returned when a token is requested w/ an idempotency key whose token is still being
+	// created by another request.
+	ErrIdempotencyKeyPending = "idempotency-key-pending"
+
+	// ErrNoPatchFields returned when a device is patched w/o any of the fields that can be updated.
+	ErrNoPatchFields = "no-fields"
+
+	// ErrInvalidDevicePatch returned when any of the fields a device is patched w/ are invalid.
+	ErrInvalidDevicePatch = "invalid-patch"
+
+	// ErrInvalidDeviceRemoval returned when a bulk device removal request w/o any (or too many) device ids is received.
+	ErrInvalidDeviceRemoval = "invalid-removal"
+
+	// ErrInvalidFeedbackBatch returned when a feedback batch w/o any (or too many) messages is received.
+	ErrInvalidFeedbackBatch = "invalid-feedback-batch"
+
+	// ErrControlUnavailable returned when a command is not published because the control channel breaker is open.
+	ErrControlUnavailable = "control-unavailable"
+
+	// ErrDeviceLocked returned when a device is mutated while another mutation of the same device holds its lock.
+	ErrDeviceLocked = "device-locked"
+
+	// ErrInsecureTokenSize returned when a token generator is configured to use fewer random bytes than the minimum.
+	ErrInsecureTokenSize = "insecure-token-size"
+
+	// ErrInvalidTokenEncoding returned when a token generator is configured w/ an unknown encoding.
+	ErrInvalidTokenEncoding = "invalid-token-encoding"
+
+	// ErrFeedbackDeviceMismatch returned when a device connection sends feedback on behalf of another device.
+	ErrFeedbackDeviceMismatch = "feedback-device-mismatch"
 )
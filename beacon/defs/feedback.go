@@ -0,0 +1,10 @@
+package defs
+
+const (
+	// FeedbackBackendList is the feedback backend that stores the feedback of each device in a capped redis list.
+	FeedbackBackendList = "list"
+
+	// FeedbackBackendStream is the feedback backend that stores the feedback of each device in a capped redis stream,
+	// whose entry ids are used as stable pagination cursors.
+	FeedbackBackendStream = "stream"
+)
@@ -7,9 +7,49 @@ const (
 	// APIDeviceRegistrationHeader is the header key used by devices to send their shared secret when connecting.
 	APIDeviceRegistrationHeader = "x-device-auth"
 
+	// APIDeviceResumeHeader is the header key used by reconnecting devices to send the resume token they were welcomed w/.
+	APIDeviceResumeHeader = "x-device-resume"
+
 	// APIUserTokenHeader is the header key used by users to send a device token.
 	APIUserTokenHeader = "x-user-auth"
 
+	// APIAcceptHeader is the header clients use to list the content types they would like responses rendered as.
+	APIAcceptHeader = "Accept"
+
+	// APIAcceptEncodingHeader is the header clients use to list the content encodings they are able to decode.
+	APIAcceptEncodingHeader = "Accept-Encoding"
+
+	// APIContentEncodingHeader is the header used to tell clients which encoding was applied to a response body.
+	APIContentEncodingHeader = "Content-Encoding"
+
+	// APIVaryHeader is the header listing the request headers a response was negotiated w/, used by caches.
+	APIVaryHeader = "Vary"
+
+	// APIGzipEncoding is the content encoding used for gzip compressed response bodies.
+	APIGzipEncoding = "gzip"
+
+	// APIIdempotencyKeyHeader is the header clients send w/ a unique key so that retried token creation requests return
+	// the token created by the original request rather than creating another.
+	APIIdempotencyKeyHeader = "Idempotency-Key"
+
+	// APIRequestIDHeader is the header used to read (and respond w/) the id used to correlate a request's log lines.
+	APIRequestIDHeader = "X-Request-ID"
+
+	// APIResponseSignatureHeader is the header holding the hex encoded signature of a signed response body.
+	APIResponseSignatureHeader = "X-Response-Signature"
+
 	// APIFeedbackContentTypeHeader is the content type required for requests sent to the feedback api.
 	APIFeedbackContentTypeHeader = "application/octet-stream"
+
+	// APIJSONContentType is the content type of json rendered responses, which are sent unless clients prefer another.
+	APIJSONContentType = "application/json"
+
+	// APIProtobufContentType is the content type of responses rendered as the binary encoding of a protobuf message.
+	APIProtobufContentType = "application/x-protobuf"
+
+	// APIEventStreamContentType is the content type sent along w/ server-sent event responses.
+	APIEventStreamContentType = "text/event-stream"
+
+	// APIFeedbackStreamEventName is the event name used when sending feedback messages along an event stream.
+	APIFeedbackStreamEventName = "feedback"
 )
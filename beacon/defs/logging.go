@@ -51,6 +51,30 @@ const (
 	// DeviceFeedbackLogPrefix is the log prefix for the device feeback processor
 	DeviceFeedbackLogPrefix = "[device feedback] "
 
+	// WebhookDispatcherLogPrefix is the log prefix for the webhook dispatcher
+	WebhookDispatcherLogPrefix = "[webhook dispatcher] "
+
+	// MQTTBridgeLogPrefix is the log prefix for the mqtt bridge
+	MQTTBridgeLogPrefix = "[mqtt bridge] "
+
+	// MQTTClientLogPrefix is the log prefix for the mqtt broker client
+	MQTTClientLogPrefix = "[mqtt client] "
+
+	// DeviceTagsAPILogPrefix is the log prefix for the device tags api
+	DeviceTagsAPILogPrefix = "[device tags api] "
+
+	// AuditAPILogPrefix is the log prefix for the audit api
+	AuditAPILogPrefix = "[audit api] "
+
+	// DeviceControlRPCLogPrefix is the log prefix for the grpc device control service
+	DeviceControlRPCLogPrefix = "[device control rpc] "
+
+	// DeviceReaperLogPrefix is the log prefix for the idle device reaper
+	DeviceReaperLogPrefix = "[device reaper] "
+
 	// DefaultLoggerFlags is the bitmask used to create default logging
 	DefaultLoggerFlags = log.Ldate | log.Ltime
+
+	// LogFileMode is the permission mode log files are created w/.
+	LogFileMode = 0644
 )
@@ -0,0 +1,35 @@
+package defs
+
+import "time"
+
+const (
+	// MQTTRegistrationTopic is subscribed to by the mqtt bridge; devices publish their shared secret to a sub-topic
+	// named after a session identifier of their choosing.
+	MQTTRegistrationTopic = "beacon/register/+"
+
+	// MQTTDeviceControlTopic is the format of the topic that messages are published to for a device session.
+	MQTTDeviceControlTopic = "beacon/devices/%s/control"
+
+	// MQTTDeviceFeedbackTopic is the format of the topic that devices publish their feedback messages to.
+	MQTTDeviceFeedbackTopic = "beacon/devices/%s/feedback"
+
+	// DefaultMQTTInboundBuffer is the number of inbound messages held for a device connection; devices that publish
+	// past it are disconnected rather than blocking the messages of every other device.
+	DefaultMQTTInboundBuffer = 10
+
+	// MaxMQTTPacketSize is the largest packet (in bytes) read from the mqtt broker; larger packets are discarded.
+	MaxMQTTPacketSize = 1 << 20
+
+	// DefaultMQTTReconnectDelay is how long the client waits before redialing the mqtt broker after losing its
+	// connection, doubling after each failed attempt.
+	DefaultMQTTReconnectDelay = time.Second
+
+	// MaxMQTTReconnectDelay is the most the client will wait between attempts to redial the mqtt broker.
+	MaxMQTTReconnectDelay = 30 * time.Second
+
+	// DefaultMQTTClientID is the client id the server connects to the mqtt broker w/.
+	DefaultMQTTClientID = "beacon-api"
+
+	// DefaultMQTTKeepAlive is the keep alive interval sent to the mqtt broker; the client pings at half of it.
+	DefaultMQTTKeepAlive = 30 * time.Second
+)
@@ -0,0 +1,17 @@
+package defs
+
+import "time"
+
+const (
+	// ReaperActionFlag is the reaper action that flags idle devices, leaving them in the registry.
+	ReaperActionFlag = "flag"
+
+	// ReaperActionRemove is the reaper action that removes idle devices from the registry.
+	ReaperActionRemove = "remove"
+
+	// DefaultReaperInterval is how often the registry is checked for idle devices.
+	DefaultReaperInterval = time.Hour
+
+	// DefaultReaperThreshold is how long a device can go without being seen before it is considered idle.
+	DefaultReaperThreshold = time.Hour * 24 * 7
+)
@@ -1,6 +1,12 @@
 package defs
 
 const (
+	// RedisURLScheme is the scheme of redis urls used to connect to the redis server.
+	RedisURLScheme = "redis"
+
+	// RedisTLSURLScheme is the scheme of redis urls used to connect to the redis server over TLS.
+	RedisTLSURLScheme = "rediss"
+
 	// RedisDeviceIndexKey is the key used by the regis device registry to store device ids
 	RedisDeviceIndexKey = "beacon:device-index"
 
@@ -10,15 +16,33 @@ const (
 	// RedisDeviceFeedbackKey is the key used by the regis device registry to store device feedback
 	RedisDeviceFeedbackKey = "beacon:device-feedback"
 
+	// RedisDeviceFeedbackStreamKey is the key used by the redis device registry to store device feedback in streams
+	RedisDeviceFeedbackStreamKey = "beacon:device-feedback-stream"
+
+	// RedisFeedbackStreamField is the field of each feedback stream entry that contains the feedback message
+	RedisFeedbackStreamField = "feedback"
+
 	// RedisRegistrationRequestListKey is the key used for registration requests
 	RedisRegistrationRequestListKey = "beacon:registration-requests"
 
+	// RedisFilledRegistrationKey is the key used for registration requests that have been filled by a device
+	RedisFilledRegistrationKey = "beacon:filled-registrations"
+
 	// RedisDeviceIDField is the field that contains the unique id of the device
 	RedisDeviceIDField = "device:uuid"
 
 	// RedisDeviceNameField is the field that contains the unique name of the device
 	RedisDeviceNameField = "device:name"
 
+	// RedisDeviceLastSeenField is the field that contains the unix timestamp of the last time the device was seen
+	RedisDeviceLastSeenField = "device:last-seen"
+
+	// RedisDeviceFirmwareField is the field that contains the firmware version the device last reported w/ feedback
+	RedisDeviceFirmwareField = "device:firmware"
+
+	// RedisDeviceIdleField is the field set on devices that have been flagged as idle by the reaper
+	RedisDeviceIdleField = "device:idle"
+
 	// RedisDeviceTokenListKey is the field that contains the list of tokens associated w/ each device
 	RedisDeviceTokenListKey = "device:token-list"
 
@@ -46,6 +70,111 @@ const (
 	// RedisRegistrationSecretField is the redis key used to store registration secrets
 	RedisRegistrationSecretField = "registration:secret"
 
+	// RedisRegistrationDeviceIDField is the redis key used to store the id of the device a registration was filled w/
+	RedisRegistrationDeviceIDField = "registration:device-id"
+
+	// RedisRegistrationCreatedField is the redis key used to store the unix time a registration was requested at
+	RedisRegistrationCreatedField = "registration:created"
+
 	// RedisMaxFeedbackEntries is the maximum amount of entries a device is allowed to have at any given time.
 	RedisMaxFeedbackEntries = 100
+
+	// RedisFeedbackQueryPageSize is the amount of feedback entries loaded at a time while querying a device's feedback.
+	RedisFeedbackQueryPageSize = 25
+
+	// RedisDeviceTagKey is the prefix of the sets holding the ids of the devices w/ a given tag
+	RedisDeviceTagKey = "beacon:device-tag"
+
+	// RedisDeviceTagListKey is the prefix of the sets holding the tags a given device has
+	RedisDeviceTagListKey = "device:tag-list"
+
+	// RedisDeviceNamesKey is the key of the hash holding the id of the device registered w/ each lowercased name.
+	RedisDeviceNamesKey = "beacon:device-name-owners"
+
+	// RedisDeviceNamesRebuildSuffix is appended to the name index key to form the key the index is rebuilt into.
+	RedisDeviceNamesRebuildSuffix = "rebuild"
+
+	// RedisAuditLogKey is the key of the list that audit entries are pushed onto.
+	RedisAuditLogKey = "beacon:audit-log"
+
+	// RedisMaxAuditEntries is the maximum amount of entries kept in the audit log.
+	RedisMaxAuditEntries = 1000
+
+	// RedisDeviceCommandKey is the prefix of the hashes holding the status of control commands sent to devices
+	RedisDeviceCommandKey = "beacon:device-command"
+
+	// RedisDeviceMetaKey is the prefix of the hashes holding the operator provided metadata of each device
+	RedisDeviceMetaKey = "beacon:device-meta"
+
+	// RedisDeviceLockKey is the prefix of the keys locking a device while its registry entries are being mutated
+	RedisDeviceLockKey = "beacon:device-lock"
+
+	// RedisDeviceCommandHistoryKey is the prefix of the lists holding the latest control commands sent to each device
+	RedisDeviceCommandHistoryKey = "beacon:device-command-history"
+
+	// RedisDeviceConnEventsKey is the prefix of the lists holding the latest connection events of each device
+	RedisDeviceConnEventsKey = "beacon:device-conn-events"
+
+	// RedisMaxConnEventEntries is the maximum amount of connection events kept for each device.
+	RedisMaxConnEventEntries = 100
+
+	// RedisDeviceStateKey is the prefix of the hashes holding the last control frame sent to each device
+	RedisDeviceStateKey = "beacon:device-state"
+
+	// RedisDeviceStateRedField is the field that contains the red value of the last frame sent to a device
+	RedisDeviceStateRedField = "state:red"
+
+	// RedisDeviceStateGreenField is the field that contains the green value of the last frame sent to a device
+	RedisDeviceStateGreenField = "state:green"
+
+	// RedisDeviceStateBlueField is the field that contains the blue value of the last frame sent to a device
+	RedisDeviceStateBlueField = "state:blue"
+
+	// RedisDeviceStateUpdatedField is the field that contains the unix timestamp of the last frame sent to a device
+	RedisDeviceStateUpdatedField = "state:updated"
+
+	// RedisTokenIdempotencyKey is the prefix of the keys holding the token created w/ an idempotency key for a device
+	RedisTokenIdempotencyKey = "beacon:token-idempotency"
+
+	// RedisTokenIdempotencyPending is held by an idempotency key reserved for a token that is still being created
+	RedisTokenIdempotencyPending = "pending"
+
+	// RedisDeviceResumeKey is the prefix of the keys holding the device each resume token was issued to
+	RedisDeviceResumeKey = "beacon:device-resume"
+
+	// RedisDeviceResumeTokensKey is the prefix of the sets holding the resume tokens issued to each device
+	RedisDeviceResumeTokensKey = "beacon:device-resume-tokens"
+
+	// RedisResumeDeviceIDField is the field that contains the id of the device a resume token was issued to
+	RedisResumeDeviceIDField = "resume:device-id"
+
+	// RedisResumeNameField is the field that contains the name of the device a resume token was issued to
+	RedisResumeNameField = "resume:name"
+
+	// RedisResumeSecretField is the field that contains the shared secret of the device a resume token was issued to
+	RedisResumeSecretField = "resume:secret"
+
+	// RedisCommandDeviceIDField is the field that contains the id of the device a command was sent to
+	RedisCommandDeviceIDField = "command:device-id"
+
+	// RedisCommandStatusField is the field that contains the status of a command
+	RedisCommandStatusField = "command:status"
+
+	// RedisCommandUpdatedField is the field that contains the unix timestamp of the last change to a command's status
+	RedisCommandUpdatedField = "command:updated"
+
+	// RedisSchemaVersionField is the field of device registry & token hashes holding the schema version they follow
+	RedisSchemaVersionField = "schema_version"
+
+	// RedisSchemaVersion is the schema version written to new device registry & token hashes
+	RedisSchemaVersion = 2
+
+	// RedisRegistrationPageSize is the amount of device ids loaded from the device index per LRANGE while walking it.
+	RedisRegistrationPageSize = 50
+
+	// RedisTokenPageSize is the amount of tokens loaded from a device's token list per LRANGE while walking it.
+	RedisTokenPageSize = 50
+
+	// RedisTokenScanCount is the COUNT hint sent w/ each SCAN while iterating every token registration.
+	RedisTokenScanCount = 100
 )
@@ -2,27 +2,87 @@ package defs
 
 import "regexp"
 
-var shorthandColors = "red|blue|green|off|rand|[0-9a-f]{6}"
+var shorthandColors = "red|blue|green|off|rand|chaos|[0-9a-f]{6}|hsl\\(-?\\d+,-?\\d+,-?\\d+\\)|hsl:-?\\d+,-?\\d+,-?\\d+"
+
+// DeviceTagPattern is used to validate the tags that devices can be grouped under.
+var DeviceTagPattern = regexp.MustCompile("^[a-z0-9_\\-]{1,32}$")
+
+// RequestIDPattern is used to validate request ids provided by clients before they are used in log lines.
+var RequestIDPattern = regexp.MustCompile("^[A-Za-z0-9_\\-\\.]{1,64}$")
+
+// IdempotencyKeyPattern is used to validate the idempotency keys provided by clients before they are stored.
+var IdempotencyKeyPattern = regexp.MustCompile("^[A-Za-z0-9_\\-\\.]{1,64}$")
 
 var (
 	// DeviceListRoute is the regular expression used for the device list route
 	DeviceListRoute = regexp.MustCompile("^/devices$")
 
+	// DeviceDetailsRoute is used to read the details of a single device
+	DeviceDetailsRoute = regexp.MustCompile("^/devices/(?P<uuid>[\\d\\w\\-]+)$")
+
 	// DeviceShorthandRoute is the regular expression used for the device shorthand route
 	DeviceShorthandRoute = regexp.MustCompile("^/devices/(?P<uuid>[\\d\\w\\-]+)/(?P<color>" + shorthandColors + ")$")
 
+	// DeviceStateRoute is used to read the color of the last control frame sent to a device
+	DeviceStateRoute = regexp.MustCompile("^/devices/(?P<uuid>[\\d\\w\\-]+)/state$")
+
+	// DeviceCommandHistoryRoute is used to list the latest control commands sent to a device.
+	DeviceCommandHistoryRoute = regexp.MustCompile("^/devices/(?P<uuid>[\\d\\w\\-]+)/commands$")
+
+	// DeviceConnectionEventsRoute is used to list the latest connects & disconnects of a device.
+	DeviceConnectionEventsRoute = regexp.MustCompile("^/devices/(?P<uuid>[\\d\\w\\-]+)/connections$")
+
+	// DeviceFeedbackListRoute is used to list the latest feedback entries of a single device.
+	DeviceFeedbackListRoute = regexp.MustCompile("^/devices/(?P<uuid>[\\d\\w\\-]+)/feedback$")
+
 	// DeviceRegistrationRoute is used by devices to register with the server
 	DeviceRegistrationRoute = regexp.MustCompile("^/register$")
 
+	// DeviceReissueRoute is used by server admins to replace the shared secret of a device that has lost its key.
+	DeviceReissueRoute = regexp.MustCompile("^/devices/(?P<uuid>[\\d\\w\\-]+)/registration$")
+
+	// DeviceExistsRoute is used to check whether a device name or id has already been registered.
+	DeviceExistsRoute = regexp.MustCompile("^/register/exists$")
+
+	// PendingRegistrationsRoute is used by server admins to list the registration requests still awaiting a device.
+	PendingRegistrationsRoute = regexp.MustCompile("^/register/pending$")
+
 	// DeviceTokensRoute is used to create device tokens for a given device.
 	DeviceTokensRoute = regexp.MustCompile("^/device-tokens$")
 
+	// AllDeviceTokensRoute is used by server admins to list the tokens of every device.
+	AllDeviceTokensRoute = regexp.MustCompile("^/device-tokens/all$")
+
+	// TokenIntrospectionRoute is used by server integrations to check whether a token is active and what it may do.
+	TokenIntrospectionRoute = regexp.MustCompile("^/introspect$")
+
 	// DeviceFeedbackRoute is used to receive device feedback from clients.
 	DeviceFeedbackRoute = regexp.MustCompile("^/device-feedback$")
 
+	// DeviceFeedbackBatchRoute is used to receive a batch of feedback messages from devices in a single request.
+	DeviceFeedbackBatchRoute = regexp.MustCompile("^/device-feedback/batch$")
+
+	// DeviceFeedbackStreamRoute is used to stream device feedback to clients as server-sent events.
+	DeviceFeedbackStreamRoute = regexp.MustCompile("^/device-feedback/stream$")
+
+	// DeviceFeedbackStatsRoute is used to read the per-level feedback counts of a device.
+	DeviceFeedbackStatsRoute = regexp.MustCompile("^/device-feedback/stats$")
+
+	// DeviceFeedbackQueryRoute is used to page through the feedback of a device, filtered by level and time.
+	DeviceFeedbackQueryRoute = regexp.MustCompile("^/device-feedback/query$")
+
+	// DeviceCommandRoute is used to read the status of a control command sent to a device.
+	DeviceCommandRoute = regexp.MustCompile("^/device-commands/(?P<id>[\\d\\w\\-]+)$")
+
 	// DeviceMessagesRoute is used to create device messages.
 	DeviceMessagesRoute = regexp.MustCompile("^/device-messages$")
 
+	// DeviceTagsRoute is used to tag devices and list the devices w/ a given tag.
+	DeviceTagsRoute = regexp.MustCompile("^/device-tags$")
+
+	// AuditLogRoute is used to read the audit log entries for a device.
+	AuditLogRoute = regexp.MustCompile("^/audit-log$")
+
 	// SystemRoute prints out system information
 	SystemRoute = regexp.MustCompile("^/system$")
 )
@@ -1,14 +1,33 @@
 package defs
 
 const (
-	// SecurityUserDeviceTokenSize is the size of user device tokens
+	// SecurityUserDeviceTokenSize is the size of user device tokens; the amount of random bytes they are generated from
+	// by default, and the minimum that token generators can be configured w/.
 	SecurityUserDeviceTokenSize = 20
 
-	// SecurityUserDeviceNameMinLength is the size of user device tokens
+	// SecurityTokenEncodingHex encodes the random bytes of generated tokens as lowercase hex.
+	SecurityTokenEncodingHex = "hex"
+
+	// SecurityTokenEncodingBase64URL encodes the random bytes of generated tokens as unpadded, url safe base64.
+	SecurityTokenEncodingBase64URL = "base64url"
+
+	// SecurityUserDeviceNameMinLength is the minimum length of the names given to device tokens
 	SecurityUserDeviceNameMinLength = 5
 
+	// SecurityDeviceNameMinLength is the minimum length of the names devices are registered under
+	SecurityDeviceNameMinLength = 4
+
 	// SecurityMinimumDeviceSharedSecretSize is the minimum size of shared secrets
 	SecurityMinimumDeviceSharedSecretSize = 20
+
+	// SecurityDeviceMetaKeyMaxLength is the maximum length of the keys of device metadata
+	SecurityDeviceMetaKeyMaxLength = 64
+
+	// SecurityDeviceMetaValueMaxLength is the maximum length of the values of device metadata
+	SecurityDeviceMetaValueMaxLength = 256
+
+	// SecurityDeviceGroupPrefix prefixes the device id of tokens scoped to every device w/ a tag (e.g "tag:kitchen")
+	SecurityDeviceGroupPrefix = "tag:"
 )
 
 // DeviceTokenPermissions is a bitmask used to authorize device actions
@@ -25,6 +44,28 @@ const (
 	SecurityDeviceTokenPermissionAdmin
 )
 
+const (
+	// SecurityDeviceTokenPermissionViewerName is the name of the viewer permission used by the api
+	SecurityDeviceTokenPermissionViewerName = "viewer"
+
+	// SecurityDeviceTokenPermissionControllerName is the name of the controller permission used by the api
+	SecurityDeviceTokenPermissionControllerName = "controller"
+
+	// SecurityDeviceTokenPermissionAdminName is the name of the admin permission used by the api
+	SecurityDeviceTokenPermissionAdminName = "admin"
+)
+
+const (
+	// SecurityDeviceTLSModeOff ignores any client certificates presented by devices during registration.
+	SecurityDeviceTLSModeOff = "off"
+
+	// SecurityDeviceTLSModeOptional verifies client certificates presented by devices during registration, if any.
+	SecurityDeviceTLSModeOptional = "optional"
+
+	// SecurityDeviceTLSModeRequired rejects device registrations that do not present a matching client certificate.
+	SecurityDeviceTLSModeRequired = "required"
+)
+
 const (
 	// SecurityDeviceTokenPermissionAll is all permissions
 	SecurityDeviceTokenPermissionAll = SecurityDeviceTokenPermissionAdmin |
@@ -6,6 +6,9 @@ import "github.com/gorilla/websocket"
 const (
 	// TextWriter asks the nextwriter for a text based writer
 	TextWriter = websocket.TextMessage
+
+	// BinaryWriter asks the nextwriter for a binary writer
+	BinaryWriter = websocket.BinaryMessage
 )
 
 // Streamer defines an interface that allows consumers to open a writer, reader and close the connection
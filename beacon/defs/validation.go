@@ -0,0 +1,45 @@
+package defs
+
+const (
+	// ValidationRequired is the field error message used when a required field is missing or empty.
+	ValidationRequired = "required"
+
+	// ValidationTooShort is the field error message used when a field is shorter than its minimum length.
+	ValidationTooShort = "too short"
+
+	// ValidationInvalidHex is the field error message used when a field is expected to be hex encoded but is not.
+	ValidationInvalidHex = "invalid hex"
+
+	// ValidationInvalidKey is the field error message used when a shared secret is not a valid rsa public key.
+	ValidationInvalidKey = "invalid key"
+
+	// ValidationUnknownPermission is the field error message used when a permission name is not recognized.
+	ValidationUnknownPermission = "unknown permission"
+
+	// ValidationUnknownColor is the field error message used when a color is not a known shorthand, hex or hsl color.
+	ValidationUnknownColor = "unknown color"
+
+	// ValidationOutOfRange is the field error message used when a value is outside of its allowed range.
+	ValidationOutOfRange = "out of range"
+
+	// ValidationUnknownMessageType is the field error message used when a device message type is not recognized.
+	ValidationUnknownMessageType = "unknown message type"
+
+	// ValidationUnknownTermination is the field error message used when a control termination is not recognized.
+	ValidationUnknownTermination = "unknown termination"
+
+	// ValidationUnknownLevel is the field error message used when a feedback level name is not recognized.
+	ValidationUnknownLevel = "unknown level"
+
+	// ValidationInvalidTime is the field error message used when a time is not formatted as RFC3339.
+	ValidationInvalidTime = "invalid time"
+
+	// ValidationInvalidCursor is the field error message used when a feedback cursor was not issued by the backend.
+	ValidationInvalidCursor = "invalid cursor"
+
+	// ValidationInvalidTag is the field error message used when a device tag does not match the allowed tag pattern.
+	ValidationInvalidTag = "invalid tag"
+
+	// ValidationTooLong is the field error message used when a field (or one of its entries) is past its maximum length.
+	ValidationTooLong = "too long"
+)
@@ -0,0 +1,6 @@
+package defs
+
+// Verifier defines an interface that checks a hex encoded message digest against the message payload
+type Verifier interface {
+	Verify(string, []byte) error
+}
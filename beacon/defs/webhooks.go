@@ -0,0 +1,32 @@
+package defs
+
+import "time"
+
+const (
+	// WebhookDeviceRegisteredEvent is dispatched when a device has filled it's registration request.
+	WebhookDeviceRegisteredEvent = "registered"
+
+	// WebhookDeviceDisconnectedEvent is dispatched when a device connection has been evicted from the control pool.
+	WebhookDeviceDisconnectedEvent = "disconnected"
+
+	// WebhookDeviceFeedbackEvent is dispatched when feedback from a device has been logged.
+	WebhookDeviceFeedbackEvent = "feedback"
+
+	// WebhookDeviceIdleEvent is dispatched when a device has been flagged as idle by the reaper.
+	WebhookDeviceIdleEvent = "idle"
+
+	// WebhookContentType is the content type used when posting events to the webhook url.
+	WebhookContentType = "application/json"
+
+	// DefaultWebhookBufferSize is the amount of events that will be held before new events are dropped.
+	DefaultWebhookBufferSize = 100
+
+	// DefaultWebhookMaxAttempts is the amount of times delivery of an event will be attempted.
+	DefaultWebhookMaxAttempts = 3
+
+	// DefaultWebhookBackoff is the initial delay between delivery attempts; it is doubled after each failure.
+	DefaultWebhookBackoff = time.Second
+
+	// DefaultWebhookTimeout is the timeout used by the http client delivering events.
+	DefaultWebhookTimeout = time.Second * 10
+)
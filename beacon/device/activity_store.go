@@ -0,0 +1,10 @@
+package device
+
+import "time"
+
+// ActivityStore defines an interface for tracking when devices were last seen, and flagging those that have gone idle.
+type ActivityStore interface {
+	TouchDevice(string) error
+	LastSeen(string) (time.Time, error)
+	FlagIdleDevice(string) error
+}
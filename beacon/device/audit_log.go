@@ -0,0 +1,18 @@
+package device
+
+import "time"
+
+// AuditEntry records a single mutation made to the devices or tokens in the registry.
+type AuditEntry struct {
+	Action    string    `json:"action"`
+	DeviceID  string    `json:"device_id"`
+	TokenID   string    `json:"token_id,omitempty"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	Timestamp time.Time `json:"ts"`
+}
+
+// AuditLog defines an interface for recording and listing audit entries.
+type AuditLog interface {
+	RecordAudit(AuditEntry) error
+	ListAuditLog(int) ([]AuditEntry, error)
+}
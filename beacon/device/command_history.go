@@ -0,0 +1,19 @@
+package device
+
+import "time"
+
+// CommandHistoryEntry records a single control command sent to a device, along w/ the token that sent it.
+type CommandHistoryEntry struct {
+	CommandID string    `json:"command_id"`
+	Red       uint32    `json:"red"`
+	Green     uint32    `json:"green"`
+	Blue      uint32    `json:"blue"`
+	TokenID   string    `json:"token_id,omitempty"`
+	Timestamp time.Time `json:"ts"`
+}
+
+// CommandHistory defines an interface for recording and listing the latest control commands sent to each device.
+type CommandHistory interface {
+	RecordCommand(string, CommandHistoryEntry) error
+	ListCommandHistory(string, int) ([]CommandHistoryEntry, error)
+}
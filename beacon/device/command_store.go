@@ -0,0 +1,18 @@
+package device
+
+import "time"
+
+// CommandStatus holds the delivery status of a control command sent to a device.
+type CommandStatus struct {
+	CommandID string    `json:"command_id"`
+	DeviceID  string    `json:"device_id"`
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CommandStore defines an interface for tracking whether the control commands sent to devices have been acknowledged.
+type CommandStore interface {
+	TrackCommand(string, string) error
+	UpdateCommandStatus(string, string, string) error
+	GetCommandStatus(string) (CommandStatus, error)
+}
@@ -0,0 +1,49 @@
+package device
+
+import "io"
+import "bytes"
+import "io/ioutil"
+import "compress/gzip"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// compressPayload gzips the payload of a message that is too large to be sent as-is.
+func compressPayload(payload []byte) ([]byte, error) {
+	buffer := bytes.NewBuffer([]byte{})
+	writer := gzip.NewWriter(buffer)
+
+	if _, e := writer.Write(payload); e != nil {
+		return nil, e
+	}
+
+	if e := writer.Close(); e != nil {
+		return nil, e
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// decompressPayload returns the original contents of a payload compressed w/ compressPayload, failing if they are
+// larger than the limit.
+func decompressPayload(payload []byte, limit int) ([]byte, error) {
+	reader, e := gzip.NewReader(bytes.NewReader(payload))
+
+	if e != nil {
+		return nil, e
+	}
+
+	defer reader.Close()
+
+	// Read one byte past the limit so that payloads expanding past it can be told apart from those that fill it.
+	data, e := ioutil.ReadAll(io.LimitReader(reader, int64(limit)+1))
+
+	if e != nil {
+		return nil, e
+	}
+
+	if len(data) > limit {
+		return nil, defs.Error(defs.ErrPayloadTooLarge)
+	}
+
+	return data, nil
+}
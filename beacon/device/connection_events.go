@@ -0,0 +1,15 @@
+package device
+
+import "time"
+
+// ConnectionEvent records a single connect or disconnect of a device connection to the control pool.
+type ConnectionEvent struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"ts"`
+}
+
+// ConnectionEventLog defines an interface for recording and listing the latest connection events of each device.
+type ConnectionEventLog interface {
+	RecordConnectionEvent(string, ConnectionEvent) error
+	ListConnectionEvents(string, int) ([]ConnectionEvent, error)
+}
@@ -0,0 +1,97 @@
+package device
+
+import "io"
+import "bytes"
+import "github.com/satori/go.uuid"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+// ControlPublisher defines the interface used to publish control messages along the device control channel.
+type ControlPublisher interface {
+	PublishReader(string, io.Reader) error
+}
+
+// ControlCommand holds a single frame to send to a device, along w/ the request and token it was sent w/.
+type ControlCommand struct {
+	DeviceID  string
+	RequestID string
+	Token     string
+	Frame     interchange.ControlFrame
+}
+
+// ControlSender sends control commands to devices on behalf of both the http api and the grpc service so that each
+// command is tracked and, once published, recorded as the state of the device and in its command history.
+type ControlSender struct {
+	logging.LeveledLogger
+	CommandStore
+	StateStore
+
+	// Tokens, if provided, is used to attribute recorded commands to the id of the token that sent them.
+	Tokens TokenStore
+
+	// History records the control commands sent to each device; when nil commands are not recorded.
+	History CommandHistory
+}
+
+// Send publishes the command to the device, returning the id it is tracked under. Errors from the publisher are
+// returned as-is so that callers are able to tell a busy device apart from a failure.
+func (sender *ControlSender) Send(publisher ControlPublisher, command ControlCommand) (string, error) {
+	commandID, frame := uuid.NewV4().String(), command.Frame
+	envelope := MessageEnvelope{RequestID: command.RequestID, CommandID: commandID}
+
+	data, e := envelope.Control(command.DeviceID, &interchange.ControlMessage{
+		Frames: []*interchange.ControlFrame{&frame},
+	})
+
+	if e != nil {
+		return "", e
+	}
+
+	if e := sender.TrackCommand(commandID, command.DeviceID); e != nil {
+		sender.Errorf("unable to track command[%s]: %s", commandID, e.Error())
+		return "", e
+	}
+
+	if e := publisher.PublishReader(defs.DeviceControlChannelName, bytes.NewBuffer(data)); e != nil {
+		sender.fail(commandID, command.DeviceID)
+		return "", e
+	}
+
+	// The command has already been published at this point; failing to record the state does not fail the command.
+	if e := sender.SetDeviceState(command.DeviceID, frame); e != nil {
+		sender.Warnf("unable to record state of device %s: %s", command.DeviceID, e.Error())
+	}
+
+	sender.record(commandID, command)
+	return commandID, nil
+}
+
+// fail marks a tracked command that could not be published as failed so that it is not left pending forever.
+func (sender *ControlSender) fail(commandID, deviceID string) {
+	if e := sender.UpdateCommandStatus(commandID, deviceID, defs.CommandStatusFailed); e != nil {
+		sender.Warnf("unable to mark unpublished command[%s] as failed: %s", commandID, e.Error())
+	}
+}
+
+// record adds the command to the device's command history, attributing it to the id of the token that sent it when
+// the token can be found. Like the device state, failing to record the command does not fail it.
+func (sender *ControlSender) record(commandID string, command ControlCommand) {
+	if sender.History == nil {
+		return
+	}
+
+	frame := command.Frame
+	entry := CommandHistoryEntry{CommandID: commandID, Red: frame.Red, Green: frame.Green, Blue: frame.Blue}
+
+	if sender.Tokens != nil && command.Token != "" {
+		if details, e := sender.Tokens.FindToken(command.Token); e == nil {
+			entry.TokenID = details.TokenID
+		}
+	}
+
+	if e := sender.History.RecordCommand(command.DeviceID, entry); e != nil {
+		sender.Warnf("unable to record command[%s] in the history of device %s: %s", commandID, command.DeviceID, e.Error())
+	}
+}
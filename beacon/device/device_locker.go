@@ -0,0 +1,12 @@
+package device
+
+// DeviceMutator defines the mutations of a device that are able to be applied together under a single lock.
+type DeviceMutator interface {
+	RenameDevice(string, string) error
+	SetDeviceMeta(string, map[string]string) error
+}
+
+// DeviceLocker defines an interface for applying several mutations of a device while holding its lock once.
+type DeviceLocker interface {
+	LockDevice(string, func(DeviceMutator) error) error
+}
@@ -0,0 +1,48 @@
+package device
+
+import "time"
+import "github.com/golang/protobuf/proto"
+
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+// MessageEnvelope holds the optional fields of the device message that built messages are wrapped in.
+type MessageEnvelope struct {
+	RequestID string
+	CommandID string
+}
+
+// BuildControlMessage marshals a control message w/ the frames, wrapped in a control device message addressed to the
+// device.
+func BuildControlMessage(deviceID string, frames []*interchange.ControlFrame) ([]byte, error) {
+	return MessageEnvelope{}.Control(deviceID, &interchange.ControlMessage{Frames: frames})
+}
+
+// Control marshals the control message and wraps it in a control device message addressed to the device.
+func (envelope MessageEnvelope) Control(deviceID string, control *interchange.ControlMessage) ([]byte, error) {
+	payload, e := proto.Marshal(control)
+
+	if e != nil {
+		return nil, e
+	}
+
+	return envelope.Build(deviceID, interchange.DeviceMessageType_CONTROL, payload)
+}
+
+// Build marshals a device message of the given type w/ the (already marshalled) payload, addressed to the device and
+// issued at the current time.
+func (envelope MessageEnvelope) Build(
+	deviceID string,
+	messageType interchange.DeviceMessageType,
+	payload []byte,
+) ([]byte, error) {
+	return proto.Marshal(&interchange.DeviceMessage{
+		Type: messageType,
+		Authentication: &interchange.DeviceMessageAuthentication{
+			DeviceID: deviceID,
+		},
+		Payload:   payload,
+		RequestID: envelope.RequestID,
+		CommandID: envelope.CommandID,
+		IssuedAt:  time.Now().Unix(),
+	})
+}
@@ -0,0 +1,81 @@
+package device
+
+import "time"
+import "testing"
+import "github.com/franela/goblin"
+import "github.com/golang/protobuf/proto"
+
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+func Test_DeviceMessages(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	unmarshal := func(data []byte) (interchange.DeviceMessage, interchange.ControlMessage) {
+		message, control := interchange.DeviceMessage{}, interchange.ControlMessage{}
+		g.Assert(proto.Unmarshal(data, &message)).Equal(nil)
+		g.Assert(proto.Unmarshal(message.Payload, &control)).Equal(nil)
+		return message, control
+	}
+
+	g.Describe("BuildControlMessage", func() {
+		frames := []*interchange.ControlFrame{
+			&interchange.ControlFrame{Red: 255},
+			&interchange.ControlFrame{Green: 10, Blue: 20},
+		}
+
+		g.It("wraps the frames in a control message addressed to the device", func() {
+			data, e := BuildControlMessage("device-1", frames)
+			g.Assert(e).Equal(nil)
+			message, control := unmarshal(data)
+			g.Assert(message.Type).Equal(interchange.DeviceMessageType_CONTROL)
+			g.Assert(message.Authentication.DeviceID).Equal("device-1")
+			g.Assert(len(control.Frames)).Equal(2)
+			g.Assert(control.Frames[0].Red).Equal(uint32(255))
+			g.Assert(control.Frames[1].Green).Equal(uint32(10))
+			g.Assert(control.Frames[1].Blue).Equal(uint32(20))
+		})
+
+		g.It("issues the message at the current time", func() {
+			before := time.Now().Unix()
+			data, _ := BuildControlMessage("device-1", frames)
+			message, _ := unmarshal(data)
+			g.Assert(message.IssuedAt >= before && message.IssuedAt <= time.Now().Unix()).Equal(true)
+		})
+
+		g.It("builds a message w/o any frames", func() {
+			data, e := BuildControlMessage("device-1", nil)
+			g.Assert(e).Equal(nil)
+			_, control := unmarshal(data)
+			g.Assert(len(control.Frames)).Equal(0)
+		})
+	})
+
+	g.Describe("MessageEnvelope", func() {
+		envelope := MessageEnvelope{RequestID: "request-1", CommandID: "command-1"}
+
+		g.It("carries the request & command ids along w/ the nested control message", func() {
+			data, e := envelope.Control("device-1", &interchange.ControlMessage{
+				Frames:      []*interchange.ControlFrame{&interchange.ControlFrame{Blue: 255}},
+				Loop:        true,
+				Termination: interchange.ControlTermination_OFF,
+			})
+			g.Assert(e).Equal(nil)
+			message, control := unmarshal(data)
+			g.Assert(message.RequestID).Equal("request-1")
+			g.Assert(message.CommandID).Equal("command-1")
+			g.Assert(control.Frames[0].Blue).Equal(uint32(255))
+			g.Assert(control.Loop).Equal(true)
+			g.Assert(control.Termination).Equal(interchange.ControlTermination_OFF)
+		})
+
+		g.It("builds messages of any type w/ the payload as-is", func() {
+			data, e := envelope.Build("device-1", interchange.DeviceMessageType_WELCOME, []byte("hello"))
+			g.Assert(e).Equal(nil)
+			message := interchange.DeviceMessage{}
+			g.Assert(proto.Unmarshal(data, &message)).Equal(nil)
+			g.Assert(message.Type).Equal(interchange.DeviceMessageType_WELCOME)
+			g.Assert(string(message.Payload)).Equal("hello")
+			g.Assert(message.Authentication.DeviceID).Equal("device-1")
+		})
+	})
+}
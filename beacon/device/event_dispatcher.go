@@ -0,0 +1,6 @@
+package device
+
+// EventDispatcher defines an interface used to notify external consumers of device events (type, device id, payload).
+type EventDispatcher interface {
+	Dispatch(string, string, interface{})
+}
@@ -1,9 +1,69 @@
 package device
 
+import "fmt"
+import "time"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
 import "github.com/dadleyy/beacon.api/beacon/interchange"
 
 // FeedbackStore defines an interface that logs device state into a persisted store.
 type FeedbackStore interface {
 	LogFeedback(interchange.FeedbackMessage) error
+	RecordFeedback(interchange.FeedbackMessage) error
+	LogFeedbackBatch([]interchange.FeedbackMessage) error
 	ListFeedback(string, int) ([]interchange.FeedbackMessage, error)
+	ListFeedbackPage(string, string, int) ([]interchange.FeedbackMessage, string, error)
+	ListFeedbackByLevel(string, int, interchange.FeedbackLevel) ([]interchange.FeedbackMessage, error)
+	FeedbackStats(string, time.Duration) (map[string]int, error)
+	QueryFeedback(string, FeedbackQuery) ([]interchange.FeedbackMessage, error)
+}
+
+// FeedbackQuery holds the predicates used to filter and page through the feedback of a device. A zero Since or Until
+// leaves that end of the time range open, and a non-positive Limit returns every matching entry after the Offset.
+type FeedbackQuery struct {
+	Level  interchange.FeedbackLevel
+	Since  time.Time
+	Until  time.Time
+	Offset int
+	Limit  int
+}
+
+// FeedbackBatchError is returned when some messages in a feedback batch could not be logged, holding the error of each
+// failed message by its index in the batch. The remaining messages of the batch are logged regardless.
+type FeedbackBatchError map[int]error
+
+func (e FeedbackBatchError) Error() string {
+	return fmt.Sprintf("%s[%d]", defs.ErrPartialFeedbackBatch, len(e))
+}
+
+// FeedbackListCount returns the amount of feedback entries listed for the requested count: the fallback when the count
+// is not positive, clamped to the maximum. The defaults stand in for a fallback or maximum that is not positive.
+func FeedbackListCount(count int, fallback int, maximum int) int {
+	if maximum < 1 {
+		maximum = defs.MaxFeedbackListCount
+	}
+
+	if fallback < 1 {
+		fallback = defs.DefaultFeedbackListCount
+	}
+
+	if count < 1 {
+		count = fallback
+	}
+
+	if count > maximum {
+		return maximum
+	}
+
+	return count
+}
+
+// FeedbackTime returns the time a feedback message was received by the server, or the zero time for entries that were
+// logged before feedback was timestamped.
+func FeedbackTime(message interchange.FeedbackMessage) time.Time {
+	if message.Timestamp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(message.Timestamp, 0)
 }
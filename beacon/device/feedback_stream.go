@@ -0,0 +1,13 @@
+package device
+
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+// FeedbackSubscription is a channel that receives feedback messages for a single device as they are received.
+type FeedbackSubscription chan interchange.FeedbackMessage
+
+// FeedbackStream defines an interface for fanning out feedback messages to subscribers interested in a device id.
+type FeedbackStream interface {
+	Subscribe(string) FeedbackSubscription
+	Unsubscribe(FeedbackSubscription)
+	Publish(interchange.FeedbackMessage)
+}
@@ -0,0 +1,7 @@
+package device
+
+// FirmwareStore defines an interface for tracking the firmware version each device last reported w/ its feedback.
+type FirmwareStore interface {
+	GetDeviceFirmware(string) (string, error)
+	ListDevicesByFirmware(string) ([]RegistrationDetails, error)
+}
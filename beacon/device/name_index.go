@@ -0,0 +1,7 @@
+package device
+
+// NameIndex defines an interface for checking whether a device name is already taken, and by which device.
+type NameIndex interface {
+	NameTaken(string) (bool, error)
+	NameOwner(string) (string, error)
+}
@@ -0,0 +1,61 @@
+package device
+
+import "time"
+import "github.com/garyburd/redigo/redis"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+
+// PoolConfig holds the limits of the connection pool used by the redis registry. Zero values for the idle & active
+// limits or the idle timeout are replaced by their defaults when the registry is constructed.
+type PoolConfig struct {
+	MaxIdle     int
+	MaxActive   int
+	IdleTimeout time.Duration
+	Wait        bool
+}
+
+// DefaultPoolConfig returns the pool limits used unless otherwise configured: at most 10 idle connections (closed after
+// 4 minutes of inactivity) and at most 100 active connections, waiting for one to free up once that limit is hit.
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		MaxIdle:     defs.DefaultRedisMaxIdle,
+		MaxActive:   defs.DefaultRedisMaxActive,
+		IdleTimeout: defs.DefaultRedisIdleTimeout,
+		Wait:        true,
+	}
+}
+
+// NewRedisRegistry returns a redis registry whose connection pool is built from the config, using the dial function to
+// open new connections. Commands that fail w/ connection errors are retried using the default retry settings.
+func NewRedisRegistry(config PoolConfig, dial func() (redis.Conn, error), generator TokenGenerator) *RedisRegistry {
+	if config.MaxIdle <= 0 {
+		config.MaxIdle = defs.DefaultRedisMaxIdle
+	}
+
+	if config.MaxActive <= 0 {
+		config.MaxActive = defs.DefaultRedisMaxActive
+	}
+
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defs.DefaultRedisIdleTimeout
+	}
+
+	pool := &redis.Pool{
+		Dial:        dial,
+		MaxIdle:     config.MaxIdle,
+		MaxActive:   config.MaxActive,
+		IdleTimeout: config.IdleTimeout,
+		Wait:        config.Wait,
+	}
+
+	return &RedisRegistry{
+		Logger:            logging.New(defs.RegistryLogPrefix, logging.Green),
+		Pool:              pool,
+		TokenGenerator:    generator,
+		Retries:           defs.DefaultRedisRetries,
+		RetryBackoff:      defs.DefaultRedisRetryBackoff,
+		MaxTokens:         defs.DefaultMaxDeviceTokens,
+		MaxCommandHistory: defs.DefaultMaxCommandHistory,
+	}
+}
@@ -0,0 +1,146 @@
+package device
+
+import "io"
+import "net"
+import "time"
+import "errors"
+import "testing"
+import "io/ioutil"
+import "github.com/franela/goblin"
+import "github.com/garyburd/redigo/redis"
+import "github.com/rafaeljusto/redigomock"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+func Test_NewRedisRegistry(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("NewRedisRegistry", func() {
+		var dials int
+		var conn *redigomock.Conn
+
+		dial := func() (redis.Conn, error) {
+			dials++
+			return conn, nil
+		}
+
+		g.BeforeEach(func() {
+			dials, conn = 0, redigomock.NewConn()
+		})
+
+		g.It("builds the pool w/ the supplied limits", func() {
+			config := PoolConfig{MaxIdle: 2, MaxActive: 5, IdleTimeout: time.Second * 30, Wait: true}
+			registry := NewRedisRegistry(config, dial, &generator)
+			g.Assert(registry.Pool.MaxIdle).Equal(2)
+			g.Assert(registry.Pool.MaxActive).Equal(5)
+			g.Assert(registry.Pool.IdleTimeout).Equal(time.Second * 30)
+			g.Assert(registry.Pool.Wait).Equal(true)
+		})
+
+		g.It("falls back to the default limits for zero values", func() {
+			registry := NewRedisRegistry(PoolConfig{}, dial, &generator)
+			g.Assert(registry.Pool.MaxIdle).Equal(defs.DefaultRedisMaxIdle)
+			g.Assert(registry.Pool.MaxActive).Equal(defs.DefaultRedisMaxActive)
+			g.Assert(registry.Pool.IdleTimeout).Equal(defs.DefaultRedisIdleTimeout)
+			g.Assert(registry.Pool.Wait).Equal(false)
+		})
+
+		g.It("returns the connection to the pool after every command", func() {
+			registry := NewRedisRegistry(PoolConfig{MaxIdle: 1, MaxActive: 1}, dial, &generator)
+			conn.Command("PING").Expect("PONG")
+
+			for i := 0; i < 3; i++ {
+				_, e := registry.Do("PING")
+				g.Assert(e).Equal(nil)
+			}
+
+			g.Assert(dials).Equal(1)
+			g.Assert(registry.Pool.ActiveCount()).Equal(1)
+		})
+	})
+}
+
+func Test_RedisRegistryDo(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("RedisRegistry.Do", func() {
+		var dials int
+		var failures int
+		var conn *redigomock.Conn
+		var registry *RedisRegistry
+
+		refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+		dial := func() (redis.Conn, error) {
+			dials++
+
+			if dials <= failures {
+				return nil, refused
+			}
+
+			return conn, nil
+		}
+
+		g.BeforeEach(func() {
+			dials, failures, conn = 0, 0, redigomock.NewConn()
+			registry = NewRedisRegistry(PoolConfig{}, dial, &generator)
+			registry.Logger.Logger.SetOutput(ioutil.Discard)
+			registry.Retries, registry.RetryBackoff = 2, time.Millisecond
+		})
+
+		g.It("retries a transient connection error on a fresh connection", func() {
+			failures = 1
+			cmd := conn.Command("PING").Expect("PONG")
+			reply, e := registry.Do("PING")
+			g.Assert(e).Equal(nil)
+			g.Assert(reply).Equal("PONG")
+			g.Assert(dials).Equal(2)
+			g.Assert(conn.Stats(cmd)).Equal(1)
+		})
+
+		g.It("returns the connection error once the retries are exhausted", func() {
+			failures = 10
+			_, e := registry.Do("PING")
+			g.Assert(e).Equal(refused)
+			g.Assert(dials).Equal(3)
+		})
+
+		g.It("does not retry errors returned by redis itself", func() {
+			cmd := conn.Command("LLEN", "some-key").ExpectError(redis.Error("WRONGTYPE bad type"))
+			_, e := registry.Do("LLEN", "some-key")
+			g.Assert(e.Error()).Equal("WRONGTYPE bad type")
+			g.Assert(conn.Stats(cmd)).Equal(1)
+		})
+
+		g.It("retries read-only commands that lost their connection mid-command", func() {
+			cmd := conn.Command("LRANGE", "some-key", 0, -1).ExpectError(io.EOF).ExpectSlice([]byte("a"))
+			reply, e := registry.Do("LRANGE", "some-key", 0, -1)
+			g.Assert(e).Equal(nil)
+			g.Assert(len(reply.([]interface{}))).Equal(1)
+			g.Assert(conn.Stats(cmd)).Equal(2)
+		})
+
+		g.It("does not retry writes that lost their connection mid-command", func() {
+			cmd := conn.Command("LPUSH", "some-key", "a").ExpectError(io.EOF).Expect(int64(1))
+			_, e := registry.Do("LPUSH", "some-key", "a")
+			g.Assert(e).Equal(io.EOF)
+			g.Assert(conn.Stats(cmd)).Equal(1)
+		})
+
+		g.It("retries writes whose connection could not be dialed", func() {
+			failures = 1
+			cmd := conn.Command("LPUSH", "some-key", "a").Expect(int64(1))
+			_, e := registry.Do("LPUSH", "some-key", "a")
+			g.Assert(e).Equal(nil)
+			g.Assert(dials).Equal(2)
+			g.Assert(conn.Stats(cmd)).Equal(1)
+		})
+
+		g.It("does not retry when retries are disabled", func() {
+			failures, registry.Retries = 10, 0
+			_, e := registry.Do("PING")
+			g.Assert(e).Equal(refused)
+			g.Assert(dials).Equal(1)
+		})
+	})
+}
@@ -0,0 +1,42 @@
+package device
+
+import "crypto/rand"
+import "encoding/hex"
+import "encoding/base64"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// RandomTokenGenerator implements the `TokenGenerator` interface, encoding a fixed amount of bytes read from
+// crypto/rand into each token.
+type RandomTokenGenerator struct {
+	size   int
+	encode func([]byte) string
+}
+
+// NewRandomTokenGenerator returns a generator of tokens encoding the amount of random bytes w/ the encoding (hex or
+// url safe base64). Sizes below the minimum token size are rejected as they do not provide enough entropy.
+func NewRandomTokenGenerator(size int, encoding string) (*RandomTokenGenerator, error) {
+	if size < defs.SecurityUserDeviceTokenSize {
+		return nil, defs.Error(defs.ErrInsecureTokenSize)
+	}
+
+	switch encoding {
+	case defs.SecurityTokenEncodingHex:
+		return &RandomTokenGenerator{size, hex.EncodeToString}, nil
+	case defs.SecurityTokenEncodingBase64URL:
+		return &RandomTokenGenerator{size, base64.RawURLEncoding.EncodeToString}, nil
+	}
+
+	return nil, defs.Error(defs.ErrInvalidTokenEncoding)
+}
+
+// GenerateToken returns a new token, failing if unable to read enough random bytes.
+func (generator *RandomTokenGenerator) GenerateToken() (string, error) {
+	buffer := make([]byte, generator.size)
+
+	if _, e := rand.Read(buffer); e != nil {
+		return "", e
+	}
+
+	return generator.encode(buffer), nil
+}
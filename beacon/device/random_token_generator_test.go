@@ -0,0 +1,57 @@
+package device
+
+import "regexp"
+import "testing"
+import "encoding/base64"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+func Test_RandomTokenGenerator(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("RandomTokenGenerator", func() {
+		g.It("rejects sizes below the minimum token size", func() {
+			_, e := NewRandomTokenGenerator(defs.SecurityUserDeviceTokenSize-1, defs.SecurityTokenEncodingHex)
+			g.Assert(e).Equal(defs.Error(defs.ErrInsecureTokenSize))
+		})
+
+		g.It("rejects unknown encodings", func() {
+			_, e := NewRandomTokenGenerator(defs.SecurityUserDeviceTokenSize, "base32")
+			g.Assert(e).Equal(defs.Error(defs.ErrInvalidTokenEncoding))
+		})
+
+		g.It("generates lowercase hex tokens w/ two characters per byte", func() {
+			generator, e := NewRandomTokenGenerator(32, defs.SecurityTokenEncodingHex)
+			g.Assert(e).Equal(nil)
+			token, e := generator.GenerateToken()
+			g.Assert(e).Equal(nil)
+			g.Assert(len(token)).Equal(64)
+			g.Assert(regexp.MustCompile("^[0-9a-f]+$").MatchString(token)).Equal(true)
+		})
+
+		g.It("generates unpadded, url safe base64 tokens", func() {
+			generator, e := NewRandomTokenGenerator(defs.SecurityUserDeviceTokenSize, defs.SecurityTokenEncodingBase64URL)
+			g.Assert(e).Equal(nil)
+
+			for i := 0; i < 100; i++ {
+				token, e := generator.GenerateToken()
+				g.Assert(e).Equal(nil)
+				g.Assert(len(token)).Equal(base64.RawURLEncoding.EncodedLen(defs.SecurityUserDeviceTokenSize))
+				g.Assert(regexp.MustCompile("^[A-Za-z0-9_\\-]+$").MatchString(token)).Equal(true)
+			}
+		})
+
+		g.It("does not repeat tokens across many calls", func() {
+			generator, _ := NewRandomTokenGenerator(defs.SecurityUserDeviceTokenSize, defs.SecurityTokenEncodingHex)
+			seen := make(map[string]bool)
+
+			for i := 0; i < 10000; i++ {
+				token, e := generator.GenerateToken()
+				g.Assert(e).Equal(nil)
+				g.Assert(seen[token]).Equal(false)
+				seen[token] = true
+			}
+		})
+	})
+}
@@ -0,0 +1,45 @@
+package device
+
+import "time"
+import "encoding/json"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// RecordAudit pushes the entry onto the audit log, trimming the log if it has grown past the max amount of entries.
+func (registry *RedisRegistry) RecordAudit(entry AuditEntry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	data, e := json.Marshal(entry)
+
+	if e != nil {
+		return e
+	}
+
+	return registry.pushCapped(registry.genAuditLogKey(), string(data), defs.RedisMaxAuditEntries)
+}
+
+// ListAuditLog returns the latest entries from the audit log, skipping any that are unable to be parsed.
+func (registry *RedisRegistry) ListAuditLog(limit int) ([]AuditEntry, error) {
+	items, e := registry.lrangestr(registry.genAuditLogKey(), 0, limit-1)
+
+	if e != nil {
+		return nil, e
+	}
+
+	entries := make([]AuditEntry, 0, len(items))
+
+	for _, item := range items {
+		entry := AuditEntry{}
+
+		if e := json.Unmarshal([]byte(item), &entry); e != nil {
+			registry.Warnf("invalid audit entry: %s", e.Error())
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,654 @@
+package device
+
+import "time"
+import "bytes"
+import "strconv"
+import "strings"
+import "github.com/garyburd/redigo/redis"
+import "github.com/golang/protobuf/proto"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+// ListFeedback retrieves the latest feedback for a given device id, treating count as the index of the last entry
+// returned (so count+1 entries are returned); a negative count returns every entry.
+func (registry *RedisRegistry) ListFeedback(id string, count int) ([]interchange.FeedbackMessage, error) {
+	details, e := registry.FindDevice(id)
+
+	if e != nil {
+		return nil, e
+	}
+
+	feedbackKey := registry.genFeedbackKey(details.DeviceID)
+
+	list, _, e := registry.feedbackPage(feedbackKey, "", count+1)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if filled := len(list) >= 1; filled == false {
+		return nil, nil
+	}
+
+	results, e := registry.decodeFeedback(feedbackKey, list)
+
+	if e != nil {
+		return nil, e
+	}
+
+	registry.Debugf("found %d entries for device key: %s (returning %d)", len(list), feedbackKey, len(results))
+	return results, nil
+}
+
+// ListFeedbackPage retrieves up to count of the feedback entries for a given device id, newest first, starting after
+// the cursor; an empty cursor starts at the latest entry. The cursor of the next page is returned along w/ the entries
+// and is empty once every entry has been returned. Cursors of the stream backend are entry ids, remaining stable while
+// new feedback is logged, while those of the list backend are offsets into the feedback stack.
+func (registry *RedisRegistry) ListFeedbackPage(
+	id string,
+	cursor string,
+	count int,
+) ([]interchange.FeedbackMessage, string, error) {
+	details, e := registry.FindDevice(id)
+
+	if e != nil {
+		return nil, "", e
+	}
+
+	feedbackKey := registry.genFeedbackKey(details.DeviceID)
+
+	list, next, e := registry.feedbackPage(feedbackKey, cursor, count)
+
+	if e != nil {
+		return nil, "", e
+	}
+
+	results, e := registry.decodeFeedback(feedbackKey, list)
+
+	if e != nil {
+		return nil, "", e
+	}
+
+	return results, next, nil
+}
+
+// ListFeedbackByLevel retrieves up to count of the latest feedback entries for a given device id whose level is at least
+// the minimum level. Entries w/ an unknown level are treated as info.
+func (registry *RedisRegistry) ListFeedbackByLevel(
+	id string,
+	count int,
+	minimum interchange.FeedbackLevel,
+) ([]interchange.FeedbackMessage, error) {
+	results := make([]interchange.FeedbackMessage, 0, count)
+
+	if count <= 0 {
+		return results, nil
+	}
+
+	e := registry.walkFeedback(id, func(message interchange.FeedbackMessage) bool {
+		if feedbackLevel(message) >= minimum {
+			results = append(results, message)
+		}
+
+		return len(results) < count
+	})
+
+	if e != nil {
+		return nil, e
+	}
+
+	return results, nil
+}
+
+// FeedbackStats returns the amount of feedback entries logged for a given device id within the window, grouped by the
+// lowercased name of their level. Every level is present in the result, even if no entries were found for it.
+func (registry *RedisRegistry) FeedbackStats(id string, window time.Duration) (map[string]int, error) {
+	stats := make(map[string]int, len(interchange.FeedbackLevel_name))
+
+	for value := range interchange.FeedbackLevel_name {
+		stats[feedbackLevelName(interchange.FeedbackLevel(value))] = 0
+	}
+
+	cutoff := time.Now().Add(-window)
+
+	// The stack is newest first; once an entry is older than the window (or was logged before feedback was timestamped,
+	// leaving it w/o a known age) every entry after it will be too.
+	e := registry.walkFeedback(id, func(message interchange.FeedbackMessage) bool {
+		if message.Timestamp == 0 || time.Unix(message.Timestamp, 0).Before(cutoff) {
+			return false
+		}
+
+		stats[feedbackLevelName(feedbackLevel(message))]++
+		return true
+	})
+
+	if e != nil {
+		return nil, e
+	}
+
+	return stats, nil
+}
+
+// walkFeedback loads the feedback entries of a device a page at a time, newest first, invoking the callback w/ each
+// entry until it returns false or every entry has been visited.
+func (registry *RedisRegistry) walkFeedback(id string, fn func(interchange.FeedbackMessage) bool) error {
+	details, e := registry.FindDevice(id)
+
+	if e != nil {
+		return e
+	}
+
+	feedbackKey, cursor := registry.genFeedbackKey(details.DeviceID), ""
+
+	for {
+		page, next, e := registry.feedbackPage(feedbackKey, cursor, defs.RedisFeedbackQueryPageSize)
+
+		if e != nil {
+			return e
+		}
+
+		messages, e := registry.decodeFeedback(feedbackKey, page)
+
+		if e != nil {
+			return e
+		}
+
+		for _, message := range messages {
+			if fn(message) != true {
+				return nil
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+
+		cursor = next
+	}
+}
+
+// QueryFeedback returns the feedback entries of a device that match the query, newest first. The feedback stack is
+// loaded a page at a time and stops being read once the limit is reached or the entries are older than the since time.
+// Entries logged before feedback was timestamped only match queries w/o a time range.
+func (registry *RedisRegistry) QueryFeedback(
+	id string,
+	query FeedbackQuery,
+) ([]interchange.FeedbackMessage, error) {
+	if query.Since.IsZero() == false && query.Until.IsZero() == false && query.Since.After(query.Until) {
+		return nil, defs.Error(defs.ErrInvalidFeedbackRange)
+	}
+
+	details, e := registry.FindDevice(id)
+
+	if e != nil {
+		return nil, e
+	}
+
+	feedbackKey, results, skipped := registry.genFeedbackKey(details.DeviceID), make([]interchange.FeedbackMessage, 0), 0
+	ranged, cursor := query.Since.IsZero() == false || query.Until.IsZero() == false, ""
+
+	for {
+		page, next, e := registry.feedbackPage(feedbackKey, cursor, defs.RedisFeedbackQueryPageSize)
+
+		if e != nil {
+			return nil, e
+		}
+
+		for _, entry := range page {
+			message := interchange.FeedbackMessage{}
+
+			if e := proto.UnmarshalText(entry, &message); e != nil {
+				registry.Warnf("invalid feedback item device[%s]: %s", feedbackKey, e.Error())
+				return nil, defs.Error(defs.ErrBadInterchangeData)
+			}
+
+			received := FeedbackTime(message)
+
+			// The stack is newest first; once an entry is older than the range every entry after it will be too.
+			if ranged && (received.IsZero() || received.Before(query.Since)) {
+				return results, nil
+			}
+
+			if query.Until.IsZero() == false && received.After(query.Until) {
+				continue
+			}
+
+			if feedbackLevel(message) < query.Level {
+				continue
+			}
+
+			if skipped < query.Offset {
+				skipped++
+				continue
+			}
+
+			results = append(results, message)
+
+			if query.Limit > 0 && len(results) >= query.Limit {
+				return results, nil
+			}
+		}
+
+		if next == "" {
+			return results, nil
+		}
+
+		cursor = next
+	}
+}
+
+// LogFeedback inserts a feedback item into the redis store, stamping it w/ the time it was received.
+func (registry *RedisRegistry) LogFeedback(message interchange.FeedbackMessage) error {
+	deviceID, e := registry.storeFeedback(&message)
+
+	if e != nil {
+		return e
+	}
+
+	if e := registry.TouchDevice(deviceID); e != nil {
+		registry.Warnf("unable to update last seen time of device[%s]: %s", deviceID, e.Error())
+	}
+
+	if e := registry.recordFirmware(deviceID, message.Firmware); e != nil {
+		registry.Warnf("unable to update firmware version of device[%s]: %s", deviceID, e.Error())
+	}
+
+	registry.dispatch(defs.WebhookDeviceFeedbackEvent, deviceID, message)
+	return nil
+}
+
+// RecordFeedback inserts a feedback item generated on behalf of a device (e.g a command the server was unable to send
+// to it). The device was not heard from; its last seen time and firmware version are left as they are.
+func (registry *RedisRegistry) RecordFeedback(message interchange.FeedbackMessage) error {
+	deviceID, e := registry.storeFeedback(&message)
+
+	if e != nil {
+		return e
+	}
+
+	registry.dispatch(defs.WebhookDeviceFeedbackEvent, deviceID, message)
+	return nil
+}
+
+// storeFeedback stamps the message and pushes it onto the feedback stack of its device, returning the device id.
+func (registry *RedisRegistry) storeFeedback(message *interchange.FeedbackMessage) (string, error) {
+	auth := message.GetAuthentication()
+
+	if auth == nil {
+		return "", defs.Error(defs.ErrBadInterchangeAuthentication)
+	}
+
+	details, e := registry.FindDevice(auth.DeviceID)
+
+	if e != nil {
+		return "", e
+	}
+
+	feedbackKey, textBuffer := registry.genFeedbackKey(details.DeviceID), bytes.NewBuffer([]byte{})
+
+	if registry.streaming() != true {
+		count, e := registry.llen(feedbackKey)
+
+		if e != nil {
+			return "", e
+		}
+
+		if count >= defs.RedisMaxFeedbackEntries {
+			registry.Warnf("feedback stack[%s] exceeds max[%d] entries, trimming", feedbackKey, defs.RedisMaxFeedbackEntries)
+
+			if _, e := registry.Do("LTRIM", feedbackKey, 0, defs.RedisMaxFeedbackEntries-2); e != nil {
+				registry.Errorf("unable to trim device feedback stack: %s", e.Error())
+				return "", e
+			}
+		}
+	}
+
+	message.Timestamp = time.Now().Unix()
+
+	if e := proto.MarshalText(textBuffer, message); e != nil {
+		return "", e
+	}
+
+	if e := registry.appendFeedback(feedbackKey, textBuffer.String()); e != nil {
+		return "", e
+	}
+
+	registry.Debugf("logging state for device: %s", feedbackKey)
+	return details.DeviceID, nil
+}
+
+// LogFeedbackBatch logs a batch of feedback messages, grouping them by device so that the entries of each device are
+// pushed (and its feedback stack trimmed) in a single pipelined round trip. Each message's digest is verified against
+// the key of its device before it is logged. Messages that cannot be logged are reported in the returned
+// FeedbackBatchError w/o discarding the rest of the batch.
+func (registry *RedisRegistry) LogFeedbackBatch(messages []interchange.FeedbackMessage) error {
+	failures, groups, order := make(FeedbackBatchError), make(map[string][]int), make([]string, 0)
+
+	for i, message := range messages {
+		auth := message.GetAuthentication()
+
+		if auth == nil {
+			failures[i] = defs.Error(defs.ErrBadInterchangeAuthentication)
+			continue
+		}
+
+		if _, ok := groups[auth.DeviceID]; ok != true {
+			order = append(order, auth.DeviceID)
+		}
+
+		groups[auth.DeviceID] = append(groups[auth.DeviceID], i)
+	}
+
+	now := time.Now().Unix()
+
+	for _, query := range order {
+		indices := groups[query]
+		details, e := registry.FindDevice(query)
+
+		if e != nil {
+			for _, i := range indices {
+				failures[i] = e
+			}
+
+			continue
+		}
+
+		entries, logged := make([]string, 0, len(indices)), make([]int, 0, len(indices))
+		stamped, firmware := make([]interchange.FeedbackMessage, 0, len(indices)), ""
+
+		for _, i := range indices {
+			message, textBuffer := messages[i], bytes.NewBuffer([]byte{})
+
+			if e := VerifyFeedback(details, message); e != nil {
+				registry.Warnf("unable to verify feedback of device[%s] in batch: %s", details.DeviceID, e.Error())
+				failures[i] = defs.Error(defs.ErrBadInterchangeAuthentication)
+				continue
+			}
+
+			message.Timestamp = now
+
+			if e := proto.MarshalText(textBuffer, &message); e != nil {
+				failures[i] = e
+				continue
+			}
+
+			entries, logged = append(entries, textBuffer.String()), append(logged, i)
+			stamped = append(stamped, message)
+
+			if message.Firmware != "" {
+				firmware = message.Firmware
+			}
+		}
+
+		if len(entries) == 0 {
+			continue
+		}
+
+		if e := registry.pushFeedback(registry.genFeedbackKey(details.DeviceID), entries); e != nil {
+			for _, i := range logged {
+				failures[i] = e
+			}
+
+			continue
+		}
+
+		if e := registry.TouchDevice(details.DeviceID); e != nil {
+			registry.Warnf("unable to update last seen time of device[%s]: %s", details.DeviceID, e.Error())
+		}
+
+		if e := registry.recordFirmware(details.DeviceID, firmware); e != nil {
+			registry.Warnf("unable to update firmware version of device[%s]: %s", details.DeviceID, e.Error())
+		}
+
+		for _, message := range stamped {
+			registry.dispatch(defs.WebhookDeviceFeedbackEvent, details.DeviceID, message)
+		}
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+
+	return nil
+}
+
+// appendFeedback adds a single entry to the feedback of a device. List entries are pushed onto the feedback stack,
+// which is trimmed separately, while stream entries are added w/ a max length that trims the stream as they are added.
+func (registry *RedisRegistry) appendFeedback(feedbackKey string, entry string) error {
+	if registry.streaming() {
+		return registry.pushFeedback(feedbackKey, []string{entry})
+	}
+
+	_, e := registry.Do("LPUSH", feedbackKey, entry)
+	return e
+}
+
+// pushFeedback pipelines the push of the entries onto the feedback stack w/ the trim that keeps the stack at its max
+// size, sending both over a single connection. Entries of the stream backend are each added w/ the max length instead.
+func (registry *RedisRegistry) pushFeedback(feedbackKey string, entries []string) error {
+	conn, e := registry.connection()
+
+	if e != nil {
+		return e
+	}
+
+	defer conn.Close()
+
+	if registry.streaming() {
+		return registry.addFeedbackEntries(conn, feedbackKey, entries)
+	}
+
+	args := []interface{}{feedbackKey}
+
+	for _, entry := range entries {
+		args = append(args, entry)
+	}
+
+	if e := conn.Send("LPUSH", args...); e != nil {
+		return e
+	}
+
+	if e := conn.Send("LTRIM", feedbackKey, 0, defs.RedisMaxFeedbackEntries-1); e != nil {
+		return e
+	}
+
+	if e := conn.Flush(); e != nil {
+		return e
+	}
+
+	count, e := redis.Int(conn.Receive())
+
+	if e != nil {
+		return e
+	}
+
+	if count > defs.RedisMaxFeedbackEntries {
+		registry.Warnf("feedback stack[%s] exceeds max[%d] entries, trimming", feedbackKey, defs.RedisMaxFeedbackEntries)
+	}
+
+	_, e = conn.Receive()
+	return e
+}
+
+// addFeedbackEntries pipelines an XADD for each of the entries onto the feedback stream, oldest first, trimming the
+// stream to the max amount of feedback entries.
+func (registry *RedisRegistry) addFeedbackEntries(conn redis.Conn, feedbackKey string, entries []string) error {
+	for _, entry := range entries {
+		args := []interface{}{feedbackKey, "MAXLEN", defs.RedisMaxFeedbackEntries, "*", defs.RedisFeedbackStreamField, entry}
+
+		if e := conn.Send("XADD", args...); e != nil {
+			return e
+		}
+	}
+
+	if e := conn.Flush(); e != nil {
+		return e
+	}
+
+	for range entries {
+		if _, e := conn.Receive(); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// feedbackPage loads up to count raw feedback entries, newest first, starting after the cursor (an empty cursor starts
+// at the latest entry while a non-positive count loads every remaining entry), returning them along w/ the cursor of
+// the next page. The returned cursor is empty once every entry has been loaded.
+func (registry *RedisRegistry) feedbackPage(feedbackKey, cursor string, count int) ([]string, string, error) {
+	if registry.streaming() {
+		return registry.feedbackStreamPage(feedbackKey, cursor, count)
+	}
+
+	start, end := 0, -1
+
+	if cursor != "" {
+		offset, e := strconv.Atoi(cursor)
+
+		if e != nil || offset < 0 {
+			return nil, "", defs.Error(defs.ErrInvalidFeedbackCursor)
+		}
+
+		start = offset
+	}
+
+	if count > 0 {
+		end = start + count - 1
+	}
+
+	page, e := registry.lrangestr(feedbackKey, start, end)
+
+	if e != nil {
+		return nil, "", e
+	}
+
+	if count <= 0 || len(page) < count {
+		return page, "", nil
+	}
+
+	return page, strconv.Itoa(start + len(page)), nil
+}
+
+// feedbackStreamPage is the stream backend implementation of feedbackPage, using XREVRANGE from the entry id of the
+// cursor. Since the range includes the cursor entry itself, an extra entry is loaded and the cursor entry is skipped.
+func (registry *RedisRegistry) feedbackStreamPage(feedbackKey, cursor string, count int) ([]string, string, error) {
+	start := "+"
+
+	if cursor != "" {
+		if validStreamID(cursor) != true {
+			return nil, "", defs.Error(defs.ErrInvalidFeedbackCursor)
+		}
+
+		start = cursor
+	}
+
+	args := []interface{}{feedbackKey, start, "-"}
+
+	if count > 0 && cursor != "" {
+		args = append(args, "COUNT", count+1)
+	} else if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+
+	response, e := registry.Do("XREVRANGE", args...)
+
+	if e != nil {
+		return nil, "", e
+	}
+
+	entries, e := redis.Values(response, e)
+
+	if e != nil {
+		return nil, "", defs.Error(defs.ErrBadRedisResponse)
+	}
+
+	results, last := make([]string, 0, len(entries)), ""
+
+	for _, entry := range entries {
+		parts, e := redis.Values(entry, nil)
+
+		if e != nil || len(parts) != 2 {
+			return nil, "", defs.Error(defs.ErrBadRedisResponse)
+		}
+
+		id, e := redis.String(parts[0], nil)
+
+		if e != nil {
+			return nil, "", defs.Error(defs.ErrBadRedisResponse)
+		}
+
+		fields, e := redis.StringMap(parts[1], nil)
+
+		if e != nil {
+			return nil, "", defs.Error(defs.ErrBadRedisResponse)
+		}
+
+		if id == cursor || (count > 0 && len(results) >= count) {
+			continue
+		}
+
+		results, last = append(results, fields[defs.RedisFeedbackStreamField]), id
+	}
+
+	if count <= 0 || len(results) < count {
+		return results, "", nil
+	}
+
+	return results, last, nil
+}
+
+// decodeFeedback unmarshals the raw feedback entries loaded from the feedback key.
+func (registry *RedisRegistry) decodeFeedback(
+	feedbackKey string,
+	entries []string,
+) ([]interchange.FeedbackMessage, error) {
+	results := make([]interchange.FeedbackMessage, 0, len(entries))
+
+	for _, entry := range entries {
+		message := interchange.FeedbackMessage{}
+
+		if e := proto.UnmarshalText(entry, &message); e != nil {
+			registry.Warnf("invalid feedback item device[%s]: %s", feedbackKey, e.Error())
+			return nil, defs.Error(defs.ErrBadInterchangeData)
+		}
+
+		results = append(results, message)
+	}
+
+	return results, nil
+}
+
+// validStreamID returns whether the value is a redis stream entry id, made up of a millisecond timestamp and sequence
+// number separated by a dash.
+func validStreamID(value string) bool {
+	parts := strings.Split(value, "-")
+
+	if len(parts) != 2 {
+		return false
+	}
+
+	for _, part := range parts {
+		if _, e := strconv.ParseUint(part, 10, 64); e != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// feedbackLevel returns the level of a feedback message, treating unknown levels as info.
+func feedbackLevel(message interchange.FeedbackMessage) interchange.FeedbackLevel {
+	if _, ok := interchange.FeedbackLevel_name[int32(message.Level)]; ok != true {
+		return interchange.FeedbackLevel_LEVEL_INFO
+	}
+
+	return message.Level
+}
+
+// feedbackLevelName returns the lowercased name of a feedback level, without the enum prefix (e.g. "warn").
+func feedbackLevelName(level interchange.FeedbackLevel) string {
+	return strings.ToLower(strings.TrimPrefix(level.String(), "LEVEL_"))
+}
@@ -0,0 +1,76 @@
+package device
+
+import "time"
+import "github.com/satori/go.uuid"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// withDeviceLock runs the mutation while holding the lock of the device, failing w/o running it when another mutation
+// of the same device holds the lock for longer than the lock wait. Each acquisition sets a unique token as the value of
+// the lock, which is used as a fence when releasing it: a lock that expired while the mutation was running (and may
+// have been taken since) is not released. Devices are not locked when the registry has no lock ttl.
+func (registry *RedisRegistry) withDeviceLock(deviceID string, mutation func() error) error {
+	if registry.LockTTL <= 0 {
+		return mutation()
+	}
+
+	key, token := registry.genLockKey(deviceID), uuid.NewV4().String()
+
+	if e := registry.acquireDeviceLock(key, token); e != nil {
+		return e
+	}
+
+	defer registry.releaseDeviceLock(key, token)
+
+	return mutation()
+}
+
+// LockDevice runs the mutations while holding the lock of the device once, rather than having each mutation take the
+// lock on its own; the mutator given to them must only be used before they return.
+func (registry *RedisRegistry) LockDevice(deviceID string, mutations func(DeviceMutator) error) error {
+	return registry.withDeviceLock(deviceID, func() error {
+		return mutations(&lockedDevice{registry})
+	})
+}
+
+// acquireDeviceLock sets the lock to the token, retrying while another mutation holds it until the lock wait passes.
+func (registry *RedisRegistry) acquireDeviceLock(key, token string) error {
+	deadline := time.Now().Add(registry.LockWait)
+
+	for {
+		reply, e := registry.Do("SET", key, token, "NX", "PX", int64(registry.LockTTL/time.Millisecond))
+
+		if e != nil {
+			return e
+		}
+
+		if reply != nil {
+			return nil
+		}
+
+		if time.Now().Add(defs.DeviceLockRetryInterval).After(deadline) {
+			return defs.Error(defs.ErrDeviceLocked)
+		}
+
+		time.Sleep(defs.DeviceLockRetryInterval)
+	}
+}
+
+func (registry *RedisRegistry) releaseDeviceLock(key, token string) {
+	if _, e := registry.eval(releaseLockScript, []string{key}, token); e != nil {
+		registry.Warnf("unable to release device lock[%s]: %s", key, e.Error())
+	}
+}
+
+// lockedDevice applies the mutations of a device whose lock is already held.
+type lockedDevice struct {
+	registry *RedisRegistry
+}
+
+func (locked *lockedDevice) RenameDevice(deviceID, name string) error {
+	return locked.registry.renameDevice(deviceID, name)
+}
+
+func (locked *lockedDevice) SetDeviceMeta(deviceID string, meta map[string]string) error {
+	return locked.registry.setDeviceMeta(deviceID, meta)
+}
@@ -0,0 +1,96 @@
+package device
+
+import "strconv"
+import "github.com/garyburd/redigo/redis"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// registryMigration upgrades a device registry or token hash written at the schema version before its own (e.g by
+// renaming fields or backfilling defaults).
+type registryMigration struct {
+	version int
+	apply   func(*RedisRegistry, string) error
+}
+
+// registryMigrations are applied in order to each hash older than their version; the version of the last migration
+// is expected to match the schema version written to new hashes.
+var registryMigrations = []registryMigration{
+	// v2 introduced the schema version field itself; older hashes only need to be stamped w/ it.
+	{version: 2, apply: func(*RedisRegistry, string) error { return nil }},
+}
+
+// RegistryMigrator defines an interface for upgrading the records of a registry to the current schema version.
+type RegistryMigrator interface {
+	MigrateRegistry(int) error
+}
+
+// MigrateRegistry upgrades the device registry and token hashes older than the current schema version, stamping each
+// w/ the current version once upgraded. Hashes written before schema versions were stamped are assumed to be at the
+// version provided; hashes already at the current version are left untouched.
+func (registry *RedisRegistry) MigrateRegistry(fromVersion int) error {
+	if fromVersion < 1 || fromVersion > defs.RedisSchemaVersion {
+		return defs.Error(defs.ErrInvalidSchemaVersion)
+	}
+
+	prefixes, migrated := []string{defs.RedisDeviceRegistryKey, defs.RedisDeviceTokenRegistrationKey}, 0
+
+	for _, prefix := range prefixes {
+		var failure error
+
+		e := registry.scan(registry.genKeyPrefix(prefix), func(key string) bool {
+			upgraded, e := registry.migrate(key, fromVersion)
+
+			if e != nil {
+				failure = e
+				return false
+			}
+
+			if upgraded {
+				migrated++
+			}
+
+			return true
+		})
+
+		if e != nil {
+			return e
+		}
+
+		if failure != nil {
+			return failure
+		}
+	}
+
+	registry.Infof("migrated %d record(s) to schema version %d", migrated, defs.RedisSchemaVersion)
+	return nil
+}
+
+// migrate applies the migrations newer than the schema version of the hash, returning whether it was upgraded.
+func (registry *RedisRegistry) migrate(key string, fromVersion int) (bool, error) {
+	version, e := redis.Int(registry.Do("HGET", key, defs.RedisSchemaVersionField))
+
+	if e == redis.ErrNil {
+		version, e = fromVersion, nil
+	}
+
+	if e != nil {
+		registry.Errorf("unable to read schema version of %s: %s", key, e.Error())
+		return false, e
+	}
+
+	if version >= defs.RedisSchemaVersion {
+		return false, nil
+	}
+
+	for _, migration := range registryMigrations {
+		if migration.version <= version {
+			continue
+		}
+
+		if e := migration.apply(registry, key); e != nil {
+			registry.Errorf("unable to migrate %s to schema version %d: %s", key, migration.version, e.Error())
+			return false, e
+		}
+	}
+
+	return true, registry.hset(key, defs.RedisSchemaVersionField, strconv.Itoa(defs.RedisSchemaVersion))
+}
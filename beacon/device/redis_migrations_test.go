@@ -0,0 +1,93 @@
+package device
+
+import "fmt"
+import "strconv"
+import "testing"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+func Test_MigrateRegistry(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("MigrateRegistry", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		devices, tokens := r.genRegistryKey(""), r.genTokenRegistrationKey("")
+		current := strconv.Itoa(defs.RedisSchemaVersion)
+
+		scan := func(prefix string, keys ...string) {
+			entries := make([]interface{}, 0, len(keys))
+
+			for _, key := range keys {
+				entries = append(entries, []byte(key))
+			}
+
+			reply := []interface{}{[]byte("0"), entries}
+			mock.Command("SCAN", "0", "MATCH", prefix+"*", "COUNT", defs.RedisTokenScanCount).Expect(reply)
+		}
+
+		g.It("rejects unknown schema versions w/o scanning", func() {
+			g.Assert(r.MigrateRegistry(0) == defs.Error(defs.ErrInvalidSchemaVersion)).Equal(true)
+			g.Assert(r.MigrateRegistry(defs.RedisSchemaVersion+1) == defs.Error(defs.ErrInvalidSchemaVersion)).Equal(true)
+			g.Assert(len(mock.history)).Equal(0)
+		})
+
+		g.It("errors if unable to scan the registry", func() {
+			scanDevices := mock.Command("SCAN", "0", "MATCH", devices+"*", "COUNT", defs.RedisTokenScanCount)
+			scanDevices.ExpectError(fmt.Errorf("bad-scan"))
+			g.Assert(r.MigrateRegistry(1).Error()).Equal("bad-scan")
+		})
+
+		g.Describe("w/ a v1 device and token", func() {
+			device, token := r.genRegistryKey("device-1"), r.genTokenRegistrationKey("token-1")
+
+			g.BeforeEach(func() {
+				scan(devices, device)
+				scan(tokens, token)
+				mock.Command("HGET", device, defs.RedisSchemaVersionField).Expect(nil)
+				mock.Command("HGET", token, defs.RedisSchemaVersionField).Expect([]byte("1"))
+			})
+
+			g.It("upgrades and stamps both records w/ the current version", func() {
+				stampDevice := mock.Command("HSET", device, defs.RedisSchemaVersionField, current).Expect(int64(1))
+				stampToken := mock.Command("HSET", token, defs.RedisSchemaVersionField, current).Expect(int64(1))
+				g.Assert(r.MigrateRegistry(1)).Equal(nil)
+				g.Assert(mock.c.Stats(stampDevice)).Equal(1)
+				g.Assert(mock.c.Stats(stampToken)).Equal(1)
+			})
+
+			g.It("stops at the first record that fails to be stamped", func() {
+				mock.Command("HSET", device, defs.RedisSchemaVersionField, current).ExpectError(fmt.Errorf("bad-hset"))
+				g.Assert(r.MigrateRegistry(1).Error()).Equal("bad-hset")
+				g.Assert(mock.history).Equal([]string{"SCAN", "HGET", "HSET"})
+			})
+		})
+
+		g.It("leaves records already at the current version untouched", func() {
+			device := r.genRegistryKey("device-2")
+			scan(devices, device)
+			scan(tokens)
+			mock.Command("HGET", device, defs.RedisSchemaVersionField).Expect([]byte(current))
+			g.Assert(r.MigrateRegistry(1)).Equal(nil)
+			g.Assert(mock.history).Equal([]string{"SCAN", "HGET", "SCAN"})
+		})
+
+		g.It("treats records w/o a schema version as being at the version migrated from", func() {
+			device := r.genRegistryKey("device-3")
+			scan(devices, device)
+			scan(tokens)
+			mock.Command("HGET", device, defs.RedisSchemaVersionField).Expect(nil)
+			g.Assert(r.MigrateRegistry(defs.RedisSchemaVersion)).Equal(nil)
+			g.Assert(mock.history).Equal([]string{"SCAN", "HGET", "SCAN"})
+		})
+
+		g.It("errors if unable to read the schema version of a record", func() {
+			device := r.genRegistryKey("device-4")
+			scan(devices, device)
+			mock.Command("HGET", device, defs.RedisSchemaVersionField).ExpectError(fmt.Errorf("bad-hget"))
+			g.Assert(r.MigrateRegistry(1).Error()).Equal("bad-hget")
+		})
+	})
+}
@@ -1,14 +1,19 @@
 package device
 
+import "io"
 import "fmt"
-import "bytes"
+import "net"
+import "time"
 import "strconv"
+import "strings"
+import "sync/atomic"
+import "encoding/json"
 import "github.com/satori/go.uuid"
 import "github.com/garyburd/redigo/redis"
-import "github.com/golang/protobuf/proto"
 
 import "github.com/dadleyy/beacon.api/beacon/defs"
 import "github.com/dadleyy/beacon.api/beacon/logging"
+import "github.com/dadleyy/beacon.api/beacon/security"
 import "github.com/dadleyy/beacon.api/beacon/interchange"
 
 // RedisRegistry implements the `Registry` interface w/ a redis backend
@@ -16,130 +21,233 @@ type RedisRegistry struct {
 	*logging.Logger
 	*redis.Pool
 	TokenGenerator
+	AllocationTTL time.Duration
+	Events        EventDispatcher
+	Retries       int
+	RetryBackoff  time.Duration
+	MaxTokens     int
+
+	// UniqueTokenNames, when set, rejects tokens named the same as one of the existing tokens of their device.
+	UniqueTokenNames bool
+
+	// MaxCommandHistory is the amount of control commands kept in the command history of each device, falling back to
+	// the default when not positive.
+	MaxCommandHistory int
+
+	// NameIndex, when set, keeps a hash of the lowercased names of registered devices to their ids so that checking
+	// whether a name is taken does not need to search every registration; off by default, in which case they are searched.
+	NameIndex bool
+
+	// LockTTL, when positive, locks a device for at most this long while it is renamed, removed or has its metadata
+	// set, failing concurrent mutations of the same device; devices are not locked by default.
+	LockTTL time.Duration
+
+	// LockWait is how long a mutation retries taking the lock of a device held by another mutation before failing w/
+	// the device locked error; mutations fail as soon as the lock is found to be held when not positive.
+	LockWait time.Duration
+
+	// ClusterMode, when set, wraps the id of every key in a hash tag (e.g `beacon:device-registry:{<id>}`) so that the
+	// keys of a single device are assigned to the same redis cluster slot; off by default so existing keys are left as-is.
+	ClusterMode bool
+
+	// Namespace is prepended to every key the registry reads or writes, allowing several deployments to share a single
+	// redis server; empty by default so existing keys are left as-is.
+	Namespace string
+
+	// FeedbackBackend is how device feedback is stored; the default list backend keeps a capped list per device while
+	// the stream backend appends to a capped redis stream per device, whose entry ids are stable pagination cursors.
+	FeedbackBackend string
+
+	closed int32
+}
+
+// Close closes the registry's connection pool, after which every command sent through the registry fails w/ a
+// registry closed error. Closing a registry more than once has no effect.
+func (registry *RedisRegistry) Close() error {
+	if atomic.CompareAndSwapInt32(&registry.closed, 0, 1) != true {
+		return nil
+	}
+
+	registry.Infof("closing registry connection pool")
+	return registry.Pool.Close()
 }
 
-// FindDevice searches the registry based on a query string for the first matching device id
+// FindDevice searches the registry based on a query string for the first matching device id, falling back to a scan
+// of every device's name when no device is registered under the query as an id. When several devices match the name
+// the first is returned and a warning is logged so that the duplicates can be cleaned up.
 func (registry *RedisRegistry) FindDevice(query string) (RegistrationDetails, error) {
-	registryKey := registry.genRegistryKey(query)
+	if details, e := registry.FindDeviceByID(query); e == nil || e != defs.Error(defs.ErrNotFound) {
+		return details, e
+	}
 
-	exists, e := registry.exists(registryKey)
+	matches, e := registry.FindDevices(query)
 
 	if e != nil {
 		return RegistrationDetails{}, e
 	}
 
-	if exists {
-		return registry.loadDetails(registryKey)
+	if len(matches) == 0 {
+		registry.Warnf("did not find matching device: %s", query)
+		return RegistrationDetails{}, defs.Error(defs.ErrNotFound)
 	}
 
-	response, e := registry.Do("KEYS", fmt.Sprintf("%s*", defs.RedisDeviceRegistryKey))
+	if len(matches) > 1 {
+		registry.Warnf("found %d devices matching %s, using device[%s]", len(matches), query, matches[0].DeviceID)
+	}
+
+	return matches[0], nil
+}
+
+// FindDevices scans every registered device, returning each device whose id or name matches the query. An empty list
+// is returned when nothing matches.
+func (registry *RedisRegistry) FindDevices(query string) ([]RegistrationDetails, error) {
+	response, e := registry.Do("KEYS", registry.namespaced(fmt.Sprintf("%s*", defs.RedisDeviceRegistryKey)))
 
 	if e != nil {
-		return RegistrationDetails{}, e
+		return nil, e
 	}
 
 	registryKeys, e := redis.Strings(response, e)
 
 	if e != nil {
-		return RegistrationDetails{}, e
+		return nil, e
 	}
 
+	matches := make([]RegistrationDetails, 0)
+
 	for _, k := range registryKeys {
 		fields, e := registry.hmgetstr(k, defs.RedisDeviceNameField, defs.RedisDeviceIDField, defs.RedisDeviceSecretField)
 
 		if e != nil {
-			return RegistrationDetails{}, e
+			return nil, e
 		}
 
 		if fields[0] == query || fields[1] == query {
-			d := RegistrationDetails{SharedSecret: fields[2], DeviceID: fields[1], Name: fields[0]}
-			return d, nil
+			matches = append(matches, RegistrationDetails{SharedSecret: fields[2], DeviceID: fields[1], Name: fields[0]})
 		}
 	}
 
-	registry.Warnf("did not find matching device: %s", query)
-	return RegistrationDetails{}, fmt.Errorf(defs.ErrNotFound)
+	return matches, nil
 }
 
-// ListFeedback retrieves the latest feedback for a given device id.
-func (registry *RedisRegistry) ListFeedback(id string, count int) ([]interchange.FeedbackMessage, error) {
-	details, e := registry.FindDevice(id)
+// DeviceExists returns whether or not a device is registered w/ the query as either its id or name.
+func (registry *RedisRegistry) DeviceExists(query string) (bool, error) {
+	_, e := registry.FindDevice(query)
 
-	if e != nil {
-		return nil, e
+	if e == defs.Error(defs.ErrNotFound) {
+		return false, nil
 	}
 
-	feedbackKey := registry.genFeedbackKey(details.DeviceID)
+	return e == nil, e
+}
+
+// FindDeviceByID loads the device registered under the given id, w/o attempting to match the id against device names.
+func (registry *RedisRegistry) FindDeviceByID(id string) (RegistrationDetails, error) {
+	registryKey := registry.genRegistryKey(id)
 
-	list, e := registry.lrangestr(feedbackKey, 0, count)
+	exists, e := registry.exists(registryKey)
 
 	if e != nil {
-		return nil, e
+		return RegistrationDetails{}, e
 	}
 
-	if filled := len(list) >= 1; filled == false {
-		return nil, nil
+	if exists != true {
+		return RegistrationDetails{}, defs.Error(defs.ErrNotFound)
 	}
 
-	results := make([]interchange.FeedbackMessage, 0, len(list))
+	return registry.loadDetails(registryKey)
+}
+
+// recordFirmware stores the firmware version reported by a device on its registry hash; feedback sent w/o a version
+// leaves the previously reported version in place.
+func (registry *RedisRegistry) recordFirmware(deviceID, version string) error {
+	if version == "" {
+		return nil
+	}
 
-	for _, entry := range list {
-		message := interchange.FeedbackMessage{}
+	return registry.hset(registry.genRegistryKey(deviceID), defs.RedisDeviceFirmwareField, version)
+}
 
-		if e := proto.UnmarshalText(entry, &message); e != nil {
-			registry.Warnf("invalid feedback item device[%d]: %s", feedbackKey, e.Error())
-			return nil, fmt.Errorf(defs.ErrBadInterchangeData)
-		}
+// GetDeviceFirmware returns the firmware version the device last reported, defaulting to the unknown version for
+// devices that have never reported one.
+func (registry *RedisRegistry) GetDeviceFirmware(deviceID string) (string, error) {
+	version, e := registry.hgetstr(registry.genRegistryKey(deviceID), defs.RedisDeviceFirmwareField)
 
-		results = append(results, message)
+	if e == redis.ErrNil || (e == nil && version == "") {
+		return defs.DefaultFirmwareVersion, nil
 	}
 
-	registry.Debugf("found %d entries for device key: %s (returning %d)", len(list), feedbackKey, len(results))
-	return results, nil
+	return version, e
 }
 
-// LogFeedback inserts a feedback item into the redis store.
-func (registry *RedisRegistry) LogFeedback(message interchange.FeedbackMessage) error {
-	auth := message.GetAuthentication()
+// ListDevicesByFirmware returns the details of each registered device whose reported firmware version exactly matches
+// the version; devices that have never reported a version are matched by the unknown version.
+func (registry *RedisRegistry) ListDevicesByFirmware(version string) ([]RegistrationDetails, error) {
+	ids, e := registry.lrangestr(registry.genDeviceIndexKey(), 0, -1)
 
-	if auth == nil {
-		return fmt.Errorf(defs.ErrBadInterchangeAuthentication)
+	if e != nil {
+		return nil, e
 	}
 
-	details, e := registry.FindDevice(auth.DeviceID)
+	versions, e := registry.firmwareBatch(ids)
 
 	if e != nil {
-		return e
+		return nil, e
+	}
+
+	keys := make([]string, 0, len(ids))
+
+	for i, id := range ids {
+		if versions[i] == version {
+			keys = append(keys, registry.genRegistryKey(id))
+		}
 	}
 
-	feedbackKey, textBuffer := registry.genFeedbackKey(details.DeviceID), bytes.NewBuffer([]byte{})
+	return registry.loadDetailsBatch(keys)
+}
+
+// firmwareBatch pipelines the reads of the firmware version reported by each of the devices over a single connection,
+// returning the versions in the order of the ids.
+func (registry *RedisRegistry) firmwareBatch(ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
 
-	count, e := registry.llen(feedbackKey)
+	conn, e := registry.connection()
 
 	if e != nil {
-		return e
+		return nil, e
 	}
 
-	if count >= defs.RedisMaxFeedbackEntries {
-		registry.Warnf("feedback stack[%s] exceeds max[%d] entries, trimming", feedbackKey, defs.RedisMaxFeedbackEntries)
+	defer conn.Close()
 
-		if _, e := registry.Do("LTRIM", feedbackKey, 0, defs.RedisMaxFeedbackEntries-2); e != nil {
-			registry.Errorf("unable to trim device feedback stack: %s", e.Error())
-			return e
+	for _, id := range ids {
+		if e := conn.Send("HGET", registry.genRegistryKey(id), defs.RedisDeviceFirmwareField); e != nil {
+			return nil, e
 		}
 	}
 
-	if e := proto.MarshalText(textBuffer, &message); e != nil {
-		return e
+	if e := conn.Flush(); e != nil {
+		return nil, e
 	}
 
-	if _, e := registry.Do("LPUSH", feedbackKey, textBuffer.String()); e != nil {
-		return e
-	}
+	versions := make([]string, 0, len(ids))
 
-	registry.Debugf("logging state for device: %s", feedbackKey)
+	for range ids {
+		version, e := redis.String(conn.Receive())
 
-	return nil
+		if e != nil && e != redis.ErrNil {
+			return nil, e
+		}
+
+		if version == "" {
+			version = defs.DefaultFirmwareVersion
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, nil
 }
 
 // AllocateRegistration reserves a spot in the registry to be filled later
@@ -147,27 +255,97 @@ func (registry *RedisRegistry) AllocateRegistration(details RegistrationRequest)
 	allocationID := uuid.NewV4().String()
 	registryKey := registry.genAllocationKey(allocationID)
 
-	if len(details.Name) < 4 || len(details.SharedSecret) < defs.SecurityMinimumDeviceSharedSecretSize {
-		return fmt.Errorf(defs.ErrInvalidRegistrationRequest)
+	if len(details.Name) < defs.SecurityDeviceNameMinLength {
+		return defs.Error(defs.ErrInvalidRegistrationRequest)
+	}
+
+	if len(details.SharedSecret) < defs.SecurityMinimumDeviceSharedSecretSize {
+		return defs.Error(defs.ErrInvalidRegistrationRequest)
 	}
 
-	nameField, secretField := defs.RedisRegistrationNameField, defs.RedisRegistrationSecretField
+	f := struct {
+		name    string
+		secret  string
+		created string
+	}{defs.RedisRegistrationNameField, defs.RedisRegistrationSecretField, defs.RedisRegistrationCreatedField}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	if e := registry.hmset(registryKey, f.name, details.Name, f.secret, details.SharedSecret, f.created, now); e != nil {
+		return e
+	}
 
-	return registry.hmset(registryKey, nameField, details.Name, secretField, details.SharedSecret)
+	// Pending registrations that are never filled should not linger (along w/ their secret) forever.
+	return registry.expire(registryKey, registry.allocationTTL())
 }
 
-// FillRegistration searches the pending registrations and adds the new uuid to the index
-func (registry *RedisRegistry) FillRegistration(secret, uuid string) error {
-	response, e := registry.Do("KEYS", fmt.Sprintf("%s*", defs.RedisRegistrationRequestListKey))
+// ListPendingRegistrations returns the registration requests that have not yet been filled by a device, along w/ how
+// long ago they were requested. The shared secrets of the requests are never included.
+func (registry *RedisRegistry) ListPendingRegistrations() ([]RegistrationRequest, error) {
+	keys := make([]string, 0)
+
+	e := registry.scan(registry.genKeyPrefix(defs.RedisRegistrationRequestListKey), func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
 
 	if e != nil {
-		return e
+		return nil, e
+	}
+
+	results, now := make([]RegistrationRequest, 0, len(keys)), time.Now().Unix()
+	filledField, createdField := defs.RedisRegistrationDeviceIDField, defs.RedisRegistrationCreatedField
+
+	for _, key := range keys {
+		values, e := redis.Strings(registry.Do("HMGET", key, filledField, createdField))
+
+		if e != nil {
+			return nil, e
+		}
+
+		if len(values) != 2 {
+			return nil, defs.Error(defs.ErrBadRedisResponse)
+		}
+
+		// Requests reissued for an already registered device are not waiting on a new device.
+		if values[0] != "" {
+			continue
+		}
+
+		request, e := registry.loadRequest(key)
+
+		// The request may have expired since the scan.
+		if e != nil {
+			registry.Warnf("unable to load registration request[%s]: %s", key, e.Error())
+			continue
+		}
+
+		request.SharedSecret = ""
+
+		if created, e := strconv.ParseInt(values[1], 10, 64); e == nil && created <= now {
+			request.Age = now - created
+		}
+
+		results = append(results, request)
+	}
+
+	return results, nil
+}
+
+// FillRegistration searches the pending registrations and adds the new uuid to the index, returning the id of the
+// registered device. Registrations that have already been filled return the id of the device they were filled w/
+// rather than registering the device a second time.
+func (registry *RedisRegistry) FillRegistration(secret, uuid string) (string, error) {
+	response, e := registry.Do("KEYS", registry.namespaced(fmt.Sprintf("%s*", defs.RedisRegistrationRequestListKey)))
+
+	if e != nil {
+		return "", e
 	}
 
 	requestKeys, e := redis.Strings(response, e)
 
 	if e != nil {
-		return fmt.Errorf(defs.ErrBadRedisResponse)
+		return "", defs.Error(defs.ErrBadRedisResponse)
 	}
 
 	for _, k := range requestKeys {
@@ -179,242 +357,1198 @@ func (registry *RedisRegistry) FillRegistration(secret, uuid string) error {
 
 		s, e := redis.String(response, e)
 
-		if e != nil {
+		if e != nil || s != secret {
+			continue
+		}
+
+		registry.Debugf("found matching secret for device[%s], filling", uuid)
+		deviceID, name, e := registry.fill(k, secret, uuid)
+
+		// The request may have been filled by a concurrent registration w/ the same secret since it was found.
+		if e == redis.ErrNil {
 			continue
 		}
 
-		if s == secret {
-			registry.Debugf("found matching secret for device[%s], filling", uuid)
-			return registry.fill(k, uuid)
+		if e != nil {
+			return "", e
 		}
+
+		return registry.completeRegistration(deviceID, name, secret)
 	}
 
-	return fmt.Errorf(defs.ErrNotFound)
+	return registry.refillRegistration(secret)
 }
 
-// ListTokens searches the token store for the token details given the token key.
-func (registry *RedisRegistry) ListTokens(query string) ([]TokenDetails, error) {
-	deviceInfo, e := registry.FindDevice(query)
+// refillRegistration searches the filled registrations for one filled w/ the secret, returning the id of the device
+// it was filled w/. Devices that have been removed since are registered again under the same id.
+func (registry *RedisRegistry) refillRegistration(secret string) (string, error) {
+	keys := make([]string, 0)
+
+	e := registry.scan(registry.genKeyPrefix(defs.RedisFilledRegistrationKey), func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
 
 	if e != nil {
-		return nil, e
+		return "", e
+	}
+
+	f := struct {
+		secret string
+		name   string
+		id     string
+	}{defs.RedisRegistrationSecretField, defs.RedisRegistrationNameField, defs.RedisRegistrationDeviceIDField}
+
+	for _, key := range keys {
+		values, e := registry.hmgetstr(key, f.secret, f.name, f.id)
+
+		if e != nil || values[0] != secret {
+			continue
+		}
+
+		registry.Infof("registration already filled by device[%s]", values[2])
+		return registry.completeRegistration(values[2], values[1], secret)
 	}
 
-	listKey := registry.genTokenListKey(deviceInfo.DeviceID)
+	return "", defs.Error(defs.ErrNotFound)
+}
 
-	tokenEntries, e := registry.lrangestr(listKey, 0, -1)
+// completeRegistration registers the device a registration was filled w/ unless it is already registered, which is
+// the case for retried and reissued registrations.
+func (registry *RedisRegistry) completeRegistration(deviceID, name, secret string) (string, error) {
+	exists, e := registry.exists(registry.genRegistryKey(deviceID))
 
 	if e != nil {
-		return nil, e
+		return "", e
+	}
+
+	if exists {
+		registry.touch(deviceID)
+		return deviceID, nil
 	}
 
-	results := make([]TokenDetails, 0, len(tokenEntries))
+	registry.Infof("filling device registry w/ name[%s] id[%s]", name, deviceID)
 
-	fields := struct {
-		id         string
-		name       string
-		device     string
-		permission string
-	}{
-		defs.RedisDeviceTokenIDField,
-		defs.RedisDeviceTokenNameField,
-		defs.RedisDeviceTokenDeviceIDField,
-		defs.RedisDeviceTokenPermissionField,
+	if e := registry.register(deviceID, name, secret); e != nil {
+		return "", e
+	}
+
+	registry.touch(deviceID)
+	registry.dispatch(defs.WebhookDeviceRegisteredEvent, deviceID, nil)
+	return deviceID, nil
+}
+
+// touch updates the last seen time of a device, logging rather than returning any error.
+func (registry *RedisRegistry) touch(deviceID string) {
+	if e := registry.TouchDevice(deviceID); e != nil {
+		registry.Warnf("unable to update last seen time of device[%s]: %s", deviceID, e.Error())
 	}
+}
 
-	for _, tokenValue := range tokenEntries {
-		registryKey := registry.genTokenRegistrationKey(tokenValue)
-		details, e := registry.hmgetstr(registryKey, fields.id, fields.name, fields.device, fields.permission)
+// scan iterates every key starting w/ the prefix, invoking the callback w/ each until it returns false.
+func (registry *RedisRegistry) scan(prefix string, fn func(string) bool) error {
+	cursor := "0"
+
+	for {
+		response, e := redis.Values(registry.Do("SCAN", cursor, "MATCH", prefix+"*", "COUNT", defs.RedisTokenScanCount))
 
 		if e != nil {
-			continue
+			return e
+		}
+
+		if len(response) != 2 {
+			return defs.Error(defs.ErrBadRedisResponse)
 		}
 
-		permission, e := strconv.ParseUint(details[3], 2, 32)
+		keys, e := redis.Strings(response[1], nil)
 
 		if e != nil {
-			continue
+			return defs.Error(defs.ErrBadRedisResponse)
 		}
 
-		results = append(results, TokenDetails{
-			TokenID:    details[0],
-			Name:       details[1],
-			DeviceID:   details[2],
-			Permission: uint(permission),
-		})
+		for _, key := range keys {
+			if fn(key) != true {
+				return nil
+			}
+		}
+
+		if cursor, e = redis.String(response[0], nil); e != nil {
+			return defs.Error(defs.ErrBadRedisResponse)
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// ListRegistrations prints out a list of all the registered devices
+func (registry *RedisRegistry) ListRegistrations() ([]RegistrationDetails, error) {
+	var results []RegistrationDetails
+
+	e := registry.WalkRegistrations(func(details RegistrationDetails) error {
+		results = append(results, details)
+		return nil
+	})
+
+	if e != nil {
+		return nil, e
 	}
 
 	return results, nil
 }
 
-// FindToken searches the token store for the token details given the token key.
-func (registry *RedisRegistry) FindToken(token string) (TokenDetails, error) {
-	// Start w/ an attempt to look up by key directly>
-	registryKey := registry.genTokenRegistrationKey(token)
+// WalkRegistrations pages through the device index, invoking the callback w/ the details of each registered device
+// so that the whole fleet is never held in memory at once. Iteration stops at the first error returned by the
+// callback, which is then returned to the caller.
+func (registry *RedisRegistry) WalkRegistrations(fn func(RegistrationDetails) error) error {
+	indexKey := registry.genDeviceIndexKey()
 
-	permissionMask, e := registry.hgetstr(registryKey, defs.RedisDeviceTokenPermissionField)
+	for start := 0; ; start += defs.RedisRegistrationPageSize {
+		ids, e := registry.lrangestr(indexKey, start, start+defs.RedisRegistrationPageSize-1)
 
-	if e != nil {
-		registry.Errorf("unable to find token by registry key %s (token: %s)", registryKey, token)
-		return TokenDetails{}, e
+		if e != nil {
+			return e
+		}
+
+		keys := make([]string, 0, len(ids))
+
+		for _, k := range ids {
+			keys = append(keys, registry.genRegistryKey(k))
+		}
+
+		details, e := registry.loadDetailsBatch(keys)
+
+		if e != nil {
+			return e
+		}
+
+		for _, d := range details {
+			if e := fn(d); e != nil {
+				return e
+			}
+		}
+
+		if len(ids) < defs.RedisRegistrationPageSize {
+			return nil
+		}
 	}
+}
 
-	permission, e := strconv.ParseUint(permissionMask, 2, 32)
+// ExportRegistry serializes every registered device, along w/ each of its tokens, into a versioned json document.
+func (registry *RedisRegistry) ExportRegistry() ([]byte, error) {
+	registrations, e := registry.ListRegistrations()
 
 	if e != nil {
-		registry.Errorf("invalid token permission mask %s (token: %s)", registryKey, token)
-		return TokenDetails{}, e
+		return nil, e
 	}
 
-	fields := struct {
-		id     string
-		name   string
-		device string
-	}{defs.RedisDeviceTokenIDField, defs.RedisDeviceTokenNameField, defs.RedisDeviceTokenDeviceIDField}
+	export := RegistryExport{
+		Version: defs.RegistryExportVersion,
+		Devices: make([]ExportedDevice, 0, len(registrations)),
+	}
 
-	r, e := registry.hmgetstr(registryKey, fields.id, fields.name, fields.device)
+	for _, details := range registrations {
+		tokens, e := registry.exportTokens(details.DeviceID)
 
-	if e != nil {
-		registry.Errorf("unable to find token details by registry key %s (token: %s)", registryKey, token)
-		return TokenDetails{}, e
+		if e != nil {
+			return nil, e
+		}
+
+		export.Devices = append(export.Devices, ExportedDevice{
+			DeviceID:     details.DeviceID,
+			Name:         details.Name,
+			SharedSecret: details.SharedSecret,
+			Tokens:       tokens,
+		})
+	}
+
+	return json.Marshal(export)
+}
+
+// ImportRegistry recreates the index, registry and token entries of each device in a registry export. Every device is
+// validated before anything is written, and devices that already exist are skipped unless overwrite is true.
+func (registry *RedisRegistry) ImportRegistry(data []byte, overwrite bool) error {
+	export := RegistryExport{}
+
+	if e := json.Unmarshal(data, &export); e != nil {
+		return defs.Error(defs.ErrInvalidRegistryExport)
+	}
+
+	if export.Version != defs.RegistryExportVersion {
+		return defs.Error(defs.ErrUnsupportedRegistryExport)
+	}
+
+	for _, exported := range export.Devices {
+		if exported.DeviceID == "" || exported.Name == "" {
+			return defs.Error(defs.ErrInvalidRegistryExport)
+		}
+
+		if _, e := security.ParseDeviceKey(exported.SharedSecret); e != nil {
+			registry.Warnf("invalid shared secret for exported device[%s]: %s", exported.DeviceID, e.Error())
+			return defs.Error(defs.ErrInvalidDeviceSharedSecret)
+		}
+	}
+
+	// The export lists devices in index order; pushing them in reverse keeps that order once imported.
+	for i := len(export.Devices) - 1; i >= 0; i-- {
+		if e := registry.importDevice(export.Devices[i], overwrite); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// RemoveDevice removes the registration of a device (e.g once it has disconnected), keeping the resume tokens it was
+// issued so that it is able to resume its id when it reconnects. The feedback history of the device (including any
+// failures recorded while it was disconnecting) is kept until the resume tokens would have expired.
+func (registry *RedisRegistry) RemoveDevice(id string) error {
+	return registry.withDeviceLock(id, func() error {
+		if e := registry.unregisterDevice(id); e != nil {
+			return e
+		}
+
+		return registry.expire(registry.genFeedbackKey(id), defs.DefaultResumeTokenTTL)
+	})
+}
+
+// removeDevice removes the registration of a device along w/ its resume tokens and feedback history, preventing it
+// from being restored.
+func (registry *RedisRegistry) removeDevice(id string) error {
+	if e := registry.unregisterDevice(id); e != nil {
+		return e
 	}
 
-	details := TokenDetails{
-		Permission: uint(permission),
-		TokenID:    r[0],
-		Name:       r[1],
-		DeviceID:   r[2],
+	if e := registry.del(registry.genFeedbackKey(id)); e != nil {
+		return e
 	}
 
-	return details, nil
+	return registry.revokeResumeTokens(id)
 }
 
-// AuthorizeToken approves the token + permission for the given device id
-func (registry *RedisRegistry) AuthorizeToken(deviceID, token string, permission uint) bool {
-	registration, e := registry.FindDevice(deviceID)
+func (registry *RedisRegistry) unregisterDevice(id string) error {
+	regKey := registry.genRegistryKey(id)
+
+	if e := registry.unindexName(id); e != nil {
+		return e
+	}
+
+	if e := registry.del(regKey); e != nil {
+		return e
+	}
+
+	if _, e := registry.Do("LREM", registry.genDeviceIndexKey(), 1, id); e != nil {
+		return e
+	}
+
+	tokensListKey := registry.genTokenListKey(id)
+
+	tokens, e := registry.lrangestr(tokensListKey, 0, -1)
 
 	if e != nil {
-		return false
+		return e
 	}
 
-	if token == registration.SharedSecret {
-		return true
+	for _, t := range tokens {
+		registry.del(registry.genTokenRegistrationKey(t))
+	}
+
+	// The state and metadata of the device are auxiliary; failing to remove them does not fail the removal.
+	registry.del(registry.genStateKey(id))
+	registry.del(registry.genMetaKey(id))
+	registry.del(registry.genCommandHistoryKey(id))
+
+	// The connection events of a device are what operators look at when it is flapping; they are kept for as long as the
+	// device is able to resume its id rather than deleted along w/ its registration.
+	registry.expire(registry.genConnEventsKey(id), defs.DefaultResumeTokenTTL)
+
+	if e := registry.del(tokensListKey); e != nil {
+		return e
+	}
+
+	return registry.removeTags(id)
+}
+
+// RemoveDevices removes each of the devices along w/ their resume tokens, returning the error of every device that
+// could not be removed keyed by its id; devices that are not registered are reported w/ the not found error rather than
+// failing the batch. Each removal is recorded in the audit log. The returned error is only set when the (pipelined)
+// existence checks fail, in which case no device is removed.
+func (registry *RedisRegistry) RemoveDevices(ids []string) (map[string]error, error) {
+	failures, keys := make(map[string]error), make([]string, 0, len(ids))
+
+	for _, id := range ids {
+		keys = append(keys, registry.genRegistryKey(id))
 	}
 
-	requester, e := registry.FindToken(token)
+	found, e := registry.existsBatch(keys)
 
 	if e != nil {
-		registry.Errorf("unable to find token: %s", e.Error())
-		return false
+		return nil, e
+	}
+
+	for i, id := range ids {
+		if found[i] != true {
+			failures[id] = defs.Error(defs.ErrNotFound)
+			continue
+		}
+
+		e := registry.withDeviceLock(id, func() error {
+			return registry.removeDevice(id)
+		})
+
+		if e != nil {
+			registry.Warnf("unable to remove device[%s] from batch: %s", id, e.Error())
+			failures[id] = e
+			continue
+		}
+
+		if e := registry.RecordAudit(AuditEntry{Action: defs.AuditDeviceRemovedAction, DeviceID: id}); e != nil {
+			registry.Warnf("unable to record removal of device[%s] in audit log: %s", id, e.Error())
+		}
+	}
+
+	return failures, nil
+}
+
+// TouchDevice records the current time as the last time the device was seen, clearing any idle flag it may have had.
+func (registry *RedisRegistry) TouchDevice(id string) error {
+	registryKey, now := registry.genRegistryKey(id), strconv.FormatInt(time.Now().Unix(), 10)
+
+	if e := registry.hset(registryKey, defs.RedisDeviceLastSeenField, now); e != nil {
+		return e
+	}
+
+	_, e := registry.Do("HDEL", registryKey, defs.RedisDeviceIdleField)
+	return e
+}
+
+// LastSeen returns the last time the device was seen, or the zero time if the device has never been seen.
+func (registry *RedisRegistry) LastSeen(id string) (time.Time, error) {
+	response, e := registry.Do("HGET", registry.genRegistryKey(id), defs.RedisDeviceLastSeenField)
+
+	if e != nil {
+		return time.Time{}, e
+	}
+
+	if response == nil {
+		return time.Time{}, nil
+	}
+
+	seconds, e := redis.Int64(response, e)
+
+	if e != nil {
+		return time.Time{}, defs.Error(defs.ErrBadRedisResponse)
+	}
+
+	return time.Unix(seconds, 0), nil
+}
+
+// FlagIdleDevice marks the device as idle, dispatching an idle event the first time the device is flagged.
+func (registry *RedisRegistry) FlagIdleDevice(id string) error {
+	response, e := registry.Do("HSETNX", registry.genRegistryKey(id), defs.RedisDeviceIdleField, "true")
+
+	if e != nil {
+		return e
+	}
+
+	if flagged, e := redis.Int(response, e); e != nil || flagged != 1 {
+		return e
+	}
+
+	registry.dispatch(defs.WebhookDeviceIdleEvent, id, nil)
+	return nil
+}
+
+// TrackCommand records a control command sent to the device as pending; the status expires after a day.
+func (registry *RedisRegistry) TrackCommand(commandID, deviceID string) error {
+	commandKey, now := registry.genCommandKey(commandID), strconv.FormatInt(time.Now().Unix(), 10)
+
+	e := registry.hmset(
+		commandKey,
+		defs.RedisCommandDeviceIDField, deviceID,
+		defs.RedisCommandStatusField, defs.CommandStatusPending,
+		defs.RedisCommandUpdatedField, now,
+	)
+
+	if e != nil {
+		return e
+	}
+
+	return registry.expire(commandKey, defs.DefaultCommandStatusTTL)
+}
+
+// UpdateCommandStatus sets the status of a tracked command, provided it was sent to the given device.
+func (registry *RedisRegistry) UpdateCommandStatus(commandID, deviceID, status string) error {
+	acked, failed, superseded := defs.CommandStatusAcknowledged, defs.CommandStatusFailed, defs.CommandStatusSuperseded
+
+	if status != acked && status != failed && status != superseded {
+		return defs.Error(defs.ErrInvalidCommandStatus)
+	}
+
+	commandKey := registry.genCommandKey(commandID)
+
+	owner, e := registry.hgetstr(commandKey, defs.RedisCommandDeviceIDField)
+
+	if e == redis.ErrNil {
+		return defs.Error(defs.ErrNotFound)
+	}
+
+	if e != nil {
+		return e
+	}
+
+	if owner != deviceID {
+		return defs.Error(defs.ErrNotFound)
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	return registry.hmset(commandKey, defs.RedisCommandStatusField, status, defs.RedisCommandUpdatedField, now)
+}
+
+// GetCommandStatus returns the status of a tracked command.
+func (registry *RedisRegistry) GetCommandStatus(commandID string) (CommandStatus, error) {
+	commandKey := registry.genCommandKey(commandID)
+
+	exists, e := registry.exists(commandKey)
+
+	if e != nil {
+		return CommandStatus{}, e
+	}
+
+	if exists != true {
+		return CommandStatus{}, defs.Error(defs.ErrNotFound)
+	}
+
+	f := struct {
+		deviceID string
+		status   string
+		updated  string
+	}{defs.RedisCommandDeviceIDField, defs.RedisCommandStatusField, defs.RedisCommandUpdatedField}
+
+	values, e := registry.hmgetstr(commandKey, f.deviceID, f.status, f.updated)
+
+	if e != nil {
+		return CommandStatus{}, e
+	}
+
+	updated, e := strconv.ParseInt(values[2], 10, 64)
+
+	if e != nil {
+		return CommandStatus{}, defs.Error(defs.ErrBadRedisResponse)
+	}
+
+	return CommandStatus{
+		CommandID: commandID,
+		DeviceID:  values[0],
+		Status:    values[1],
+		UpdatedAt: time.Unix(updated, 0),
+	}, nil
+}
+
+// SetDeviceMeta writes the metadata fields onto the metadata hash of the device, overwriting the value of any field
+// that has already been set. Fields that are not included are left as-is.
+func (registry *RedisRegistry) SetDeviceMeta(deviceID string, meta map[string]string) error {
+	return registry.withDeviceLock(deviceID, func() error {
+		return registry.setDeviceMeta(deviceID, meta)
+	})
+}
+
+func (registry *RedisRegistry) setDeviceMeta(deviceID string, meta map[string]string) error {
+	pairs := make([]string, 0, len(meta)*2)
+
+	for key, value := range meta {
+		if len(key) == 0 || len(key) > defs.SecurityDeviceMetaKeyMaxLength {
+			return defs.Error(defs.ErrInvalidDeviceMeta)
+		}
+
+		if len(value) > defs.SecurityDeviceMetaValueMaxLength {
+			return defs.Error(defs.ErrInvalidDeviceMeta)
+		}
+
+		pairs = append(pairs, key, value)
+	}
+
+	if len(pairs) == 0 {
+		return defs.Error(defs.ErrInvalidDeviceMeta)
+	}
+
+	exists, e := registry.exists(registry.genRegistryKey(deviceID))
+
+	if e != nil {
+		return e
+	}
+
+	if exists != true {
+		return defs.Error(defs.ErrNotFound)
+	}
+
+	return registry.hmset(registry.genMetaKey(deviceID), pairs...)
+}
+
+// RenameDevice updates the name the device is registered under; uniqueness of the name is left to the caller.
+func (registry *RedisRegistry) RenameDevice(deviceID, name string) error {
+	return registry.withDeviceLock(deviceID, func() error {
+		return registry.renameDevice(deviceID, name)
+	})
+}
+
+func (registry *RedisRegistry) renameDevice(deviceID, name string) error {
+	if len(name) < defs.SecurityDeviceNameMinLength {
+		return defs.Error(defs.ErrInvalidRegistrationRequest)
+	}
+
+	registryKey := registry.genRegistryKey(deviceID)
+	exists, e := registry.exists(registryKey)
+
+	if e != nil {
+		return e
+	}
+
+	if exists != true {
+		return defs.Error(defs.ErrNotFound)
+	}
+
+	if e := registry.unindexName(deviceID); e != nil {
+		return e
+	}
+
+	if e := registry.hset(registryKey, defs.RedisDeviceNameField, name); e != nil {
+		return e
+	}
+
+	return registry.indexName(deviceID, name)
+}
+
+// ReissueRegistration replaces the shared secret (the public key) of a registered device, keeping its id, name and
+// tokens. The registration requests filled by the device are removed so that its previous key can no longer be used
+// to reconnect under its id, and a request filled w/ the device id is allocated for the new key in their place; the
+// device is able to reconnect w/ the new key until the allocation ttl has elapsed.
+func (registry *RedisRegistry) ReissueRegistration(deviceID, secret string) error {
+	if _, e := security.ParseDeviceKey(secret); e != nil {
+		return defs.Error(defs.ErrInvalidDeviceSharedSecret)
+	}
+
+	return registry.withDeviceLock(deviceID, func() error {
+		return registry.reissueRegistration(deviceID, secret)
+	})
+}
+
+func (registry *RedisRegistry) reissueRegistration(deviceID, secret string) error {
+	registryKey := registry.genRegistryKey(deviceID)
+	name, e := registry.hgetstr(registryKey, defs.RedisDeviceNameField)
+
+	if e == redis.ErrNil {
+		return defs.Error(defs.ErrNotFound)
+	}
+
+	if e != nil {
+		return e
+	}
+
+	if e := registry.removeFilledRequests(deviceID); e != nil {
+		return e
+	}
+
+	// Resume tokens were issued to whoever held the previous secret, which must not be able to resume the device.
+	if e := registry.revokeResumeTokens(deviceID); e != nil {
+		return e
+	}
+
+	if e := registry.hset(registryKey, defs.RedisDeviceSecretField, secret); e != nil {
+		return e
+	}
+
+	requestKey := registry.genAllocationKey(uuid.NewV4().String())
+
+	f := struct {
+		name    string
+		secret  string
+		id      string
+		created string
+	}{
+		defs.RedisRegistrationNameField,
+		defs.RedisRegistrationSecretField,
+		defs.RedisRegistrationDeviceIDField,
+		defs.RedisRegistrationCreatedField,
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	if e := registry.hmset(requestKey, f.name, name, f.secret, secret, f.id, deviceID, f.created, now); e != nil {
+		return e
+	}
+
+	if e := registry.expire(requestKey, registry.allocationTTL()); e != nil {
+		return e
+	}
+
+	if e := registry.RecordAudit(AuditEntry{Action: defs.AuditDeviceReissuedAction, DeviceID: deviceID}); e != nil {
+		registry.Warnf("unable to record registration reissue in audit log: %s", e.Error())
+	}
+
+	return nil
+}
+
+// removeFilledRequests deletes every registration request reissued for the device along w/ the registrations it has
+// filled, so that neither can be used to register w/ a previous secret.
+func (registry *RedisRegistry) removeFilledRequests(deviceID string) error {
+	keys := make([]string, 0)
+
+	collect := func(key string) bool {
+		keys = append(keys, key)
+		return true
+	}
+
+	if e := registry.scan(registry.genKeyPrefix(defs.RedisRegistrationRequestListKey), collect); e != nil {
+		return e
+	}
+
+	if e := registry.scan(registry.genKeyPrefix(defs.RedisFilledRegistrationKey), collect); e != nil {
+		return e
+	}
+
+	for _, key := range keys {
+		filledID, e := registry.hgetstr(key, defs.RedisRegistrationDeviceIDField)
+
+		if e != nil && e != redis.ErrNil {
+			return e
+		}
+
+		if filledID != deviceID {
+			continue
+		}
+
+		if e := registry.del(key); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// NameTaken returns whether a registered device has the name (case insensitive when the name index is enabled). W/o
+// the name index the registrations are searched for a device w/ the name.
+func (registry *RedisRegistry) NameTaken(name string) (bool, error) {
+	if registry.NameIndex != true {
+		_, e := registry.FindDevice(name)
+
+		if e == defs.Error(defs.ErrNotFound) {
+			return false, nil
+		}
+
+		return e == nil, e
+	}
+
+	response, e := registry.Do("HEXISTS", registry.genDeviceNamesKey(), strings.ToLower(name))
+	return redis.Bool(response, e)
+}
+
+// NameOwner returns the id of the device registered w/ the name (case insensitive when the name index is enabled), or
+// the not found error when no device has the name.
+func (registry *RedisRegistry) NameOwner(name string) (string, error) {
+	if registry.NameIndex != true {
+		details, e := registry.FindDevice(name)
+		return details.DeviceID, e
+	}
+
+	owner, e := redis.String(registry.Do("HGET", registry.genDeviceNamesKey(), strings.ToLower(name)))
+
+	if e == redis.ErrNil {
+		return "", defs.Error(defs.ErrNotFound)
+	}
+
+	return owner, e
+}
+
+// RebuildNameIndex replaces the name index w/ the names of every registered device, allowing the name index to be
+// enabled on a registry that already has devices. The index is rebuilt into a separate key that is then renamed over
+// it, so that names are not reported as free while the registrations are walked. Does nothing when disabled.
+func (registry *RedisRegistry) RebuildNameIndex() error {
+	if registry.NameIndex != true {
+		return nil
+	}
+
+	namesKey, rebuildKey := registry.genDeviceNamesKey(), registry.genDeviceNamesRebuildKey()
+
+	// A rebuild left behind by a previous attempt would otherwise be renamed over the index w/ stale names.
+	if e := registry.del(rebuildKey); e != nil {
+		return e
+	}
+
+	e := registry.WalkRegistrations(func(details RegistrationDetails) error {
+		_, e := registry.Do("HSET", rebuildKey, strings.ToLower(details.Name), details.DeviceID)
+		return e
+	})
+
+	if e != nil {
+		return e
+	}
+
+	rebuilt, e := registry.exists(rebuildKey)
+
+	if e != nil {
+		return e
+	}
+
+	// Nothing is written to the rebuild key when there are no registered devices.
+	if rebuilt != true {
+		return registry.del(namesKey)
+	}
+
+	_, e = registry.Do("RENAME", rebuildKey, namesKey)
+	return e
+}
+
+// GetDeviceMeta returns the metadata of the device; devices w/o any metadata return an empty set of fields.
+func (registry *RedisRegistry) GetDeviceMeta(deviceID string) (map[string]string, error) {
+	meta, e := redis.StringMap(registry.Do("HGETALL", registry.genMetaKey(deviceID)))
+
+	if e != nil {
+		return nil, e
+	}
+
+	return meta, nil
+}
+
+// SetDeviceState records the frame as the last known state of the device, overwriting any previous state.
+func (registry *RedisRegistry) SetDeviceState(deviceID string, frame interchange.ControlFrame) error {
+	return registry.hmset(
+		registry.genStateKey(deviceID),
+		defs.RedisDeviceStateRedField, strconv.FormatUint(uint64(frame.Red), 10),
+		defs.RedisDeviceStateGreenField, strconv.FormatUint(uint64(frame.Green), 10),
+		defs.RedisDeviceStateBlueField, strconv.FormatUint(uint64(frame.Blue), 10),
+		defs.RedisDeviceStateUpdatedField, strconv.FormatInt(time.Now().Unix(), 10),
+	)
+}
+
+// GetDeviceState returns the last known state of the device, or a not found error if no state has been recorded.
+func (registry *RedisRegistry) GetDeviceState(deviceID string) (DeviceState, error) {
+	stateKey := registry.genStateKey(deviceID)
+
+	exists, e := registry.exists(stateKey)
+
+	if e != nil {
+		return DeviceState{}, e
+	}
+
+	if exists != true {
+		return DeviceState{}, defs.Error(defs.ErrNotFound)
+	}
+
+	fields, e := registry.hmgetstr(
+		stateKey,
+		defs.RedisDeviceStateRedField,
+		defs.RedisDeviceStateGreenField,
+		defs.RedisDeviceStateBlueField,
+		defs.RedisDeviceStateUpdatedField,
+	)
+
+	if e != nil {
+		return DeviceState{}, e
+	}
+
+	values := make([]uint32, 3)
+
+	for i, field := range fields[:3] {
+		value, e := strconv.ParseUint(field, 10, 32)
+
+		if e != nil {
+			return DeviceState{}, defs.Error(defs.ErrBadRedisResponse)
+		}
+
+		values[i] = uint32(value)
+	}
+
+	updated, e := strconv.ParseInt(fields[3], 10, 64)
+
+	if e != nil {
+		return DeviceState{}, defs.Error(defs.ErrBadRedisResponse)
+	}
+
+	return DeviceState{
+		DeviceID:  deviceID,
+		Red:       values[0],
+		Green:     values[1],
+		Blue:      values[2],
+		UpdatedAt: time.Unix(updated, 0),
+	}, nil
+}
+
+// RecordCommand pushes the entry onto the command history of the device, trimming the history if it has grown past
+// the configured amount of entries.
+func (registry *RedisRegistry) RecordCommand(deviceID string, entry CommandHistoryEntry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	data, e := json.Marshal(entry)
+
+	if e != nil {
+		return e
+	}
+
+	historyKey, limit := registry.genCommandHistoryKey(deviceID), registry.commandHistoryLimit()
+
+	if e := registry.pushCapped(historyKey, string(data), limit); e != nil {
+		registry.Errorf("unable to record command history of device[%s]: %s", deviceID, e.Error())
+		return e
+	}
+
+	return nil
+}
+
+// pushCapped pushes the entry onto the front of the list and trims the list down to its newest limit entries in a
+// single transaction, so that concurrent pushes never leave the list w/ more than limit entries.
+func (registry *RedisRegistry) pushCapped(key, entry string, limit int) error {
+	conn, e := registry.connection()
+
+	if e != nil {
+		return e
+	}
+
+	defer conn.Close()
+
+	if e := conn.Send("MULTI"); e != nil {
+		return e
+	}
+
+	if e := conn.Send("LPUSH", key, entry); e != nil {
+		return e
+	}
+
+	if e := conn.Send("LTRIM", key, 0, limit-1); e != nil {
+		return e
+	}
+
+	if e := conn.Send("EXEC"); e != nil {
+		return e
+	}
+
+	if e := conn.Flush(); e != nil {
+		return e
+	}
+
+	// The replies to the queued commands only acknowledge them; their results are part of the reply to the exec.
+	for _, queued := range []string{"MULTI", "LPUSH", "LTRIM"} {
+		if _, e := conn.Receive(); e != nil {
+			registry.Warnf("unable to queue %s of list[%s]: %s", queued, key, e.Error())
+			return e
+		}
+	}
+
+	replies, e := redis.Values(conn.Receive())
+
+	if e != nil {
+		return e
+	}
+
+	for _, reply := range replies {
+		if e, failed := reply.(redis.Error); failed {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// ListCommandHistory returns up to count of the latest control commands sent to the device, newest first.
+func (registry *RedisRegistry) ListCommandHistory(deviceID string, count int) ([]CommandHistoryEntry, error) {
+	items, e := registry.lrangestr(registry.genCommandHistoryKey(deviceID), 0, count-1)
+
+	if e != nil {
+		return nil, e
+	}
+
+	entries := make([]CommandHistoryEntry, 0, len(items))
+
+	for _, item := range items {
+		entry := CommandHistoryEntry{}
+
+		if e := json.Unmarshal([]byte(item), &entry); e != nil {
+			registry.Warnf("invalid command history entry of device[%s]: %s", deviceID, e.Error())
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// RecordConnectionEvent pushes the event onto the connection events of the device, trimming the list if it has grown
+// past the max amount of entries.
+func (registry *RedisRegistry) RecordConnectionEvent(deviceID string, event ConnectionEvent) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	data, e := json.Marshal(event)
+
+	if e != nil {
+		return e
+	}
+
+	eventsKey := registry.genConnEventsKey(deviceID)
+
+	if e := registry.pushCapped(eventsKey, string(data), defs.RedisMaxConnEventEntries); e != nil {
+		registry.Errorf("unable to record connection event of device[%s]: %s", deviceID, e.Error())
+		return e
+	}
+
+	return nil
+}
+
+// ListConnectionEvents returns up to count of the latest connection events of the device, newest first.
+func (registry *RedisRegistry) ListConnectionEvents(deviceID string, count int) ([]ConnectionEvent, error) {
+	items, e := registry.lrangestr(registry.genConnEventsKey(deviceID), 0, count-1)
+
+	if e != nil {
+		return nil, e
+	}
+
+	events := make([]ConnectionEvent, 0, len(items))
+
+	for _, item := range items {
+		event := ConnectionEvent{}
+
+		if e := json.Unmarshal([]byte(item), &event); e != nil {
+			registry.Warnf("invalid connection event of device[%s]: %s", deviceID, e.Error())
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// AddDeviceTag adds the device to the set of devices w/ the tag, and the tag to the set of the device's tags, returning
+// whether the device was newly tagged (false if it already had the tag).
+func (registry *RedisRegistry) AddDeviceTag(deviceID, tag string) (bool, error) {
+	if defs.DeviceTagPattern.MatchString(tag) != true {
+		return false, defs.Error(defs.ErrInvalidDeviceTag)
+	}
+
+	details, e := registry.FindDevice(deviceID)
+
+	if e != nil {
+		return false, e
+	}
+
+	if _, e := registry.Do("SADD", registry.genTagKey(tag), details.DeviceID); e != nil {
+		return false, e
+	}
+
+	added, e := redis.Int(registry.Do("SADD", registry.genTagListKey(details.DeviceID), tag))
+
+	if e != nil {
+		return false, e
+	}
+
+	return added == 1, nil
+}
+
+// RemoveDeviceTag removes the device from the set of devices w/ the tag, and the tag from the device's tags.
+func (registry *RedisRegistry) RemoveDeviceTag(deviceID, tag string) error {
+	if _, e := registry.Do("SREM", registry.genTagKey(tag), deviceID); e != nil {
+		return e
+	}
+
+	_, e := registry.Do("SREM", registry.genTagListKey(deviceID), tag)
+	return e
+}
+
+// ListDevicesByTag returns the details of each device w/ the tag, skipping devices that are unable to be loaded.
+func (registry *RedisRegistry) ListDevicesByTag(tag string) ([]RegistrationDetails, error) {
+	ids, e := registry.smembersstr(registry.genTagKey(tag))
+
+	if e != nil {
+		return nil, e
+	}
+
+	results := make([]RegistrationDetails, 0, len(ids))
+
+	for _, id := range ids {
+		details, e := registry.loadDetails(registry.genRegistryKey(id))
+
+		if e != nil {
+			registry.Warnf("unable to load tagged device[%s] (tag: %s): %s", id, tag, e.Error())
+			continue
+		}
+
+		results = append(results, details)
+	}
+
+	return results, nil
+}
+
+// exportTokens loads the details of each token in the device's token list. Unlike ListTokens, the raw token value is
+// included so that the token can be recreated during an import.
+func (registry *RedisRegistry) exportTokens(id string) ([]ExportedToken, error) {
+	values, e := registry.lrangestr(registry.genTokenListKey(id), 0, -1)
+
+	if e != nil {
+		return nil, e
+	}
+
+	results := make([]ExportedToken, 0, len(values))
+
+	for _, value := range values {
+		details, e := registry.loadToken(value)
+
+		if e != nil {
+			registry.Warnf("unable to load token for export (device: %s): %s", id, e.Error())
+			continue
+		}
+
+		results = append(results, ExportedToken{
+			TokenID:    details.TokenID,
+			Token:      value,
+			Name:       details.Name,
+			Permission: details.Permission,
+		})
 	}
 
-	registry.Infof("auth token: %s (token: %b, requested: %b)", requester.TokenID, requester.Permission, permission)
-
-	return requester.Permission&permission == permission
+	return results, nil
 }
 
-// CreateToken creates a new auth token for a given device id
-func (registry *RedisRegistry) CreateToken(deviceID, tokenName string, permission uint) (TokenDetails, error) {
-	listKey := registry.genTokenListKey(deviceID)
-	empty, permissionMask, tokenID := TokenDetails{}, fmt.Sprintf("%b", permission), uuid.NewV4().String()
-
-	if _, e := registry.FindDevice(deviceID); e != nil {
-		return empty, e
-	}
+// importDevice writes the index, registry and token entries of a single exported device. Entries are removed from
+// the index and token lists before being pushed so that repeated imports do not create duplicates.
+func (registry *RedisRegistry) importDevice(exported ExportedDevice, overwrite bool) error {
+	registryKey := registry.genRegistryKey(exported.DeviceID)
 
-	rawToken, e := registry.GenerateToken()
+	existing, e := registry.exists(registryKey)
 
 	if e != nil {
-		return empty, e
+		return e
 	}
 
-	if _, e := registry.Do("LPUSH", listKey, rawToken); e != nil {
-		return empty, e
+	if existing && overwrite != true {
+		registry.Infof("skipping import of existing device[%s]", exported.DeviceID)
+		return nil
 	}
 
-	registryKey := registry.genTokenRegistrationKey(rawToken)
+	if _, e := registry.Do("LREM", registry.genDeviceIndexKey(), 0, exported.DeviceID); e != nil {
+		return e
+	}
 
-	fields := struct {
-		name       string
-		permission string
-		id         string
-		deviceID   string
-	}{
-		defs.RedisDeviceTokenNameField,
-		defs.RedisDeviceTokenPermissionField,
-		defs.RedisDeviceTokenIDField,
-		defs.RedisDeviceTokenDeviceIDField,
+	if _, e := registry.Do("LPUSH", registry.genDeviceIndexKey(), exported.DeviceID); e != nil {
+		return e
 	}
 
-	details := TokenDetails{
-		TokenID:    tokenID,
-		DeviceID:   deviceID,
-		Token:      rawToken,
-		Name:       tokenName,
-		Permission: permission,
+	if e := registry.unindexName(exported.DeviceID); e != nil {
+		return e
 	}
 
-	return details, registry.hmset(
+	e = registry.hmset(
 		registryKey,
-		fields.name, tokenName,
-		fields.permission, permissionMask,
-		fields.id, tokenID,
-		fields.deviceID, deviceID,
+		defs.RedisDeviceIDField, exported.DeviceID,
+		defs.RedisDeviceNameField, exported.Name,
+		defs.RedisDeviceSecretField, exported.SharedSecret,
+		defs.RedisSchemaVersionField, strconv.Itoa(defs.RedisSchemaVersion),
 	)
-}
-
-// ListRegistrations prints out a list of all the registered devices
-func (registry *RedisRegistry) ListRegistrations() ([]RegistrationDetails, error) {
-	var results []RegistrationDetails
-
-	ids, e := registry.lrangestr(defs.RedisDeviceIndexKey, 0, -1)
 
 	if e != nil {
-		return nil, e
+		return e
+	}
+
+	if e := registry.indexName(exported.DeviceID, exported.Name); e != nil {
+		return e
 	}
 
-	for _, k := range ids {
-		details, e := registry.loadDetails(registry.genRegistryKey(k))
+	listKey := registry.genTokenListKey(exported.DeviceID)
 
-		if e != nil {
-			return nil, e
+	for i := len(exported.Tokens) - 1; i >= 0; i-- {
+		token := exported.Tokens[i]
+
+		if _, e := registry.Do("LREM", listKey, 0, token.Token); e != nil {
+			return e
 		}
 
-		results = append(results, details)
+		if _, e := registry.Do("LPUSH", listKey, token.Token); e != nil {
+			return e
+		}
+
+		e := registry.hmset(
+			registry.genTokenRegistrationKey(token.Token),
+			defs.RedisDeviceTokenNameField, token.Name,
+			defs.RedisDeviceTokenPermissionField, fmt.Sprintf("%b", token.Permission),
+			defs.RedisDeviceTokenIDField, token.TokenID,
+			defs.RedisDeviceTokenDeviceIDField, exported.DeviceID,
+			defs.RedisSchemaVersionField, strconv.Itoa(defs.RedisSchemaVersion),
+		)
+
+		if e != nil {
+			return e
+		}
 	}
 
-	return results, nil
+	registry.Infof("imported device[%s] w/ %d tokens", exported.DeviceID, len(exported.Tokens))
+	return nil
 }
 
-// RemoveDevice executes the LREM command to the redis connection
-func (registry *RedisRegistry) RemoveDevice(id string) error {
-	regKey, feedKey := registry.genRegistryKey(id), registry.genFeedbackKey(id)
+// removeTags removes the device from the set of each of its tags before deleting its own set of tags.
+func (registry *RedisRegistry) removeTags(id string) error {
+	tagListKey := registry.genTagListKey(id)
 
-	if e := registry.del(regKey); e != nil {
-		return e
-	}
+	tags, e := registry.smembersstr(tagListKey)
 
-	if e := registry.del(feedKey); e != nil {
+	if e != nil {
 		return e
 	}
 
-	if _, e := registry.Do("LREM", defs.RedisDeviceIndexKey, 1, id); e != nil {
-		return e
+	for _, tag := range tags {
+		if _, e := registry.Do("SREM", registry.genTagKey(tag), id); e != nil {
+			return e
+		}
 	}
 
-	tokensListKey := registry.genTokenListKey(id)
+	return registry.del(tagListKey)
+}
 
-	tokens, e := registry.lrangestr(tokensListKey, 0, -1)
+// readOnlyRedisCommands are the commands that may safely be sent again after the connection failed mid-command.
+var readOnlyRedisCommands = map[string]bool{
+	"EXISTS":    true,
+	"GET":       true,
+	"HEXISTS":   true,
+	"HGET":      true,
+	"HGETALL":   true,
+	"HKEYS":     true,
+	"HLEN":      true,
+	"HMGET":     true,
+	"HSCAN":     true,
+	"KEYS":      true,
+	"LINDEX":    true,
+	"LLEN":      true,
+	"LRANGE":    true,
+	"MGET":      true,
+	"PING":      true,
+	"PTTL":      true,
+	"SCAN":      true,
+	"SCARD":     true,
+	"SISMEMBER": true,
+	"SMEMBERS":  true,
+	"SSCAN":     true,
+	"TTL":       true,
+	"TYPE":      true,
+	"XLEN":      true,
+	"XRANGE":    true,
+	"XREVRANGE": true,
+}
 
-	if e != nil {
-		return e
+// transientRedisError returns true for errors that come from the connection to redis rather than from redis itself.
+func transientRedisError(e error) bool {
+	if _, ok := e.(redis.Error); ok {
+		return false
 	}
 
-	for _, t := range tokens {
-		registry.del(registry.genTokenRegistrationKey(t))
+	if e == io.EOF || e == io.ErrUnexpectedEOF {
+		return true
 	}
 
-	return registry.del(tokensListKey)
+	_, ok := e.(net.Error)
+	return ok
 }
 
 // exists extracts the full list of device keys and searches for the target id
@@ -428,6 +1562,46 @@ func (registry *RedisRegistry) exists(key string) (bool, error) {
 	return redis.Bool(response, e)
 }
 
+// existsBatch checks whether each of the keys exists, pipelining the EXISTS commands over a single connection rather
+// than making a round trip per key.
+func (registry *RedisRegistry) existsBatch(keys []string) ([]bool, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	conn, e := registry.connection()
+
+	if e != nil {
+		return nil, e
+	}
+
+	defer conn.Close()
+
+	for _, key := range keys {
+		if e := conn.Send("EXISTS", key); e != nil {
+			return nil, e
+		}
+	}
+
+	if e := conn.Flush(); e != nil {
+		return nil, e
+	}
+
+	results := make([]bool, 0, len(keys))
+
+	for range keys {
+		exists, e := redis.Bool(conn.Receive())
+
+		if e != nil {
+			return nil, e
+		}
+
+		results = append(results, exists)
+	}
+
+	return results, nil
+}
+
 // loadDetails returns the device registration details based on a provided device key
 func (registry *RedisRegistry) loadDetails(deviceKey string) (RegistrationDetails, error) {
 	f := struct {
@@ -454,6 +1628,58 @@ func (registry *RedisRegistry) loadDetails(deviceKey string) (RegistrationDetail
 	}, nil
 }
 
+// loadDetailsBatch loads the details of each device key, pipelining the HMGET commands over a single connection rather
+// than making a round trip per device. As w/ loadDetails, a device w/ an empty field is an error.
+func (registry *RedisRegistry) loadDetailsBatch(deviceKeys []string) ([]RegistrationDetails, error) {
+	if len(deviceKeys) == 0 {
+		return nil, nil
+	}
+
+	conn, e := registry.connection()
+
+	if e != nil {
+		return nil, e
+	}
+
+	defer conn.Close()
+
+	fields := []interface{}{defs.RedisDeviceIDField, defs.RedisDeviceNameField, defs.RedisDeviceSecretField}
+
+	for _, key := range deviceKeys {
+		if e := conn.Send("HMGET", append([]interface{}{key}, fields...)...); e != nil {
+			return nil, e
+		}
+	}
+
+	if e := conn.Flush(); e != nil {
+		return nil, e
+	}
+
+	results := make([]RegistrationDetails, 0, len(deviceKeys))
+
+	for range deviceKeys {
+		values, e := redis.Strings(conn.Receive())
+
+		if e != nil {
+			return nil, e
+		}
+
+		if len(values) != len(fields) {
+			return nil, defs.Error(defs.ErrBadRedisResponse)
+		}
+
+		for _, v := range values {
+			if filled := len(v) > 1; !filled {
+				return nil, fmt.Errorf("invalid-device")
+			}
+		}
+
+		results = append(results, RegistrationDetails{DeviceID: values[0], Name: values[1], SharedSecret: values[2]})
+	}
+
+	return results, nil
+}
+
 // loadRequest loads the registration request associated w/ a given key
 func (registry *RedisRegistry) loadRequest(requestKey string) (RegistrationRequest, error) {
 	f := struct {
@@ -474,24 +1700,137 @@ func (registry *RedisRegistry) loadRequest(requestKey string) (RegistrationReque
 
 	return RegistrationRequest{SharedSecret: values[0], Name: values[1]}, nil
 }
+
+// namespaced prepends the namespace of the registry to the key, returning the key as-is when there is no namespace.
+func (registry *RedisRegistry) namespaced(key string) string {
+	if registry.Namespace == "" {
+		return key
+	}
+
+	return fmt.Sprintf("%s:%s", registry.Namespace, key)
+}
+
+// genKey returns the key of the id under the prefix, wrapping the id in a hash tag when in cluster mode.
+func (registry *RedisRegistry) genKey(prefix, id string) string {
+	if registry.ClusterMode {
+		return registry.namespaced(fmt.Sprintf("%s:{%s}", prefix, id))
+	}
+
+	return registry.namespaced(fmt.Sprintf("%s:%s", prefix, id))
+}
+
+// genKeyPrefix returns the portion shared by every key genKey returns for the prefix, used when scanning.
+func (registry *RedisRegistry) genKeyPrefix(prefix string) string {
+	if registry.ClusterMode {
+		return registry.namespaced(fmt.Sprintf("%s:{", prefix))
+	}
+
+	return registry.namespaced(fmt.Sprintf("%s:", prefix))
+}
+
+// keyID returns the id a key generated by genKey for the prefix was generated w/.
+func (registry *RedisRegistry) keyID(prefix, key string) string {
+	id := strings.TrimPrefix(key, registry.genKeyPrefix(prefix))
+
+	if registry.ClusterMode {
+		return strings.TrimSuffix(id, "}")
+	}
+
+	return id
+}
+
+func (registry *RedisRegistry) genDeviceIndexKey() string {
+	return registry.namespaced(defs.RedisDeviceIndexKey)
+}
+
+// genDeviceNamesKey returns the key of the name index, hash tagged in cluster mode so that the key it is rebuilt into
+// is in the same slot.
+func (registry *RedisRegistry) genDeviceNamesKey() string {
+	if registry.ClusterMode {
+		return registry.namespaced(fmt.Sprintf("{%s}", defs.RedisDeviceNamesKey))
+	}
+
+	return registry.namespaced(defs.RedisDeviceNamesKey)
+}
+
+func (registry *RedisRegistry) genDeviceNamesRebuildKey() string {
+	return fmt.Sprintf("%s:%s", registry.genDeviceNamesKey(), defs.RedisDeviceNamesRebuildSuffix)
+}
+
+func (registry *RedisRegistry) genAuditLogKey() string {
+	return registry.namespaced(defs.RedisAuditLogKey)
+}
+
 func (registry *RedisRegistry) genAllocationKey(id string) string {
-	return fmt.Sprintf("%s:%s", defs.RedisRegistrationRequestListKey, id)
+	return registry.genKey(defs.RedisRegistrationRequestListKey, id)
+}
+
+func (registry *RedisRegistry) genFilledRegistrationKey(id string) string {
+	return registry.genKey(defs.RedisFilledRegistrationKey, id)
+}
+
+func (registry *RedisRegistry) genIdempotencyKey(deviceID, key string) string {
+	return fmt.Sprintf("%s:%s", registry.genKey(defs.RedisTokenIdempotencyKey, deviceID), key)
 }
 
 func (registry *RedisRegistry) genTokenRegistrationKey(token string) string {
-	return fmt.Sprintf("%s:%s", defs.RedisDeviceTokenRegistrationKey, token)
+	return registry.genKey(defs.RedisDeviceTokenRegistrationKey, token)
 }
 
 func (registry *RedisRegistry) genRegistryKey(id string) string {
-	return fmt.Sprintf("%s:%s", defs.RedisDeviceRegistryKey, id)
+	return registry.genKey(defs.RedisDeviceRegistryKey, id)
 }
 
 func (registry *RedisRegistry) genFeedbackKey(id string) string {
-	return fmt.Sprintf("%s:%s", defs.RedisDeviceFeedbackKey, id)
+	if registry.streaming() {
+		return registry.genKey(defs.RedisDeviceFeedbackStreamKey, id)
+	}
+
+	return registry.genKey(defs.RedisDeviceFeedbackKey, id)
 }
 
 func (registry *RedisRegistry) genTokenListKey(id string) string {
-	return fmt.Sprintf("%s:%s", defs.RedisDeviceTokenListKey, id)
+	return registry.genKey(defs.RedisDeviceTokenListKey, id)
+}
+
+func (registry *RedisRegistry) genTagKey(tag string) string {
+	return registry.genKey(defs.RedisDeviceTagKey, tag)
+}
+
+func (registry *RedisRegistry) genTagListKey(id string) string {
+	return registry.genKey(defs.RedisDeviceTagListKey, id)
+}
+
+func (registry *RedisRegistry) genMetaKey(id string) string {
+	return registry.genKey(defs.RedisDeviceMetaKey, id)
+}
+
+func (registry *RedisRegistry) genLockKey(id string) string {
+	return registry.genKey(defs.RedisDeviceLockKey, id)
+}
+
+func (registry *RedisRegistry) genStateKey(id string) string {
+	return registry.genKey(defs.RedisDeviceStateKey, id)
+}
+
+func (registry *RedisRegistry) genCommandHistoryKey(id string) string {
+	return registry.genKey(defs.RedisDeviceCommandHistoryKey, id)
+}
+
+func (registry *RedisRegistry) genConnEventsKey(id string) string {
+	return registry.genKey(defs.RedisDeviceConnEventsKey, id)
+}
+
+func (registry *RedisRegistry) genResumeKey(token string) string {
+	return registry.genKey(defs.RedisDeviceResumeKey, token)
+}
+
+func (registry *RedisRegistry) genResumeTokensKey(id string) string {
+	return registry.genKey(defs.RedisDeviceResumeTokensKey, id)
+}
+
+func (registry *RedisRegistry) genCommandKey(id string) string {
+	return registry.genKey(defs.RedisDeviceCommandKey, id)
 }
 
 // hmgetstr is a wrapper around the redis HMGET command where all fields are expected to be strings
@@ -523,6 +1862,44 @@ func (registry *RedisRegistry) hmgetstr(key string, fields ...string) ([]string,
 	return list, nil
 }
 
+// dispatch sends the event along to the registry's event dispatcher, if one has been provided
+func (registry *RedisRegistry) dispatch(eventType, deviceID string, payload interface{}) {
+	if registry.Events == nil {
+		return
+	}
+
+	registry.Events.Dispatch(eventType, deviceID, payload)
+}
+
+// expire is a wrapper around EXPIRE that sends the duration in seconds
+func (registry *RedisRegistry) expire(key string, ttl time.Duration) error {
+	_, e := registry.Do("EXPIRE", key, int(ttl.Seconds()))
+	return e
+}
+
+// commandHistoryLimit returns the configured size of each device's command history, falling back to the default
+func (registry *RedisRegistry) commandHistoryLimit() int {
+	if registry.MaxCommandHistory > 0 {
+		return registry.MaxCommandHistory
+	}
+
+	return defs.DefaultMaxCommandHistory
+}
+
+// streaming returns whether device feedback is stored in redis streams rather than lists.
+func (registry *RedisRegistry) streaming() bool {
+	return registry.FeedbackBackend == defs.FeedbackBackendStream
+}
+
+// allocationTTL returns the configured lifetime of registration requests, falling back to the default
+func (registry *RedisRegistry) allocationTTL() time.Duration {
+	if registry.AllocationTTL > 0 {
+		return registry.AllocationTTL
+	}
+
+	return defs.DefaultRegistrationRequestTTL
+}
+
 // del is a wrapper around DEL that casts to a string
 func (registry *RedisRegistry) del(key string) error {
 	_, e := registry.Do("DEL", key)
@@ -551,7 +1928,24 @@ func (registry *RedisRegistry) lrangestr(key string, start, end int) ([]string,
 	result, e := redis.Strings(response, e)
 
 	if e != nil {
-		return nil, fmt.Errorf(defs.ErrBadRedisResponse)
+		return nil, defs.Error(defs.ErrBadRedisResponse)
+	}
+
+	return result, nil
+}
+
+// smembersstr is a wrapper around the redis SMEMBERS command where all members are expected to be strings
+func (registry *RedisRegistry) smembersstr(key string) ([]string, error) {
+	response, e := registry.Do("SMEMBERS", key)
+
+	if e != nil {
+		return nil, e
+	}
+
+	result, e := redis.Strings(response, e)
+
+	if e != nil {
+		return nil, defs.Error(defs.ErrBadRedisResponse)
 	}
 
 	return result, nil
@@ -587,43 +1981,151 @@ func (registry *RedisRegistry) hgetstr(key, field string) (string, error) {
 	return redis.String(response, e)
 }
 
-// fill is responsible for loading the information stored during the registration request and creating records in both
-// the device registry index as well as the device registry (keys w/ device hash information)
-func (registry *RedisRegistry) fill(requestKey, deviceID string) error {
-	request, e := registry.loadRequest(requestKey)
+// fill claims the registration request if it still holds the secret, returning the id of the device it is filled w/
+// and the name it was requested w/. Returns redis.ErrNil when the request no longer holds the secret.
+func (registry *RedisRegistry) fill(requestKey, secret, deviceID string) (string, string, error) {
+	requestID := registry.keyID(defs.RedisRegistrationRequestListKey, requestKey)
+
+	f := struct {
+		secret string
+		name   string
+		id     string
+	}{defs.RedisRegistrationSecretField, defs.RedisRegistrationNameField, defs.RedisRegistrationDeviceIDField}
+
+	// The request is deleted in the same script that reads it so that it can only ever be filled once.
+	values, e := redis.Strings(registry.eval(
+		fillRegistrationScript,
+		[]string{requestKey, registry.genFilledRegistrationKey(requestID)},
+		f.secret, f.name, f.id,
+		secret,
+		deviceID,
+		int(registry.allocationTTL().Seconds()),
+	))
 
 	if e != nil {
-		return e
+		return "", "", e
 	}
 
-	if _, e := registry.Do("LPUSH", defs.RedisDeviceIndexKey, deviceID); e != nil {
+	if len(values) != 2 {
+		return "", "", defs.Error(defs.ErrBadRedisResponse)
+	}
+
+	return values[0], values[1], nil
+}
+
+// register adds the device to the device index and creates its entry in the device registry.
+func (registry *RedisRegistry) register(deviceID, name, secret string) error {
+	if _, e := registry.Do("LPUSH", registry.genDeviceIndexKey(), deviceID); e != nil {
 		return e
 	}
 
-	registryKey := registry.genRegistryKey(deviceID)
+	if e := registry.indexName(deviceID, name); e != nil {
+		return e
+	}
 
 	f := struct {
-		id   string
-		name string
-		key  string
-	}{defs.RedisDeviceIDField, defs.RedisDeviceNameField, defs.RedisDeviceSecretField}
-
-	_, e = registry.Do("HMSET", registryKey, f.id, deviceID, f.name, request.Name, f.key, request.SharedSecret)
+		id      string
+		name    string
+		key     string
+		version string
+	}{defs.RedisDeviceIDField, defs.RedisDeviceNameField, defs.RedisDeviceSecretField, defs.RedisSchemaVersionField}
+
+	_, e := registry.Do(
+		"HMSET",
+		registry.genRegistryKey(deviceID),
+		f.id, deviceID,
+		f.name, name,
+		f.key, secret,
+		f.version, defs.RedisSchemaVersion,
+	)
 
 	if e != nil {
 		return e
 	}
 
-	registry.Infof("filling device registry w/ name[%s] id[%s]", request.Name, deviceID)
-
-	defer registry.Do("DEL", requestKey)
+	// Feedback & connection events kept from a previous connection of the device are no longer set to expire.
+	for _, key := range []string{registry.genFeedbackKey(deviceID), registry.genConnEventsKey(deviceID)} {
+		if _, e := registry.Do("PERSIST", key); e != nil {
+			registry.Warnf("unable to persist history[%s] of device[%s]: %s", key, deviceID, e.Error())
+		}
+	}
 
 	return nil
 }
 
-// Do attempts to get an available connection from the pool and execute a command against it.
+// indexName records the device as the owner of the lowercased name when the name index is enabled.
+func (registry *RedisRegistry) indexName(deviceID, name string) error {
+	if registry.NameIndex != true {
+		return nil
+	}
+
+	_, e := registry.Do("HSET", registry.genDeviceNamesKey(), strings.ToLower(name), deviceID)
+	return e
+}
+
+// unindexName removes the current name of the device from the name index when the name index is enabled. The name is
+// only removed while the device still owns it, leaving names since taken by another device in place.
+func (registry *RedisRegistry) unindexName(deviceID string) error {
+	if registry.NameIndex != true {
+		return nil
+	}
+
+	response, e := registry.Do("HGET", registry.genRegistryKey(deviceID), defs.RedisDeviceNameField)
+
+	if e != nil || response == nil {
+		return e
+	}
+
+	name, e := redis.String(response, e)
+
+	if e != nil {
+		return defs.Error(defs.ErrBadRedisResponse)
+	}
+
+	_, e = registry.eval(unindexNameScript, []string{registry.genDeviceNamesKey()}, strings.ToLower(name), deviceID)
+	return e
+}
+
+// connection returns a connection from the pool, failing w/o touching the pool once the registry has been closed.
+func (registry *RedisRegistry) connection() (redis.Conn, error) {
+	if atomic.LoadInt32(&registry.closed) == 1 {
+		return nil, defs.Error(defs.ErrRegistryClosed)
+	}
+
+	return registry.Pool.Get(), nil
+}
+
+// Do attempts to get an available connection from the pool and execute a command against it. Connection-level errors
+// are retried up to the configured amount of times on a fresh connection, doubling the backoff between each attempt;
+// errors returned by redis itself (e.g. WRONGTYPE) are returned immediately. Failures to get a connection are retried
+// for every command, but failures while the command was in flight are only retried for read-only commands since a
+// write may have been applied before its reply was lost.
 func (registry *RedisRegistry) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
-	conn := registry.Pool.Get()
-	defer conn.Close()
-	return conn.Do(commandName, args...)
+	backoff := registry.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		conn, e := registry.connection()
+
+		if e != nil {
+			return nil, e
+		}
+
+		retryable := true
+
+		// Connections that could not be dialed hold their error and never send the command.
+		if err = conn.Err(); err == nil {
+			reply, err = conn.Do(commandName, args...)
+			retryable = readOnlyRedisCommands[strings.ToUpper(commandName)]
+		}
+
+		conn.Close()
+
+		if err == nil || attempt >= registry.Retries || retryable != true || transientRedisError(err) != true {
+			return reply, err
+		}
+
+		registry.Warnf("retrying %s after connection error (attempt %d): %s", commandName, attempt+1, err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+	}
 }
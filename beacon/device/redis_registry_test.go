@@ -2,10 +2,18 @@ package device
 
 import "log"
 import "fmt"
+import "time"
 import "bytes"
 import "strconv"
 import "testing"
+import "crypto"
 import "strings"
+import "crypto/rsa"
+import "crypto/rand"
+import "crypto/x509"
+import "crypto/sha256"
+import "encoding/hex"
+import "encoding/json"
 import "github.com/franela/goblin"
 import "github.com/golang/protobuf/proto"
 import "github.com/garyburd/redigo/redis"
@@ -28,12 +36,40 @@ func genFeedback() []byte {
 	return payload
 }
 
+func genDeviceKey() string {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	block, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return hex.EncodeToString(block)
+}
+
+// genSigningKey returns a private key along w/ its hex encoded public key, as registered by devices.
+func genSigningKey() (*rsa.PrivateKey, string) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	block, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return key, hex.EncodeToString(block)
+}
+
+// signFeedback sets the digest of the feedback message to the signature of its payload made w/ the private key.
+func signFeedback(key *rsa.PrivateKey, message interchange.FeedbackMessage) interchange.FeedbackMessage {
+	digest := sha256.Sum256(message.Payload)
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	message.Authentication.MessageDigest = hex.EncodeToString(signature)
+	return message
+}
+
 type fakeTokenGenerator struct {
-	t string
-	e error
+	t        string
+	e        error
+	sequence []string
 }
 
 func (f *fakeTokenGenerator) GenerateToken() (string, error) {
+	if len(f.sequence) >= 1 {
+		token := f.sequence[0]
+		f.sequence = f.sequence[1:]
+		return token, f.e
+	}
+
 	return f.t, f.e
 }
 
@@ -41,24 +77,96 @@ var (
 	generator fakeTokenGenerator
 )
 
+// feedbackCapture matches any redis argument, holding on to the last feedback message it was given.
+type feedbackCapture struct {
+	message *interchange.FeedbackMessage
+}
+
+func (c *feedbackCapture) Match(arg interface{}) bool {
+	message := interchange.FeedbackMessage{}
+
+	if e := proto.UnmarshalText(fmt.Sprintf("%s", arg), &message); e == nil {
+		c.message = &message
+	}
+
+	return true
+}
+
+type commandHistoryCapture struct {
+	entry *CommandHistoryEntry
+}
+
+func (c *commandHistoryCapture) Match(arg interface{}) bool {
+	entry := CommandHistoryEntry{}
+
+	if e := json.Unmarshal([]byte(fmt.Sprintf("%s", arg)), &entry); e == nil {
+		c.entry = &entry
+	}
+
+	return true
+}
+
+// auditCapture matches any redis argument, holding on to each audit entry it was given.
+type auditCapture struct {
+	entries []AuditEntry
+}
+
+func (c *auditCapture) Match(arg interface{}) bool {
+	entry := AuditEntry{}
+
+	if e := json.Unmarshal([]byte(fmt.Sprintf("%s", arg)), &entry); e == nil {
+		c.entries = append(c.entries, entry)
+	}
+
+	return true
+}
+
+// lockTokenCapture matches any redis argument, holding on to each lock token it was given.
+type lockTokenCapture struct {
+	tokens []string
+}
+
+func (c *lockTokenCapture) Match(arg interface{}) bool {
+	c.tokens = append(c.tokens, fmt.Sprintf("%s", arg))
+	return true
+}
+
+type dispatchedEvent struct {
+	kind     string
+	deviceID string
+	payload  interface{}
+}
+
+type fakeEventDispatcher struct {
+	events []dispatchedEvent
+}
+
+func (f *fakeEventDispatcher) Dispatch(kind, deviceID string, payload interface{}) {
+	f.events = append(f.events, dispatchedEvent{kind, deviceID, payload})
+}
+
 type redisMock struct {
-	c *redigomock.Conn
+	c       *redigomock.Conn
+	history []string
+	keys    []string
+	scripts [][]string
 }
 
 func (r *redisMock) Close() error {
 	return nil
 }
 
-func (r *redisMock) Send(string, ...interface{}) error {
-	return nil
+func (r *redisMock) Send(name string, args ...interface{}) error {
+	r.history = append(r.history, name)
+	return r.c.Send(name, args...)
 }
 
 func (r *redisMock) Receive() (interface{}, error) {
-	return nil, nil
+	return r.c.Receive()
 }
 
 func (r *redisMock) Flush() error {
-	return nil
+	return r.c.Flush()
 }
 
 func (r *redisMock) Err() error {
@@ -66,6 +174,7 @@ func (r *redisMock) Err() error {
 }
 
 func (r *redisMock) Clear() {
+	r.history, r.keys, r.scripts = nil, nil, nil
 	r.c.Clear()
 }
 
@@ -74,6 +183,18 @@ func (r *redisMock) ExpectationsWereMet() error {
 }
 
 func (r *redisMock) Do(name string, args ...interface{}) (interface{}, error) {
+	if name != "" {
+		r.history = append(r.history, name)
+	}
+
+	if key, ok := firstString(args); name != "" && ok {
+		r.keys = append(r.keys, key)
+	}
+
+	if name == "EVALSHA" || name == "EVAL" {
+		r.scripts = append(r.scripts, scriptKeys(args))
+	}
+
 	return r.c.Do(name, args...)
 }
 
@@ -81,6 +202,49 @@ func (r *redisMock) Command(name string, args ...interface{}) *redigomock.Cmd {
 	return r.c.Command(name, args...)
 }
 
+// scriptKeys returns the keys declared by the arguments of an EVALSHA or EVAL command.
+func scriptKeys(args []interface{}) []string {
+	if len(args) < 2 {
+		return nil
+	}
+
+	count, _ := args[1].(int)
+	keys := make([]string, 0, count)
+
+	for i := 0; i < count && i+2 < len(args); i++ {
+		key, _ := args[i+2].(string)
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// hashTag returns the portion of the key redis cluster hashes to pick the slot of the key.
+func hashTag(key string) string {
+	start := strings.Index(key, "{")
+
+	if start < 0 {
+		return key
+	}
+
+	end := strings.Index(key[start+1:], "}")
+
+	if end <= 0 {
+		return key
+	}
+
+	return key[start+1 : start+1+end]
+}
+
+func firstString(args []interface{}) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+
+	key, ok := args[0].(string)
+	return key, ok
+}
+
 func subject() (RedisRegistry, *redisMock) {
 	out := bytes.NewBuffer([]byte{})
 	logger := log.New(out, "", 0)
@@ -106,6 +270,9 @@ func subject() (RedisRegistry, *redisMock) {
 func Test_RedisRegistry(t *testing.T) {
 	g := goblin.Goblin(t)
 
+	// The LRANGE stop of the first page of the device index.
+	indexPageEnd := defs.RedisRegistrationPageSize - 1
+
 	tokenFields := struct {
 		id         string
 		name       string
@@ -145,13 +312,13 @@ func Test_RedisRegistry(t *testing.T) {
 		})
 
 		g.It("returns an error if unable to perform the initial lrange", func() {
-			mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, -1).ExpectError(fmt.Errorf("bad-range"))
+			mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, indexPageEnd).ExpectError(fmt.Errorf("bad-range"))
 			_, e := r.ListRegistrations()
 			g.Assert(e.Error()).Equal("bad-range")
 		})
 
 		g.It("returns an error if unable to parse range as strings", func() {
-			mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, -1).Expect(nil)
+			mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, indexPageEnd).Expect(nil)
 			_, e := r.ListRegistrations()
 			g.Assert(e.Error()).Equal(defs.ErrBadRedisResponse)
 		})
@@ -161,7 +328,7 @@ func Test_RedisRegistry(t *testing.T) {
 			registryKey := r.genRegistryKey(string(registration))
 
 			g.BeforeEach(func() {
-				mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, -1).ExpectSlice(registration)
+				mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, indexPageEnd).ExpectSlice(registration)
 			})
 
 			g.It("returns an error if unable to perform lookup on returned registrations", func() {
@@ -184,6 +351,134 @@ func Test_RedisRegistry(t *testing.T) {
 		})
 	})
 
+	g.Describe("WalkRegistrations", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		fields := []interface{}{defs.RedisDeviceIDField, defs.RedisDeviceNameField, defs.RedisDeviceSecretField}
+
+		// page expects the range of the device index starting at the offset, returning the ids of each device in it.
+		page := func(start, count int) {
+			ids := make([]interface{}, 0, count)
+
+			for i := start; i < start+count; i++ {
+				id := fmt.Sprintf("device-%d", i)
+				ids = append(ids, []byte(id))
+				mock.Command("HMGET", append([]interface{}{r.genRegistryKey(id)}, fields...)...).ExpectSlice(
+					[]byte(id),
+					[]byte("name-"+id),
+					[]byte("secret-"+id),
+				)
+			}
+
+			end := start + defs.RedisRegistrationPageSize - 1
+			mock.Command("LRANGE", defs.RedisDeviceIndexKey, start, end).Expect(ids)
+		}
+
+		g.It("invokes the callback w/ every device across pages of the index", func() {
+			page(0, defs.RedisRegistrationPageSize)
+			page(defs.RedisRegistrationPageSize, 2)
+			visited := make([]string, 0)
+
+			e := r.WalkRegistrations(func(details RegistrationDetails) error {
+				visited = append(visited, details.DeviceID)
+				return nil
+			})
+
+			g.Assert(e).Equal(nil)
+			g.Assert(len(visited)).Equal(defs.RedisRegistrationPageSize + 2)
+			g.Assert(visited[0]).Equal("device-0")
+			g.Assert(visited[defs.RedisRegistrationPageSize+1]).Equal(fmt.Sprintf("device-%d", defs.RedisRegistrationPageSize+1))
+		})
+
+		g.It("stops at the first error returned by the callback w/o loading later pages", func() {
+			page(0, defs.RedisRegistrationPageSize)
+			visited := 0
+
+			e := r.WalkRegistrations(func(details RegistrationDetails) error {
+				visited++
+
+				if visited == 3 {
+					return fmt.Errorf("stop")
+				}
+
+				return nil
+			})
+
+			g.Assert(e.Error()).Equal("stop")
+			g.Assert(visited).Equal(3)
+			g.Assert(strings.Count(strings.Join(mock.history, ","), "LRANGE")).Equal(1)
+		})
+
+		g.It("returns the error from loading a page of the index", func() {
+			mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, indexPageEnd).ExpectError(fmt.Errorf("bad-lrange"))
+			e := r.WalkRegistrations(func(RegistrationDetails) error { return nil })
+			g.Assert(e.Error()).Equal("bad-lrange")
+		})
+	})
+
+	g.Describe("loadDetailsBatch", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		fields := []interface{}{defs.RedisDeviceIDField, defs.RedisDeviceNameField, defs.RedisDeviceSecretField}
+		keys := []string{r.genRegistryKey("first"), r.genRegistryKey("second"), r.genRegistryKey("third")}
+
+		expectDevices := func() {
+			for i, key := range keys {
+				id := fmt.Sprintf("device-%d", i)
+				args := append([]interface{}{key}, fields...)
+				mock.Command("HMGET", args...).ExpectSlice([]byte(id), []byte(id+"-name"), []byte(id+"-secret"))
+			}
+		}
+
+		g.It("returns nothing w/o touching redis when given no keys", func() {
+			results, e := r.loadDetailsBatch(nil)
+			g.Assert(e).Equal(nil)
+			g.Assert(len(results)).Equal(0)
+			g.Assert(len(mock.history)).Equal(0)
+		})
+
+		g.It("pipelines a single HMGET per device", func() {
+			expectDevices()
+			_, e := r.loadDetailsBatch(keys)
+			g.Assert(e).Equal(nil)
+			g.Assert(mock.history).Equal([]string{"HMGET", "HMGET", "HMGET"})
+		})
+
+		g.It("returns the same details as loading each device serially", func() {
+			expectDevices()
+			batch, e := r.loadDetailsBatch(keys)
+			g.Assert(e).Equal(nil)
+
+			serial := make([]RegistrationDetails, 0, len(keys))
+
+			for _, key := range keys {
+				details, e := r.loadDetails(key)
+				g.Assert(e).Equal(nil)
+				serial = append(serial, details)
+			}
+
+			g.Assert(batch).Equal(serial)
+		})
+
+		g.It("errors if any of the devices has an empty field", func() {
+			mock.Command("HMGET", append([]interface{}{keys[0]}, fields...)...).ExpectSlice(
+				[]byte("device-0"),
+				[]byte(""),
+				[]byte("device-0-secret"),
+			)
+			_, e := r.loadDetailsBatch(keys[0:1])
+			g.Assert(e.Error()).Equal("invalid-device")
+		})
+
+		g.It("errors if any of the lookups fail", func() {
+			mock.Command("HMGET", append([]interface{}{keys[0]}, fields...)...).ExpectError(fmt.Errorf("bad-get"))
+			_, e := r.loadDetailsBatch(keys[0:1])
+			g.Assert(e.Error()).Equal("bad-get")
+		})
+	})
+
 	g.Describe("RemoveDevice", func() {
 		r, mock := subject()
 		g.BeforeEach(mock.Clear)
@@ -193,6 +488,8 @@ func Test_RedisRegistry(t *testing.T) {
 			token string
 		}{"eeeeeeeeeeeeeeeeeeee", "some-token"}
 
+		ttl := int(defs.DefaultResumeTokenTTL.Seconds())
+
 		g.AfterEach(func() {
 			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
 		})
@@ -203,16 +500,9 @@ func Test_RedisRegistry(t *testing.T) {
 			g.Assert(e.Error()).Equal("invalid-delete")
 		})
 
-		g.It("errors when unable to delete the feedback key", func() {
-			mock.Command("DEL", r.genRegistryKey(device.id)).Expect(nil)
-			mock.Command("DEL", r.genFeedbackKey(device.id)).ExpectError(fmt.Errorf("invalid-delete"))
-			e := r.RemoveDevice(device.id)
-			g.Assert(e.Error()).Equal("invalid-delete")
-		})
-
 		g.It("errors when unable to remove the device from the index", func() {
 			mock.Command("DEL", r.genRegistryKey(device.id)).Expect(nil)
-			mock.Command("DEL", r.genFeedbackKey(device.id)).Expect(nil)
+			mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).Expect(int64(1))
 			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).ExpectError(fmt.Errorf("invalid-lrem"))
 			e := r.RemoveDevice(device.id)
 			g.Assert(e.Error()).Equal("invalid-lrem")
@@ -220,7 +510,7 @@ func Test_RedisRegistry(t *testing.T) {
 
 		g.It("errors when unable to get a list of tokens", func() {
 			mock.Command("DEL", r.genRegistryKey(device.id)).Expect(nil)
-			mock.Command("DEL", r.genFeedbackKey(device.id)).Expect(nil)
+			mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).Expect(int64(1))
 			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).Expect(nil)
 			mock.Command("LRANGE", r.genTokenListKey(device.id), 0, -1).ExpectError(fmt.Errorf("invalid-list"))
 			e := r.RemoveDevice(device.id)
@@ -229,7 +519,7 @@ func Test_RedisRegistry(t *testing.T) {
 
 		g.It("errors when unable to delete the token list", func() {
 			mock.Command("DEL", r.genRegistryKey(device.id)).Expect(nil)
-			mock.Command("DEL", r.genFeedbackKey(device.id)).Expect(nil)
+			mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).Expect(int64(1))
 			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).Expect(nil)
 			mock.Command("LRANGE", r.genTokenListKey(device.id), 0, -1).ExpectSlice(
 				[]byte(device.token),
@@ -242,725 +532,4226 @@ func Test_RedisRegistry(t *testing.T) {
 
 		g.It("does not error when unable to delete a single token", func() {
 			mock.Command("DEL", r.genRegistryKey(device.id)).Expect(nil)
-			mock.Command("DEL", r.genFeedbackKey(device.id)).Expect(nil)
+			mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).Expect(int64(1))
 			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).Expect(nil)
 			mock.Command("LRANGE", r.genTokenListKey(device.id), 0, -1).ExpectSlice(
 				[]byte(device.token),
 			)
 			mock.Command("DEL", r.genTokenRegistrationKey(device.token)).ExpectError(fmt.Errorf("invalid-del"))
 			mock.Command("DEL", r.genTokenListKey(device.id)).Expect(nil)
+			mock.Command("SMEMBERS", r.genTagListKey(device.id)).ExpectSlice()
+			mock.Command("DEL", r.genTagListKey(device.id)).Expect(nil)
 			e := r.RemoveDevice(device.id)
 			g.Assert(e).Equal(nil)
 		})
-	})
 
-	g.Describe("FindDevice", func() {
-		r, mock := subject()
-		device := RegistrationDetails{
-			Name:         "some-device",
-			DeviceID:     "1235",
-			SharedSecret: "shared-secret",
-		}
-		registryKey := r.genRegistryKey(device.DeviceID)
-
-		g.BeforeEach(mock.Clear)
+		g.It("keeps the resume tokens of the device so it is able to resume its id once reconnected", func() {
+			mock.Command("DEL", r.genRegistryKey(device.id)).Expect(nil)
+			mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).Expect(int64(1))
+			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).Expect(nil)
+			mock.Command("LRANGE", r.genTokenListKey(device.id), 0, -1).ExpectSlice()
+			mock.Command("DEL", r.genTokenListKey(device.id)).Expect(nil)
+			mock.Command("SMEMBERS", r.genTagListKey(device.id)).ExpectSlice()
+			mock.Command("DEL", r.genTagListKey(device.id)).Expect(nil)
+			tokens := mock.Command("SMEMBERS", r.genResumeTokensKey(device.id)).ExpectSlice()
+			g.Assert(r.RemoveDevice(device.id)).Equal(nil)
+			g.Assert(mock.c.Stats(tokens)).Equal(0)
+		})
 
-		g.It("returns an error with no devies in the store", func() {
-			_, e := r.FindDevice("garbage")
-			g.Assert(e != nil).Equal(true)
+		g.It("keeps the feedback history of the device until its resume tokens would have expired", func() {
+			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).Expect(nil)
+			mock.Command("LRANGE", r.genTokenListKey(device.id), 0, -1).ExpectSlice()
+			mock.Command("SMEMBERS", r.genTagListKey(device.id)).ExpectSlice()
+			removed := mock.Command("DEL", r.genFeedbackKey(device.id)).Expect(nil)
+			mock.Command("DEL", redigomock.NewAnyData()).Expect(nil)
+			expire := mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).Expect(int64(1))
+			g.Assert(r.RemoveDevice(device.id)).Equal(nil)
+			g.Assert(mock.c.Stats(removed)).Equal(0)
+			g.Assert(mock.c.Stats(expire)).Equal(1)
 		})
 
-		g.Describe("when successfully able to check via exists", func() {
-			g.BeforeEach(func() {
-				mock.Command("EXISTS", registryKey).Expect([]byte("true"))
-			})
+		g.It("keeps the connection events of the device until its resume tokens would have expired", func() {
+			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).Expect(nil)
+			mock.Command("LRANGE", r.genTokenListKey(device.id), 0, -1).ExpectSlice()
+			mock.Command("SMEMBERS", r.genTagListKey(device.id)).ExpectSlice()
+			removed := mock.Command("DEL", r.genConnEventsKey(device.id)).Expect(nil)
+			mock.Command("DEL", redigomock.NewAnyData()).Expect(nil)
+			expire := mock.Command("EXPIRE", r.genConnEventsKey(device.id), ttl).Expect(int64(1))
+			mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).Expect(int64(1))
+			g.Assert(r.RemoveDevice(device.id)).Equal(nil)
+			g.Assert(mock.c.Stats(removed)).Equal(0)
+			g.Assert(mock.c.Stats(expire)).Equal(1)
+		})
 
-			g.It("still returns an error if unable to load data", func() {
-				_, e := r.FindDevice("garbage")
-				g.Assert(e != nil).Equal(true)
-			})
+		g.It("errors when unable to expire the feedback history of the device", func() {
+			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).Expect(nil)
+			mock.Command("LRANGE", r.genTokenListKey(device.id), 0, -1).ExpectSlice()
+			mock.Command("SMEMBERS", r.genTagListKey(device.id)).ExpectSlice()
+			mock.Command("DEL", redigomock.NewAnyData()).Expect(nil)
+			mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).ExpectError(fmt.Errorf("bad-expire"))
+			g.Assert(r.RemoveDevice(device.id).Error()).Equal("bad-expire")
+		})
 
-			g.Describe("when able to load all details via HMGET", func() {
-				g.BeforeEach(func() {
-					mock.Command("HMGET", registryKey, "device:uuid", "device:name", "device:secret").ExpectSlice(
-						[]byte(device.DeviceID),
-						[]byte(device.Name),
-						[]byte(device.SharedSecret),
-					)
-				})
+		g.It("errors when unable to load the tags of the device", func() {
+			mock.Command("DEL", r.genRegistryKey(device.id)).Expect(nil)
+			mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).Expect(int64(1))
+			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).Expect(nil)
+			mock.Command("LRANGE", r.genTokenListKey(device.id), 0, -1).ExpectSlice()
+			mock.Command("DEL", r.genTokenListKey(device.id)).Expect(nil)
+			mock.Command("SMEMBERS", r.genTagListKey(device.id)).ExpectError(fmt.Errorf("bad-smembers"))
+			g.Assert(r.RemoveDevice(device.id).Error()).Equal("bad-smembers")
+		})
 
-				g.It("successfully returns the device details", func() {
-					result, e := r.FindDevice(device.DeviceID)
+		g.It("removes the device from the set of each of its tags", func() {
+			mock.Command("DEL", r.genRegistryKey(device.id)).Expect(nil)
+			mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).Expect(int64(1))
+			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).Expect(nil)
+			mock.Command("LRANGE", r.genTokenListKey(device.id), 0, -1).ExpectSlice()
+			mock.Command("DEL", r.genTokenListKey(device.id)).Expect(nil)
+			mock.Command("SMEMBERS", r.genTagListKey(device.id)).ExpectSlice([]byte("kitchen"), []byte("office"))
+			kitchen := mock.Command("SREM", r.genTagKey("kitchen"), device.id).Expect(int64(1))
+			office := mock.Command("SREM", r.genTagKey("office"), device.id).Expect(int64(1))
+			list := mock.Command("DEL", r.genTagListKey(device.id)).Expect(nil)
+			g.Assert(r.RemoveDevice(device.id)).Equal(nil)
+			g.Assert(mock.c.Stats(kitchen)).Equal(1)
+			g.Assert(mock.c.Stats(office)).Equal(1)
+			g.Assert(mock.c.Stats(list)).Equal(1)
+		})
 
-					g.Assert(e == nil).Equal(true)
-					g.Assert(result.DeviceID).Equal(device.DeviceID)
-				})
-			})
+		g.It("removes the state and metadata of the device", func() {
+			mock.Command("DEL", r.genRegistryKey(device.id)).Expect(nil)
+			mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).Expect(int64(1))
+			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).Expect(nil)
+			mock.Command("LRANGE", r.genTokenListKey(device.id), 0, -1).ExpectSlice()
+			state := mock.Command("DEL", r.genStateKey(device.id)).Expect(nil)
+			meta := mock.Command("DEL", r.genMetaKey(device.id)).Expect(nil)
+			mock.Command("DEL", r.genTokenListKey(device.id)).Expect(nil)
+			mock.Command("SMEMBERS", r.genTagListKey(device.id)).ExpectSlice()
+			mock.Command("DEL", r.genTagListKey(device.id)).Expect(nil)
+			g.Assert(r.RemoveDevice(device.id)).Equal(nil)
+			g.Assert(mock.c.Stats(state)).Equal(1)
+			g.Assert(mock.c.Stats(meta)).Equal(1)
 		})
 
-		g.Describe("when unable to find by fast id lookup", func() {
-			g.BeforeEach(func() {
-				mock.Command("EXISTS", r.genRegistryKey(device.Name)).Expect([]byte("false"))
-			})
+		g.It("does not record the removal of a disconnected device in the audit log", func() {
+			mock.Command("DEL", r.genRegistryKey(device.id)).Expect(nil)
+			mock.Command("EXPIRE", r.genFeedbackKey(device.id), ttl).Expect(int64(1))
+			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, device.id).Expect(nil)
+			mock.Command("LRANGE", r.genTokenListKey(device.id), 0, -1).ExpectSlice()
+			mock.Command("DEL", r.genTokenListKey(device.id)).Expect(nil)
+			mock.Command("SMEMBERS", r.genTagListKey(device.id)).ExpectSlice()
+			mock.Command("DEL", r.genTagListKey(device.id)).Expect(nil)
+			push := mock.Command("LPUSH", defs.RedisAuditLogKey, redigomock.NewAnyData()).Expect("QUEUED")
+			g.Assert(r.RemoveDevice(device.id)).Equal(nil)
+			g.Assert(mock.c.Stats(push)).Equal(0)
+		})
+	})
 
-			g.It("returns an error when recevied an error during the loading from KEYS", func() {
-				mock.Command("KEYS", fmt.Sprintf("%s*", defs.RedisDeviceRegistryKey)).ExpectError(fmt.Errorf("problems"))
+	g.Describe("RemoveDevices", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
 
-				_, e := r.FindDevice(device.Name)
+		ids := []string{"device-1", "device-2", "device-3"}
+
+		expectRemoval := func(id string) *redigomock.Cmd {
+			mock.Command("DEL", r.genRegistryKey(id)).Expect(nil)
+			mock.Command("DEL", r.genFeedbackKey(id)).Expect(nil)
+			lrem := mock.Command("LREM", defs.RedisDeviceIndexKey, 1, id).Expect(nil)
+			mock.Command("LRANGE", r.genTokenListKey(id), 0, -1).ExpectSlice()
+			mock.Command("DEL", r.genTokenListKey(id)).Expect(nil)
+			mock.Command("SMEMBERS", r.genTagListKey(id)).ExpectSlice()
+			mock.Command("DEL", r.genTagListKey(id)).Expect(nil)
+			return lrem
+		}
 
-				g.Assert(e != nil).Equal(true)
-			})
+		resumeTokens := func(id string, tokens ...string) {
+			members := make([]interface{}, 0, len(tokens))
 
-			g.It("returns an error when recevied an error during the parsing of strings from KEYS", func() {
-				mock.Command("KEYS", fmt.Sprintf("%s*", defs.RedisDeviceRegistryKey)).Expect(nil)
-				_, e := r.FindDevice(device.Name)
-				g.Assert(e != nil).Equal(true)
-			})
+			for _, token := range tokens {
+				members = append(members, []byte(token))
+			}
 
-			g.Describe("having received a valid list of device registrations", func() {
-				g.BeforeEach(func() {
-					list := []byte(r.genRegistryKey(device.DeviceID))
-					mock.Command("KEYS", fmt.Sprintf("%s*", defs.RedisDeviceRegistryKey)).ExpectSlice(list)
-				})
+			mock.Command("SMEMBERS", r.genResumeTokensKey(id)).Expect(members)
+			mock.Command("DEL", r.genResumeTokensKey(id)).Expect(int64(1))
+		}
 
-				g.It("returns an error when recevied an error during the loading of keys via second HMGET", func() {
-					mock.Command(
-						"HMGET",
-						r.genRegistryKey(device.DeviceID), "device:name", "device:uuid", "device:secret",
-					).ExpectError(fmt.Errorf("problem"))
+		g.BeforeEach(func() {
+			for _, id := range ids {
+				resumeTokens(id)
+			}
+		})
 
-					_, e := r.FindDevice(device.Name)
+		g.It("returns no failures w/o touching redis when given no ids", func() {
+			failures, e := r.RemoveDevices(nil)
+			g.Assert(e).Equal(nil)
+			g.Assert(len(failures)).Equal(0)
+			g.Assert(len(mock.history)).Equal(0)
+		})
 
-					g.Assert(e != nil).Equal(true)
-				})
+		g.It("removes every device of an all-success batch", func() {
+			removals := make([]*redigomock.Cmd, 0, len(ids))
 
-				g.It("errors when recevied a mismatch during the loading from HMGET", func() {
-					k := r.genRegistryKey(device.DeviceID)
-					cmd := mock.Command("HMGET", k, "device:name", "device:uuid", "device:secret")
-					cmd.ExpectSlice(
-						[]byte("not-the-same"),
-						[]byte("not-the-same"),
-						[]byte("not-the-same"),
-					)
+			for _, id := range ids {
+				mock.Command("EXISTS", r.genRegistryKey(id)).Expect(int64(1))
+				removals = append(removals, expectRemoval(id))
+			}
 
-					_, e := r.FindDevice(device.Name)
-					g.Assert(e != nil).Equal(true)
-				})
+			failures, e := r.RemoveDevices(ids)
+			g.Assert(e).Equal(nil)
+			g.Assert(len(failures)).Equal(0)
 
-				g.It("succeeds with valid device details & searching by name", func() {
-					k := r.genRegistryKey(device.DeviceID)
-					cmd := mock.Command("HMGET", k, "device:name", "device:uuid", "device:secret")
-					cmd.ExpectSlice(
-						[]byte(device.Name),
-						[]byte(device.DeviceID),
-						[]byte(device.SharedSecret),
-					)
+			for _, removal := range removals {
+				g.Assert(mock.c.Stats(removal)).Equal(1)
+			}
+		})
 
-					result, e := r.FindDevice(device.Name)
+		g.It("reports the ids that failed in a mixed batch w/o aborting the rest", func() {
+			mock.Command("EXISTS", r.genRegistryKey(ids[0])).Expect(int64(1))
+			mock.Command("EXISTS", r.genRegistryKey(ids[1])).Expect(int64(0))
+			mock.Command("EXISTS", r.genRegistryKey(ids[2])).Expect(int64(1))
+			mock.Command("DEL", r.genRegistryKey(ids[0])).ExpectError(fmt.Errorf("bad-del"))
+			removal := expectRemoval(ids[2])
 
-					g.Assert(e).Equal(nil)
-					g.Assert(result.Name).Equal(device.Name)
-					g.Assert(result.DeviceID).Equal(device.DeviceID)
-				})
-			})
+			failures, e := r.RemoveDevices(ids)
+			g.Assert(e).Equal(nil)
+			g.Assert(len(failures)).Equal(2)
+			g.Assert(failures[ids[0]].Error()).Equal("bad-del")
+			g.Assert(failures[ids[1]]).Equal(defs.Error(defs.ErrNotFound))
+			g.Assert(mock.c.Stats(removal)).Equal(1)
 		})
-	})
 
-	g.Describe("AllocateRegistration", func() {
-		r, mock := subject()
+		g.It("records an entry in the audit log for each removed device", func() {
+			mock.Command("EXISTS", r.genRegistryKey(ids[0])).Expect(int64(1))
+			mock.Command("EXISTS", r.genRegistryKey(ids[1])).Expect(int64(0))
+			expectRemoval(ids[0])
+			mock.Command("MULTI").Expect("OK")
+			mock.Command("LTRIM", defs.RedisAuditLogKey, 0, defs.RedisMaxAuditEntries-1).Expect("QUEUED")
+			mock.Command("EXEC").ExpectSlice(int64(1), "OK")
+			capture := &auditCapture{}
+			mock.Command("LPUSH", defs.RedisAuditLogKey, capture).Expect("QUEUED")
+
+			failures, e := r.RemoveDevices(ids[:2])
+			g.Assert(e).Equal(nil)
+			g.Assert(len(failures)).Equal(1)
+			g.Assert(len(capture.entries)).Equal(1)
+			g.Assert(capture.entries[0].Action).Equal(defs.AuditDeviceRemovedAction)
+			g.Assert(capture.entries[0].DeviceID).Equal(ids[0])
+		})
 
-		g.BeforeEach(mock.Clear)
+		g.It("does not fail the removal if unable to record it in the audit log", func() {
+			mock.Command("EXISTS", r.genRegistryKey(ids[0])).Expect(int64(1))
+			removal := expectRemoval(ids[0])
+			mock.Command("MULTI").ExpectError(fmt.Errorf("bad-multi"))
 
-		g.Describe("with invalid registration details", func() {
-			registrations := []RegistrationRequest{
-				RegistrationRequest{},
-				RegistrationRequest{Name: "this is a valid name"},
-				RegistrationRequest{SharedSecret: "iiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiii"},
-			}
+			failures, e := r.RemoveDevices(ids[:1])
+			g.Assert(e).Equal(nil)
+			g.Assert(len(failures)).Equal(0)
+			g.Assert(mock.c.Stats(removal)).Equal(1)
+		})
 
-			for _, request := range registrations {
-				g.It("errors with an invalid registration request", func() {
-					e := r.AllocateRegistration(request)
-					g.Assert(e.Error()).Equal(defs.ErrInvalidRegistrationRequest)
-				})
-			}
+		g.It("revokes the resume tokens of the removed devices so they cannot be restored", func() {
+			mock.Command("EXISTS", r.genRegistryKey(ids[0])).Expect(int64(1))
+			expectRemoval(ids[0])
+			resumeTokens(ids[0], "issued")
+			issued := mock.Command("DEL", r.genResumeKey("issued")).Expect(int64(1))
+			set := mock.Command("DEL", r.genResumeTokensKey(ids[0])).Expect(int64(1))
+
+			failures, e := r.RemoveDevices(ids[:1])
+			g.Assert(e).Equal(nil)
+			g.Assert(len(failures)).Equal(0)
+			g.Assert(mock.c.Stats(issued)).Equal(1)
+			g.Assert(mock.c.Stats(set)).Equal(1)
+			g.Assert(strings.Contains(strings.Join(mock.history, ","), "SCAN")).Equal(false)
 		})
 
-		g.Describe("with a valid registration", func() {
-			request := RegistrationRequest{
-				Name:         "a valid device name",
-				SharedSecret: "iiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiii",
-			}
+		g.It("reports the device as failed if unable to load its resume tokens", func() {
+			mock.Command("EXISTS", r.genRegistryKey(ids[0])).Expect(int64(1))
+			expectRemoval(ids[0])
+			mock.Command("SMEMBERS", r.genResumeTokensKey(ids[0])).ExpectError(fmt.Errorf("bad-smembers"))
 
-			g.It("errors when unable to set via hset", func() {
-				mock.Command("HMSET").ExpectError(fmt.Errorf("some-error"))
-				e := r.AllocateRegistration(request)
-				g.Assert(e.Error()).Equal("some-error")
-			})
+			failures, e := r.RemoveDevices(ids[:1])
+			g.Assert(e).Equal(nil)
+			g.Assert(failures[ids[0]].Error()).Equal("bad-smembers")
+		})
 
-			g.It("returns nil when successfully able to set via hset", func() {
-				mock.Command("HMSET").Expect(nil)
-				e := r.AllocateRegistration(request)
-				g.Assert(e).Equal(nil)
-			})
+		g.It("errors w/o removing any device when unable to check whether the devices exist", func() {
+			mock.Command("EXISTS", r.genRegistryKey(ids[0])).Expect(int64(1))
+			mock.Command("EXISTS", r.genRegistryKey(ids[1])).ExpectError(fmt.Errorf("bad-exists"))
+			mock.Command("EXISTS", r.genRegistryKey(ids[2])).Expect(int64(1))
+
+			_, e := r.RemoveDevices(ids)
+			g.Assert(e.Error()).Equal("bad-exists")
+
+			for _, command := range mock.history {
+				g.Assert(command).Equal("EXISTS")
+			}
 		})
 	})
 
-	g.Describe("FillRegistration", func() {
-		r, mock := subject()
-		g.BeforeEach(mock.Clear)
+	g.Describe("RegistryArchive", func() {
+		secret := genDeviceKey()
+		device := ExportedDevice{
+			DeviceID:     "device-1",
+			Name:         "some-device",
+			SharedSecret: secret,
+			Tokens: []ExportedToken{
+				{TokenID: "token-id-1", Token: "token-1", Name: "some-token", Permission: 3},
+			},
+		}
 
-		fields := struct {
-			secret string
-			name   string
-		}{defs.RedisRegistrationSecretField, defs.RedisRegistrationNameField}
+		document := func(devices ...ExportedDevice) []byte {
+			data, _ := json.Marshal(RegistryExport{Version: defs.RegistryExportVersion, Devices: devices})
+			return data
+		}
 
-		registration := struct {
-			id     string
-			name   string
-			secret string
-		}{"1212121212", "some request", "31313131313131313131"}
+		expectImport := func(mock *redisMock, r RedisRegistry) []*redigomock.Cmd {
+			return []*redigomock.Cmd{
+				mock.Command("LREM", defs.RedisDeviceIndexKey, 0, device.DeviceID).Expect(int64(0)),
+				mock.Command("LPUSH", defs.RedisDeviceIndexKey, device.DeviceID).Expect(int64(1)),
+				mock.Command(
+					"HMSET", r.genRegistryKey(device.DeviceID),
+					defs.RedisDeviceIDField, device.DeviceID,
+					defs.RedisDeviceNameField, device.Name,
+					defs.RedisDeviceSecretField, secret,
+					defs.RedisSchemaVersionField, strconv.Itoa(defs.RedisSchemaVersion),
+				).Expect("OK"),
+				mock.Command("LREM", r.genTokenListKey(device.DeviceID), 0, "token-1").Expect(int64(0)),
+				mock.Command("LPUSH", r.genTokenListKey(device.DeviceID), "token-1").Expect(int64(1)),
+				mock.Command(
+					"HMSET", r.genTokenRegistrationKey("token-1"),
+					defs.RedisDeviceTokenNameField, "some-token",
+					defs.RedisDeviceTokenPermissionField, "11",
+					defs.RedisDeviceTokenIDField, "token-id-1",
+					defs.RedisDeviceTokenDeviceIDField, device.DeviceID,
+					defs.RedisSchemaVersionField, strconv.Itoa(defs.RedisSchemaVersion),
+				).Expect("OK"),
+			}
+		}
 
-		g.It("returns error when initial keys lookup fails", func() {
-			mock.Command("KEYS").ExpectError(fmt.Errorf("bad-keys"))
-			e := r.FillRegistration("secret", "uuid")
-			g.Assert(e.Error()).Equal("bad-keys")
-		})
+		g.Describe("ExportRegistry", func() {
+			r, mock := subject()
+			g.BeforeEach(mock.Clear)
 
-		g.It("returns error when initial keys lookup returns garbage", func() {
-			mock.Command("KEYS").Expect(nil)
-			e := r.FillRegistration("secret", "uuid")
-			g.Assert(e.Error()).Equal(defs.ErrBadRedisResponse)
-		})
+			g.It("errors if unable to list the registrations", func() {
+				mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, indexPageEnd).ExpectError(fmt.Errorf("bad-lrange"))
+				_, e := r.ExportRegistry()
+				g.Assert(e.Error()).Equal("bad-lrange")
+			})
 
-		g.It("returns error when initial keys lookup returns empty array", func() {
-			mock.Command("KEYS").ExpectSlice([]byte("one"))
-			e := r.FillRegistration("secret", "uuid")
-			g.Assert(e.Error()).Equal(defs.ErrNotFound)
-		})
+			g.It("errors if unable to load the token list of a device", func() {
+				mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, indexPageEnd).ExpectSlice([]byte(device.DeviceID))
+				mock.Command("HMGET", r.genRegistryKey(device.DeviceID), "device:uuid", "device:name", "device:secret").ExpectSlice(
+					[]byte(device.DeviceID),
+					[]byte(device.Name),
+					[]byte(secret),
+				)
+				mock.Command("LRANGE", r.genTokenListKey(device.DeviceID), 0, -1).ExpectError(fmt.Errorf("bad-tokens"))
+				_, e := r.ExportRegistry()
+				g.Assert(e.Error()).Equal("bad-tokens")
+			})
 
-		g.It("returns error when received some keys but fails on string conv", func() {
-			mock.Command("KEYS").ExpectSlice([]byte("hello"))
-			mock.Command("HGET").Expect(nil)
-			e := r.FillRegistration("secret", "uuid")
-			g.Assert(e.Error()).Equal(defs.ErrNotFound)
+			g.It("exports a document that can be imported into a fresh registry", func() {
+				mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, indexPageEnd).ExpectSlice([]byte(device.DeviceID))
+				mock.Command("HMGET", r.genRegistryKey(device.DeviceID), "device:uuid", "device:name", "device:secret").ExpectSlice(
+					[]byte(device.DeviceID),
+					[]byte(device.Name),
+					[]byte(secret),
+				)
+				mock.Command("LRANGE", r.genTokenListKey(device.DeviceID), 0, -1).ExpectSlice(
+					[]byte("token-1"),
+					[]byte("stale-token"),
+				)
+				mock.Command(
+					"HMGET", r.genTokenRegistrationKey("token-1"),
+					defs.RedisDeviceTokenIDField,
+					defs.RedisDeviceTokenNameField,
+					defs.RedisDeviceTokenDeviceIDField,
+					defs.RedisDeviceTokenPermissionField,
+				).ExpectSlice([]byte("token-id-1"), []byte("some-token"), []byte(device.DeviceID), []byte("11"))
+				mock.Command(
+					"HMGET", r.genTokenRegistrationKey("stale-token"),
+					defs.RedisDeviceTokenIDField,
+					defs.RedisDeviceTokenNameField,
+					defs.RedisDeviceTokenDeviceIDField,
+					defs.RedisDeviceTokenPermissionField,
+				).ExpectError(fmt.Errorf("bad-hmget"))
+
+				data, e := r.ExportRegistry()
+				g.Assert(e).Equal(nil)
+
+				fresh, freshMock := subject()
+				freshMock.Command("EXISTS", fresh.genRegistryKey(device.DeviceID)).Expect(int64(0))
+				commands := expectImport(freshMock, fresh)
+
+				g.Assert(fresh.ImportRegistry(data, false)).Equal(nil)
+
+				for _, cmd := range commands {
+					g.Assert(freshMock.c.Stats(cmd)).Equal(1)
+				}
+			})
 		})
 
-		g.Describe("when having received a valid lookup w/ a matching secret", func() {
-			registrationKey := r.genAllocationKey(registration.id)
+		g.Describe("ImportRegistry", func() {
+			r, mock := subject()
+			g.BeforeEach(mock.Clear)
 
-			g.BeforeEach(func() {
-				mock.Command("KEYS").ExpectSlice([]byte(registrationKey))
-				mock.Command("HGET", registrationKey, fields.secret).Expect([]byte(registration.secret))
+			g.It("errors if unable to parse the document", func() {
+				g.Assert(r.ImportRegistry([]byte("}{"), false).Error()).Equal(defs.ErrInvalidRegistryExport)
 			})
 
-			g.It("returns error when unable to finalize the registration", func() {
-				mock.Command("HMGET", registrationKey, fields.secret, fields.name).ExpectError(fmt.Errorf("some-error"))
-				e := r.FillRegistration(registration.secret, registration.id)
-				g.Assert(e.Error()).Equal("some-error")
+			g.It("errors if the document version is not supported", func() {
+				data, _ := json.Marshal(RegistryExport{Version: defs.RegistryExportVersion + 1})
+				g.Assert(r.ImportRegistry(data, false).Error()).Equal(defs.ErrUnsupportedRegistryExport)
 			})
 
-			g.It("returns error when unable to push into the index", func() {
-				mock.Command("HMGET", registrationKey, fields.secret, fields.name).ExpectSlice(
-					[]byte(registration.secret),
-					[]byte(registration.name),
-				)
-				mock.Command("LPUSH", defs.RedisDeviceIndexKey, registration.id).ExpectError(fmt.Errorf("some-error"))
-				e := r.FillRegistration(registration.secret, registration.id)
-				g.Assert(e.Error()).Equal("some-error")
+			g.It("errors w/o writing anything if any shared secret is not a valid key", func() {
+				invalid := ExportedDevice{DeviceID: "device-2", Name: "other-device", SharedSecret: "not-a-key"}
+				e := r.ImportRegistry(document(device, invalid), false)
+				g.Assert(e.Error()).Equal(defs.ErrInvalidDeviceSharedSecret)
+				g.Assert(len(mock.history)).Equal(0)
 			})
 
-			g.Describe("having succesfully loaded + pushed to the index", func() {
-				g.BeforeEach(func() {
-					mock.Command("HMGET", registrationKey, fields.secret, fields.name).ExpectSlice(
-						[]byte(registration.secret),
-						[]byte(registration.name),
-					)
-					mock.Command("LPUSH", defs.RedisDeviceIndexKey, registration.id).Expect(nil)
-				})
+			g.It("skips devices that already exist when not overwriting", func() {
+				mock.Command("EXISTS", r.genRegistryKey(device.DeviceID)).Expect(int64(1))
+				g.Assert(r.ImportRegistry(document(device), false)).Equal(nil)
+				g.Assert(mock.history).Equal([]string{"EXISTS"})
+			})
 
-				g.It("errors when failed on hmset", func() {
-					mock.Command("HMSET").ExpectError(fmt.Errorf("bad-hmset"))
-					e := r.FillRegistration(registration.secret, registration.id)
-					g.Assert(e.Error()).Equal("bad-hmset")
-				})
+			g.It("rewrites devices that already exist when overwriting", func() {
+				mock.Command("EXISTS", r.genRegistryKey(device.DeviceID)).Expect(int64(1))
+				commands := expectImport(mock, r)
+				g.Assert(r.ImportRegistry(document(device), true)).Equal(nil)
 
-				g.It("succeeds after successful hmset", func() {
-					mock.Command("HMSET").Expect(nil)
-					e := r.FillRegistration(registration.secret, registration.id)
-					g.Assert(e).Equal(nil)
-				})
+				for _, cmd := range commands {
+					g.Assert(mock.c.Stats(cmd)).Equal(1)
+				}
+			})
+
+			g.It("errors if unable to push the device into the index", func() {
+				mock.Command("EXISTS", r.genRegistryKey(device.DeviceID)).Expect(int64(0))
+				mock.Command("LREM", defs.RedisDeviceIndexKey, 0, device.DeviceID).Expect(int64(0))
+				mock.Command("LPUSH", defs.RedisDeviceIndexKey, device.DeviceID).ExpectError(fmt.Errorf("bad-lpush"))
+				g.Assert(r.ImportRegistry(document(device), false).Error()).Equal("bad-lpush")
 			})
 		})
 	})
 
-	g.Describe("ListTokens", func() {
+	g.Describe("Activity", func() {
 		r, mock := subject()
 		g.BeforeEach(mock.Clear)
 
-		fixtures := struct {
-			deviceID            string
-			deviceName          string
-			deviceSecret        string
-			testTokenValue      string
-			testTokenName       string
-			testTokenID         string
-			testTokenPermission string
-		}{
-			deviceID:            "list-tokens-test-device-id",
-			deviceName:          "some-device-name",
-			deviceSecret:        "go-bills",
-			testTokenValue:      "a-token",
-			testTokenName:       "token-id",
-			testTokenID:         "111",
-			testTokenPermission: "111",
-		}
+		registryKey := r.genRegistryKey("device-1")
 
-		g.AfterEach(func() {
-			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
-		})
+		g.Describe("TouchDevice", func() {
+			g.It("errors if unable to set the last seen time", func() {
+				mock.Command("HSET", registryKey, defs.RedisDeviceLastSeenField, redigomock.NewAnyData()).ExpectError(
+					fmt.Errorf("bad-hset"),
+				)
+				g.Assert(r.TouchDevice("device-1").Error()).Equal("bad-hset")
+			})
 
-		g.It("fails if it is unable to find the device requested", func() {
-			registryKey := r.genRegistryKey(fixtures.deviceID)
-			mock.Command("EXISTS", registryKey).ExpectError(fmt.Errorf("bad-exists"))
-			_, e := r.ListTokens(fixtures.deviceID)
-			g.Assert(e.Error()).Equal("bad-exists")
+			g.It("sets the last seen time and clears the idle flag", func() {
+				mock.Command("HSET", registryKey, defs.RedisDeviceLastSeenField, redigomock.NewAnyData()).Expect(int64(1))
+				clear := mock.Command("HDEL", registryKey, defs.RedisDeviceIdleField).Expect(int64(1))
+				g.Assert(r.TouchDevice("device-1")).Equal(nil)
+				g.Assert(mock.c.Stats(clear)).Equal(1)
+			})
 		})
 
-		g.Describe("having found a device", func() {
-			g.BeforeEach(func() {
-				registryKey := r.genRegistryKey(fixtures.deviceID)
-				mock.Command("EXISTS", registryKey).Expect([]byte("true"))
-				mock.Command("HMGET", registryKey, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
-					[]byte(fixtures.deviceID),
-					[]byte(fixtures.deviceName),
-					[]byte(fixtures.deviceSecret),
-				)
+		g.Describe("LastSeen", func() {
+			g.It("returns the zero time for devices that have never been seen", func() {
+				mock.Command("HGET", registryKey, defs.RedisDeviceLastSeenField).Expect(nil)
+				seen, e := r.LastSeen("device-1")
+				g.Assert(e).Equal(nil)
+				g.Assert(seen.IsZero()).Equal(true)
 			})
 
-			g.It("errors if unable to range over the tokens", func() {
-				tokensListKey := r.genTokenListKey(fixtures.deviceID)
-				mock.Command("LRANGE", tokensListKey, 0, -1).ExpectError(fmt.Errorf("bad-range"))
-				_, e := r.ListTokens(fixtures.deviceID)
-				g.Assert(e.Error()).Equal("bad-range")
+			g.It("errors w/ an invalid last seen time", func() {
+				mock.Command("HGET", registryKey, defs.RedisDeviceLastSeenField).Expect([]byte("garbage"))
+				_, e := r.LastSeen("device-1")
+				g.Assert(e.Error()).Equal(defs.ErrBadRedisResponse)
 			})
 
-			g.It("returns an empty range if no elements were returned", func() {
-				tokensListKey := r.genTokenListKey(fixtures.deviceID)
-				mock.Command("LRANGE", tokensListKey, 0, -1).ExpectSlice()
-				tokens, e := r.ListTokens(fixtures.deviceID)
+			g.It("returns the parsed last seen time", func() {
+				mock.Command("HGET", registryKey, defs.RedisDeviceLastSeenField).Expect([]byte("1500000000"))
+				seen, e := r.LastSeen("device-1")
 				g.Assert(e).Equal(nil)
-				g.Assert(len(tokens)).Equal(0)
+				g.Assert(seen.Unix()).Equal(int64(1500000000))
 			})
+		})
 
-			g.Describe("having returned some raw tokens from the range", func() {
-				g.BeforeEach(func() {
-					tokensListKey := r.genTokenListKey(fixtures.deviceID)
-					mock.Command("LRANGE", tokensListKey, 0, -1).ExpectSlice(
-						[]byte(fixtures.testTokenValue),
-					)
-				})
+		g.Describe("FlagIdleDevice", func() {
+			g.It("dispatches an idle event the first time the device is flagged", func() {
+				events := &fakeEventDispatcher{}
+				r.Events = events
+				defer func() { r.Events = nil }()
+				mock.Command("HSETNX", registryKey, defs.RedisDeviceIdleField, "true").Expect(int64(1))
+				g.Assert(r.FlagIdleDevice("device-1")).Equal(nil)
+				g.Assert(len(events.events)).Equal(1)
+				g.Assert(events.events[0].kind).Equal(defs.WebhookDeviceIdleEvent)
+			})
 
-				g.It("returns no tokens even if errored during lookup", func() {
-					tokenDetailKey := r.genTokenRegistrationKey(fixtures.testTokenValue)
-					mock.Command(
-						"HMGET",
-						tokenDetailKey,
-						tokenFields.id,
-						tokenFields.name,
-						tokenFields.device,
-						tokenFields.permission,
-					).ExpectError(fmt.Errorf("bad-get"))
-					tokens, e := r.ListTokens(fixtures.deviceID)
-					g.Assert(e).Equal(nil)
-					g.Assert(len(tokens)).Equal(0)
-				})
+			g.It("does not dispatch an event for devices that were already flagged", func() {
+				events := &fakeEventDispatcher{}
+				r.Events = events
+				defer func() { r.Events = nil }()
+				mock.Command("HSETNX", registryKey, defs.RedisDeviceIdleField, "true").Expect(int64(0))
+				g.Assert(r.FlagIdleDevice("device-1")).Equal(nil)
+				g.Assert(len(events.events)).Equal(0)
+			})
+		})
+	})
 
-				g.It("skips tokens with invalid permission masks", func() {
-					tokenDetailKey := r.genTokenRegistrationKey(fixtures.testTokenValue)
-					mock.Command(
-						"HMGET",
-						tokenDetailKey,
-						tokenFields.id,
-						tokenFields.name,
-						tokenFields.device,
-						tokenFields.permission,
-					).ExpectSlice(
-						[]byte(fixtures.testTokenID),
-						[]byte(fixtures.testTokenName),
-						[]byte(fixtures.deviceID),
-						[]byte("asdasdas"),
-					)
+	g.Describe("RenameDevice", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
 
-					tokens, e := r.ListTokens(fixtures.deviceID)
-					g.Assert(e).Equal(nil)
-					g.Assert(len(tokens)).Equal(0)
-				})
+		registryKey := r.genRegistryKey("device-1")
 
-				g.It("returns the token details identified by the value returned from the range", func() {
-					tokenDetailKey := r.genTokenRegistrationKey(fixtures.testTokenValue)
-					mock.Command(
-						"HMGET",
-						tokenDetailKey,
-						tokenFields.id,
-						tokenFields.name,
-						tokenFields.device,
-						tokenFields.permission,
-					).ExpectSlice(
-						[]byte(fixtures.testTokenID),
-						[]byte(fixtures.testTokenName),
-						[]byte(fixtures.deviceID),
-						[]byte(fixtures.testTokenPermission),
-					)
+		g.It("errors w/ a name shorter than the minimum w/o touching the registry", func() {
+			e := r.RenameDevice("device-1", strings.Repeat("a", defs.SecurityDeviceNameMinLength-1))
+			g.Assert(e).Equal(defs.Error(defs.ErrInvalidRegistrationRequest))
+			g.Assert(len(mock.history)).Equal(0)
+		})
 
-					tokens, e := r.ListTokens(fixtures.deviceID)
-					g.Assert(e).Equal(nil)
-					g.Assert(len(tokens)).Equal(1)
-				})
-			})
+		g.It("returns not found for unknown devices", func() {
+			mock.Command("EXISTS", registryKey).Expect(int64(0))
+			g.Assert(r.RenameDevice("device-1", "kitchen")).Equal(defs.Error(defs.ErrNotFound))
+		})
 
+		g.It("sets the name field of the device's registry entry", func() {
+			mock.Command("EXISTS", registryKey).Expect(int64(1))
+			set := mock.Command("HSET", registryKey, defs.RedisDeviceNameField, "kitchen").Expect(int64(0))
+			g.Assert(r.RenameDevice("device-1", "kitchen")).Equal(nil)
+			g.Assert(mock.c.Stats(set)).Equal(1)
 		})
 	})
 
-	g.Describe("FindToken", func() {
+	g.Describe("DeviceMeta", func() {
 		r, mock := subject()
 		g.BeforeEach(mock.Clear)
 
-		token := struct {
-			name     string
-			token    string
-			id       string
-			deviceID string
-		}{"testing", "eeeeeeeeeeeeeeeeeeee", "token-id-1", "device-id-1"}
+		registryKey, metaKey := r.genRegistryKey("device-1"), r.genMetaKey("device-1")
 
-		tokenKey := r.genTokenRegistrationKey(token.token)
+		g.Describe("SetDeviceMeta", func() {
+			g.It("errors w/o any metadata", func() {
+				g.Assert(r.SetDeviceMeta("device-1", nil)).Equal(defs.Error(defs.ErrInvalidDeviceMeta))
+			})
 
-		fields := struct {
-			permission string
-		}{defs.RedisDeviceTokenPermissionField}
+			g.It("errors w/ an empty key", func() {
+				e := r.SetDeviceMeta("device-1", map[string]string{"": "kitchen"})
+				g.Assert(e).Equal(defs.Error(defs.ErrInvalidDeviceMeta))
+			})
 
-		g.It("fails fast when unable to get the permission mask", func() {
-			mock.Command("HGET", tokenKey, fields.permission).ExpectError(fmt.Errorf("bad-hget"))
-			_, e := r.FindToken(token.token)
-			g.Assert(e.Error()).Equal("bad-hget")
-		})
+			g.It("errors w/ a key or value past the maximum length", func() {
+				key := strings.Repeat("k", defs.SecurityDeviceMetaKeyMaxLength+1)
+				value := strings.Repeat("v", defs.SecurityDeviceMetaValueMaxLength+1)
+				g.Assert(r.SetDeviceMeta("device-1", map[string]string{key: "v"})).Equal(defs.Error(defs.ErrInvalidDeviceMeta))
+				g.Assert(r.SetDeviceMeta("device-1", map[string]string{"k": value})).Equal(defs.Error(defs.ErrInvalidDeviceMeta))
+				g.Assert(len(mock.history)).Equal(0)
+			})
 
-		g.It("fails fast when unable to parse the permission mask", func() {
-			mock.Command("HGET", tokenKey, fields.permission).Expect([]byte("invalid-mask"))
-			_, e := r.FindToken(token.token)
-			g.Assert(strings.Contains(e.Error(), "invalid syntax")).Equal(true)
-		})
+			g.It("returns not found for unknown devices", func() {
+				mock.Command("EXISTS", registryKey).Expect(int64(0))
+				e := r.SetDeviceMeta("device-1", map[string]string{"location": "kitchen"})
+				g.Assert(e).Equal(defs.Error(defs.ErrNotFound))
+			})
 
-		g.Describe("when successfully able to load token", func() {
-			g.BeforeEach(func() {
-				mock.Command("HGET", tokenKey, fields.permission).Expect([]byte("111"))
+			g.It("writes the metadata onto the metadata hash of the device", func() {
+				mock.Command("EXISTS", registryKey).Expect(int64(1))
+				set := mock.Command("HMSET", metaKey, "location", "kitchen").Expect("OK")
+				g.Assert(r.SetDeviceMeta("device-1", map[string]string{"location": "kitchen"})).Equal(nil)
+				g.Assert(mock.c.Stats(set)).Equal(1)
 			})
 
-			g.It("returns error when hmget lookup fails", func() {
-				mock.Command("HMGET").ExpectError(fmt.Errorf("bad-hmget"))
-				_, e := r.FindToken(token.token)
-				g.Assert(e.Error()).Equal("bad-hmget")
+			g.It("overwrites fields that have already been set", func() {
+				mock.Command("EXISTS", registryKey).Expect(int64(1))
+				first := mock.Command("HMSET", metaKey, "location", "kitchen").Expect("OK")
+				second := mock.Command("HMSET", metaKey, "location", "office").Expect("OK")
+				g.Assert(r.SetDeviceMeta("device-1", map[string]string{"location": "kitchen"})).Equal(nil)
+				g.Assert(r.SetDeviceMeta("device-1", map[string]string{"location": "office"})).Equal(nil)
+				g.Assert(mock.c.Stats(first)).Equal(1)
+				g.Assert(mock.c.Stats(second)).Equal(1)
 			})
+		})
 
-			g.It("successfully returns token details when hmget lookup passes", func() {
-				mock.Command("HMGET").ExpectSlice(
-					[]byte(token.id),
-					[]byte(token.name),
-					[]byte(token.deviceID),
-				)
-				_, e := r.FindToken(token.token)
+		g.Describe("GetDeviceMeta", func() {
+			g.It("errors if unable to load the metadata hash", func() {
+				mock.Command("HGETALL", metaKey).ExpectError(fmt.Errorf("bad-hgetall"))
+				_, e := r.GetDeviceMeta("device-1")
+				g.Assert(e.Error()).Equal("bad-hgetall")
+			})
+
+			g.It("returns the fields of the metadata hash", func() {
+				mock.Command("HGETALL", metaKey).ExpectSlice([]byte("location"), []byte("kitchen"), []byte("model"), []byte("v2"))
+				meta, e := r.GetDeviceMeta("device-1")
 				g.Assert(e).Equal(nil)
+				g.Assert(meta).Equal(map[string]string{"location": "kitchen", "model": "v2"})
+			})
+
+			g.It("returns empty metadata for devices w/o any", func() {
+				mock.Command("HGETALL", metaKey).ExpectSlice()
+				meta, e := r.GetDeviceMeta("device-1")
+				g.Assert(e).Equal(nil)
+				g.Assert(len(meta)).Equal(0)
 			})
 		})
 	})
 
-	g.Describe("AuthorizeToken", func() {
+	g.Describe("DeviceState", func() {
 		r, mock := subject()
+		g.BeforeEach(mock.Clear)
 
-		fields := struct {
-			permission string
-			deviceID   string
-			id         string
-			name       string
-		}{
-			defs.RedisDeviceTokenPermissionField,
-			defs.RedisDeviceTokenDeviceIDField,
-			defs.RedisDeviceTokenIDField,
-			defs.RedisDeviceTokenNameField,
+		stateKey := r.genStateKey("device-1")
+		fields := []interface{}{
+			stateKey,
+			defs.RedisDeviceStateRedField,
+			defs.RedisDeviceStateGreenField,
+			defs.RedisDeviceStateBlueField,
+			defs.RedisDeviceStateUpdatedField,
 		}
 
-		device := struct {
-			name   string
-			id     string
-			token  string
-			secret string
-		}{"test-device", "id-123", "4242424242", "421421421421421421421421"}
+		g.Describe("SetDeviceState", func() {
+			g.It("writes the color of the frame onto the state hash of the device", func() {
+				set := mock.Command(
+					"HMSET",
+					stateKey,
+					defs.RedisDeviceStateRedField, "255",
+					defs.RedisDeviceStateGreenField, "128",
+					defs.RedisDeviceStateBlueField, "0",
+					defs.RedisDeviceStateUpdatedField, redigomock.NewAnyData(),
+				).Expect("OK")
+				g.Assert(r.SetDeviceState("device-1", interchange.ControlFrame{Red: 255, Green: 128})).Equal(nil)
+				g.Assert(mock.c.Stats(set)).Equal(1)
+			})
 
-		registryKey := r.genRegistryKey(device.id)
+			g.It("overwrites the previous state w/ each new frame", func() {
+				first := mock.Command(
+					"HMSET",
+					stateKey,
+					defs.RedisDeviceStateRedField, "255",
+					defs.RedisDeviceStateGreenField, "0",
+					defs.RedisDeviceStateBlueField, "0",
+					defs.RedisDeviceStateUpdatedField, redigomock.NewAnyData(),
+				).Expect("OK")
+				second := mock.Command(
+					"HMSET",
+					stateKey,
+					defs.RedisDeviceStateRedField, "0",
+					defs.RedisDeviceStateGreenField, "0",
+					defs.RedisDeviceStateBlueField, "255",
+					defs.RedisDeviceStateUpdatedField, redigomock.NewAnyData(),
+				).Expect("OK")
+				g.Assert(r.SetDeviceState("device-1", interchange.ControlFrame{Red: 255})).Equal(nil)
+				g.Assert(r.SetDeviceState("device-1", interchange.ControlFrame{Blue: 255})).Equal(nil)
+				g.Assert(mock.c.Stats(first)).Equal(1)
+				g.Assert(mock.c.Stats(second)).Equal(1)
+			})
+
+			g.It("errors if unable to write the state hash", func() {
+				mock.c.GenericCommand("HMSET").ExpectError(fmt.Errorf("bad-hmset"))
+				g.Assert(r.SetDeviceState("device-1", interchange.ControlFrame{}).Error()).Equal("bad-hmset")
+			})
+		})
+
+		g.Describe("GetDeviceState", func() {
+			g.It("returns not found if no state has been recorded", func() {
+				mock.Command("EXISTS", stateKey).Expect(int64(0))
+				_, e := r.GetDeviceState("device-1")
+				g.Assert(e).Equal(defs.Error(defs.ErrNotFound))
+			})
+
+			g.It("errors if unable to check for the state hash", func() {
+				mock.Command("EXISTS", stateKey).ExpectError(fmt.Errorf("bad-exists"))
+				_, e := r.GetDeviceState("device-1")
+				g.Assert(e.Error()).Equal("bad-exists")
+			})
+
+			g.It("errors w/ an invalid color value", func() {
+				mock.Command("EXISTS", stateKey).Expect(int64(1))
+				mock.Command("HMGET", fields...).ExpectSlice([]byte("red"), []byte("0"), []byte("0"), []byte("1500000000"))
+				_, e := r.GetDeviceState("device-1")
+				g.Assert(e).Equal(defs.Error(defs.ErrBadRedisResponse))
+			})
+
+			g.It("returns the recorded state", func() {
+				mock.Command("EXISTS", stateKey).Expect(int64(1))
+				mock.Command("HMGET", fields...).ExpectSlice([]byte("255"), []byte("128"), []byte("0"), []byte("1500000000"))
+				state, e := r.GetDeviceState("device-1")
+				g.Assert(e).Equal(nil)
+				g.Assert([]uint32{state.Red, state.Green, state.Blue}).Equal([]uint32{255, 128, 0})
+				g.Assert(state.UpdatedAt.Unix()).Equal(int64(1500000000))
+			})
+		})
+	})
 
+	g.Describe("DeviceFirmware", func() {
+		r, mock := subject()
 		g.BeforeEach(mock.Clear)
 
 		g.AfterEach(func() {
 			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
 		})
 
-		g.It("returns false if unable to find device", func() {
-			mock.Command("EXISTS", registryKey).ExpectError(fmt.Errorf("bad-exists"))
-			b := r.AuthorizeToken(device.id, device.token, 1)
-			g.Assert(b).Equal(false)
+		firmware := func(id string) *redigomock.Cmd {
+			return mock.Command("HGET", r.genRegistryKey(id), defs.RedisDeviceFirmwareField)
+		}
+
+		g.Describe("GetDeviceFirmware", func() {
+			g.It("returns the reported firmware version", func() {
+				firmware("device-1").Expect([]byte("1.2.0"))
+				version, e := r.GetDeviceFirmware("device-1")
+				g.Assert(e).Equal(nil)
+				g.Assert(version).Equal("1.2.0")
+			})
+
+			g.It("defaults to the unknown version for devices that never reported one", func() {
+				firmware("device-1").Expect(nil)
+				version, e := r.GetDeviceFirmware("device-1")
+				g.Assert(e).Equal(nil)
+				g.Assert(version).Equal(defs.DefaultFirmwareVersion)
+			})
+
+			g.It("errors if unable to read the registry hash", func() {
+				firmware("device-1").ExpectError(fmt.Errorf("bad-hget"))
+				_, e := r.GetDeviceFirmware("device-1")
+				g.Assert(e.Error()).Equal("bad-hget")
+			})
 		})
 
-		g.Describe("having found a device via EXISTS", func() {
+		g.Describe("ListDevicesByFirmware", func() {
 			g.BeforeEach(func() {
-				mock.Command("EXISTS", registryKey).Expect([]byte("true"))
+				mock.Command("LRANGE", r.genDeviceIndexKey(), 0, -1).ExpectSlice(
+					[]byte("device-1"),
+					[]byte("device-2"),
+					[]byte("device-3"),
+				)
 			})
 
-			g.It("should return true if token matches device secret", func() {
-				mock.Command("HMGET", registryKey, "device:uuid", "device:name", "device:secret").ExpectSlice(
-					[]byte(device.id),
-					[]byte(device.name),
-					[]byte(device.secret),
+			loaded := func(id string) {
+				mock.Command("HMGET", r.genRegistryKey(id), deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+					[]byte(id),
+					[]byte(id+"-name"),
+					[]byte(id+"-secret"),
 				)
-				b := r.AuthorizeToken(device.id, device.secret, 1)
-				g.Assert(b).Equal(true)
+			}
+
+			g.It("returns only the devices that reported exactly the version", func() {
+				firmware("device-1").Expect([]byte("1.2.0"))
+				firmware("device-2").Expect([]byte("1.2.0-beta"))
+				firmware("device-3").Expect([]byte("1.2.0"))
+				loaded("device-1")
+				loaded("device-3")
+				results, e := r.ListDevicesByFirmware("1.2.0")
+				g.Assert(e).Equal(nil)
+				g.Assert([]string{results[0].DeviceID, results[1].DeviceID}).Equal([]string{"device-1", "device-3"})
 			})
 
-			g.It("should not return true if unable to load in token details", func() {
-				mock.Command("HMGET", registryKey, "device:uuid", "device:name", "device:secret").ExpectSlice(
-					[]byte(device.id),
-					[]byte(device.name),
-					[]byte(device.secret),
+			g.It("matches devices that never reported a version w/ the unknown version", func() {
+				firmware("device-1").Expect([]byte("1.2.0"))
+				firmware("device-2").Expect(nil)
+				firmware("device-3").Expect([]byte("1.2.0"))
+				loaded("device-2")
+				results, e := r.ListDevicesByFirmware(defs.DefaultFirmwareVersion)
+				g.Assert(e).Equal(nil)
+				g.Assert(len(results)).Equal(1)
+				g.Assert(results[0].DeviceID).Equal("device-2")
+			})
+
+			g.It("returns an empty list when no device matches", func() {
+				firmware("device-1").Expect([]byte("1.2.0"))
+				firmware("device-2").Expect([]byte("1.2.0"))
+				firmware("device-3").Expect([]byte("1.2.0"))
+				results, e := r.ListDevicesByFirmware("2.0.0")
+				g.Assert(e).Equal(nil)
+				g.Assert(len(results)).Equal(0)
+			})
+
+			g.It("errors if unable to read the firmware of a device", func() {
+				firmware("device-1").ExpectError(fmt.Errorf("bad-hget"))
+				_, e := r.ListDevicesByFirmware("1.2.0")
+				g.Assert(e.Error()).Equal("bad-hget")
+			})
+		})
+	})
+
+	g.Describe("DeviceTags", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		g.AfterEach(func() {
+			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
+		})
+
+		device := RegistrationDetails{Name: "some-device", DeviceID: "device-1", SharedSecret: "secret"}
+
+		found := func() {
+			mock.Command("EXISTS", r.genRegistryKey(device.DeviceID)).Expect([]byte("true"))
+			mock.Command("HMGET", r.genRegistryKey(device.DeviceID), "device:uuid", "device:name", "device:secret").ExpectSlice(
+				[]byte(device.DeviceID),
+				[]byte(device.Name),
+				[]byte(device.SharedSecret),
+			)
+		}
+
+		g.Describe("AddDeviceTag", func() {
+			g.It("errors with an invalid tag", func() {
+				_, e := r.AddDeviceTag(device.DeviceID, "Not A Tag")
+				g.Assert(e == defs.Error(defs.ErrInvalidDeviceTag)).Equal(true)
+			})
+
+			g.It("errors if unable to find the device", func() {
+				_, e := r.AddDeviceTag(device.DeviceID, "kitchen")
+				g.Assert(e != nil).Equal(true)
+			})
+
+			g.It("errors if unable to add the device to the tag set", func() {
+				found()
+				mock.Command("SADD", r.genTagKey("kitchen"), device.DeviceID).ExpectError(fmt.Errorf("bad-sadd"))
+				_, e := r.AddDeviceTag(device.DeviceID, "kitchen")
+				g.Assert(e.Error()).Equal("bad-sadd")
+			})
+
+			g.It("adds the device to the tag set and the tag to the device's set", func() {
+				found()
+				tag := mock.Command("SADD", r.genTagKey("kitchen"), device.DeviceID).Expect(int64(1))
+				list := mock.Command("SADD", r.genTagListKey(device.DeviceID), "kitchen").Expect(int64(1))
+				added, e := r.AddDeviceTag(device.DeviceID, "kitchen")
+				g.Assert(e).Equal(nil)
+				g.Assert(added).Equal(true)
+				g.Assert(mock.c.Stats(tag)).Equal(1)
+				g.Assert(mock.c.Stats(list)).Equal(1)
+			})
+
+			g.It("reports devices that already had the tag as not newly tagged", func() {
+				found()
+				mock.Command("SADD", r.genTagKey("kitchen"), device.DeviceID).Expect(int64(0))
+				mock.Command("SADD", r.genTagListKey(device.DeviceID), "kitchen").Expect(int64(0))
+				added, e := r.AddDeviceTag(device.DeviceID, "kitchen")
+				g.Assert(e).Equal(nil)
+				g.Assert(added).Equal(false)
+			})
+		})
+
+		g.Describe("RemoveDeviceTag", func() {
+			g.It("errors if unable to remove the device from the tag set", func() {
+				mock.Command("SREM", r.genTagKey("kitchen"), device.DeviceID).ExpectError(fmt.Errorf("bad-srem"))
+				g.Assert(r.RemoveDeviceTag(device.DeviceID, "kitchen").Error()).Equal("bad-srem")
+			})
+
+			g.It("removes the device from the tag set and the tag from the device's set", func() {
+				tag := mock.Command("SREM", r.genTagKey("kitchen"), device.DeviceID).Expect(int64(1))
+				list := mock.Command("SREM", r.genTagListKey(device.DeviceID), "kitchen").Expect(int64(1))
+				g.Assert(r.RemoveDeviceTag(device.DeviceID, "kitchen")).Equal(nil)
+				g.Assert(mock.c.Stats(tag)).Equal(1)
+				g.Assert(mock.c.Stats(list)).Equal(1)
+			})
+		})
+
+		g.Describe("ListDevicesByTag", func() {
+			g.It("errors if unable to load the members of the tag set", func() {
+				mock.Command("SMEMBERS", r.genTagKey("kitchen")).ExpectError(fmt.Errorf("bad-smembers"))
+				_, e := r.ListDevicesByTag("kitchen")
+				g.Assert(e.Error()).Equal("bad-smembers")
+			})
+
+			g.It("returns the details of each tagged device, skipping those unable to be loaded", func() {
+				mock.Command("SMEMBERS", r.genTagKey("kitchen")).ExpectSlice([]byte(device.DeviceID), []byte("stale"))
+				mock.Command("HMGET", r.genRegistryKey(device.DeviceID), "device:uuid", "device:name", "device:secret").ExpectSlice(
+					[]byte(device.DeviceID),
+					[]byte(device.Name),
+					[]byte(device.SharedSecret),
 				)
-				mock.Command("HGET", r.genTokenRegistrationKey(device.token), fields.permission).ExpectError(fmt.Errorf(""))
-				b := r.AuthorizeToken(device.id, device.token, 1)
-				g.Assert(b).Equal(false)
+				mock.Command("HMGET", r.genRegistryKey("stale"), "device:uuid", "device:name", "device:secret").ExpectError(
+					fmt.Errorf("bad-hmget"),
+				)
+				results, e := r.ListDevicesByTag("kitchen")
+				g.Assert(e).Equal(nil)
+				g.Assert(len(results)).Equal(1)
+				g.Assert(results[0].Name).Equal(device.Name)
 			})
+		})
+	})
 
-			g.Describe("with valid device + token information loaded", func() {
-				tokenKey := r.genTokenRegistrationKey(device.token)
+	g.Describe("AuditLog", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
 
-				g.BeforeEach(func() {
-					mock.Command("HMGET", registryKey, "device:uuid", "device:name", "device:secret").ExpectSlice(
-						[]byte(device.id),
-						[]byte(device.name),
-						[]byte(device.secret),
-					)
-					mock.Command("HMGET", tokenKey, fields.id, fields.name, fields.deviceID).ExpectSlice(
-						[]byte(device.id),
-						[]byte(device.name),
-						[]byte(device.id),
-					)
-				})
+		g.AfterEach(func() {
+			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
+		})
 
-				invalid := [][]string{
-					[]string{"100", "011"},
-					[]string{"100", "001"},
-					[]string{"100", "010"},
-					[]string{"100", "111"},
-					[]string{"010", "101"},
-					[]string{"010", "100"},
-					[]string{"010", "001"},
-					[]string{"010", "111"},
-					[]string{"001", "110"},
-					[]string{"001", "010"},
-					[]string{"001", "100"},
-					[]string{"001", "111"},
-				}
+		entry := AuditEntry{
+			Action:    defs.AuditTokenCreatedAction,
+			DeviceID:  "device-1",
+			TokenID:   "token-1",
+			ActorID:   "actor-1",
+			Timestamp: time.Unix(1500000000, 0).UTC(),
+		}
 
-				valid := [][]string{
-					[]string{"1100", "100"},
-					[]string{"1010", "010"},
-					[]string{"1001", "001"},
-				}
+		serialized := `{"action":"token-created","device_id":"device-1","token_id":"token-1",` +
+			`"actor_id":"actor-1","ts":"2017-07-14T02:40:00Z"}`
 
-				for _, masks := range invalid {
-					have, want := masks[0], masks[1]
-					g.It(fmt.Sprintf("should not return true if the token mask is invalid (%s vs %s)", have, want), func() {
-						mock.Command("HGET", tokenKey, fields.permission).Expect([]byte(have))
-						b := r.AuthorizeToken(device.id, device.token, mask(want))
-						g.Assert(b).Equal(false)
-					})
-				}
+		g.Describe("RecordAudit", func() {
+			g.It("errors if unable to queue the push onto the audit log", func() {
+				mock.Command("MULTI").Expect("OK")
+				mock.Command("LPUSH", defs.RedisAuditLogKey, serialized).ExpectError(fmt.Errorf("bad-lpush"))
+				g.Assert(r.RecordAudit(entry).Error()).Equal("bad-lpush")
+			})
 
-				for _, masks := range valid {
-					have, want := masks[0], masks[1]
-					g.It(fmt.Sprintf("should return true if the token mask is valid (%s vs %s)", have, want), func() {
-						mock.Command("HGET", tokenKey, fields.permission).Expect([]byte(have))
-						b := r.AuthorizeToken(device.id, device.token, mask(want))
-						g.Assert(b).Equal(true)
-					})
+			g.It("pushes the serialized entry and trims the audit log in a single transaction", func() {
+				mock.Command("MULTI").Expect("OK")
+				push := mock.Command("LPUSH", defs.RedisAuditLogKey, serialized).Expect("QUEUED")
+				trim := mock.Command("LTRIM", defs.RedisAuditLogKey, 0, defs.RedisMaxAuditEntries-1).Expect("QUEUED")
+				mock.Command("EXEC").ExpectSlice(int64(1), "OK")
+				g.Assert(r.RecordAudit(entry)).Equal(nil)
+				g.Assert(mock.c.Stats(push)).Equal(1)
+				g.Assert(mock.c.Stats(trim)).Equal(1)
+				g.Assert(mock.history).Equal([]string{"MULTI", "LPUSH", "LTRIM", "EXEC"})
+			})
+
+			g.It("errors if the transaction fails", func() {
+				mock.Command("MULTI").Expect("OK")
+				mock.Command("LPUSH", defs.RedisAuditLogKey, serialized).Expect("QUEUED")
+				mock.Command("LTRIM", defs.RedisAuditLogKey, 0, defs.RedisMaxAuditEntries-1).Expect("QUEUED")
+				mock.Command("EXEC").ExpectError(fmt.Errorf("bad-exec"))
+				g.Assert(r.RecordAudit(entry).Error()).Equal("bad-exec")
+			})
+		})
+
+		g.Describe("ListAuditLog", func() {
+			g.It("errors if unable to load the audit log", func() {
+				mock.Command("LRANGE", defs.RedisAuditLogKey, 0, 9).ExpectError(fmt.Errorf("bad-lrange"))
+				_, e := r.ListAuditLog(10)
+				g.Assert(e.Error()).Equal("bad-lrange")
+			})
+
+			g.It("returns the parsed entries, skipping invalid ones", func() {
+				mock.Command("LRANGE", defs.RedisAuditLogKey, 0, 9).ExpectSlice([]byte(serialized), []byte("}{"))
+				entries, e := r.ListAuditLog(10)
+				g.Assert(e).Equal(nil)
+				g.Assert(len(entries)).Equal(1)
+				g.Assert(entries[0].ActorID).Equal("actor-1")
+				g.Assert(entries[0].Timestamp.Equal(entry.Timestamp)).Equal(true)
+			})
+		})
+	})
+
+	g.Describe("CommandHistory", func() {
+		r, mock := subject()
+
+		g.BeforeEach(func() {
+			mock.Clear()
+			r.MaxCommandHistory = 3
+		})
+
+		historyKey := r.genCommandHistoryKey("device-1")
+
+		g.Describe("RecordCommand", func() {
+			// transaction mocks the replies to the multi and queued commands of each push, returning the exec.
+			transaction := func() *redigomock.Cmd {
+				mock.Command("MULTI").Expect("OK")
+				mock.Command("LPUSH", historyKey, redigomock.NewAnyData()).Expect("QUEUED")
+				mock.Command("LTRIM", historyKey, 0, 2).Expect("QUEUED")
+				return mock.Command("EXEC").ExpectSlice(int64(1), "OK")
+			}
+
+			g.It("errors if unable to queue the push onto the command history", func() {
+				mock.Command("MULTI").Expect("OK")
+				mock.Command("LPUSH", historyKey, redigomock.NewAnyData()).ExpectError(fmt.Errorf("bad-lpush"))
+				g.Assert(r.RecordCommand("device-1", CommandHistoryEntry{}).Error()).Equal("bad-lpush")
+			})
+
+			g.It("pushes each command onto the front of the history in the order they were sent", func() {
+				pushed := make([]*redigomock.Cmd, 0, 2)
+
+				for _, id := range []string{"command-1", "command-2"} {
+					entry, _ := json.Marshal(CommandHistoryEntry{CommandID: id, Timestamp: time.Unix(1500000000, 0)})
+					pushed = append(pushed, mock.Command("LPUSH", historyKey, string(entry)).Expect("QUEUED"))
 				}
+
+				transaction()
+
+				first := CommandHistoryEntry{CommandID: "command-1", Timestamp: time.Unix(1500000000, 0)}
+				second := CommandHistoryEntry{CommandID: "command-2", Timestamp: time.Unix(1500000000, 0)}
+				g.Assert(r.RecordCommand("device-1", first)).Equal(nil)
+				g.Assert(r.RecordCommand("device-1", second)).Equal(nil)
+				g.Assert(mock.c.Stats(pushed[0])).Equal(1)
+				g.Assert(mock.c.Stats(pushed[1])).Equal(1)
+				g.Assert(mock.history).Equal([]string{
+					"MULTI", "LPUSH", "LTRIM", "EXEC",
+					"MULTI", "LPUSH", "LTRIM", "EXEC",
+				})
+			})
+
+			g.It("stamps entries that were not given a time", func() {
+				capture := &commandHistoryCapture{}
+				mock.Command("LPUSH", historyKey, capture).Expect("QUEUED")
+				transaction()
+				before := time.Now().Add(-time.Second)
+				g.Assert(r.RecordCommand("device-1", CommandHistoryEntry{CommandID: "command-1"})).Equal(nil)
+				g.Assert(capture.entry == nil).Equal(false)
+				g.Assert(capture.entry.CommandID).Equal("command-1")
+				g.Assert(capture.entry.Timestamp.After(before)).Equal(true)
+			})
+
+			g.It("trims the history down to the configured size after every push", func() {
+				exec := transaction()
+				g.Assert(r.RecordCommand("device-1", CommandHistoryEntry{CommandID: "command-4"})).Equal(nil)
+				g.Assert(mock.c.Stats(exec)).Equal(1)
+			})
+
+			g.It("keeps only the newest command when configured w/ a size of one", func() {
+				r.MaxCommandHistory = 1
+				mock.Command("MULTI").Expect("OK")
+				mock.Command("LPUSH", historyKey, redigomock.NewAnyData()).Expect("QUEUED")
+				trim := mock.Command("LTRIM", historyKey, 0, 0).Expect("QUEUED")
+				mock.Command("EXEC").ExpectSlice(int64(2), "OK")
+				g.Assert(r.RecordCommand("device-1", CommandHistoryEntry{})).Equal(nil)
+				g.Assert(mock.c.Stats(trim)).Equal(1)
+			})
+
+			g.It("falls back to the default size when not configured", func() {
+				r.MaxCommandHistory = 0
+				mock.Command("MULTI").Expect("OK")
+				mock.Command("LPUSH", historyKey, redigomock.NewAnyData()).Expect("QUEUED")
+				trim := mock.Command("LTRIM", historyKey, 0, defs.DefaultMaxCommandHistory-1).Expect("QUEUED")
+				mock.Command("EXEC").ExpectSlice(int64(1), "OK")
+				g.Assert(r.RecordCommand("device-1", CommandHistoryEntry{})).Equal(nil)
+				g.Assert(mock.c.Stats(trim)).Equal(1)
+			})
+
+			g.It("errors if the transaction fails", func() {
+				mock.Command("MULTI").Expect("OK")
+				mock.Command("LPUSH", historyKey, redigomock.NewAnyData()).Expect("QUEUED")
+				mock.Command("LTRIM", historyKey, 0, 2).Expect("QUEUED")
+				mock.Command("EXEC").ExpectSlice(int64(1), redis.Error("WRONGTYPE bad-trim"))
+				g.Assert(r.RecordCommand("device-1", CommandHistoryEntry{}).Error()).Equal("WRONGTYPE bad-trim")
+			})
+		})
+
+		g.Describe("ListCommandHistory", func() {
+			g.It("errors if unable to load the command history", func() {
+				mock.Command("LRANGE", historyKey, 0, 9).ExpectError(fmt.Errorf("bad-lrange"))
+				_, e := r.ListCommandHistory("device-1", 10)
+				g.Assert(e.Error()).Equal("bad-lrange")
+			})
+
+			g.It("returns the parsed entries newest first, skipping invalid ones", func() {
+				newest, _ := json.Marshal(CommandHistoryEntry{CommandID: "command-2", Red: 255, TokenID: "token-1"})
+				oldest, _ := json.Marshal(CommandHistoryEntry{CommandID: "command-1", Blue: 255})
+				mock.Command("LRANGE", historyKey, 0, 9).ExpectSlice(newest, []byte("}{"), oldest)
+				entries, e := r.ListCommandHistory("device-1", 10)
+				g.Assert(e).Equal(nil)
+				g.Assert([]string{entries[0].CommandID, entries[1].CommandID}).Equal([]string{"command-2", "command-1"})
+				g.Assert(entries[0].Red).Equal(uint32(255))
+				g.Assert(entries[0].TokenID).Equal("token-1")
 			})
 		})
 	})
 
-	g.Describe("CreateToken", func() {
+	g.Describe("ConnectionEvents", func() {
 		r, mock := subject()
 
-		g.BeforeEach(mock.Clear)
+		g.BeforeEach(func() {
+			mock.Clear()
+		})
 
-		testFixtures := struct {
-			deviceID        string
-			deviceName      string
-			deviceSecret    string
-			tokenName       string
-			tokenSecret     string
-			tokenPermission uint
-		}{"device-id", "a test device", "the device secret", "a test token", "token-secret", 7}
+		eventsKey := r.genConnEventsKey("device-1")
+
+		g.Describe("RecordConnectionEvent", func() {
+			transaction := func() *redigomock.Cmd {
+				mock.Command("MULTI").Expect("OK")
+				mock.Command("LPUSH", eventsKey, redigomock.NewAnyData()).Expect("QUEUED")
+				mock.Command("LTRIM", eventsKey, 0, defs.RedisMaxConnEventEntries-1).Expect("QUEUED")
+				return mock.Command("EXEC").ExpectSlice(int64(1), "OK")
+			}
+
+			g.It("errors if unable to queue the push onto the connection events", func() {
+				mock.Command("MULTI").Expect("OK")
+				mock.Command("LPUSH", eventsKey, redigomock.NewAnyData()).ExpectError(fmt.Errorf("bad-lpush"))
+				g.Assert(r.RecordConnectionEvent("device-1", ConnectionEvent{}).Error()).Equal("bad-lpush")
+			})
+
+			g.It("pushes the event onto the front of the list and trims it to capacity in a single transaction", func() {
+				event := ConnectionEvent{Type: defs.ConnectionEventConnected, Timestamp: time.Unix(1500000000, 0)}
+				entry, _ := json.Marshal(event)
+				push := mock.Command("LPUSH", eventsKey, string(entry)).Expect("QUEUED")
+				exec := transaction()
+				g.Assert(r.RecordConnectionEvent("device-1", event)).Equal(nil)
+				g.Assert(mock.c.Stats(push)).Equal(1)
+				g.Assert(mock.c.Stats(exec)).Equal(1)
+				g.Assert(mock.history).Equal([]string{"MULTI", "LPUSH", "LTRIM", "EXEC"})
+			})
+
+			g.It("errors if the transaction fails", func() {
+				mock.Command("MULTI").Expect("OK")
+				mock.Command("LPUSH", eventsKey, redigomock.NewAnyData()).Expect("QUEUED")
+				mock.Command("LTRIM", eventsKey, 0, defs.RedisMaxConnEventEntries-1).Expect("QUEUED")
+				mock.Command("EXEC").ExpectError(fmt.Errorf("bad-exec"))
+				g.Assert(r.RecordConnectionEvent("device-1", ConnectionEvent{}).Error()).Equal("bad-exec")
+			})
+		})
+
+		g.Describe("ListConnectionEvents", func() {
+			g.It("errors if unable to load the connection events", func() {
+				mock.Command("LRANGE", eventsKey, 0, 9).ExpectError(fmt.Errorf("bad-lrange"))
+				_, e := r.ListConnectionEvents("device-1", 10)
+				g.Assert(e.Error()).Equal("bad-lrange")
+			})
+
+			g.It("returns the parsed events newest first, skipping invalid ones", func() {
+				newest, _ := json.Marshal(ConnectionEvent{Type: defs.ConnectionEventDisconnected})
+				oldest, _ := json.Marshal(ConnectionEvent{Type: defs.ConnectionEventConnected})
+				mock.Command("LRANGE", eventsKey, 0, 9).ExpectSlice(newest, []byte("}{"), oldest)
+				events, e := r.ListConnectionEvents("device-1", 10)
+				g.Assert(e).Equal(nil)
+				g.Assert(len(events)).Equal(2)
+				g.Assert(events[0].Type).Equal(defs.ConnectionEventDisconnected)
+				g.Assert(events[1].Type).Equal(defs.ConnectionEventConnected)
+			})
+		})
+	})
+
+	g.Describe("Namespace", func() {
+		r, mock := subject()
+
+		g.BeforeEach(func() {
+			mock.Clear()
+			r.Namespace = ""
+		})
+
+		g.It("preserves the existing keys when empty", func() {
+			g.Assert(r.genRegistryKey("device-1")).Equal(defs.RedisDeviceRegistryKey + ":device-1")
+			g.Assert(r.genFeedbackKey("device-1")).Equal(defs.RedisDeviceFeedbackKey + ":device-1")
+			g.Assert(r.genAllocationKey("request-1")).Equal(defs.RedisRegistrationRequestListKey + ":request-1")
+			g.Assert(r.genTokenListKey("device-1")).Equal(defs.RedisDeviceTokenListKey + ":device-1")
+			g.Assert(r.genTokenRegistrationKey("token-1")).Equal(defs.RedisDeviceTokenRegistrationKey + ":token-1")
+			g.Assert(r.genTagKey("kitchen")).Equal(defs.RedisDeviceTagKey + ":kitchen")
+			g.Assert(r.genTagListKey("device-1")).Equal(defs.RedisDeviceTagListKey + ":device-1")
+			g.Assert(r.genCommandKey("command-1")).Equal(defs.RedisDeviceCommandKey + ":command-1")
+			g.Assert(r.genDeviceIndexKey()).Equal(defs.RedisDeviceIndexKey)
+			g.Assert(r.genAuditLogKey()).Equal(defs.RedisAuditLogKey)
+		})
+
+		g.It("sends the existing keys to redis when empty", func() {
+			r.TouchDevice("device-1")
+			r.ListRegistrations()
+			r.ListAuditLog(10)
+			r.FillRegistration("secret", "device-1")
+			g.Assert(mock.keys).Equal([]string{
+				defs.RedisDeviceRegistryKey + ":device-1",
+				defs.RedisDeviceIndexKey,
+				defs.RedisAuditLogKey,
+				defs.RedisRegistrationRequestListKey + "*",
+			})
+		})
+
+		g.It("prefixes the key of every command w/ the namespace", func() {
+			r.Namespace = "staging"
+			r.FindDevice("device-1")
+			r.FindDeviceByID("device-1")
+			r.ListFeedback("device-1", 10)
+			r.FillRegistration("secret", "device-1")
+			r.ListTokens("device-1")
+			r.FindToken("token-1")
+			r.ListRegistrations()
+			r.RemoveDevice("device-1")
+			r.TouchDevice("device-1")
+			r.LastSeen("device-1")
+			r.FlagIdleDevice("device-1")
+			r.TrackCommand("command-1", "device-1")
+			r.UpdateCommandStatus("command-1", "device-1", defs.CommandStatusAcknowledged)
+			r.GetCommandStatus("command-1")
+			r.AddDeviceTag("device-1", "kitchen")
+			r.RemoveDeviceTag("device-1", "kitchen")
+			r.ListDevicesByTag("kitchen")
+			r.RecordAudit(AuditEntry{Action: defs.AuditTokenCreatedAction})
+			r.ListAuditLog(10)
+
+			g.Assert(len(mock.keys) > 0).Equal(true)
+
+			for _, key := range mock.keys {
+				g.Assert(strings.HasPrefix(key, "staging:")).Equal(true)
+			}
+		})
+	})
+
+	g.Describe("DeviceLock", func() {
+		r, mock := subject()
+		r.LockTTL = time.Second
+		g.BeforeEach(mock.Clear)
+
+		lockKey, registryKey := r.genLockKey("device-1"), r.genRegistryKey("device-1")
+		ttl := int64(time.Second / time.Millisecond)
+
+		g.It("fails the mutation w/o touching the registry while another mutation holds the lock", func() {
+			mock.Command("SET", lockKey, redigomock.NewAnyData(), "NX", "PX", ttl).Expect(nil)
+			g.Assert(r.RenameDevice("device-1", "kitchen")).Equal(defs.Error(defs.ErrDeviceLocked))
+			meta := map[string]string{"location": "kitchen"}
+			g.Assert(r.SetDeviceMeta("device-1", meta)).Equal(defs.Error(defs.ErrDeviceLocked))
+			g.Assert(r.RemoveDevice("device-1")).Equal(defs.Error(defs.ErrDeviceLocked))
+			g.Assert(mock.history).Equal([]string{"SET", "SET", "SET"})
+		})
+
+		g.It("runs the mutation once the lock has been released", func() {
+			mock.Command("SET", lockKey, redigomock.NewAnyData(), "NX", "PX", ttl).Expect(nil).Expect("OK")
+			mock.Command("EXISTS", registryKey).Expect(int64(1))
+			rename := mock.Command("HSET", registryKey, defs.RedisDeviceNameField, "kitchen").Expect(int64(0))
+			mock.Command("EVALSHA", releaseLockScript.sha, 1, lockKey, redigomock.NewAnyData()).Expect(int64(1))
+			g.Assert(r.RenameDevice("device-1", "kitchen")).Equal(defs.Error(defs.ErrDeviceLocked))
+			g.Assert(mock.c.Stats(rename)).Equal(0)
+			g.Assert(r.RenameDevice("device-1", "kitchen")).Equal(nil)
+			g.Assert(mock.c.Stats(rename)).Equal(1)
+			g.Assert(mock.history).Equal([]string{"SET", "SET", "EXISTS", "HSET", "EVALSHA"})
+		})
+
+		g.It("releases the lock w/ the token it was acquired w/, even when the mutation fails", func() {
+			acquired, released := &lockTokenCapture{}, &lockTokenCapture{}
+			mock.Command("SET", lockKey, acquired, "NX", "PX", ttl).Expect("OK")
+			mock.Command("EXISTS", registryKey).Expect(int64(0))
+			mock.Command("EVALSHA", releaseLockScript.sha, 1, lockKey, released).Expect(int64(1))
+			g.Assert(r.RenameDevice("device-1", "kitchen")).Equal(defs.Error(defs.ErrNotFound))
+			g.Assert(len(acquired.tokens)).Equal(1)
+			g.Assert(released.tokens).Equal(acquired.tokens)
+		})
+
+		g.It("uses a new token for each acquisition", func() {
+			acquired := &lockTokenCapture{}
+			mock.Command("SET", lockKey, acquired, "NX", "PX", ttl).Expect("OK")
+			mock.Command("EXISTS", registryKey).Expect(int64(0))
+			mock.Command("EVALSHA", releaseLockScript.sha, 1, lockKey, redigomock.NewAnyData()).Expect(int64(1))
+			r.RenameDevice("device-1", "kitchen")
+			r.RenameDevice("device-1", "kitchen")
+			g.Assert(len(acquired.tokens)).Equal(2)
+			g.Assert(acquired.tokens[0] == acquired.tokens[1]).Equal(false)
+		})
+
+		g.It("errors w/o running the mutation if unable to acquire the lock", func() {
+			mock.Command("SET", lockKey, redigomock.NewAnyData(), "NX", "PX", ttl).ExpectError(fmt.Errorf("bad-set"))
+			g.Assert(r.RenameDevice("device-1", "kitchen").Error()).Equal("bad-set")
+			g.Assert(mock.history).Equal([]string{"SET"})
+		})
+
+		g.Describe("w/ a lock wait", func() {
+			g.BeforeEach(func() {
+				r.LockWait = time.Second
+			})
+
+			g.AfterEach(func() {
+				r.LockWait = 0
+			})
+
+			g.It("retries taking the lock until the mutation holding it releases it", func() {
+				mock.Command("SET", lockKey, redigomock.NewAnyData(), "NX", "PX", ttl).Expect(nil).Expect(nil).Expect("OK")
+				mock.Command("EXISTS", registryKey).Expect(int64(1))
+				rename := mock.Command("HSET", registryKey, defs.RedisDeviceNameField, "kitchen").Expect(int64(0))
+				mock.Command("EVALSHA", releaseLockScript.sha, 1, lockKey, redigomock.NewAnyData()).Expect(int64(1))
+				g.Assert(r.RenameDevice("device-1", "kitchen")).Equal(nil)
+				g.Assert(mock.c.Stats(rename)).Equal(1)
+				g.Assert(mock.history).Equal([]string{"SET", "SET", "SET", "EXISTS", "HSET", "EVALSHA"})
+			})
+
+			g.It("fails w/ the device locked error once the lock wait has passed", func() {
+				r.LockWait = defs.DeviceLockRetryInterval * 3
+				set := mock.Command("SET", lockKey, redigomock.NewAnyData(), "NX", "PX", ttl).Expect(nil)
+				g.Assert(r.RemoveDevice("device-1")).Equal(defs.Error(defs.ErrDeviceLocked))
+				g.Assert(mock.c.Stats(set) > 1).Equal(true)
+				g.Assert(mock.c.Stats(set) <= 4).Equal(true)
+			})
+		})
+
+		g.It("applies every mutation given to LockDevice under a single acquisition of the lock", func() {
+			set := mock.Command("SET", lockKey, redigomock.NewAnyData(), "NX", "PX", ttl).Expect("OK")
+			mock.Command("EXISTS", registryKey).Expect(int64(1))
+			mock.Command("HSET", registryKey, defs.RedisDeviceNameField, "kitchen").Expect(int64(0))
+			mock.Command("HMSET", r.genMetaKey("device-1"), "floor", "1").Expect("OK")
+			release := mock.Command("EVALSHA", releaseLockScript.sha, 1, lockKey, redigomock.NewAnyData()).Expect(int64(1))
+
+			e := r.LockDevice("device-1", func(mutator DeviceMutator) error {
+				if e := mutator.RenameDevice("device-1", "kitchen"); e != nil {
+					return e
+				}
+
+				return mutator.SetDeviceMeta("device-1", map[string]string{"floor": "1"})
+			})
+
+			g.Assert(e).Equal(nil)
+			g.Assert(mock.c.Stats(set)).Equal(1)
+			g.Assert(mock.c.Stats(release)).Equal(1)
+			g.Assert(mock.history).Equal([]string{"SET", "EXISTS", "HSET", "EXISTS", "HMSET", "EVALSHA"})
+		})
+
+		g.It("does not run the mutations given to LockDevice while another mutation holds the lock", func() {
+			mock.Command("SET", lockKey, redigomock.NewAnyData(), "NX", "PX", ttl).Expect(nil)
+			ran := false
+			e := r.LockDevice("device-1", func(DeviceMutator) error {
+				ran = true
+				return nil
+			})
+			g.Assert(e).Equal(defs.Error(defs.ErrDeviceLocked))
+			g.Assert(ran).Equal(false)
+		})
+	})
+
+	g.Describe("NameIndex", func() {
+		r, mock := subject()
+		r.NameIndex = true
+		g.BeforeEach(mock.Clear)
+
+		namesKey, registryKey := r.genDeviceNamesKey(), r.genRegistryKey("device-1")
+
+		g.Describe("NameTaken", func() {
+			g.It("detects a duplicate name through the lowercased name's field in the hash", func() {
+				check := mock.Command("HEXISTS", namesKey, "kitchen").Expect(int64(1))
+				taken, e := r.NameTaken("Kitchen")
+				g.Assert(e).Equal(nil)
+				g.Assert(taken).Equal(true)
+				g.Assert(mock.c.Stats(check)).Equal(1)
+				g.Assert(mock.history).Equal([]string{"HEXISTS"})
+			})
+
+			g.It("reports names that are not in the hash as free", func() {
+				mock.Command("HEXISTS", namesKey, "kitchen").Expect(int64(0))
+				taken, e := r.NameTaken("kitchen")
+				g.Assert(e).Equal(nil)
+				g.Assert(taken).Equal(false)
+			})
+
+			g.It("searches the registrations when the name index is disabled", func() {
+				unindexed, unindexedMock := subject()
+				unindexedMock.Command("EXISTS", unindexed.genRegistryKey("kitchen")).ExpectError(fmt.Errorf("bad-exists"))
+				_, e := unindexed.NameTaken("kitchen")
+				g.Assert(e.Error()).Equal("bad-exists")
+				g.Assert(unindexedMock.history).Equal([]string{"EXISTS"})
+			})
+		})
+
+		g.Describe("NameOwner", func() {
+			g.It("returns the id of the device that owns the lowercased name", func() {
+				mock.Command("HGET", namesKey, "kitchen").Expect([]byte("device-1"))
+				owner, e := r.NameOwner("Kitchen")
+				g.Assert(e).Equal(nil)
+				g.Assert(owner).Equal("device-1")
+			})
+
+			g.It("returns not found for names that are not in the hash", func() {
+				mock.Command("HGET", namesKey, "kitchen").Expect(nil)
+				_, e := r.NameOwner("kitchen")
+				g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+			})
+
+			g.It("returns the error from reading the hash", func() {
+				mock.Command("HGET", namesKey, "kitchen").ExpectError(fmt.Errorf("bad-hget"))
+				_, e := r.NameOwner("kitchen")
+				g.Assert(e.Error()).Equal("bad-hget")
+			})
+		})
+
+		unindex := func(name string) []interface{} {
+			return []interface{}{unindexNameScript.sha, 1, namesKey, name, "device-1"}
+		}
+
+		g.It("frees the name of a removed device", func() {
+			mock.Command("HGET", registryKey, defs.RedisDeviceNameField).Expect([]byte("Kitchen"))
+			free := mock.Command("EVALSHA", unindex("kitchen")...).Expect(int64(1))
+			mock.Command("DEL", registryKey).Expect(nil)
+			mock.Command("EXPIRE", r.genFeedbackKey("device-1"), int(defs.DefaultResumeTokenTTL.Seconds())).Expect(int64(1))
+			mock.Command("LREM", defs.RedisDeviceIndexKey, 1, "device-1").Expect(nil)
+			mock.Command("LRANGE", r.genTokenListKey("device-1"), 0, -1).ExpectSlice()
+			mock.Command("DEL", r.genTokenListKey("device-1")).Expect(nil)
+			mock.Command("SMEMBERS", r.genTagListKey("device-1")).ExpectSlice()
+			mock.Command("DEL", r.genTagListKey("device-1")).Expect(nil)
+			g.Assert(r.RemoveDevice("device-1")).Equal(nil)
+			g.Assert(mock.c.Stats(free)).Equal(1)
+		})
+
+		g.It("only frees the name while it is owned by the device", func() {
+			source := unindexNameScript.source
+			g.Assert(strings.Index(source, "== ARGV[2]") < strings.Index(source, `redis.call("HDEL"`)).Equal(true)
+		})
+
+		g.It("does not remove the device if unable to free its name", func() {
+			mock.Command("HGET", registryKey, defs.RedisDeviceNameField).ExpectError(fmt.Errorf("bad-hget"))
+			g.Assert(r.RemoveDevice("device-1").Error()).Equal("bad-hget")
+			g.Assert(mock.history).Equal([]string{"HGET"})
+		})
+
+		g.It("moves the name of a renamed device", func() {
+			mock.Command("EXISTS", registryKey).Expect(int64(1))
+			mock.Command("HGET", registryKey, defs.RedisDeviceNameField).Expect([]byte("kitchen"))
+			free := mock.Command("EVALSHA", unindex("kitchen")...).Expect(int64(1))
+			mock.Command("HSET", registryKey, defs.RedisDeviceNameField, "Office").Expect(int64(0))
+			take := mock.Command("HSET", namesKey, "office", "device-1").Expect(int64(1))
+			g.Assert(r.RenameDevice("device-1", "Office")).Equal(nil)
+			g.Assert(mock.c.Stats(free)).Equal(1)
+			g.Assert(mock.c.Stats(take)).Equal(1)
+		})
+
+		g.Describe("RebuildNameIndex", func() {
+			rebuildKey := r.genDeviceNamesRebuildKey()
+			fields := []interface{}{defs.RedisDeviceIDField, defs.RedisDeviceNameField, defs.RedisDeviceSecretField}
+
+			g.It("rebuilds the hash into a separate key that is renamed over the index", func() {
+				reset := mock.Command("DEL", rebuildKey).Expect(nil)
+				mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, defs.RedisRegistrationPageSize-1).ExpectSlice(
+					[]byte("device-1"),
+				)
+				mock.Command("HMGET", append([]interface{}{registryKey}, fields...)...).ExpectSlice(
+					[]byte("device-1"), []byte("Kitchen"), []byte("secret"),
+				)
+				take := mock.Command("HSET", rebuildKey, "kitchen", "device-1").Expect(int64(1))
+				mock.Command("EXISTS", rebuildKey).Expect(int64(1))
+				swap := mock.Command("RENAME", rebuildKey, namesKey).Expect("OK")
+				g.Assert(r.RebuildNameIndex()).Equal(nil)
+				g.Assert(mock.c.Stats(reset)).Equal(1)
+				g.Assert(mock.c.Stats(take)).Equal(1)
+				g.Assert(mock.c.Stats(swap)).Equal(1)
+				g.Assert(mock.history).Equal([]string{"DEL", "LRANGE", "HMGET", "HSET", "EXISTS", "RENAME"})
+			})
+
+			g.It("empties the index when there are no registered devices", func() {
+				mock.Command("DEL", rebuildKey).Expect(nil)
+				mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, defs.RedisRegistrationPageSize-1).ExpectSlice()
+				mock.Command("EXISTS", rebuildKey).Expect(int64(0))
+				clear := mock.Command("DEL", namesKey).Expect(int64(1))
+				g.Assert(r.RebuildNameIndex()).Equal(nil)
+				g.Assert(mock.c.Stats(clear)).Equal(1)
+				g.Assert(strings.Contains(strings.Join(mock.history, ","), "RENAME")).Equal(false)
+			})
+
+			g.It("leaves the index in place when unable to walk the registrations", func() {
+				mock.Command("DEL", rebuildKey).Expect(nil)
+				mock.Command("LRANGE", defs.RedisDeviceIndexKey, 0, defs.RedisRegistrationPageSize-1).ExpectError(
+					fmt.Errorf("bad-lrange"),
+				)
+				g.Assert(r.RebuildNameIndex().Error()).Equal("bad-lrange")
+				g.Assert(mock.history).Equal([]string{"DEL", "LRANGE"})
+			})
+
+			g.It("keeps the rebuild key in the slot of the index in cluster mode", func() {
+				r.ClusterMode = true
+				defer func() { r.ClusterMode = false }()
+				g.Assert(hashTag(r.genDeviceNamesRebuildKey())).Equal(hashTag(r.genDeviceNamesKey()))
+				g.Assert(hashTag(r.genDeviceNamesKey())).Equal(defs.RedisDeviceNamesKey)
+			})
+		})
+	})
+
+	g.Describe("ClusterMode", func() {
+		r, mock := subject()
+
+		g.BeforeEach(func() {
+			mock.Clear()
+			r.ClusterMode = true
+		})
+
+		g.AfterEach(func() {
+			r.ClusterMode = false
+			r.FeedbackBackend = ""
+		})
+
+		g.It("leaves the keys untagged when off", func() {
+			r.ClusterMode = false
+			g.Assert(r.genRegistryKey("device-1")).Equal(defs.RedisDeviceRegistryKey + ":device-1")
+			g.Assert(r.genTokenListKey("device-1")).Equal(defs.RedisDeviceTokenListKey + ":device-1")
+		})
+
+		g.It("wraps the id of the registry, feedback & token list keys of a device in the same hash tag", func() {
+			keys := []string{r.genRegistryKey("device-1"), r.genFeedbackKey("device-1"), r.genTokenListKey("device-1")}
+
+			for _, key := range keys {
+				g.Assert(strings.Contains(key, "{device-1}")).Equal(true)
+				g.Assert(strings.Count(key, "{")).Equal(1)
+			}
+
+			g.Assert(keys[0]).Equal(defs.RedisDeviceRegistryKey + ":{device-1}")
+		})
+
+		g.It("tags every other key of the device w/ the same hash tag", func() {
+			r.FeedbackBackend = defs.FeedbackBackendStream
+			keys := []string{
+				r.genFeedbackKey("device-1"),
+				r.genTagListKey("device-1"),
+				r.genMetaKey("device-1"),
+				r.genStateKey("device-1"),
+				r.genCommandHistoryKey("device-1"),
+				r.genConnEventsKey("device-1"),
+				r.genIdempotencyKey("device-1", "retry-1"),
+			}
+
+			for _, key := range keys {
+				g.Assert(strings.Contains(key, "{device-1}")).Equal(true)
+			}
+		})
+
+		g.It("keeps the hash tag after the namespace", func() {
+			r.Namespace = "staging"
+			defer func() { r.Namespace = "" }()
+			g.Assert(r.genRegistryKey("device-1")).Equal("staging:" + defs.RedisDeviceRegistryKey + ":{device-1}")
+		})
+
+		g.It("only passes keys of a single slot to each script", func() {
+			r.LockTTL = time.Second
+			defer func() { r.LockTTL = 0 }()
+			generator.t = "token-a"
+			registryKey := r.genRegistryKey("device-1")
+			mock.Command("EXISTS", registryKey).Expect([]byte("true"))
+			mock.Command("HMGET", registryKey, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+				[]byte("device-1"), []byte("kitchen"), []byte("device-secret"),
+			)
+			mock.Command(
+				"EVALSHA",
+				registerTokenScript.sha,
+				1,
+				r.genTokenRegistrationKey("token-a"),
+				tokenFields.name, "some-token",
+				tokenFields.permission, "1",
+				tokenFields.id, redigomock.NewAnyData(),
+				tokenFields.device, "device-1",
+				defs.RedisSchemaVersionField, defs.RedisSchemaVersion,
+			).Expect([]byte(tokenScriptCreated))
+			mock.Command("SET", r.genLockKey("device-1"), redigomock.NewAnyData(), "NX", "PX", int64(1000)).Expect("OK")
+			r.CreateToken("device-1", "some-token", defs.SecurityDeviceTokenPermissionViewer)
+			r.fill(r.genAllocationKey("request-1"), "secret", "device-1")
+			r.ResumeDevice("resume-token", "device-secret")
+			r.RenameDevice("device-1", "office")
+			g.Assert(len(mock.scripts) >= 4).Equal(true)
+
+			for _, keys := range mock.scripts {
+				g.Assert(len(keys) > 0).Equal(true)
+
+				for _, key := range keys {
+					g.Assert(hashTag(key)).Equal(hashTag(keys[0]))
+				}
+			}
+		})
+
+		g.It("recovers the token from tagged token registration keys when listing every token", func() {
+			key := r.genTokenRegistrationKey("token-a")
+			reply := []interface{}{[]byte("0"), []interface{}{[]byte(key)}}
+			pattern := defs.RedisDeviceTokenRegistrationKey + ":{*"
+			mock.Command("SCAN", "0", "MATCH", pattern, "COUNT", defs.RedisTokenScanCount).Expect(reply)
+			mock.Command("HMGET", key, tokenFields.id, tokenFields.name, tokenFields.device, tokenFields.permission).ExpectSlice(
+				[]byte("token-id-a"), []byte("some-token"), []byte("device-1"), []byte("1"),
+			)
+			tokens, e := r.ListAllTokens(0)
+			g.Assert(e).Equal(nil)
+			g.Assert(len(tokens)).Equal(1)
+			g.Assert(tokens[0].TokenID).Equal("token-id-a")
+		})
+	})
+
+	g.Describe("FindDevice", func() {
+		r, mock := subject()
+		device := RegistrationDetails{
+			Name:         "some-device",
+			DeviceID:     "1235",
+			SharedSecret: "shared-secret",
+		}
+		registryKey := r.genRegistryKey(device.DeviceID)
+
+		g.BeforeEach(mock.Clear)
+
+		g.It("returns an error with no devies in the store", func() {
+			_, e := r.FindDevice("garbage")
+			g.Assert(e != nil).Equal(true)
+		})
+
+		g.Describe("when successfully able to check via exists", func() {
+			g.BeforeEach(func() {
+				mock.Command("EXISTS", registryKey).Expect([]byte("true"))
+			})
+
+			g.It("still returns an error if unable to load data", func() {
+				_, e := r.FindDevice("garbage")
+				g.Assert(e != nil).Equal(true)
+			})
+
+			g.Describe("when able to load all details via HMGET", func() {
+				g.BeforeEach(func() {
+					mock.Command("HMGET", registryKey, "device:uuid", "device:name", "device:secret").ExpectSlice(
+						[]byte(device.DeviceID),
+						[]byte(device.Name),
+						[]byte(device.SharedSecret),
+					)
+				})
+
+				g.It("successfully returns the device details", func() {
+					result, e := r.FindDevice(device.DeviceID)
+
+					g.Assert(e == nil).Equal(true)
+					g.Assert(result.DeviceID).Equal(device.DeviceID)
+				})
+			})
+		})
+
+		g.Describe("when unable to find by fast id lookup", func() {
+			g.BeforeEach(func() {
+				mock.Command("EXISTS", r.genRegistryKey(device.Name)).Expect([]byte("false"))
+			})
+
+			g.It("returns an error when recevied an error during the loading from KEYS", func() {
+				mock.Command("KEYS", fmt.Sprintf("%s*", defs.RedisDeviceRegistryKey)).ExpectError(fmt.Errorf("problems"))
+
+				_, e := r.FindDevice(device.Name)
+
+				g.Assert(e != nil).Equal(true)
+			})
+
+			g.It("returns an error when recevied an error during the parsing of strings from KEYS", func() {
+				mock.Command("KEYS", fmt.Sprintf("%s*", defs.RedisDeviceRegistryKey)).Expect(nil)
+				_, e := r.FindDevice(device.Name)
+				g.Assert(e != nil).Equal(true)
+			})
+
+			g.Describe("having received a valid list of device registrations", func() {
+				g.BeforeEach(func() {
+					list := []byte(r.genRegistryKey(device.DeviceID))
+					mock.Command("KEYS", fmt.Sprintf("%s*", defs.RedisDeviceRegistryKey)).ExpectSlice(list)
+				})
+
+				g.It("returns an error when recevied an error during the loading of keys via second HMGET", func() {
+					mock.Command(
+						"HMGET",
+						r.genRegistryKey(device.DeviceID), "device:name", "device:uuid", "device:secret",
+					).ExpectError(fmt.Errorf("problem"))
+
+					_, e := r.FindDevice(device.Name)
+
+					g.Assert(e != nil).Equal(true)
+				})
+
+				g.It("errors when recevied a mismatch during the loading from HMGET", func() {
+					k := r.genRegistryKey(device.DeviceID)
+					cmd := mock.Command("HMGET", k, "device:name", "device:uuid", "device:secret")
+					cmd.ExpectSlice(
+						[]byte("not-the-same"),
+						[]byte("not-the-same"),
+						[]byte("not-the-same"),
+					)
+
+					_, e := r.FindDevice(device.Name)
+					g.Assert(e != nil).Equal(true)
+				})
+
+				g.It("succeeds with valid device details & searching by name", func() {
+					k := r.genRegistryKey(device.DeviceID)
+					cmd := mock.Command("HMGET", k, "device:name", "device:uuid", "device:secret")
+					cmd.ExpectSlice(
+						[]byte(device.Name),
+						[]byte(device.DeviceID),
+						[]byte(device.SharedSecret),
+					)
+
+					result, e := r.FindDevice(device.Name)
+
+					g.Assert(e).Equal(nil)
+					g.Assert(result.Name).Equal(device.Name)
+					g.Assert(result.DeviceID).Equal(device.DeviceID)
+				})
+			})
+
+			g.Describe("having two devices registered w/ the same name", func() {
+				g.BeforeEach(func() {
+					first, second := r.genRegistryKey("device-1"), r.genRegistryKey("device-2")
+					other := r.genRegistryKey("device-3")
+					keys := fmt.Sprintf("%s*", defs.RedisDeviceRegistryKey)
+					mock.Command("KEYS", keys).ExpectSlice([]byte(first), []byte(other), []byte(second))
+					mock.Command("HMGET", first, "device:name", "device:uuid", "device:secret").ExpectSlice(
+						[]byte(device.Name),
+						[]byte("device-1"),
+						[]byte("secret-1"),
+					)
+					mock.Command("HMGET", other, "device:name", "device:uuid", "device:secret").ExpectSlice(
+						[]byte("other-device"),
+						[]byte("device-3"),
+						[]byte("secret-3"),
+					)
+					mock.Command("HMGET", second, "device:name", "device:uuid", "device:secret").ExpectSlice(
+						[]byte(device.Name),
+						[]byte("device-2"),
+						[]byte("secret-2"),
+					)
+				})
+
+				g.It("returns the first of the matching devices", func() {
+					result, e := r.FindDevice(device.Name)
+					g.Assert(e).Equal(nil)
+					g.Assert(result.DeviceID).Equal("device-1")
+				})
+
+				g.It("returns both of the matching devices from FindDevices", func() {
+					results, e := r.FindDevices(device.Name)
+					g.Assert(e).Equal(nil)
+					g.Assert(results).Equal([]RegistrationDetails{
+						{Name: device.Name, DeviceID: "device-1", SharedSecret: "secret-1"},
+						{Name: device.Name, DeviceID: "device-2", SharedSecret: "secret-2"},
+					})
+				})
+
+				g.It("matches devices by id from FindDevices", func() {
+					results, e := r.FindDevices("device-3")
+					g.Assert(e).Equal(nil)
+					g.Assert(len(results)).Equal(1)
+					g.Assert(results[0].Name).Equal("other-device")
+				})
+
+				g.It("returns an empty list from FindDevices when nothing matches", func() {
+					results, e := r.FindDevices("missing-device")
+					g.Assert(e).Equal(nil)
+					g.Assert(len(results)).Equal(0)
+				})
+			})
+		})
+	})
+
+	g.Describe("FindDeviceByID", func() {
+		r, mock := subject()
+		device := RegistrationDetails{
+			Name:         "some-device",
+			DeviceID:     "1235",
+			SharedSecret: "shared-secret",
+		}
+		registryKey := r.genRegistryKey(device.DeviceID)
+
+		g.BeforeEach(mock.Clear)
+
+		g.It("returns the error from the EXISTS lookup", func() {
+			mock.Command("EXISTS", registryKey).ExpectError(fmt.Errorf("bad-exists"))
+			_, e := r.FindDeviceByID(device.DeviceID)
+			g.Assert(e.Error()).Equal("bad-exists")
+		})
+
+		g.It("returns not found w/o scanning device names when the id is not registered", func() {
+			mock.Command("EXISTS", r.genRegistryKey(device.Name)).Expect([]byte("false"))
+			mock.Command("KEYS").ExpectSlice([]byte(registryKey))
+			_, e := r.FindDeviceByID(device.Name)
+			g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+			g.Assert(mock.history).Equal([]string{"EXISTS"})
+		})
+
+		g.It("returns the details of the device registered under the id", func() {
+			mock.Command("EXISTS", registryKey).Expect([]byte("true"))
+			mock.Command("HMGET", registryKey, "device:uuid", "device:name", "device:secret").ExpectSlice(
+				[]byte(device.DeviceID),
+				[]byte(device.Name),
+				[]byte(device.SharedSecret),
+			)
+			result, e := r.FindDeviceByID(device.DeviceID)
+			g.Assert(e).Equal(nil)
+			g.Assert(result.Name).Equal(device.Name)
+			g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET"})
+		})
+	})
+
+	g.Describe("DeviceExists", func() {
+		r, mock := subject()
+		device := RegistrationDetails{
+			Name:         "some-device",
+			DeviceID:     "1235",
+			SharedSecret: "shared-secret",
+		}
+		registryKey := r.genRegistryKey(device.DeviceID)
+
+		g.BeforeEach(mock.Clear)
+
+		g.It("returns true when a device is registered w/ the id", func() {
+			mock.Command("EXISTS", registryKey).Expect([]byte("true"))
+			mock.Command("HMGET", registryKey, "device:uuid", "device:name", "device:secret").ExpectSlice(
+				[]byte(device.DeviceID),
+				[]byte(device.Name),
+				[]byte(device.SharedSecret),
+			)
+			exists, e := r.DeviceExists(device.DeviceID)
+			g.Assert(e).Equal(nil)
+			g.Assert(exists).Equal(true)
+		})
+
+		g.Describe("when no device is registered w/ the query as an id", func() {
+			g.BeforeEach(func() {
+				mock.Command("EXISTS", r.genRegistryKey(device.Name)).Expect([]byte("false"))
+				mock.Command("KEYS", fmt.Sprintf("%s*", defs.RedisDeviceRegistryKey)).ExpectSlice([]byte(registryKey))
+			})
+
+			g.It("returns true when a device is registered w/ the name", func() {
+				mock.Command("HMGET", registryKey, "device:name", "device:uuid", "device:secret").ExpectSlice(
+					[]byte(device.Name),
+					[]byte(device.DeviceID),
+					[]byte(device.SharedSecret),
+				)
+				exists, e := r.DeviceExists(device.Name)
+				g.Assert(e).Equal(nil)
+				g.Assert(exists).Equal(true)
+			})
+
+			g.It("returns false w/o an error when no device matches", func() {
+				mock.Command("HMGET", registryKey, "device:name", "device:uuid", "device:secret").ExpectSlice(
+					[]byte("other-device"),
+					[]byte("other-id"),
+					[]byte(device.SharedSecret),
+				)
+				exists, e := r.DeviceExists(device.Name)
+				g.Assert(e).Equal(nil)
+				g.Assert(exists).Equal(false)
+			})
+
+			g.It("returns errors from the name scan", func() {
+				mock.Command("HMGET", registryKey, "device:name", "device:uuid", "device:secret").ExpectError(
+					fmt.Errorf("bad-hmget"),
+				)
+				exists, e := r.DeviceExists(device.Name)
+				g.Assert(e.Error()).Equal("bad-hmget")
+				g.Assert(exists).Equal(false)
+			})
+		})
+	})
+
+	g.Describe("AllocateRegistration", func() {
+		r, mock := subject()
+
+		g.BeforeEach(mock.Clear)
+
+		g.Describe("with invalid registration details", func() {
+			registrations := []RegistrationRequest{
+				RegistrationRequest{},
+				RegistrationRequest{Name: "this is a valid name"},
+				RegistrationRequest{SharedSecret: "iiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiii"},
+			}
+
+			for _, request := range registrations {
+				g.It("errors with an invalid registration request", func() {
+					e := r.AllocateRegistration(request)
+					g.Assert(e.Error()).Equal(defs.ErrInvalidRegistrationRequest)
+				})
+			}
+		})
+
+		g.Describe("at the minimum device name length", func() {
+			secret := strings.Repeat("i", defs.SecurityMinimumDeviceSharedSecretSize)
+			name := strings.Repeat("a", defs.SecurityDeviceNameMinLength)
+
+			g.It("errors w/ a name one shorter than the minimum", func() {
+				e := r.AllocateRegistration(RegistrationRequest{Name: name[1:], SharedSecret: secret})
+				g.Assert(e).Equal(defs.Error(defs.ErrInvalidRegistrationRequest))
+			})
+
+			g.It("accepts a name of the minimum length", func() {
+				mock.Command("HMSET").Expect(nil)
+				mock.Command("EXPIRE").Expect(nil)
+				g.Assert(r.AllocateRegistration(RegistrationRequest{Name: name, SharedSecret: secret})).Equal(nil)
+			})
+		})
+
+		g.Describe("with a valid registration", func() {
+			request := RegistrationRequest{
+				Name:         "a valid device name",
+				SharedSecret: "iiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiii",
+			}
+
+			g.It("errors when unable to set via hset", func() {
+				mock.Command("HMSET").ExpectError(fmt.Errorf("some-error"))
+				e := r.AllocateRegistration(request)
+				g.Assert(e.Error()).Equal("some-error")
+			})
+
+			g.It("errors when unable to set the expiration of the allocation", func() {
+				mock.Command("HMSET").Expect(nil)
+				mock.Command("EXPIRE").ExpectError(fmt.Errorf("bad-expire"))
+				e := r.AllocateRegistration(request)
+				g.Assert(e.Error()).Equal("bad-expire")
+			})
+
+			g.It("returns nil when successfully able to set via hset", func() {
+				mock.Command("HMSET").Expect(nil)
+				mock.Command("EXPIRE").Expect(nil)
+				e := r.AllocateRegistration(request)
+				g.Assert(e).Equal(nil)
+			})
+
+			g.It("stamps the allocation w/ the time it was requested at", func() {
+				hmset := mock.Command(
+					"HMSET",
+					redigomock.NewAnyData(),
+					defs.RedisRegistrationNameField, request.Name,
+					defs.RedisRegistrationSecretField, request.SharedSecret,
+					defs.RedisRegistrationCreatedField, redigomock.NewAnyData(),
+				).Expect(nil)
+				mock.Command("EXPIRE").Expect(nil)
+				g.Assert(r.AllocateRegistration(request)).Equal(nil)
+				g.Assert(mock.c.Stats(hmset)).Equal(1)
+			})
+
+			g.It("sets the expiration of the allocation after the hmset", func() {
+				ttl := int(defs.DefaultRegistrationRequestTTL.Seconds())
+				mock.Command("HMSET").Expect(nil)
+				mock.Command("EXPIRE", redigomock.NewAnyData(), ttl).Expect(nil)
+				e := r.AllocateRegistration(request)
+				g.Assert(e).Equal(nil)
+				g.Assert(mock.history).Equal([]string{"HMSET", "EXPIRE"})
+			})
+
+			g.It("uses the configured allocation ttl when present", func() {
+				r.AllocationTTL = time.Minute
+				defer func() { r.AllocationTTL = 0 }()
+				mock.Command("HMSET").Expect(nil)
+				mock.Command("EXPIRE", redigomock.NewAnyData(), 60).Expect(nil)
+				mock.Command("EXPIRE", redigomock.NewAnyData(), int(defs.DefaultRegistrationRequestTTL.Seconds())).ExpectError(
+					fmt.Errorf("wrong-ttl"),
+				)
+				e := r.AllocateRegistration(request)
+				g.Assert(e).Equal(nil)
+			})
+		})
+	})
+
+	g.Describe("IssueResumeToken", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		deviceID, resumeKey := "12345", r.genResumeKey("resume-token")
+
+		g.BeforeEach(func() {
+			generator.t, generator.e = "resume-token", nil
+			key := r.genRegistryKey(deviceID)
+			mock.Command("EXISTS", key).Expect(int64(1))
+			mock.Command("HMGET", key, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+				[]byte(deviceID),
+				[]byte("kitchen"),
+				[]byte("device-secret"),
+			)
+			tokensKey := r.genResumeTokensKey(deviceID)
+			mock.Command("SADD", tokensKey, "resume-token").Expect(int64(1))
+			mock.Command("EXPIRE", tokensKey, int(defs.DefaultResumeTokenTTL.Seconds())).Expect(int64(1))
+		})
+
+		g.It("stores the details of the device under the generated token until the resume ttl has elapsed", func() {
+			store := mock.Command(
+				"HMSET",
+				resumeKey,
+				defs.RedisResumeDeviceIDField, deviceID,
+				defs.RedisResumeNameField, "kitchen",
+				defs.RedisResumeSecretField, "device-secret",
+			).Expect("OK")
+			expire := mock.Command("EXPIRE", resumeKey, int(defs.DefaultResumeTokenTTL.Seconds())).Expect(int64(1))
+			token, e := r.IssueResumeToken(deviceID)
+			g.Assert(e).Equal(nil)
+			g.Assert(token).Equal("resume-token")
+			g.Assert(mock.c.Stats(store)).Equal(1)
+			g.Assert(mock.c.Stats(expire)).Equal(1)
+		})
+
+		g.It("adds the token to the set of resume tokens issued to the device", func() {
+			tokensKey := r.genResumeTokensKey(deviceID)
+			mock.Command(
+				"HMSET",
+				resumeKey,
+				defs.RedisResumeDeviceIDField, deviceID,
+				defs.RedisResumeNameField, "kitchen",
+				defs.RedisResumeSecretField, "device-secret",
+			).Expect("OK")
+			mock.Command("EXPIRE", resumeKey, int(defs.DefaultResumeTokenTTL.Seconds())).Expect(int64(1))
+			add := mock.Command("SADD", tokensKey, "resume-token").Expect(int64(1))
+			expire := mock.Command("EXPIRE", tokensKey, int(defs.DefaultResumeTokenTTL.Seconds())).Expect(int64(1))
+			_, e := r.IssueResumeToken(deviceID)
+			g.Assert(e).Equal(nil)
+			g.Assert(mock.c.Stats(add)).Equal(1)
+			g.Assert(mock.c.Stats(expire)).Equal(1)
+		})
+
+		g.It("fails if unable to track the token in the set of the device", func() {
+			mock.Command(
+				"HMSET",
+				resumeKey,
+				defs.RedisResumeDeviceIDField, deviceID,
+				defs.RedisResumeNameField, "kitchen",
+				defs.RedisResumeSecretField, "device-secret",
+			).Expect("OK")
+			mock.Command("EXPIRE", resumeKey, int(defs.DefaultResumeTokenTTL.Seconds())).Expect(int64(1))
+			mock.Command("SADD", r.genResumeTokensKey(deviceID), "resume-token").ExpectError(fmt.Errorf("bad-sadd"))
+			_, e := r.IssueResumeToken(deviceID)
+			g.Assert(e.Error()).Equal("bad-sadd")
+		})
+
+		g.It("fails if unable to generate a token", func() {
+			generator.e = fmt.Errorf("bad-generate")
+			_, e := r.IssueResumeToken(deviceID)
+			g.Assert(e.Error()).Equal("bad-generate")
+			generator.e = nil
+		})
+
+		g.It("fails for devices that are not registered", func() {
+			mock.Command("EXISTS", r.genRegistryKey(deviceID)).Expect(int64(0))
+			_, e := r.IssueResumeToken(deviceID)
+			g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+		})
+	})
+
+	g.Describe("ResumeDevice", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		deviceID, resumeKey := "12345", r.genResumeKey("resume-token")
+		registryKey := r.genRegistryKey(deviceID)
+
+		called := func(name string) bool {
+			for _, command := range mock.history {
+				if command == name {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		redeem := func(secret string) *redigomock.Cmd {
+			return mock.Command(
+				"EVALSHA",
+				redeemResumeScript.sha,
+				1,
+				resumeKey,
+				defs.RedisResumeDeviceIDField,
+				defs.RedisResumeNameField,
+				defs.RedisResumeSecretField,
+				secret,
+			)
+		}
+
+		g.BeforeEach(func() {
+			redeem("device-secret").ExpectSlice([]byte(deviceID), []byte("kitchen"))
+			redeem("other-secret").ExpectSlice([]byte(deviceID))
+		})
+
+		g.It("rejects unknown resume tokens", func() {
+			redeem("device-secret").Expect(nil)
+			_, e := r.ResumeDevice("resume-token", "device-secret")
+			g.Assert(e == defs.Error(defs.ErrInvalidResumeToken)).Equal(true)
+		})
+
+		g.It("rejects resume tokens presented w/ a different secret", func() {
+			_, e := r.ResumeDevice("resume-token", "other-secret")
+			g.Assert(e == defs.Error(defs.ErrInvalidResumeToken)).Equal(true)
+			g.Assert(called("EXISTS")).Equal(false)
+		})
+
+		g.It("reads and consumes the token in a single script, leaving tokens w/ a different secret in place", func() {
+			source := redeemResumeScript.source
+			g.Assert(strings.Index(source, "~= ARGV[4]") < strings.Index(source, `redis.call("DEL", KEYS[1])`)).Equal(true)
+		})
+
+		g.It("returns the id of a device that is still registered, consuming the token", func() {
+			mock.Command("EXISTS", registryKey).Expect(int64(1))
+			id, e := r.ResumeDevice("resume-token", "device-secret")
+			g.Assert(e).Equal(nil)
+			g.Assert(id).Equal(deviceID)
+			g.Assert(called("EVALSHA")).Equal(true)
+			g.Assert(called("HMSET")).Equal(false)
+		})
+
+		g.It("registers a device removed since the token was issued again under the same id", func() {
+			mock.Command("EXISTS", registryKey).Expect(int64(0))
+			mock.Command("LPUSH", r.genDeviceIndexKey(), deviceID).Expect(int64(1))
+			restore := mock.Command(
+				"HMSET",
+				registryKey,
+				deviceFields.id, deviceID,
+				deviceFields.name, "kitchen",
+				deviceFields.secret, "device-secret",
+				defs.RedisSchemaVersionField, defs.RedisSchemaVersion,
+			).Expect("OK")
+			id, e := r.ResumeDevice("resume-token", "device-secret")
+			g.Assert(e).Equal(nil)
+			g.Assert(id).Equal(deviceID)
+			g.Assert(mock.c.Stats(restore)).Equal(1)
+		})
+
+		g.It("keeps the feedback history of a restored device from expiring", func() {
+			mock.Command("EXISTS", registryKey).Expect(int64(0))
+			mock.Command("LPUSH", r.genDeviceIndexKey(), deviceID).Expect(int64(1))
+			mock.Command(
+				"HMSET",
+				registryKey,
+				deviceFields.id, deviceID,
+				deviceFields.name, "kitchen",
+				deviceFields.secret, "device-secret",
+				defs.RedisSchemaVersionField, defs.RedisSchemaVersion,
+			).Expect("OK")
+			persist := mock.Command("PERSIST", r.genFeedbackKey(deviceID)).Expect(int64(1))
+			_, e := r.ResumeDevice("resume-token", "device-secret")
+			g.Assert(e).Equal(nil)
+			g.Assert(mock.c.Stats(persist)).Equal(1)
+		})
+
+		g.It("fails if unable to consume the token", func() {
+			redeem("device-secret").ExpectError(fmt.Errorf("bad-eval"))
+			_, e := r.ResumeDevice("resume-token", "device-secret")
+			g.Assert(e.Error()).Equal("bad-eval")
+		})
+	})
+
+	g.Describe("FillRegistration", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		fields := struct {
+			secret   string
+			name     string
+			deviceID string
+		}{defs.RedisRegistrationSecretField, defs.RedisRegistrationNameField, defs.RedisRegistrationDeviceIDField}
+
+		registration := struct {
+			id     string
+			name   string
+			secret string
+		}{"1212121212", "some request", "31313131313131313131"}
+
+		g.It("returns error when initial keys lookup fails", func() {
+			mock.Command("KEYS").ExpectError(fmt.Errorf("bad-keys"))
+			_, e := r.FillRegistration("secret", "uuid")
+			g.Assert(e.Error()).Equal("bad-keys")
+		})
+
+		g.It("returns error when initial keys lookup returns garbage", func() {
+			mock.Command("KEYS").Expect(nil)
+			_, e := r.FillRegistration("secret", "uuid")
+			g.Assert(e.Error()).Equal(defs.ErrBadRedisResponse)
+		})
+
+		filledPattern := r.genFilledRegistrationKey("*")
+
+		// filled replies to the scan of the filled registrations w/ the keys of the ids.
+		filled := func(ids ...string) {
+			keys := make([]interface{}, 0, len(ids))
+
+			for _, id := range ids {
+				keys = append(keys, []byte(r.genFilledRegistrationKey(id)))
+			}
+
+			reply := []interface{}{[]byte("0"), keys}
+			mock.Command("SCAN", "0", "MATCH", filledPattern, "COUNT", defs.RedisTokenScanCount).Expect(reply)
+		}
+
+		g.It("returns error when initial keys lookup returns empty array", func() {
+			mock.Command("KEYS").ExpectSlice([]byte("one"))
+			filled()
+			_, e := r.FillRegistration("secret", "uuid")
+			g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+		})
+
+		g.It("returns a not found error once the allocation has expired", func() {
+			mock.Command("KEYS", fmt.Sprintf("%s*", defs.RedisRegistrationRequestListKey)).ExpectSlice()
+			filled()
+			_, e := r.FillRegistration(registration.secret, registration.id)
+			g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+		})
+
+		g.It("returns error when received some keys but fails on string conv", func() {
+			mock.Command("KEYS").ExpectSlice([]byte("hello"))
+			mock.Command("HGET").Expect(nil)
+			filled()
+			_, e := r.FillRegistration("secret", "uuid")
+			g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+		})
+
+		g.It("returns the error from scanning the filled registrations", func() {
+			mock.Command("KEYS").ExpectSlice()
+			scan := mock.Command("SCAN", "0", "MATCH", filledPattern, "COUNT", defs.RedisTokenScanCount)
+			scan.ExpectError(fmt.Errorf("bad-scan"))
+			_, e := r.FillRegistration(registration.secret, registration.id)
+			g.Assert(e.Error()).Equal("bad-scan")
+		})
+
+		g.Describe("when having received a valid lookup w/ a matching secret", func() {
+			registrationKey := r.genAllocationKey(registration.id)
+			filledKey := r.genFilledRegistrationKey(registration.id)
+			registryKey := r.genRegistryKey(registration.id)
+
+			claim := func() *redigomock.Cmd {
+				return mock.Command(
+					"EVALSHA",
+					fillRegistrationScript.sha,
+					2,
+					registrationKey,
+					filledKey,
+					fields.secret,
+					fields.name,
+					fields.deviceID,
+					registration.secret,
+					registration.id,
+					int(defs.DefaultRegistrationRequestTTL.Seconds()),
+				)
+			}
+
+			g.BeforeEach(func() {
+				mock.Command("KEYS").ExpectSlice([]byte(registrationKey))
+				mock.Command("HGET", registrationKey, fields.secret).Expect([]byte(registration.secret))
+			})
+
+			g.It("returns the error from claiming the request", func() {
+				claim().ExpectError(fmt.Errorf("bad-eval"))
+				_, e := r.FillRegistration(registration.secret, registration.id)
+				g.Assert(e.Error()).Equal("bad-eval")
+			})
+
+			g.It("deletes the request in the same script that writes the filled registration", func() {
+				g.Assert(strings.Contains(fillRegistrationScript.source, `redis.call("DEL", KEYS[1])`)).Equal(true)
+				g.Assert(strings.Contains(fillRegistrationScript.source, `redis.call("HMSET", KEYS[2]`)).Equal(true)
+			})
+
+			g.It("moves on to the filled registrations if the request was claimed since it was found", func() {
+				claim().Expect(nil)
+				filled()
+				_, e := r.FillRegistration(registration.secret, registration.id)
+				g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+				g.Assert(strings.Contains(strings.Join(mock.history, ","), "LPUSH")).Equal(false)
+			})
+
+			g.Describe("reissued for a registered device", func() {
+				filledID := "the-original-device-id"
+
+				g.BeforeEach(func() {
+					claim().ExpectSlice([]byte(filledID), []byte(registration.name))
+				})
+
+				g.It("returns the id of the device w/o registering it again", func() {
+					mock.Command("EXISTS", r.genRegistryKey(filledID)).Expect(int64(1))
+					id, e := r.FillRegistration(registration.secret, registration.id)
+					g.Assert(e).Equal(nil)
+					g.Assert(id).Equal(filledID)
+					g.Assert(mock.history[:4]).Equal([]string{"KEYS", "HGET", "EVALSHA", "EXISTS"})
+					for _, command := range mock.history {
+						g.Assert(command == "LPUSH" || command == "HMSET").Equal(false)
+					}
+				})
+			})
+
+			g.Describe("that has been claimed", func() {
+				g.BeforeEach(func() {
+					claim().ExpectSlice([]byte(registration.id), []byte(registration.name))
+					mock.Command("EXISTS", registryKey).Expect(int64(0))
+				})
+
+				g.It("returns error when unable to push into the index", func() {
+					mock.Command("LPUSH", defs.RedisDeviceIndexKey, registration.id).ExpectError(fmt.Errorf("some-error"))
+					_, e := r.FillRegistration(registration.secret, registration.id)
+					g.Assert(e.Error()).Equal("some-error")
+				})
+
+				g.Describe("having succesfully pushed to the index", func() {
+					g.BeforeEach(func() {
+						mock.Command("LPUSH", defs.RedisDeviceIndexKey, registration.id).Expect(nil)
+					})
+
+					g.It("errors when failed on hmset", func() {
+						mock.Command("HMSET").ExpectError(fmt.Errorf("bad-hmset"))
+						_, e := r.FillRegistration(registration.secret, registration.id)
+						g.Assert(e.Error()).Equal("bad-hmset")
+					})
+
+					g.It("succeeds after successful hmset", func() {
+						mock.Command("HMSET").Expect(nil)
+						id, e := r.FillRegistration(registration.secret, registration.id)
+						g.Assert(e).Equal(nil)
+						g.Assert(id).Equal(registration.id)
+					})
+
+					g.It("dispatches a registered event after successful hmset", func() {
+						events := &fakeEventDispatcher{}
+						r.Events = events
+						defer func() { r.Events = nil }()
+						mock.Command("HMSET").Expect(nil)
+						_, e := r.FillRegistration(registration.secret, registration.id)
+						g.Assert(e).Equal(nil)
+						g.Assert(len(events.events)).Equal(1)
+						g.Assert(events.events[0].kind).Equal(defs.WebhookDeviceRegisteredEvent)
+						g.Assert(events.events[0].deviceID).Equal(registration.id)
+					})
+
+					g.It("does not dispatch a registered event if the hmset fails", func() {
+						events := &fakeEventDispatcher{}
+						r.Events = events
+						defer func() { r.Events = nil }()
+						mock.Command("HMSET").ExpectError(fmt.Errorf("bad-hmset"))
+						r.FillRegistration(registration.secret, registration.id)
+						g.Assert(len(events.events)).Equal(0)
+					})
+				})
+			})
+		})
+
+		g.Describe("w/ a registration that has already been filled", func() {
+			filledKey := r.genFilledRegistrationKey(registration.id)
+			registryKey := r.genRegistryKey(registration.id)
+
+			g.BeforeEach(func() {
+				mock.Command("KEYS").ExpectSlice()
+				filled(registration.id)
+				mock.Command("HMGET", filledKey, fields.secret, fields.name, fields.deviceID).ExpectSlice(
+					[]byte(registration.secret),
+					[]byte(registration.name),
+					[]byte(registration.id),
+				)
+			})
+
+			g.It("returns the id of the device it was filled w/ w/o registering the device again", func() {
+				mock.Command("EXISTS", registryKey).Expect(int64(1))
+				id, e := r.FillRegistration(registration.secret, "some-other-id")
+				g.Assert(e).Equal(nil)
+				g.Assert(id).Equal(registration.id)
+				for _, command := range mock.history {
+					g.Assert(command == "LPUSH" || command == "HMSET" || command == "EVALSHA").Equal(false)
+				}
+			})
+
+			g.It("registers the device again under the original id if it has since been removed", func() {
+				mock.Command("EXISTS", registryKey).Expect(int64(0))
+				index := mock.Command("LPUSH", defs.RedisDeviceIndexKey, registration.id).Expect(nil)
+				hmset := mock.Command("HMSET", registryKey, redigomock.NewAnyData(), registration.id,
+					redigomock.NewAnyData(), registration.name, redigomock.NewAnyData(), registration.secret,
+					defs.RedisSchemaVersionField, defs.RedisSchemaVersion).Expect(nil)
+				id, e := r.FillRegistration(registration.secret, "some-other-id")
+				g.Assert(e).Equal(nil)
+				g.Assert(id).Equal(registration.id)
+				g.Assert(mock.c.Stats(index)).Equal(1)
+				g.Assert(mock.c.Stats(hmset)).Equal(1)
+			})
+
+			g.It("only registers the device once when filled twice w/ the same secret", func() {
+				mock.Clear()
+				requestKey := r.genAllocationKey(registration.id)
+				mock.Command("KEYS").ExpectSlice([]byte(requestKey)).ExpectSlice()
+				mock.Command("HGET", requestKey, fields.secret).Expect([]byte(registration.secret))
+				claim := mock.Command(
+					"EVALSHA",
+					fillRegistrationScript.sha,
+					2,
+					requestKey,
+					filledKey,
+					fields.secret,
+					fields.name,
+					fields.deviceID,
+					registration.secret,
+					registration.id,
+					int(defs.DefaultRegistrationRequestTTL.Seconds()),
+				).ExpectSlice([]byte(registration.id), []byte(registration.name))
+				filled(registration.id)
+				mock.Command("HMGET", filledKey, fields.secret, fields.name, fields.deviceID).ExpectSlice(
+					[]byte(registration.secret),
+					[]byte(registration.name),
+					[]byte(registration.id),
+				)
+				mock.Command("EXISTS", registryKey).Expect(int64(0)).Expect(int64(1))
+				index := mock.Command("LPUSH", defs.RedisDeviceIndexKey, registration.id).Expect(nil)
+				hmset := mock.Command("HMSET", registryKey, redigomock.NewAnyData(), registration.id,
+					redigomock.NewAnyData(), registration.name, redigomock.NewAnyData(), registration.secret,
+					defs.RedisSchemaVersionField, defs.RedisSchemaVersion).Expect(nil)
+
+				first, e := r.FillRegistration(registration.secret, registration.id)
+				g.Assert(e).Equal(nil)
+				second, e := r.FillRegistration(registration.secret, "some-other-id")
+				g.Assert(e).Equal(nil)
+
+				g.Assert(first).Equal(registration.id)
+				g.Assert(second).Equal(registration.id)
+				g.Assert(mock.c.Stats(claim)).Equal(1)
+				g.Assert(mock.c.Stats(hmset)).Equal(1)
+				g.Assert(mock.c.Stats(index)).Equal(1)
+			})
+
+			g.It("skips filled registrations w/ a different secret", func() {
+				_, e := r.FillRegistration("another-secret", "some-other-id")
+				g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+			})
+		})
+	})
+
+	g.Describe("ListTokens", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		fixtures := struct {
+			deviceID            string
+			deviceName          string
+			deviceSecret        string
+			testTokenValue      string
+			testTokenName       string
+			testTokenID         string
+			testTokenPermission string
+		}{
+			deviceID:            "list-tokens-test-device-id",
+			deviceName:          "some-device-name",
+			deviceSecret:        "go-bills",
+			testTokenValue:      "a-token",
+			testTokenName:       "token-id",
+			testTokenID:         "111",
+			testTokenPermission: "111",
+		}
+
+		g.AfterEach(func() {
+			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
+		})
+
+		g.It("fails if it is unable to find the device requested", func() {
+			registryKey := r.genRegistryKey(fixtures.deviceID)
+			mock.Command("EXISTS", registryKey).ExpectError(fmt.Errorf("bad-exists"))
+			_, e := r.ListTokens(fixtures.deviceID)
+			g.Assert(e.Error()).Equal("bad-exists")
+		})
+
+		g.Describe("having found a device", func() {
+			g.BeforeEach(func() {
+				registryKey := r.genRegistryKey(fixtures.deviceID)
+				mock.Command("EXISTS", registryKey).Expect([]byte("true"))
+				mock.Command("HMGET", registryKey, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+					[]byte(fixtures.deviceID),
+					[]byte(fixtures.deviceName),
+					[]byte(fixtures.deviceSecret),
+				)
+			})
+
+			g.It("errors if unable to range over the tokens", func() {
+				tokensListKey := r.genTokenListKey(fixtures.deviceID)
+				mock.Command("LRANGE", tokensListKey, 0, defs.RedisTokenPageSize-1).ExpectError(fmt.Errorf("bad-range"))
+				_, e := r.ListTokens(fixtures.deviceID)
+				g.Assert(e.Error()).Equal("bad-range")
+			})
+
+			g.It("returns an empty range if no elements were returned", func() {
+				tokensListKey := r.genTokenListKey(fixtures.deviceID)
+				mock.Command("LRANGE", tokensListKey, 0, defs.RedisTokenPageSize-1).ExpectSlice()
+				tokens, e := r.ListTokens(fixtures.deviceID)
+				g.Assert(e).Equal(nil)
+				g.Assert(len(tokens)).Equal(0)
+			})
+
+			g.Describe("having returned some raw tokens from the range", func() {
+				g.BeforeEach(func() {
+					tokensListKey := r.genTokenListKey(fixtures.deviceID)
+					mock.Command("LRANGE", tokensListKey, 0, defs.RedisTokenPageSize-1).ExpectSlice(
+						[]byte(fixtures.testTokenValue),
+					)
+				})
+
+				g.It("returns no tokens even if errored during lookup", func() {
+					tokenDetailKey := r.genTokenRegistrationKey(fixtures.testTokenValue)
+					mock.Command(
+						"HMGET",
+						tokenDetailKey,
+						tokenFields.id,
+						tokenFields.name,
+						tokenFields.device,
+						tokenFields.permission,
+					).ExpectError(fmt.Errorf("bad-get"))
+					tokens, e := r.ListTokens(fixtures.deviceID)
+					g.Assert(e).Equal(nil)
+					g.Assert(len(tokens)).Equal(0)
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "LRANGE", "HMGET"})
+				})
+
+				g.It("prunes entries whose registration hash is missing", func() {
+					tokenDetailKey := r.genTokenRegistrationKey(fixtures.testTokenValue)
+					mock.Command(
+						"HMGET",
+						tokenDetailKey,
+						tokenFields.id,
+						tokenFields.name,
+						tokenFields.device,
+						tokenFields.permission,
+					).ExpectSlice(nil, nil, nil, nil)
+					mock.Command("LREM", r.genTokenListKey(fixtures.deviceID), 0, fixtures.testTokenValue).Expect(int64(1))
+					tokens, e := r.ListTokens(fixtures.deviceID)
+					g.Assert(e).Equal(nil)
+					g.Assert(len(tokens)).Equal(0)
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "LRANGE", "HMGET", "LREM"})
+				})
+
+				g.It("skips and prunes tokens with invalid permission masks", func() {
+					mock.Command("LREM", r.genTokenListKey(fixtures.deviceID), 0, fixtures.testTokenValue).Expect(int64(1))
+					tokenDetailKey := r.genTokenRegistrationKey(fixtures.testTokenValue)
+					mock.Command(
+						"HMGET",
+						tokenDetailKey,
+						tokenFields.id,
+						tokenFields.name,
+						tokenFields.device,
+						tokenFields.permission,
+					).ExpectSlice(
+						[]byte(fixtures.testTokenID),
+						[]byte(fixtures.testTokenName),
+						[]byte(fixtures.deviceID),
+						[]byte("asdasdas"),
+					)
+
+					tokens, e := r.ListTokens(fixtures.deviceID)
+					g.Assert(e).Equal(nil)
+					g.Assert(len(tokens)).Equal(0)
+				})
+
+				g.It("returns the token details identified by the value returned from the range", func() {
+					tokenDetailKey := r.genTokenRegistrationKey(fixtures.testTokenValue)
+					mock.Command(
+						"HMGET",
+						tokenDetailKey,
+						tokenFields.id,
+						tokenFields.name,
+						tokenFields.device,
+						tokenFields.permission,
+					).ExpectSlice(
+						[]byte(fixtures.testTokenID),
+						[]byte(fixtures.testTokenName),
+						[]byte(fixtures.deviceID),
+						[]byte(fixtures.testTokenPermission),
+					)
+
+					tokens, e := r.ListTokens(fixtures.deviceID)
+					g.Assert(e).Equal(nil)
+					g.Assert(len(tokens)).Equal(1)
+				})
+			})
+
+		})
+	})
+
+	g.Describe("WalkTokens", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		device := struct {
+			id     string
+			name   string
+			secret string
+		}{"walk-tokens-device-id", "walk-tokens-device", "walk-tokens-secret"}
+
+		listKey := r.genTokenListKey(device.id)
+
+		// page fills a page of the token list starting at `start` w/ `count` tokens, each of which is hydrated.
+		page := func(start, count int) {
+			values := make([]interface{}, 0, count)
+
+			for i := start; i < start+count; i++ {
+				value := fmt.Sprintf("token-%d", i)
+				values = append(values, []byte(value))
+
+				mock.Command(
+					"HMGET",
+					r.genTokenRegistrationKey(value),
+					tokenFields.id,
+					tokenFields.name,
+					tokenFields.device,
+					tokenFields.permission,
+				).ExpectSlice(
+					[]byte(fmt.Sprintf("id-%d", i)),
+					[]byte(fmt.Sprintf("name-%d", i)),
+					[]byte(device.id),
+					[]byte("001"),
+				)
+			}
+
+			mock.Command("LRANGE", listKey, start, start+defs.RedisTokenPageSize-1).ExpectSlice(values...)
+		}
+
+		g.BeforeEach(func() {
+			registryKey := r.genRegistryKey(device.id)
+			mock.Command("EXISTS", registryKey).Expect([]byte("true"))
+			mock.Command("HMGET", registryKey, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+				[]byte(device.id),
+				[]byte(device.name),
+				[]byte(device.secret),
+			)
+		})
+
+		g.It("pages through the token list until a partial page is returned", func() {
+			page(0, defs.RedisTokenPageSize)
+			page(defs.RedisTokenPageSize, 3)
+			visited := make([]string, 0)
+
+			e := r.WalkTokens(device.id, func(details TokenDetails) error {
+				visited = append(visited, details.TokenID)
+				return nil
+			})
+
+			g.Assert(e).Equal(nil)
+			g.Assert(len(visited)).Equal(defs.RedisTokenPageSize + 3)
+			g.Assert(visited[defs.RedisTokenPageSize]).Equal(fmt.Sprintf("id-%d", defs.RedisTokenPageSize))
+		})
+
+		g.It("requests the next page when the previous one was full", func() {
+			page(0, defs.RedisTokenPageSize)
+			mock.Command("LRANGE", listKey, defs.RedisTokenPageSize, defs.RedisTokenPageSize*2-1).ExpectSlice()
+			tokens, e := r.ListTokens(device.id)
+			g.Assert(e).Equal(nil)
+			g.Assert(len(tokens)).Equal(defs.RedisTokenPageSize)
+		})
+
+		g.It("accounts for pruned entries when requesting the next page", func() {
+			page(0, defs.RedisTokenPageSize)
+			dangling := r.genTokenRegistrationKey("token-0")
+			mock.Command("HMGET", dangling, tokenFields.id, tokenFields.name, tokenFields.device, tokenFields.permission).
+				ExpectSlice(nil, nil, nil, nil)
+			mock.Command("LREM", listKey, 0, "token-0").Expect(int64(1))
+			mock.Command("LRANGE", listKey, defs.RedisTokenPageSize-1, defs.RedisTokenPageSize*2-2).ExpectSlice()
+			tokens, e := r.ListTokens(device.id)
+			g.Assert(e).Equal(nil)
+			g.Assert(len(tokens)).Equal(defs.RedisTokenPageSize - 1)
+		})
+
+		g.It("stops walking when the callback returns an error", func() {
+			page(0, defs.RedisTokenPageSize)
+			page(defs.RedisTokenPageSize, 3)
+			visited := 0
+
+			e := r.WalkTokens(device.id, func(details TokenDetails) error {
+				visited++
+
+				if visited == 2 {
+					return fmt.Errorf("stop-walking")
+				}
+
+				return nil
+			})
+
+			g.Assert(e.Error()).Equal("stop-walking")
+			g.Assert(visited).Equal(2)
+			g.Assert(mock.history[len(mock.history)-1]).Equal("HMGET")
+		})
+	})
+
+	g.Describe("ReissueRegistration", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		secret, registryKey := genDeviceKey(), r.genRegistryKey("device-1")
+		pattern, filledField := r.genAllocationKey("*"), defs.RedisRegistrationDeviceIDField
+
+		// scan replies to the scans of the registration requests and filled registrations w/ the device ids of each.
+		scan := func(requests, filled map[string]string) {
+			reply := func(pattern string, ids map[string]string, key func(string) string) {
+				keys := make([]interface{}, 0, len(ids))
+
+				for id, deviceID := range ids {
+					keys = append(keys, []byte(key(id)))
+					mock.Command("HGET", key(id), filledField).Expect([]byte(deviceID))
+				}
+
+				mock.Command("SCAN", "0", "MATCH", pattern, "COUNT", defs.RedisTokenScanCount).Expect([]interface{}{
+					[]byte("0"),
+					keys,
+				})
+			}
+
+			reply(pattern, requests, r.genAllocationKey)
+			reply(r.genFilledRegistrationKey("*"), filled, r.genFilledRegistrationKey)
+		}
+
+		// resumes replies to the lookup of the resume tokens issued to the device.
+		resumes := func(tokens ...string) {
+			members := make([]interface{}, 0, len(tokens))
+
+			for _, token := range tokens {
+				members = append(members, []byte(token))
+			}
+
+			mock.Command("SMEMBERS", r.genResumeTokensKey("device-1")).Expect(members)
+			mock.Command("DEL", r.genResumeTokensKey("device-1")).Expect(int64(1))
+		}
+
+		g.BeforeEach(func() {
+			resumes()
+		})
+
+		allocate := func() *redigomock.Cmd {
+			mock.Command("EXPIRE", redigomock.NewAnyData(), int(r.allocationTTL().Seconds())).Expect(int64(1))
+
+			return mock.Command(
+				"HMSET",
+				redigomock.NewAnyData(),
+				defs.RedisRegistrationNameField, "kitchen",
+				defs.RedisRegistrationSecretField, secret,
+				filledField, "device-1",
+				defs.RedisRegistrationCreatedField, redigomock.NewAnyData(),
+			).Expect("OK")
+		}
+
+		g.It("rejects secrets that are not an rsa public key w/o touching the registry", func() {
+			g.Assert(r.ReissueRegistration("device-1", "abcdef")).Equal(defs.Error(defs.ErrInvalidDeviceSharedSecret))
+			g.Assert(len(mock.history)).Equal(0)
+		})
+
+		g.It("returns not found for devices that are not registered", func() {
+			mock.Command("HGET", registryKey, defs.RedisDeviceNameField).Expect(nil)
+			g.Assert(r.ReissueRegistration("device-1", secret)).Equal(defs.Error(defs.ErrNotFound))
+			g.Assert(mock.history).Equal([]string{"HGET"})
+		})
+
+		g.It("replaces the secret of the device, keeping its id", func() {
+			mock.Command("HGET", registryKey, defs.RedisDeviceNameField).Expect([]byte("kitchen"))
+			scan(nil, nil)
+			set := mock.Command("HSET", registryKey, defs.RedisDeviceSecretField, secret).Expect(int64(0))
+			request := allocate()
+			g.Assert(r.ReissueRegistration("device-1", secret)).Equal(nil)
+			g.Assert(mock.c.Stats(set)).Equal(1)
+			g.Assert(mock.c.Stats(request)).Equal(1)
+		})
+
+		g.It("removes the registration requests filled by the device w/ its previous secret", func() {
+			mock.Command("HGET", registryKey, defs.RedisDeviceNameField).Expect([]byte("kitchen"))
+			scan(
+				map[string]string{"previous": "device-1", "other": "device-2", "pending": ""},
+				map[string]string{"filled": "device-1", "other-filled": "device-2"},
+			)
+			removed := mock.Command("DEL", r.genAllocationKey("previous")).Expect(int64(1))
+			other := mock.Command("DEL", r.genAllocationKey("other")).Expect(int64(1))
+			pending := mock.Command("DEL", r.genAllocationKey("pending")).Expect(int64(1))
+			filled := mock.Command("DEL", r.genFilledRegistrationKey("filled")).Expect(int64(1))
+			otherFilled := mock.Command("DEL", r.genFilledRegistrationKey("other-filled")).Expect(int64(1))
+			mock.Command("HSET", registryKey, defs.RedisDeviceSecretField, secret).Expect(int64(0))
+			allocate()
+			g.Assert(r.ReissueRegistration("device-1", secret)).Equal(nil)
+			g.Assert(mock.c.Stats(removed)).Equal(1)
+			g.Assert(mock.c.Stats(other)).Equal(0)
+			g.Assert(mock.c.Stats(pending)).Equal(0)
+			g.Assert(mock.c.Stats(filled)).Equal(1)
+			g.Assert(mock.c.Stats(otherFilled)).Equal(0)
+		})
+
+		g.It("revokes the resume tokens issued to the device w/ its previous secret", func() {
+			mock.Command("HGET", registryKey, defs.RedisDeviceNameField).Expect([]byte("kitchen"))
+			scan(nil, nil)
+			resumes("issued")
+			issued := mock.Command("DEL", r.genResumeKey("issued")).Expect(int64(1))
+			other := mock.Command("DEL", r.genResumeKey("other")).Expect(int64(1))
+			mock.Command("HSET", registryKey, defs.RedisDeviceSecretField, secret).Expect(int64(0))
+			allocate()
+			g.Assert(r.ReissueRegistration("device-1", secret)).Equal(nil)
+			g.Assert(mock.c.Stats(issued)).Equal(1)
+			g.Assert(mock.c.Stats(other)).Equal(0)
+		})
+
+		g.It("leaves the secret as-is if unable to revoke the resume tokens", func() {
+			mock.Command("HGET", registryKey, defs.RedisDeviceNameField).Expect([]byte("kitchen"))
+			scan(nil, nil)
+			resumes("issued")
+			mock.Command("DEL", r.genResumeKey("issued")).ExpectError(fmt.Errorf("bad-del"))
+			set := mock.Command("HSET", registryKey, defs.RedisDeviceSecretField, secret).Expect(int64(0))
+			g.Assert(r.ReissueRegistration("device-1", secret).Error()).Equal("bad-del")
+			g.Assert(mock.c.Stats(set)).Equal(0)
+		})
+
+		g.It("leaves the secret as-is if unable to remove the previously filled requests", func() {
+			mock.Command("HGET", registryKey, defs.RedisDeviceNameField).Expect([]byte("kitchen"))
+			scan(map[string]string{"previous": "device-1"}, nil)
+			mock.Command("DEL", r.genAllocationKey("previous")).ExpectError(fmt.Errorf("bad-del"))
+			set := mock.Command("HSET", registryKey, defs.RedisDeviceSecretField, secret).Expect(int64(0))
+			g.Assert(r.ReissueRegistration("device-1", secret).Error()).Equal("bad-del")
+			g.Assert(mock.c.Stats(set)).Equal(0)
+		})
+	})
+
+	g.Describe("ListPendingRegistrations", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		pattern := r.genAllocationKey("*")
+		filledField, createdField := defs.RedisRegistrationDeviceIDField, defs.RedisRegistrationCreatedField
+		secretField, nameField := defs.RedisRegistrationSecretField, defs.RedisRegistrationNameField
+
+		scan := func(ids ...string) {
+			keys := make([]interface{}, 0, len(ids))
+
+			for _, id := range ids {
+				keys = append(keys, []byte(r.genAllocationKey(id)))
+			}
+
+			reply := []interface{}{[]byte("0"), keys}
+			mock.Command("SCAN", "0", "MATCH", pattern, "COUNT", defs.RedisTokenScanCount).Expect(reply)
+		}
+
+		seed := func(id, name, filledID string, created int64) {
+			key := r.genAllocationKey(id)
+			timestamp := []byte(strconv.FormatInt(created, 10))
+			mock.Command("HMGET", key, filledField, createdField).ExpectSlice([]byte(filledID), timestamp)
+			mock.Command("HMGET", key, secretField, nameField).ExpectSlice([]byte("some-secret"), []byte(name))
+		}
+
+		g.It("errors if unable to scan the registration requests", func() {
+			mock.Command("SCAN", "0", "MATCH", pattern, "COUNT", defs.RedisTokenScanCount).ExpectError(fmt.Errorf("bad-scan"))
+			_, e := r.ListPendingRegistrations()
+			g.Assert(e.Error()).Equal("bad-scan")
+		})
+
+		g.It("errors if unable to check whether a request has been filled", func() {
+			scan("request-a")
+			key := r.genAllocationKey("request-a")
+			mock.Command("HMGET", key, filledField, createdField).ExpectError(fmt.Errorf("bad-hmget"))
+			_, e := r.ListPendingRegistrations()
+			g.Assert(e.Error()).Equal("bad-hmget")
+		})
+
+		g.It("lists the name and age of each outstanding request w/o its secret", func() {
+			now := time.Now().Unix()
+			scan("request-a", "request-b")
+			seed("request-a", "kitchen", "", now-120)
+			seed("request-b", "office", "", now-60)
+
+			pending, e := r.ListPendingRegistrations()
+			g.Assert(e).Equal(nil)
+			g.Assert(len(pending)).Equal(2)
+			g.Assert(pending[0].Name).Equal("kitchen")
+			g.Assert(pending[0].SharedSecret).Equal("")
+			g.Assert(pending[0].Age >= 120).Equal(true)
+			g.Assert(pending[1].Name).Equal("office")
+			g.Assert(pending[1].Age >= 60 && pending[1].Age < 120).Equal(true)
+		})
+
+		g.It("skips requests reissued for an already registered device", func() {
+			now := time.Now().Unix()
+			scan("request-a", "request-b")
+			seed("request-a", "kitchen", "some-device-id", now)
+			seed("request-b", "office", "", now)
+
+			pending, e := r.ListPendingRegistrations()
+			g.Assert(e).Equal(nil)
+			g.Assert(len(pending)).Equal(1)
+			g.Assert(pending[0].Name).Equal("office")
+		})
+
+		g.It("skips requests that expired since being scanned", func() {
+			scan("request-a")
+			key := r.genAllocationKey("request-a")
+			mock.Command("HMGET", key, filledField, createdField).ExpectSlice(nil, nil)
+			mock.Command("HMGET", key, secretField, nameField).ExpectSlice(nil, nil)
+
+			pending, e := r.ListPendingRegistrations()
+			g.Assert(e).Equal(nil)
+			g.Assert(len(pending)).Equal(0)
+		})
+	})
+
+	g.Describe("ListAllTokens", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		pattern := r.genTokenRegistrationKey("*")
+
+		scan := func(cursor, next string, tokens ...string) {
+			keys := make([]interface{}, 0, len(tokens))
+
+			for _, token := range tokens {
+				keys = append(keys, []byte(r.genTokenRegistrationKey(token)))
+			}
+
+			reply := []interface{}{[]byte(next), keys}
+			mock.Command("SCAN", cursor, "MATCH", pattern, "COUNT", defs.RedisTokenScanCount).Expect(reply)
+		}
+
+		seed := func(token, id, deviceID string) {
+			key := r.genTokenRegistrationKey(token)
+			fields := []interface{}{key, tokenFields.id, tokenFields.name, tokenFields.device, tokenFields.permission}
+			mock.Command("HMGET", fields...).ExpectSlice(
+				[]byte(id), []byte("some-token"), []byte(deviceID), []byte("1"),
+			)
+		}
+
+		g.It("errors if unable to scan the token registrations", func() {
+			mock.Command("SCAN", "0", "MATCH", pattern, "COUNT", defs.RedisTokenScanCount).ExpectError(fmt.Errorf("bad-scan"))
+			_, e := r.ListAllTokens(0)
+			g.Assert(e.Error()).Equal("bad-scan")
+		})
+
+		g.It("aggregates the tokens of every device across scan pages, skipping unparsable ones", func() {
+			scan("0", "12", "token-a")
+			scan("12", "0", "token-b", "token-c")
+			seed("token-a", "token-id-a", "device-1")
+			seed("token-b", "token-id-b", "device-2")
+			dangling := r.genTokenRegistrationKey("token-c")
+			fields := []interface{}{dangling, tokenFields.id, tokenFields.name, tokenFields.device, tokenFields.permission}
+			mock.Command("HMGET", fields...).ExpectSlice(
+				[]byte(""), []byte(""), []byte(""), []byte(""),
+			)
+
+			tokens, e := r.ListAllTokens(0)
+			g.Assert(e).Equal(nil)
+			g.Assert(len(tokens)).Equal(2)
+			g.Assert(tokens[0].DeviceID).Equal("device-1")
+			g.Assert(tokens[1].DeviceID).Equal("device-2")
+			g.Assert(tokens[1].TokenID).Equal("token-id-b")
+		})
+
+		g.It("stops scanning once the limit has been reached", func() {
+			scan("0", "12", "token-a", "token-b")
+			seed("token-a", "token-id-a", "device-1")
+			seed("token-b", "token-id-b", "device-2")
+
+			tokens, e := r.ListAllTokens(1)
+			g.Assert(e).Equal(nil)
+			g.Assert(len(tokens)).Equal(1)
+			g.Assert(mock.history).Equal([]string{"SCAN", "HMGET"})
+		})
+	})
+
+	g.Describe("RecallToken", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		idempotencyKey := r.genIdempotencyKey("device-id-1", "retry-key")
+		tokenKey := r.genTokenRegistrationKey("raw-token")
+
+		g.It("returns a not found error when the key has not been used", func() {
+			mock.Command("GET", idempotencyKey).Expect(nil)
+			_, e := r.RecallToken("device-id-1", "retry-key")
+			g.Assert(e).Equal(defs.Error(defs.ErrNotFound))
+		})
+
+		g.It("fails fast when unable to read the key", func() {
+			mock.Command("GET", idempotencyKey).ExpectError(fmt.Errorf("bad-get"))
+			_, e := r.RecallToken("device-id-1", "retry-key")
+			g.Assert(e.Error()).Equal("bad-get")
+		})
+
+		g.It("returns a not found error when the token has since been removed", func() {
+			mock.Command("GET", idempotencyKey).Expect([]byte("raw-token"))
+			mock.Command("HGET", tokenKey, defs.RedisDeviceTokenPermissionField).Expect(nil)
+			_, e := r.RecallToken("device-id-1", "retry-key")
+			g.Assert(e).Equal(defs.Error(defs.ErrNotFound))
+		})
+
+		g.It("returns a pending error w/o looking up a token while the key is reserved", func() {
+			mock.Command("GET", idempotencyKey).Expect([]byte(defs.RedisTokenIdempotencyPending))
+			_, e := r.RecallToken("device-id-1", "retry-key")
+			g.Assert(e).Equal(defs.Error(defs.ErrIdempotencyKeyPending))
+			g.Assert(mock.history).Equal([]string{"GET"})
+		})
+
+		g.It("returns the details of the token along w/ its raw value", func() {
+			mock.Command("GET", idempotencyKey).Expect([]byte("raw-token"))
+			mock.Command("HGET", tokenKey, defs.RedisDeviceTokenPermissionField).Expect([]byte("1"))
+			mock.Command("HMGET").ExpectSlice([]byte("token-id-1"), []byte("testing"), []byte("device-id-1"))
+			details, e := r.RecallToken("device-id-1", "retry-key")
+			g.Assert(e).Equal(nil)
+			g.Assert(details.TokenID).Equal("token-id-1")
+			g.Assert(details.Token).Equal("raw-token")
+			g.Assert(details.Permission).Equal(uint(defs.SecurityDeviceTokenPermissionViewer))
+		})
+	})
+
+	g.Describe("RememberToken", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		idempotencyKey := r.genIdempotencyKey("device-id-1", "retry-key")
+		details := TokenDetails{TokenID: "token-id-1", Token: "raw-token"}
+
+		ttl := int(defs.DefaultTokenIdempotencyWindow.Seconds())
+
+		g.It("stores the raw token under the key w/ the expiration of the idempotency window in a single command", func() {
+			set := mock.Command("SET", idempotencyKey, "raw-token", "EX", ttl).Expect("OK")
+			g.Assert(r.RememberToken("device-id-1", "retry-key", details)).Equal(nil)
+			g.Assert(mock.c.Stats(set)).Equal(1)
+			g.Assert(mock.history).Equal([]string{"SET"})
+		})
+
+		g.It("fails if unable to store the token", func() {
+			mock.Command("SET", idempotencyKey, "raw-token", "EX", ttl).ExpectError(fmt.Errorf("bad-set"))
+			e := r.RememberToken("device-id-1", "retry-key", details)
+			g.Assert(e.Error()).Equal("bad-set")
+		})
+	})
+
+	g.Describe("ReserveToken", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		idempotencyKey := r.genIdempotencyKey("device-id-1", "retry-key")
+		ttl := int(defs.DefaultTokenIdempotencyReservation.Seconds())
+
+		reserve := func() *redigomock.Cmd {
+			return mock.Command("SET", idempotencyKey, defs.RedisTokenIdempotencyPending, "NX", "EX", ttl)
+		}
+
+		g.It("claims an unused key w/ the pending marker", func() {
+			set := reserve().Expect("OK")
+			g.Assert(r.ReserveToken("device-id-1", "retry-key")).Equal(nil)
+			g.Assert(mock.c.Stats(set)).Equal(1)
+		})
+
+		g.It("returns a pending error if the key has already been claimed", func() {
+			reserve().Expect(nil)
+			e := r.ReserveToken("device-id-1", "retry-key")
+			g.Assert(e).Equal(defs.Error(defs.ErrIdempotencyKeyPending))
+		})
+
+		g.It("fails if unable to set the key", func() {
+			reserve().ExpectError(fmt.Errorf("bad-set"))
+			g.Assert(r.ReserveToken("device-id-1", "retry-key").Error()).Equal("bad-set")
+		})
+	})
+
+	g.Describe("ReleaseToken", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		g.It("deletes the reserved key", func() {
+			del := mock.Command("DEL", r.genIdempotencyKey("device-id-1", "retry-key")).Expect(int64(1))
+			g.Assert(r.ReleaseToken("device-id-1", "retry-key")).Equal(nil)
+			g.Assert(mock.c.Stats(del)).Equal(1)
+		})
+	})
+
+	g.Describe("FindToken", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		token := struct {
+			name     string
+			token    string
+			id       string
+			deviceID string
+		}{"testing", "eeeeeeeeeeeeeeeeeeee", "token-id-1", "device-id-1"}
+
+		tokenKey := r.genTokenRegistrationKey(token.token)
+
+		fields := struct {
+			permission string
+		}{defs.RedisDeviceTokenPermissionField}
+
+		g.It("fails fast when unable to get the permission mask", func() {
+			mock.Command("HGET", tokenKey, fields.permission).ExpectError(fmt.Errorf("bad-hget"))
+			_, e := r.FindToken(token.token)
+			g.Assert(e.Error()).Equal("bad-hget")
+		})
+
+		g.It("returns a not found error when the token is not registered", func() {
+			mock.Command("HGET", tokenKey, fields.permission).Expect(nil)
+			_, e := r.FindToken(token.token)
+			g.Assert(e).Equal(defs.Error(defs.ErrNotFound))
+		})
+
+		g.It("fails fast when unable to parse the permission mask", func() {
+			mock.Command("HGET", tokenKey, fields.permission).Expect([]byte("invalid-mask"))
+			_, e := r.FindToken(token.token)
+			g.Assert(strings.Contains(e.Error(), "invalid syntax")).Equal(true)
+		})
+
+		g.Describe("when successfully able to load token", func() {
+			g.BeforeEach(func() {
+				mock.Command("HGET", tokenKey, fields.permission).Expect([]byte("111"))
+			})
+
+			g.It("returns error when hmget lookup fails", func() {
+				mock.Command("HMGET").ExpectError(fmt.Errorf("bad-hmget"))
+				_, e := r.FindToken(token.token)
+				g.Assert(e.Error()).Equal("bad-hmget")
+			})
+
+			g.It("successfully returns token details when hmget lookup passes", func() {
+				mock.Command("HMGET").ExpectSlice(
+					[]byte(token.id),
+					[]byte(token.name),
+					[]byte(token.deviceID),
+				)
+				_, e := r.FindToken(token.token)
+				g.Assert(e).Equal(nil)
+			})
+		})
+	})
+
+	g.Describe("AuthorizeToken", func() {
+		r, mock := subject()
+
+		fields := struct {
+			permission string
+			deviceID   string
+			id         string
+			name       string
+		}{
+			defs.RedisDeviceTokenPermissionField,
+			defs.RedisDeviceTokenDeviceIDField,
+			defs.RedisDeviceTokenIDField,
+			defs.RedisDeviceTokenNameField,
+		}
+
+		device := struct {
+			name   string
+			id     string
+			token  string
+			secret string
+		}{"test-device", "id-123", "4242424242", "421421421421421421421421"}
+
+		registryKey := r.genRegistryKey(device.id)
+
+		g.BeforeEach(mock.Clear)
+
+		g.AfterEach(func() {
+			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
+		})
+
+		g.It("returns false if unable to find device", func() {
+			mock.Command("EXISTS", registryKey).ExpectError(fmt.Errorf("bad-exists"))
+			b := r.AuthorizeToken(device.id, device.token, 1)
+			g.Assert(b).Equal(false)
+		})
+
+		g.It("returns false w/o scanning device names when the device id is not registered", func() {
+			mock.Command("EXISTS", registryKey).Expect([]byte("false"))
+			b := r.AuthorizeToken(device.id, device.token, 1)
+			g.Assert(b).Equal(false)
+			g.Assert(mock.history).Equal([]string{"EXISTS"})
+		})
+
+		g.Describe("having found a device via EXISTS", func() {
+			g.BeforeEach(func() {
+				mock.Command("EXISTS", registryKey).Expect([]byte("true"))
+			})
+
+			g.It("should return true if token matches device secret", func() {
+				mock.Command("HMGET", registryKey, "device:uuid", "device:name", "device:secret").ExpectSlice(
+					[]byte(device.id),
+					[]byte(device.name),
+					[]byte(device.secret),
+				)
+				b := r.AuthorizeToken(device.id, device.secret, 1)
+				g.Assert(b).Equal(true)
+			})
+
+			g.It("should not return true if unable to load in token details", func() {
+				mock.Command("HMGET", registryKey, "device:uuid", "device:name", "device:secret").ExpectSlice(
+					[]byte(device.id),
+					[]byte(device.name),
+					[]byte(device.secret),
+				)
+				mock.Command("HGET", r.genTokenRegistrationKey(device.token), fields.permission).ExpectError(fmt.Errorf(""))
+				b := r.AuthorizeToken(device.id, device.token, 1)
+				g.Assert(b).Equal(false)
+			})
+
+			g.Describe("with valid device + token information loaded", func() {
+				tokenKey := r.genTokenRegistrationKey(device.token)
+
+				g.BeforeEach(func() {
+					mock.Command("HMGET", registryKey, "device:uuid", "device:name", "device:secret").ExpectSlice(
+						[]byte(device.id),
+						[]byte(device.name),
+						[]byte(device.secret),
+					)
+					mock.Command("HMGET", tokenKey, fields.id, fields.name, fields.deviceID).ExpectSlice(
+						[]byte(device.id),
+						[]byte(device.name),
+						[]byte(device.id),
+					)
+				})
+
+				invalid := [][]string{
+					[]string{"100", "011"},
+					[]string{"100", "001"},
+					[]string{"100", "010"},
+					[]string{"100", "111"},
+					[]string{"010", "101"},
+					[]string{"010", "100"},
+					[]string{"010", "001"},
+					[]string{"010", "111"},
+					[]string{"001", "110"},
+					[]string{"001", "010"},
+					[]string{"001", "100"},
+					[]string{"001", "111"},
+				}
+
+				valid := [][]string{
+					[]string{"1100", "100"},
+					[]string{"1010", "010"},
+					[]string{"1001", "001"},
+				}
+
+				for _, masks := range invalid {
+					have, want := masks[0], masks[1]
+					g.It(fmt.Sprintf("should not return true if the token mask is invalid (%s vs %s)", have, want), func() {
+						mock.Command("HGET", tokenKey, fields.permission).Expect([]byte(have))
+						b := r.AuthorizeToken(device.id, device.token, mask(want))
+						g.Assert(b).Equal(false)
+					})
+				}
+
+				for _, masks := range valid {
+					have, want := masks[0], masks[1]
+					g.It(fmt.Sprintf("should return true if the token mask is valid (%s vs %s)", have, want), func() {
+						mock.Command("HGET", tokenKey, fields.permission).Expect([]byte(have))
+						b := r.AuthorizeToken(device.id, device.token, mask(want))
+						g.Assert(b).Equal(true)
+					})
+				}
+			})
+
+			g.Describe("w/ a token scoped to another device or group", func() {
+				tokenKey, admin := r.genTokenRegistrationKey(device.token), uint(defs.SecurityDeviceTokenPermissionAdmin)
+
+				load := func(scope string) {
+					mock.Command("HMGET", registryKey, "device:uuid", "device:name", "device:secret").ExpectSlice(
+						[]byte(device.id),
+						[]byte(device.name),
+						[]byte(device.secret),
+					)
+					mock.Command("HMGET", tokenKey, fields.id, fields.name, fields.deviceID).ExpectSlice(
+						[]byte("token-id"),
+						[]byte("token-name"),
+						[]byte(scope),
+					)
+					mock.Command("HGET", tokenKey, fields.permission).Expect([]byte("100"))
+				}
+
+				g.It("rejects tokens scoped to another device w/o checking group membership", func() {
+					load("other-device")
+					g.Assert(r.AuthorizeToken(device.id, device.token, admin)).Equal(false)
+					g.Assert(strings.Contains(strings.Join(mock.history, ","), "SISMEMBER")).Equal(false)
+				})
+
+				g.It("rejects tokens scoped to an invalid group id w/o checking group membership", func() {
+					load(defs.SecurityDeviceGroupPrefix)
+					g.Assert(r.AuthorizeToken(device.id, device.token, admin)).Equal(false)
+					g.Assert(strings.Contains(strings.Join(mock.history, ","), "SISMEMBER")).Equal(false)
+				})
+
+				g.It("allows group tokens against devices that are members of the group", func() {
+					load(defs.SecurityDeviceGroupPrefix + "kitchen")
+					mock.Command("SISMEMBER", r.genTagKey("kitchen"), device.id).Expect(int64(1))
+					g.Assert(r.AuthorizeToken(device.id, device.token, admin)).Equal(true)
+				})
+
+				g.It("rejects group tokens against devices that are not members of the group", func() {
+					load(defs.SecurityDeviceGroupPrefix + "kitchen")
+					mock.Command("SISMEMBER", r.genTagKey("kitchen"), device.id).Expect(int64(0))
+					g.Assert(r.AuthorizeToken(device.id, device.token, admin)).Equal(false)
+				})
+
+				g.It("rejects group tokens if unable to check group membership", func() {
+					load(defs.SecurityDeviceGroupPrefix + "kitchen")
+					mock.Command("SISMEMBER", r.genTagKey("kitchen"), device.id).ExpectError(fmt.Errorf("bad-sismember"))
+					g.Assert(r.AuthorizeToken(device.id, device.token, admin)).Equal(false)
+				})
+
+				g.It("still requires the group token to hold the requested permission", func() {
+					load(defs.SecurityDeviceGroupPrefix + "kitchen")
+					mock.Command("SISMEMBER", r.genTagKey("kitchen"), device.id).Expect(int64(1))
+					g.Assert(r.AuthorizeToken(device.id, device.token, 1)).Equal(false)
+				})
+			})
+		})
+	})
+
+	g.Describe("CreateToken", func() {
+		r, mock := subject()
+
+		g.BeforeEach(mock.Clear)
+
+		tokenPrefix := r.genKeyPrefix(defs.RedisDeviceTokenRegistrationKey)
+
+		testFixtures := struct {
+			deviceID        string
+			deviceName      string
+			deviceSecret    string
+			tokenName       string
+			tokenSecret     string
+			tokenPermission uint
+		}{"device-id", "a test device", "the device secret", "a test token", "token-secret", 7}
+
+		g.BeforeEach(func() {
+			generator.t = testFixtures.tokenSecret
+		})
+
+		g.AfterEach(func() {
+			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
+		})
+
+		// free marks the registration of each of the tokens as unused.
+		g.It("rejects permission masks w/ bits outside of the known permissions", func() {
+			permission := uint(defs.SecurityDeviceTokenPermissionAll + 1)
+			details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, permission)
+			g.Assert(e == defs.Error(defs.ErrInvalidTokenPermission)).Equal(true)
+			g.Assert(details.Token).Equal("")
+			g.Assert(len(mock.history)).Equal(0)
+		})
+
+		g.It("errors when unable to push into token list", func() {
+			mock.Command("EXISTS", r.genRegistryKey(testFixtures.deviceID)).ExpectError(fmt.Errorf("bad-exists"))
+			_, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+			g.Assert(e.Error()).Equal("bad-exists")
+		})
+
+		g.It("returns not found w/o scanning device names when the device id is not registered", func() {
+			mock.Command("EXISTS", r.genRegistryKey(testFixtures.deviceID)).Expect([]byte("false"))
+			_, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+			g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+			g.Assert(mock.history).Equal([]string{"EXISTS"})
+		})
+
+		g.It("creates group tokens w/o looking up a registered device", func() {
+			group := defs.SecurityDeviceGroupPrefix + "kitchen"
+			mock.Command(
+				"EVALSHA",
+				createTokenScript.sha,
+				2,
+				r.genTokenListKey(group),
+				r.genTokenRegistrationKey(testFixtures.tokenSecret),
+				testFixtures.tokenSecret,
+				0,
+				"",
+				tokenPrefix,
+				tokenFields.name,
+				tokenFields.name,
+				testFixtures.tokenName,
+				tokenFields.permission,
+				redigomock.NewAnyData(),
+				tokenFields.id,
+				redigomock.NewAnyData(),
+				tokenFields.device,
+				group,
+				defs.RedisSchemaVersionField,
+				defs.RedisSchemaVersion,
+			).Expect([]byte(tokenScriptCreated))
+			details, e := r.CreateToken(group, testFixtures.tokenName, testFixtures.tokenPermission)
+			g.Assert(e).Equal(nil)
+			g.Assert(details.DeviceID).Equal(group)
+			g.Assert(mock.history).Equal([]string{"EVALSHA"})
+		})
+
+		g.Describe("having found the device", func() {
+			g.BeforeEach(func() {
+				key := r.genRegistryKey(testFixtures.deviceID)
+				mock.Command("EXISTS", key).Expect([]byte("true"))
+				mock.Command("HMGET", key, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+					[]byte(testFixtures.deviceID),
+					[]byte(testFixtures.deviceName),
+					[]byte(testFixtures.deviceSecret),
+				)
+			})
+
+			scriptArgs := func() []interface{} {
+				return []interface{}{
+					2,
+					r.genTokenListKey(testFixtures.deviceID),
+					r.genTokenRegistrationKey(testFixtures.tokenSecret),
+					testFixtures.tokenSecret,
+					0,
+					"",
+					tokenPrefix,
+					tokenFields.name,
+					tokenFields.name,
+					testFixtures.tokenName,
+					tokenFields.permission,
+					redigomock.NewAnyData(),
+					tokenFields.id,
+					redigomock.NewAnyData(),
+					tokenFields.device,
+					testFixtures.deviceID,
+					defs.RedisSchemaVersionField,
+					defs.RedisSchemaVersion,
+				}
+			}
+
+			g.It("writes the token list entry and registration w/ the cached script", func() {
+				args := append([]interface{}{createTokenScript.sha}, scriptArgs()...)
+				mock.Command("EVALSHA", args...).Expect([]byte(tokenScriptCreated))
+				details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+				g.Assert(e).Equal(nil)
+				g.Assert(details.Token).Equal(testFixtures.tokenSecret)
+				g.Assert(details.DeviceID).Equal(testFixtures.deviceID)
+				g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA"})
+			})
+
+			g.It("persists valid combined permission masks", func() {
+				permission := uint(defs.SecurityDeviceTokenPermissionViewer | defs.SecurityDeviceTokenPermissionController)
+				args := append([]interface{}{createTokenScript.sha}, scriptArgs()...)
+				args[12] = "11"
+				mock.Command("EVALSHA", args...).Expect([]byte(tokenScriptCreated))
+				details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, permission)
+				g.Assert(e).Equal(nil)
+				g.Assert(details.Permission).Equal(permission)
+			})
+
+			g.It("loads and evaluates the script source when it is not cached by redis", func() {
+				args := append([]interface{}{createTokenScript.sha}, scriptArgs()...)
+				mock.Command("EVALSHA", args...).ExpectError(redis.Error("NOSCRIPT No matching script."))
+				mock.Command("SCRIPT", "LOAD", createTokenScript.source).Expect([]byte(createTokenScript.sha))
+				mock.Command("EVAL", append([]interface{}{createTokenScript.source}, scriptArgs()...)...).Expect([]byte(tokenScriptCreated))
+				_, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+				g.Assert(e).Equal(nil)
+				g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA", "SCRIPT", "EVAL"})
+			})
+
+			g.It("returns the scripting error w/o writing the list entry or registration", func() {
+				args := append([]interface{}{createTokenScript.sha}, scriptArgs()...)
+				mock.Command("EVALSHA", args...).ExpectError(redis.Error("WRONGTYPE token list has the wrong type"))
+				details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+				g.Assert(e.Error()).Equal("WRONGTYPE token list has the wrong type")
+				g.Assert(details.Token).Equal("")
+				g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA"})
+			})
+
+			g.Describe("w/ a max token count", func() {
+				g.BeforeEach(func() {
+					r.MaxTokens = 3
+				})
+
+				g.AfterEach(func() {
+					r.MaxTokens = 0
+				})
+
+				limited := func() []interface{} {
+					args := append([]interface{}{createTokenScript.sha}, scriptArgs()...)
+					args[5] = 3
+					return args
+				}
+
+				g.It("passes the max token count to the script", func() {
+					mock.Command("EVALSHA", limited()...).Expect([]byte(tokenScriptCreated))
+					details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e).Equal(nil)
+					g.Assert(details.Token).Equal(testFixtures.tokenSecret)
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA"})
+				})
+
+				g.It("rejects the token once the script reports the device's token list is full", func() {
+					mock.Command("EVALSHA", limited()...).Expect([]byte(tokenScriptLimitReached))
+					details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e == defs.Error(defs.ErrTokenLimitReached)).Equal(true)
+					g.Assert(details.Token).Equal("")
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA"})
+				})
+
+				g.It("creates the token once a slot in the token list has been freed", func() {
+					created := []byte(tokenScriptCreated)
+					mock.Command("EVALSHA", limited()...).Expect([]byte(tokenScriptLimitReached)).Expect(created)
+					_, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e == defs.Error(defs.ErrTokenLimitReached)).Equal(true)
+					details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e).Equal(nil)
+					g.Assert(details.Token).Equal(testFixtures.tokenSecret)
+				})
+			})
+
+			g.Describe("w/ unique token names", func() {
+				g.BeforeEach(func() {
+					r.UniqueTokenNames = true
+				})
+
+				g.AfterEach(func() {
+					r.UniqueTokenNames = false
+				})
+
+				unique := func() []interface{} {
+					args := append([]interface{}{createTokenScript.sha}, scriptArgs()...)
+					args[6] = testFixtures.tokenName
+					return args
+				}
+
+				g.It("passes the name to the script w/o checking the device's tokens beforehand", func() {
+					mock.Command("EVALSHA", unique()...).Expect([]byte(tokenScriptCreated))
+					details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e).Equal(nil)
+					g.Assert(details.Token).Equal(testFixtures.tokenSecret)
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA"})
+				})
+
+				g.It("rejects the token once the script reports the name is taken by another token of the device", func() {
+					mock.Command("EVALSHA", unique()...).Expect([]byte(tokenScriptDuplicateName))
+					details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e == defs.Error(defs.ErrDuplicateTokenName)).Equal(true)
+					g.Assert(details.Token).Equal("")
+				})
+
+				g.It("compares the names of the listed tokens before writing anything", func() {
+					source := createTokenScript.source
+					g.Assert(strings.Index(source, "duplicate-name") < strings.Index(source, `redis.call("LPUSH"`)).Equal(true)
+				})
+
+				g.Describe("in cluster mode", func() {
+					listKey := ""
+
+					g.BeforeEach(func() {
+						r.ClusterMode = true
+						listKey = r.genTokenListKey(testFixtures.deviceID)
+						key := r.genRegistryKey(testFixtures.deviceID)
+						mock.Command("EXISTS", key).Expect([]byte("true"))
+						mock.Command("HMGET", key, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+							[]byte(testFixtures.deviceID),
+							[]byte(testFixtures.deviceName),
+							[]byte(testFixtures.deviceSecret),
+						)
+					})
+
+					g.AfterEach(func() {
+						r.ClusterMode = false
+					})
+
+					g.It("checks the names of the device's tokens beforehand", func() {
+						existingKey := r.genTokenRegistrationKey("existing-token")
+						mock.Command("LRANGE", listKey, 0, -1).ExpectSlice([]byte("existing-token"))
+						mock.Command(
+							"HMGET",
+							existingKey,
+							tokenFields.id,
+							tokenFields.name,
+							tokenFields.device,
+							tokenFields.permission,
+						).ExpectSlice([]byte("token-id"), []byte(testFixtures.tokenName), []byte(testFixtures.deviceID), []byte("1"))
+						details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+						g.Assert(e == defs.Error(defs.ErrDuplicateTokenName)).Equal(true)
+						g.Assert(details.Token).Equal("")
+						g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "LRANGE", "HMGET"})
+					})
+
+					g.It("returns the error from loading the device's token list", func() {
+						mock.Command("LRANGE", listKey, 0, -1).ExpectError(fmt.Errorf("bad-lrange"))
+						_, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+						g.Assert(e.Error()).Equal("bad-lrange")
+					})
+				})
+			})
+
+			g.Describe("in cluster mode", func() {
+				registration := r.genTokenRegistrationKey(testFixtures.tokenSecret)
+				listKey := r.genTokenListKey(testFixtures.deviceID)
+
+				g.BeforeEach(func() {
+					r.ClusterMode = true
+					registration = r.genTokenRegistrationKey(testFixtures.tokenSecret)
+					listKey = r.genTokenListKey(testFixtures.deviceID)
+					key := r.genRegistryKey(testFixtures.deviceID)
+					mock.Command("EXISTS", key).Expect([]byte("true"))
+					mock.Command("HMGET", key, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+						[]byte(testFixtures.deviceID),
+						[]byte(testFixtures.deviceName),
+						[]byte(testFixtures.deviceSecret),
+					)
+				})
+
+				g.AfterEach(func() {
+					r.ClusterMode = false
+				})
+
+				register := func() []interface{} {
+					return append([]interface{}{registerTokenScript.sha, 1, registration}, scriptArgs()[8:]...)
+				}
+
+				push := func() []interface{} {
+					return []interface{}{pushTokenScript.sha, 1, listKey, testFixtures.tokenSecret, 0}
+				}
+
+				g.It("writes the registration before listing the token, each w/ keys of a single slot", func() {
+					mock.Command("EVALSHA", register()...).Expect([]byte(tokenScriptCreated))
+					mock.Command("EVALSHA", push()...).Expect([]byte(tokenScriptCreated))
+					details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e).Equal(nil)
+					g.Assert(details.Token).Equal(testFixtures.tokenSecret)
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA", "EVALSHA"})
+					g.Assert(mock.scripts).Equal([][]string{{registration}, {listKey}})
+				})
+
+				g.It("removes the registration once the script reports the device's token list is full", func() {
+					mock.Command("EVALSHA", register()...).Expect([]byte(tokenScriptCreated))
+					mock.Command("EVALSHA", push()...).Expect([]byte(tokenScriptLimitReached))
+					mock.Command("DEL", registration).Expect(int64(1))
+					details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e == defs.Error(defs.ErrTokenLimitReached)).Equal(true)
+					g.Assert(details.Token).Equal("")
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA", "EVALSHA", "DEL"})
+				})
+
+				g.It("removes the registration and returns the error when listing the token fails", func() {
+					mock.Command("EVALSHA", register()...).Expect([]byte(tokenScriptCreated))
+					mock.Command("EVALSHA", push()...).ExpectError(redis.Error("WRONGTYPE token list has the wrong type"))
+					mock.Command("DEL", registration).Expect(int64(1))
+					_, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e.Error()).Equal("WRONGTYPE token list has the wrong type")
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA", "EVALSHA", "DEL"})
+				})
+
+				g.It("generates another token w/o listing the one whose registration already exists", func() {
+					generator.sequence = []string{"taken-token", testFixtures.tokenSecret}
+					defer func() { generator.sequence = nil }()
+					taken := register()
+					taken[2] = r.genTokenRegistrationKey("taken-token")
+					mock.Command("EVALSHA", taken...).Expect([]byte(tokenScriptCollision))
+					mock.Command("EVALSHA", register()...).Expect([]byte(tokenScriptCreated))
+					mock.Command("EVALSHA", push()...).Expect([]byte(tokenScriptCreated))
+					details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e).Equal(nil)
+					g.Assert(details.Token).Equal(testFixtures.tokenSecret)
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA", "EVALSHA", "EVALSHA"})
+				})
+
+				g.It("does not list the token when the registration could not be written", func() {
+					mock.Command("EVALSHA", register()...).ExpectError(fmt.Errorf("bad-register"))
+					_, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e.Error()).Equal("bad-register")
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA"})
+				})
+			})
+
+			g.Describe("w/ a generated token that is already in use", func() {
+				takenArgs := func() []interface{} {
+					args := append([]interface{}{createTokenScript.sha}, scriptArgs()...)
+					args[3], args[4] = r.genTokenRegistrationKey("taken-token"), "taken-token"
+					return args
+				}
+
+				g.BeforeEach(func() {
+					generator.sequence = []string{"taken-token", testFixtures.tokenSecret}
+				})
+
+				g.AfterEach(func() {
+					generator.sequence = nil
+				})
+
+				g.It("generates another token once the script reports the registration exists", func() {
+					mock.Command("EVALSHA", takenArgs()...).Expect([]byte(tokenScriptCollision))
+					mock.Command("EVALSHA", append([]interface{}{createTokenScript.sha}, scriptArgs()...)...).Expect([]byte(tokenScriptCreated))
+					details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e).Equal(nil)
+					g.Assert(details.Token).Equal(testFixtures.tokenSecret)
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA", "EVALSHA"})
+				})
+
+				g.It("fails once every attempt has generated a token in use", func() {
+					generator.sequence = nil
+					generator.t = "taken-token"
+					defer func() { generator.t = testFixtures.tokenSecret }()
+					mock.Command("EVALSHA", takenArgs()...).Expect([]byte(tokenScriptCollision))
+					details, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
+					g.Assert(e == defs.Error(defs.ErrTokenGenerationFailed)).Equal(true)
+					g.Assert(details.Token).Equal("")
+					g.Assert(len(mock.history)).Equal(2 + defs.DefaultTokenGenerationAttempts)
+				})
+
+				g.It("checks whether the registration exists before writing anything", func() {
+					source := createTokenScript.source
+					g.Assert(strings.Index(source, "collision") < strings.Index(source, `redis.call("LPUSH"`)).Equal(true)
+					source = registerTokenScript.source
+					g.Assert(strings.Index(source, "collision") < strings.Index(source, `redis.call("HMSET"`)).Equal(true)
+				})
+			})
+		})
+
+		g.Describe("w/ unique token names and a name taken by another device", func() {
+			otherDevice := "other-device"
+
+			g.BeforeEach(func() {
+				r.UniqueTokenNames = true
+				key := r.genRegistryKey(otherDevice)
+				mock.Command("EXISTS", key).Expect([]byte("true"))
+				mock.Command("HMGET", key, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+					[]byte(otherDevice),
+					[]byte(testFixtures.deviceName),
+					[]byte(testFixtures.deviceSecret),
+				)
+			})
+
+			g.AfterEach(func() {
+				r.UniqueTokenNames = false
+			})
+
+			g.It("creates the token since only the tokens of the same device are checked", func() {
+				mock.Command(
+					"EVALSHA",
+					createTokenScript.sha,
+					2,
+					r.genTokenListKey(otherDevice),
+					r.genTokenRegistrationKey(testFixtures.tokenSecret),
+					testFixtures.tokenSecret,
+					0,
+					testFixtures.tokenName,
+					tokenPrefix,
+					tokenFields.name,
+					tokenFields.name,
+					testFixtures.tokenName,
+					tokenFields.permission,
+					redigomock.NewAnyData(),
+					tokenFields.id,
+					redigomock.NewAnyData(),
+					tokenFields.device,
+					otherDevice,
+					defs.RedisSchemaVersionField,
+					defs.RedisSchemaVersion,
+				).Expect([]byte(tokenScriptCreated))
+				details, e := r.CreateToken(otherDevice, testFixtures.tokenName, testFixtures.tokenPermission)
+				g.Assert(e).Equal(nil)
+				g.Assert(details.DeviceID).Equal(otherDevice)
+				g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "EVALSHA"})
+			})
+		})
+	})
+
+	g.Describe("command tracking", func() {
+		r, mock := subject()
+
+		g.BeforeEach(mock.Clear)
+
+		commandKey := r.genCommandKey("command-id")
+
+		fields := struct {
+			deviceID string
+			status   string
+			updated  string
+		}{defs.RedisCommandDeviceIDField, defs.RedisCommandStatusField, defs.RedisCommandUpdatedField}
+
+		g.Describe("TrackCommand", func() {
+			g.It("records the command as pending and expires it", func() {
+				set := mock.Command(
+					"HMSET",
+					commandKey,
+					fields.deviceID, "device-id",
+					fields.status, defs.CommandStatusPending,
+					fields.updated, redigomock.NewAnyData(),
+				).Expect("OK")
+				expire := mock.Command("EXPIRE", commandKey, int(defs.DefaultCommandStatusTTL.Seconds())).Expect(int64(1))
+				g.Assert(r.TrackCommand("command-id", "device-id")).Equal(nil)
+				g.Assert(mock.c.Stats(set)).Equal(1)
+				g.Assert(mock.c.Stats(expire)).Equal(1)
+			})
+
+			g.It("fails if unable to write the command", func() {
+				mock.Command(
+					"HMSET",
+					commandKey,
+					fields.deviceID, "device-id",
+					fields.status, defs.CommandStatusPending,
+					fields.updated, redigomock.NewAnyData(),
+				).ExpectError(fmt.Errorf("bad-set"))
+				g.Assert(r.TrackCommand("command-id", "device-id").Error()).Equal("bad-set")
+			})
+		})
+
+		g.Describe("UpdateCommandStatus", func() {
+			g.It("rejects statuses other than acked, failed or superseded", func() {
+				e := r.UpdateCommandStatus("command-id", "device-id", defs.CommandStatusPending)
+				g.Assert(e == defs.Error(defs.ErrInvalidCommandStatus)).Equal(true)
+				g.Assert(len(mock.history)).Equal(0)
+			})
+
+			g.It("returns not found for commands that are not tracked", func() {
+				mock.Command("HGET", commandKey, fields.deviceID).Expect(nil)
+				e := r.UpdateCommandStatus("command-id", "device-id", defs.CommandStatusAcknowledged)
+				g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+			})
+
+			g.It("returns not found for commands sent to another device", func() {
+				mock.Command("HGET", commandKey, fields.deviceID).Expect([]byte("other-device"))
+				e := r.UpdateCommandStatus("command-id", "device-id", defs.CommandStatusAcknowledged)
+				g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+				g.Assert(mock.history).Equal([]string{"HGET"})
+			})
+
+			g.It("updates the status of the command", func() {
+				mock.Command("HGET", commandKey, fields.deviceID).Expect([]byte("device-id"))
+				set := mock.Command(
+					"HMSET",
+					commandKey,
+					fields.status, defs.CommandStatusAcknowledged,
+					fields.updated, redigomock.NewAnyData(),
+				).Expect("OK")
+				g.Assert(r.UpdateCommandStatus("command-id", "device-id", defs.CommandStatusAcknowledged)).Equal(nil)
+				g.Assert(mock.c.Stats(set)).Equal(1)
+			})
+
+			g.It("marks commands as superseded", func() {
+				mock.Command("HGET", commandKey, fields.deviceID).Expect([]byte("device-id"))
+				set := mock.Command(
+					"HMSET",
+					commandKey,
+					fields.status, defs.CommandStatusSuperseded,
+					fields.updated, redigomock.NewAnyData(),
+				).Expect("OK")
+				g.Assert(r.UpdateCommandStatus("command-id", "device-id", defs.CommandStatusSuperseded)).Equal(nil)
+				g.Assert(mock.c.Stats(set)).Equal(1)
+			})
+		})
+
+		g.Describe("GetCommandStatus", func() {
+			g.It("returns not found for commands that are not tracked", func() {
+				mock.Command("EXISTS", commandKey).Expect(int64(0))
+				_, e := r.GetCommandStatus("command-id")
+				g.Assert(e == defs.Error(defs.ErrNotFound)).Equal(true)
+			})
+
+			g.It("returns the status of the command", func() {
+				mock.Command("EXISTS", commandKey).Expect(int64(1))
+				mock.Command("HMGET", commandKey, fields.deviceID, fields.status, fields.updated).ExpectSlice(
+					[]byte("device-id"),
+					[]byte(defs.CommandStatusAcknowledged),
+					[]byte("1500000000"),
+				)
+				status, e := r.GetCommandStatus("command-id")
+				g.Assert(e).Equal(nil)
+				g.Assert(status.CommandID).Equal("command-id")
+				g.Assert(status.DeviceID).Equal("device-id")
+				g.Assert(status.Status).Equal(defs.CommandStatusAcknowledged)
+				g.Assert(status.UpdatedAt.Equal(time.Unix(1500000000, 0))).Equal(true)
+			})
+
+			g.It("fails w/ an unparsable update time", func() {
+				mock.Command("EXISTS", commandKey).Expect(int64(1))
+				mock.Command("HMGET", commandKey, fields.deviceID, fields.status, fields.updated).ExpectSlice(
+					[]byte("device-id"),
+					[]byte(defs.CommandStatusPending),
+					[]byte("yesterday"),
+				)
+				_, e := r.GetCommandStatus("command-id")
+				g.Assert(e.Error()).Equal(defs.ErrBadRedisResponse)
+			})
+		})
+	})
+
+	g.Describe("LogFeedback", func() {
+		r, mock := subject()
+
+		g.BeforeEach(mock.Clear)
+
+		g.AfterEach(func() {
+			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
+		})
+
+		testFixtures := struct {
+			deviceID string
+		}{"12345"}
+
+		g.It("errors if the message does not have any authentication information", func() {
+			e := r.LogFeedback(interchange.FeedbackMessage{})
+			g.Assert(e.Error()).Equal(defs.ErrBadInterchangeAuthentication)
+		})
+
+		g.Describe("with a valid feedbackMessage", func() {
+			feedbackMessage := interchange.FeedbackMessage{
+				Authentication: &interchange.DeviceMessageAuthentication{
+					DeviceID: testFixtures.deviceID,
+				},
+			}
+
+			g.It("errors if the message has a bad device id", func() {
+				mock.Command("EXISTS", r.genRegistryKey(testFixtures.deviceID)).ExpectError(fmt.Errorf("bad-exists"))
+				e := r.LogFeedback(feedbackMessage)
+				g.Assert(e.Error()).Equal("bad-exists")
+			})
+
+			g.Describe("with a valid device", func() {
+				g.BeforeEach(func() {
+					key := r.genRegistryKey(testFixtures.deviceID)
+					mock.Command("EXISTS", key).Expect([]byte("true"))
+					mock.Command("HMGET", key, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+						[]byte(testFixtures.deviceID),
+						[]byte("buffalo-bills"),
+						[]byte("red-sox"),
+					)
+				})
+
+				g.It("errors if the it is unable to get the length of messages currently in the list", func() {
+					key := r.genFeedbackKey(testFixtures.deviceID)
+					mock.Command("LLEN", key).ExpectError(fmt.Errorf("bad-llen"))
+					e := r.LogFeedback(feedbackMessage)
+					g.Assert(e.Error()).Equal("bad-llen")
+				})
+
+				g.It("errors if the it is unable to push into the registry", func() {
+					key := r.genFeedbackKey(testFixtures.deviceID)
+					mock.Command("LLEN", key).Expect([]byte("0"))
+					mock.Command("LPUSH", key, redigomock.NewAnyData()).ExpectError(fmt.Errorf("bad-push"))
+					e := r.LogFeedback(feedbackMessage)
+					g.Assert(e.Error()).Equal("bad-push")
+				})
+
+				g.Describe("having more entries than the maximum amount", func() {
+					g.BeforeEach(func() {
+						key := r.genFeedbackKey(testFixtures.deviceID)
+						mock.Command("LLEN", key).Expect([]byte(fmt.Sprintf("%d", defs.RedisMaxFeedbackEntries+1)))
+					})
+
+					g.It("attempts to trim the list down to size", func() {
+						key := r.genFeedbackKey(testFixtures.deviceID)
+						mock.Command("LTRIM", key, 0, defs.RedisMaxFeedbackEntries-2).ExpectError(fmt.Errorf("bad-trim"))
+						e := r.LogFeedback(feedbackMessage)
+						g.Assert(e.Error()).Equal("bad-trim")
+					})
+				})
+
+				g.It("succeeds if the it is able to push into the registry", func() {
+					key := r.genFeedbackKey(testFixtures.deviceID)
+					mock.Command("LLEN", key).Expect([]byte("0"))
+					mock.Command("LPUSH", key, redigomock.NewAnyData()).Expect(nil)
+					e := r.LogFeedback(feedbackMessage)
+					g.Assert(e).Equal(nil)
+				})
+
+				g.It("stamps the entry w/ the time it was received", func() {
+					capture := &feedbackCapture{}
+					key := r.genFeedbackKey(testFixtures.deviceID)
+					mock.Command("LLEN", key).Expect([]byte("0"))
+					mock.Command("LPUSH", key, capture).Expect(nil)
+					before := time.Now().Unix()
+					e := r.LogFeedback(feedbackMessage)
+					g.Assert(e).Equal(nil)
+					g.Assert(capture.message == nil).Equal(false)
+					g.Assert(capture.message.Timestamp >= before).Equal(true)
+					g.Assert(capture.message.Timestamp <= time.Now().Unix()).Equal(true)
+				})
+
+				g.It("records the reported firmware version on the device registry hash", func() {
+					key := r.genFeedbackKey(testFixtures.deviceID)
+					mock.Command("LLEN", key).Expect([]byte("0"))
+					mock.Command("LPUSH", key, redigomock.NewAnyData()).Expect(nil)
+					update := mock.Command("HSET", r.genRegistryKey(testFixtures.deviceID), defs.RedisDeviceFirmwareField, "1.2.0")
+					reported := feedbackMessage
+					reported.Firmware = "1.2.0"
+					g.Assert(r.LogFeedback(reported)).Equal(nil)
+					g.Assert(mock.c.Stats(update)).Equal(1)
+				})
+
+				g.It("dispatches a feedback event after pushing into the registry", func() {
+					events := &fakeEventDispatcher{}
+					r.Events = events
+					defer func() { r.Events = nil }()
+					key := r.genFeedbackKey(testFixtures.deviceID)
+					mock.Command("LLEN", key).Expect([]byte("0"))
+					mock.Command("LPUSH", key, redigomock.NewAnyData()).Expect(nil)
+					e := r.LogFeedback(feedbackMessage)
+					g.Assert(e).Equal(nil)
+					g.Assert(len(events.events)).Equal(1)
+					g.Assert(events.events[0].kind).Equal(defs.WebhookDeviceFeedbackEvent)
+					g.Assert(events.events[0].deviceID).Equal(testFixtures.deviceID)
+				})
+			})
+		})
+	})
+
+	g.Describe("RecordFeedback", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		deviceID := "12345"
+		registryKey, feedbackKey := r.genRegistryKey(deviceID), r.genFeedbackKey(deviceID)
+
+		message := interchange.FeedbackMessage{
+			Authentication: &interchange.DeviceMessageAuthentication{DeviceID: deviceID},
+			Firmware:       "1.2.0",
+		}
+
+		g.AfterEach(func() {
+			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
+		})
+
+		g.BeforeEach(func() {
+			mock.Command("EXISTS", registryKey).Expect([]byte("true"))
+			mock.Command("HMGET", registryKey, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+				[]byte(deviceID),
+				[]byte("buffalo-bills"),
+				[]byte("red-sox"),
+			)
+			mock.Command("LLEN", feedbackKey).Expect([]byte("0"))
+		})
+
+		g.It("errors if unable to push into the registry", func() {
+			mock.Command("LPUSH", feedbackKey, redigomock.NewAnyData()).ExpectError(fmt.Errorf("bad-push"))
+			g.Assert(r.RecordFeedback(message).Error()).Equal("bad-push")
+		})
+
+		g.It("pushes the entry w/o updating the last seen time or firmware version of the device", func() {
+			push := mock.Command("LPUSH", feedbackKey, redigomock.NewAnyData()).Expect(nil)
+			g.Assert(r.RecordFeedback(message)).Equal(nil)
+			g.Assert(mock.c.Stats(push)).Equal(1)
+			g.Assert(strings.Contains(strings.Join(mock.history, ","), "HSET")).Equal(false)
+		})
+	})
+
+	g.Describe("LogFeedbackBatch", func() {
+		r, mock := subject()
+		g.BeforeEach(mock.Clear)
+
+		known, unknown := "12345", "67890"
+		feedbackKey := r.genFeedbackKey(known)
+		signer, public := genSigningKey()
+		other, _ := genSigningKey()
+
+		message := func(deviceID string) interchange.FeedbackMessage {
+			auth := &interchange.DeviceMessageAuthentication{DeviceID: deviceID}
+			return signFeedback(signer, interchange.FeedbackMessage{Authentication: auth, Payload: []byte("payload")})
+		}
+
+		g.BeforeEach(func() {
+			key := r.genRegistryKey(known)
+			mock.Command("EXISTS", key).Expect(int64(1))
+			mock.Command("HMGET", key, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+				[]byte(known),
+				[]byte("buffalo-bills"),
+				[]byte(public),
+			)
+			mock.Command("EXISTS", r.genRegistryKey(unknown)).Expect(int64(0))
+			mock.Command("KEYS", fmt.Sprintf("%s*", defs.RedisDeviceRegistryKey)).ExpectSlice()
+		})
+
+		g.It("logs the valid messages of a mixed batch in a single push, reporting the invalid ones", func() {
+			push := mock.Command("LPUSH", feedbackKey, redigomock.NewAnyData(), redigomock.NewAnyData()).Expect(int64(2))
+			mock.Command("LTRIM", feedbackKey, 0, defs.RedisMaxFeedbackEntries-1).Expect("OK")
+
+			batch := []interchange.FeedbackMessage{message(known), {}, message(unknown), message(known)}
+			e := r.LogFeedbackBatch(batch)
+
+			failures, ok := e.(FeedbackBatchError)
+			g.Assert(ok).Equal(true)
+			g.Assert(len(failures)).Equal(2)
+			g.Assert(failures[1]).Equal(defs.Error(defs.ErrBadInterchangeAuthentication))
+			g.Assert(failures[2]).Equal(defs.Error(defs.ErrNotFound))
+			g.Assert(mock.c.Stats(push)).Equal(1)
+		})
+
+		g.It("reports messages w/ a digest not signed by the device w/o discarding the rest of the batch", func() {
+			push := mock.Command("LPUSH", feedbackKey, redigomock.NewAnyData()).Expect(int64(1))
+			mock.Command("LTRIM", feedbackKey, 0, defs.RedisMaxFeedbackEntries-1).Expect("OK")
+			forged := signFeedback(other, message(known))
+			e := r.LogFeedbackBatch([]interchange.FeedbackMessage{forged, message(known)})
+			failures, ok := e.(FeedbackBatchError)
+			g.Assert(ok).Equal(true)
+			g.Assert(len(failures)).Equal(1)
+			g.Assert(failures[0]).Equal(defs.Error(defs.ErrBadInterchangeAuthentication))
+			g.Assert(mock.c.Stats(push)).Equal(1)
+		})
+
+		g.It("returns nil when every message has been logged", func() {
+			mock.Command("LPUSH", feedbackKey, redigomock.NewAnyData()).Expect(int64(1))
+			mock.Command("LTRIM", feedbackKey, 0, defs.RedisMaxFeedbackEntries-1).Expect("OK")
+			g.Assert(r.LogFeedbackBatch([]interchange.FeedbackMessage{message(known)})).Equal(nil)
+		})
+
+		g.It("trims the feedback stack back to capacity when the batch pushes it over", func() {
+			mock.Command("LPUSH", feedbackKey, redigomock.NewAnyData(), redigomock.NewAnyData()).Expect(
+				int64(defs.RedisMaxFeedbackEntries + 1),
+			)
+			trim := mock.Command("LTRIM", feedbackKey, 0, defs.RedisMaxFeedbackEntries-1).Expect("OK")
+			e := r.LogFeedbackBatch([]interchange.FeedbackMessage{message(known), message(known)})
+			g.Assert(e).Equal(nil)
+			g.Assert(mock.c.Stats(trim)).Equal(1)
+		})
+
+		g.It("records the latest firmware version reported by each device in the batch", func() {
+			mock.Command("LPUSH", feedbackKey, redigomock.NewAnyData(), redigomock.NewAnyData()).Expect(int64(2))
+			mock.Command("LTRIM", feedbackKey, 0, defs.RedisMaxFeedbackEntries-1).Expect("OK")
+			older := mock.Command("HSET", r.genRegistryKey(known), defs.RedisDeviceFirmwareField, "1.1.0").Expect(int64(1))
+			latest := mock.Command("HSET", r.genRegistryKey(known), defs.RedisDeviceFirmwareField, "1.2.0").Expect(int64(1))
+			first, second := message(known), message(known)
+			first.Firmware, second.Firmware = "1.1.0", "1.2.0"
+			g.Assert(r.LogFeedbackBatch([]interchange.FeedbackMessage{first, second})).Equal(nil)
+			g.Assert(mock.c.Stats(older)).Equal(0)
+			g.Assert(mock.c.Stats(latest)).Equal(1)
+		})
+
+		g.It("leaves the firmware version in place when none was reported", func() {
+			mock.Command("LPUSH", feedbackKey, redigomock.NewAnyData()).Expect(int64(1))
+			mock.Command("LTRIM", feedbackKey, 0, defs.RedisMaxFeedbackEntries-1).Expect("OK")
+			update := mock.Command("HSET", r.genRegistryKey(known), defs.RedisDeviceFirmwareField, redigomock.NewAnyData())
+			g.Assert(r.LogFeedbackBatch([]interchange.FeedbackMessage{message(known)})).Equal(nil)
+			g.Assert(mock.c.Stats(update)).Equal(0)
+		})
+
+		g.It("reports every message of a device whose push fails", func() {
+			mock.Command("LPUSH", feedbackKey, redigomock.NewAnyData(), redigomock.NewAnyData()).ExpectError(
+				fmt.Errorf("bad-push"),
+			)
+			e := r.LogFeedbackBatch([]interchange.FeedbackMessage{message(known), message(known)})
+			failures, _ := e.(FeedbackBatchError)
+			g.Assert(len(failures)).Equal(2)
+			g.Assert(failures[0].Error()).Equal("bad-push")
+		})
+	})
+
+	g.Describe("Close", func() {
+		var r RedisRegistry
+		var mock *redisMock
+
+		g.BeforeEach(func() {
+			r, mock = subject()
+		})
+
+		g.It("closes the connection pool", func() {
+			g.Assert(r.Close()).Equal(nil)
+			g.Assert(r.Pool.Get().Err() != nil).Equal(true)
+		})
+
+		g.It("is safe to close more than once", func() {
+			g.Assert(r.Close()).Equal(nil)
+			g.Assert(r.Close()).Equal(nil)
+		})
+
+		g.It("fails commands sent after the registry was closed w/o using the pool", func() {
+			r.Close()
+			_, e := r.Do("GET", "some-key")
+			g.Assert(e.Error()).Equal(defs.ErrRegistryClosed)
+			g.Assert(len(mock.history)).Equal(0)
+		})
+
+		g.It("fails lookups and pipelined writes after the registry was closed", func() {
+			r.Close()
+			_, e := r.FindDeviceByID("some-device")
+			g.Assert(e.Error()).Equal(defs.ErrRegistryClosed)
+			_, e = r.loadDetailsBatch([]string{r.genRegistryKey("some-device")})
+			g.Assert(e.Error()).Equal(defs.ErrRegistryClosed)
+			g.Assert(r.pushFeedback(r.genFeedbackKey("some-device"), []string{"entry"}).Error()).Equal(defs.ErrRegistryClosed)
+		})
+	})
+
+	g.Describe("w/ the stream feedback backend", func() {
+		r, mock := subject()
+		r.FeedbackBackend = defs.FeedbackBackendStream
+
+		deviceID := "12345"
+		streamKey := r.genFeedbackKey(deviceID)
+		signer, public := genSigningKey()
 
 		g.BeforeEach(func() {
-			generator.t = testFixtures.tokenSecret
+			mock.Clear()
+			key := r.genRegistryKey(deviceID)
+			mock.Command("EXISTS", key).Expect(int64(1))
+			mock.Command("HMGET", key, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
+				[]byte(deviceID),
+				[]byte("buffalo-bills"),
+				[]byte(public),
+			)
 		})
 
 		g.AfterEach(func() {
 			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
 		})
 
-		g.It("errors when unable to push into token list", func() {
-			mock.Command("EXISTS", r.genRegistryKey(testFixtures.deviceID)).ExpectError(fmt.Errorf("bad-exists"))
-			_, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
-			g.Assert(e.Error()).Equal("bad-exists")
+		entry := func(id, payload string) interface{} {
+			message := interchange.FeedbackMessage{Payload: []byte(payload)}
+			text := []byte(proto.MarshalTextString(&message))
+			return []interface{}{[]byte(id), []interface{}{[]byte(defs.RedisFeedbackStreamField), text}}
+		}
+
+		payloads := func(messages []interchange.FeedbackMessage) []string {
+			result := make([]string, 0, len(messages))
+
+			for _, message := range messages {
+				result = append(result, string(message.Payload))
+			}
+
+			return result
+		}
+
+		g.It("stores feedback under a key separate from the list backend", func() {
+			list := &RedisRegistry{}
+			g.Assert(streamKey == list.genFeedbackKey(deviceID)).Equal(false)
 		})
 
-		g.Describe("having found the device", func() {
-			g.BeforeEach(func() {
-				key := r.genRegistryKey(testFixtures.deviceID)
-				mock.Command("EXISTS", key).Expect([]byte("true"))
-				mock.Command("HMGET", key, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
-					[]byte(testFixtures.deviceID),
-					[]byte(testFixtures.deviceName),
-					[]byte(testFixtures.deviceSecret),
-				)
-			})
+		g.Describe("logging feedback", func() {
+			message := interchange.FeedbackMessage{
+				Authentication: &interchange.DeviceMessageAuthentication{DeviceID: deviceID},
+			}
 
-			g.It("returns an error if unable to push into the token list", func() {
-				key := r.genTokenListKey(testFixtures.deviceID)
-				mock.Command("LPUSH", key, testFixtures.tokenSecret).ExpectError(fmt.Errorf("bad-push"))
-				_, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
-				g.Assert(e.Error()).Equal("bad-push")
+			g.It("adds the entry to the stream, trimming it to the max amount of entries w/o checking its length", func() {
+				capture := &feedbackCapture{}
+				add := mock.Command(
+					"XADD", streamKey, "MAXLEN", defs.RedisMaxFeedbackEntries, "*", defs.RedisFeedbackStreamField, capture,
+				).Expect([]byte("1500000000000-0"))
+				g.Assert(r.LogFeedback(message)).Equal(nil)
+				g.Assert(mock.c.Stats(add)).Equal(1)
+				g.Assert(capture.message == nil).Equal(false)
+				g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "XADD", "HSET"})
 			})
 
-			g.It("returns an error if unable to set token fields in the token registry", func() {
-				listKey := r.genTokenListKey(testFixtures.deviceID)
-				tokenRegistryKey := r.genTokenRegistrationKey(generator.t)
-				mock.Command("LPUSH", listKey, testFixtures.tokenSecret).Expect(nil)
+			g.It("returns the error if unable to add the entry to the stream", func() {
 				mock.Command(
-					"HMSET",
-					tokenRegistryKey,
-					tokenFields.name,
-					testFixtures.tokenName,
-					tokenFields.permission,
-					redigomock.NewAnyData(),
-					tokenFields.id,
+					"XADD", streamKey, "MAXLEN", defs.RedisMaxFeedbackEntries, "*", defs.RedisFeedbackStreamField,
 					redigomock.NewAnyData(),
-					tokenFields.device,
-					testFixtures.deviceID,
-				).ExpectError(fmt.Errorf("bad-set"))
-				_, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
-				g.Assert(e.Error()).Equal("bad-set")
+				).ExpectError(fmt.Errorf("bad-xadd"))
+				g.Assert(r.LogFeedback(message).Error()).Equal("bad-xadd")
 			})
 
-			g.It("returns successfully if able to set token fields in the token registry", func() {
-				listKey := r.genTokenListKey(testFixtures.deviceID)
-				tokenRegistryKey := r.genTokenRegistrationKey(generator.t)
-				mock.Command("LPUSH", listKey, testFixtures.tokenSecret).Expect(nil)
-				mock.Command(
-					"HMSET",
-					tokenRegistryKey,
-					tokenFields.name,
-					testFixtures.tokenName,
-					tokenFields.permission,
-					redigomock.NewAnyData(),
-					tokenFields.id,
+			g.It("adds each entry of a batch to the stream in a single round trip", func() {
+				add := mock.Command(
+					"XADD", streamKey, "MAXLEN", defs.RedisMaxFeedbackEntries, "*", defs.RedisFeedbackStreamField,
 					redigomock.NewAnyData(),
-					tokenFields.device,
-					testFixtures.deviceID,
-				).Expect(nil)
-				_, e := r.CreateToken(testFixtures.deviceID, testFixtures.tokenName, testFixtures.tokenPermission)
-				g.Assert(e).Equal(nil)
+				).Expect([]byte("1500000000000-0"))
+				signed := signFeedback(signer, message)
+				g.Assert(r.LogFeedbackBatch([]interchange.FeedbackMessage{signed, signed})).Equal(nil)
+				g.Assert(mock.c.Stats(add)).Equal(2)
 			})
-
 		})
-	})
-
-	g.Describe("LogFeedback", func() {
-		r, mock := subject()
-
-		g.BeforeEach(mock.Clear)
 
-		g.AfterEach(func() {
-			g.Assert(mock.ExpectationsWereMet()).Equal(nil)
-		})
+		g.Describe("listing feedback", func() {
+			g.It("reads the latest entries of the stream, newest first", func() {
+				mock.Command("XREVRANGE", streamKey, "+", "-", "COUNT", 2).Expect([]interface{}{
+					entry("1500000000002-0", "third"),
+					entry("1500000000001-0", "second"),
+				})
+				results, e := r.ListFeedback(deviceID, 1)
+				g.Assert(e).Equal(nil)
+				g.Assert(payloads(results)).Equal([]string{"third", "second"})
+			})
 
-		testFixtures := struct {
-			deviceID string
-		}{"12345"}
+			g.It("reads every entry of the stream w/o a count", func() {
+				mock.Command("XREVRANGE", streamKey, "+", "-").Expect([]interface{}{entry("1500000000000-0", "first")})
+				results, e := r.ListFeedback(deviceID, -1)
+				g.Assert(e).Equal(nil)
+				g.Assert(payloads(results)).Equal([]string{"first"})
+			})
 
-		g.It("errors if the message does not have any authentication information", func() {
-			e := r.LogFeedback(interchange.FeedbackMessage{})
-			g.Assert(e.Error()).Equal(defs.ErrBadInterchangeAuthentication)
+			g.It("fails w/ a bad redis response when the stream entries are malformed", func() {
+				mock.Command("XREVRANGE", streamKey, "+", "-", "COUNT", 2).Expect([]interface{}{[]byte("garbage")})
+				_, e := r.ListFeedback(deviceID, 1)
+				g.Assert(e).Equal(defs.Error(defs.ErrBadRedisResponse))
+			})
 		})
 
-		g.Describe("with a valid feedbackMessage", func() {
-			feedbackMessage := interchange.FeedbackMessage{
-				Authentication: &interchange.DeviceMessageAuthentication{
-					DeviceID: testFixtures.deviceID,
-				},
-			}
-
-			g.It("errors if the message has a bad device id", func() {
-				mock.Command("EXISTS", r.genRegistryKey(testFixtures.deviceID)).ExpectError(fmt.Errorf("bad-exists"))
-				e := r.LogFeedback(feedbackMessage)
-				g.Assert(e.Error()).Equal("bad-exists")
+		g.Describe("paging through feedback", func() {
+			g.It("returns the id of the last entry as the cursor of a full page", func() {
+				mock.Command("XREVRANGE", streamKey, "+", "-", "COUNT", 2).Expect([]interface{}{
+					entry("1500000000002-0", "third"),
+					entry("1500000000001-0", "second"),
+				})
+				results, cursor, e := r.ListFeedbackPage(deviceID, "", 2)
+				g.Assert(e).Equal(nil)
+				g.Assert(payloads(results)).Equal([]string{"third", "second"})
+				g.Assert(cursor).Equal("1500000000001-0")
 			})
 
-			g.Describe("with a valid device", func() {
-				g.BeforeEach(func() {
-					key := r.genRegistryKey(testFixtures.deviceID)
-					mock.Command("EXISTS", key).Expect([]byte("true"))
-					mock.Command("HMGET", key, deviceFields.id, deviceFields.name, deviceFields.secret).ExpectSlice(
-						[]byte(testFixtures.deviceID),
-						[]byte("buffalo-bills"),
-						[]byte("red-sox"),
-					)
+			g.It("reads the entries older than the cursor, skipping the cursor entry itself", func() {
+				mock.Command("XREVRANGE", streamKey, "1500000000001-0", "-", "COUNT", 3).Expect([]interface{}{
+					entry("1500000000001-0", "second"),
+					entry("1500000000000-0", "first"),
 				})
+				results, cursor, e := r.ListFeedbackPage(deviceID, "1500000000001-0", 2)
+				g.Assert(e).Equal(nil)
+				g.Assert(payloads(results)).Equal([]string{"first"})
+				g.Assert(cursor).Equal("")
+			})
 
-				g.It("errors if the it is unable to get the length of messages currently in the list", func() {
-					key := r.genFeedbackKey(testFixtures.deviceID)
-					mock.Command("LLEN", key).ExpectError(fmt.Errorf("bad-llen"))
-					e := r.LogFeedback(feedbackMessage)
-					g.Assert(e.Error()).Equal("bad-llen")
+			g.It("still pages from the cursor once its entry has been trimmed from the stream", func() {
+				mock.Command("XREVRANGE", streamKey, "1500000000001-0", "-", "COUNT", 2).Expect([]interface{}{
+					entry("1500000000000-5", "first"),
 				})
+				results, cursor, e := r.ListFeedbackPage(deviceID, "1500000000001-0", 1)
+				g.Assert(e).Equal(nil)
+				g.Assert(payloads(results)).Equal([]string{"first"})
+				g.Assert(cursor).Equal("1500000000000-5")
+			})
 
-				g.It("errors if the it is unable to push into the registry", func() {
-					key := r.genFeedbackKey(testFixtures.deviceID)
-					mock.Command("LLEN", key).Expect([]byte("0"))
-					mock.Command("LPUSH", key, redigomock.NewAnyData()).ExpectError(fmt.Errorf("bad-push"))
-					e := r.LogFeedback(feedbackMessage)
-					g.Assert(e.Error()).Equal("bad-push")
-				})
+			g.It("fails w/o reading the stream given a cursor that is not an entry id", func() {
+				_, _, e := r.ListFeedbackPage(deviceID, "not-an-id", 2)
+				g.Assert(e).Equal(defs.Error(defs.ErrInvalidFeedbackCursor))
+				g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET"})
+			})
 
-				g.Describe("having more entries than the maximum amount", func() {
-					g.BeforeEach(func() {
-						key := r.genFeedbackKey(testFixtures.deviceID)
-						mock.Command("LLEN", key).Expect([]byte(fmt.Sprintf("%d", defs.RedisMaxFeedbackEntries+1)))
-					})
+			g.It("queries the stream a page at a time using the cursor of each page", func() {
+				page := make([]interface{}, 0, defs.RedisFeedbackQueryPageSize)
 
-					g.It("attempts to trim the list down to size", func() {
-						key := r.genFeedbackKey(testFixtures.deviceID)
-						mock.Command("LTRIM", key, 0, defs.RedisMaxFeedbackEntries-2).ExpectError(fmt.Errorf("bad-trim"))
-						e := r.LogFeedback(feedbackMessage)
-						g.Assert(e.Error()).Equal("bad-trim")
-					})
-				})
+				for i := defs.RedisFeedbackQueryPageSize; i > 0; i-- {
+					page = append(page, entry(fmt.Sprintf("15000000000%02d-0", i), "newer"))
+				}
 
-				g.It("succeeds if the it is able to push into the registry", func() {
-					key := r.genFeedbackKey(testFixtures.deviceID)
-					mock.Command("LLEN", key).Expect([]byte("0"))
-					mock.Command("LPUSH", key, redigomock.NewAnyData()).Expect(nil)
-					e := r.LogFeedback(feedbackMessage)
-					g.Assert(e).Equal(nil)
-				})
+				mock.Command("XREVRANGE", streamKey, "+", "-", "COUNT", defs.RedisFeedbackQueryPageSize).Expect(page)
+				mock.Command("XREVRANGE", streamKey, "1500000000001-0", "-", "COUNT", defs.RedisFeedbackQueryPageSize+1).Expect(
+					[]interface{}{entry("1500000000001-0", "newer"), entry("1500000000000-0", "oldest")},
+				)
+
+				results, e := r.QueryFeedback(deviceID, FeedbackQuery{})
+				g.Assert(e).Equal(nil)
+				g.Assert(len(results)).Equal(defs.RedisFeedbackQueryPageSize + 1)
+				g.Assert(string(results[defs.RedisFeedbackQueryPageSize].Payload)).Equal("oldest")
 			})
 		})
 	})
@@ -986,6 +4777,13 @@ func Test_RedisRegistry(t *testing.T) {
 			g.Assert(e.Error()).Equal("bad-exists")
 		})
 
+		g.It("fails to query feedback w/ a since time after the until time w/o loading the device", func() {
+			query := FeedbackQuery{Since: time.Unix(1500000100, 0), Until: time.Unix(1500000000, 0)}
+			_, e := r.QueryFeedback(device.id, query)
+			g.Assert(e.Error()).Equal(defs.ErrInvalidFeedbackRange)
+			g.Assert(len(mock.history)).Equal(0)
+		})
+
 		g.Describe("having found the device", func() {
 			g.BeforeEach(func() {
 				key := r.genRegistryKey(device.id)
@@ -1039,6 +4837,333 @@ func Test_RedisRegistry(t *testing.T) {
 				g.Assert(e).Equal(nil)
 				g.Assert(len(results)).Equal(3)
 			})
+
+			g.It("pages through the feedback stack using offsets as cursors", func() {
+				key := r.genFeedbackKey(device.id)
+				mock.Command("LRANGE", key, 2, 3).ExpectSlice(genFeedback(), genFeedback())
+				results, cursor, e := r.ListFeedbackPage(device.id, "2", 2)
+				g.Assert(e).Equal(nil)
+				g.Assert(len(results)).Equal(2)
+				g.Assert(cursor).Equal("4")
+			})
+
+			g.It("fails to page through the feedback stack w/ a cursor that is not an offset", func() {
+				_, _, e := r.ListFeedbackPage(device.id, "1500000000000-0", 2)
+				g.Assert(e).Equal(defs.Error(defs.ErrInvalidFeedbackCursor))
+			})
+
+			g.It("preserves the timestamp of entries, defaulting to the zero time for older entries", func() {
+				key, received := r.genFeedbackKey(device.id), time.Unix(1500000000, 0)
+				stamped := interchange.FeedbackMessage{Timestamp: received.Unix()}
+				mock.Command("LRANGE", key, 0, 3).ExpectSlice(
+					[]byte(proto.MarshalTextString(&stamped)),
+					[]byte(proto.MarshalTextString(&interchange.FeedbackMessage{})),
+				)
+				results, e := r.ListFeedback(device.id, 3)
+				g.Assert(e).Equal(nil)
+				g.Assert(FeedbackTime(results[0]).Equal(received)).Equal(true)
+				g.Assert(FeedbackTime(results[1]).IsZero()).Equal(true)
+			})
+
+			g.Describe("ListFeedbackByLevel", func() {
+				leveled := func(payload string, level interchange.FeedbackLevel) []byte {
+					message := interchange.FeedbackMessage{Payload: []byte(payload), Level: level}
+					return []byte(proto.MarshalTextString(&message))
+				}
+
+				g.BeforeEach(func() {
+					mock.Command("LRANGE", r.genFeedbackKey(device.id), 0, defs.RedisFeedbackQueryPageSize-1).ExpectSlice(
+						leveled("first", interchange.FeedbackLevel_LEVEL_ERROR),
+						leveled("second", interchange.FeedbackLevel_LEVEL_INFO),
+						leveled("third", interchange.FeedbackLevel_LEVEL_WARN),
+						leveled("fourth", interchange.FeedbackLevel(42)),
+						leveled("fifth", interchange.FeedbackLevel_LEVEL_ERROR),
+					)
+				})
+
+				payloads := func(messages []interchange.FeedbackMessage) []string {
+					result := make([]string, 0, len(messages))
+
+					for _, message := range messages {
+						result = append(result, string(message.Payload))
+					}
+
+					return result
+				}
+
+				g.It("returns only the entries at or above the minimum level", func() {
+					results, e := r.ListFeedbackByLevel(device.id, 10, interchange.FeedbackLevel_LEVEL_WARN)
+					g.Assert(e).Equal(nil)
+					g.Assert(payloads(results)).Equal([]string{"first", "third", "fifth"})
+				})
+
+				g.It("treats entries w/ an unknown level as info", func() {
+					results, e := r.ListFeedbackByLevel(device.id, 10, interchange.FeedbackLevel_LEVEL_INFO)
+					g.Assert(e).Equal(nil)
+					g.Assert(payloads(results)).Equal([]string{"first", "second", "third", "fourth", "fifth"})
+				})
+
+				g.It("returns at most the requested amount of entries", func() {
+					results, e := r.ListFeedbackByLevel(device.id, 1, interchange.FeedbackLevel_LEVEL_ERROR)
+					g.Assert(e).Equal(nil)
+					g.Assert(payloads(results)).Equal([]string{"first"})
+				})
+
+				g.It("pages through the feedback, stopping once the requested amount of entries was found", func() {
+					size, key := defs.RedisFeedbackQueryPageSize, r.genFeedbackKey(device.id)
+					first, second := make([]interface{}, 0, size), make([]interface{}, 0, size)
+
+					for i := 0; i < size; i++ {
+						first = append(first, leveled("info", interchange.FeedbackLevel_LEVEL_INFO))
+						second = append(second, leveled("error", interchange.FeedbackLevel_LEVEL_ERROR))
+					}
+
+					mock.Command("LRANGE", key, 0, size-1).Expect(first)
+					mock.Command("LRANGE", key, size, size*2-1).Expect(second)
+					third := mock.Command("LRANGE", key, size*2, size*3-1).ExpectSlice()
+					results, e := r.ListFeedbackByLevel(device.id, 2, interchange.FeedbackLevel_LEVEL_ERROR)
+					g.Assert(e).Equal(nil)
+					g.Assert(payloads(results)).Equal([]string{"error", "error"})
+					g.Assert(mock.c.Stats(third)).Equal(0)
+				})
+			})
+
+			g.Describe("FeedbackStats", func() {
+				stamped := func(level interchange.FeedbackLevel, age time.Duration) []byte {
+					message := interchange.FeedbackMessage{Level: level, Timestamp: time.Now().Add(-age).Unix()}
+					return []byte(proto.MarshalTextString(&message))
+				}
+
+				g.It("returns zeroed counts for every level when there is no feedback", func() {
+					mock.Command("LRANGE", r.genFeedbackKey(device.id), 0, defs.RedisFeedbackQueryPageSize-1).ExpectSlice()
+					stats, e := r.FeedbackStats(device.id, time.Hour)
+					g.Assert(e).Equal(nil)
+					g.Assert(stats).Equal(map[string]int{"info": 0, "warn": 0, "error": 0})
+				})
+
+				g.It("fails if unable to list the feedback", func() {
+					key := r.genFeedbackKey(device.id)
+					mock.Command("LRANGE", key, 0, defs.RedisFeedbackQueryPageSize-1).ExpectError(fmt.Errorf("bad-lrange"))
+					_, e := r.FeedbackStats(device.id, time.Hour)
+					g.Assert(e.Error()).Equal("bad-lrange")
+				})
+
+				g.It("counts the entries per level that were logged within the window", func() {
+					untimed := interchange.FeedbackMessage{Level: interchange.FeedbackLevel_LEVEL_ERROR}
+
+					mock.Command("LRANGE", r.genFeedbackKey(device.id), 0, defs.RedisFeedbackQueryPageSize-1).ExpectSlice(
+						stamped(interchange.FeedbackLevel_LEVEL_ERROR, time.Minute),
+						stamped(interchange.FeedbackLevel_LEVEL_INFO, time.Minute*2),
+						stamped(interchange.FeedbackLevel_LEVEL_ERROR, time.Minute*5),
+						stamped(interchange.FeedbackLevel(42), time.Minute*10),
+						stamped(interchange.FeedbackLevel_LEVEL_WARN, time.Hour*2),
+						stamped(interchange.FeedbackLevel_LEVEL_ERROR, time.Hour*3),
+						[]byte(proto.MarshalTextString(&untimed)),
+					)
+
+					stats, e := r.FeedbackStats(device.id, time.Hour)
+					g.Assert(e).Equal(nil)
+					g.Assert(stats).Equal(map[string]int{"info": 2, "warn": 0, "error": 2})
+				})
+
+				g.It("stops loading pages once the entries are older than the window", func() {
+					size, key := defs.RedisFeedbackQueryPageSize, r.genFeedbackKey(device.id)
+					recent, old := make([]interface{}, 0, size), make([]interface{}, 0, size)
+
+					for i := 0; i < size; i++ {
+						recent = append(recent, stamped(interchange.FeedbackLevel_LEVEL_WARN, time.Minute))
+						old = append(old, stamped(interchange.FeedbackLevel_LEVEL_WARN, time.Hour*2))
+					}
+
+					mock.Command("LRANGE", key, 0, size-1).Expect(recent)
+					mock.Command("LRANGE", key, size, size*2-1).Expect(old)
+					third := mock.Command("LRANGE", key, size*2, size*3-1).ExpectSlice()
+					stats, e := r.FeedbackStats(device.id, time.Hour)
+					g.Assert(e).Equal(nil)
+					g.Assert(stats["warn"]).Equal(size)
+					g.Assert(mock.c.Stats(third)).Equal(0)
+				})
+			})
+
+			g.Describe("QueryFeedback", func() {
+				base := time.Unix(1500000000, 0)
+
+				entry := func(payload string, level interchange.FeedbackLevel, offset int64) []byte {
+					message := interchange.FeedbackMessage{Payload: []byte(payload), Level: level}
+
+					if offset >= 0 {
+						message.Timestamp = base.Unix() + offset
+					}
+
+					return []byte(proto.MarshalTextString(&message))
+				}
+
+				payloads := func(messages []interchange.FeedbackMessage) []string {
+					result := make([]string, 0, len(messages))
+
+					for _, message := range messages {
+						result = append(result, string(message.Payload))
+					}
+
+					return result
+				}
+
+				g.It("returns an empty list when the device has no feedback", func() {
+					mock.Command("LRANGE", r.genFeedbackKey(device.id), 0, defs.RedisFeedbackQueryPageSize-1).ExpectSlice()
+					results, e := r.QueryFeedback(device.id, FeedbackQuery{})
+					g.Assert(e).Equal(nil)
+					g.Assert(len(results)).Equal(0)
+				})
+
+				g.It("fails if unable to load a page of the feedback", func() {
+					key := r.genFeedbackKey(device.id)
+					mock.Command("LRANGE", key, 0, defs.RedisFeedbackQueryPageSize-1).ExpectError(fmt.Errorf("bad-lrange"))
+					_, e := r.QueryFeedback(device.id, FeedbackQuery{})
+					g.Assert(e.Error()).Equal("bad-lrange")
+				})
+
+				g.Describe("w/ a page of feedback", func() {
+					g.BeforeEach(func() {
+						mock.Command("LRANGE", r.genFeedbackKey(device.id), 0, defs.RedisFeedbackQueryPageSize-1).ExpectSlice(
+							entry("first", interchange.FeedbackLevel_LEVEL_ERROR, 50),
+							entry("second", interchange.FeedbackLevel_LEVEL_INFO, 40),
+							entry("third", interchange.FeedbackLevel_LEVEL_WARN, 30),
+							entry("fourth", interchange.FeedbackLevel_LEVEL_ERROR, 20),
+							entry("fifth", interchange.FeedbackLevel_LEVEL_INFO, 10),
+							entry("untimed", interchange.FeedbackLevel_LEVEL_ERROR, -1),
+						)
+					})
+
+					g.It("returns every entry newest first w/o any predicates", func() {
+						results, e := r.QueryFeedback(device.id, FeedbackQuery{})
+						g.Assert(e).Equal(nil)
+						g.Assert(payloads(results)).Equal([]string{"first", "second", "third", "fourth", "fifth", "untimed"})
+					})
+
+					g.It("filters by the minimum level", func() {
+						results, e := r.QueryFeedback(device.id, FeedbackQuery{Level: interchange.FeedbackLevel_LEVEL_WARN})
+						g.Assert(e).Equal(nil)
+						g.Assert(payloads(results)).Equal([]string{"first", "third", "fourth", "untimed"})
+					})
+
+					g.It("filters out entries before the since time, including untimed entries", func() {
+						results, e := r.QueryFeedback(device.id, FeedbackQuery{Since: base.Add(time.Second * 30)})
+						g.Assert(e).Equal(nil)
+						g.Assert(payloads(results)).Equal([]string{"first", "second", "third"})
+					})
+
+					g.It("filters out entries after the until time, including untimed entries", func() {
+						results, e := r.QueryFeedback(device.id, FeedbackQuery{Until: base.Add(time.Second * 30)})
+						g.Assert(e).Equal(nil)
+						g.Assert(payloads(results)).Equal([]string{"third", "fourth", "fifth"})
+					})
+
+					g.It("skips the offset amount of matching entries", func() {
+						results, e := r.QueryFeedback(device.id, FeedbackQuery{Offset: 4})
+						g.Assert(e).Equal(nil)
+						g.Assert(payloads(results)).Equal([]string{"fifth", "untimed"})
+					})
+
+					g.It("returns at most the limit amount of entries", func() {
+						results, e := r.QueryFeedback(device.id, FeedbackQuery{Limit: 2})
+						g.Assert(e).Equal(nil)
+						g.Assert(payloads(results)).Equal([]string{"first", "second"})
+					})
+
+					g.It("combines each of the predicates", func() {
+						query := FeedbackQuery{
+							Level:  interchange.FeedbackLevel_LEVEL_WARN,
+							Since:  base.Add(time.Second * 10),
+							Until:  base.Add(time.Second * 45),
+							Offset: 1,
+							Limit:  1,
+						}
+						results, e := r.QueryFeedback(device.id, query)
+						g.Assert(e).Equal(nil)
+						g.Assert(payloads(results)).Equal([]string{"fourth"})
+					})
+
+					g.It("returns an empty list when no entries match", func() {
+						results, e := r.QueryFeedback(device.id, FeedbackQuery{Since: base.Add(time.Hour)})
+						g.Assert(e).Equal(nil)
+						g.Assert(len(results)).Equal(0)
+					})
+				})
+
+				g.It("loads the next page when the limit has not been reached", func() {
+					key, page := r.genFeedbackKey(device.id), make([]interface{}, 0, defs.RedisFeedbackQueryPageSize)
+
+					for i := 0; i < defs.RedisFeedbackQueryPageSize; i++ {
+						page = append(page, entry("info", interchange.FeedbackLevel_LEVEL_INFO, int64(100-i)))
+					}
+
+					mock.Command("LRANGE", key, 0, defs.RedisFeedbackQueryPageSize-1).ExpectSlice(page...)
+					mock.Command("LRANGE", key, defs.RedisFeedbackQueryPageSize, defs.RedisFeedbackQueryPageSize*2-1).ExpectSlice(
+						entry("error", interchange.FeedbackLevel_LEVEL_ERROR, 10),
+					)
+
+					results, e := r.QueryFeedback(device.id, FeedbackQuery{Level: interchange.FeedbackLevel_LEVEL_ERROR})
+					g.Assert(e).Equal(nil)
+					g.Assert(payloads(results)).Equal([]string{"error"})
+				})
+
+				g.It("stops loading pages once the entries are older than the since time", func() {
+					key, page := r.genFeedbackKey(device.id), make([]interface{}, 0, defs.RedisFeedbackQueryPageSize)
+
+					for i := 0; i < defs.RedisFeedbackQueryPageSize; i++ {
+						page = append(page, entry("info", interchange.FeedbackLevel_LEVEL_INFO, int64(100-i)))
+					}
+
+					mock.Command("LRANGE", key, 0, defs.RedisFeedbackQueryPageSize-1).ExpectSlice(page...)
+					results, e := r.QueryFeedback(device.id, FeedbackQuery{Since: base.Add(time.Second * 99)})
+					g.Assert(e).Equal(nil)
+					g.Assert(len(results)).Equal(2)
+					g.Assert(mock.history).Equal([]string{"EXISTS", "HMGET", "LRANGE"})
+				})
+			})
 		})
 	})
 }
+
+func benchmarkDetailsSubject(count int) (RedisRegistry, []string) {
+	r, mock := subject()
+	fields := []interface{}{defs.RedisDeviceIDField, defs.RedisDeviceNameField, defs.RedisDeviceSecretField}
+	keys := make([]string, 0, count)
+
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("device-%d", i)
+		key := r.genRegistryKey(id)
+		keys = append(keys, key)
+		mock.Command("HMGET", append([]interface{}{key}, fields...)...).ExpectSlice(
+			[]byte(id),
+			[]byte(id+"-name"),
+			[]byte(id+"-secret"),
+		)
+	}
+
+	return r, keys
+}
+
+func Benchmark_LoadDetailsSerial(b *testing.B) {
+	r, keys := benchmarkDetailsSubject(100)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			if _, e := r.loadDetails(key); e != nil {
+				b.Fatal(e)
+			}
+		}
+	}
+}
+
+func Benchmark_LoadDetailsBatch(b *testing.B) {
+	r, keys := benchmarkDetailsSubject(100)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, e := r.loadDetailsBatch(keys); e != nil {
+			b.Fatal(e)
+		}
+	}
+}
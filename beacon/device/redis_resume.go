@@ -0,0 +1,129 @@
+package device
+
+import "github.com/garyburd/redigo/redis"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// IssueResumeToken creates a single use token the device can present when reconnecting to resume its registration under
+// the same id. The token holds the name and secret of the device so that its registration can be restored should the
+// device have been removed when its previous connection dropped.
+func (registry *RedisRegistry) IssueResumeToken(deviceID string) (string, error) {
+	details, e := registry.FindDeviceByID(deviceID)
+
+	if e != nil {
+		return "", e
+	}
+
+	token, e := registry.GenerateToken()
+
+	if e != nil {
+		return "", e
+	}
+
+	resumeKey := registry.genResumeKey(token)
+
+	f := struct {
+		id     string
+		name   string
+		secret string
+	}{defs.RedisResumeDeviceIDField, defs.RedisResumeNameField, defs.RedisResumeSecretField}
+
+	e = registry.hmset(resumeKey, f.id, details.DeviceID, f.name, details.Name, f.secret, details.SharedSecret)
+
+	if e != nil {
+		return "", e
+	}
+
+	if e := registry.expire(resumeKey, defs.DefaultResumeTokenTTL); e != nil {
+		return "", e
+	}
+
+	// Each device's tokens are also kept in a set so that revoking them does not mean scanning every resume key. The
+	// set lives as long as its newest token; members whose token has since expired or been redeemed are harmless.
+	tokensKey := registry.genResumeTokensKey(details.DeviceID)
+
+	if _, e := registry.Do("SADD", tokensKey, token); e != nil {
+		return "", e
+	}
+
+	if e := registry.expire(tokensKey, defs.DefaultResumeTokenTTL); e != nil {
+		return "", e
+	}
+
+	return token, nil
+}
+
+// ResumeDevice redeems the resume token for the id of the device it was issued to, provided the secret matches the one
+// the device was registered w/. Devices removed since the token was issued are registered again under the same id.
+func (registry *RedisRegistry) ResumeDevice(token, secret string) (string, error) {
+	f := struct {
+		id     string
+		name   string
+		secret string
+	}{defs.RedisResumeDeviceIDField, defs.RedisResumeNameField, defs.RedisResumeSecretField}
+
+	// Resume tokens are single use (the resumed connection is welcomed w/ a new one); the token is deleted by the same
+	// script that reads it so that it cannot be redeemed twice.
+	fields, e := redis.Strings(registry.eval(
+		redeemResumeScript,
+		[]string{registry.genResumeKey(token)},
+		f.id, f.name, f.secret,
+		secret,
+	))
+
+	if e == redis.ErrNil {
+		return "", defs.Error(defs.ErrInvalidResumeToken)
+	}
+
+	if e != nil {
+		return "", e
+	}
+
+	if len(fields) == 1 {
+		registry.Warnf("resume token for device[%s] presented w/ a different secret", fields[0])
+		return "", defs.Error(defs.ErrInvalidResumeToken)
+	}
+
+	if len(fields) != 2 {
+		return "", defs.Error(defs.ErrBadRedisResponse)
+	}
+
+	deviceID, name := fields[0], fields[1]
+
+	registered, e := registry.exists(registry.genRegistryKey(deviceID))
+
+	if e != nil {
+		return "", e
+	}
+
+	if registered != true {
+		registry.Infof("restoring registration of resumed device[%s]", deviceID)
+
+		if e := registry.register(deviceID, name, secret); e != nil {
+			return "", e
+		}
+
+		registry.dispatch(defs.WebhookDeviceRegisteredEvent, deviceID, nil)
+	}
+
+	registry.touch(deviceID)
+	return deviceID, nil
+}
+
+// revokeResumeTokens deletes every resume token issued to the device, along w/ the set that tracks them.
+func (registry *RedisRegistry) revokeResumeTokens(deviceID string) error {
+	tokensKey := registry.genResumeTokensKey(deviceID)
+	tokens, e := registry.smembersstr(tokensKey)
+
+	if e != nil {
+		return e
+	}
+
+	for _, token := range tokens {
+		if e := registry.del(registry.genResumeKey(token)); e != nil {
+			return e
+		}
+	}
+
+	return registry.del(tokensKey)
+}
@@ -0,0 +1,180 @@
+package device
+
+import "fmt"
+import "strings"
+import "crypto/sha1"
+import "github.com/garyburd/redigo/redis"
+
+// luaScript holds the source of a lua script run by the registry along w/ its sha1, which is what redis caches it by.
+type luaScript struct {
+	source string
+	sha    string
+}
+
+func newLuaScript(source string) luaScript {
+	return luaScript{source, fmt.Sprintf("%x", sha1.Sum([]byte(source)))}
+}
+
+// Results of the token scripts, which return the reason a token was not written rather than an error reply so
+// that callers are able to tell them apart from redis errors.
+const (
+	tokenScriptCreated       = "created"
+	tokenScriptLimitReached  = "limit-reached"
+	tokenScriptDuplicateName = "duplicate-name"
+	tokenScriptCollision     = "collision"
+)
+
+// createTokenScript pushes a token onto the device's token list (KEYS[1]) and writes its registration hash (KEYS[2])
+// from the field/value pairs that follow the token (ARGV[1]), the device's max token count (ARGV[2]) and the name that
+// must be unique among the device's tokens (ARGV[3], empty to allow duplicates). The registrations of the listed tokens
+// are read w/ the registration key prefix (ARGV[4]) and name field (ARGV[5]). Both keys are type-checked, the names and
+// the list length compared before anything is written so that a failure does not leave one without the other, and so
+// that concurrent calls cannot push the list past the max or create two tokens w/ the same name. A token that already
+// has a registration is reported as a collision rather than overwritten.
+var createTokenScript = newLuaScript(`
+local list, hash = redis.call("TYPE", KEYS[1]).ok, redis.call("TYPE", KEYS[2]).ok
+
+if (list ~= "none" and list ~= "list") or (hash ~= "none" and hash ~= "hash") then
+  return redis.error_reply("WRONGTYPE token list or registration has the wrong type")
+end
+
+if redis.call("EXISTS", KEYS[2]) == 1 then
+  return "collision"
+end
+
+if ARGV[3] ~= "" then
+  for _, token in ipairs(redis.call("LRANGE", KEYS[1], 0, -1)) do
+    if redis.pcall("HGET", ARGV[4] .. token, ARGV[5]) == ARGV[3] then
+      return "duplicate-name"
+    end
+  end
+end
+
+local max = tonumber(ARGV[2])
+
+if max > 0 and redis.call("LLEN", KEYS[1]) >= max then
+  return "limit-reached"
+end
+
+redis.call("LPUSH", KEYS[1], ARGV[1])
+redis.call("HMSET", KEYS[2], unpack(ARGV, 6))
+return "created"
+`)
+
+// registerTokenScript writes the registration hash (KEYS[1]) of a token from the field/value pairs in ARGV unless a
+// registration of the token already exists. Used in cluster mode, where the token list is in another slot.
+var registerTokenScript = newLuaScript(`
+local hash = redis.call("TYPE", KEYS[1]).ok
+
+if hash ~= "none" and hash ~= "hash" then
+  return redis.error_reply("WRONGTYPE token registration has the wrong type")
+end
+
+if redis.call("EXISTS", KEYS[1]) == 1 then
+  return "collision"
+end
+
+redis.call("HMSET", KEYS[1], unpack(ARGV))
+return "created"
+`)
+
+// pushTokenScript pushes a token (ARGV[1]) onto the device's token list (KEYS[1]) unless the list already holds the
+// device's max token count (ARGV[2]). Used in cluster mode, where the registration of the token is in another slot and
+// is written separately.
+var pushTokenScript = newLuaScript(`
+local list = redis.call("TYPE", KEYS[1]).ok
+
+if list ~= "none" and list ~= "list" then
+  return redis.error_reply("WRONGTYPE token list has the wrong type")
+end
+
+local max = tonumber(ARGV[2])
+
+if max > 0 and redis.call("LLEN", KEYS[1]) >= max then
+  return "limit-reached"
+end
+
+redis.call("LPUSH", KEYS[1], ARGV[1])
+return "created"
+`)
+
+// unindexNameScript removes a name (ARGV[1]) from the name index (KEYS[1]) only while it is owned by the device w/ the
+// id (ARGV[2]), so that a device does not free a name that has since been taken by another device.
+var unindexNameScript = newLuaScript(`
+if redis.call("HGET", KEYS[1], ARGV[1]) == ARGV[2] then
+  return redis.call("HDEL", KEYS[1], ARGV[1])
+end
+
+return 0
+`)
+
+// fillRegistrationScript deletes a registration request (KEYS[1]) if it holds the secret (ARGV[4]), writing the filled
+// registration (KEYS[2]) in its place so that retried registrations w/ the same secret resolve to the same device. The
+// request's own device id is kept for reissued registrations, falling back to ARGV[5]. The secret, name & device id
+// field names are ARGV[1-3] and the ttl of the filled registration ARGV[6]. Returns the device id and name.
+var fillRegistrationScript = newLuaScript(`
+local values = redis.call("HMGET", KEYS[1], ARGV[1], ARGV[2], ARGV[3])
+
+if values[1] ~= ARGV[4] or not values[2] then
+  return false
+end
+
+local id = values[3] or ARGV[5]
+
+redis.call("DEL", KEYS[1])
+redis.call("HMSET", KEYS[2], ARGV[1], ARGV[4], ARGV[2], values[2], ARGV[3], id)
+redis.call("EXPIRE", KEYS[2], ARGV[6])
+return {id, values[2]}
+`)
+
+// redeemResumeScript deletes a resume token (KEYS[1]) if it was issued w/ the secret (ARGV[4]), returning the device id
+// and name it was issued w/ (ARGV[1] & ARGV[2], ARGV[3] being the secret field). Tokens presented w/ a different secret
+// are left in place, returning only the device id.
+var redeemResumeScript = newLuaScript(`
+local values = redis.call("HMGET", KEYS[1], ARGV[1], ARGV[2], ARGV[3])
+
+if not values[1] or not values[2] then
+  return false
+end
+
+if values[3] ~= ARGV[4] then
+  return {values[1]}
+end
+
+redis.call("DEL", KEYS[1])
+return {values[1], values[2]}
+`)
+
+// releaseLockScript deletes a lock (KEYS[1]) only if it still holds the token it was acquired w/ (ARGV[1]), so that a
+// lock which expired and was then taken by another caller is left alone.
+var releaseLockScript = newLuaScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("DEL", KEYS[1])
+end
+
+return 0
+`)
+
+// eval runs the script by its sha, falling back to sending the full source when redis does not have it cached yet.
+// In that case the script is also loaded so that later runs can be made by sha again.
+func (registry *RedisRegistry) eval(script luaScript, keys []string, args ...interface{}) (interface{}, error) {
+	params := []interface{}{len(keys)}
+
+	for _, key := range keys {
+		params = append(params, key)
+	}
+
+	params = append(params, args...)
+
+	reply, e := registry.Do("EVALSHA", append([]interface{}{script.sha}, params...)...)
+
+	if e == nil || strings.HasPrefix(e.Error(), "NOSCRIPT") != true {
+		return reply, e
+	}
+
+	if _, e := redis.String(registry.Do("SCRIPT", "LOAD", script.source)); e != nil {
+		registry.Warnf("unable to load script[%s]: %s", script.sha, e.Error())
+	}
+
+	return registry.Do("EVAL", append([]interface{}{script.source}, params...)...)
+}
@@ -0,0 +1,494 @@
+package device
+
+import "fmt"
+import "strconv"
+import "github.com/satori/go.uuid"
+import "github.com/garyburd/redigo/redis"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// ListTokens searches the token store for the token details given the token key.
+func (registry *RedisRegistry) ListTokens(query string) ([]TokenDetails, error) {
+	results := make([]TokenDetails, 0)
+
+	e := registry.WalkTokens(query, func(details TokenDetails) error {
+		results = append(results, details)
+		return nil
+	})
+
+	if e != nil {
+		return nil, e
+	}
+
+	return results, nil
+}
+
+// WalkTokens pages through the token list of a device, invoking the callback w/ each token's details. Iteration stops
+// at the first error returned by the callback, which is then returned to the caller. Entries whose registration can
+// never be loaded are removed from the list as they are encountered.
+func (registry *RedisRegistry) WalkTokens(query string, fn func(TokenDetails) error) error {
+	deviceInfo, e := registry.FindDevice(query)
+
+	if e != nil {
+		return e
+	}
+
+	listKey := registry.genTokenListKey(deviceInfo.DeviceID)
+
+	for start := 0; ; start += defs.RedisTokenPageSize {
+		tokenEntries, e := registry.lrangestr(listKey, start, start+defs.RedisTokenPageSize-1)
+
+		if e != nil {
+			return e
+		}
+
+		pruned := 0
+
+		for _, tokenValue := range tokenEntries {
+			details, e := registry.loadToken(tokenValue)
+
+			// Only dangling entries are pruned; anything else (e.g. a failed lookup) may succeed on a later walk.
+			if e != nil && e == defs.Error(defs.ErrDanglingToken) {
+				pruned += registry.pruneToken(listKey, tokenValue)
+				continue
+			}
+
+			if e != nil {
+				continue
+			}
+
+			if e := fn(details); e != nil {
+				return e
+			}
+		}
+
+		if len(tokenEntries) < defs.RedisTokenPageSize {
+			return nil
+		}
+
+		// Entries removed from this page shift the remainder of the list back.
+		start -= pruned
+	}
+}
+
+// pruneToken removes a dangling token entry from the token list, returning the number of entries removed.
+func (registry *RedisRegistry) pruneToken(listKey, tokenValue string) int {
+	registry.Warnf("pruning dangling token entry from %s", listKey)
+
+	removed, e := redis.Int(registry.Do("LREM", listKey, 0, tokenValue))
+
+	if e != nil {
+		registry.Errorf("unable to prune dangling token entry from %s: %s", listKey, e.Error())
+		return 0
+	}
+
+	return removed
+}
+
+// ListAllTokens scans every token registration regardless of the device it belongs to, returning at most limit tokens
+// (a limit less than one returns every token). Registrations that cannot be parsed are skipped.
+func (registry *RedisRegistry) ListAllTokens(limit int) ([]TokenDetails, error) {
+	prefix := defs.RedisDeviceTokenRegistrationKey
+	results := make([]TokenDetails, 0)
+
+	e := registry.scan(registry.genKeyPrefix(prefix), func(key string) bool {
+		details, e := registry.loadToken(registry.keyID(prefix, key))
+
+		if e != nil {
+			registry.Warnf("skipping unparsable token registration %s: %s", key, e.Error())
+			return true
+		}
+
+		results = append(results, details)
+		return limit < 1 || len(results) < limit
+	})
+
+	if e != nil {
+		return nil, e
+	}
+
+	return results, nil
+}
+
+// RecallToken returns the details of the token created for the device w/ the idempotency key, failing w/ a not found
+// error if the key has not been used within the idempotency window or its token has since been removed. Keys reserved
+// for a token that is still being created fail w/ a pending error.
+func (registry *RedisRegistry) RecallToken(deviceID, key string) (TokenDetails, error) {
+	token, e := redis.String(registry.Do("GET", registry.genIdempotencyKey(deviceID, key)))
+
+	if e == redis.ErrNil {
+		return TokenDetails{}, defs.Error(defs.ErrNotFound)
+	}
+
+	if e != nil {
+		return TokenDetails{}, e
+	}
+
+	if token == defs.RedisTokenIdempotencyPending {
+		return TokenDetails{}, defs.Error(defs.ErrIdempotencyKeyPending)
+	}
+
+	details, e := registry.FindToken(token)
+
+	if e != nil {
+		return TokenDetails{}, e
+	}
+
+	details.Token = token
+	return details, nil
+}
+
+// ReserveToken claims the idempotency key for a token about to be created, failing w/ a pending error if the key has
+// already been claimed (or used) by another request. Reservations expire on their own if the token is never created.
+func (registry *RedisRegistry) ReserveToken(deviceID, key string) error {
+	reservation := int(defs.DefaultTokenIdempotencyReservation.Seconds())
+	idempotencyKey := registry.genIdempotencyKey(deviceID, key)
+
+	response, e := registry.Do("SET", idempotencyKey, defs.RedisTokenIdempotencyPending, "NX", "EX", reservation)
+
+	if e != nil {
+		return e
+	}
+
+	if response == nil {
+		return defs.Error(defs.ErrIdempotencyKeyPending)
+	}
+
+	return nil
+}
+
+// RememberToken records the token created for the device w/ the idempotency key until the idempotency window elapses.
+func (registry *RedisRegistry) RememberToken(deviceID, key string, details TokenDetails) error {
+	window := int(defs.DefaultTokenIdempotencyWindow.Seconds())
+	_, e := registry.Do("SET", registry.genIdempotencyKey(deviceID, key), details.Token, "EX", window)
+	return e
+}
+
+// ReleaseToken frees an idempotency key reserved for a token that could not be created, allowing it to be retried.
+func (registry *RedisRegistry) ReleaseToken(deviceID, key string) error {
+	return registry.del(registry.genIdempotencyKey(deviceID, key))
+}
+
+// FindToken searches the token store for the token details given the token key.
+func (registry *RedisRegistry) FindToken(token string) (TokenDetails, error) {
+	// Start w/ an attempt to look up by key directly>
+	registryKey := registry.genTokenRegistrationKey(token)
+
+	permissionMask, e := registry.hgetstr(registryKey, defs.RedisDeviceTokenPermissionField)
+
+	if e == redis.ErrNil {
+		return TokenDetails{}, defs.Error(defs.ErrNotFound)
+	}
+
+	if e != nil {
+		registry.Errorf("unable to find token by registry key %s (token: %s)", registryKey, token)
+		return TokenDetails{}, e
+	}
+
+	permission, e := strconv.ParseUint(permissionMask, 2, 32)
+
+	if e != nil {
+		registry.Errorf("invalid token permission mask %s (token: %s)", registryKey, token)
+		return TokenDetails{}, e
+	}
+
+	fields := struct {
+		id     string
+		name   string
+		device string
+	}{defs.RedisDeviceTokenIDField, defs.RedisDeviceTokenNameField, defs.RedisDeviceTokenDeviceIDField}
+
+	r, e := registry.hmgetstr(registryKey, fields.id, fields.name, fields.device)
+
+	if e != nil {
+		registry.Errorf("unable to find token details by registry key %s (token: %s)", registryKey, token)
+		return TokenDetails{}, e
+	}
+
+	details := TokenDetails{
+		Permission: uint(permission),
+		TokenID:    r[0],
+		Name:       r[1],
+		DeviceID:   r[2],
+	}
+
+	return details, nil
+}
+
+// AuthorizeToken approves the token + permission for the given device id. Tokens only authorize the device they were
+// created for, or every member of the group they are scoped to; a token belonging to one device is rejected for others.
+func (registry *RedisRegistry) AuthorizeToken(deviceID, token string, permission uint) bool {
+	registration, e := registry.FindDeviceByID(deviceID)
+
+	if e != nil {
+		return false
+	}
+
+	if token == registration.SharedSecret {
+		return true
+	}
+
+	requester, e := registry.FindToken(token)
+
+	if e != nil {
+		registry.Errorf("unable to find token: %s", e.Error())
+		return false
+	}
+
+	registry.Infof("auth token: %s (token: %b, requested: %b)", requester.TokenID, requester.Permission, permission)
+
+	if registry.covers(requester.DeviceID, registration.DeviceID) != true {
+		registry.Warnf("token %s (scope: %s) does not cover device[%s]", requester.TokenID, requester.DeviceID, deviceID)
+		return false
+	}
+
+	return requester.Permission&permission == permission
+}
+
+// covers returns whether a token scoped to the device or group id applies to the device. Group membership is only
+// resolved a single level deep; tags only ever hold device ids, and the members are never resolved as groups.
+func (registry *RedisRegistry) covers(scope, deviceID string) bool {
+	if scope == deviceID {
+		return true
+	}
+
+	tag, group := GroupTag(scope)
+
+	if group != true {
+		return false
+	}
+
+	// Empty (or unknown) tags have no members, rejecting every device.
+	member, e := redis.Bool(registry.Do("SISMEMBER", registry.genTagKey(tag), deviceID))
+
+	if e != nil {
+		registry.Errorf("unable to check membership of device[%s] in group[%s]: %s", deviceID, tag, e.Error())
+		return false
+	}
+
+	return member
+}
+
+// CreateToken creates a new auth token for a given device id
+func (registry *RedisRegistry) CreateToken(deviceID, tokenName string, permission uint) (TokenDetails, error) {
+	listKey := registry.genTokenListKey(deviceID)
+	empty, permissionMask, tokenID := TokenDetails{}, fmt.Sprintf("%b", permission), uuid.NewV4().String()
+
+	// Bits outside of the known permissions would otherwise be persisted and interact oddly w/ authorization checks.
+	if permission&^defs.SecurityDeviceTokenPermissionAll != 0 {
+		return empty, defs.Error(defs.ErrInvalidTokenPermission)
+	}
+
+	// Group tokens are scoped to the devices w/ a tag rather than a single registered device.
+	if _, group := GroupTag(deviceID); group != true {
+		if _, e := registry.FindDeviceByID(deviceID); e != nil {
+			return empty, e
+		}
+	}
+
+	// Token names are compared by the script that creates the token. In cluster mode the registrations of a device's
+	// tokens are spread across slots the script is unable to read; the names are checked beforehand instead, which does
+	// not prevent concurrent requests from creating tokens w/ the same name.
+	unique := ""
+
+	if registry.UniqueTokenNames && registry.ClusterMode != true {
+		unique = tokenName
+	}
+
+	if registry.UniqueTokenNames && registry.ClusterMode {
+		taken, e := registry.tokenNameTaken(listKey, tokenName)
+
+		if e != nil {
+			return empty, e
+		}
+
+		if taken {
+			registry.Warnf("device %s already has a token named \"%s\"", deviceID, tokenName)
+			return empty, defs.Error(defs.ErrDuplicateTokenName)
+		}
+	}
+
+	fields := struct {
+		name       string
+		permission string
+		id         string
+		deviceID   string
+	}{
+		defs.RedisDeviceTokenNameField,
+		defs.RedisDeviceTokenPermissionField,
+		defs.RedisDeviceTokenIDField,
+		defs.RedisDeviceTokenDeviceIDField,
+	}
+
+	values := []interface{}{
+		fields.name, tokenName,
+		fields.permission, permissionMask,
+		fields.id, tokenID,
+		fields.deviceID, deviceID,
+		defs.RedisSchemaVersionField, defs.RedisSchemaVersion,
+	}
+
+	// Whether the generated token is already in use is checked by the same script that writes its registration, which
+	// would otherwise overwrite the hash of the existing token; a token in use is replaced by another generated one.
+	for attempt := 1; attempt <= defs.DefaultTokenGenerationAttempts; attempt++ {
+		rawToken, e := registry.GenerateToken()
+
+		if e != nil {
+			return empty, e
+		}
+
+		details := TokenDetails{
+			TokenID:    tokenID,
+			DeviceID:   deviceID,
+			Token:      rawToken,
+			Name:       tokenName,
+			Permission: permission,
+		}
+
+		result, e := registry.writeToken(listKey, details, unique, fields.name, values)
+
+		if e != nil {
+			return empty, e
+		}
+
+		switch result {
+		case tokenScriptCreated:
+			return details, nil
+		case tokenScriptLimitReached:
+			registry.Warnf("device %s has reached the max token count (%d)", deviceID, registry.MaxTokens)
+			return empty, defs.Error(defs.ErrTokenLimitReached)
+		case tokenScriptDuplicateName:
+			registry.Warnf("device %s already has a token named \"%s\"", deviceID, tokenName)
+			return empty, defs.Error(defs.ErrDuplicateTokenName)
+		case tokenScriptCollision:
+			registry.Warnf("generated token already in use (attempt %d of %d)", attempt, defs.DefaultTokenGenerationAttempts)
+			continue
+		}
+
+		return empty, defs.Error(defs.ErrBadRedisResponse)
+	}
+
+	return empty, defs.Error(defs.ErrTokenGenerationFailed)
+}
+
+// writeToken lists the token of the details on the device's token list and writes its registration from the values,
+// returning the result of the script(s) that wrote them.
+func (registry *RedisRegistry) writeToken(
+	listKey string,
+	details TokenDetails,
+	unique, nameField string,
+	values []interface{},
+) (string, error) {
+	registryKey := registry.genTokenRegistrationKey(details.Token)
+
+	if registry.ClusterMode {
+		return registry.writeClusterToken(listKey, registryKey, details, values)
+	}
+
+	// The token list entry and the registration hash are written together by a script so one is never left w/o the other.
+	// A max token count of zero leaves the amount of tokens a device can have unlimited.
+	args := []interface{}{
+		details.Token,
+		registry.MaxTokens,
+		unique,
+		registry.genKeyPrefix(defs.RedisDeviceTokenRegistrationKey),
+		nameField,
+	}
+
+	return redis.String(registry.eval(createTokenScript, []string{listKey, registryKey}, append(args, values...)...))
+}
+
+// writeClusterToken writes the registration of the token before pushing it onto the device's token list. In cluster
+// mode the two keys are in different slots and unable to be written by a single script; the registration is deleted
+// again if the token cannot be listed, and the raw token is never returned until both have been written.
+func (registry *RedisRegistry) writeClusterToken(
+	listKey, registryKey string,
+	details TokenDetails,
+	values []interface{},
+) (string, error) {
+	result, e := redis.String(registry.eval(registerTokenScript, []string{registryKey}, values...))
+
+	if e != nil || result != tokenScriptCreated {
+		return result, e
+	}
+
+	result, e = redis.String(registry.eval(pushTokenScript, []string{listKey}, details.Token, registry.MaxTokens))
+
+	if e == nil && result == tokenScriptCreated {
+		return result, nil
+	}
+
+	if e := registry.del(registryKey); e != nil {
+		registry.Errorf("unable to remove registration of unlisted token %s: %s", details.TokenID, e.Error())
+	}
+
+	return result, e
+}
+
+// loadToken returns the token details stored in the token registry for a given token value
+func (registry *RedisRegistry) loadToken(tokenValue string) (TokenDetails, error) {
+	fields := struct {
+		id         string
+		name       string
+		device     string
+		permission string
+	}{
+		defs.RedisDeviceTokenIDField,
+		defs.RedisDeviceTokenNameField,
+		defs.RedisDeviceTokenDeviceIDField,
+		defs.RedisDeviceTokenPermissionField,
+	}
+
+	registryKey := registry.genTokenRegistrationKey(tokenValue)
+	response, e := registry.Do("HMGET", registryKey, fields.id, fields.name, fields.device, fields.permission)
+	details, e := redis.Strings(response, e)
+
+	if e != nil {
+		return TokenDetails{}, e
+	}
+
+	// A missing registration hash comes back w/ empty fields, which fails to parse along w/ any corrupt mask.
+	permission, e := strconv.ParseUint(details[3], 2, 32)
+
+	if e != nil {
+		return TokenDetails{}, defs.Error(defs.ErrDanglingToken)
+	}
+
+	for i, value := range details[:3] {
+		if empty := len(value) == 0; empty {
+			return TokenDetails{}, fmt.Errorf("invalid-entry[%d]", i)
+		}
+	}
+
+	return TokenDetails{
+		TokenID:    details[0],
+		Name:       details[1],
+		DeviceID:   details[2],
+		Permission: uint(permission),
+	}, nil
+}
+
+// tokenNameTaken scans the tokens in the token list for one w/ the given name. Tokens that are unable to be loaded
+// (e.g dangling list entries) are skipped.
+func (registry *RedisRegistry) tokenNameTaken(listKey, name string) (bool, error) {
+	values, e := registry.lrangestr(listKey, 0, -1)
+
+	if e != nil {
+		return false, e
+	}
+
+	for _, value := range values {
+		details, e := registry.loadToken(value)
+
+		if e != nil {
+			registry.Debugf("skipping token during name check: %s", e.Error())
+			continue
+		}
+
+		if details.Name == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
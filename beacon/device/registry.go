@@ -1,9 +1,11 @@
 package device
 
-// RegistrationRequest holds the information for a pending registration
+// RegistrationRequest holds the information for a pending registration. The age (in seconds) is only populated when
+// listing pending registrations.
 type RegistrationRequest struct {
 	SharedSecret string `json:"-"`
 	Name         string `json:"name"`
+	Age          int64  `json:"age"`
 }
 
 // RegistrationDetails holds the information about a given device connection
@@ -17,6 +19,14 @@ type RegistrationDetails struct {
 type Registry interface {
 	Index
 	ListRegistrations() ([]RegistrationDetails, error)
-	FillRegistration(string, string) error
+	FindDevices(string) ([]RegistrationDetails, error)
+	DeviceExists(string) (bool, error)
+	FillRegistration(string, string) (string, error)
 	AllocateRegistration(RegistrationRequest) error
+	ListPendingRegistrations() ([]RegistrationRequest, error)
+	SetDeviceMeta(string, map[string]string) error
+	RenameDevice(string, string) error
+	GetDeviceMeta(string) (map[string]string, error)
+	RemoveDevices([]string) (map[string]error, error)
+	ReissueRegistration(string, string) error
 }
@@ -0,0 +1,30 @@
+package device
+
+// RegistryArchive defines an interface for backing up and restoring the devices (and their tokens) of a registry.
+type RegistryArchive interface {
+	ExportRegistry() ([]byte, error)
+	ImportRegistry([]byte, bool) error
+}
+
+// RegistryExport is the versioned json document produced when exporting a registry.
+type RegistryExport struct {
+	Version int              `json:"version"`
+	Devices []ExportedDevice `json:"devices"`
+}
+
+// ExportedDevice holds the full registration details of a device, including the values that are normally omitted
+// from api responses (shared secret, token values).
+type ExportedDevice struct {
+	DeviceID     string          `json:"device_id"`
+	Name         string          `json:"name"`
+	SharedSecret string          `json:"shared_secret"`
+	Tokens       []ExportedToken `json:"tokens,omitempty"`
+}
+
+// ExportedToken holds the details of a single device token.
+type ExportedToken struct {
+	TokenID    string `json:"token_id"`
+	Token      string `json:"token"`
+	Name       string `json:"name"`
+	Permission uint   `json:"permission"`
+}
@@ -0,0 +1,8 @@
+package device
+
+// ResumeStore defines an interface for issuing and redeeming the tokens devices present when reconnecting in order to
+// resume their connection under the device id they were previously registered w/.
+type ResumeStore interface {
+	IssueResumeToken(string) (string, error)
+	ResumeDevice(string, string) (string, error)
+}
@@ -0,0 +1,25 @@
+package device
+
+import "encoding/hex"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/security"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+// VerifyDeviceSignature checks that the signature sent by a device is the signature of the sha256 digest of the
+// payload, made w/ the private key matching the public key the device registered w/ (its shared secret).
+func VerifyDeviceSignature(details RegistrationDetails, payload, signature []byte) error {
+	return security.VerifySignature(details.SharedSecret, payload, signature)
+}
+
+// VerifyFeedback checks the hex encoded digest in the authentication of a feedback message, which the device signs the
+// same way, against the payload of the message.
+func VerifyFeedback(details RegistrationDetails, message interchange.FeedbackMessage) error {
+	signature, e := hex.DecodeString(message.GetAuthentication().GetMessageDigest())
+
+	if e != nil {
+		return defs.Error(defs.ErrInvalidDeviceSignature)
+	}
+
+	return VerifyDeviceSignature(details, message.GetPayload(), signature)
+}
@@ -0,0 +1,56 @@
+package device
+
+import "crypto"
+import "testing"
+import "crypto/rsa"
+import "crypto/rand"
+import "crypto/x509"
+import "crypto/sha256"
+import "encoding/hex"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+func Test_VerifyDeviceSignature(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("VerifyDeviceSignature", func() {
+		private, _ := rsa.GenerateKey(rand.Reader, 1024)
+		public, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+		details := RegistrationDetails{DeviceID: "device-1", SharedSecret: hex.EncodeToString(public)}
+		payload := []byte("feedback")
+		digest := sha256.Sum256(payload)
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+
+		g.It("accepts payloads signed w/ the device's key", func() {
+			g.Assert(VerifyDeviceSignature(details, payload, signature)).Equal(nil)
+		})
+
+		g.It("rejects tampered payloads", func() {
+			e := VerifyDeviceSignature(details, []byte("tampered"), signature)
+			g.Assert(e == defs.Error(defs.ErrInvalidDeviceSignature)).Equal(true)
+		})
+
+		g.It("accepts feedback whose hex encoded digest was signed w/ the device's key", func() {
+			message := interchange.FeedbackMessage{
+				Authentication: &interchange.DeviceMessageAuthentication{MessageDigest: hex.EncodeToString(signature)},
+				Payload:        payload,
+			}
+			g.Assert(VerifyFeedback(details, message)).Equal(nil)
+		})
+
+		g.It("rejects feedback w/ a digest that is not hex encoded", func() {
+			message := interchange.FeedbackMessage{
+				Authentication: &interchange.DeviceMessageAuthentication{MessageDigest: "not-hex"},
+				Payload:        payload,
+			}
+			g.Assert(VerifyFeedback(details, message) == defs.Error(defs.ErrInvalidDeviceSignature)).Equal(true)
+		})
+
+		g.It("errors if the stored key is unable to be parsed", func() {
+			e := VerifyDeviceSignature(RegistrationDetails{SharedSecret: "not-a-key"}, payload, signature)
+			g.Assert(e == defs.Error(defs.ErrInvalidDeviceKey)).Equal(true)
+		})
+	})
+}
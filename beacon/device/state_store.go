@@ -0,0 +1,25 @@
+package device
+
+import "time"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+// DeviceState holds the color of the last control frame sent to a device.
+type DeviceState struct {
+	DeviceID  string    `json:"device_id"`
+	Red       uint32    `json:"red"`
+	Green     uint32    `json:"green"`
+	Blue      uint32    `json:"blue"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// ColorName is the name of the palette color nearest the state, populated by the api when responding.
+	ColorName string `json:"color_name,omitempty"`
+
+	// Status is whether the device is online, silent or disconnected, populated by the api when responding.
+	Status string `json:"status,omitempty"`
+}
+
+// StateStore defines an interface for persisting the last known state of each device.
+type StateStore interface {
+	SetDeviceState(string, interchange.ControlFrame) error
+	GetDeviceState(string) (DeviceState, error)
+}
@@ -1,8 +1,8 @@
 package device
 
 import "io"
-import "fmt"
 import "bytes"
+import "io/ioutil"
 import "encoding/hex"
 import "crypto/sha256"
 import "github.com/satori/go.uuid"
@@ -15,21 +15,40 @@ import "github.com/dadleyy/beacon.api/beacon/interchange"
 // NewStreamerConnection returns a device connection who's underlying IO is managed through a streamer interface
 func NewStreamerConnection(stream defs.Streamer, sign defs.Signer, id uuid.UUID) *StreamerConnection {
 	logger := logging.New(defs.DeviceConnectionLogPrefix, logging.Red)
-	return &StreamerConnection{logger, stream, sign, id}
+	return &StreamerConnection{logger, stream, sign, id, defs.BinaryWriter, 0, 0}
 }
 
-// StreamerConnection is an implementation of the device.Connection interface using a websocket
+// StreamerConnection is an implementation of the device.Connection interface using a websocket. Messages are sent as
+// binary frames unless the writer type is set to text (which can be useful when debugging). When the compression
+// threshold is set, message payloads larger than it are gzipped and flagged as compressed.
 type StreamerConnection struct {
 	logging.LeveledLogger
 	defs.Streamer
 	defs.Signer
-	id uuid.UUID
+	id                   uuid.UUID
+	WriterType           int
+	CompressionThreshold int
+
+	// MaxDecompressedSize is the size compressed feedback payloads may expand to; when zero, the default is used.
+	MaxDecompressedSize int
 }
 
 // Send writes the provided byte data to the next available writer from the underlying streamer interface
 func (connection *StreamerConnection) Send(message interchange.DeviceMessage) error {
 	if message.GetAuthentication() == nil {
-		return fmt.Errorf(defs.ErrBadInterchangeAuthentication)
+		return defs.Error(defs.ErrBadInterchangeAuthentication)
+	}
+
+	// Large payloads are compressed before the digest is created so that the digest covers what is actually sent.
+	if threshold := connection.CompressionThreshold; threshold > 0 && len(message.Payload) > threshold {
+		compressed, e := compressPayload(message.Payload)
+
+		if e != nil {
+			return e
+		}
+
+		connection.Debugf("compressed payload from %d to %d bytes", len(message.Payload), len(compressed))
+		message.Payload, message.Compressed = compressed, true
 	}
 
 	// Create the message's digest - should be a sha256 hash
@@ -63,7 +82,7 @@ func (connection *StreamerConnection) Send(message interchange.DeviceMessage) er
 	}
 
 	// Using the streamer interface, open a writer and write the finshed (serialized) message.
-	w, e := connection.NextWriter(defs.TextWriter)
+	w, e := connection.NextWriter(connection.writerType())
 
 	if e != nil {
 		return e
@@ -76,10 +95,62 @@ func (connection *StreamerConnection) Send(message interchange.DeviceMessage) er
 	return e
 }
 
-// Receive returns the next available reader from the underlying streamer interface
+// Receive returns the next available reader from the underlying streamer interface, which may be either a text or a
+// binary frame regardless of the writer type used when sending. Feedback messages flagged as compressed are returned
+// w/ their payload decompressed, failing if it expands past the maximum decompressed size.
 func (connection *StreamerConnection) Receive() (io.Reader, error) {
-	_, r, e := connection.NextReader()
-	return r, e
+	kind, r, e := connection.NextReader()
+
+	if e != nil {
+		return nil, e
+	}
+
+	if kind != defs.TextWriter && kind != defs.BinaryWriter {
+		return nil, defs.Error(defs.ErrUnsupportedFrameType)
+	}
+
+	data, e := ioutil.ReadAll(r)
+
+	if e != nil {
+		return nil, e
+	}
+
+	message := interchange.FeedbackMessage{}
+
+	if e := proto.Unmarshal(data, &message); e != nil || message.Compressed != true {
+		return bytes.NewBuffer(data), nil
+	}
+
+	limit := connection.MaxDecompressedSize
+
+	if limit <= 0 {
+		limit = defs.DefaultMaxDecompressedSize
+	}
+
+	payload, e := decompressPayload(message.Payload, limit)
+
+	if e != nil {
+		return nil, e
+	}
+
+	message.Payload, message.Compressed = payload, false
+
+	decompressed, e := proto.Marshal(&message)
+
+	if e != nil {
+		return nil, e
+	}
+
+	return bytes.NewBuffer(decompressed), nil
+}
+
+// writerType returns the type of writer requested when sending, defaulting to binary since messages are protobuf.
+func (connection *StreamerConnection) writerType() int {
+	if connection.WriterType == defs.TextWriter {
+		return defs.TextWriter
+	}
+
+	return defs.BinaryWriter
 }
 
 // GetID returns the unique identifier created for this connection as a string
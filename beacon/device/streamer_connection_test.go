@@ -5,6 +5,7 @@ import "log"
 import "fmt"
 import "bytes"
 import "testing"
+import "github.com/golang/protobuf/proto"
 import "github.com/franela/goblin"
 import "github.com/satori/go.uuid"
 import "github.com/dadleyy/beacon.api/beacon/defs"
@@ -19,13 +20,15 @@ func newStreamerLogger() *logging.Logger {
 }
 
 type testStreamerResponse struct {
-	r io.Reader
-	w io.WriteCloser
-	e error
+	r    io.Reader
+	w    io.WriteCloser
+	e    error
+	kind int
 }
 
 type testStreamer struct {
 	responses []testStreamerResponse
+	requested []int
 }
 
 func (t *testStreamer) Close() error {
@@ -33,6 +36,8 @@ func (t *testStreamer) Close() error {
 }
 
 func (t *testStreamer) NextWriter(kind int) (io.WriteCloser, error) {
+	t.requested = append(t.requested, kind)
+
 	if len(t.responses) == 0 {
 		return nil, fmt.Errorf("no-reader")
 	}
@@ -49,7 +54,7 @@ func (t *testStreamer) NextReader() (int, io.Reader, error) {
 
 	r := t.responses[0]
 
-	return 0, r.r, r.e
+	return r.kind, r.r, r.e
 }
 
 type testSigner struct {
@@ -70,7 +75,8 @@ type testStreamerConnectionScaffolding struct {
 }
 
 type testWriteCloser struct {
-	errors []error
+	errors  []error
+	written []byte
 }
 
 func (t *testWriteCloser) Close() error {
@@ -82,7 +88,9 @@ func (t *testWriteCloser) Write(b []byte) (int, error) {
 		return 0, t.errors[0]
 	}
 
-	return 0, nil
+	t.written = append(t.written, b...)
+
+	return len(b), nil
 }
 
 func Test_StreamerConnection(t *testing.T) {
@@ -151,6 +159,163 @@ func Test_StreamerConnection(t *testing.T) {
 				e := scaffold.connection.Send(message)
 				g.Assert(e.Error()).Equal("bad-writer")
 			})
+
+			g.It("requests a binary writer by default", func() {
+				scaffold.streamer.responses = append(scaffold.streamer.responses, testStreamerResponse{
+					w: &testWriteCloser{},
+				})
+				g.Assert(scaffold.connection.Send(message)).Equal(nil)
+				g.Assert(scaffold.streamer.requested).Equal([]int{defs.BinaryWriter})
+			})
+
+			g.It("requests a text writer when configured to", func() {
+				scaffold.connection.WriterType = defs.TextWriter
+				scaffold.streamer.responses = append(scaffold.streamer.responses, testStreamerResponse{
+					w: &testWriteCloser{},
+				})
+				g.Assert(scaffold.connection.Send(message)).Equal(nil)
+				g.Assert(scaffold.streamer.requested).Equal([]int{defs.TextWriter})
+			})
+
+			g.Describe("with a compression threshold", func() {
+				var writer *testWriteCloser
+				var payload []byte
+
+				g.BeforeEach(func() {
+					frames := []*interchange.ControlFrame{}
+
+					for i := 0; i < 64; i++ {
+						frames = append(frames, &interchange.ControlFrame{Red: uint32(i), Green: 10, Blue: 20})
+					}
+
+					payload, _ = proto.Marshal(&interchange.ControlMessage{Frames: frames})
+					message.Payload = payload
+
+					writer = &testWriteCloser{}
+					scaffold.connection.CompressionThreshold = 32
+					scaffold.streamer.responses = append(scaffold.streamer.responses, testStreamerResponse{w: writer})
+				})
+
+				g.It("compresses payloads larger than the threshold", func() {
+					g.Assert(scaffold.connection.Send(message)).Equal(nil)
+					sent := interchange.DeviceMessage{}
+					g.Assert(proto.Unmarshal(writer.written, &sent)).Equal(nil)
+					g.Assert(sent.Compressed).Equal(true)
+					g.Assert(len(sent.Payload) < len(payload)).Equal(true)
+					decompressed, e := decompressPayload(sent.Payload, len(payload))
+					g.Assert(e).Equal(nil)
+					g.Assert(bytes.Equal(decompressed, payload)).Equal(true)
+				})
+
+				g.It("leaves payloads at or below the threshold untouched", func() {
+					scaffold.connection.CompressionThreshold = len(payload)
+					g.Assert(scaffold.connection.Send(message)).Equal(nil)
+					sent := interchange.DeviceMessage{}
+					g.Assert(proto.Unmarshal(writer.written, &sent)).Equal(nil)
+					g.Assert(sent.Compressed).Equal(false)
+					g.Assert(bytes.Equal(sent.Payload, payload)).Equal(true)
+				})
+			})
+		})
+	})
+
+	g.Describe("Receive", func() {
+		var streamer *testStreamer
+		var connection StreamerConnection
+
+		g.BeforeEach(func() {
+			streamer = &testStreamer{}
+			connection = StreamerConnection{LeveledLogger: newStreamerLogger(), Streamer: streamer}
+		})
+
+		g.It("returns the error from the streamer's NextReader", func() {
+			_, e := connection.Receive()
+			g.Assert(e.Error()).Equal("no-reader")
+		})
+
+		g.It("returns the reader of text frames", func() {
+			streamer.responses = append(streamer.responses, testStreamerResponse{
+				r:    bytes.NewBufferString("text"),
+				kind: defs.TextWriter,
+			})
+			r, e := connection.Receive()
+			g.Assert(e).Equal(nil)
+			g.Assert(r.(*bytes.Buffer).String()).Equal("text")
+		})
+
+		g.It("returns the reader of binary frames", func() {
+			streamer.responses = append(streamer.responses, testStreamerResponse{
+				r:    bytes.NewBuffer([]byte{0x08, 0x01}),
+				kind: defs.BinaryWriter,
+			})
+			r, e := connection.Receive()
+			g.Assert(e).Equal(nil)
+			g.Assert(r.(*bytes.Buffer).Bytes()).Equal([]byte{0x08, 0x01})
+		})
+
+		g.It("rejects frames that are neither text nor binary", func() {
+			streamer.responses = append(streamer.responses, testStreamerResponse{
+				r:    bytes.NewBufferString("ping"),
+				kind: 9,
+			})
+			_, e := connection.Receive()
+			g.Assert(e == defs.Error(defs.ErrUnsupportedFrameType)).Equal(true)
+		})
+
+		g.Describe("with compressed feedback", func() {
+			payload := bytes.Repeat([]byte("feedback-payload"), 32)
+
+			g.It("returns the feedback message w/ its payload decompressed", func() {
+				compressed, _ := compressPayload(payload)
+				frame, _ := proto.Marshal(&interchange.FeedbackMessage{Payload: compressed, Compressed: true})
+				streamer.responses = append(streamer.responses, testStreamerResponse{
+					r:    bytes.NewBuffer(frame),
+					kind: defs.BinaryWriter,
+				})
+				r, e := connection.Receive()
+				g.Assert(e).Equal(nil)
+				message := interchange.FeedbackMessage{}
+				g.Assert(proto.Unmarshal(r.(*bytes.Buffer).Bytes(), &message)).Equal(nil)
+				g.Assert(message.Compressed).Equal(false)
+				g.Assert(bytes.Equal(message.Payload, payload)).Equal(true)
+			})
+
+			compressedFrame := func(data []byte) testStreamerResponse {
+				compressed, _ := compressPayload(data)
+				frame, _ := proto.Marshal(&interchange.FeedbackMessage{Payload: compressed, Compressed: true})
+				return testStreamerResponse{r: bytes.NewBuffer(frame), kind: defs.BinaryWriter}
+			}
+
+			g.It("accepts payloads that expand to exactly the maximum decompressed size", func() {
+				connection.MaxDecompressedSize = len(payload)
+				streamer.responses = append(streamer.responses, compressedFrame(payload))
+				_, e := connection.Receive()
+				g.Assert(e).Equal(nil)
+			})
+
+			g.It("rejects payloads that expand past the maximum decompressed size", func() {
+				connection.MaxDecompressedSize = len(payload) - 1
+				streamer.responses = append(streamer.responses, compressedFrame(payload))
+				_, e := connection.Receive()
+				g.Assert(e == defs.Error(defs.ErrPayloadTooLarge)).Equal(true)
+			})
+
+			g.It("limits decompressed payloads to the default size when no maximum is set", func() {
+				bomb := make([]byte, defs.DefaultMaxDecompressedSize+1)
+				streamer.responses = append(streamer.responses, compressedFrame(bomb))
+				_, e := connection.Receive()
+				g.Assert(e == defs.Error(defs.ErrPayloadTooLarge)).Equal(true)
+			})
+
+			g.It("returns an error when the compressed payload is invalid", func() {
+				frame, _ := proto.Marshal(&interchange.FeedbackMessage{Payload: payload, Compressed: true})
+				streamer.responses = append(streamer.responses, testStreamerResponse{
+					r:    bytes.NewBuffer(frame),
+					kind: defs.BinaryWriter,
+				})
+				_, e := connection.Receive()
+				g.Assert(e == nil).Equal(false)
+			})
 		})
 	})
 
@@ -0,0 +1,21 @@
+package device
+
+import "strings"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// TagStore defines an interface for grouping devices under arbitrary tags (e.g. the room a light is in).
+type TagStore interface {
+	AddDeviceTag(string, string) (bool, error)
+	RemoveDeviceTag(string, string) error
+	ListDevicesByTag(string) ([]RegistrationDetails, error)
+}
+
+// GroupTag returns the tag referenced by a group device id (e.g "tag:kitchen"), along w/ whether the id is one.
+func GroupTag(deviceID string) (string, bool) {
+	if strings.HasPrefix(deviceID, defs.SecurityDeviceGroupPrefix) != true {
+		return "", false
+	}
+
+	tag := strings.TrimPrefix(deviceID, defs.SecurityDeviceGroupPrefix)
+	return tag, defs.DeviceTagPattern.MatchString(tag)
+}
@@ -0,0 +1,30 @@
+package device
+
+import "testing"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+func Test_GroupTag(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("GroupTag", func() {
+		g.It("returns the tag referenced by group ids", func() {
+			tag, group := GroupTag(defs.SecurityDeviceGroupPrefix + "kitchen")
+			g.Assert(group).Equal(true)
+			g.Assert(tag).Equal("kitchen")
+		})
+
+		g.It("does not treat device ids as group ids", func() {
+			_, group := GroupTag("2f0f4b1c-device-id")
+			g.Assert(group).Equal(false)
+		})
+
+		g.It("does not treat group ids w/ invalid tags as group ids", func() {
+			_, group := GroupTag(defs.SecurityDeviceGroupPrefix)
+			g.Assert(group).Equal(false)
+			_, group = GroupTag(defs.SecurityDeviceGroupPrefix + "Not A Tag")
+			g.Assert(group).Equal(false)
+		})
+	})
+}
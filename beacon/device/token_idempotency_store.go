@@ -0,0 +1,10 @@
+package device
+
+// TokenIdempotencyStore defines an interface for recording the token created for a device w/ a client provided
+// idempotency key, allowing retried token requests to return the original token rather than creating another.
+type TokenIdempotencyStore interface {
+	RecallToken(string, string) (TokenDetails, error)
+	ReserveToken(string, string) error
+	RememberToken(string, string, TokenDetails) error
+	ReleaseToken(string, string) error
+}
@@ -1,12 +1,49 @@
 package device
 
+import "encoding/json"
+import "github.com/dadleyy/beacon.api/beacon/security"
+
 // TokenDetails holds permission information for a given device token.
 type TokenDetails struct {
-	TokenID    string `json:"token_id"`
-	DeviceID   string `json:"device_id"`
-	Token      string `json:"token"`
-	Name       string `json:"name"`
-	Permission uint   `json:"permission"`
+	TokenID     string   `json:"token_id"`
+	DeviceID    string   `json:"device_id"`
+	Token       string   `json:"token"`
+	Name        string   `json:"name"`
+	Permission  uint     `json:"permission"`
+	Permissions []string `json:"permissions,omitempty"`
+
+	// Reveal includes the raw token when the details are marshaled; it should only be set when the token is created.
+	Reveal bool `json:"-"`
+}
+
+// MarshalJSON encodes the token details w/ the names of its permissions, omitting the raw token unless revealed.
+func (details TokenDetails) MarshalJSON() ([]byte, error) {
+	permissions := details.Permissions
+
+	if permissions == nil {
+		permissions = security.FormatPermissions(details.Permission)
+	}
+
+	encoded := struct {
+		TokenID     string   `json:"token_id"`
+		DeviceID    string   `json:"device_id"`
+		Token       string   `json:"token,omitempty"`
+		Name        string   `json:"name"`
+		Permission  uint     `json:"permission"`
+		Permissions []string `json:"permissions"`
+	}{
+		TokenID:     details.TokenID,
+		DeviceID:    details.DeviceID,
+		Name:        details.Name,
+		Permission:  details.Permission,
+		Permissions: permissions,
+	}
+
+	if details.Reveal {
+		encoded.Token = details.Token
+	}
+
+	return json.Marshal(encoded)
 }
 
 // TokenStore defines the interface for creating tokens.
@@ -14,4 +51,6 @@ type TokenStore interface {
 	CreateToken(string, string, uint) (TokenDetails, error)
 	ListTokens(string) ([]TokenDetails, error)
 	AuthorizeToken(string, string, uint) bool
+	FindToken(string) (TokenDetails, error)
+	ListAllTokens(int) ([]TokenDetails, error)
 }
@@ -0,0 +1,55 @@
+package device
+
+import "testing"
+import "encoding/json"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+func Test_TokenDetails(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("TokenDetails", func() {
+		var details TokenDetails
+
+		decode := func(details TokenDetails) map[string]interface{} {
+			encoded, e := json.Marshal(details)
+			g.Assert(e).Equal(nil)
+			result := make(map[string]interface{})
+			g.Assert(json.Unmarshal(encoded, &result)).Equal(nil)
+			return result
+		}
+
+		g.BeforeEach(func() {
+			details = TokenDetails{
+				TokenID:    "token-id",
+				DeviceID:   "device-id",
+				Token:      "raw-token",
+				Name:       "token-name",
+				Permission: defs.SecurityDeviceTokenPermissionViewer | defs.SecurityDeviceTokenPermissionAdmin,
+			}
+		})
+
+		g.It("omits the raw token unless revealed", func() {
+			_, ok := decode(details)["token"]
+			g.Assert(ok).Equal(false)
+		})
+
+		g.It("includes the raw token when revealed", func() {
+			details.Reveal = true
+			g.Assert(decode(details)["token"]).Equal("raw-token")
+		})
+
+		g.It("always includes the token id, name, device id and permission names", func() {
+			result := decode(details)
+			g.Assert(result["token_id"]).Equal("token-id")
+			g.Assert(result["name"]).Equal("token-name")
+			g.Assert(result["device_id"]).Equal("device-id")
+			g.Assert(result["permissions"]).Equal([]interface{}{"viewer", "admin"})
+		})
+
+		g.It("includes an empty list of permission names for tokens w/o any permissions", func() {
+			g.Assert(decode(TokenDetails{})["permissions"]).Equal([]interface{}{})
+		})
+	})
+}
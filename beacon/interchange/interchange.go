@@ -6,3 +6,4 @@ package interchange
 //go:generate protoc --proto_path=./ -I./ --go_out=./ feedback_message.proto
 //go:generate protoc --proto_path=./ -I./ --go_out=./ error_message.proto
 //go:generate protoc --proto_path=./ -I./ --go_out=./ report_message.proto
+//go:generate protoc --proto_path=./ -I./ --go_out=plugins=grpc:./ device_control_service.proto
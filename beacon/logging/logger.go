@@ -51,14 +51,24 @@ func findOuput() io.Writer {
 
 // New retrurns a new logger
 func New(name string, colorFlag uint) *Logger {
+	return newLogger(name, colorFlag, findOuput())
+}
+
+func newLogger(name string, colorFlag uint, output io.Writer) *Logger {
 	prefix := color(colorFlag, name)
-	writer := log.New(findOuput(), prefix, defs.DefaultLoggerFlags)
-	return &Logger{writer}
+	writer := log.New(output, prefix, defs.DefaultLoggerFlags)
+	return &Logger{Logger: writer}
 }
 
 // Logger wraps the golang log.Logger struct for coloring
 type Logger struct {
 	*log.Logger
+	tag string
+}
+
+// WithTag returns a logger sharing the same output that includes the tag in every line it emits.
+func (logger *Logger) WithTag(tag string) *Logger {
+	return &Logger{Logger: logger.Logger, tag: tag}
 }
 
 // Errorf sends the output colored
@@ -82,8 +92,13 @@ func (logger *Logger) Debugf(format string, items ...interface{}) {
 }
 
 func (logger *Logger) printfc(crayon chalk.Color, label string, format string, items ...interface{}) {
-	labelTag := fmt.Sprintf("[%s]", label)
-	formatted := fmt.Sprintf("%v %s", crayon.Color(labelTag), fmt.Sprintf(format, items...))
+	labelTag, message := fmt.Sprintf("[%s]", label), fmt.Sprintf(format, items...)
+
+	if logger.tag != "" {
+		message = fmt.Sprintf("[%s] %s", logger.tag, message)
+	}
+
+	formatted := fmt.Sprintf("%v %s", crayon.Color(labelTag), message)
 	logger.Printf("%s", formatted)
 }
 
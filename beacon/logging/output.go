@@ -0,0 +1,99 @@
+package logging
+
+import "io"
+import "os"
+import "sync"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// SetOutput configures the writers every logger constructed afterwards writes to; each line is written to every one
+// of the writers in order. Calling it w/o any writers restores the default stdout (or syslog) output.
+func SetOutput(writers ...io.Writer) {
+	output = combine(writers)
+}
+
+// NewWithOutput returns a new logger writing to the writers provided rather than the package output, falling back to
+// the package output (same as New) when none are provided.
+func NewWithOutput(name string, colorFlag uint, writers ...io.Writer) *Logger {
+	if writer := combine(writers); writer != nil {
+		return newLogger(name, colorFlag, writer)
+	}
+
+	return New(name, colorFlag)
+}
+
+// combine returns a single writer fanning out to each of the writers, or nil if there are none.
+func combine(writers []io.Writer) io.Writer {
+	switch len(writers) {
+	case 0:
+		return nil
+	case 1:
+		return writers[0]
+	}
+
+	return io.MultiWriter(writers...)
+}
+
+// OpenFileSink opens (creating if necessary) the log file at the path for appending.
+func OpenFileSink(path string) (*FileSink, error) {
+	sink := &FileSink{path: path}
+
+	if e := sink.Reopen(); e != nil {
+		return nil, e
+	}
+
+	return sink, nil
+}
+
+// FileSink is a writer appending to a log file that can be reopened; external rotators (e.g logrotate) move the file
+// aside and signal the process to reopen it so that subsequent lines are written to a fresh file at the same path.
+type FileSink struct {
+	path string
+	file *os.File
+	lock sync.Mutex
+}
+
+// Write appends the line to the currently open file.
+func (sink *FileSink) Write(data []byte) (int, error) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	return sink.file.Write(data)
+}
+
+// Reopen closes the current file (if any) and opens the file at the path again.
+func (sink *FileSink) Reopen() error {
+	file, e := os.OpenFile(sink.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, defs.LogFileMode)
+
+	if e != nil {
+		return e
+	}
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.file != nil {
+		sink.file.Close()
+	}
+
+	sink.file = file
+	return nil
+}
+
+// Close closes the current file; lines written afterwards are dropped w/ an error.
+func (sink *FileSink) Close() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.file == nil {
+		return nil
+	}
+
+	e := sink.file.Close()
+	sink.file = nil
+	return e
+}
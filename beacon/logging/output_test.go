@@ -0,0 +1,99 @@
+package logging
+
+import "os"
+import "bytes"
+import "strings"
+import "testing"
+import "io/ioutil"
+import "path/filepath"
+import "github.com/franela/goblin"
+
+func Test_Output(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("NewWithOutput", func() {
+		g.It("writes each line to every writer provided", func() {
+			stdout, file := bytes.NewBuffer([]byte{}), bytes.NewBuffer([]byte{})
+			logger := NewWithOutput("[test] ", White, stdout, file)
+			logger.Infof("hello %s", "world")
+			g.Assert(strings.Contains(stdout.String(), "hello world")).Equal(true)
+			g.Assert(stdout.String()).Equal(file.String())
+		})
+
+		g.It("writes to the single writer provided", func() {
+			buffer := bytes.NewBuffer([]byte{})
+			NewWithOutput("[test] ", White, buffer).Warnf("careful")
+			g.Assert(strings.Contains(buffer.String(), "careful")).Equal(true)
+		})
+	})
+
+	g.Describe("SetOutput", func() {
+		g.AfterEach(func() {
+			SetOutput()
+		})
+
+		g.It("fans the lines of loggers constructed afterwards out to every writer", func() {
+			first, second := bytes.NewBuffer([]byte{}), bytes.NewBuffer([]byte{})
+			SetOutput(first, second)
+			New("[test] ", White).Errorf("broken")
+			g.Assert(strings.Contains(first.String(), "broken")).Equal(true)
+			g.Assert(strings.Contains(second.String(), "broken")).Equal(true)
+		})
+
+		g.It("restores the default output when called w/o writers", func() {
+			SetOutput(bytes.NewBuffer([]byte{}))
+			SetOutput()
+			g.Assert(output == nil).Equal(true)
+		})
+	})
+
+	g.Describe("FileSink", func() {
+		var dir string
+
+		g.BeforeEach(func() {
+			dir, _ = ioutil.TempDir("", "beacon-logs")
+		})
+
+		g.AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		g.It("appends the lines of the logger to the file", func() {
+			path := filepath.Join(dir, "beacon.log")
+			sink, e := OpenFileSink(path)
+			g.Assert(e).Equal(nil)
+			defer sink.Close()
+			NewWithOutput("[test] ", White, sink).Infof("to the file")
+			contents, _ := ioutil.ReadFile(path)
+			g.Assert(strings.Contains(string(contents), "to the file")).Equal(true)
+		})
+
+		g.It("writes to a fresh file at the same path once reopened after being moved aside", func() {
+			path, rotated := filepath.Join(dir, "beacon.log"), filepath.Join(dir, "beacon.log.1")
+			sink, _ := OpenFileSink(path)
+			defer sink.Close()
+			logger := NewWithOutput("[test] ", White, sink)
+			logger.Infof("before rotation")
+			g.Assert(os.Rename(path, rotated)).Equal(nil)
+			g.Assert(sink.Reopen()).Equal(nil)
+			logger.Infof("after rotation")
+			previous, _ := ioutil.ReadFile(rotated)
+			current, _ := ioutil.ReadFile(path)
+			g.Assert(strings.Contains(string(previous), "before rotation")).Equal(true)
+			g.Assert(strings.Contains(string(previous), "after rotation")).Equal(false)
+			g.Assert(strings.Contains(string(current), "after rotation")).Equal(true)
+		})
+
+		g.It("errors on writes once closed", func() {
+			sink, _ := OpenFileSink(filepath.Join(dir, "beacon.log"))
+			g.Assert(sink.Close()).Equal(nil)
+			_, e := sink.Write([]byte("dropped"))
+			g.Assert(e).Equal(os.ErrClosed)
+		})
+
+		g.It("errors if unable to open the file", func() {
+			_, e := OpenFileSink(filepath.Join(dir, "missing", "beacon.log"))
+			g.Assert(e == nil).Equal(false)
+		})
+	})
+}
@@ -0,0 +1,92 @@
+package mqtt
+
+import "sync"
+import "strings"
+import "github.com/satori/go.uuid"
+
+import "github.com/dadleyy/beacon.api/beacon/bg"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+import "github.com/dadleyy/beacon.api/beacon/security"
+
+// NewBridge returns a bridge that registers devices connecting over mqtt, sending them along the registration stream.
+func NewBridge(client Client, registry device.Registry, stream device.RegistrationStream) *Bridge {
+	logger := logging.New(defs.MQTTBridgeLogPrefix, logging.Magenta)
+
+	return &Bridge{
+		LeveledLogger: logger,
+		Registry:      registry,
+		client:        client,
+		stream:        stream,
+	}
+}
+
+// Bridge is the mqtt counterpart of the registration api's websocket route; it implements the bg.Processor interface,
+// listening on the registration topic for devices until the kill switch is received.
+type Bridge struct {
+	logging.LeveledLogger
+	device.Registry
+	client Client
+	stream device.RegistrationStream
+}
+
+// Start is the Processor#Start implementation
+func (bridge *Bridge) Start(wg *sync.WaitGroup, stop bg.KillSwitch) {
+	defer wg.Done()
+
+	if e := bridge.client.Subscribe(defs.MQTTRegistrationTopic, bridge.register); e != nil {
+		bridge.Errorf("unable to subscribe to registration topic: %s", e.Error())
+		return
+	}
+
+	bridge.Infof("mqtt bridge listening for registrations")
+	<-stop
+	bridge.Warnf("received kill signal, unsubscribing from registrations")
+
+	if e := bridge.client.Unsubscribe(defs.MQTTRegistrationTopic); e != nil {
+		bridge.Errorf("unable to unsubscribe from registration topic: %s", e.Error())
+	}
+}
+
+func (bridge *Bridge) register(topic string, payload []byte) {
+	session := topic[strings.LastIndex(topic, "/")+1:]
+
+	if session == "" {
+		bridge.Warnf("registration received without a session (topic: %s)", topic)
+		return
+	}
+
+	encodedSecret := string(payload)
+
+	deviceKey, e := security.ParseDeviceKey(encodedSecret)
+
+	if e != nil {
+		bridge.Warnf("invalid hex shared secret: %s", e.Error())
+		return
+	}
+
+	filledID, e := bridge.FillRegistration(encodedSecret, uuid.NewV4().String())
+
+	if e != nil {
+		bridge.Warnf("unable to push device id into store: %s", e.Error())
+		return
+	}
+
+	deviceID, e := uuid.FromString(filledID)
+
+	if e != nil {
+		bridge.Errorf("invalid device id from registry (%s): %s", filledID, e.Error())
+		return
+	}
+
+	streamer, e := NewStreamer(bridge.client, session)
+
+	if e != nil {
+		bridge.Errorf("unable to subscribe to device session[%s]: %s", session, e.Error())
+		return
+	}
+
+	bridge.Infof("registered mqtt device[%s] (session: %s)", filledID, session)
+	bridge.stream <- device.NewStreamerConnection(streamer, deviceKey, deviceID)
+}
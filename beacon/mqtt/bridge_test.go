@@ -0,0 +1,87 @@
+package mqtt
+
+import "fmt"
+import "sync"
+import "testing"
+import "crypto/rsa"
+import "crypto/x509"
+import "crypto/rand"
+import "encoding/hex"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/bg"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+
+func Test_Bridge(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	public, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	secret := hex.EncodeToString(public)
+
+	g.Describe("Bridge", func() {
+		var client *testClient
+		var registry *testRegistry
+		var stream device.RegistrationStream
+		var bridge *Bridge
+
+		g.BeforeEach(func() {
+			client = &testClient{}
+			registry = &testRegistry{}
+			stream = make(device.RegistrationStream, 1)
+			bridge = &Bridge{
+				LeveledLogger: newTestLogger(),
+				Registry:      registry,
+				client:        client,
+				stream:        stream,
+			}
+		})
+
+		g.Describe("#Start", func() {
+			g.It("returns immediately if unable to subscribe to the registration topic", func() {
+				wg := &sync.WaitGroup{}
+				wg.Add(1)
+				client.subscriptionError = fmt.Errorf("bad-subscribe")
+				bridge.Start(wg, make(bg.KillSwitch))
+				wg.Wait()
+			})
+
+			g.It("unsubscribes from the registration topic once the kill switch is received", func() {
+				wg, kill := &sync.WaitGroup{}, make(bg.KillSwitch)
+				wg.Add(1)
+				go bridge.Start(wg, kill)
+				kill <- struct{}{}
+				wg.Wait()
+				g.Assert(client.unsubscribed).Equal([]string{defs.MQTTRegistrationTopic})
+			})
+		})
+
+		g.Describe("#register", func() {
+			g.It("ignores registrations w/o a session", func() {
+				bridge.register("beacon/register/", []byte(secret))
+				g.Assert(len(registry.filled)).Equal(0)
+				g.Assert(len(stream)).Equal(0)
+			})
+
+			g.It("ignores registrations w/ an invalid shared secret", func() {
+				bridge.register("beacon/register/session-1", []byte("not-hex"))
+				g.Assert(len(registry.filled)).Equal(0)
+				g.Assert(len(stream)).Equal(0)
+			})
+
+			g.It("does not send the connection along if unable to fill the registration", func() {
+				registry.fillErrors = append(registry.fillErrors, fmt.Errorf("bad-fill"))
+				bridge.register("beacon/register/session-1", []byte(secret))
+				g.Assert(len(stream)).Equal(0)
+			})
+
+			g.It("fills the registration and sends the connection along the registration stream", func() {
+				bridge.register("beacon/register/session-1", []byte(secret))
+				connection := <-stream
+				g.Assert(registry.filled[secret]).Equal(connection.GetID())
+				g.Assert(client.handler(fmt.Sprintf(defs.MQTTDeviceFeedbackTopic, "session-1")) != nil).Equal(true)
+			})
+		})
+	})
+}
@@ -0,0 +1,11 @@
+package mqtt
+
+// MessageHandler is called by the client w/ the topic and payload of each message received on a subscribed topic.
+type MessageHandler func(string, []byte)
+
+// Client defines the subset of an mqtt client's capabilities used by the bridge to exchange messages w/ devices.
+type Client interface {
+	Publish(string, []byte) error
+	Subscribe(string, MessageHandler) error
+	Unsubscribe(string) error
+}
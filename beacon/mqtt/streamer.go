@@ -0,0 +1,96 @@
+package mqtt
+
+import "io"
+import "fmt"
+import "sync"
+import "bytes"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// NewStreamer subscribes to the feedback topic of the device session, returning a streamer that writes to the control
+// topic of the same session.
+func NewStreamer(client Client, session string) (*Streamer, error) {
+	streamer := &Streamer{
+		client:   client,
+		control:  fmt.Sprintf(defs.MQTTDeviceControlTopic, session),
+		feedback: fmt.Sprintf(defs.MQTTDeviceFeedbackTopic, session),
+		inbound:  make(chan []byte, defs.DefaultMQTTInboundBuffer),
+		closed:   make(chan struct{}),
+	}
+
+	if e := client.Subscribe(streamer.feedback, streamer.receive); e != nil {
+		return nil, e
+	}
+
+	return streamer, nil
+}
+
+// Streamer implements the defs.Streamer interface over a pair of mqtt topics so that it can be used as the underlying
+// IO of a device.StreamerConnection.
+type Streamer struct {
+	client   Client
+	control  string
+	feedback string
+	inbound  chan []byte
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// NextWriter returns a writer that publishes each write made to it as a message on the control topic.
+func (streamer *Streamer) NextWriter(int) (io.WriteCloser, error) {
+	select {
+	case <-streamer.closed:
+		return nil, fmt.Errorf(defs.ErrMQTTConnectionClosed)
+	default:
+		return &publication{streamer: streamer}, nil
+	}
+}
+
+// NextReader blocks until a message has been received on the feedback topic or the streamer has been closed.
+func (streamer *Streamer) NextReader() (int, io.Reader, error) {
+	select {
+	case payload := <-streamer.inbound:
+		return defs.TextWriter, bytes.NewBuffer(payload), nil
+	case <-streamer.closed:
+		return 0, nil, fmt.Errorf(defs.ErrMQTTConnectionClosed)
+	}
+}
+
+// Close unsubscribes from the feedback topic, unblocking any pending readers.
+func (streamer *Streamer) Close() error {
+	var e error
+
+	streamer.once.Do(func() {
+		close(streamer.closed)
+		e = streamer.client.Unsubscribe(streamer.feedback)
+	})
+
+	return e
+}
+
+// receive is called from the read loop of the client, which is shared by every device; a device whose inbound buffer
+// is full is disconnected instead of blocking the loop.
+func (streamer *Streamer) receive(topic string, payload []byte) {
+	select {
+	case streamer.inbound <- payload:
+	case <-streamer.closed:
+	default:
+		streamer.Close()
+	}
+}
+
+type publication struct {
+	streamer *Streamer
+}
+
+func (p *publication) Write(data []byte) (int, error) {
+	if e := p.streamer.client.Publish(p.streamer.control, data); e != nil {
+		return 0, e
+	}
+
+	return len(data), nil
+}
+
+func (p *publication) Close() error {
+	return nil
+}
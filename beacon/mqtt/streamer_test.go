@@ -0,0 +1,102 @@
+package mqtt
+
+import "io"
+import "fmt"
+import "testing"
+import "io/ioutil"
+import "github.com/franela/goblin"
+import "github.com/satori/go.uuid"
+import "github.com/golang/protobuf/proto"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+type testSigner struct {
+}
+
+func (s *testSigner) Sign(out io.Writer, data []byte) error {
+	_, e := out.Write(data)
+	return e
+}
+
+func Test_Streamer(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("Streamer", func() {
+		var client *testClient
+
+		g.BeforeEach(func() {
+			client = &testClient{}
+		})
+
+		g.It("returns an error if unable to subscribe to the feedback topic", func() {
+			client.subscriptionError = fmt.Errorf("bad-subscribe")
+			_, e := NewStreamer(client, "session-1")
+			g.Assert(e.Error()).Equal("bad-subscribe")
+		})
+
+		g.Describe("used as the io of a device connection", func() {
+			var connection device.Connection
+			var streamer *Streamer
+
+			g.BeforeEach(func() {
+				streamer, _ = NewStreamer(client, "session-1")
+				connection = device.NewStreamerConnection(streamer, &testSigner{}, uuid.NewV4())
+			})
+
+			g.It("publishes sent messages to the session's control topic", func() {
+				e := connection.Send(interchange.DeviceMessage{
+					Authentication: &interchange.DeviceMessageAuthentication{DeviceID: "device-1"},
+					Payload:        []byte("hello"),
+				})
+				g.Assert(e).Equal(nil)
+				g.Assert(len(client.published)).Equal(1)
+				g.Assert(client.published[0].topic).Equal(fmt.Sprintf(defs.MQTTDeviceControlTopic, "session-1"))
+				message := interchange.DeviceMessage{}
+				g.Assert(proto.Unmarshal(client.published[0].payload, &message)).Equal(nil)
+				g.Assert(string(message.Payload)).Equal("hello")
+			})
+
+			g.It("returns the error from the client if unable to publish", func() {
+				client.publishErrors = append(client.publishErrors, fmt.Errorf("bad-publish"))
+				e := connection.Send(interchange.DeviceMessage{
+					Authentication: &interchange.DeviceMessageAuthentication{},
+				})
+				g.Assert(e.Error()).Equal("bad-publish")
+			})
+
+			g.It("surfaces messages received on the session's feedback topic", func() {
+				topic := fmt.Sprintf(defs.MQTTDeviceFeedbackTopic, "session-1")
+				client.handler(topic)(topic, []byte("feedback"))
+				reader, e := connection.Receive()
+				g.Assert(e).Equal(nil)
+				data, _ := ioutil.ReadAll(reader)
+				g.Assert(string(data)).Equal("feedback")
+			})
+
+			g.It("disconnects w/o blocking the client once the inbound buffer of the device is full", func() {
+				topic := fmt.Sprintf(defs.MQTTDeviceFeedbackTopic, "session-1")
+				handler := client.handler(topic)
+
+				for i := 0; i <= defs.DefaultMQTTInboundBuffer; i++ {
+					handler(topic, []byte("feedback"))
+				}
+
+				g.Assert(client.unsubscribed).Equal([]string{topic})
+				_, e := streamer.NextWriter(defs.TextWriter)
+				g.Assert(e.Error()).Equal(defs.ErrMQTTConnectionClosed)
+			})
+
+			g.It("unsubscribes from the feedback topic and errors on io once closed", func() {
+				g.Assert(connection.Close()).Equal(nil)
+				g.Assert(client.unsubscribed).Equal([]string{fmt.Sprintf(defs.MQTTDeviceFeedbackTopic, "session-1")})
+				_, e := connection.Receive()
+				g.Assert(e.Error()).Equal(defs.ErrMQTTConnectionClosed)
+				_, e = streamer.NextWriter(defs.TextWriter)
+				g.Assert(e.Error()).Equal(defs.ErrMQTTConnectionClosed)
+				g.Assert(connection.Close()).Equal(nil)
+			})
+		})
+	})
+}
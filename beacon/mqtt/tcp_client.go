@@ -0,0 +1,465 @@
+package mqtt
+
+import "io"
+import "fmt"
+import "net"
+import "sync"
+import "time"
+import "bufio"
+import "io/ioutil"
+import "strings"
+import "encoding/binary"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+
+const (
+	packetConnect     = 0x10
+	packetConnack     = 0x20
+	packetPublish     = 0x30
+	packetSubscribe   = 0x82
+	packetUnsubscribe = 0xa2
+	packetPingreq     = 0xc0
+	packetDisconnect  = 0xe0
+)
+
+// Dial opens a tcp connection to the mqtt broker at the address, returning a client connected w/ the client id. The
+// client redials the broker (w/ an exponential backoff) whenever the connection is dropped.
+func Dial(address string, clientID string, keepAlive time.Duration) (*TCPClient, error) {
+	dial := func() (net.Conn, error) {
+		return net.DialTimeout("tcp", address, keepAlive)
+	}
+
+	conn, e := dial()
+
+	if e != nil {
+		return nil, e
+	}
+
+	client, e := newTCPClient(conn, clientID, keepAlive, dial)
+
+	if e != nil {
+		conn.Close()
+		return nil, e
+	}
+
+	return client, nil
+}
+
+// NewTCPClient sends the mqtt connect packet along the connection and waits for the broker to accept it before
+// reading messages published to the client's subscriptions in the background. The client is closed once the
+// connection is dropped; clients returned from Dial reconnect instead.
+func NewTCPClient(conn net.Conn, clientID string, keepAlive time.Duration) (*TCPClient, error) {
+	return newTCPClient(conn, clientID, keepAlive, nil)
+}
+
+func newTCPClient(
+	conn net.Conn,
+	clientID string,
+	keepAlive time.Duration,
+	dial func() (net.Conn, error),
+) (*TCPClient, error) {
+	logger := logging.New(defs.MQTTClientLogPrefix, logging.Magenta)
+
+	client := &TCPClient{
+		LeveledLogger: logger,
+		clientID:      clientID,
+		keepAlive:     keepAlive,
+		dial:          dial,
+		handlers:      make(map[string]MessageHandler),
+		closed:        make(chan struct{}),
+	}
+
+	if e := client.connect(conn); e != nil {
+		return nil, e
+	}
+
+	go client.listen()
+	go client.ping(keepAlive)
+
+	return client, nil
+}
+
+// TCPClient implements the Client interface over a single connection to an mqtt broker. Messages are published and
+// subscribed to at qos 0; subscriptions are sent w/o waiting for the broker's acknowledgement so that handlers, which
+// are called from the client's read loop, are able to subscribe to other topics.
+type TCPClient struct {
+	logging.LeveledLogger
+	clientID  string
+	keepAlive time.Duration
+	dial      func() (net.Conn, error)
+	conn      net.Conn
+	reader    *bufio.Reader
+	handlers  map[string]MessageHandler
+	closed    chan struct{}
+	packetID  uint16
+	once      sync.Once
+	wlock     sync.Mutex
+	hlock     sync.Mutex
+}
+
+// Publish sends the payload to the topic.
+func (client *TCPClient) Publish(topic string, payload []byte) error {
+	return client.write(packetPublish, append(encodeString(topic), payload...))
+}
+
+// Subscribe sends a subscription for the topic to the broker, calling the handler w/ each message received on it.
+func (client *TCPClient) Subscribe(topic string, handler MessageHandler) error {
+	client.hlock.Lock()
+	client.handlers[topic] = handler
+	client.hlock.Unlock()
+
+	body := append(encodeUint16(client.nextPacketID()), encodeString(topic)...)
+
+	if e := client.write(packetSubscribe, append(body, 0)); e != nil {
+		client.removeHandler(topic)
+		return e
+	}
+
+	return nil
+}
+
+// Unsubscribe removes the subscription to the topic from the broker.
+func (client *TCPClient) Unsubscribe(topic string) error {
+	client.removeHandler(topic)
+	return client.write(packetUnsubscribe, append(encodeUint16(client.nextPacketID()), encodeString(topic)...))
+}
+
+// Close sends the disconnect packet to the broker and closes the underlying connection.
+func (client *TCPClient) Close() error {
+	var e error
+
+	client.once.Do(func() {
+		close(client.closed)
+		client.write(packetDisconnect, nil)
+		e = client.connection().Close()
+	})
+
+	return e
+}
+
+// connect sends the mqtt connect packet along the connection, replacing the one currently used by the client, and waits
+// for the broker to accept it.
+func (client *TCPClient) connect(conn net.Conn) error {
+	client.wlock.Lock()
+	client.conn = conn
+	client.wlock.Unlock()
+	client.reader = bufio.NewReader(conn)
+
+	variable := append(encodeString("MQTT"), 4, 0x02)
+	variable = append(variable, encodeUint16(uint16(client.keepAlive/time.Second))...)
+
+	if e := client.write(packetConnect, append(variable, encodeString(client.clientID)...)); e != nil {
+		return e
+	}
+
+	if client.keepAlive > 0 {
+		conn.SetReadDeadline(time.Now().Add(client.keepAlive))
+	}
+
+	kind, body, e := client.read()
+	conn.SetReadDeadline(time.Time{})
+
+	if e != nil {
+		return e
+	}
+
+	if kind != packetConnack || len(body) != 2 || body[1] != 0 {
+		return fmt.Errorf("%s: %v", defs.ErrMQTTConnectionRefused, body)
+	}
+
+	return nil
+}
+
+// reconnect redials the broker after the connection has been dropped, backing off between failed attempts, and sends
+// the subscriptions of the client along the new connection. False is returned if the client is unable to reconnect.
+func (client *TCPClient) reconnect() bool {
+	if client.dial == nil {
+		return false
+	}
+
+	client.connection().Close()
+	delay := defs.DefaultMQTTReconnectDelay
+
+	for {
+		select {
+		case <-client.closed:
+			return false
+		case <-time.After(delay):
+		}
+
+		conn, e := client.dial()
+
+		if e == nil {
+			e = client.connect(conn)
+		}
+
+		if e == nil {
+			break
+		}
+
+		if conn != nil {
+			conn.Close()
+		}
+
+		if delay *= 2; delay > defs.MaxMQTTReconnectDelay {
+			delay = defs.MaxMQTTReconnectDelay
+		}
+
+		client.Warnf("unable to reconnect to mqtt broker (retrying in %s): %s", delay, e.Error())
+	}
+
+	// The client may have been closed while connecting, in which case the new connection is not closed by it.
+	select {
+	case <-client.closed:
+		client.connection().Close()
+		return false
+	default:
+		client.Infof("reconnected to mqtt broker")
+	}
+
+	for _, topic := range client.topics() {
+		body := append(encodeUint16(client.nextPacketID()), encodeString(topic)...)
+
+		if e := client.write(packetSubscribe, append(body, 0)); e != nil {
+			client.Warnf("unable to resubscribe to %s: %s", topic, e.Error())
+		}
+	}
+
+	return true
+}
+
+func (client *TCPClient) listen() {
+	defer client.Close()
+
+	for {
+		kind, body, e := client.read()
+
+		if e == defs.Error(defs.ErrMQTTPacketTooLarge) {
+			client.Warnf("discarded packet larger than %d bytes from mqtt broker", defs.MaxMQTTPacketSize)
+			continue
+		}
+
+		if e != nil {
+			select {
+			case <-client.closed:
+				return
+			default:
+				client.Errorf("unable to read from mqtt broker: %s", e.Error())
+			}
+
+			if client.reconnect() != true {
+				return
+			}
+
+			continue
+		}
+
+		if kind&0xf0 != packetPublish {
+			continue
+		}
+
+		topic, payload, e := decodePublish(kind, body)
+
+		if e != nil {
+			client.Warnf("invalid publish packet from mqtt broker: %s", e.Error())
+			continue
+		}
+
+		for _, handler := range client.matching(topic) {
+			handler(topic, payload)
+		}
+	}
+}
+
+func (client *TCPClient) ping(keepAlive time.Duration) {
+	if keepAlive <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-client.closed:
+			return
+		case <-ticker.C:
+			if e := client.write(packetPingreq, nil); e != nil {
+				client.Warnf("unable to ping mqtt broker: %s", e.Error())
+			}
+		}
+	}
+}
+
+func (client *TCPClient) matching(topic string) []MessageHandler {
+	client.hlock.Lock()
+	defer client.hlock.Unlock()
+	handlers := make([]MessageHandler, 0, 1)
+
+	for filter, handler := range client.handlers {
+		if matchTopic(filter, topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+
+	return handlers
+}
+
+func (client *TCPClient) topics() []string {
+	client.hlock.Lock()
+	defer client.hlock.Unlock()
+	topics := make([]string, 0, len(client.handlers))
+
+	for topic := range client.handlers {
+		topics = append(topics, topic)
+	}
+
+	return topics
+}
+
+func (client *TCPClient) removeHandler(topic string) {
+	client.hlock.Lock()
+	defer client.hlock.Unlock()
+	delete(client.handlers, topic)
+}
+
+func (client *TCPClient) nextPacketID() uint16 {
+	client.hlock.Lock()
+	defer client.hlock.Unlock()
+	client.packetID++
+
+	// Packet identifiers must be non-zero.
+	if client.packetID == 0 {
+		client.packetID = 1
+	}
+
+	return client.packetID
+}
+
+func (client *TCPClient) connection() net.Conn {
+	client.wlock.Lock()
+	defer client.wlock.Unlock()
+	return client.conn
+}
+
+func (client *TCPClient) write(kind byte, body []byte) error {
+	client.wlock.Lock()
+	defer client.wlock.Unlock()
+	packet := append([]byte{kind}, encodeLength(len(body))...)
+	_, e := client.conn.Write(append(packet, body...))
+	return e
+}
+
+func (client *TCPClient) read() (byte, []byte, error) {
+	kind, e := client.reader.ReadByte()
+
+	if e != nil {
+		return 0, nil, e
+	}
+
+	length, multiplier := 0, 1
+
+	for i := 0; ; i++ {
+		// The remaining length of a packet is encoded in at most four bytes.
+		if i >= 4 {
+			return 0, nil, fmt.Errorf(defs.ErrMQTTMalformedPacket)
+		}
+
+		digit, e := client.reader.ReadByte()
+
+		if e != nil {
+			return 0, nil, e
+		}
+
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+
+	// The body of packets over the size limit is skipped so that the next packet can be read w/o allocating for it.
+	if length > defs.MaxMQTTPacketSize {
+		if _, e := io.CopyN(ioutil.Discard, client.reader, int64(length)); e != nil {
+			return 0, nil, e
+		}
+
+		return kind, nil, defs.Error(defs.ErrMQTTPacketTooLarge)
+	}
+
+	body := make([]byte, length)
+
+	if _, e := io.ReadFull(client.reader, body); e != nil {
+		return 0, nil, e
+	}
+
+	return kind, body, nil
+}
+
+// decodePublish returns the topic and payload of a publish packet, skipping the packet id sent w/ qos 1 & 2 messages.
+func decodePublish(kind byte, body []byte) (string, []byte, error) {
+	if len(body) < 2 {
+		return "", nil, fmt.Errorf(defs.ErrMQTTMalformedPacket)
+	}
+
+	topicEnd := 2 + int(binary.BigEndian.Uint16(body))
+	payloadStart := topicEnd
+
+	if kind&0x06 != 0 {
+		payloadStart += 2
+	}
+
+	if payloadStart > len(body) {
+		return "", nil, fmt.Errorf(defs.ErrMQTTMalformedPacket)
+	}
+
+	return string(body[2:topicEnd]), body[payloadStart:], nil
+}
+
+// matchTopic returns true if the topic matches the subscription filter, supporting the "+" and "#" wildcards.
+func matchTopic(filter string, topic string) bool {
+	filters, levels := strings.Split(filter, "/"), strings.Split(topic, "/")
+
+	for i, part := range filters {
+		if part == "#" {
+			return true
+		}
+
+		if i >= len(levels) || (part != "+" && part != levels[i]) {
+			return false
+		}
+	}
+
+	return len(filters) == len(levels)
+}
+
+func encodeString(value string) []byte {
+	return append(encodeUint16(uint16(len(value))), value...)
+}
+
+func encodeUint16(value uint16) []byte {
+	result := make([]byte, 2)
+	binary.BigEndian.PutUint16(result, value)
+	return result
+}
+
+func encodeLength(length int) []byte {
+	result := make([]byte, 0, 4)
+
+	for {
+		digit := byte(length % 128)
+		length /= 128
+
+		if length > 0 {
+			digit |= 0x80
+		}
+
+		result = append(result, digit)
+
+		if length == 0 {
+			return result
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package mqtt
+
+import "net"
+import "bufio"
+import "testing"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+type testPacket struct {
+	kind byte
+	body []byte
+}
+
+func Test_TCPClient(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("TCPClient", func() {
+		var broker *TCPClient
+		var conn net.Conn
+		var packets chan testPacket
+		var client *TCPClient
+
+		// connect sends the connack w/ the return code in response to the connect packet of a new client.
+		connect := func(code byte) (*TCPClient, error) {
+			go func() {
+				kind, body, _ := broker.read()
+				packets <- testPacket{kind, body}
+				broker.write(packetConnack, []byte{0, code})
+			}()
+
+			connected, e := NewTCPClient(conn, "test-client", 0)
+			client = connected
+			return connected, e
+		}
+
+		// receive reads the next packet sent by the client while the action is run.
+		receive := func(action func()) testPacket {
+			go action()
+			kind, body, _ := broker.read()
+			return testPacket{kind, body}
+		}
+
+		g.BeforeEach(func() {
+			server, pipe := net.Pipe()
+			broker = &TCPClient{conn: server, reader: bufio.NewReader(server)}
+			conn = pipe
+			packets = make(chan testPacket, 1)
+			client = nil
+		})
+
+		g.AfterEach(func() {
+			if client != nil {
+				receive(func() { client.Close() })
+			}
+
+			broker.conn.Close()
+			conn.Close()
+		})
+
+		g.It("sends the connect packet w/ the client id", func() {
+			_, e := connect(0)
+			g.Assert(e).Equal(nil)
+			packet := <-packets
+			g.Assert(packet.kind).Equal(byte(packetConnect))
+			g.Assert(string(packet.body[len(packet.body)-len("test-client"):])).Equal("test-client")
+		})
+
+		g.It("returns an error if the broker refuses the connection", func() {
+			_, e := connect(5)
+			g.Assert(e == nil).Equal(false)
+			g.Assert(e.Error()).Equal(defs.ErrMQTTConnectionRefused + ": [0 5]")
+		})
+
+		g.Describe("once connected", func() {
+			g.BeforeEach(func() {
+				connect(0)
+				<-packets
+			})
+
+			g.It("publishes the payload to the topic", func() {
+				packet := receive(func() { client.Publish("beacon/devices/a/control", []byte("hello")) })
+				g.Assert(packet.kind).Equal(byte(packetPublish))
+				topic, payload, e := decodePublish(packet.kind, packet.body)
+				g.Assert(e).Equal(nil)
+				g.Assert(topic).Equal("beacon/devices/a/control")
+				g.Assert(string(payload)).Equal("hello")
+			})
+
+			g.It("subscribes to the topic at qos 0", func() {
+				packet := receive(func() { client.Subscribe("beacon/register/+", func(string, []byte) {}) })
+				g.Assert(packet.kind).Equal(byte(packetSubscribe))
+				g.Assert(packet.body[len(packet.body)-1]).Equal(byte(0))
+				g.Assert(string(packet.body[4 : len(packet.body)-1])).Equal("beacon/register/+")
+			})
+
+			g.It("calls the handler of a matching subscription w/ messages published by the broker", func() {
+				received := make(chan testPublication, 1)
+
+				receive(func() {
+					client.Subscribe("beacon/register/+", func(topic string, payload []byte) {
+						received <- testPublication{topic, payload}
+					})
+				})
+
+				broker.write(packetPublish, append(encodeString("beacon/register/session-1"), "secret"...))
+				publication := <-received
+				g.Assert(publication.topic).Equal("beacon/register/session-1")
+				g.Assert(string(publication.payload)).Equal("secret")
+			})
+
+			g.It("discards packets larger than the maximum packet size w/o dropping the connection", func() {
+				received := make(chan testPublication, 1)
+
+				receive(func() {
+					client.Subscribe("beacon/register/+", func(topic string, payload []byte) {
+						received <- testPublication{topic, payload}
+					})
+				})
+
+				large := append(encodeString("beacon/register/session-1"), make([]byte, defs.MaxMQTTPacketSize)...)
+				broker.write(packetPublish, large)
+				broker.write(packetPublish, append(encodeString("beacon/register/session-2"), "secret"...))
+				publication := <-received
+				g.Assert(publication.topic).Equal("beacon/register/session-2")
+				g.Assert(len(received)).Equal(0)
+			})
+
+			g.It("stops calling the handler once unsubscribed", func() {
+				received := make(chan testPublication, 1)
+
+				receive(func() {
+					client.Subscribe("beacon/devices/a/feedback", func(topic string, payload []byte) {
+						received <- testPublication{topic, payload}
+					})
+				})
+
+				packet := receive(func() { client.Unsubscribe("beacon/devices/a/feedback") })
+				g.Assert(packet.kind).Equal(byte(packetUnsubscribe))
+				broker.write(packetPublish, append(encodeString("beacon/devices/a/feedback"), "ignored"...))
+				g.Assert(len(received)).Equal(0)
+			})
+		})
+	})
+
+	g.Describe("TCPClient w/ a dialer", func() {
+		g.It("redials the broker once the connection is dropped and resubscribes to its topics", func() {
+			g.Timeout(defs.DefaultMQTTReconnectDelay * 5)
+			server, pipe := net.Pipe()
+			broker := &TCPClient{conn: server, reader: bufio.NewReader(server)}
+			redialed, next := net.Pipe()
+			replacement := &TCPClient{conn: redialed, reader: bufio.NewReader(redialed)}
+
+			// accept reads the connect packet of the client and sends the connack in response to it.
+			accept := func(broker *TCPClient) {
+				broker.read()
+				broker.write(packetConnack, []byte{0, 0})
+			}
+
+			go accept(broker)
+
+			client, e := newTCPClient(pipe, "test-client", 0, func() (net.Conn, error) {
+				return next, nil
+			})
+
+			g.Assert(e).Equal(nil)
+			received := make(chan testPublication, 1)
+
+			go client.Subscribe("beacon/register/+", func(topic string, payload []byte) {
+				received <- testPublication{topic, payload}
+			})
+
+			broker.read()
+			server.Close()
+			accept(replacement)
+			kind, body, _ := replacement.read()
+			g.Assert(kind).Equal(byte(packetSubscribe))
+			g.Assert(string(body[4 : len(body)-1])).Equal("beacon/register/+")
+
+			replacement.write(packetPublish, append(encodeString("beacon/register/session-1"), "secret"...))
+			publication := <-received
+			g.Assert(publication.topic).Equal("beacon/register/session-1")
+
+			go client.Close()
+			replacement.read()
+			redialed.Close()
+		})
+	})
+
+	g.Describe("matchTopic", func() {
+		g.It("matches topics against filters w/ single and multi level wildcards", func() {
+			g.Assert(matchTopic("beacon/register/+", "beacon/register/session-1")).Equal(true)
+			g.Assert(matchTopic("beacon/register/+", "beacon/register/session-1/extra")).Equal(false)
+			g.Assert(matchTopic("beacon/register/+", "beacon/register")).Equal(false)
+			g.Assert(matchTopic("beacon/#", "beacon/devices/a/feedback")).Equal(true)
+			g.Assert(matchTopic("beacon/devices/a/feedback", "beacon/devices/b/feedback")).Equal(false)
+		})
+	})
+}
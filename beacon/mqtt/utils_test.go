@@ -0,0 +1,137 @@
+package mqtt
+
+import "log"
+import "sync"
+import "bytes"
+
+import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+
+func newTestLogger() *logging.Logger {
+	out := bytes.NewBuffer([]byte{})
+	logger := log.New(out, "", 0)
+	logger.SetFlags(0)
+	return &logging.Logger{Logger: logger}
+}
+
+type testPublication struct {
+	topic   string
+	payload []byte
+}
+
+type testClient struct {
+	sync.Mutex
+	published         []testPublication
+	subscriptions     map[string]MessageHandler
+	unsubscribed      []string
+	publishErrors     []error
+	subscriptionError error
+}
+
+func (c *testClient) Publish(topic string, payload []byte) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.publishErrors) >= 1 {
+		return c.publishErrors[0]
+	}
+
+	c.published = append(c.published, testPublication{topic, payload})
+	return nil
+}
+
+func (c *testClient) Subscribe(topic string, handler MessageHandler) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.subscriptionError != nil {
+		return c.subscriptionError
+	}
+
+	if c.subscriptions == nil {
+		c.subscriptions = make(map[string]MessageHandler)
+	}
+
+	c.subscriptions[topic] = handler
+	return nil
+}
+
+func (c *testClient) Unsubscribe(topic string) error {
+	c.Lock()
+	defer c.Unlock()
+	c.unsubscribed = append(c.unsubscribed, topic)
+	delete(c.subscriptions, topic)
+	return nil
+}
+
+func (c *testClient) handler(topic string) MessageHandler {
+	c.Lock()
+	defer c.Unlock()
+	return c.subscriptions[topic]
+}
+
+type testRegistry struct {
+	fillErrors []error
+	filled     map[string]string
+}
+
+func (r *testRegistry) FindDevice(string) (device.RegistrationDetails, error) {
+	return device.RegistrationDetails{}, nil
+}
+
+func (r *testRegistry) RemoveDevice(string) error {
+	return nil
+}
+
+func (r *testRegistry) RemoveDevices([]string) (map[string]error, error) {
+	return nil, nil
+}
+
+func (r *testRegistry) ReissueRegistration(string, string) error {
+	return nil
+}
+
+func (r *testRegistry) ListRegistrations() ([]device.RegistrationDetails, error) {
+	return nil, nil
+}
+
+func (r *testRegistry) FindDevices(string) ([]device.RegistrationDetails, error) {
+	return nil, nil
+}
+
+func (r *testRegistry) SetDeviceMeta(string, map[string]string) error {
+	return nil
+}
+
+func (r *testRegistry) RenameDevice(string, string) error {
+	return nil
+}
+
+func (r *testRegistry) GetDeviceMeta(string) (map[string]string, error) {
+	return nil, nil
+}
+
+func (r *testRegistry) DeviceExists(string) (bool, error) {
+	return false, nil
+}
+
+func (r *testRegistry) AllocateRegistration(device.RegistrationRequest) error {
+	return nil
+}
+
+func (r *testRegistry) ListPendingRegistrations() ([]device.RegistrationRequest, error) {
+	return nil, nil
+}
+
+func (r *testRegistry) FillRegistration(secret, id string) (string, error) {
+	if len(r.fillErrors) >= 1 {
+		return "", r.fillErrors[0]
+	}
+
+	if r.filled == nil {
+		r.filled = make(map[string]string)
+	}
+
+	r.filled[secret] = id
+	return id, nil
+}
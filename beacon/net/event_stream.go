@@ -0,0 +1,20 @@
+package net
+
+import "fmt"
+import "net/http"
+
+// EventStream is used by route handlers to send server-sent events along an open response.
+type EventStream struct {
+	writer  http.ResponseWriter
+	flusher http.Flusher
+}
+
+// Send writes a single event frame w/ the provided event name and data, flushing it to the client immediately.
+func (stream *EventStream) Send(event string, data []byte) error {
+	if _, e := fmt.Fprintf(stream.writer, "event: %s\ndata: %s\n\n", event, data); e != nil {
+		return e
+	}
+
+	stream.flusher.Flush()
+	return nil
+}
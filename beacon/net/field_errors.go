@@ -0,0 +1,4 @@
+package net
+
+// FieldErrors maps the name of each invalid field of a request to a message describing why it is invalid.
+type FieldErrors map[string]string
@@ -2,3 +2,6 @@ package net
 
 // Handler much like http.HandlerFunc, these are used as "route" handlers by the ServerRuntime
 type Handler func(*RequestRuntime) HandlerResult
+
+// Middleware wraps a handler, returning a handler that may short-circuit before the wrapped handler is invoked.
+type Middleware func(Handler) Handler
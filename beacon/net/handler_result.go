@@ -1,5 +1,7 @@
 package net
 
+import "github.com/golang/protobuf/proto"
+
 // HandlerResult public contract between routes and the server runtime for consistent rendering
 type HandlerResult struct {
 	Errors   []error
@@ -8,4 +10,13 @@ type HandlerResult struct {
 	Redirect string
 	NoRender bool
 	Status   int
+
+	// Fields holds per-field validation errors, rendered alongside the top-level errors.
+	Fields FieldErrors
+
+	// Signed results are rendered w/ a signature of the response body when the server runtime has a response signer.
+	Signed bool
+
+	// Protobuf, when set, is rendered in place of the results for clients that prefer protobuf responses.
+	Protobuf proto.Message
 }
@@ -1,25 +1,36 @@
 package net
 
 import "time"
+import "bytes"
 import "net/http"
+import "crypto/sha256"
+import "compress/gzip"
+import "encoding/hex"
 import "encoding/json"
 
-// JSONRenderer exposes a `Renderer` interface for rendering `HandlerResult`s in json
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// JSONRenderer exposes a `Renderer` interface for rendering `HandlerResult`s in json. When the gzip threshold is
+// positive, rendered bodies larger than it are sent gzip compressed. Signed results are sent w/ the signature of the
+// (uncompressed) body when given a signer.
 type JSONRenderer struct {
-	version string
+	version       string
+	gzipThreshold int
+	signer        defs.Signer
 }
 
 type jsonResponse struct {
-	Status  string     `json:"status"`
-	Meta    Metadata   `json:"meta"`
-	Errors  []string   `json:"errors"`
-	Results ResultList `json:"results"`
+	Status  string      `json:"status"`
+	Meta    Metadata    `json:"meta"`
+	Errors  []string    `json:"errors"`
+	Results ResultList  `json:"results"`
+	Fields  FieldErrors `json:"fields,omitempty"`
 }
 
 // Render uses a response writer and a `HandlerResult` to serialize the result in a json-api like format
 func (js *JSONRenderer) Render(response http.ResponseWriter, result HandlerResult) error {
 	headers := response.Header()
-	headers.Set("Content-Type", "application/json")
+	headers.Set(defs.APIContentTypeHeader, defs.APIJSONContentType)
 
 	errors := make([]string, 0, len(result.Errors))
 	meta := Metadata{"time": time.Now(), "version": js.version}
@@ -37,10 +48,9 @@ func (js *JSONRenderer) Render(response http.ResponseWriter, result HandlerResul
 		Meta:    meta,
 		Errors:  errors,
 		Results: result.Results,
+		Fields:  result.Fields,
 	}
 
-	writer := json.NewEncoder(response)
-
 	statusCode := result.Status
 
 	if statusCode >= 200 != true {
@@ -48,10 +58,69 @@ func (js *JSONRenderer) Render(response http.ResponseWriter, result HandlerResul
 	}
 
 	if ec := len(result.Errors); ec >= 1 {
-		response.WriteHeader(statusCode)
 		out.Status = "ERRORED"
-		return writer.Encode(out)
+	} else {
+		statusCode = http.StatusOK
+	}
+
+	body := bytes.NewBuffer([]byte{})
+
+	if e := json.NewEncoder(body).Encode(out); e != nil {
+		return e
+	}
+
+	if result.Signed != true {
+		return writeBody(response, body, statusCode, js.gzipThreshold, nil)
+	}
+
+	return writeBody(response, body, statusCode, js.gzipThreshold, js.signer)
+}
+
+// writeBody sends the rendered body w/ the status code, signing it when given a signer and compressing it when larger
+// than the (positive) gzip threshold.
+func writeBody(
+	response http.ResponseWriter,
+	body *bytes.Buffer,
+	statusCode, gzipThreshold int,
+	signer defs.Signer,
+) error {
+	headers := response.Header()
+
+	if signer != nil {
+		signature, e := sign(signer, body.Bytes())
+
+		if e != nil {
+			return e
+		}
+
+		headers.Set(defs.APIResponseSignatureHeader, signature)
+	}
+
+	if gzipThreshold <= 0 || body.Len() <= gzipThreshold {
+		response.WriteHeader(statusCode)
+		_, e := body.WriteTo(response)
+		return e
+	}
+
+	headers.Set(defs.APIContentEncodingHeader, defs.APIGzipEncoding)
+	response.WriteHeader(statusCode)
+
+	writer := gzip.NewWriter(response)
+
+	if _, e := body.WriteTo(writer); e != nil {
+		return e
+	}
+
+	return writer.Close()
+}
+
+// sign returns the hex encoded signature of the sha256 hash of the body.
+func sign(signer defs.Signer, body []byte) (string, error) {
+	digest, signature := sha256.Sum256(body), bytes.NewBuffer([]byte{})
+
+	if e := signer.Sign(signature, digest[:]); e != nil {
+		return "", e
 	}
 
-	return writer.Encode(out)
+	return hex.EncodeToString(signature.Bytes()), nil
 }
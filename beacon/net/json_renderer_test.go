@@ -2,11 +2,21 @@ package net
 
 import "fmt"
 import "bytes"
+import "crypto"
+import "strings"
 import "testing"
 import "net/http"
+import "io/ioutil"
+import "crypto/rsa"
+import "crypto/rand"
+import "crypto/sha256"
+import "compress/gzip"
+import "encoding/hex"
 import "encoding/json"
 import "net/http/httptest"
 import "github.com/franela/goblin"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/security"
 
 type jsonRendererScaffold struct {
 	recorder *httptest.ResponseRecorder
@@ -83,6 +93,122 @@ func Test_JSONRenderer(t *testing.T) {
 				g.Assert(s.parsedBody().Status).Equal("ERRORED")
 			})
 
+			g.It("omits the field errors when there are none", func() {
+				g.Assert(bytes.Contains(s.recorder.Body.Bytes(), []byte(`"fields"`))).Equal(false)
+			})
+
+		})
+
+		g.Describe("having been given a result with field errors", func() {
+
+			g.BeforeEach(func() {
+				result := HandlerResult{
+					Errors: []error{fmt.Errorf("bad-request")},
+					Fields: FieldErrors{"name": "too short", "shared_secret": "invalid hex"},
+				}
+				s.renderer.Render(s.recorder, result)
+			})
+
+			g.It("keeps the top-level error", func() {
+				g.Assert(s.parsedBody().Errors).Equal([]string{"bad-request"})
+			})
+
+			g.It("sends the error of each invalid field", func() {
+				g.Assert(s.parsedBody().Fields).Equal(FieldErrors{"name": "too short", "shared_secret": "invalid hex"})
+			})
+
+		})
+
+		g.Describe("having been given a gzip threshold", func() {
+
+			large := HandlerResult{Results: strings.Repeat("a", 2048)}
+
+			g.BeforeEach(func() {
+				s.renderer.gzipThreshold = 1024
+			})
+
+			g.It("compresses results larger than the threshold", func() {
+				g.Assert(s.renderer.Render(s.recorder, large)).Equal(nil)
+				g.Assert(s.recorder.Header().Get(defs.APIContentEncodingHeader)).Equal(defs.APIGzipEncoding)
+				reader, e := gzip.NewReader(s.recorder.Body)
+				g.Assert(e).Equal(nil)
+				res := jsonResponse{}
+				g.Assert(json.NewDecoder(reader).Decode(&res)).Equal(nil)
+				g.Assert(res.Status).Equal("SUCCESS")
+				g.Assert(res.Results).Equal(strings.Repeat("a", 2048))
+			})
+
+			g.It("keeps the status code of compressed errors", func() {
+				large.Errors = []error{fmt.Errorf("bad-request")}
+				defer func() { large.Errors = nil }()
+				s.renderer.Render(s.recorder, large)
+				g.Assert(s.recorder.Result().StatusCode).Equal(http.StatusBadRequest)
+				g.Assert(s.recorder.Header().Get(defs.APIContentEncodingHeader)).Equal(defs.APIGzipEncoding)
+			})
+
+			g.It("leaves results smaller than the threshold uncompressed", func() {
+				s.renderer.Render(s.recorder, HandlerResult{Results: "small"})
+				g.Assert(s.recorder.Header().Get(defs.APIContentEncodingHeader)).Equal("")
+				g.Assert(s.parsedBody().Results).Equal("small")
+			})
+
+		})
+
+		g.Describe("having been given a signer", func() {
+			private, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+			verify := func(body []byte, signature string) error {
+				decoded, e := hex.DecodeString(signature)
+
+				if e != nil {
+					return e
+				}
+
+				digest := sha256.Sum256(body)
+				return rsa.VerifyPKCS1v15(&private.PublicKey, crypto.SHA256, digest[:], decoded)
+			}
+
+			g.BeforeEach(func() {
+				s.renderer.signer = &security.ServerKey{PrivateKey: private}
+			})
+
+			g.It("leaves results that are not signed w/o a signature", func() {
+				s.renderer.Render(s.recorder, HandlerResult{Results: "unsigned"})
+				g.Assert(s.recorder.Header().Get(defs.APIResponseSignatureHeader)).Equal("")
+			})
+
+			g.It("sends a signature of the body that verifies against the public key", func() {
+				g.Assert(s.renderer.Render(s.recorder, HandlerResult{Results: "signed", Signed: true})).Equal(nil)
+				signature := s.recorder.Header().Get(defs.APIResponseSignatureHeader)
+				g.Assert(signature == "").Equal(false)
+				g.Assert(verify(s.recorder.Body.Bytes(), signature)).Equal(nil)
+			})
+
+			g.It("sends a signature that does not verify against a different body", func() {
+				s.renderer.Render(s.recorder, HandlerResult{Results: "signed", Signed: true})
+				signature := s.recorder.Header().Get(defs.APIResponseSignatureHeader)
+				tampered := bytes.Replace(s.recorder.Body.Bytes(), []byte("signed"), []byte("forged"), 1)
+				g.Assert(verify(tampered, signature) != nil).Equal(true)
+			})
+
+			g.It("sends a different signature for a different body", func() {
+				s.renderer.Render(s.recorder, HandlerResult{Results: "first", Signed: true})
+				first := s.recorder.Header().Get(defs.APIResponseSignatureHeader)
+				s.Reset()
+				s.renderer.signer = &security.ServerKey{PrivateKey: private}
+				s.renderer.Render(s.recorder, HandlerResult{Results: "second", Signed: true})
+				g.Assert(s.recorder.Header().Get(defs.APIResponseSignatureHeader) == first).Equal(false)
+			})
+
+			g.It("signs the uncompressed body of compressed responses", func() {
+				s.renderer.gzipThreshold = 16
+				s.renderer.Render(s.recorder, HandlerResult{Results: strings.Repeat("a", 64), Signed: true})
+				reader, e := gzip.NewReader(s.recorder.Body)
+				g.Assert(e).Equal(nil)
+				body, e := ioutil.ReadAll(reader)
+				g.Assert(e).Equal(nil)
+				g.Assert(verify(body, s.recorder.Header().Get(defs.APIResponseSignatureHeader))).Equal(nil)
+			})
 		})
 
 	})
@@ -0,0 +1,31 @@
+package net
+
+import "bytes"
+import "net/http"
+import "github.com/golang/protobuf/proto"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// ProtobufRenderer exposes a `Renderer` interface for rendering the protobuf message of `HandlerResult`s in its binary
+// encoding. Bodies are compressed & signed the same way as those of the `JSONRenderer`.
+type ProtobufRenderer struct {
+	gzipThreshold int
+	signer        defs.Signer
+}
+
+// Render marshals the protobuf message of the result, sending it as the response body.
+func (pb *ProtobufRenderer) Render(response http.ResponseWriter, result HandlerResult) error {
+	data, e := proto.Marshal(result.Protobuf)
+
+	if e != nil {
+		return e
+	}
+
+	response.Header().Set(defs.APIContentTypeHeader, defs.APIProtobufContentType)
+
+	if result.Signed != true {
+		return writeBody(response, bytes.NewBuffer(data), http.StatusOK, pb.gzipThreshold, nil)
+	}
+
+	return writeBody(response, bytes.NewBuffer(data), http.StatusOK, pb.gzipThreshold, pb.signer)
+}
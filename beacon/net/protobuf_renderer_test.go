@@ -0,0 +1,53 @@
+package net
+
+import "bytes"
+import "testing"
+import "net/http"
+import "crypto/rsa"
+import "crypto/rand"
+import "net/http/httptest"
+import "github.com/franela/goblin"
+import "github.com/golang/protobuf/proto"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/security"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+func Test_ProtobufRenderer(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("ProtobufRenderer", func() {
+		var recorder *httptest.ResponseRecorder
+		var renderer *ProtobufRenderer
+
+		message := &interchange.ReportMessage{Red: 10, Green: 20, Blue: 30}
+
+		g.BeforeEach(func() {
+			recorder = &httptest.ResponseRecorder{Body: bytes.NewBuffer([]byte{})}
+			renderer = &ProtobufRenderer{}
+		})
+
+		g.It("sends the binary encoding of the message w/ the protobuf content type", func() {
+			g.Assert(renderer.Render(recorder, HandlerResult{Protobuf: message})).Equal(nil)
+			g.Assert(recorder.Result().StatusCode).Equal(http.StatusOK)
+			g.Assert(recorder.HeaderMap.Get(defs.APIContentTypeHeader)).Equal(defs.APIProtobufContentType)
+			decoded := interchange.ReportMessage{}
+			g.Assert(proto.Unmarshal(recorder.Body.Bytes(), &decoded)).Equal(nil)
+			g.Assert(decoded.Red).Equal(uint32(10))
+			g.Assert(decoded.Blue).Equal(uint32(30))
+		})
+
+		g.It("signs the body of signed results when given a signer", func() {
+			private, _ := rsa.GenerateKey(rand.Reader, 1024)
+			renderer.signer = &security.ServerKey{PrivateKey: private}
+			renderer.Render(recorder, HandlerResult{Protobuf: message, Signed: true})
+			g.Assert(recorder.HeaderMap.Get(defs.APIResponseSignatureHeader) != "").Equal(true)
+		})
+
+		g.It("does not sign results that are not marked as signed", func() {
+			private, _ := rsa.GenerateKey(rand.Reader, 1024)
+			renderer.signer = &security.ServerKey{PrivateKey: private}
+			renderer.Render(recorder, HandlerResult{Protobuf: message})
+			g.Assert(recorder.HeaderMap.Get(defs.APIResponseSignatureHeader)).Equal("")
+		})
+	})
+}
@@ -1,7 +1,9 @@
 package net
 
+import "io"
 import "fmt"
 import "net/url"
+import "io/ioutil"
 import "net/http"
 import "encoding/json"
 
@@ -16,8 +18,10 @@ type RequestRuntime struct {
 	bg.ChannelPublisher
 	*logging.Logger
 	*http.Request
+	RequestID string
 
 	responseWriter http.ResponseWriter
+	maxBodySize    int64
 }
 
 // GetQueryParam returns a parsed url.Values struct from the request query params.
@@ -35,15 +39,43 @@ func (runtime *RequestRuntime) ContentType() string {
 	return runtime.Header.Get(defs.APIContentTypeHeader)
 }
 
-// ReadBody will attempt to fill the provided interface with values from the http request
+// ReadBody will attempt to fill the provided interface with values from the http request. Bodies larger than the max
+// body size stop being read once the limit is reached, returning a request too large error.
 func (runtime *RequestRuntime) ReadBody(target interface{}) error {
-	decoder := json.NewDecoder(runtime.Request.Body)
+	body := runtime.limitedBody()
+	decoder := json.NewDecoder(body)
 
-	if e := decoder.Decode(target); e != nil {
-		return e
+	e := decoder.Decode(target)
+
+	// The body is only cut off by the limit once every byte up to it has been read.
+	if e != nil && body.count >= body.limit {
+		return defs.Error(defs.ErrRequestTooLarge)
+	}
+
+	return e
+}
+
+// ReadAll returns the raw bytes of the request body, limited to the max body size like ReadBody.
+func (runtime *RequestRuntime) ReadAll() ([]byte, error) {
+	body := runtime.limitedBody()
+	data, e := ioutil.ReadAll(body)
+
+	if e != nil && body.count >= body.limit {
+		return nil, defs.Error(defs.ErrRequestTooLarge)
+	}
+
+	return data, e
+}
+
+func (runtime *RequestRuntime) limitedBody() *countingReader {
+	limit := runtime.maxBodySize
+
+	if limit <= 0 {
+		limit = defs.DefaultMaxRequestBodySize
 	}
 
-	return nil
+	reader := http.MaxBytesReader(runtime.responseWriter, runtime.Request.Body, limit)
+	return &countingReader{Reader: reader, limit: limit}
 }
 
 // ServerError returns a HandlerResult w/ the standardized server error response text
@@ -56,8 +88,56 @@ func (runtime *RequestRuntime) LogicError(message string) HandlerResult {
 	return HandlerResult{Errors: []error{fmt.Errorf(message)}}
 }
 
+// LookupError returns a not found logic error when the error reports that the record being looked up does not exist,
+// and a server error for any other failure (e.g the store being unreachable).
+func (runtime *RequestRuntime) LookupError(e error) HandlerResult {
+	if e == defs.Error(defs.ErrNotFound) {
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	return runtime.ServerError()
+}
+
+// ValidationError returns a HandlerResult w/ the error message along w/ the validation error of each invalid field.
+func (runtime *RequestRuntime) ValidationError(message string, fields FieldErrors) HandlerResult {
+	return HandlerResult{Errors: []error{fmt.Errorf(message)}, Fields: fields}
+}
+
 // Websocket attempts to updrade the request to a websocket connection
 func (runtime *RequestRuntime) Websocket() (defs.Streamer, error) {
 	responseWriter, request := runtime.responseWriter, runtime.Request
 	return runtime.UpgradeWebsocket(responseWriter, request, nil)
 }
+
+// EventStream prepares the response for server-sent events, returning a stream that events can be sent along.
+func (runtime *RequestRuntime) EventStream() (*EventStream, error) {
+	flusher, ok := runtime.responseWriter.(http.Flusher)
+
+	if ok != true {
+		return nil, fmt.Errorf(defs.ErrStreamingUnsupported)
+	}
+
+	headers := runtime.responseWriter.Header()
+	headers.Set(defs.APIContentTypeHeader, defs.APIEventStreamContentType)
+	headers.Set("Cache-Control", "no-cache")
+	headers.Set("Connection", "keep-alive")
+
+	runtime.responseWriter.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &EventStream{runtime.responseWriter, flusher}, nil
+}
+
+// countingReader keeps track of the amount of bytes read through it, allowing a failure to decode a request body to be
+// attributed to the body being cut off at the max body size.
+type countingReader struct {
+	io.Reader
+	count int64
+	limit int64
+}
+
+func (reader *countingReader) Read(data []byte) (int, error) {
+	n, e := reader.Reader.Read(data)
+	reader.count += int64(n)
+	return n, e
+}
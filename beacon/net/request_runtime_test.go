@@ -4,6 +4,7 @@ import "io"
 import "fmt"
 import "log"
 import "bytes"
+import "strings"
 import "net/url"
 import "testing"
 import "net/http"
@@ -86,6 +87,25 @@ func Test_RequestRuntime(t *testing.T) {
 			})
 		})
 
+		g.Describe("#EventStream", func() {
+
+			g.It("returns an error if the response writer is unable to flush", func() {
+				_, e := s.runtime.EventStream()
+				g.Assert(e.Error()).Equal(defs.ErrStreamingUnsupported)
+			})
+
+			g.It("writes the event stream headers and sends event frames", func() {
+				recorder := httptest.NewRecorder()
+				s.runtime.responseWriter = recorder
+				stream, e := s.runtime.EventStream()
+				g.Assert(e).Equal(nil)
+				g.Assert(recorder.Header().Get(defs.APIContentTypeHeader)).Equal(defs.APIEventStreamContentType)
+				g.Assert(stream.Send("hello", []byte("world"))).Equal(nil)
+				g.Assert(recorder.Body.String()).Equal("event: hello\ndata: world\n\n")
+				g.Assert(recorder.Flushed).Equal(true)
+			})
+		})
+
 		g.Describe("#ServerError", func() {
 
 			g.It("returns the error string in the appropriate error response", func() {
@@ -102,6 +122,19 @@ func Test_RequestRuntime(t *testing.T) {
 			})
 		})
 
+		g.Describe("#LookupError", func() {
+
+			g.It("returns a not found error for errors reporting a missing record", func() {
+				r := s.runtime.LookupError(defs.Error(defs.ErrNotFound))
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+			})
+
+			g.It("returns a server error for any other error", func() {
+				r := s.runtime.LookupError(fmt.Errorf("connection refused"))
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			})
+		})
+
 		g.Describe("#ReadBody", func() {
 			g.It("returns an error if unable to parse the request body into the given interface", func() {
 				s.body.Write([]byte("}{"))
@@ -123,6 +156,57 @@ func Test_RequestRuntime(t *testing.T) {
 				g.Assert(s.runtime.ReadBody(dest)).Equal(nil)
 				g.Assert(dest.Name).Equal("frank reynolds")
 			})
+
+			g.It("decodes a body within the max body size", func() {
+				s.runtime.maxBodySize = 64
+				s.body.Write([]byte(`{"name":"frank reynolds"}`))
+				dest := &struct {
+					Name string `json:"name"`
+				}{}
+
+				g.Assert(s.runtime.ReadBody(dest)).Equal(nil)
+				g.Assert(dest.Name).Equal("frank reynolds")
+			})
+
+			g.It("rejects a body larger than the max body size w/o reading the rest of it", func() {
+				s.runtime.maxBodySize = 16
+				s.body.Write([]byte(fmt.Sprintf(`{"name":"%s"}`, strings.Repeat("frank", 1024))))
+				dest := &struct {
+					Name string `json:"name"`
+				}{}
+
+				g.Assert(s.runtime.ReadBody(dest)).Equal(defs.Error(defs.ErrRequestTooLarge))
+				g.Assert(dest.Name).Equal("")
+				g.Assert(s.body.Len() > 4096).Equal(true)
+			})
+
+			g.It("limits bodies to the default max body size w/o one configured", func() {
+				s.body.Write([]byte(fmt.Sprintf(`{"name":"%s"}`, strings.Repeat("f", defs.DefaultMaxRequestBodySize))))
+				dest := &struct {
+					Name string `json:"name"`
+				}{}
+
+				g.Assert(s.runtime.ReadBody(dest)).Equal(defs.Error(defs.ErrRequestTooLarge))
+			})
+		})
+
+		g.Describe("#ReadAll", func() {
+			g.It("returns the raw body within the max body size", func() {
+				s.runtime.maxBodySize = 64
+				s.body.Write([]byte("some feedback"))
+				data, e := s.runtime.ReadAll()
+				g.Assert(e).Equal(nil)
+				g.Assert(string(data)).Equal("some feedback")
+			})
+
+			g.It("rejects a body larger than the max body size w/o reading the rest of it", func() {
+				s.runtime.maxBodySize = 16
+				s.body.Write([]byte(strings.Repeat("frank", 1024)))
+				data, e := s.runtime.ReadAll()
+				g.Assert(e).Equal(defs.Error(defs.ErrRequestTooLarge))
+				g.Assert(len(data)).Equal(0)
+				g.Assert(s.body.Len() > 4096).Equal(true)
+			})
 		})
 
 		g.Describe("#ContentType", func() {
@@ -1,7 +1,10 @@
 package net
 
 import "fmt"
+import "strconv"
+import "strings"
 import "net/http"
+import "github.com/satori/go.uuid"
 
 import "github.com/dadleyy/beacon.api/beacon/bg"
 import "github.com/dadleyy/beacon.api/beacon/defs"
@@ -16,6 +19,16 @@ type ServerRuntime struct {
 	bg.ChannelPublisher
 	*logging.Logger
 	ApplicationVersion string
+
+	// GzipThreshold is the size (in bytes) past which rendered responses are gzip compressed for clients that accept
+	// gzip encoding; zero disables compression.
+	GzipThreshold int
+
+	// MaxBodySize is the size (in bytes) request bodies are limited to when read; zero uses the default size.
+	MaxBodySize int64
+
+	// ResponseSigner, if provided, is used to sign the body of the responses routes mark as signed.
+	ResponseSigner defs.Signer
 }
 
 // ServerHTTP implmentation of the http.Handler interface method
@@ -27,16 +40,28 @@ func (runtime *ServerRuntime) ServeHTTP(responseWriter http.ResponseWriter, requ
 		Status: 404,
 	}
 
-	runtime.Debugf("%s %s %s\n", request.Method, request.URL.Path, request.URL.Host)
+	requestID := request.Header.Get(defs.APIRequestIDHeader)
+
+	// Client provided request ids are only used if they are safe to include in log lines.
+	if defs.RequestIDPattern.MatchString(requestID) != true {
+		requestID = uuid.NewV4().String()
+	}
+
+	logger := runtime.Logger.WithTag(fmt.Sprintf("request:%s", requestID))
+	responseWriter.Header().Set(defs.APIRequestIDHeader, requestID)
+
+	logger.Debugf("%s %s %s\n", request.Method, request.URL.Path, request.URL.Host)
 
 	requestRuntime := RequestRuntime{
 		Values:            params,
 		WebsocketUpgrader: runtime.WebsocketUpgrader,
-		Logger:            runtime.Logger,
+		Logger:            logger,
 		Request:           request,
 		ChannelPublisher:  runtime.ChannelPublisher,
+		RequestID:         requestID,
 
 		responseWriter: responseWriter,
+		maxBodySize:    runtime.MaxBodySize,
 	}
 
 	if found == true {
@@ -52,20 +77,100 @@ func (runtime *ServerRuntime) ServeHTTP(responseWriter http.ResponseWriter, requ
 	var renderer Renderer
 
 	if result.NoRender {
-		runtime.Debugf("skipping server runtime render, response already sent")
+		logger.Debugf("skipping server runtime render, response already sent")
 		return
 	}
 
-	switch request.Header.Get("accepts") {
+	threshold := runtime.GzipThreshold
+
+	// Whether or not this response is compressed, another w/ a different accept encoding header may be; caches need to
+	// know that regardless of this client's header.
+	if threshold > 0 {
+		responseWriter.Header().Add(defs.APIVaryHeader, defs.APIAcceptEncodingHeader)
+	}
+
+	if acceptsGzip(request) != true {
+		threshold = 0
+	}
+
+	// Results w/ a protobuf message are rendered according to the accept header, which caches must also key them by.
+	if result.Protobuf != nil {
+		responseWriter.Header().Add(defs.APIVaryHeader, defs.APIAcceptHeader)
+	}
+
+	switch {
+	case result.Protobuf != nil && prefersProtobuf(request):
+		renderer = &ProtobufRenderer{
+			gzipThreshold: threshold,
+			signer:        runtime.ResponseSigner,
+		}
 	default:
 		renderer = &JSONRenderer{
-			version: runtime.ApplicationVersion,
+			version:       runtime.ApplicationVersion,
+			gzipThreshold: threshold,
+			signer:        runtime.ResponseSigner,
 		}
 	}
 
 	if e := renderer.Render(responseWriter, result); e != nil {
-		runtime.Errorf("unable to render results: %s", e.Error())
+		logger.Errorf("unable to render results: %s", e.Error())
 		responseWriter.WriteHeader(http.StatusNotFound)
 		fmt.Fprintf(responseWriter, "server error")
 	}
 }
+
+// prefersProtobuf returns whether the request's accept header gives protobuf a higher quality than json; json is
+// preferred when neither (or both equally) are listed.
+func prefersProtobuf(request *http.Request) bool {
+	accept := request.Header.Get(defs.APIAcceptHeader)
+	return acceptQuality(accept, defs.APIProtobufContentType) > acceptQuality(accept, defs.APIJSONContentType)
+}
+
+// acceptQuality returns the quality an accept header gives the content type; one unless a quality parameter says
+// otherwise, and zero if it is not listed.
+func acceptQuality(accept, contentType string) float64 {
+	for _, value := range strings.Split(accept, ",") {
+		parts := strings.Split(value, ";")
+
+		if strings.TrimSpace(parts[0]) != contentType {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			param = strings.Replace(param, " ", "", -1)
+
+			if strings.HasPrefix(param, "q=") != true {
+				continue
+			}
+
+			if quality, e := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); e == nil {
+				return quality
+			}
+		}
+
+		return 1
+	}
+
+	return 0
+}
+
+// acceptsGzip returns whether the request's accept encoding header lists gzip w/o giving it a quality of zero.
+func acceptsGzip(request *http.Request) bool {
+	for _, value := range strings.Split(request.Header.Get(defs.APIAcceptEncodingHeader), ",") {
+		parts := strings.Split(value, ";")
+
+		if strings.TrimSpace(parts[0]) != defs.APIGzipEncoding {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			if quality := strings.Replace(param, " ", "", -1); quality == "q=0" || quality == "q=0.0" {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
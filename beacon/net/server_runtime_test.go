@@ -1,13 +1,20 @@
 package net
 
+import "io"
+import "log"
 import "bytes"
+import "strings"
 import "net/url"
 import "testing"
 import "net/http"
+import "compress/gzip"
 import "encoding/json"
 import "net/http/httptest"
 import "github.com/franela/goblin"
+import "github.com/golang/protobuf/proto"
 import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
 
 type testRouteMatcher struct {
 	matches []Handler
@@ -33,6 +40,7 @@ type serverRuntimeScaffold struct {
 	body           *bytes.Buffer
 	responseWriter *httptest.ResponseRecorder
 	routes         *testRouteMatcher
+	log            *bytes.Buffer
 }
 
 func (s *serverRuntimeScaffold) Reset() {
@@ -48,11 +56,13 @@ func (s *serverRuntimeScaffold) Reset() {
 
 	s.routes = &testRouteMatcher{}
 
+	s.log = new(bytes.Buffer)
+
 	s.runtime = &ServerRuntime{
 		Multiplexer:       s.routes,
 		WebsocketUpgrader: s.upgrader,
 		ChannelPublisher:  s.publisher,
-		Logger:            newTestLogger(),
+		Logger:            &logging.Logger{Logger: log.New(s.log, "", 0)},
 	}
 }
 
@@ -111,6 +121,184 @@ func Test_ServerRuntime(t *testing.T) {
 
 			})
 
+			g.Describe("gzip encoding", func() {
+				results := strings.Repeat("device ", 1024)
+
+				g.BeforeEach(func() {
+					s.runtime.GzipThreshold = 1024
+					s.routes.matches = append(s.routes.matches, func(*RequestRuntime) HandlerResult {
+						return HandlerResult{Results: results}
+					})
+				})
+
+				decoded := func(body io.Reader) string {
+					out := struct {
+						Results string `json:"results"`
+					}{}
+					json.NewDecoder(body).Decode(&out)
+					return out.Results
+				}
+
+				g.It("compresses large results for clients that accept gzip", func() {
+					s.request.Header.Set(defs.APIAcceptEncodingHeader, "deflate, gzip")
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(s.responseWriter.Result().Header.Get(defs.APIContentEncodingHeader)).Equal(defs.APIGzipEncoding)
+					g.Assert(s.responseWriter.Body.Len() < len(results)).Equal(true)
+					reader, e := gzip.NewReader(s.responseWriter.Body)
+					g.Assert(e).Equal(nil)
+					g.Assert(decoded(reader)).Equal(results)
+				})
+
+				g.It("does not compress results for clients that do not accept gzip", func() {
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(s.responseWriter.Result().Header.Get(defs.APIContentEncodingHeader)).Equal("")
+					g.Assert(decoded(s.responseWriter.Body)).Equal(results)
+				})
+
+				g.It("varies the response by accept encoding whether or not it was compressed", func() {
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(s.responseWriter.Result().Header.Get(defs.APIVaryHeader)).Equal(defs.APIAcceptEncodingHeader)
+
+					s.responseWriter = httptest.NewRecorder()
+					s.request.Header.Set(defs.APIAcceptEncodingHeader, "gzip")
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(s.responseWriter.Result().Header.Get(defs.APIVaryHeader)).Equal(defs.APIAcceptEncodingHeader)
+				})
+
+				g.It("does not compress results for clients that refuse gzip", func() {
+					s.request.Header.Set(defs.APIAcceptEncodingHeader, "gzip;q=0, identity")
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(s.responseWriter.Result().Header.Get(defs.APIContentEncodingHeader)).Equal("")
+					g.Assert(decoded(s.responseWriter.Body)).Equal(results)
+				})
+
+				g.It("does not compress results when the threshold is disabled", func() {
+					s.runtime.GzipThreshold = 0
+					s.request.Header.Set(defs.APIAcceptEncodingHeader, "gzip")
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(s.responseWriter.Result().Header.Get(defs.APIContentEncodingHeader)).Equal("")
+					g.Assert(s.responseWriter.Result().Header.Get(defs.APIVaryHeader)).Equal("")
+					g.Assert(decoded(s.responseWriter.Body)).Equal(results)
+				})
+			})
+
+			g.Describe("content negotiation", func() {
+				message := &interchange.ReportMessage{Red: 10}
+
+				g.BeforeEach(func() {
+					s.routes.matches = append(s.routes.matches, func(*RequestRuntime) HandlerResult {
+						return HandlerResult{Results: "json", Protobuf: message}
+					})
+				})
+
+				contentType := func() string {
+					return s.responseWriter.Result().Header.Get(defs.APIContentTypeHeader)
+				}
+
+				g.It("renders the protobuf message for clients that prefer protobuf", func() {
+					s.request.Header.Set(defs.APIAcceptHeader, defs.APIProtobufContentType)
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(contentType()).Equal(defs.APIProtobufContentType)
+					decoded := interchange.ReportMessage{}
+					g.Assert(proto.Unmarshal(s.responseWriter.Body.Bytes(), &decoded)).Equal(nil)
+					g.Assert(decoded.Red).Equal(uint32(10))
+				})
+
+				g.It("renders json w/o an accept header", func() {
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(contentType()).Equal(defs.APIJSONContentType)
+				})
+
+				g.It("renders json when it is given a higher quality than protobuf", func() {
+					s.request.Header.Set(defs.APIAcceptHeader, "application/x-protobuf;q=0.5, application/json")
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(contentType()).Equal(defs.APIJSONContentType)
+				})
+
+				g.It("renders json when both are given the same quality", func() {
+					s.request.Header.Set(defs.APIAcceptHeader, "application/json, application/x-protobuf")
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(contentType()).Equal(defs.APIJSONContentType)
+				})
+
+				g.It("renders protobuf when json is given a lower quality", func() {
+					s.request.Header.Set(defs.APIAcceptHeader, "application/json;q=0.1, application/x-protobuf")
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(contentType()).Equal(defs.APIProtobufContentType)
+				})
+
+				g.It("varies json responses by the accept header", func() {
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(contentType()).Equal(defs.APIJSONContentType)
+					g.Assert(s.responseWriter.Result().Header.Get(defs.APIVaryHeader)).Equal(defs.APIAcceptHeader)
+				})
+
+				g.It("varies protobuf responses by the accept header", func() {
+					s.request.Header.Set(defs.APIAcceptHeader, defs.APIProtobufContentType)
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(contentType()).Equal(defs.APIProtobufContentType)
+					g.Assert(s.responseWriter.Result().Header.Get(defs.APIVaryHeader)).Equal(defs.APIAcceptHeader)
+				})
+
+				g.It("lists both the accept and accept encoding headers when results may also be compressed", func() {
+					s.runtime.GzipThreshold = 1
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					vary := s.responseWriter.Result().Header[defs.APIVaryHeader]
+					g.Assert(vary).Equal([]string{defs.APIAcceptEncodingHeader, defs.APIAcceptHeader})
+				})
+
+				g.It("renders json for results w/o a protobuf message", func() {
+					s.routes.matches = []Handler{func(*RequestRuntime) HandlerResult {
+						return HandlerResult{Results: "json"}
+					}}
+					s.request.Header.Set(defs.APIAcceptHeader, defs.APIProtobufContentType)
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(contentType()).Equal(defs.APIJSONContentType)
+					g.Assert(s.responseWriter.Result().Header.Get(defs.APIVaryHeader)).Equal("")
+				})
+			})
+
+			g.Describe("request ids", func() {
+				var runtime *RequestRuntime
+
+				g.BeforeEach(func() {
+					runtime = nil
+					s.routes.matches = append(s.routes.matches, func(r *RequestRuntime) HandlerResult {
+						runtime = r
+						r.Warnf("handled request")
+						return HandlerResult{}
+					})
+				})
+
+				g.It("generates a request id and sends it along in the response header", func() {
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					id := s.responseWriter.Result().Header.Get(defs.APIRequestIDHeader)
+					g.Assert(id != "").Equal(true)
+					g.Assert(runtime.RequestID).Equal(id)
+				})
+
+				g.It("uses the request id provided in the request header", func() {
+					s.request.Header.Set(defs.APIRequestIDHeader, "client-request-1")
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(s.responseWriter.Result().Header.Get(defs.APIRequestIDHeader)).Equal("client-request-1")
+					g.Assert(runtime.RequestID).Equal("client-request-1")
+				})
+
+				g.It("includes the request id in the lines logged by the request runtime", func() {
+					s.request.Header.Set(defs.APIRequestIDHeader, "client-request-1")
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					g.Assert(strings.Contains(s.log.String(), "[request:client-request-1] handled request")).Equal(true)
+				})
+
+				g.It("replaces request ids that are unsafe to log", func() {
+					s.request.Header.Set(defs.APIRequestIDHeader, "bad id\nwith newline")
+					s.runtime.ServeHTTP(s.responseWriter, s.request)
+					id := s.responseWriter.Result().Header.Get(defs.APIRequestIDHeader)
+					g.Assert(id != "bad id\nwith newline").Equal(true)
+					g.Assert(defs.RequestIDPattern.MatchString(id)).Equal(true)
+				})
+			})
+
 		})
 
 	})
@@ -0,0 +1,48 @@
+package net
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+
+// TokenAuthorizer defines the interface used to authorize user tokens against the permissions of a device.
+type TokenAuthorizer interface {
+	AuthorizeToken(string, string, uint) bool
+}
+
+// DeviceFinder defines the interface used to resolve a device identified by either its id or its name.
+type DeviceFinder interface {
+	FindDevice(string) (device.RegistrationDetails, error)
+}
+
+// RequireToken returns a middleware that authorizes the request's user token w/ the permission against the device
+// identified by the named route param (falling back to the query param of the same name). When the finder is not nil
+// the param is resolved through it, allowing devices to be identified by name. Wrapped handlers are only invoked once
+// the token has been authorized.
+func RequireToken(auth TokenAuthorizer, finder DeviceFinder, param string, permission uint) Middleware {
+	return func(handler Handler) Handler {
+		return func(runtime *RequestRuntime) HandlerResult {
+			deviceID := runtime.Get(param)
+
+			if deviceID == "" {
+				deviceID = runtime.GetQueryParam(param)
+			}
+
+			if finder != nil && deviceID != "" {
+				details, e := finder.FindDevice(deviceID)
+
+				if e != nil {
+					return runtime.LogicError(defs.ErrInvalidToken)
+				}
+
+				deviceID = details.DeviceID
+			}
+
+			token := runtime.HeaderValue(defs.APIUserTokenHeader)
+
+			if deviceID == "" || token == "" || auth.AuthorizeToken(deviceID, token, permission) != true {
+				return runtime.LogicError(defs.ErrInvalidToken)
+			}
+
+			return handler(runtime)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package net
+
+import "fmt"
+import "bytes"
+import "net/url"
+import "testing"
+import "net/http/httptest"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+
+type testTokenAuthorizer struct {
+	authorized bool
+	attempts   []string
+}
+
+func (t *testTokenAuthorizer) AuthorizeToken(deviceID, token string, permission uint) bool {
+	t.attempts = append(t.attempts, deviceID, token)
+	return t.authorized
+}
+
+type testDeviceFinder struct {
+	devices map[string]device.RegistrationDetails
+}
+
+func (t *testDeviceFinder) FindDevice(query string) (device.RegistrationDetails, error) {
+	details, ok := t.devices[query]
+
+	if !ok {
+		return device.RegistrationDetails{}, fmt.Errorf(defs.ErrNotFound)
+	}
+
+	return details, nil
+}
+
+func Test_RequireToken(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("RequireToken", func() {
+		var auth *testTokenAuthorizer
+		var runtime *RequestRuntime
+		var calls int
+
+		handler := func(*RequestRuntime) HandlerResult {
+			calls++
+			return HandlerResult{}
+		}
+
+		g.BeforeEach(func() {
+			calls = 0
+			auth = &testTokenAuthorizer{}
+			runtime = &RequestRuntime{
+				Values:  make(url.Values),
+				Request: httptest.NewRequest("GET", "/devices", bytes.NewBuffer([]byte{})),
+			}
+		})
+
+		wrapped := func() Handler {
+			return RequireToken(auth, nil, "id", defs.SecurityDeviceTokenPermissionAdmin)(handler)
+		}
+
+		g.It("does not invoke the handler w/o a device id", func() {
+			runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			auth.authorized = true
+			r := wrapped()(runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidToken)
+			g.Assert(calls).Equal(0)
+		})
+
+		g.It("does not invoke the handler w/o a token", func() {
+			runtime.Values.Set("id", "device-1")
+			auth.authorized = true
+			r := wrapped()(runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidToken)
+			g.Assert(calls).Equal(0)
+		})
+
+		g.It("does not invoke the handler if the token is not authorized", func() {
+			runtime.Values.Set("id", "device-1")
+			runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			r := wrapped()(runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidToken)
+			g.Assert(auth.attempts).Equal([]string{"device-1", "some-token"})
+			g.Assert(calls).Equal(0)
+		})
+
+		g.It("invokes the handler once the token has been authorized", func() {
+			runtime.Values.Set("id", "device-1")
+			runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			auth.authorized = true
+			r := wrapped()(runtime)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(calls).Equal(1)
+		})
+
+		g.It("falls back to the query param when the route param is missing", func() {
+			runtime.Request = httptest.NewRequest("GET", "/devices?id=device-2", bytes.NewBuffer([]byte{}))
+			runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			auth.authorized = true
+			wrapped()(runtime)
+			g.Assert(auth.attempts).Equal([]string{"device-2", "some-token"})
+			g.Assert(calls).Equal(1)
+		})
+
+		g.Describe("w/ a device finder", func() {
+			var finder *testDeviceFinder
+
+			g.BeforeEach(func() {
+				finder = &testDeviceFinder{devices: map[string]device.RegistrationDetails{
+					"lamp": device.RegistrationDetails{DeviceID: "device-3", Name: "lamp"},
+				}}
+				runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+				auth.authorized = true
+			})
+
+			finding := func() Handler {
+				return RequireToken(auth, finder, "id", defs.SecurityDeviceTokenPermissionAdmin)(handler)
+			}
+
+			g.It("authorizes the token against the id of the device found by the param", func() {
+				runtime.Values.Set("id", "lamp")
+				r := finding()(runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(auth.attempts).Equal([]string{"device-3", "some-token"})
+				g.Assert(calls).Equal(1)
+			})
+
+			g.It("does not invoke the handler if the device cannot be found", func() {
+				runtime.Values.Set("id", "missing")
+				r := finding()(runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidToken)
+				g.Assert(len(auth.attempts)).Equal(0)
+				g.Assert(calls).Equal(0)
+			})
+		})
+	})
+}
@@ -0,0 +1,65 @@
+package routes
+
+import "strconv"
+
+import "github.com/dadleyy/beacon.api/beacon/net"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+
+// NewAuditAPI returns the route engine used to read the audit log.
+func NewAuditAPI(audit device.AuditLog, index device.Index, tokens device.TokenStore) *AuditAPI {
+	logger := logging.New(defs.AuditAPILogPrefix, logging.Green)
+	return &AuditAPI{logger, audit, index, tokens}
+}
+
+// AuditAPI route engine is responsible for reading entries from the audit log.
+type AuditAPI struct {
+	logging.LeveledLogger
+	device.AuditLog
+	device.Index
+	device.TokenStore
+}
+
+// ListAuditLog returns the latest audit entries for a device, requiring a token w/ the device's admin permission. The
+// count is applied to the audit log as a whole before the entries are filtered down to the requested device.
+func (audit *AuditAPI) ListAuditLog(runtime *net.RequestRuntime) net.HandlerResult {
+	count, e := strconv.Atoi(runtime.GetQueryParam("count"))
+
+	if e != nil || count < 1 || count > defs.AuditLogMaxLimit {
+		count = defs.AuditLogMaxLimit
+	}
+
+	details, e := audit.FindDevice(runtime.GetQueryParam("device_id"))
+
+	if e != nil {
+		audit.Warnf("invalid device id: %s", runtime.GetQueryParam("device_id"))
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	token := runtime.HeaderValue(defs.APIUserTokenHeader)
+
+	if token == "" || audit.AuthorizeToken(details.DeviceID, token, defs.SecurityDeviceTokenPermissionAdmin) != true {
+		audit.Warnf("unauthorized attempt to read audit log (token: %s, device: %s)", token, details.DeviceID)
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	entries, e := audit.AuditLog.ListAuditLog(count)
+
+	if e != nil {
+		audit.Errorf("unable to load audit log: %s", e.Error())
+		return runtime.ServerError()
+	}
+
+	results := make([]device.AuditEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.DeviceID != details.DeviceID {
+			continue
+		}
+
+		results = append(results, entry)
+	}
+
+	return net.HandlerResult{Results: results}
+}
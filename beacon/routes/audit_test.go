@@ -0,0 +1,88 @@
+package routes
+
+import "fmt"
+import "bytes"
+import "testing"
+import "net/http/httptest"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/net"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+
+type auditAPIScaffolding struct {
+	api     *AuditAPI
+	audit   *testAuditLog
+	index   *testDeviceIndex
+	tokens  *testDeviceTokenStore
+	runtime *net.RequestRuntime
+}
+
+func (s *auditAPIScaffolding) Reset() {
+	s.audit = &testAuditLog{}
+	s.index = &testDeviceIndex{}
+	s.tokens = &testDeviceTokenStore{}
+
+	s.api = &AuditAPI{
+		LeveledLogger: newTestRouteLogger(),
+		AuditLog:      s.audit,
+		Index:         s.index,
+		TokenStore:    s.tokens,
+	}
+
+	s.runtime = &net.RequestRuntime{
+		Request: httptest.NewRequest("GET", "/audit-log?device_id=device-1&count=10", bytes.NewBuffer([]byte{})),
+	}
+}
+
+func Test_AuditAPI(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("ListAuditLog", func() {
+		s := &auditAPIScaffolding{}
+
+		g.BeforeEach(s.Reset)
+
+		g.It("returns not found if unable to find the device", func() {
+			s.index.findErrors = append(s.index.findErrors, fmt.Errorf("bad-find"))
+			r := s.api.ListAuditLog(s.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.Describe("having found the device", func() {
+			g.BeforeEach(func() {
+				s.index.foundDevices = append(s.index.foundDevices, device.RegistrationDetails{DeviceID: "device-1"})
+				s.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			})
+
+			g.It("returns not found if the token is not an admin token for the device", func() {
+				r := s.api.ListAuditLog(s.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+				g.Assert(s.tokens.authorizationAttempts["device-1"]["some-token"]).Equal(
+					uint(defs.SecurityDeviceTokenPermissionAdmin),
+				)
+				g.Assert(len(s.audit.listLimits)).Equal(0)
+			})
+
+			g.It("returns a server error if unable to list the audit log", func() {
+				s.tokens.authorized = true
+				s.audit.listErrors = append(s.audit.listErrors, fmt.Errorf("bad-list"))
+				r := s.api.ListAuditLog(s.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			})
+
+			g.It("returns only the entries for the requested device", func() {
+				s.tokens.authorized = true
+				s.audit.listResults = []device.AuditEntry{
+					{Action: defs.AuditTokenCreatedAction, DeviceID: "device-1"},
+					{Action: defs.AuditTokenCreatedAction, DeviceID: "device-2"},
+				}
+				r := s.api.ListAuditLog(s.runtime)
+				results, _ := r.Results.([]device.AuditEntry)
+				g.Assert(len(results)).Equal(1)
+				g.Assert(results[0].DeviceID).Equal("device-1")
+				g.Assert(s.audit.listLimits).Equal([]int{10})
+			})
+		})
+	})
+}
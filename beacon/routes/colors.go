@@ -0,0 +1,123 @@
+package routes
+
+import "math"
+import "regexp"
+import "strconv"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+var (
+	hslColorRegex = regexp.MustCompile("^hsl(?:\\((-?\\d+),(-?\\d+),(-?\\d+)\\)|:(-?\\d+),(-?\\d+),(-?\\d+))$")
+)
+
+// defaultPalette is the set of colors that the "rand" shorthand picks from.
+var defaultPalette = []interchange.ControlFrame{
+	{Red: 231, Green: 76, Blue: 60},
+	{Red: 230, Green: 126, Blue: 34},
+	{Red: 241, Green: 196, Blue: 15},
+	{Red: 46, Green: 204, Blue: 113},
+	{Red: 26, Green: 188, Blue: 156},
+	{Red: 52, Green: 152, Blue: 219},
+	{Red: 155, Green: 89, Blue: 182},
+	{Red: 232, Green: 67, Blue: 147},
+}
+
+// namedColors is the palette frames are described w/ when responding; ties between entries equally close to a frame are
+// broken by picking the entry listed first.
+var namedColors = []struct {
+	name  string
+	frame interchange.ControlFrame
+}{
+	{"off", interchange.ControlFrame{}},
+	{"red", interchange.ControlFrame{Red: 255}},
+	{"green", interchange.ControlFrame{Green: 255}},
+	{"blue", interchange.ControlFrame{Blue: 255}},
+	{"yellow", interchange.ControlFrame{Red: 255, Green: 255}},
+	{"cyan", interchange.ControlFrame{Green: 255, Blue: 255}},
+	{"magenta", interchange.ControlFrame{Red: 255, Blue: 255}},
+	{"white", interchange.ControlFrame{Red: 255, Green: 255, Blue: 255}},
+}
+
+// NearestColorName returns the name of the palette color closest to the frame by euclidean distance in rgb space.
+func NearestColorName(frame interchange.ControlFrame) string {
+	nearest, best := "", int64(-1)
+
+	for _, named := range namedColors {
+		red := int64(frame.Red) - int64(named.frame.Red)
+		green := int64(frame.Green) - int64(named.frame.Green)
+		blue := int64(frame.Blue) - int64(named.frame.Blue)
+
+		// Comparing the squared distances keeps the comparison exact; strictly closer entries replace earlier ones.
+		if distance := red*red + green*green + blue*blue; best < 0 || distance < best {
+			nearest, best = named.name, distance
+		}
+	}
+
+	return nearest
+}
+
+// parseHSLColor converts either the `hsl(h,s,l)` or `hsl:h,s,l` form of a color into a control frame. The hue must be
+// within 0-360 while the saturation and lightness are percentages within 0-100.
+func parseHSLColor(color string) (interchange.ControlFrame, error) {
+	matches := hslColorRegex.FindStringSubmatch(color)
+
+	if matches == nil {
+		return interchange.ControlFrame{}, defs.Error(defs.ErrInvalidHSL)
+	}
+
+	components := matches[1:4]
+
+	if matches[1] == "" {
+		components = matches[4:7]
+	}
+
+	values := make([]int, len(components))
+	limits := []int{360, 100, 100}
+
+	for i, component := range components {
+		value, e := strconv.Atoi(component)
+
+		if e != nil || value < 0 || value > limits[i] {
+			return interchange.ControlFrame{}, defs.Error(defs.ErrInvalidHSL)
+		}
+
+		values[i] = value
+	}
+
+	red, green, blue := hslToRGB(float64(values[0]), float64(values[1])/100, float64(values[2])/100)
+	return interchange.ControlFrame{Red: red, Green: green, Blue: blue}, nil
+}
+
+// hslToRGB converts a hue (in degrees) and a saturation & lightness (between 0 and 1) into rgb values, rounding each
+// channel to the nearest integer so that e.g. a hue of 0 w/ full saturation & half lightness is pure red.
+func hslToRGB(hue, saturation, lightness float64) (uint32, uint32, uint32) {
+	chroma := (1 - math.Abs(2*lightness-1)) * saturation
+	sector := math.Mod(hue, 360) / 60
+	secondary := chroma * (1 - math.Abs(math.Mod(sector, 2)-1))
+
+	var red, green, blue float64
+
+	switch {
+	case sector < 1:
+		red, green = chroma, secondary
+	case sector < 2:
+		red, green = secondary, chroma
+	case sector < 3:
+		green, blue = chroma, secondary
+	case sector < 4:
+		green, blue = secondary, chroma
+	case sector < 5:
+		red, blue = secondary, chroma
+	default:
+		red, blue = chroma, secondary
+	}
+
+	offset := lightness - chroma/2
+
+	channel := func(value float64) uint32 {
+		return uint32(math.Floor((value+offset)*255 + 0.5))
+	}
+
+	return channel(red), channel(green), channel(blue)
+}
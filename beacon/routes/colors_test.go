@@ -0,0 +1,179 @@
+package routes
+
+import "fmt"
+import "testing"
+import "math/rand"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+func Test_ParseHSLColor(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("parseHSLColor", func() {
+		valid := []struct {
+			color string
+			rgb   []uint32
+		}{
+			{"hsl(0,100,50)", []uint32{255, 0, 0}},
+			{"hsl(120,100,50)", []uint32{0, 255, 0}},
+			{"hsl(240,100,50)", []uint32{0, 0, 255}},
+			{"hsl(360,100,50)", []uint32{255, 0, 0}},
+			{"hsl(60,100,50)", []uint32{255, 255, 0}},
+			{"hsl(0,0,0)", []uint32{0, 0, 0}},
+			{"hsl(0,0,100)", []uint32{255, 255, 255}},
+			{"hsl(200,0,50)", []uint32{128, 128, 128}},
+			{"hsl:120,100,25", []uint32{0, 128, 0}},
+		}
+
+		for _, c := range valid {
+			test := c
+
+			g.It("converts "+test.color, func() {
+				frame, e := parseHSLColor(test.color)
+				g.Assert(e).Equal(nil)
+				g.Assert([]uint32{frame.Red, frame.Green, frame.Blue}).Equal(test.rgb)
+			})
+		}
+
+		invalid := []string{
+			"hsl(361,100,50)",
+			"hsl(-1,100,50)",
+			"hsl(0,101,50)",
+			"hsl(0,100,101)",
+			"hsl:0,-5,50",
+			"hsl(0,100)",
+			"hsl(0,100,50",
+			"ff0000",
+		}
+
+		for _, c := range invalid {
+			color := c
+
+			g.It("rejects "+color, func() {
+				_, e := parseHSLColor(color)
+				g.Assert(e == defs.Error(defs.ErrInvalidHSL)).Equal(true)
+			})
+		}
+	})
+}
+
+func Test_RandPaletteColor(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("randPaletteColor", func() {
+		palette := []interchange.ControlFrame{
+			{Red: 10, Green: 20, Blue: 30},
+			{Red: 40, Green: 50, Blue: 60},
+			{Red: 70, Green: 80, Blue: 90},
+		}
+
+		g.It("only returns members of the palette", func() {
+			devices := Devices{Palette: palette}
+
+			for i := 0; i < 100; i++ {
+				color, found := devices.randPaletteColor(), false
+
+				for _, member := range palette {
+					found = found || (color.Red == member.Red && color.Green == member.Green && color.Blue == member.Blue)
+				}
+
+				g.Assert(found).Equal(true)
+			}
+		})
+
+		g.It("falls back to the default palette when none is configured", func() {
+			devices := Devices{}
+			color, found := devices.randPaletteColor(), false
+
+			for _, member := range defaultPalette {
+				found = found || (color.Red == member.Red && color.Green == member.Green && color.Blue == member.Blue)
+			}
+
+			g.Assert(found).Equal(true)
+		})
+
+		g.It("does not return a constant color across differently seeded sources", func() {
+			picks := make([]interchange.ControlFrame, 0, 2)
+
+			for _, seed := range []int64{1, 2, 3, 4, 5} {
+				devices := Devices{Palette: palette, Random: rand.New(rand.NewSource(seed))}
+				color := devices.randPaletteColor()
+
+				if len(picks) == 0 || picks[0].Red != color.Red {
+					picks = append(picks, color)
+				}
+			}
+
+			g.Assert(len(picks) > 1).Equal(true)
+		})
+	})
+}
+
+func Test_RandColorValue(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("randColorValue", func() {
+		g.It("returns a deterministic sequence from an injected source", func() {
+			devices := Devices{Random: rand.New(rand.NewSource(42))}
+			expected := rand.New(rand.NewSource(42))
+
+			for i := 0; i < 10; i++ {
+				g.Assert(devices.randColorValue()).Equal(uint32(expected.Intn(255)))
+			}
+		})
+
+		g.It("uses the same sequence for sources w/ the same seed", func() {
+			first := Devices{Random: rand.New(rand.NewSource(7))}
+			second := Devices{Random: rand.New(rand.NewSource(7))}
+
+			for i := 0; i < 10; i++ {
+				g.Assert(first.randColorValue()).Equal(second.randColorValue())
+			}
+		})
+
+		g.It("seeds a source when none has been injected", func() {
+			devices := Devices{}
+			devices.randColorValue()
+			g.Assert(devices.Random == nil).Equal(false)
+		})
+	})
+}
+
+func Test_NearestColorName(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("NearestColorName", func() {
+		cases := []struct {
+			frame interchange.ControlFrame
+			name  string
+		}{
+			{interchange.ControlFrame{Red: 255}, "red"},
+			{interchange.ControlFrame{Green: 255}, "green"},
+			{interchange.ControlFrame{Blue: 255}, "blue"},
+			{interchange.ControlFrame{}, "off"},
+			{interchange.ControlFrame{Red: 12, Green: 8, Blue: 20}, "off"},
+			{interchange.ControlFrame{Red: 255, Green: 255, Blue: 255}, "white"},
+			{interchange.ControlFrame{Red: 231, Green: 76, Blue: 60}, "red"},
+			{interchange.ControlFrame{Red: 241, Green: 196, Blue: 15}, "yellow"},
+			{interchange.ControlFrame{Red: 26, Green: 188, Blue: 156}, "cyan"},
+			{interchange.ControlFrame{Red: 127}, "off"},
+			{interchange.ControlFrame{Red: 128}, "red"},
+		}
+
+		for _, c := range cases {
+			test := c
+
+			g.It(fmt.Sprintf("names rgb(%d,%d,%d) %s", test.frame.Red, test.frame.Green, test.frame.Blue, test.name), func() {
+				g.Assert(NearestColorName(test.frame)).Equal(test.name)
+			})
+		}
+
+		g.It("names every palette color after itself", func() {
+			for _, named := range namedColors {
+				g.Assert(NearestColorName(named.frame)).Equal(named.name)
+			}
+		})
+	})
+}
@@ -0,0 +1,51 @@
+package routes
+
+import "github.com/satori/go.uuid"
+import "github.com/dadleyy/beacon.api/beacon/net"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+
+// ConnectionFactory defines the interface used by the registration api to open the connection of a registering device.
+// Connections are opened before the registration is filled; once filled they are attached to the id & key of the
+// device, or closed should the registration fail.
+type ConnectionFactory interface {
+	OpenConnection(*net.RequestRuntime) (PendingConnection, error)
+}
+
+// PendingConnection is an opened device connection that has not yet been attached to a registered device.
+type PendingConnection interface {
+	Attach(defs.Signer, uuid.UUID) device.Connection
+	Close() error
+}
+
+// WebsocketConnectionFactory is the default connection factory, upgrading the request to a websocket that device
+// messages are streamed over. Payloads past the compression threshold are compressed when it is set.
+type WebsocketConnectionFactory struct {
+	CompressionThreshold int
+	MaxDecompressedSize  int
+}
+
+// OpenConnection upgrades the request to a websocket.
+func (factory WebsocketConnectionFactory) OpenConnection(runtime *net.RequestRuntime) (PendingConnection, error) {
+	stream, e := runtime.Websocket()
+
+	if e != nil {
+		return nil, e
+	}
+
+	return &pendingStreamer{stream, factory.CompressionThreshold, factory.MaxDecompressedSize}, nil
+}
+
+type pendingStreamer struct {
+	defs.Streamer
+	compressionThreshold int
+	maxDecompressedSize  int
+}
+
+// Attach wraps the websocket in a streamer connection for the device.
+func (pending *pendingStreamer) Attach(key defs.Signer, deviceID uuid.UUID) device.Connection {
+	streamer := device.NewStreamerConnection(pending.Streamer, key, deviceID)
+	streamer.CompressionThreshold = pending.compressionThreshold
+	streamer.MaxDecompressedSize = pending.maxDecompressedSize
+	return streamer
+}
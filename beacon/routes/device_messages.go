@@ -1,6 +1,8 @@
 package routes
 
 import "bytes"
+import "net/http"
+import "encoding/json"
 import "github.com/golang/protobuf/proto"
 
 import "github.com/dadleyy/beacon.api/beacon/net"
@@ -27,63 +29,182 @@ type DeviceMessages struct {
 	device.Index
 }
 
-// CreateMessage publishes a new DeviceMessage to the control stream
+type controlFrameRequest struct {
+	Red   uint32 `json:"red"`
+	Green uint32 `json:"green"`
+	Blue  uint32 `json:"blue"`
+}
+
+type deviceMessageRequest struct {
+	DeviceID  string                `json:"device_id"`
+	Type      string                `json:"type"`
+	Payload   []byte                `json:"payload"`
+	Red       uint32                `json:"red"`
+	Green     uint32                `json:"green"`
+	Blue      uint32                `json:"blue"`
+	Frames    []controlFrameRequest `json:"frames"`
+	Loop      bool                  `json:"loop"`
+	Terminate string                `json:"terminate"`
+}
+
+// CreateMessage publishes new DeviceMessages to the control stream. The body may either be a single message or an
+// array of messages; a batch is only published if every message in it is valid and authorized.
 func (messages *DeviceMessages) CreateMessage(runtime *net.RequestRuntime) net.HandlerResult {
-	message := struct {
-		DeviceID string `json:"device_id"`
-		Red      uint32 `json:"red"`
-		Green    uint32 `json:"green"`
-		Blue     uint32 `json:"blue"`
-	}{}
-
-	if e := runtime.ReadBody(&message); e != nil {
-		return runtime.LogicError(defs.ErrBadRequestFormat)
-	}
+	requests, e := messages.readRequests(runtime)
 
-	details, e := messages.FindDevice(message.DeviceID)
+	if e == defs.Error(defs.ErrRequestTooLarge) {
+		messages.Warnf("device message request body too large")
+		return runtime.LogicError(defs.ErrRequestTooLarge)
+	}
 
 	if e != nil {
-		messages.Warnf("unable to locate device: %v", message.DeviceID)
-		return runtime.LogicError(defs.ErrNotFound)
+		messages.Warnf("invalid device message request: %s", e.Error())
+		return runtime.LogicError(defs.ErrBadRequestFormat)
 	}
 
 	token := runtime.HeaderValue(defs.APIUserTokenHeader)
+	batch := make([][]byte, 0, len(requests))
+	envelope := device.MessageEnvelope{RequestID: runtime.RequestID}
+
+	for _, request := range requests {
+		details, e := messages.FindDevice(request.DeviceID)
+
+		if e != nil {
+			messages.Warnf("unable to locate device[%s]: %s", request.DeviceID, e.Error())
+			return runtime.LookupError(e)
+		}
+
+		if token == "" || messages.AuthorizeToken(details.DeviceID, token, controllerPermission) != true {
+			messages.Warnf("unauthorized attempt to control device (token: %s, device: %s)", token, details.DeviceID)
+			return runtime.LogicError(defs.ErrNotFound)
+		}
+
+		messageType, payload, e := messages.content(request)
+
+		if e != nil {
+			messages.Warnf("invalid message for device[%s]: %s", details.DeviceID, e.Error())
+			return runtime.ValidationError(e.Error(), contentFieldErrors(e))
+		}
 
-	if token == "" || messages.AuthorizeToken(details.DeviceID, token, controllerPermission) != true {
-		messages.Warnf("unauthorized attempt to control device (token: %s, device: %s)", token, details.DeviceID)
-		return runtime.LogicError(defs.ErrNotFound)
+		messages.Debugf("creating device message for[%s]: %v", details.DeviceID, request)
+
+		data, e := envelope.Build(details.DeviceID, messageType, payload)
+
+		if e != nil {
+			return net.HandlerResult{Errors: []error{e}}
+		}
+
+		batch = append(batch, data)
 	}
 
-	messages.Debugf("creating device message for[%s]: %v", message.DeviceID, message)
+	for _, data := range batch {
+		e := runtime.PublishReader(defs.DeviceControlChannelName, bytes.NewBuffer(data))
+
+		if e == defs.Error(defs.ErrDeviceBusy) {
+			messages.Warnf("command channel full, unable to publish device message")
+			return net.HandlerResult{Errors: []error{e}, Status: http.StatusServiceUnavailable}
+		}
+
+		if e == defs.Error(defs.ErrControlUnavailable) {
+			messages.Warnf("control channel unavailable, unable to publish device message")
+			return net.HandlerResult{Errors: []error{e}, Status: http.StatusServiceUnavailable}
+		}
+
+		if e != nil {
+			messages.Errorf("unable to publish device message: %s", e.Error())
+			return runtime.ServerError()
+		}
+	}
+
+	return net.HandlerResult{}
+}
+
+// content returns the message type and payload for the request; requests without a type are treated as a control
+// message built from the frames of the request, or a single frame from its rgb values when no frames were provided.
+func (messages *DeviceMessages) content(request deviceMessageRequest) (interchange.DeviceMessageType, []byte, error) {
+	if request.Type == "" {
+		control, e := messages.control(request)
+
+		if e != nil {
+			return 0, nil, e
+		}
+
+		payload, e := proto.Marshal(control)
+		return interchange.DeviceMessageType_CONTROL, payload, e
+	}
 
-	commandData, e := proto.Marshal(&interchange.ControlMessage{
-		Frames: []*interchange.ControlFrame{
-			&interchange.ControlFrame{
-				Red:   message.Red,
-				Green: message.Green,
-				Blue:  message.Blue,
-			},
-		},
-	})
+	messageType, e := ParseDeviceMessageType(request.Type)
 
 	if e != nil {
-		return net.HandlerResult{Errors: []error{e}}
+		return 0, nil, e
 	}
 
-	deviceMessage := interchange.DeviceMessage{
-		Type: interchange.DeviceMessageType_CONTROL,
-		Authentication: &interchange.DeviceMessageAuthentication{
-			DeviceID: details.DeviceID,
-		},
-		Payload: commandData,
+	return messageType, request.Payload, nil
+}
+
+// control builds the control message for an untyped request. Messages that do not loop hold their last frame unless
+// the request asks for the device to be turned off once the animation has finished.
+func (messages *DeviceMessages) control(request deviceMessageRequest) (*interchange.ControlMessage, error) {
+	if len(request.Frames) > defs.DefaultControlFrameLimit {
+		return nil, defs.Error(defs.ErrTooManyControlFrames)
 	}
 
-	data, e := proto.Marshal(&deviceMessage)
+	termination, e := ParseControlTermination(request.Terminate)
 
 	if e != nil {
-		return net.HandlerResult{Errors: []error{e}}
+		return nil, e
 	}
 
-	runtime.PublishReader(defs.DeviceControlChannelName, bytes.NewBuffer(data))
-	return net.HandlerResult{}
+	frames := []*interchange.ControlFrame{
+		&interchange.ControlFrame{Red: request.Red, Green: request.Green, Blue: request.Blue},
+	}
+
+	if len(request.Frames) > 0 {
+		frames = make([]*interchange.ControlFrame, 0, len(request.Frames))
+	}
+
+	for _, frame := range request.Frames {
+		frames = append(frames, &interchange.ControlFrame{Red: frame.Red, Green: frame.Green, Blue: frame.Blue})
+	}
+
+	return &interchange.ControlMessage{Frames: frames, Loop: request.Loop, Termination: termination}, nil
+}
+
+// contentFieldErrors returns the field errors that are sent back to the client for an error returned from content.
+func contentFieldErrors(e error) net.FieldErrors {
+	switch e {
+	case defs.Error(defs.ErrInvalidControlTermination):
+		return net.FieldErrors{"terminate": defs.ValidationUnknownTermination}
+	case defs.Error(defs.ErrTooManyControlFrames):
+		return net.FieldErrors{"frames": defs.ValidationTooLong}
+	}
+
+	return net.FieldErrors{"type": defs.ValidationUnknownMessageType}
+}
+
+// readRequests reads either a single message or an array of messages from the request body.
+func (messages *DeviceMessages) readRequests(runtime *net.RequestRuntime) ([]deviceMessageRequest, error) {
+	body := json.RawMessage{}
+
+	if e := runtime.ReadBody(&body); e != nil {
+		return nil, e
+	}
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+		single := deviceMessageRequest{}
+		e := json.Unmarshal(body, &single)
+		return []deviceMessageRequest{single}, e
+	}
+
+	requests := make([]deviceMessageRequest, 0)
+
+	if e := json.Unmarshal(body, &requests); e != nil {
+		return nil, e
+	}
+
+	if len(requests) == 0 || len(requests) > defs.DefaultDeviceMessageBatchLimit {
+		return nil, defs.Error(defs.ErrBadRequestFormat)
+	}
+
+	return requests, nil
 }
@@ -3,14 +3,17 @@ package routes
 import "log"
 import "fmt"
 import "bytes"
+import "strings"
 import "testing"
 import "net/http/httptest"
 
 import "github.com/franela/goblin"
+import "github.com/golang/protobuf/proto"
 import "github.com/dadleyy/beacon.api/beacon/net"
 import "github.com/dadleyy/beacon.api/beacon/defs"
 import "github.com/dadleyy/beacon.api/beacon/device"
 import "github.com/dadleyy/beacon.api/beacon/logging"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
 
 func newDeviceMessagesAPILogger() *logging.Logger {
 	out := bytes.NewBuffer([]byte{})
@@ -24,6 +27,7 @@ type testDeviceMessagesAPIScaffolding struct {
 	internals *testDeviceMessagesAPIInternals
 	runtime   *net.RequestRuntime
 	body      *bytes.Buffer
+	publisher *testChannelPublisher
 }
 
 type testDeviceMessagesAPIInternals struct {
@@ -31,6 +35,7 @@ type testDeviceMessagesAPIInternals struct {
 	createdTokens []device.TokenDetails
 	foundTokens   []device.TokenDetails
 	foundDevices  []device.RegistrationDetails
+	findErrors    []error
 	removalErrors []error
 }
 
@@ -43,11 +48,15 @@ func (t *testDeviceMessagesAPIInternals) RemoveDevice(string) error {
 }
 
 func (t *testDeviceMessagesAPIInternals) FindDevice(string) (device.RegistrationDetails, error) {
+	if len(t.findErrors) >= 1 {
+		return device.RegistrationDetails{}, t.findErrors[0]
+	}
+
 	if len(t.foundDevices) >= 1 {
 		return t.foundDevices[0], nil
 	}
 
-	return device.RegistrationDetails{}, fmt.Errorf("not-found")
+	return device.RegistrationDetails{}, defs.Error(defs.ErrNotFound)
 }
 
 func (t *testDeviceMessagesAPIInternals) CreateToken(string, string, uint) (device.TokenDetails, error) {
@@ -66,6 +75,18 @@ func (t *testDeviceMessagesAPIInternals) ListTokens(string) ([]device.TokenDetai
 	return nil, fmt.Errorf("not-found")
 }
 
+func (t *testDeviceMessagesAPIInternals) ListAllTokens(int) ([]device.TokenDetails, error) {
+	return t.foundTokens, nil
+}
+
+func (t *testDeviceMessagesAPIInternals) FindToken(string) (device.TokenDetails, error) {
+	if len(t.foundTokens) >= 1 {
+		return t.foundTokens[0], nil
+	}
+
+	return device.TokenDetails{}, fmt.Errorf("not-found")
+}
+
 func (t *testDeviceMessagesAPIInternals) AuthorizeToken(string, string, uint) bool {
 	return t.authorized
 }
@@ -100,6 +121,7 @@ func Test_DeviceMessagesAPI(t *testing.T) {
 				api:       api,
 				internals: internals,
 				body:      body,
+				publisher: &publisher,
 				runtime: &net.RequestRuntime{
 					Request:          request,
 					ChannelPublisher: &publisher,
@@ -122,6 +144,12 @@ func Test_DeviceMessagesAPI(t *testing.T) {
 				g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
 			})
 
+			g.It("returns a server error if unable to look up the device", func() {
+				scaffold.internals.findErrors = append(scaffold.internals.findErrors, fmt.Errorf("bad-find"))
+				r := scaffold.api.CreateMessage(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			})
+
 			g.Describe("when a device was found successfully", func() {
 				device := device.RegistrationDetails{}
 
@@ -145,7 +173,153 @@ func Test_DeviceMessagesAPI(t *testing.T) {
 					scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
 					r := scaffold.api.CreateMessage(scaffold.runtime)
 					g.Assert(len(r.Errors)).Equal(0)
+					g.Assert(len(scaffold.publisher.published)).Equal(1)
+				})
+			})
+		})
+
+		g.Describe("with a typed message body", func() {
+			g.BeforeEach(func() {
+				scaffold.internals.authorized = true
+				scaffold.internals.foundDevices = append(scaffold.internals.foundDevices, device.RegistrationDetails{
+					DeviceID: "123",
 				})
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			})
+
+			g.It("publishes the message w/ the requested type and decoded payload", func() {
+				scaffold.body.Write([]byte(`{"device_id": "123", "type": "welcome", "payload": "aGVsbG8="}`))
+				r := scaffold.api.CreateMessage(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				message := interchange.DeviceMessage{}
+				g.Assert(proto.Unmarshal(scaffold.publisher.published[0], &message)).Equal(nil)
+				g.Assert(message.Type).Equal(interchange.DeviceMessageType_WELCOME)
+				g.Assert(string(message.Payload)).Equal("hello")
+				g.Assert(message.Authentication.DeviceID).Equal("123")
+			})
+
+			g.It("includes the id of the request in the published message", func() {
+				scaffold.runtime.RequestID = "some-request-id"
+				scaffold.body.Write([]byte(`{"device_id": "123", "type": "welcome", "payload": "aGVsbG8="}`))
+				scaffold.api.CreateMessage(scaffold.runtime)
+				message := interchange.DeviceMessage{}
+				g.Assert(proto.Unmarshal(scaffold.publisher.published[0], &message)).Equal(nil)
+				g.Assert(message.RequestID).Equal("some-request-id")
+			})
+
+			g.It("rejects messages w/ an unknown message type", func() {
+				scaffold.body.Write([]byte(`{"device_id": "123", "type": "explode", "payload": "aGVsbG8="}`))
+				r := scaffold.api.CreateMessage(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceMessageType)
+				g.Assert(r.Fields).Equal(net.FieldErrors{"type": defs.ValidationUnknownMessageType})
+				g.Assert(len(scaffold.publisher.published)).Equal(0)
+			})
+
+			g.It("publishes each message in a batch", func() {
+				scaffold.body.Write([]byte(`[
+					{"device_id": "123", "type": "control", "payload": "b25l"},
+					{"device_id": "123", "type": "control", "payload": "dHdv"}
+				]`))
+				r := scaffold.api.CreateMessage(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(len(scaffold.publisher.published)).Equal(2)
+				second := interchange.DeviceMessage{}
+				proto.Unmarshal(scaffold.publisher.published[1], &second)
+				g.Assert(string(second.Payload)).Equal("two")
+			})
+
+			g.It("does not publish any of a batch if one of the messages is invalid", func() {
+				scaffold.body.Write([]byte(`[
+					{"device_id": "123", "type": "control", "payload": "b25l"},
+					{"device_id": "123", "type": "explode", "payload": "dHdv"}
+				]`))
+				r := scaffold.api.CreateMessage(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceMessageType)
+				g.Assert(len(scaffold.publisher.published)).Equal(0)
+			})
+
+			g.It("rejects empty batches", func() {
+				scaffold.body.Write([]byte(`[]`))
+				r := scaffold.api.CreateMessage(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrBadRequestFormat)
+			})
+		})
+
+		g.Describe("with an animated control message body", func() {
+			var control func() interchange.ControlMessage
+
+			g.BeforeEach(func() {
+				scaffold.internals.authorized = true
+				scaffold.internals.foundDevices = append(scaffold.internals.foundDevices, device.RegistrationDetails{
+					DeviceID: "123",
+				})
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+
+				control = func() interchange.ControlMessage {
+					message, result := interchange.DeviceMessage{}, interchange.ControlMessage{}
+					g.Assert(proto.Unmarshal(scaffold.publisher.published[0], &message)).Equal(nil)
+					g.Assert(message.Type).Equal(interchange.DeviceMessageType_CONTROL)
+					g.Assert(proto.Unmarshal(message.Payload, &result)).Equal(nil)
+					return result
+				}
+			})
+
+			g.It("publishes every frame w/ the loop and termination flags of the request", func() {
+				scaffold.body.Write([]byte(`{
+					"device_id": "123",
+					"frames": [{"red": 255}, {"green": 255}, {"blue": 255}],
+					"loop": true,
+					"terminate": "off"
+				}`))
+				r := scaffold.api.CreateMessage(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				message := control()
+				g.Assert(len(message.Frames)).Equal(3)
+				g.Assert(message.Frames[1].Green).Equal(uint32(255))
+				g.Assert(message.Loop).Equal(true)
+				g.Assert(message.Termination).Equal(interchange.ControlTermination_OFF)
+			})
+
+			g.It("holds the last frame by default", func() {
+				scaffold.body.Write([]byte(`{"device_id": "123", "frames": [{"red": 255}, {"blue": 255}]}`))
+				r := scaffold.api.CreateMessage(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				message := control()
+				g.Assert(len(message.Frames)).Equal(2)
+				g.Assert(message.Loop).Equal(false)
+				g.Assert(message.Termination).Equal(interchange.ControlTermination_HOLD)
+			})
+
+			g.It("sends a single frame from the rgb values when no frames were provided", func() {
+				scaffold.body.Write([]byte(`{"device_id": "123", "red": 10, "green": 20, "blue": 30, "terminate": "off"}`))
+				r := scaffold.api.CreateMessage(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				message := control()
+				g.Assert(len(message.Frames)).Equal(1)
+				g.Assert(message.Frames[0].Blue).Equal(uint32(30))
+				g.Assert(message.Termination).Equal(interchange.ControlTermination_OFF)
+			})
+
+			g.It("rejects messages w/ an unknown termination", func() {
+				scaffold.body.Write([]byte(`{"device_id": "123", "frames": [{"red": 255}], "terminate": "explode"}`))
+				r := scaffold.api.CreateMessage(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidControlTermination)
+				g.Assert(r.Fields).Equal(net.FieldErrors{"terminate": defs.ValidationUnknownTermination})
+				g.Assert(len(scaffold.publisher.published)).Equal(0)
+			})
+
+			g.It("rejects messages w/ more frames than the control frame limit", func() {
+				frames := make([]string, defs.DefaultControlFrameLimit+1)
+
+				for i := range frames {
+					frames[i] = `{"red": 255}`
+				}
+
+				scaffold.body.Write([]byte(fmt.Sprintf(`{"device_id": "123", "frames": [%s]}`, strings.Join(frames, ","))))
+				r := scaffold.api.CreateMessage(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrTooManyControlFrames)
+				g.Assert(r.Fields).Equal(net.FieldErrors{"frames": defs.ValidationTooLong})
+				g.Assert(len(scaffold.publisher.published)).Equal(0)
 			})
 		})
 
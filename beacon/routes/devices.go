@@ -1,10 +1,13 @@
 package routes
 
-import "bytes"
+import "sort"
+import "sync"
+import "time"
 import "regexp"
+import "strconv"
+import "net/http"
 import "math/rand"
 import "encoding/hex"
-import "github.com/golang/protobuf/proto"
 
 import "github.com/dadleyy/beacon.api/beacon/net"
 import "github.com/dadleyy/beacon.api/beacon/defs"
@@ -20,39 +23,499 @@ const (
 	controllerPermission = defs.SecurityDeviceTokenPermissionController
 )
 
+// DevicePool defines the interface used to check whether a device has a connection held in the control pool.
+type DevicePool interface {
+	Connected(string) bool
+}
+
 // NewDevicesAPI constructs the devices api
-func NewDevicesAPI(registry device.Registry, auth device.TokenStore) *Devices {
+func NewDevicesAPI(
+	registry device.Registry,
+	auth device.TokenStore,
+	commands device.CommandStore,
+	states device.StateStore,
+) *Devices {
 	logger := logging.New(defs.DevicesAPILogPrefix, logging.Green)
-	return &Devices{logger, registry, auth}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	return &Devices{
+		LeveledLogger: logger,
+		Registry:      registry,
+		TokenStore:    auth,
+		CommandStore:  commands,
+		StateStore:    states,
+		Palette:       defaultPalette,
+		Random:        random,
+	}
 }
 
-// Devices route engine is responsible for CRUD operations on the device objects themselves.
+// Devices route engine is responsible for CRUD operations on the device objects themselves. The palette is the set of
+// colors that the "rand" shorthand will choose from, using the random source (which is seeded when constructed). A
+// source given a fixed seed makes the frames of the "rand" & "chaos" shorthands reproducible.
 type Devices struct {
 	logging.LeveledLogger
 	device.Registry
 	device.TokenStore
+	device.CommandStore
+	device.StateStore
+	Palette []interchange.ControlFrame
+	Random  *rand.Rand
+
+	// Firmware is used to look up the firmware version reported by devices; when nil every device is reported as
+	// running the unknown version.
+	Firmware device.FirmwareStore
+
+	// History records the control commands sent to each device; when nil commands are not recorded.
+	History device.CommandHistory
+
+	// Tags is used to tag devices when patched; when nil patches that include tags fail.
+	Tags device.TagStore
+
+	// Locks, if provided, holds the lock of a patched device across every field of the patch; when nil the name and
+	// metadata are each applied under their own lock.
+	Locks device.DeviceLocker
+
+	// Names, if provided, is used to check whether the name a device is patched w/ is taken by another device; when nil
+	// the registry is searched for a device w/ the name.
+	Names device.NameIndex
+
+	// Pool, if provided, is checked for the connection of each device read; devices w/o one are reported as
+	// disconnected.
+	Pool DevicePool
+
+	// Activity, if provided, is used to report devices that have not been seen within the heartbeat interval as silent.
+	Activity device.ActivityStore
+
+	// HeartbeatInterval is how long a device can go unseen before it is reported as silent, falling back to the default
+	// when not positive.
+	HeartbeatInterval time.Duration
+
+	// ConnectionEvents is used to list the connects & disconnects of each device; when nil no events are listed.
+	ConnectionEvents device.ConnectionEventLog
+
+	// AdminToken is the server admin token required to remove devices in bulk; the route is disabled if empty.
+	AdminToken string
+
+	randomLock sync.Mutex
 }
 
-// ListDevices will return a list of the UUIDs registered in the registry
+// ListDevices will return a page of the devices registered in the registry, sorted by their id. The `page` (starting
+// at 1) and `per_page` query params select the page; pages past the end of the list are returned empty. The optional
+// `firmware` query param limits the list to devices that last reported that exact firmware version.
 func (devices *Devices) ListDevices(runtime *net.RequestRuntime) net.HandlerResult {
-	ids, e := devices.ListRegistrations()
+	registrations, e := devices.registrations(runtime.GetQueryParam("firmware"))
 
 	if e != nil {
 		devices.Errorf("unable to lookup device id list: %s", e.Error())
+		return runtime.LookupError(e)
+	}
+
+	page, e := strconv.Atoi(runtime.GetQueryParam("page"))
+
+	if e != nil || page < 1 {
+		page = 1
+	}
+
+	perPage, e := strconv.Atoi(runtime.GetQueryParam("per_page"))
+
+	if e != nil || perPage < 1 {
+		perPage = defs.DefaultDevicePageSize
+	}
+
+	if perPage > defs.MaxDevicePageSize {
+		perPage = defs.MaxDevicePageSize
+	}
+
+	sorted := make([]device.RegistrationDetails, len(registrations))
+	copy(sorted, registrations)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].DeviceID < sorted[j].DeviceID
+	})
+
+	results, total := make([]device.RegistrationDetails, 0, perPage), len(sorted)
+
+	// Compare against the page count before multiplying so that large pages cannot overflow the slice bounds.
+	if pages := (total + perPage - 1) / perPage; page-1 < pages {
+		start := (page - 1) * perPage
+		end := start + perPage
+
+		if end > total {
+			end = total
+		}
+
+		results = append(results, sorted[start:end]...)
+	}
+
+	metadata := map[string]interface{}{"total": total, "page": page, "per_page": perPage}
+	return net.HandlerResult{Results: results, Metadata: metadata}
+}
+
+// deviceDetails is returned when reading a single device, including the last known state of the device (if any) and
+// the metadata it has been given by operators.
+type deviceDetails struct {
+	device.RegistrationDetails
+	State    *device.DeviceState `json:"state"`
+	Meta     map[string]string   `json:"meta"`
+	Firmware string              `json:"firmware"`
+	Status   string              `json:"status"`
+}
+
+// GetDevice returns the details of a single device along w/ the color of the last control frame sent to it. Requests
+// are expected to have been authorized w/ the device's viewer permission by net.RequireToken.
+func (devices *Devices) GetDevice(runtime *net.RequestRuntime) net.HandlerResult {
+	query := runtime.Get("uuid")
+	details, e := devices.FindDevice(query)
+
+	if e != nil {
+		devices.Warnf("device lookup w/ invalid device id: %s (%s)", query, e.Error())
+		return runtime.LookupError(e)
+	}
+
+	result := deviceDetails{RegistrationDetails: details, Status: devices.status(details.DeviceID)}
+	state, e := devices.GetDeviceState(details.DeviceID)
+
+	if e != nil && e != defs.Error(defs.ErrNotFound) {
+		devices.Warnf("unable to load state of device %s: %s", details.DeviceID, e.Error())
+	}
+
+	if e == nil {
+		state.ColorName = NearestColorName(interchange.ControlFrame{Red: state.Red, Green: state.Green, Blue: state.Blue})
+		result.State = &state
+	}
+
+	meta, e := devices.GetDeviceMeta(details.DeviceID)
+
+	if e != nil {
+		devices.Errorf("unable to load metadata of device %s: %s", details.DeviceID, e.Error())
+		return runtime.ServerError()
+	}
+
+	result.Meta = meta
+
+	if result.Meta == nil {
+		result.Meta = make(map[string]string)
+	}
+
+	result.Firmware = defs.DefaultFirmwareVersion
+
+	if devices.Firmware == nil {
+		return net.HandlerResult{Results: result}
+	}
+
+	if result.Firmware, e = devices.Firmware.GetDeviceFirmware(details.DeviceID); e != nil {
+		devices.Errorf("unable to load firmware version of device %s: %s", details.DeviceID, e.Error())
 		return runtime.ServerError()
 	}
 
-	return net.HandlerResult{Results: ids}
+	return net.HandlerResult{Results: result}
+}
+
+// devicePatch holds the fields of a device that can be updated together; fields that are omitted are left as-is. The
+// tags are added to the tags the device already has and the metadata is merged into its existing metadata.
+type devicePatch struct {
+	Name *string           `json:"name"`
+	Tags []string          `json:"tags"`
+	Meta map[string]string `json:"meta"`
+}
+
+// Patch updates any subset of the name, tags and metadata of a device, requiring a token w/ the device's admin
+// permission. Every field is validated before any is applied; should applying a field fail the name & tags applied
+// before it are reverted on a best-effort basis. The metadata is applied last so that it never needs reverting.
+func (devices *Devices) Patch(runtime *net.RequestRuntime) net.HandlerResult {
+	patch := devicePatch{}
+	e := runtime.ReadBody(&patch)
+
+	if e == defs.Error(defs.ErrRequestTooLarge) {
+		devices.Warnf("device patch body too large")
+		return runtime.LogicError(defs.ErrRequestTooLarge)
+	}
+
+	if e != nil {
+		devices.Warnf("received invalid device patch: %s", e.Error())
+		return runtime.LogicError(defs.ErrBadRequestFormat)
+	}
+
+	if patch.Name == nil && len(patch.Tags) == 0 && len(patch.Meta) == 0 {
+		return runtime.LogicError(defs.ErrNoPatchFields)
+	}
+
+	query := runtime.Get("uuid")
+	details, e := devices.FindDevice(query)
+
+	if e != nil {
+		devices.Warnf("patch w/ invalid device id: %s (%s)", query, e.Error())
+		return runtime.LookupError(e)
+	}
+
+	token := runtime.HeaderValue(defs.APIUserTokenHeader)
+
+	if token == "" || devices.AuthorizeToken(details.DeviceID, token, defs.SecurityDeviceTokenPermissionAdmin) != true {
+		devices.Warnf("unauthorized attempt to patch device (token: %s, device: %s)", token, details.DeviceID)
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	if fields := patch.validate(); len(fields) > 0 {
+		return runtime.ValidationError(defs.ErrInvalidDevicePatch, fields)
+	}
+
+	if patch.Name != nil && *patch.Name != details.Name {
+		owner, e := devices.nameOwner(*patch.Name)
+
+		if e == nil && owner != details.DeviceID {
+			devices.Warnf("attempt to rename device %s to the name of device %s", details.DeviceID, owner)
+			return runtime.LogicError(defs.ErrDuplicateRegistrationName)
+		}
+
+		if e != nil && e != defs.Error(defs.ErrNotFound) {
+			devices.Errorf("unable to check for devices named %s: %s", *patch.Name, e.Error())
+			return runtime.ServerError()
+		}
+	}
+
+	if len(patch.Tags) > 0 && devices.Tags == nil {
+		devices.Errorf("unable to tag device %s w/o a tag store", details.DeviceID)
+		return runtime.ServerError()
+	}
+
+	updated, e := devices.patchDevice(details, patch)
+
+	if e == defs.Error(defs.ErrDeviceLocked) {
+		devices.Warnf("unable to patch device %s while it is locked", details.DeviceID)
+		return runtime.LogicError(defs.ErrDeviceLocked)
+	}
+
+	if e != nil {
+		devices.Errorf("unable to patch device %s: %s", details.DeviceID, e.Error())
+		return runtime.ServerError()
+	}
+
+	devices.Infof("patched device %s", details.DeviceID)
+	return net.HandlerResult{Results: updated}
+}
+
+// nameOwner returns the id of the device registered w/ the name, or the not found error when no device has the name.
+func (devices *Devices) nameOwner(name string) (string, error) {
+	if devices.Names != nil {
+		return devices.Names.NameOwner(name)
+	}
+
+	existing, e := devices.FindDevice(name)
+	return existing.DeviceID, e
+}
+
+type deviceRemovalRequest struct {
+	DeviceIDs []string `json:"device_ids"`
+}
+
+type deviceRemovalResult struct {
+	Removed []string          `json:"removed"`
+	Failed  map[string]string `json:"failed"`
+}
+
+// DeleteDevices removes each of the devices in the request body, requiring the server admin token. Devices that could
+// not be removed (including those that are not registered) are listed w/ their error rather than failing the request.
+func (devices *Devices) DeleteDevices(runtime *net.RequestRuntime) net.HandlerResult {
+	if authorizeAdmin(devices.AdminToken, runtime.HeaderValue(defs.APIUserTokenHeader)) != true {
+		devices.Warnf("unauthorized attempt to remove devices")
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	request := deviceRemovalRequest{}
+	e := runtime.ReadBody(&request)
+
+	if e == defs.Error(defs.ErrRequestTooLarge) {
+		devices.Warnf("device removal body too large")
+		return runtime.LogicError(defs.ErrRequestTooLarge)
+	}
+
+	if e != nil {
+		devices.Warnf("received invalid device removal: %s", e.Error())
+		return runtime.LogicError(defs.ErrBadRequestFormat)
+	}
+
+	if len(request.DeviceIDs) == 0 {
+		return runtime.ValidationError(defs.ErrInvalidDeviceRemoval, net.FieldErrors{"device_ids": defs.ValidationRequired})
+	}
+
+	if len(request.DeviceIDs) > defs.DefaultDeviceRemovalBatchLimit {
+		return runtime.ValidationError(defs.ErrInvalidDeviceRemoval, net.FieldErrors{"device_ids": defs.ValidationTooLong})
+	}
+
+	failures, e := devices.Registry.RemoveDevices(request.DeviceIDs)
+
+	if e != nil {
+		devices.Errorf("unable to remove devices: %s", e.Error())
+		return runtime.ServerError()
+	}
+
+	result := deviceRemovalResult{Removed: make([]string, 0, len(request.DeviceIDs)), Failed: make(map[string]string)}
+
+	for _, id := range request.DeviceIDs {
+		e, failed := failures[id]
+
+		if failed != true {
+			result.Removed = append(result.Removed, id)
+			continue
+		}
+
+		if e == defs.Error(defs.ErrNotFound) || e == defs.Error(defs.ErrDeviceLocked) {
+			result.Failed[id] = e.Error()
+			continue
+		}
+
+		devices.Errorf("unable to remove device %s: %s", id, e.Error())
+		result.Failed[id] = defs.ErrServerError
+	}
+
+	devices.Infof("removed %d of %d devices", len(result.Removed), len(request.DeviceIDs))
+	return net.HandlerResult{Results: result}
+}
+
+// patchDevice applies the patch while holding the lock of the device when a locker has been provided.
+func (devices *Devices) patchDevice(
+	details device.RegistrationDetails,
+	patch devicePatch,
+) (device.RegistrationDetails, error) {
+	if devices.Locks == nil {
+		return devices.applyPatch(devices.Registry, details, patch)
+	}
+
+	updated := details
+
+	e := devices.Locks.LockDevice(details.DeviceID, func(mutator device.DeviceMutator) error {
+		patched, e := devices.applyPatch(mutator, details, patch)
+		updated = patched
+		return e
+	})
+
+	if e != nil {
+		return details, e
+	}
+
+	return updated, nil
+}
+
+// applyPatch applies each field of the (validated) patch to the device, reverting the name & tags that were applied
+// should a later field fail. Tags the device already had before the patch are left in place.
+func (devices *Devices) applyPatch(
+	mutator device.DeviceMutator,
+	details device.RegistrationDetails,
+	patch devicePatch,
+) (device.RegistrationDetails, error) {
+	updated, tagged := details, make([]string, 0, len(patch.Tags))
+
+	revert := func() {
+		for _, tag := range tagged {
+			if e := devices.Tags.RemoveDeviceTag(details.DeviceID, tag); e != nil {
+				devices.Warnf("unable to revert tag %s of device %s: %s", tag, details.DeviceID, e.Error())
+			}
+		}
+
+		if updated.Name == details.Name {
+			return
+		}
+
+		if e := mutator.RenameDevice(details.DeviceID, details.Name); e != nil {
+			devices.Warnf("unable to revert name of device %s: %s", details.DeviceID, e.Error())
+		}
+	}
+
+	if patch.Name != nil && *patch.Name != details.Name {
+		if e := mutator.RenameDevice(details.DeviceID, *patch.Name); e != nil {
+			return details, e
+		}
+
+		updated.Name = *patch.Name
+	}
+
+	for _, tag := range patch.Tags {
+		added, e := devices.Tags.AddDeviceTag(details.DeviceID, tag)
+
+		if e != nil {
+			revert()
+			return details, e
+		}
+
+		if added {
+			tagged = append(tagged, tag)
+		}
+	}
+
+	if len(patch.Meta) == 0 {
+		return updated, nil
+	}
+
+	if e := mutator.SetDeviceMeta(details.DeviceID, patch.Meta); e != nil {
+		revert()
+		return details, e
+	}
+
+	return updated, nil
+}
+
+// validate returns the field errors of each invalid field in the patch.
+func (patch devicePatch) validate() net.FieldErrors {
+	fields := net.FieldErrors{}
+
+	if patch.Name != nil && len(*patch.Name) < defs.SecurityDeviceNameMinLength {
+		fields["name"] = defs.ValidationTooShort
+	}
+
+	for _, tag := range patch.Tags {
+		if defs.DeviceTagPattern.MatchString(tag) != true {
+			fields["tags"] = defs.ValidationInvalidTag
+		}
+	}
+
+	for key, value := range patch.Meta {
+		if len(key) == 0 {
+			fields["meta"] = defs.ValidationRequired
+		}
+
+		if len(key) > defs.SecurityDeviceMetaKeyMaxLength {
+			fields["meta"] = defs.ValidationTooLong
+		}
+
+		if len(value) > defs.SecurityDeviceMetaValueMaxLength {
+			fields["meta"] = defs.ValidationTooLong
+		}
+	}
+
+	return fields
+}
+
+// registrations returns every registered device, or only those running the firmware version when one is provided.
+func (devices *Devices) registrations(firmware string) ([]device.RegistrationDetails, error) {
+	if firmware == "" {
+		return devices.ListRegistrations()
+	}
+
+	if devices.Firmware == nil {
+		if firmware != defs.DefaultFirmwareVersion {
+			return nil, nil
+		}
+
+		return devices.ListRegistrations()
+	}
+
+	return devices.Firmware.ListDevicesByFirmware(firmware)
+}
+
+// commandReceipt is returned to clients that have sent a control command, identifying it for later status lookups.
+type commandReceipt struct {
+	CommandID string `json:"command_id"`
 }
 
 // UpdateShorthand accepts a device id and a color (via url params from the req) and updates the device to that color.
+// The id of the command is returned so that clients can check whether the device has acknowledged it.
 func (devices *Devices) UpdateShorthand(runtime *net.RequestRuntime) net.HandlerResult {
 	query, color := runtime.Get("uuid"), runtime.Get("color")
 	details, e := devices.FindDevice(query)
 
 	if e != nil {
 		devices.Warnf("shorthand update w/ invalid device id: %s (%s)", query, e.Error())
-		return runtime.LogicError(defs.ErrNotFound)
+		return runtime.LookupError(e)
 	}
 
 	token := runtime.HeaderValue(defs.APIUserTokenHeader)
@@ -72,32 +535,44 @@ func (devices *Devices) UpdateShorthand(runtime *net.RequestRuntime) net.Handler
 	case color == "blue":
 		frame.Blue = 255
 	case color == "rand":
+		frame = devices.randPaletteColor()
+	case color == "chaos":
 		frame = interchange.ControlFrame{
 			Red:   devices.randColorValue(),
 			Green: devices.randColorValue(),
 			Blue:  devices.randColorValue(),
 		}
+	case hslColorRegex.MatchString(color):
+		parsed, e := parseHSLColor(color)
+
+		if e != nil {
+			devices.Warnf("invalid hsl color received: %s", color)
+			return runtime.ValidationError(defs.ErrInvalidHSL, net.FieldErrors{"color": defs.ValidationOutOfRange})
+		}
+
+		frame = parsed
+		devices.Debugf("received hsl color: rgb(%d,%d,%d)", frame.Red, frame.Green, frame.Blue)
 	case hexColorRegex.MatchString(color):
 		r, g, b := color[0:2], color[2:4], color[4:6]
 		buff := make([]byte, 1)
 
 		if _, e := hex.Decode(buff, []byte(r)); e != nil {
 			devices.Warnf("[warn] invalid hex received: %s", e.Error())
-			return runtime.LogicError("invalid-hex")
+			return runtime.ValidationError("invalid-hex", net.FieldErrors{"color": defs.ValidationInvalidHex})
 		}
 
 		frame.Red = uint32(buff[0])
 
 		if _, e := hex.Decode(buff, []byte(g)); e != nil {
 			devices.Warnf("[warn] invalid hex received: %s", e.Error())
-			return runtime.LogicError("invalid-hex")
+			return runtime.ValidationError("invalid-hex", net.FieldErrors{"color": defs.ValidationInvalidHex})
 		}
 
 		frame.Green = uint32(buff[0])
 
 		if _, e := hex.Decode(buff, []byte(b)); e != nil {
 			devices.Warnf("[warn] invalid hex received: %s", e.Error())
-			return runtime.LogicError("invalid-hex")
+			return runtime.ValidationError("invalid-hex", net.FieldErrors{"color": defs.ValidationInvalidHex})
 		}
 
 		frame.Blue = uint32(buff[0])
@@ -106,38 +581,213 @@ func (devices *Devices) UpdateShorthand(runtime *net.RequestRuntime) net.Handler
 	case color == "off":
 		break
 	default:
-		return runtime.LogicError(defs.ErrInvalidColorShorthand)
+		return runtime.ValidationError(defs.ErrInvalidColorShorthand, net.FieldErrors{"color": defs.ValidationUnknownColor})
 	}
 
-	commandData, e := proto.Marshal(&interchange.ControlMessage{
-		Frames: []*interchange.ControlFrame{&frame},
+	devices.Debugf("attempting to update device %s to %s", details.DeviceID, color)
+
+	commandID, e := devices.control().Send(runtime, device.ControlCommand{
+		DeviceID:  details.DeviceID,
+		RequestID: runtime.RequestID,
+		Token:     token,
+		Frame:     frame,
 	})
 
+	if e == defs.Error(defs.ErrDeviceBusy) {
+		devices.Warnf("command channel full, unable to publish command to device %s", details.DeviceID)
+		return net.HandlerResult{Errors: []error{e}, Status: http.StatusServiceUnavailable}
+	}
+
+	if e == defs.Error(defs.ErrControlUnavailable) {
+		devices.Warnf("control channel unavailable, unable to publish command to device %s", details.DeviceID)
+		return net.HandlerResult{Errors: []error{e}, Status: http.StatusServiceUnavailable}
+	}
+
 	if e != nil {
-		return net.HandlerResult{Errors: []error{e}}
+		devices.Errorf("unable to send command to device %s: %s", details.DeviceID, e.Error())
+		return runtime.ServerError()
+	}
+
+	return net.HandlerResult{Results: commandReceipt{commandID}}
+}
+
+// control returns the sender used to send control commands to devices w/ the stores of the api.
+func (devices *Devices) control() *device.ControlSender {
+	return &device.ControlSender{
+		LeveledLogger: devices.LeveledLogger,
+		CommandStore:  devices.CommandStore,
+		StateStore:    devices.StateStore,
+		Tokens:        devices.TokenStore,
+		History:       devices.History,
 	}
+}
 
-	message := interchange.DeviceMessage{
-		Type: interchange.DeviceMessageType_CONTROL,
-		Authentication: &interchange.DeviceMessageAuthentication{
-			DeviceID: details.DeviceID,
-		},
-		Payload: commandData,
+// ListCommandHistory returns the latest control commands sent to the device, newest first. Requests are expected to
+// have been authorized w/ the device's admin permission by net.RequireToken. The `count` query param limits the amount
+// of entries returned; the history itself is capped by the store.
+func (devices *Devices) ListCommandHistory(runtime *net.RequestRuntime) net.HandlerResult {
+	query := runtime.Get("uuid")
+	details, e := devices.FindDevice(query)
+
+	if e != nil {
+		devices.Warnf("command history lookup w/ invalid device id: %s (%s)", query, e.Error())
+		return runtime.LookupError(e)
 	}
 
-	devices.Debugf("attempting to update device %s to %s", details.DeviceID, color)
+	count, e := strconv.Atoi(runtime.GetQueryParam("count"))
 
-	data, e := proto.Marshal(&message)
+	if e != nil || count < 1 {
+		count = defs.DefaultCommandHistoryCount
+	}
+
+	if devices.History == nil {
+		return net.HandlerResult{Results: []device.CommandHistoryEntry{}}
+	}
+
+	entries, e := devices.History.ListCommandHistory(details.DeviceID, count)
+
+	if e != nil {
+		devices.Errorf("unable to load command history of device %s: %s", details.DeviceID, e.Error())
+		return runtime.ServerError()
+	}
+
+	return net.HandlerResult{Results: entries}
+}
+
+// ListConnectionEvents returns the latest connects & disconnects of the device, newest first. Requests are expected to
+// have been authorized w/ the device's viewer permission by net.RequireToken. The `count` query param limits the amount
+// of events returned.
+func (devices *Devices) ListConnectionEvents(runtime *net.RequestRuntime) net.HandlerResult {
+	query := runtime.Get("uuid")
+	details, e := devices.FindDevice(query)
+
+	if e != nil {
+		devices.Warnf("connection events lookup w/ invalid device id: %s (%s)", query, e.Error())
+		return runtime.LookupError(e)
+	}
+
+	count, e := strconv.Atoi(runtime.GetQueryParam("count"))
+
+	if e != nil || count < 1 {
+		count = defs.DefaultConnectionEventCount
+	}
+
+	if devices.ConnectionEvents == nil {
+		return net.HandlerResult{Results: []device.ConnectionEvent{}}
+	}
+
+	events, e := devices.ConnectionEvents.ListConnectionEvents(details.DeviceID, count)
+
+	if e != nil {
+		devices.Errorf("unable to load connection events of device %s: %s", details.DeviceID, e.Error())
+		return runtime.ServerError()
+	}
+
+	return net.HandlerResult{Results: events}
+}
+
+// status reports the device as disconnected w/o a connection in the pool, silent when its connection lingers but the
+// device has not been seen within the heartbeat interval, or online. Devices that have never been seen are reported as
+// online since there is nothing to compare against; failing to load the last seen time is only logged.
+func (devices *Devices) status(deviceID string) string {
+	if devices.Pool != nil && devices.Pool.Connected(deviceID) != true {
+		return defs.DeviceStatusDisconnected
+	}
+
+	if devices.Activity == nil {
+		return defs.DeviceStatusOnline
+	}
+
+	lastSeen, e := devices.Activity.LastSeen(deviceID)
 
 	if e != nil {
-		return net.HandlerResult{Errors: []error{e}}
+		devices.Warnf("unable to load last seen time of device %s: %s", deviceID, e.Error())
+		return defs.DeviceStatusOnline
 	}
 
-	runtime.PublishReader(defs.DeviceControlChannelName, bytes.NewBuffer(data))
+	interval := devices.HeartbeatInterval
 
-	return net.HandlerResult{}
+	if interval <= 0 {
+		interval = defs.DefaultHeartbeatInterval
+	}
+
+	if lastSeen.IsZero() || time.Since(lastSeen) <= interval {
+		return defs.DeviceStatusOnline
+	}
+
+	return defs.DeviceStatusSilent
+}
+
+// GetState returns the color of the last control frame sent to the device. Requests are expected to have been
+// authorized w/ the device's viewer permission by net.RequireToken.
+func (devices *Devices) GetState(runtime *net.RequestRuntime) net.HandlerResult {
+	query := runtime.Get("uuid")
+	details, e := devices.FindDevice(query)
+
+	if e != nil {
+		devices.Warnf("state lookup w/ invalid device id: %s (%s)", query, e.Error())
+		return runtime.LookupError(e)
+	}
+
+	state, e := devices.GetDeviceState(details.DeviceID)
+
+	if e == defs.Error(defs.ErrNotFound) {
+		return runtime.LogicError(defs.ErrNoDeviceState)
+	}
+
+	if e != nil {
+		devices.Errorf("unable to load state of device %s: %s", details.DeviceID, e.Error())
+		return runtime.ServerError()
+	}
+
+	state.ColorName = NearestColorName(interchange.ControlFrame{Red: state.Red, Green: state.Green, Blue: state.Blue})
+	state.Status = devices.status(details.DeviceID)
+	return net.HandlerResult{Results: state}
+}
+
+// GetCommandStatus returns whether the control command has been acknowledged by its device, requiring a token w/ the
+// controller permission of the device the command was sent to.
+func (devices *Devices) GetCommandStatus(runtime *net.RequestRuntime) net.HandlerResult {
+	commandID := runtime.Get("id")
+	status, e := devices.CommandStore.GetCommandStatus(commandID)
+
+	if e != nil {
+		devices.Warnf("unable to find command[%s]: %s", commandID, e.Error())
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	token := runtime.HeaderValue(defs.APIUserTokenHeader)
+
+	if token == "" || devices.AuthorizeToken(status.DeviceID, token, controllerPermission) != true {
+		devices.Warnf("unauthorized attempt to read command status (token: %s, command: %s)", token, commandID)
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	return net.HandlerResult{Results: status}
+}
+
+func (devices *Devices) randPaletteColor() interchange.ControlFrame {
+	palette := devices.Palette
+
+	if len(palette) == 0 {
+		palette = defaultPalette
+	}
+
+	return palette[devices.randIntn(len(palette))]
 }
 
 func (devices *Devices) randColorValue() uint32 {
-	return uint32(rand.Intn(255))
+	return uint32(devices.randIntn(255))
+}
+
+// randIntn returns a value in [0,n) from the random source, which is not safe for concurrent use on its own.
+func (devices *Devices) randIntn(n int) int {
+	devices.randomLock.Lock()
+	defer devices.randomLock.Unlock()
+
+	if devices.Random == nil {
+		devices.Random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	return devices.Random.Intn(n)
 }
@@ -1,17 +1,25 @@
 package routes
 
+import "io"
 import "log"
 import "fmt"
 import "bytes"
+import "strings"
+import "time"
 import "testing"
 import "net/url"
+import "math/rand"
+import "net/http"
 import "net/http/httptest"
 import "github.com/franela/goblin"
+import "github.com/golang/protobuf/proto"
 
+import "github.com/dadleyy/beacon.api/beacon/bg"
 import "github.com/dadleyy/beacon.api/beacon/net"
 import "github.com/dadleyy/beacon.api/beacon/defs"
 import "github.com/dadleyy/beacon.api/beacon/logging"
 import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
 
 func newDevicesAPILogger() *logging.Logger {
 	out := bytes.NewBuffer([]byte{})
@@ -24,6 +32,13 @@ type testDevicesAPIScaffolding struct {
 	api        *Devices
 	registry   *testDeviceRegistry
 	tokenStore *testDeviceTokenStore
+	commands   *testCommandStore
+	states     *testStateStore
+	firmware   *testFirmwareStore
+	history    *testCommandHistory
+	tags       *testTagStore
+	connEvents *testConnectionEventLog
+	publisher  *testChannelPublisher
 	runtime    *net.RequestRuntime
 	body       *bytes.Buffer
 	pathValues url.Values
@@ -32,10 +47,22 @@ type testDevicesAPIScaffolding struct {
 func prepareDeviceAPIScaffold() testDevicesAPIScaffolding {
 	registry := testDeviceRegistry{}
 	tokenStore := testDeviceTokenStore{}
+	commands := testCommandStore{}
+	states := testStateStore{}
+	firmware := testFirmwareStore{}
+	history := testCommandHistory{}
+	tags := testTagStore{}
+	connEvents := testConnectionEventLog{}
 	api := Devices{
-		LeveledLogger: newDevicesAPILogger(),
-		Registry:      &registry,
-		TokenStore:    &tokenStore,
+		LeveledLogger:    newDevicesAPILogger(),
+		Registry:         &registry,
+		TokenStore:       &tokenStore,
+		CommandStore:     &commands,
+		StateStore:       &states,
+		Firmware:         &firmware,
+		History:          &history,
+		Tags:             &tags,
+		ConnectionEvents: &connEvents,
 	}
 
 	body := bytes.NewBuffer([]byte{})
@@ -50,6 +77,13 @@ func prepareDeviceAPIScaffold() testDevicesAPIScaffolding {
 		api:        &api,
 		registry:   &registry,
 		tokenStore: &tokenStore,
+		commands:   &commands,
+		states:     &states,
+		firmware:   &firmware,
+		history:    &history,
+		tags:       &tags,
+		connEvents: &connEvents,
+		publisher:  &publisher,
 		body:       body,
 		pathValues: pathValues,
 		runtime: &net.RequestRuntime{
@@ -77,6 +111,13 @@ func Test_DevicesAPI(t *testing.T) {
 			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
 		})
 
+		g.It("returns a not-found error if the registry reports the registrations as missing", func() {
+			registry := scaffold.registry
+			registry.listRegistrationErrors = append(registry.listRegistrationErrors, defs.Error(defs.ErrNotFound))
+			r := scaffold.api.ListDevices(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
 		g.It("returns the list of registered devices if present", func() {
 			registry := scaffold.registry
 			registry.activeRegistrations = append(registry.activeRegistrations, device.RegistrationDetails{})
@@ -86,6 +127,107 @@ func Test_DevicesAPI(t *testing.T) {
 			g.Assert(e).Equal(true)
 			g.Assert(len(l)).Equal(1)
 		})
+
+		g.Describe("w/ a firmware version", func() {
+			g.BeforeEach(func() {
+				scaffold.runtime.URL.RawQuery = "firmware=1.2.0"
+				scaffold.firmware.versions = map[string]string{"device-a": "1.2.0", "device-b": "1.1.0"}
+			})
+
+			g.It("returns only the devices that reported the firmware version", func() {
+				r := scaffold.api.ListDevices(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(scaffold.firmware.queries).Equal([]string{"1.2.0"})
+				l, _ := r.Results.([]device.RegistrationDetails)
+				g.Assert(len(l)).Equal(1)
+				g.Assert(l[0].DeviceID).Equal("device-a")
+			})
+
+			g.It("errors if unable to list the devices by firmware version", func() {
+				scaffold.firmware.errors = append(scaffold.firmware.errors, fmt.Errorf("bad-firmware"))
+				r := scaffold.api.ListDevices(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			})
+
+			g.It("returns no devices for a known version w/o a firmware store", func() {
+				scaffold.api.Firmware = nil
+				scaffold.registry.activeRegistrations = append(scaffold.registry.activeRegistrations, device.RegistrationDetails{})
+				r := scaffold.api.ListDevices(scaffold.runtime)
+				l, _ := r.Results.([]device.RegistrationDetails)
+				g.Assert(len(l)).Equal(0)
+			})
+		})
+
+		g.Describe("with more devices than fit on a single page", func() {
+			g.BeforeEach(func() {
+				for _, id := range []string{"device-e", "device-a", "device-d", "device-b", "device-c"} {
+					details := device.RegistrationDetails{DeviceID: id}
+					scaffold.registry.activeRegistrations = append(scaffold.registry.activeRegistrations, details)
+				}
+			})
+
+			ids := func(r net.HandlerResult) []string {
+				l, _ := r.Results.([]device.RegistrationDetails)
+				result := make([]string, 0, len(l))
+
+				for _, details := range l {
+					result = append(result, details.DeviceID)
+				}
+
+				return result
+			}
+
+			g.It("returns the first page of devices sorted by id", func() {
+				scaffold.runtime.URL.RawQuery = "per_page=2"
+				r := scaffold.api.ListDevices(scaffold.runtime)
+				g.Assert(ids(r)).Equal([]string{"device-a", "device-b"})
+				g.Assert(r.Metadata["total"]).Equal(5)
+				g.Assert(r.Metadata["page"]).Equal(1)
+				g.Assert(r.Metadata["per_page"]).Equal(2)
+			})
+
+			g.It("returns the requested page of devices", func() {
+				scaffold.runtime.URL.RawQuery = "page=2&per_page=2"
+				r := scaffold.api.ListDevices(scaffold.runtime)
+				g.Assert(ids(r)).Equal([]string{"device-c", "device-d"})
+				g.Assert(r.Metadata["page"]).Equal(2)
+			})
+
+			g.It("returns a partial last page", func() {
+				scaffold.runtime.URL.RawQuery = "page=3&per_page=2"
+				r := scaffold.api.ListDevices(scaffold.runtime)
+				g.Assert(ids(r)).Equal([]string{"device-e"})
+			})
+
+			g.It("returns an empty page rather than an error for pages past the end", func() {
+				scaffold.runtime.URL.RawQuery = "page=4&per_page=2"
+				r := scaffold.api.ListDevices(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(ids(r)).Equal([]string{})
+				g.Assert(r.Metadata["total"]).Equal(5)
+			})
+
+			g.It("returns an empty page for pages large enough to overflow the slice offset", func() {
+				scaffold.runtime.URL.RawQuery = "page=2305843009213693953&per_page=4"
+				r := scaffold.api.ListDevices(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(ids(r)).Equal([]string{})
+			})
+
+			g.It("falls back to the defaults w/ invalid paging params", func() {
+				scaffold.runtime.URL.RawQuery = "page=-1&per_page=abc"
+				r := scaffold.api.ListDevices(scaffold.runtime)
+				g.Assert(len(ids(r))).Equal(5)
+				g.Assert(r.Metadata["page"]).Equal(1)
+				g.Assert(r.Metadata["per_page"]).Equal(defs.DefaultDevicePageSize)
+			})
+
+			g.It("clamps the page size to the maximum", func() {
+				scaffold.runtime.URL.RawQuery = "per_page=100000"
+				r := scaffold.api.ListDevices(scaffold.runtime)
+				g.Assert(r.Metadata["per_page"]).Equal(defs.MaxDevicePageSize)
+			})
+		})
 	})
 
 	g.Describe("UpdateShorthand", func() {
@@ -100,6 +242,12 @@ func Test_DevicesAPI(t *testing.T) {
 			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
 		})
 
+		g.It("returns a server error if the store fails to look up the device", func() {
+			scaffold.registry.findErrors = append(scaffold.registry.findErrors, fmt.Errorf("bad-find"))
+			r := scaffold.api.UpdateShorthand(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+		})
+
 		g.Describe("having found a device", func() {
 			g.BeforeEach(func() {
 				testDevice := device.RegistrationDetails{}
@@ -134,6 +282,165 @@ func Test_DevicesAPI(t *testing.T) {
 					scaffold.pathValues.Set("color", "bad-value")
 					r := scaffold.api.UpdateShorthand(scaffold.runtime)
 					g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidColorShorthand)
+					g.Assert(r.Fields).Equal(net.FieldErrors{"color": defs.ValidationUnknownColor})
+				})
+
+				g.It("tracks the command and includes its id in the published device message", func() {
+					scaffold.pathValues.Set("color", "red")
+					r := scaffold.api.UpdateShorthand(scaffold.runtime)
+					g.Assert(len(r.Errors)).Equal(0)
+					receipt, ok := r.Results.(commandReceipt)
+					g.Assert(ok).Equal(true)
+					_, tracked := scaffold.commands.tracked[receipt.CommandID]
+					g.Assert(tracked).Equal(true)
+					message := interchange.DeviceMessage{}
+					g.Assert(proto.Unmarshal(scaffold.publisher.published[0], &message)).Equal(nil)
+					g.Assert(message.CommandID).Equal(receipt.CommandID)
+				})
+
+				g.It("stamps the published device message w/ the time it was issued", func() {
+					scaffold.pathValues.Set("color", "red")
+					before := time.Now().Unix()
+					scaffold.api.UpdateShorthand(scaffold.runtime)
+					message := interchange.DeviceMessage{}
+					g.Assert(proto.Unmarshal(scaffold.publisher.published[0], &message)).Equal(nil)
+					g.Assert(message.IssuedAt >= before).Equal(true)
+				})
+
+				g.It("does not publish the command if unable to track it", func() {
+					scaffold.pathValues.Set("color", "red")
+					scaffold.commands.trackErrors = append(scaffold.commands.trackErrors, fmt.Errorf("bad-track"))
+					r := scaffold.api.UpdateShorthand(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+					g.Assert(len(scaffold.publisher.published)).Equal(0)
+				})
+
+				g.It("records the published frame as the state of the device", func() {
+					scaffold.pathValues.Set("color", "ff8000")
+					scaffold.api.UpdateShorthand(scaffold.runtime)
+					state := scaffold.states.states[""]
+					g.Assert([]uint32{state.Red, state.Green, state.Blue}).Equal([]uint32{255, 128, 0})
+				})
+
+				g.It("records each command in the history of the device in the order they were sent", func() {
+					scaffold.tokenStore.foundTokens = append(scaffold.tokenStore.foundTokens, device.TokenDetails{TokenID: "t1"})
+					scaffold.pathValues.Set("color", "red")
+					first := scaffold.api.UpdateShorthand(scaffold.runtime).Results.(commandReceipt)
+					scaffold.pathValues.Set("color", "0000ff")
+					second := scaffold.api.UpdateShorthand(scaffold.runtime).Results.(commandReceipt)
+					history := scaffold.history.recorded[""]
+					g.Assert(len(history)).Equal(2)
+					g.Assert(history[0].CommandID).Equal(second.CommandID)
+					g.Assert(history[0].Blue).Equal(uint32(255))
+					g.Assert(history[1].CommandID).Equal(first.CommandID)
+					g.Assert(history[1].Red).Equal(uint32(255))
+					g.Assert(history[1].TokenID).Equal("t1")
+				})
+
+				g.It("does not fail the request if unable to record the command in the history", func() {
+					scaffold.history.errors = append(scaffold.history.errors, fmt.Errorf("bad-history"))
+					scaffold.pathValues.Set("color", "red")
+					r := scaffold.api.UpdateShorthand(scaffold.runtime)
+					g.Assert(len(r.Errors)).Equal(0)
+				})
+
+				g.Describe("w/ a seeded random source", func() {
+					published := func() interchange.ControlFrame {
+						message, control := interchange.DeviceMessage{}, interchange.ControlMessage{}
+						g.Assert(proto.Unmarshal(scaffold.publisher.published[0], &message)).Equal(nil)
+						g.Assert(proto.Unmarshal(message.Payload, &control)).Equal(nil)
+						g.Assert(len(control.Frames)).Equal(1)
+						return *control.Frames[0]
+					}
+
+					g.BeforeEach(func() {
+						scaffold.api.Random = rand.New(rand.NewSource(42))
+					})
+
+					g.It("publishes the palette color picked by the seed for \"rand\"", func() {
+						scaffold.pathValues.Set("color", "rand")
+						g.Assert(len(scaffold.api.UpdateShorthand(scaffold.runtime).Errors)).Equal(0)
+						frame := published()
+						g.Assert([]uint32{frame.Red, frame.Green, frame.Blue}).Equal([]uint32{230, 126, 34})
+					})
+
+					g.It("publishes the color components picked by the seed for \"chaos\"", func() {
+						scaffold.pathValues.Set("color", "chaos")
+						g.Assert(len(scaffold.api.UpdateShorthand(scaffold.runtime).Errors)).Equal(0)
+						frame := published()
+						g.Assert([]uint32{frame.Red, frame.Green, frame.Blue}).Equal([]uint32{5, 122, 23})
+						state := scaffold.states.states[""]
+						g.Assert([]uint32{state.Red, state.Green, state.Blue}).Equal([]uint32{5, 122, 23})
+					})
+				})
+
+				g.It("overwrites the recorded state w/ each subsequent command", func() {
+					scaffold.pathValues.Set("color", "red")
+					scaffold.api.UpdateShorthand(scaffold.runtime)
+					scaffold.pathValues.Set("color", "0000ff")
+					scaffold.api.UpdateShorthand(scaffold.runtime)
+					state := scaffold.states.states[""]
+					g.Assert([]uint32{state.Red, state.Green, state.Blue}).Equal([]uint32{0, 0, 255})
+				})
+
+				g.It("does not fail the request if unable to record the state of the device", func() {
+					scaffold.pathValues.Set("color", "red")
+					scaffold.states.setErrors = append(scaffold.states.setErrors, fmt.Errorf("bad-state"))
+					r := scaffold.api.UpdateShorthand(scaffold.runtime)
+					g.Assert(len(r.Errors)).Equal(0)
+					g.Assert(len(scaffold.publisher.published)).Equal(1)
+				})
+
+				g.It("returns a device busy error rather than blocking when the command channel is full", func() {
+					commands := make(chan io.Reader, 1)
+					commands <- bytes.NewBuffer([]byte{})
+					scaffold.runtime.ChannelPublisher = &bg.ChannelStore{
+						Channels: map[string]chan io.Reader{defs.DeviceControlChannelName: commands},
+						Timeout:  time.Millisecond * 10,
+					}
+					scaffold.pathValues.Set("color", "red")
+					r := scaffold.api.UpdateShorthand(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrDeviceBusy)
+					g.Assert(r.Status).Equal(http.StatusServiceUnavailable)
+					g.Assert(len(commands)).Equal(1)
+				})
+
+				g.It("marks the tracked command as failed when unable to publish it", func() {
+					commands := make(chan io.Reader, 1)
+					commands <- bytes.NewBuffer([]byte{})
+					scaffold.runtime.ChannelPublisher = &bg.ChannelStore{
+						Channels: map[string]chan io.Reader{defs.DeviceControlChannelName: commands},
+						Timeout:  time.Millisecond * 10,
+					}
+					scaffold.pathValues.Set("color", "red")
+					scaffold.api.UpdateShorthand(scaffold.runtime)
+					g.Assert(len(scaffold.commands.tracked)).Equal(1)
+
+					for commandID := range scaffold.commands.tracked {
+						g.Assert(scaffold.commands.updates[commandID]).Equal(defs.CommandStatusFailed)
+					}
+				})
+
+				g.It("fails fast w/ a control unavailable error while the control breaker is open", func() {
+					breaker := &bg.CircuitBreaker{
+						ChannelPublisher: &bg.ChannelStore{},
+						Channel:          defs.DeviceControlChannelName,
+						Threshold:        1,
+					}
+					scaffold.runtime.ChannelPublisher = breaker
+					scaffold.pathValues.Set("color", "red")
+					scaffold.api.UpdateShorthand(scaffold.runtime)
+					g.Assert(breaker.State()).Equal(defs.CircuitBreakerOpen)
+					r := scaffold.api.UpdateShorthand(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrControlUnavailable)
+					g.Assert(r.Status).Equal(http.StatusServiceUnavailable)
+				})
+
+				g.It("errors when the hsl color is out of range", func() {
+					scaffold.pathValues.Set("color", "hsl(400,100,50)")
+					r := scaffold.api.UpdateShorthand(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidHSL)
+					g.Assert(r.Fields).Equal(net.FieldErrors{"color": defs.ValidationOutOfRange})
 				})
 
 				g.Describe("with a valid value", func() {
@@ -146,6 +453,10 @@ func Test_DevicesAPI(t *testing.T) {
 						scaffold.pathValues.Set("color", "rand")
 					})
 
+					g.It("succeeds when given \"chaos\"", func() {
+						scaffold.pathValues.Set("color", "chaos")
+					})
+
 					g.It("succeeds when given \"green\"", func() {
 						scaffold.pathValues.Set("color", "green")
 					})
@@ -165,6 +476,618 @@ func Test_DevicesAPI(t *testing.T) {
 					g.It("succeeds when given a valid 6 character hex code", func() {
 						scaffold.pathValues.Set("color", "ffffff")
 					})
+
+					g.It("succeeds when given a valid hsl color", func() {
+						scaffold.pathValues.Set("color", "hsl(0,100,50)")
+					})
+
+					g.It("succeeds when given a valid hsl color in its query form", func() {
+						scaffold.pathValues.Set("color", "hsl:0,100,50")
+					})
+				})
+			})
+		})
+	})
+
+	g.Describe("GetCommandStatus", func() {
+		var scaffold testDevicesAPIScaffolding
+
+		g.BeforeEach(func() {
+			scaffold = prepareDeviceAPIScaffold()
+			scaffold.pathValues.Set("id", "command-id")
+		})
+
+		g.It("returns not found if the command is not tracked", func() {
+			r := scaffold.api.GetCommandStatus(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.Describe("having found the command", func() {
+			status := device.CommandStatus{CommandID: "command-id", DeviceID: "device-id", Status: defs.CommandStatusPending}
+
+			g.BeforeEach(func() {
+				scaffold.commands.statuses = append(scaffold.commands.statuses, status)
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			})
+
+			g.It("returns not found if the token is not authorized to control the device", func() {
+				r := scaffold.api.GetCommandStatus(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+				attempted := scaffold.tokenStore.authorizationAttempts["device-id"]["some-token"]
+				g.Assert(attempted).Equal(uint(defs.SecurityDeviceTokenPermissionController))
+			})
+
+			g.It("returns the status of the command", func() {
+				scaffold.tokenStore.authorized = true
+				r := scaffold.api.GetCommandStatus(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(r.Results).Equal(status)
+			})
+		})
+	})
+
+	g.Describe("GetState", func() {
+		var scaffold testDevicesAPIScaffolding
+
+		g.BeforeEach(func() {
+			scaffold = prepareDeviceAPIScaffold()
+			scaffold.pathValues.Set("uuid", "device-id")
+		})
+
+		g.It("returns not found if unable to find the device", func() {
+			r := scaffold.api.GetState(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.Describe("having found the device", func() {
+			g.BeforeEach(func() {
+				details := device.RegistrationDetails{DeviceID: "device-id"}
+				scaffold.registry.activeRegistrations = append(scaffold.registry.activeRegistrations, details)
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			})
+
+			g.Describe("w/ an authorized token", func() {
+				g.BeforeEach(func() {
+					scaffold.tokenStore.authorized = true
+				})
+
+				g.It("returns the last recorded state of the device", func() {
+					scaffold.states.SetDeviceState("device-id", interchange.ControlFrame{Red: 255, Blue: 10})
+					r := scaffold.api.GetState(scaffold.runtime)
+					g.Assert(len(r.Errors)).Equal(0)
+					state, _ := r.Results.(device.DeviceState)
+					g.Assert([]uint32{state.Red, state.Green, state.Blue}).Equal([]uint32{255, 0, 10})
+					g.Assert(state.ColorName).Equal("red")
+					g.Assert(state.Status).Equal(defs.DeviceStatusOnline)
+				})
+
+				g.It("reports devices that have not been seen within the heartbeat interval as silent", func() {
+					scaffold.api.Activity = &testActivityStore{
+						seen: map[string]time.Time{"device-id": time.Now().Add(-defs.DefaultHeartbeatInterval * 2)},
+					}
+					scaffold.states.SetDeviceState("device-id", interchange.ControlFrame{Red: 255})
+					r := scaffold.api.GetState(scaffold.runtime)
+					state, _ := r.Results.(device.DeviceState)
+					g.Assert(state.Status).Equal(defs.DeviceStatusSilent)
+				})
+
+				g.It("errors if the device has no recorded state", func() {
+					r := scaffold.api.GetState(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrNoDeviceState)
+				})
+
+				g.It("errors if unable to load the state of the device", func() {
+					scaffold.states.getErrors = append(scaffold.states.getErrors, fmt.Errorf("bad-state"))
+					r := scaffold.api.GetState(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+				})
+			})
+		})
+	})
+
+	g.Describe("ListCommandHistory", func() {
+		var scaffold testDevicesAPIScaffolding
+
+		g.BeforeEach(func() {
+			scaffold = prepareDeviceAPIScaffold()
+			scaffold.pathValues.Set("uuid", "device-id")
+		})
+
+		g.It("returns not found if unable to find the device", func() {
+			r := scaffold.api.ListCommandHistory(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.Describe("having found the device", func() {
+			g.BeforeEach(func() {
+				details := device.RegistrationDetails{DeviceID: "device-id"}
+				scaffold.registry.activeRegistrations = append(scaffold.registry.activeRegistrations, details)
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			})
+
+			g.Describe("w/ an authorized admin token", func() {
+				g.BeforeEach(func() {
+					scaffold.tokenStore.authorized = true
+				})
+
+				g.It("returns the command history of the device", func() {
+					scaffold.history.RecordCommand("device-id", device.CommandHistoryEntry{CommandID: "command-1"})
+					scaffold.history.RecordCommand("device-id", device.CommandHistoryEntry{CommandID: "command-2"})
+					r := scaffold.api.ListCommandHistory(scaffold.runtime)
+					entries, _ := r.Results.([]device.CommandHistoryEntry)
+					g.Assert([]string{entries[0].CommandID, entries[1].CommandID}).Equal([]string{"command-2", "command-1"})
+				})
+
+				g.It("uses the default count when none is provided", func() {
+					scaffold.api.ListCommandHistory(scaffold.runtime)
+					g.Assert(scaffold.history.listCounts).Equal([]int{defs.DefaultCommandHistoryCount})
+				})
+
+				g.It("uses the requested count", func() {
+					scaffold.runtime.URL.RawQuery = "count=3"
+					scaffold.api.ListCommandHistory(scaffold.runtime)
+					g.Assert(scaffold.history.listCounts).Equal([]int{3})
+				})
+
+				g.It("errors if unable to load the command history", func() {
+					scaffold.history.errors = append(scaffold.history.errors, fmt.Errorf("bad-history"))
+					r := scaffold.api.ListCommandHistory(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+				})
+
+				g.It("returns an empty history w/o a command history store", func() {
+					scaffold.api.History = nil
+					r := scaffold.api.ListCommandHistory(scaffold.runtime)
+					g.Assert(len(r.Errors)).Equal(0)
+					g.Assert(len(r.Results.([]device.CommandHistoryEntry))).Equal(0)
+				})
+			})
+		})
+	})
+
+	g.Describe("ListConnectionEvents", func() {
+		var scaffold testDevicesAPIScaffolding
+
+		g.BeforeEach(func() {
+			scaffold = prepareDeviceAPIScaffold()
+			scaffold.pathValues.Set("uuid", "device-id")
+		})
+
+		g.It("returns not found if unable to find the device", func() {
+			r := scaffold.api.ListConnectionEvents(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.Describe("having found the device", func() {
+			g.BeforeEach(func() {
+				details := device.RegistrationDetails{DeviceID: "device-id"}
+				scaffold.registry.activeRegistrations = append(scaffold.registry.activeRegistrations, details)
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			})
+
+			g.Describe("w/ an authorized viewer token", func() {
+				g.BeforeEach(func() {
+					scaffold.tokenStore.authorized = true
+				})
+
+				g.It("returns the connection events of the device, newest first", func() {
+					connected := device.ConnectionEvent{Type: defs.ConnectionEventConnected}
+					disconnected := device.ConnectionEvent{Type: defs.ConnectionEventDisconnected}
+					scaffold.connEvents.RecordConnectionEvent("device-id", connected)
+					scaffold.connEvents.RecordConnectionEvent("device-id", disconnected)
+					r := scaffold.api.ListConnectionEvents(scaffold.runtime)
+					events, _ := r.Results.([]device.ConnectionEvent)
+					g.Assert([]string{events[0].Type, events[1].Type}).Equal([]string{
+						defs.ConnectionEventDisconnected,
+						defs.ConnectionEventConnected,
+					})
+				})
+
+				g.It("uses the requested count, falling back to the default", func() {
+					scaffold.api.ListConnectionEvents(scaffold.runtime)
+					scaffold.runtime.URL.RawQuery = "count=3"
+					scaffold.api.ListConnectionEvents(scaffold.runtime)
+					g.Assert(scaffold.connEvents.listCounts).Equal([]int{defs.DefaultConnectionEventCount, 3})
+				})
+
+				g.It("errors if unable to load the connection events", func() {
+					scaffold.connEvents.errors = append(scaffold.connEvents.errors, fmt.Errorf("bad-events"))
+					r := scaffold.api.ListConnectionEvents(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+				})
+
+				g.It("returns an empty list w/o a connection event log", func() {
+					scaffold.api.ConnectionEvents = nil
+					r := scaffold.api.ListConnectionEvents(scaffold.runtime)
+					g.Assert(len(r.Errors)).Equal(0)
+					g.Assert(len(r.Results.([]device.ConnectionEvent))).Equal(0)
+				})
+			})
+		})
+	})
+
+	g.Describe("DeleteDevices", func() {
+		var scaffold testDevicesAPIScaffolding
+
+		remove := func(body string) net.HandlerResult {
+			scaffold.body.Reset()
+			scaffold.body.Write([]byte(body))
+			return scaffold.api.DeleteDevices(scaffold.runtime)
+		}
+
+		g.BeforeEach(func() {
+			scaffold = prepareDeviceAPIScaffold()
+			scaffold.api.AdminToken = "admin-token"
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "admin-token")
+		})
+
+		g.It("returns not found w/o the server admin token", func() {
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			r := remove(`{"device_ids": ["device-1"]}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+			g.Assert(len(scaffold.registry.removed)).Equal(0)
+		})
+
+		g.It("returns not found when no admin token is configured", func() {
+			scaffold.api.AdminToken = ""
+			r := remove(`{"device_ids": ["device-1"]}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.It("rejects requests w/o any device ids", func() {
+			r := remove(`{"device_ids": []}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceRemoval)
+			g.Assert(r.Fields).Equal(net.FieldErrors{"device_ids": defs.ValidationRequired})
+		})
+
+		g.It("rejects requests w/ more device ids than the batch limit", func() {
+			ids := make([]string, defs.DefaultDeviceRemovalBatchLimit+1)
+
+			for i := range ids {
+				ids[i] = fmt.Sprintf("%q", fmt.Sprintf("device-%d", i))
+			}
+
+			r := remove(fmt.Sprintf(`{"device_ids": [%s]}`, strings.Join(ids, ",")))
+			g.Assert(r.Fields).Equal(net.FieldErrors{"device_ids": defs.ValidationTooLong})
+			g.Assert(len(scaffold.registry.removed)).Equal(0)
+		})
+
+		g.It("errors when the registry is unable to remove the batch", func() {
+			scaffold.registry.bulkRemovalErrors = []error{fmt.Errorf("bad-exists")}
+			r := remove(`{"device_ids": ["device-1"]}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+		})
+
+		g.It("returns every device as removed in an all-success batch", func() {
+			r := remove(`{"device_ids": ["device-1", "device-2"]}`)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(scaffold.registry.removed).Equal([]string{"device-1", "device-2"})
+			g.Assert(r.Results).Equal(deviceRemovalResult{
+				Removed: []string{"device-1", "device-2"},
+				Failed:  map[string]string{},
+			})
+		})
+
+		g.It("reports the failed devices of a mixed batch w/o failing the request", func() {
+			scaffold.registry.removalFailures = map[string]error{
+				"device-2": defs.Error(defs.ErrNotFound),
+				"device-3": fmt.Errorf("bad-del"),
+			}
+			r := remove(`{"device_ids": ["device-1", "device-2", "device-3"]}`)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(r.Results).Equal(deviceRemovalResult{
+				Removed: []string{"device-1"},
+				Failed:  map[string]string{"device-2": defs.ErrNotFound, "device-3": defs.ErrServerError},
+			})
+		})
+
+		g.It("reports devices that are locked by another mutation", func() {
+			scaffold.registry.removalFailures = map[string]error{"device-2": defs.Error(defs.ErrDeviceLocked)}
+			r := remove(`{"device_ids": ["device-1", "device-2"]}`)
+			g.Assert(r.Results).Equal(deviceRemovalResult{
+				Removed: []string{"device-1"},
+				Failed:  map[string]string{"device-2": defs.ErrDeviceLocked},
+			})
+		})
+	})
+
+	g.Describe("Patch", func() {
+		var scaffold testDevicesAPIScaffolding
+
+		patch := func(body string) net.HandlerResult {
+			scaffold.body.Reset()
+			scaffold.body.Write([]byte(body))
+			return scaffold.api.Patch(scaffold.runtime)
+		}
+
+		g.BeforeEach(func() {
+			scaffold = prepareDeviceAPIScaffold()
+			scaffold.pathValues.Set("uuid", "device-id")
+			details := device.RegistrationDetails{DeviceID: "device-id", Name: "some-device"}
+			scaffold.registry.activeRegistrations = append(scaffold.registry.activeRegistrations, details)
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			scaffold.tokenStore.authorized = true
+		})
+
+		g.It("rejects a patch w/o any fields", func() {
+			r := patch(`{}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNoPatchFields)
+		})
+
+		g.It("returns not found if the token is not authorized to administer the device", func() {
+			scaffold.tokenStore.authorized = false
+			r := patch(`{"name": "kitchen"}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+			g.Assert(scaffold.tokenStore.authorizationAttempts["device-id"]["some-token"]).Equal(
+				uint(defs.SecurityDeviceTokenPermissionAdmin),
+			)
+		})
+
+		g.It("updates only the name of the device", func() {
+			r := patch(`{"name": "kitchen"}`)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(scaffold.registry.renamed).Equal([]string{"kitchen"})
+			g.Assert(len(scaffold.tags.added)).Equal(0)
+			g.Assert(len(scaffold.registry.meta)).Equal(0)
+			g.Assert(r.Results).Equal(device.RegistrationDetails{DeviceID: "device-id", Name: "kitchen"})
+		})
+
+		g.Describe("w/ a name index", func() {
+			var names *testNameIndex
+
+			g.BeforeEach(func() {
+				names = &testNameIndex{owners: map[string]string{}}
+				scaffold.api.Names = names
+			})
+
+			g.It("rejects a name the index reports is owned by another device", func() {
+				names.owners["Kitchen"] = "other-device"
+				r := patch(`{"name": "Kitchen"}`)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrDuplicateRegistrationName)
+				g.Assert(names.queries).Equal([]string{"Kitchen"})
+				g.Assert(len(scaffold.registry.renamed)).Equal(0)
+			})
+
+			g.It("renames the device when the index reports the name is owned by the device itself", func() {
+				names.owners["Some-Device"] = "device-id"
+				r := patch(`{"name": "Some-Device"}`)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(scaffold.registry.renamed).Equal([]string{"Some-Device"})
+			})
+
+			g.It("renames the device when the name is free", func() {
+				r := patch(`{"name": "kitchen"}`)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(scaffold.registry.renamed).Equal([]string{"kitchen"})
+			})
+
+			g.It("fails w/ a server error when unable to check the index", func() {
+				names.errors = append(names.errors, fmt.Errorf("bad-hget"))
+				r := patch(`{"name": "kitchen"}`)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+				g.Assert(len(scaffold.registry.renamed)).Equal(0)
+			})
+		})
+
+		g.It("updates only the metadata of the device", func() {
+			r := patch(`{"meta": {"location": "kitchen"}}`)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(len(scaffold.registry.renamed)).Equal(0)
+			g.Assert(scaffold.registry.meta).Equal(map[string]string{"location": "kitchen"})
+			g.Assert(r.Results).Equal(device.RegistrationDetails{DeviceID: "device-id", Name: "some-device"})
+		})
+
+		g.It("updates the name, tags and metadata of the device together", func() {
+			r := patch(`{"name": "kitchen", "tags": ["downstairs", "lamps"], "meta": {"floor": "1"}}`)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(scaffold.registry.renamed).Equal([]string{"kitchen"})
+			g.Assert(scaffold.tags.added["device-id"]).Equal([]string{"downstairs", "lamps"})
+			g.Assert(scaffold.registry.meta).Equal(map[string]string{"floor": "1"})
+			g.Assert(r.Results).Equal(device.RegistrationDetails{DeviceID: "device-id", Name: "kitchen"})
+		})
+
+		g.It("rejects invalid fields w/o applying any of them", func() {
+			r := patch(`{"name": "ab", "tags": ["Not A Tag"], "meta": {"floor": "1"}}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDevicePatch)
+			g.Assert(r.Fields).Equal(net.FieldErrors{"name": defs.ValidationTooShort, "tags": defs.ValidationInvalidTag})
+			g.Assert(len(scaffold.registry.renamed)).Equal(0)
+			g.Assert(len(scaffold.registry.meta)).Equal(0)
+		})
+
+		g.It("reverts the name and tags applied if unable to apply the metadata", func() {
+			scaffold.registry.metaErrors = append(scaffold.registry.metaErrors, fmt.Errorf("bad-meta"))
+			r := patch(`{"name": "kitchen", "tags": ["lamps"], "meta": {"floor": "1"}}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			g.Assert(scaffold.registry.renamed).Equal([]string{"kitchen", "some-device"})
+			g.Assert(scaffold.tags.removed).Equal([]string{"lamps"})
+		})
+
+		g.It("only reverts the tags the device did not already have", func() {
+			scaffold.tags.added = map[string][]string{"device-id": []string{"downstairs"}}
+			scaffold.registry.metaErrors = append(scaffold.registry.metaErrors, fmt.Errorf("bad-meta"))
+			r := patch(`{"tags": ["downstairs", "lamps"], "meta": {"floor": "1"}}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			g.Assert(scaffold.tags.removed).Equal([]string{"lamps"})
+		})
+
+		g.It("fails w/ a logic error while the device is locked by another mutation", func() {
+			scaffold.registry.renameErrors = append(scaffold.registry.renameErrors, defs.Error(defs.ErrDeviceLocked))
+			r := patch(`{"name": "kitchen"}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrDeviceLocked)
+		})
+
+		g.Describe("w/ a device locker", func() {
+			var locks *testDeviceLocker
+
+			g.BeforeEach(func() {
+				locks = &testDeviceLocker{mutator: scaffold.registry}
+				scaffold.api.Locks = locks
+			})
+
+			g.It("applies the name and metadata while holding the lock of the device once", func() {
+				r := patch(`{"name": "kitchen", "meta": {"floor": "1"}}`)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(locks.locked).Equal([]string{"device-id"})
+				g.Assert(scaffold.registry.renamed).Equal([]string{"kitchen"})
+				g.Assert(scaffold.registry.meta).Equal(map[string]string{"floor": "1"})
+				g.Assert(r.Results).Equal(device.RegistrationDetails{DeviceID: "device-id", Name: "kitchen"})
+			})
+
+			g.It("reverts the name under the same lock if unable to apply the metadata", func() {
+				scaffold.registry.metaErrors = append(scaffold.registry.metaErrors, fmt.Errorf("bad-meta"))
+				r := patch(`{"name": "kitchen", "meta": {"floor": "1"}}`)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+				g.Assert(locks.locked).Equal([]string{"device-id"})
+				g.Assert(scaffold.registry.renamed).Equal([]string{"kitchen", "some-device"})
+			})
+
+			g.It("fails w/ a logic error w/o applying anything while the device is locked", func() {
+				locks.errors = append(locks.errors, defs.Error(defs.ErrDeviceLocked))
+				r := patch(`{"name": "kitchen"}`)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrDeviceLocked)
+				g.Assert(len(scaffold.registry.renamed)).Equal(0)
+			})
+		})
+
+		g.It("fails w/ a server error when tagging w/o a tag store", func() {
+			scaffold.api.Tags = nil
+			r := patch(`{"tags": ["lamps"]}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+		})
+	})
+
+	g.Describe("GetDevice", func() {
+		var scaffold testDevicesAPIScaffolding
+
+		g.BeforeEach(func() {
+			scaffold = prepareDeviceAPIScaffold()
+			scaffold.pathValues.Set("uuid", "device-id")
+		})
+
+		g.It("returns not found if unable to find the device", func() {
+			r := scaffold.api.GetDevice(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.Describe("having found the device", func() {
+			g.BeforeEach(func() {
+				details := device.RegistrationDetails{DeviceID: "device-id", Name: "some-device"}
+				scaffold.registry.activeRegistrations = append(scaffold.registry.activeRegistrations, details)
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			})
+
+			g.Describe("w/ an authorized token", func() {
+				g.BeforeEach(func() {
+					scaffold.tokenStore.authorized = true
+				})
+
+				g.It("includes the last recorded state of the device", func() {
+					scaffold.states.SetDeviceState("device-id", interchange.ControlFrame{Green: 255})
+					r := scaffold.api.GetDevice(scaffold.runtime)
+					details, _ := r.Results.(deviceDetails)
+					g.Assert(details.Name).Equal("some-device")
+					g.Assert(details.State.Green).Equal(uint32(255))
+					g.Assert(details.State.ColorName).Equal("green")
+				})
+
+				g.It("includes the metadata of the device", func() {
+					scaffold.registry.SetDeviceMeta("device-id", map[string]string{"location": "kitchen"})
+					r := scaffold.api.GetDevice(scaffold.runtime)
+					details, _ := r.Results.(deviceDetails)
+					g.Assert(details.Meta).Equal(map[string]string{"location": "kitchen"})
+				})
+
+				g.It("errors if unable to load the metadata of the device", func() {
+					scaffold.registry.metaErrors = append(scaffold.registry.metaErrors, fmt.Errorf("bad-meta"))
+					r := scaffold.api.GetDevice(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+				})
+
+				g.It("includes the firmware version reported by the device", func() {
+					scaffold.firmware.versions = map[string]string{"device-id": "1.2.0"}
+					r := scaffold.api.GetDevice(scaffold.runtime)
+					details, _ := r.Results.(deviceDetails)
+					g.Assert(details.Firmware).Equal("1.2.0")
+				})
+
+				g.Describe("w/ a device pool and activity store", func() {
+					var pool *testDevicePool
+					var activity *testActivityStore
+
+					g.BeforeEach(func() {
+						pool = &testDevicePool{connected: map[string]bool{"device-id": true}}
+						activity = &testActivityStore{}
+						scaffold.api.Pool, scaffold.api.Activity = pool, activity
+						scaffold.api.HeartbeatInterval = time.Minute
+					})
+
+					g.It("reports a recently active device as online", func() {
+						activity.TouchDevice("device-id")
+						r := scaffold.api.GetDevice(scaffold.runtime)
+						details, _ := r.Results.(deviceDetails)
+						g.Assert(details.Status).Equal(defs.DeviceStatusOnline)
+					})
+
+					g.It("reports a device w/ a stale last seen time as silent while its connection lingers", func() {
+						activity.seen = map[string]time.Time{"device-id": time.Now().Add(-time.Minute * 2)}
+						r := scaffold.api.GetDevice(scaffold.runtime)
+						details, _ := r.Results.(deviceDetails)
+						g.Assert(details.Status).Equal(defs.DeviceStatusSilent)
+					})
+
+					g.It("reports a device w/o a connection in the pool as disconnected", func() {
+						activity.TouchDevice("device-id")
+						pool.connected = nil
+						r := scaffold.api.GetDevice(scaffold.runtime)
+						details, _ := r.Results.(deviceDetails)
+						g.Assert(details.Status).Equal(defs.DeviceStatusDisconnected)
+					})
+
+					g.It("reports devices that have never been seen as online", func() {
+						r := scaffold.api.GetDevice(scaffold.runtime)
+						details, _ := r.Results.(deviceDetails)
+						g.Assert(details.Status).Equal(defs.DeviceStatusOnline)
+					})
+
+					g.It("reports the device as online if unable to load its last seen time", func() {
+						activity.errors = append(activity.errors, fmt.Errorf("bad-last-seen"))
+						r := scaffold.api.GetDevice(scaffold.runtime)
+						details, _ := r.Results.(deviceDetails)
+						g.Assert(len(r.Errors)).Equal(0)
+						g.Assert(details.Status).Equal(defs.DeviceStatusOnline)
+					})
+				})
+
+				g.It("reports the unknown firmware version for devices that have not reported one", func() {
+					r := scaffold.api.GetDevice(scaffold.runtime)
+					details, _ := r.Results.(deviceDetails)
+					g.Assert(details.Firmware).Equal(defs.DefaultFirmwareVersion)
+				})
+
+				g.It("reports the unknown firmware version w/o a firmware store", func() {
+					scaffold.api.Firmware = nil
+					r := scaffold.api.GetDevice(scaffold.runtime)
+					details, _ := r.Results.(deviceDetails)
+					g.Assert(details.Firmware).Equal(defs.DefaultFirmwareVersion)
+				})
+
+				g.It("errors if unable to load the firmware version of the device", func() {
+					scaffold.firmware.errors = append(scaffold.firmware.errors, fmt.Errorf("bad-firmware"))
+					r := scaffold.api.GetDevice(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+				})
+
+				g.It("omits the state of devices that have not been sent a command", func() {
+					r := scaffold.api.GetDevice(scaffold.runtime)
+					details, _ := r.Results.(deviceDetails)
+					g.Assert(details.DeviceID).Equal("device-id")
+					g.Assert(details.State == nil).Equal(true)
+				})
+
+				g.It("does not fail if unable to load the state of the device", func() {
+					scaffold.states.getErrors = append(scaffold.states.getErrors, fmt.Errorf("bad-state"))
+					r := scaffold.api.GetDevice(scaffold.runtime)
+					g.Assert(len(r.Errors)).Equal(0)
 				})
 			})
 		})
@@ -1,7 +1,9 @@
 package routes
 
+import "time"
+import "strings"
 import "strconv"
-import "io/ioutil"
+import "encoding/json"
 import "github.com/golang/protobuf/proto"
 
 import "github.com/dadleyy/beacon.api/beacon/net"
@@ -11,13 +13,20 @@ import "github.com/dadleyy/beacon.api/beacon/logging"
 import "github.com/dadleyy/beacon.api/beacon/interchange"
 
 // NewFeedbackAPI returns a new initialized feed back api
-func NewFeedbackAPI(store device.FeedbackStore, index device.Index) *Feedback {
+func NewFeedbackAPI(
+	store device.FeedbackStore,
+	index device.Index,
+	tokens device.TokenStore,
+	stream device.FeedbackStream,
+) *Feedback {
 	logger := logging.New(defs.FeedbackAPILogPrefix, logging.Green)
 
 	return &Feedback{
-		LeveledLogger: logger,
-		FeedbackStore: store,
-		Index:         index,
+		LeveledLogger:  logger,
+		FeedbackStore:  store,
+		Index:          index,
+		TokenStore:     tokens,
+		FeedbackStream: stream,
 	}
 }
 
@@ -26,31 +35,66 @@ type Feedback struct {
 	logging.LeveledLogger
 	device.FeedbackStore
 	device.Index
+	device.TokenStore
+	device.FeedbackStream
+
+	// ListCount is the amount of feedback entries listed when a request does not provide a (positive) count, falling back
+	// to the default when not positive.
+	ListCount int
+
+	// MaxListCount is the most feedback entries a single list request can return; larger counts are clamped to it. Falls
+	// back to the default maximum when not positive.
+	MaxListCount int
 }
 
 type reportEntry struct {
-	Red   uint32 `json:"red"`
-	Green uint32 `json:"green"`
-	Blue  uint32 `json:"blue"`
+	Red       uint32    `json:"red"`
+	Green     uint32    `json:"green"`
+	Blue      uint32    `json:"blue"`
+	Timestamp time.Time `json:"ts"`
 }
 
-// ListFeedback validates a payload from the client and adds an entry to the device feedback log.
+// ListFeedback returns the latest entries from the device feedback log, requiring a token w/ the viewer permission.
+// Unfiltered feedback is paged through using the cursor returned in the metadata of each page that has more entries,
+// along w/ the effective (defaulted or clamped) count of the page. Clients that prefer protobuf (through the accept
+// header) are sent the raw feedback messages of the page as a `FeedbackList`, which holds the cursor instead.
 func (feedback *Feedback) ListFeedback(runtime *net.RequestRuntime) net.HandlerResult {
-	count, e := strconv.Atoi(runtime.GetQueryParam("count"))
+	count := feedback.listCount(runtime)
+	level := runtime.GetQueryParam("level")
+	minimum, filtered := interchange.FeedbackLevel_value["LEVEL_"+strings.ToUpper(level)]
 
-	if e != nil || count >= 1 != true || count >= 100 {
-		count = 1
-		feedback.Debugf("defaulting feedback count to 1")
+	if level != "" && filtered != true {
+		return runtime.LogicError(defs.ErrInvalidFeedbackLevel)
 	}
 
 	deviceID := runtime.GetQueryParam("device_id")
 
-	if _, e := feedback.FindDevice(deviceID); e != nil {
-		feedback.Warnf("invalid device id: %s", deviceID)
+	details, e := feedback.FindDevice(deviceID)
+
+	if e != nil {
+		feedback.Warnf("unable to find device[%s]: %s", deviceID, e.Error())
+		return runtime.LookupError(e)
+	}
+
+	token := runtime.HeaderValue(defs.APIUserTokenHeader)
+
+	if token == "" || feedback.authorizeViewer(details.DeviceID, token) != true {
+		feedback.Warnf("unauthorized attempt to list feedback (token: %s, device: %s)", token, details.DeviceID)
 		return runtime.LogicError(defs.ErrNotFound)
 	}
 
-	entries, e := feedback.FeedbackStore.ListFeedback(deviceID, count-1)
+	var entries []interchange.FeedbackMessage
+	cursor, next := runtime.GetQueryParam("cursor"), ""
+
+	if filtered {
+		entries, e = feedback.ListFeedbackByLevel(details.DeviceID, count, interchange.FeedbackLevel(minimum))
+	} else {
+		entries, next, e = feedback.ListFeedbackPage(details.DeviceID, cursor, count)
+	}
+
+	if e == defs.Error(defs.ErrInvalidFeedbackCursor) {
+		return runtime.ValidationError(defs.ErrInvalidFeedbackCursor, net.FieldErrors{"cursor": defs.ValidationInvalidCursor})
+	}
 
 	if e != nil {
 		feedback.Warnf("unable to load device feedback: %s", e.Error())
@@ -59,37 +103,221 @@ func (feedback *Feedback) ListFeedback(runtime *net.RequestRuntime) net.HandlerR
 
 	feedback.Debugf("found %d entries for device %s", len(entries), runtime.GetQueryParam("device_id"))
 
-	results := make([]interface{}, 0, len(entries))
+	results, e := feedback.entries(entries)
 
-	for _, top := range entries {
-		payload := top.GetPayload()
+	if e != nil {
+		feedback.Errorf("unable to unmarshal latest feedback payload: %s", e.Error())
+		return runtime.LogicError(defs.ErrBadInterchangeData)
+	}
 
-		if payload == nil || len(payload) == 0 {
-			results = append(results, nil)
+	metadata := net.Metadata{"count": count}
+
+	if next != "" {
+		metadata["cursor"] = next
+	}
+
+	return net.HandlerResult{
+		Results:  results,
+		Metadata: metadata,
+		Signed:   true,
+		Protobuf: feedbackList(entries, next),
+	}
+}
+
+// List returns the latest feedback entries of the device in the path, newest first, requiring a token w/ the viewer
+// permission. The `count` query param limits the amount of entries returned, clamped the same as ListFeedback, which
+// it also mirrors in sending protobuf rendered entries to the clients that prefer them.
+func (feedback *Feedback) List(runtime *net.RequestRuntime) net.HandlerResult {
+	count := feedback.listCount(runtime)
+	query := runtime.Get("uuid")
+	details, e := feedback.FindDevice(query)
+
+	if e != nil {
+		feedback.Warnf("feedback list w/ invalid device id: %s (%s)", query, e.Error())
+		return runtime.LookupError(e)
+	}
+
+	token := runtime.HeaderValue(defs.APIUserTokenHeader)
+
+	if token == "" || feedback.authorizeViewer(details.DeviceID, token) != true {
+		feedback.Warnf("unauthorized attempt to list feedback (token: %s, device: %s)", token, details.DeviceID)
+		return runtime.LogicError(defs.ErrInvalidToken)
+	}
+
+	// The store treats the count as the index of the last entry, returning count+1 entries w/o adjusting it.
+	messages, e := feedback.FeedbackStore.ListFeedback(details.DeviceID, count-1)
+
+	if e != nil {
+		feedback.Errorf("unable to list feedback of device %s: %s", details.DeviceID, e.Error())
+		return runtime.ServerError()
+	}
+
+	results, e := feedback.entries(messages)
+
+	if e != nil {
+		feedback.Errorf("unable to unmarshal feedback payload: %s", e.Error())
+		return runtime.LogicError(defs.ErrBadInterchangeData)
+	}
+
+	return net.HandlerResult{
+		Results:  results,
+		Metadata: net.Metadata{"count": count},
+		Signed:   true,
+		Protobuf: feedbackList(messages, ""),
+	}
+}
+
+// listCount returns the `count` query param clamped to the maximum list count, or the list count when the param is
+// missing or not positive.
+func (feedback *Feedback) listCount(runtime *net.RequestRuntime) int {
+	count, e := strconv.Atoi(runtime.GetQueryParam("count"))
+
+	if e != nil {
+		count = 0
+	}
+
+	return device.FeedbackListCount(count, feedback.ListCount, feedback.MaxListCount)
+}
+
+// QueryFeedback returns a page of the device feedback log, newest first, filtered by the optional level, since and
+// until (RFC3339) query params and paged w/ the offset and limit params. Requires a token w/ the viewer permission.
+func (feedback *Feedback) QueryFeedback(runtime *net.RequestRuntime) net.HandlerResult {
+	query, fields := device.FeedbackQuery{Limit: defs.DefaultFeedbackQueryLimit}, make(net.FieldErrors)
+
+	if level := runtime.GetQueryParam("level"); level != "" {
+		minimum, ok := interchange.FeedbackLevel_value["LEVEL_"+strings.ToUpper(level)]
+
+		if ok != true {
+			return runtime.ValidationError(defs.ErrInvalidFeedbackLevel, net.FieldErrors{"level": defs.ValidationUnknownLevel})
+		}
+
+		query.Level = interchange.FeedbackLevel(minimum)
+	}
+
+	for name, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		value := runtime.GetQueryParam(name)
+
+		if value == "" {
 			continue
 		}
 
-		switch top.Type {
-		case interchange.FeedbackMessageType_ERROR:
-			results = append(results, nil)
-		case interchange.FeedbackMessageType_REPORT:
-			report := interchange.ReportMessage{}
+		parsed, e := time.Parse(time.RFC3339, value)
 
-			if e := proto.Unmarshal(payload, &report); e != nil {
-				feedback.Errorf("unable to unmarshal latest feedback payload: %s", e.Error())
-				return runtime.LogicError(defs.ErrBadInterchangeData)
-			}
+		if e != nil {
+			fields[name] = defs.ValidationInvalidTime
+			continue
+		}
+
+		*target = parsed
+	}
+
+	for name, target := range map[string]*int{"offset": &query.Offset, "limit": &query.Limit} {
+		value := runtime.GetQueryParam(name)
+
+		if value == "" {
+			continue
+		}
+
+		parsed, e := strconv.Atoi(value)
+
+		if e != nil || parsed < 0 || parsed > defs.RedisMaxFeedbackEntries {
+			fields[name] = defs.ValidationOutOfRange
+			continue
+		}
+
+		*target = parsed
+	}
+
+	if len(fields) >= 1 {
+		feedback.Warnf("invalid feedback query: %v", fields)
+		return runtime.ValidationError(defs.ErrBadRequestFormat, fields)
+	}
+
+	if query.Since.IsZero() == false && query.Until.IsZero() == false && query.Since.After(query.Until) {
+		return runtime.ValidationError(defs.ErrInvalidFeedbackRange, net.FieldErrors{"since": defs.ValidationOutOfRange})
+	}
+
+	details, e := feedback.FindDevice(runtime.GetQueryParam("device_id"))
+
+	if e != nil {
+		feedback.Warnf("unable to find device[%s]: %s", runtime.GetQueryParam("device_id"), e.Error())
+		return runtime.LookupError(e)
+	}
+
+	token := runtime.HeaderValue(defs.APIUserTokenHeader)
+
+	if token == "" || feedback.authorizeViewer(details.DeviceID, token) != true {
+		feedback.Warnf("unauthorized attempt to query feedback (token: %s, device: %s)", token, details.DeviceID)
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	entries, e := feedback.FeedbackStore.QueryFeedback(details.DeviceID, query)
+
+	if e != nil {
+		feedback.Warnf("unable to query device feedback: %s", e.Error())
+		return runtime.ServerError()
+	}
+
+	results, e := feedback.entries(entries)
+
+	if e != nil {
+		feedback.Errorf("unable to unmarshal queried feedback payload: %s", e.Error())
+		return runtime.LogicError(defs.ErrBadInterchangeData)
+	}
+
+	meta := net.Metadata{"offset": query.Offset, "limit": query.Limit, "count": len(results)}
+	return net.HandlerResult{Results: results, Metadata: meta}
+}
 
-			results = append(results, reportEntry{report.Red, report.Green, report.Blue})
+// FeedbackStats returns the amount of feedback entries per level logged by a device within a window (e.g. "30m"),
+// requiring a token w/ the device's admin permission.
+func (feedback *Feedback) FeedbackStats(runtime *net.RequestRuntime) net.HandlerResult {
+	window := defs.DefaultFeedbackStatsWindow
+
+	if value := runtime.GetQueryParam("window"); value != "" {
+		parsed, e := time.ParseDuration(value)
+
+		if e != nil || parsed <= 0 {
+			feedback.Warnf("invalid feedback stats window: %s", value)
+			return runtime.LogicError(defs.ErrInvalidFeedbackWindow)
 		}
+
+		window = parsed
+	}
+
+	details, e := feedback.FindDevice(runtime.GetQueryParam("device_id"))
+
+	if e != nil {
+		feedback.Warnf("unable to find device[%s]: %s", runtime.GetQueryParam("device_id"), e.Error())
+		return runtime.LookupError(e)
+	}
+
+	token := runtime.HeaderValue(defs.APIUserTokenHeader)
+
+	if token == "" || feedback.AuthorizeToken(details.DeviceID, token, defs.SecurityDeviceTokenPermissionAdmin) != true {
+		feedback.Warnf("unauthorized attempt to read feedback stats (token: %s, device: %s)", token, details.DeviceID)
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	stats, e := feedback.FeedbackStore.FeedbackStats(details.DeviceID, window)
+
+	if e != nil {
+		feedback.Errorf("unable to load feedback stats: %s", e.Error())
+		return runtime.ServerError()
 	}
 
-	return net.HandlerResult{Results: results}
+	return net.HandlerResult{Results: stats, Metadata: net.Metadata{"window": window.String()}}
 }
 
-// CreateFeedback validates a payload from the client and adds an entry to the device feedback log.
+// CreateFeedback validates a payload from the client and adds an entry to the device feedback log. The message digest
+// must be the hash of the payload, encrypted by the device using the shared secret it was sent when welcomed.
 func (feedback *Feedback) CreateFeedback(runtime *net.RequestRuntime) net.HandlerResult {
-	buf, e := ioutil.ReadAll(runtime.Body)
+	buf, e := runtime.ReadAll()
+
+	if e == defs.Error(defs.ErrRequestTooLarge) {
+		feedback.Warnf("feedback request body too large")
+		return runtime.LogicError(defs.ErrRequestTooLarge)
+	}
 
 	if e != nil {
 		feedback.Errorf("invalid data received in feedback api: %s", e.Error())
@@ -115,8 +343,16 @@ func (feedback *Feedback) CreateFeedback(runtime *net.RequestRuntime) net.Handle
 		return runtime.LogicError(defs.ErrBadInterchangeData)
 	}
 
-	if _, e := feedback.FindDevice(auth.GetDeviceID()); e != nil {
-		return runtime.LogicError(defs.ErrNotFound)
+	details, e := feedback.FindDevice(auth.GetDeviceID())
+
+	if e != nil {
+		return runtime.LookupError(e)
+	}
+
+	// The digest is checked against the key the device registered w/; the key sent to devices is shared by all of them.
+	if e := device.VerifyFeedback(details, message); e != nil {
+		feedback.Warnf("unable to verify feedback from device[%s]: %s", auth.GetDeviceID(), e.Error())
+		return runtime.LogicError(defs.ErrBadInterchangeAuthentication)
 	}
 
 	if e := feedback.LogFeedback(message); e != nil {
@@ -124,6 +360,197 @@ func (feedback *Feedback) CreateFeedback(runtime *net.RequestRuntime) net.Handle
 		return runtime.ServerError()
 	}
 
+	feedback.Publish(message)
 	feedback.Infof("successfully posted feedback from device[%s]", auth.DeviceID)
 	return net.HandlerResult{}
 }
+
+type feedbackBatchResult struct {
+	Logged int               `json:"logged"`
+	Failed map[string]string `json:"failed"`
+}
+
+// CreateFeedbackBatch logs each of the feedback messages in the request body, verifying every message against the key
+// of its device. Messages that could not be logged are reported by their index w/o failing the rest of the batch.
+func (feedback *Feedback) CreateFeedbackBatch(runtime *net.RequestRuntime) net.HandlerResult {
+	buf, e := runtime.ReadAll()
+
+	if e == defs.Error(defs.ErrRequestTooLarge) {
+		feedback.Warnf("feedback batch body too large")
+		return runtime.LogicError(defs.ErrRequestTooLarge)
+	}
+
+	if e != nil {
+		feedback.Errorf("invalid data received in feedback batch api: %s", e.Error())
+		return runtime.LogicError("invalid-request")
+	}
+
+	if runtime.ContentType() != defs.APIFeedbackContentTypeHeader {
+		feedback.Warnf("invalid content type for feedback batch: %s", runtime.ContentType())
+		return runtime.LogicError(defs.ErrInvalidContentType)
+	}
+
+	batch := interchange.FeedbackList{}
+
+	if e := proto.Unmarshal(buf, &batch); e != nil {
+		feedback.Errorf("invalid data received in feedback batch api: %s", e.Error())
+		return runtime.LogicError(defs.ErrBadInterchangeData)
+	}
+
+	messages := make([]interchange.FeedbackMessage, 0, len(batch.Messages))
+
+	for _, message := range batch.Messages {
+		if message == nil {
+			return runtime.LogicError(defs.ErrBadInterchangeData)
+		}
+
+		messages = append(messages, *message)
+	}
+
+	if len(messages) == 0 {
+		return runtime.ValidationError(defs.ErrInvalidFeedbackBatch, net.FieldErrors{"messages": defs.ValidationRequired})
+	}
+
+	if len(messages) > defs.DefaultFeedbackBatchLimit {
+		return runtime.ValidationError(defs.ErrInvalidFeedbackBatch, net.FieldErrors{"messages": defs.ValidationTooLong})
+	}
+
+	failures := make(device.FeedbackBatchError)
+
+	if e := feedback.LogFeedbackBatch(messages); e != nil {
+		batchError, ok := e.(device.FeedbackBatchError)
+
+		if ok != true {
+			feedback.Errorf("unable to log device feedback batch: %s", e.Error())
+			return runtime.ServerError()
+		}
+
+		failures = batchError
+	}
+
+	result := feedbackBatchResult{Failed: make(map[string]string)}
+
+	for i, message := range messages {
+		e, failed := failures[i]
+
+		if failed != true {
+			feedback.Publish(message)
+			result.Logged++
+			continue
+		}
+
+		if e == defs.Error(defs.ErrNotFound) || e == defs.Error(defs.ErrBadInterchangeAuthentication) {
+			result.Failed[strconv.Itoa(i)] = e.Error()
+			continue
+		}
+
+		feedback.Errorf("unable to log feedback message[%d] of batch: %s", i, e.Error())
+		result.Failed[strconv.Itoa(i)] = defs.ErrServerError
+	}
+
+	feedback.Infof("logged %d of %d feedback messages in batch", result.Logged, len(messages))
+	return net.HandlerResult{Results: result}
+}
+
+// StreamFeedback sends feedback messages for a device along to the client as server-sent events as they are received.
+func (feedback *Feedback) StreamFeedback(runtime *net.RequestRuntime) net.HandlerResult {
+	details, e := feedback.FindDevice(runtime.GetQueryParam("device_id"))
+
+	if e != nil {
+		feedback.Warnf("unable to find device[%s]: %s", runtime.GetQueryParam("device_id"), e.Error())
+		return runtime.LookupError(e)
+	}
+
+	token := runtime.HeaderValue(defs.APIUserTokenHeader)
+
+	if token == "" || feedback.authorizeViewer(details.DeviceID, token) != true {
+		feedback.Warnf("unauthorized attempt to stream feedback (token: %s, device: %s)", token, details.DeviceID)
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	subscription := feedback.Subscribe(details.DeviceID)
+	defer feedback.Unsubscribe(subscription)
+
+	stream, e := runtime.EventStream()
+
+	if e != nil {
+		feedback.Errorf("unable to open event stream: %s", e.Error())
+		return runtime.ServerError()
+	}
+
+	feedback.Infof("streaming feedback for device[%s]", details.DeviceID)
+
+	for {
+		select {
+		case message, ok := <-subscription:
+			if ok != true {
+				return net.HandlerResult{NoRender: true}
+			}
+
+			data, e := json.Marshal(message)
+
+			if e != nil {
+				feedback.Warnf("unable to serialize feedback message: %s", e.Error())
+				continue
+			}
+
+			if e := stream.Send(defs.APIFeedbackStreamEventName, data); e != nil {
+				feedback.Warnf("unable to send feedback to client: %s", e.Error())
+				return net.HandlerResult{NoRender: true}
+			}
+		case <-runtime.Context().Done():
+			feedback.Infof("client stopped streaming feedback for device[%s]", details.DeviceID)
+			return net.HandlerResult{NoRender: true}
+		}
+	}
+}
+
+// entries converts feedback messages into their api representation; reports are sent as colors and any other entry is
+// sent as null so that the position of each entry is preserved.
+func (feedback *Feedback) entries(messages []interchange.FeedbackMessage) ([]interface{}, error) {
+	results := make([]interface{}, 0, len(messages))
+
+	for _, top := range messages {
+		payload := top.GetPayload()
+
+		if payload == nil || len(payload) == 0 {
+			results = append(results, nil)
+			continue
+		}
+
+		switch top.Type {
+		case interchange.FeedbackMessageType_ERROR:
+			results = append(results, nil)
+		case interchange.FeedbackMessageType_REPORT:
+			report := interchange.ReportMessage{}
+
+			if e := proto.Unmarshal(payload, &report); e != nil {
+				return nil, e
+			}
+
+			results = append(results, reportEntry{report.Red, report.Green, report.Blue, device.FeedbackTime(top)})
+		}
+	}
+
+	return results, nil
+}
+
+// feedbackList returns the raw feedback messages (along w/ the cursor of the next page, if any) as they are sent to
+// clients that prefer protobuf responses.
+func feedbackList(messages []interchange.FeedbackMessage, cursor string) *interchange.FeedbackList {
+	list := interchange.FeedbackList{Messages: make([]*interchange.FeedbackMessage, 0, len(messages)), Cursor: cursor}
+
+	for i := range messages {
+		list.Messages = append(list.Messages, &messages[i])
+	}
+
+	return &list
+}
+
+func (feedback *Feedback) authorizeViewer(deviceID string, token string) bool {
+	if feedback.AuthorizeToken(deviceID, token, defs.SecurityDeviceTokenPermissionViewer) {
+		return true
+	}
+
+	return feedback.AuthorizeToken(deviceID, token, defs.SecurityDeviceTokenPermissionAdmin)
+}
@@ -1,8 +1,20 @@
 package routes
 
 import "fmt"
+import "time"
 import "bytes"
+import "bufio"
+import "crypto"
 import "testing"
+import "strings"
+import "net/http"
+import "io/ioutil"
+import "crypto/rsa"
+import "crypto/rand"
+import "crypto/x509"
+import "crypto/sha256"
+import "encoding/hex"
+import "encoding/json"
 import "net/http/httptest"
 import "github.com/franela/goblin"
 import "github.com/golang/protobuf/proto"
@@ -15,6 +27,8 @@ import "github.com/dadleyy/beacon.api/beacon/interchange"
 type testFeedbackAPIScaffolding struct {
 	index   *testDeviceIndex
 	store   *testFeedbackStore
+	tokens  *testDeviceTokenStore
+	stream  *testFeedbackStream
 	api     *Feedback
 	runtime *net.RequestRuntime
 	body    *bytes.Buffer
@@ -23,11 +37,15 @@ type testFeedbackAPIScaffolding struct {
 func prepareFeedbackAPIScaffold() testFeedbackAPIScaffolding {
 	store := testFeedbackStore{}
 	index := testDeviceIndex{}
+	tokens := testDeviceTokenStore{}
+	stream := testFeedbackStream{}
 
 	api := Feedback{
-		LeveledLogger: newTestRouteLogger(),
-		FeedbackStore: &store,
-		Index:         &index,
+		LeveledLogger:  newTestRouteLogger(),
+		FeedbackStore:  &store,
+		Index:          &index,
+		TokenStore:     &tokens,
+		FeedbackStream: &stream,
 	}
 
 	body := bytes.NewBuffer([]byte{})
@@ -39,6 +57,8 @@ func prepareFeedbackAPIScaffold() testFeedbackAPIScaffolding {
 	return testFeedbackAPIScaffolding{
 		index:   &index,
 		store:   &store,
+		tokens:  &tokens,
+		stream:  &stream,
 		api:     &api,
 		runtime: &runtime,
 		body:    body,
@@ -55,15 +75,43 @@ func Test_FeedbackAPI(t *testing.T) {
 			scaffold = prepareFeedbackAPIScaffold()
 		})
 
-		g.It("returns an error if unable to find the device", func() {
+		g.It("returns not found if the device does not exist", func() {
+			scaffold.index.findErrors = append(scaffold.index.findErrors, defs.Error(defs.ErrNotFound))
+			r := scaffold.api.ListFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.It("returns a server error if unable to look up the device", func() {
 			scaffold.index.findErrors = append(scaffold.index.findErrors, fmt.Errorf("bad-find"))
 			r := scaffold.api.ListFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+		})
+
+		g.It("returns not found if the token is not authorized to view the device", func() {
+			scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			r := scaffold.api.ListFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+			g.Assert(len(scaffold.store.listCalls)).Equal(0)
+		})
+
+		g.It("returns not found without a token", func() {
+			scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
+			scaffold.tokens.authorized = true
+			r := scaffold.api.ListFeedback(scaffold.runtime)
 			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
 		})
 
-		g.Describe("having found the device", func() {
+		g.Describe("having found the device w/ an authorized viewer token", func() {
 			g.BeforeEach(func() {
 				scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
+				scaffold.tokens.authorized = true
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			})
+
+			g.It("marks the result to be signed", func() {
+				r := scaffold.api.ListFeedback(scaffold.runtime)
+				g.Assert(r.Signed).Equal(true)
 			})
 
 			g.It("fails if unable to list the feedback from the store", func() {
@@ -123,6 +171,418 @@ func Test_FeedbackAPI(t *testing.T) {
 				g.Assert(first.Red).Equal(uint(100))
 				g.Assert(first.Green).Equal(uint(200))
 				g.Assert(first.Blue).Equal(uint(300))
+				g.Assert(first.Timestamp.IsZero()).Equal(true)
+			})
+
+			g.It("includes the time the report was received", func() {
+				payload, _ := proto.Marshal(&interchange.ReportMessage{Red: 10})
+
+				scaffold.store.listResults = append(scaffold.store.listResults, interchange.FeedbackMessage{
+					Type:      interchange.FeedbackMessageType_REPORT,
+					Payload:   payload,
+					Timestamp: 1500000000,
+				})
+
+				r := scaffold.api.ListFeedback(scaffold.runtime)
+				list, _ := r.Results.([]interface{})
+				first, _ := list[0].(reportEntry)
+				g.Assert(first.Timestamp.Equal(time.Unix(1500000000, 0))).Equal(true)
+			})
+
+			g.It("returns an error w/ an unknown minimum level", func() {
+				scaffold.runtime.URL.RawQuery = "level=critical"
+				r := scaffold.api.ListFeedback(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidFeedbackLevel)
+				g.Assert(len(scaffold.store.listCalls)).Equal(0)
+			})
+
+			g.It("filters the feedback by the requested minimum level", func() {
+				scaffold.runtime.URL.RawQuery = "level=warn&count=5"
+				r := scaffold.api.ListFeedback(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(scaffold.store.levelCalls).Equal([]interchange.FeedbackLevel{interchange.FeedbackLevel_LEVEL_WARN})
+				g.Assert(scaffold.store.listCalls[0].feedbackCount).Equal(5)
+			})
+
+			g.It("pages through the feedback from the provided cursor", func() {
+				scaffold.runtime.URL.RawQuery = "cursor=1500000000000-0&count=5"
+				scaffold.store.nextCursor = "1400000000000-0"
+				r := scaffold.api.ListFeedback(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(scaffold.store.cursors).Equal([]string{"1500000000000-0"})
+				g.Assert(scaffold.store.listCalls[0].feedbackCount).Equal(5)
+				g.Assert(r.Metadata["cursor"]).Equal("1400000000000-0")
+			})
+
+			g.It("omits the cursor from the metadata once every entry has been returned", func() {
+				r := scaffold.api.ListFeedback(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				_, paged := r.Metadata["cursor"]
+				g.Assert(paged).Equal(false)
+			})
+
+			g.It("passes a valid count through to the store", func() {
+				scaffold.runtime.URL.RawQuery = "count=25"
+				r := scaffold.api.ListFeedback(scaffold.runtime)
+				g.Assert(scaffold.store.listCalls[0].feedbackCount).Equal(25)
+				g.Assert(r.Metadata["count"]).Equal(25)
+			})
+
+			g.It("defaults the count when it is missing or not positive", func() {
+				for _, query := range []string{"", "count=0", "count=-3", "count=lots"} {
+					scaffold.store.listCalls = nil
+					scaffold.runtime.URL.RawQuery = query
+					r := scaffold.api.ListFeedback(scaffold.runtime)
+					g.Assert(scaffold.store.listCalls[0].feedbackCount).Equal(defs.DefaultFeedbackListCount)
+					g.Assert(r.Metadata["count"]).Equal(defs.DefaultFeedbackListCount)
+				}
+			})
+
+			g.It("clamps a count above the maximum list count", func() {
+				scaffold.runtime.URL.RawQuery = "count=5000"
+				r := scaffold.api.ListFeedback(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(scaffold.store.listCalls[0].feedbackCount).Equal(defs.MaxFeedbackListCount)
+				g.Assert(r.Metadata["count"]).Equal(defs.MaxFeedbackListCount)
+			})
+
+			g.It("uses the configured default and maximum counts", func() {
+				scaffold.api.ListCount, scaffold.api.MaxListCount = 3, 40
+				scaffold.api.ListFeedback(scaffold.runtime)
+				scaffold.runtime.URL.RawQuery = "count=41"
+				scaffold.api.ListFeedback(scaffold.runtime)
+				g.Assert(scaffold.store.listCalls).Equal([]feedbackStoreListParams{{"", 3}, {"", 40}})
+			})
+
+			g.It("returns a field error for a cursor not issued by the store", func() {
+				scaffold.runtime.URL.RawQuery = "cursor=garbage"
+				scaffold.store.listErrors = append(scaffold.store.listErrors, defs.Error(defs.ErrInvalidFeedbackCursor))
+				r := scaffold.api.ListFeedback(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidFeedbackCursor)
+				g.Assert(r.Fields).Equal(net.FieldErrors{"cursor": defs.ValidationInvalidCursor})
+			})
+
+			g.It("includes the raw messages of the page along w/ its cursor for protobuf rendering", func() {
+				scaffold.store.nextCursor = "1400000000000-0"
+				scaffold.store.listResults = []interchange.FeedbackMessage{{CommandID: "first"}, {CommandID: "second"}}
+				r := scaffold.api.ListFeedback(scaffold.runtime)
+				list, _ := r.Protobuf.(*interchange.FeedbackList)
+				g.Assert(len(list.Messages)).Equal(2)
+				g.Assert(list.Messages[1].CommandID).Equal("second")
+				g.Assert(list.Cursor).Equal("1400000000000-0")
+			})
+
+			g.Describe("rendered for a client", func() {
+				var server *httptest.Server
+
+				list := func(accept string) *http.Response {
+					request, _ := http.NewRequest("GET", server.URL+"/device-feedback?device_id=device-1", nil)
+					request.Header.Set(defs.APIUserTokenHeader, "viewer-token")
+					request.Header.Set(defs.APIAcceptHeader, accept)
+					response, _ := http.DefaultClient.Do(request)
+					return response
+				}
+
+				g.BeforeEach(func() {
+					report, _ := proto.Marshal(&interchange.ReportMessage{Red: 10, Green: 20, Blue: 30})
+					scaffold.store.listResults = []interchange.FeedbackMessage{
+						{Type: interchange.FeedbackMessageType_REPORT, Payload: report, CommandID: "command-1"},
+					}
+
+					server = httptest.NewServer(&net.ServerRuntime{
+						Logger: newTestRouteLogger(),
+						Multiplexer: &net.RouteConfigMapMatcher{
+							net.RouteConfig{Method: "GET", Pattern: defs.DeviceFeedbackRoute}: scaffold.api.ListFeedback,
+						},
+					})
+				})
+
+				g.AfterEach(func() {
+					server.Close()
+				})
+
+				g.It("sends the feedback list as json by default", func() {
+					response := list("")
+					defer response.Body.Close()
+					g.Assert(response.Header.Get(defs.APIContentTypeHeader)).Equal(defs.APIJSONContentType)
+					body := struct {
+						Results []reportEntry `json:"results"`
+					}{}
+					g.Assert(json.NewDecoder(response.Body).Decode(&body)).Equal(nil)
+					g.Assert(len(body.Results)).Equal(1)
+					g.Assert(body.Results[0].Green).Equal(uint32(20))
+				})
+
+				g.It("sends the feedback list as json to clients that accept json", func() {
+					response := list(defs.APIJSONContentType)
+					defer response.Body.Close()
+					g.Assert(response.Header.Get(defs.APIContentTypeHeader)).Equal(defs.APIJSONContentType)
+				})
+
+				g.It("sends the binary encoded feedback list to clients that accept protobuf", func() {
+					response := list(defs.APIProtobufContentType)
+					defer response.Body.Close()
+					g.Assert(response.Header.Get(defs.APIContentTypeHeader)).Equal(defs.APIProtobufContentType)
+					data, _ := ioutil.ReadAll(response.Body)
+					decoded := interchange.FeedbackList{}
+					g.Assert(proto.Unmarshal(data, &decoded)).Equal(nil)
+					g.Assert(len(decoded.Messages)).Equal(1)
+					g.Assert(decoded.Messages[0].CommandID).Equal("command-1")
+					report := interchange.ReportMessage{}
+					g.Assert(proto.Unmarshal(decoded.Messages[0].Payload, &report)).Equal(nil)
+					g.Assert(report.Blue).Equal(uint32(30))
+				})
+			})
+		})
+	})
+
+	g.Describe("List", func() {
+		var scaffold testFeedbackAPIScaffolding
+
+		g.BeforeEach(func() {
+			scaffold = prepareFeedbackAPIScaffold()
+			scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{DeviceID: "device-1"})
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+		})
+
+		g.It("returns not found if unable to find the device", func() {
+			scaffold.index.findErrors = append(scaffold.index.findErrors, defs.Error(defs.ErrNotFound))
+			r := scaffold.api.List(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.It("rejects requests w/o a token", func() {
+			scaffold.runtime.Header.Del(defs.APIUserTokenHeader)
+			scaffold.tokens.authorized = true
+			r := scaffold.api.List(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidToken)
+			g.Assert(len(scaffold.store.listCalls)).Equal(0)
+		})
+
+		g.It("rejects tokens w/o the viewer permission", func() {
+			r := scaffold.api.List(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidToken)
+			g.Assert(len(scaffold.store.listCalls)).Equal(0)
+		})
+
+		g.It("lists the feedback of the device for an authorized token", func() {
+			scaffold.tokens.authorized = true
+			scaffold.store.listResults = append(scaffold.store.listResults, interchange.FeedbackMessage{})
+			r := scaffold.api.List(scaffold.runtime)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(r.Signed).Equal(true)
+			g.Assert(len(r.Results.([]interface{}))).Equal(1)
+			g.Assert(scaffold.store.listCalls).Equal([]feedbackStoreListParams{
+				{"device-1", defs.DefaultFeedbackListCount - 1},
+			})
+		})
+
+		g.It("returns exactly the requested amount of entries", func() {
+			scaffold.tokens.authorized = true
+			scaffold.store.listResults = make([]interchange.FeedbackMessage, 10)
+			scaffold.runtime.URL.RawQuery = "count=3"
+			r := scaffold.api.List(scaffold.runtime)
+			g.Assert(len(r.Results.([]interface{}))).Equal(3)
+			g.Assert(r.Metadata["count"]).Equal(3)
+		})
+
+		g.It("returns no more than the maximum list count of entries", func() {
+			scaffold.tokens.authorized = true
+			scaffold.store.listResults = make([]interchange.FeedbackMessage, defs.MaxFeedbackListCount*2)
+			scaffold.runtime.URL.RawQuery = "count=1000"
+			r := scaffold.api.List(scaffold.runtime)
+			g.Assert(len(r.Results.([]interface{}))).Equal(defs.MaxFeedbackListCount)
+		})
+
+		g.It("is satisfied by a token w/ only the viewer permission", func() {
+			scaffold.tokens.authorizedPermission = defs.SecurityDeviceTokenPermissionViewer
+			r := scaffold.api.List(scaffold.runtime)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(scaffold.tokens.authorizationAttempts["device-1"]["some-token"]).Equal(
+				uint(defs.SecurityDeviceTokenPermissionViewer),
+			)
+		})
+
+		g.It("caps the count at the maximum list count", func() {
+			scaffold.tokens.authorized = true
+			scaffold.runtime.URL.RawQuery = "count=1000"
+			scaffold.api.List(scaffold.runtime)
+			g.Assert(scaffold.store.listCalls[0].feedbackCount).Equal(defs.MaxFeedbackListCount - 1)
+		})
+
+		g.It("fails if unable to list the feedback from the store", func() {
+			scaffold.tokens.authorized = true
+			scaffold.store.listErrors = append(scaffold.store.listErrors, fmt.Errorf("bad-list"))
+			r := scaffold.api.List(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+		})
+	})
+
+	g.Describe("FeedbackStats", func() {
+		var scaffold testFeedbackAPIScaffolding
+
+		g.BeforeEach(func() {
+			scaffold = prepareFeedbackAPIScaffold()
+		})
+
+		g.It("returns not found if the device does not exist", func() {
+			scaffold.index.findErrors = append(scaffold.index.findErrors, defs.Error(defs.ErrNotFound))
+			r := scaffold.api.FeedbackStats(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.It("returns a server error if unable to look up the device", func() {
+			scaffold.index.findErrors = append(scaffold.index.findErrors, fmt.Errorf("bad-find"))
+			r := scaffold.api.FeedbackStats(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+		})
+
+		g.It("returns not found if the token is not authorized to administer the device", func() {
+			scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{DeviceID: "d1"})
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			r := scaffold.api.FeedbackStats(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+			attempted := scaffold.tokens.authorizationAttempts["d1"]["some-token"]
+			g.Assert(attempted).Equal(uint(defs.SecurityDeviceTokenPermissionAdmin))
+			g.Assert(len(scaffold.store.statWindows)).Equal(0)
+		})
+
+		g.It("returns an error if the window is invalid", func() {
+			scaffold.runtime.URL.RawQuery = "window=yesterday"
+			r := scaffold.api.FeedbackStats(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidFeedbackWindow)
+		})
+
+		g.It("returns an error if the window is not positive", func() {
+			scaffold.runtime.URL.RawQuery = "window=-10m"
+			r := scaffold.api.FeedbackStats(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidFeedbackWindow)
+		})
+
+		g.Describe("having found the device w/ an authorized admin token", func() {
+			g.BeforeEach(func() {
+				scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
+				scaffold.tokens.authorized = true
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			})
+
+			g.It("fails if unable to load the stats from the store", func() {
+				scaffold.store.statErrors = append(scaffold.store.statErrors, fmt.Errorf("bad-stats"))
+				r := scaffold.api.FeedbackStats(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			})
+
+			g.It("uses the default window when none is provided", func() {
+				r := scaffold.api.FeedbackStats(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(scaffold.store.statWindows).Equal([]time.Duration{defs.DefaultFeedbackStatsWindow})
+			})
+
+			g.It("returns the stats for the requested window", func() {
+				scaffold.store.statResults = map[string]int{"info": 1, "warn": 0, "error": 3}
+				scaffold.runtime.URL.RawQuery = "window=30m"
+				r := scaffold.api.FeedbackStats(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(scaffold.store.statWindows).Equal([]time.Duration{time.Minute * 30})
+				g.Assert(r.Results).Equal(map[string]int{"info": 1, "warn": 0, "error": 3})
+				g.Assert(r.Metadata["window"]).Equal("30m0s")
+			})
+		})
+	})
+
+	g.Describe("QueryFeedback", func() {
+		var scaffold testFeedbackAPIScaffolding
+
+		g.BeforeEach(func() {
+			scaffold = prepareFeedbackAPIScaffold()
+		})
+
+		g.It("returns not found if the token is not authorized to view the device", func() {
+			scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			r := scaffold.api.QueryFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+			g.Assert(len(scaffold.store.queries)).Equal(0)
+		})
+
+		g.It("returns an error w/ the level field if the level is unknown", func() {
+			scaffold.runtime.URL.RawQuery = "level=loud"
+			r := scaffold.api.QueryFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidFeedbackLevel)
+			g.Assert(r.Fields).Equal(net.FieldErrors{"level": defs.ValidationUnknownLevel})
+		})
+
+		g.It("returns an error w/ each invalid field", func() {
+			scaffold.runtime.URL.RawQuery = "since=yesterday&limit=-1&offset=abc"
+			r := scaffold.api.QueryFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrBadRequestFormat)
+			g.Assert(r.Fields).Equal(net.FieldErrors{
+				"since":  defs.ValidationInvalidTime,
+				"limit":  defs.ValidationOutOfRange,
+				"offset": defs.ValidationOutOfRange,
+			})
+		})
+
+		g.It("returns an error if the since time is after the until time", func() {
+			scaffold.runtime.URL.RawQuery = "since=2017-07-14T02:41:00Z&until=2017-07-14T02:40:00Z"
+			r := scaffold.api.QueryFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidFeedbackRange)
+			g.Assert(len(scaffold.store.queries)).Equal(0)
+		})
+
+		g.Describe("having found the device w/ an authorized viewer token", func() {
+			g.BeforeEach(func() {
+				scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
+				scaffold.tokens.authorized = true
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			})
+
+			g.It("fails if unable to query the feedback from the store", func() {
+				scaffold.store.listErrors = append(scaffold.store.listErrors, fmt.Errorf("bad-query"))
+				r := scaffold.api.QueryFeedback(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			})
+
+			g.It("uses the default limit w/o any other predicates when no params are provided", func() {
+				r := scaffold.api.QueryFeedback(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(scaffold.store.queries).Equal([]device.FeedbackQuery{{Limit: defs.DefaultFeedbackQueryLimit}})
+				g.Assert(r.Metadata["count"]).Equal(0)
+			})
+
+			g.It("passes each of the params along to the store", func() {
+				scaffold.runtime.URL.RawQuery = strings.Join([]string{
+					"level=warn",
+					"since=2017-07-14T02:40:00Z",
+					"until=2017-07-14T02:41:00Z",
+					"offset=5",
+					"limit=20",
+				}, "&")
+				r := scaffold.api.QueryFeedback(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				query := scaffold.store.queries[0]
+				g.Assert(query.Level).Equal(interchange.FeedbackLevel_LEVEL_WARN)
+				g.Assert(query.Since.Unix()).Equal(int64(1500000000))
+				g.Assert(query.Until.Unix()).Equal(int64(1500000060))
+				g.Assert(query.Offset).Equal(5)
+				g.Assert(query.Limit).Equal(20)
+				g.Assert(r.Metadata["offset"]).Equal(5)
+				g.Assert(r.Metadata["limit"]).Equal(20)
+			})
+
+			g.It("returns the queried entries", func() {
+				report, _ := proto.Marshal(&interchange.ReportMessage{Red: 255})
+				scaffold.store.listResults = []interchange.FeedbackMessage{
+					{Type: interchange.FeedbackMessageType_REPORT, Payload: report},
+					{Type: interchange.FeedbackMessageType_ERROR, Payload: []byte("oops")},
+				}
+				r := scaffold.api.QueryFeedback(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				results := r.Results.([]interface{})
+				g.Assert(len(results)).Equal(2)
+				g.Assert(results[0].(reportEntry).Red).Equal(uint32(255))
+				g.Assert(results[1] == nil).Equal(true)
+				g.Assert(r.Metadata["count"]).Equal(2)
 			})
 		})
 	})
@@ -145,7 +605,27 @@ func Test_FeedbackAPI(t *testing.T) {
 			g.Assert(r.Errors[0].Error()).Equal(defs.ErrBadInterchangeData)
 		})
 
+		g.It("rejects bodies larger than the max body size w/o reading the rest of them", func() {
+			scaffold.runtime.Header.Set(defs.APIContentTypeHeader, defs.APIFeedbackContentTypeHeader)
+			scaffold.body.Write(make([]byte, defs.DefaultMaxRequestBodySize*2))
+			r := scaffold.api.CreateFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrRequestTooLarge)
+			g.Assert(scaffold.body.Len() > 0).Equal(true)
+			g.Assert(len(scaffold.stream.published)).Equal(0)
+		})
+
 		g.Describe("when the body contains a valid marshalled feedback message", func() {
+			// registered returns the details of a registered device w/ the public key of the private key as its secret.
+			registered := func(private *rsa.PrivateKey) device.RegistrationDetails {
+				public, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+				return device.RegistrationDetails{DeviceID: "123", SharedSecret: hex.EncodeToString(public)}
+			}
+
+			private, _ := rsa.GenerateKey(rand.Reader, 1024)
+			other, _ := rsa.GenerateKey(rand.Reader, 1024)
+			payload := []byte("some-payload")
+			digest := sha256.Sum256(payload)
+			signature, _ := rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
 
 			g.BeforeEach(func() {
 				scaffold.runtime.Header.Set(defs.APIContentTypeHeader, defs.APIFeedbackContentTypeHeader)
@@ -153,31 +633,239 @@ func Test_FeedbackAPI(t *testing.T) {
 				buffer.Marshal(&interchange.FeedbackMessage{
 					Authentication: &interchange.DeviceMessageAuthentication{
 						DeviceID:      "123",
-						MessageDigest: "12345",
+						MessageDigest: hex.EncodeToString(signature),
 					},
+					Payload: payload,
 				})
 				scaffold.body.Grow(len(buffer.Bytes()))
 				scaffold.body.Write(buffer.Bytes())
 			})
 
-			g.It("returns an error if unable to find device", func() {
-				scaffold.index.findErrors = append(scaffold.index.findErrors, fmt.Errorf("not-found"))
+			g.It("returns not found if the device does not exist", func() {
+				scaffold.index.findErrors = append(scaffold.index.findErrors, defs.Error(defs.ErrNotFound))
 				r := scaffold.api.CreateFeedback(scaffold.runtime)
 				g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
 			})
 
+			g.It("returns a server error if unable to look up the device", func() {
+				scaffold.index.findErrors = append(scaffold.index.findErrors, fmt.Errorf("bad-find"))
+				r := scaffold.api.CreateFeedback(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			})
+
+			g.It("rejects feedback whose digest was signed w/ the key of another device", func() {
+				scaffold.index.foundDevices = append(scaffold.index.foundDevices, registered(other))
+				r := scaffold.api.CreateFeedback(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrBadInterchangeAuthentication)
+				g.Assert(len(scaffold.stream.published)).Equal(0)
+			})
+
+			g.It("rejects feedback from devices whose registered key is unable to be parsed", func() {
+				scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{DeviceID: "123"})
+				r := scaffold.api.CreateFeedback(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrBadInterchangeAuthentication)
+				g.Assert(len(scaffold.stream.published)).Equal(0)
+			})
+
 			g.It("returns an error if unable to log the feedback", func() {
-				scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
+				scaffold.index.foundDevices = append(scaffold.index.foundDevices, registered(private))
 				scaffold.store.logErrors = append(scaffold.store.logErrors, fmt.Errorf("bad-store"))
 				r := scaffold.api.CreateFeedback(scaffold.runtime)
 				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
 			})
 
 			g.It("returns without an error if successfully logged the feedback", func() {
-				scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
+				scaffold.index.foundDevices = append(scaffold.index.foundDevices, registered(private))
 				r := scaffold.api.CreateFeedback(scaffold.runtime)
 				g.Assert(len(r.Errors)).Equal(0)
 			})
+
+			g.It("publishes the feedback to the feedback stream after logging it", func() {
+				scaffold.index.foundDevices = append(scaffold.index.foundDevices, registered(private))
+				scaffold.api.CreateFeedback(scaffold.runtime)
+				g.Assert(len(scaffold.stream.published)).Equal(1)
+				g.Assert(scaffold.stream.published[0].Authentication.DeviceID).Equal("123")
+			})
+		})
+	})
+
+	g.Describe("CreateFeedbackBatch", func() {
+		var scaffold testFeedbackAPIScaffolding
+
+		// send writes the batch into the request body as a marshalled feedback list.
+		send := func(messages ...*interchange.FeedbackMessage) {
+			buffer := proto.NewBuffer([]byte{})
+			buffer.Marshal(&interchange.FeedbackList{Messages: messages})
+			scaffold.body.Write(buffer.Bytes())
+		}
+
+		// message returns a feedback message from the device w/ the provided payload.
+		message := func(id string, payload string) *interchange.FeedbackMessage {
+			auth := interchange.DeviceMessageAuthentication{DeviceID: id}
+			return &interchange.FeedbackMessage{Authentication: &auth, Payload: []byte(payload)}
+		}
+
+		g.BeforeEach(func() {
+			scaffold = prepareFeedbackAPIScaffold()
+			scaffold.runtime.Header.Set(defs.APIContentTypeHeader, defs.APIFeedbackContentTypeHeader)
+		})
+
+		g.It("returns an error without a proper content type header", func() {
+			scaffold.runtime.Header.Del(defs.APIContentTypeHeader)
+			r := scaffold.api.CreateFeedbackBatch(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidContentType)
+		})
+
+		g.It("returns an error with an invalid body", func() {
+			scaffold.body.WriteString("not-a-feedback-list")
+			r := scaffold.api.CreateFeedbackBatch(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrBadInterchangeData)
+		})
+
+		g.It("returns a validation error for a batch w/o any messages", func() {
+			send()
+			r := scaffold.api.CreateFeedbackBatch(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidFeedbackBatch)
+			g.Assert(len(scaffold.store.batches)).Equal(0)
+		})
+
+		g.It("returns a validation error for a batch w/ too many messages", func() {
+			messages := make([]*interchange.FeedbackMessage, defs.DefaultFeedbackBatchLimit+1)
+
+			for i := range messages {
+				messages[i] = message("123", "some-payload")
+			}
+
+			send(messages...)
+			r := scaffold.api.CreateFeedbackBatch(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidFeedbackBatch)
+			g.Assert(len(scaffold.store.batches)).Equal(0)
+		})
+
+		g.It("returns a server error if unable to log the batch", func() {
+			send(message("123", "first"))
+			scaffold.store.batchErrors = append(scaffold.store.batchErrors, fmt.Errorf("bad-store"))
+			r := scaffold.api.CreateFeedbackBatch(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			g.Assert(len(scaffold.stream.published)).Equal(0)
+		})
+
+		g.It("logs each message of the batch w/ the store and publishes them", func() {
+			send(message("123", "first"), message("456", "second"))
+			r := scaffold.api.CreateFeedbackBatch(scaffold.runtime)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(len(scaffold.store.batches)).Equal(1)
+			g.Assert(string(scaffold.store.batches[0][1].Payload)).Equal("second")
+			g.Assert(r.Results.(feedbackBatchResult).Logged).Equal(2)
+			g.Assert(len(scaffold.stream.published)).Equal(2)
+		})
+
+		g.It("reports the messages that failed by index w/o publishing them", func() {
+			send(message("123", "first"), message("456", "second"), message("789", "third"))
+			scaffold.store.batchErrors = append(scaffold.store.batchErrors, device.FeedbackBatchError{
+				0: defs.Error(defs.ErrBadInterchangeAuthentication),
+				2: fmt.Errorf("bad-store"),
+			})
+			r := scaffold.api.CreateFeedbackBatch(scaffold.runtime)
+			result := r.Results.(feedbackBatchResult)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(result.Logged).Equal(1)
+			g.Assert(result.Failed["0"]).Equal(defs.ErrBadInterchangeAuthentication)
+			g.Assert(result.Failed["2"]).Equal(defs.ErrServerError)
+			g.Assert(len(scaffold.stream.published)).Equal(1)
+			g.Assert(string(scaffold.stream.published[0].Payload)).Equal("second")
+		})
+	})
+
+	g.Describe("StreamFeedback", func() {
+		var scaffold testFeedbackAPIScaffolding
+
+		g.BeforeEach(func() {
+			scaffold = prepareFeedbackAPIScaffold()
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "viewer-token")
+		})
+
+		g.It("returns not found if the device does not exist", func() {
+			scaffold.index.findErrors = append(scaffold.index.findErrors, defs.Error(defs.ErrNotFound))
+			r := scaffold.api.StreamFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.It("returns a server error if unable to look up the device", func() {
+			scaffold.index.findErrors = append(scaffold.index.findErrors, fmt.Errorf("bad-find"))
+			r := scaffold.api.StreamFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+		})
+
+		g.It("returns an error if the token is not authorized to view the device", func() {
+			scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
+			r := scaffold.api.StreamFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+			g.Assert(len(scaffold.stream.subscriptions)).Equal(0)
+		})
+
+		g.It("returns a server error if the response is unable to stream events", func() {
+			scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
+			scaffold.tokens.authorized = true
+			r := scaffold.api.StreamFeedback(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+		})
+
+		g.Describe("with an authorized client connected", func() {
+			var server *httptest.Server
+			var reader *bufio.Reader
+			var response *http.Response
+
+			g.BeforeEach(func() {
+				scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{
+					DeviceID: "device-123",
+				})
+				scaffold.tokens.authorized = true
+
+				server = httptest.NewServer(&net.ServerRuntime{
+					Logger: newTestRouteLogger(),
+					Multiplexer: &net.RouteConfigMapMatcher{
+						net.RouteConfig{Method: "GET", Pattern: defs.DeviceFeedbackStreamRoute}: scaffold.api.StreamFeedback,
+					},
+				})
+
+				request, _ := http.NewRequest("GET", server.URL+"/device-feedback/stream?device_id=device-123", nil)
+				request.Header.Set(defs.APIUserTokenHeader, "viewer-token")
+				response, _ = http.DefaultClient.Do(request)
+				reader = bufio.NewReader(response.Body)
+			})
+
+			g.AfterEach(func() {
+				response.Body.Close()
+				server.Close()
+			})
+
+			g.It("responds w/ the event stream content type", func() {
+				g.Assert(response.Header.Get(defs.APIContentTypeHeader)).Equal(defs.APIEventStreamContentType)
+			})
+
+			g.It("sends feedback messages for the device as event frames", func() {
+				scaffold.stream.subscriptions[0] <- interchange.FeedbackMessage{
+					Authentication: &interchange.DeviceMessageAuthentication{DeviceID: "device-123"},
+				}
+
+				event, _ := reader.ReadString('\n')
+				data, _ := reader.ReadString('\n')
+				end, _ := reader.ReadString('\n')
+
+				g.Assert(event).Equal(fmt.Sprintf("event: %s\n", defs.APIFeedbackStreamEventName))
+				g.Assert(strings.HasPrefix(data, "data: {")).Equal(true)
+				g.Assert(strings.Contains(data, "device-123")).Equal(true)
+				g.Assert(end).Equal("\n")
+			})
+
+			g.It("unsubscribes once the client disconnects", func() {
+				subscription := scaffold.stream.subscriptions[0]
+				response.Body.Close()
+				server.Close()
+				g.Assert(len(scaffold.stream.unsubscribed)).Equal(1)
+				g.Assert(scaffold.stream.unsubscribed[0] == subscription).Equal(true)
+			})
 		})
 	})
 }
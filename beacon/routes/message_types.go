@@ -0,0 +1,34 @@
+package routes
+
+import "strings"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+// ParseDeviceMessageType returns the device message type w/ the given name (case insensitive, e.g "control"), erroring
+// w/ the invalid message type error for names that are not part of the enum.
+func ParseDeviceMessageType(name string) (interchange.DeviceMessageType, error) {
+	value, ok := interchange.DeviceMessageType_value[strings.ToUpper(strings.TrimSpace(name))]
+
+	if ok != true {
+		return 0, defs.Error(defs.ErrInvalidDeviceMessageType)
+	}
+
+	return interchange.DeviceMessageType(value), nil
+}
+
+// ParseControlTermination returns the control termination w/ the given name (case insensitive, e.g "off"). An empty
+// name is the default hold-last-frame termination.
+func ParseControlTermination(name string) (interchange.ControlTermination, error) {
+	if strings.TrimSpace(name) == "" {
+		return interchange.ControlTermination_HOLD, nil
+	}
+
+	value, ok := interchange.ControlTermination_value[strings.ToUpper(strings.TrimSpace(name))]
+
+	if ok != true {
+		return 0, defs.Error(defs.ErrInvalidControlTermination)
+	}
+
+	return interchange.ControlTermination(value), nil
+}
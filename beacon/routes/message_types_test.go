@@ -0,0 +1,91 @@
+package routes
+
+import "testing"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+func Test_ParseDeviceMessageType(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("ParseDeviceMessageType", func() {
+		valid := []struct {
+			name     string
+			expected interchange.DeviceMessageType
+		}{
+			{"WELCOME", interchange.DeviceMessageType_WELCOME},
+			{"welcome", interchange.DeviceMessageType_WELCOME},
+			{"CONTROL", interchange.DeviceMessageType_CONTROL},
+			{"control", interchange.DeviceMessageType_CONTROL},
+			{" Control ", interchange.DeviceMessageType_CONTROL},
+		}
+
+		for _, v := range valid {
+			test := v
+
+			g.It("parses \""+test.name+"\"", func() {
+				messageType, e := ParseDeviceMessageType(test.name)
+				g.Assert(e).Equal(nil)
+				g.Assert(messageType).Equal(test.expected)
+			})
+		}
+
+		g.It("parses the name of every message type in the enum", func() {
+			for value, name := range interchange.DeviceMessageType_name {
+				messageType, e := ParseDeviceMessageType(name)
+				g.Assert(e).Equal(nil)
+				g.Assert(messageType).Equal(interchange.DeviceMessageType(value))
+			}
+		})
+
+		invalid := []string{"", "reboot", "control!", "1"}
+
+		for _, v := range invalid {
+			name := v
+
+			g.It("rejects \""+name+"\"", func() {
+				_, e := ParseDeviceMessageType(name)
+				g.Assert(e == defs.Error(defs.ErrInvalidDeviceMessageType)).Equal(true)
+			})
+		}
+	})
+}
+
+func Test_ParseControlTermination(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("ParseControlTermination", func() {
+		valid := []struct {
+			name     string
+			expected interchange.ControlTermination
+		}{
+			{"", interchange.ControlTermination_HOLD},
+			{"hold", interchange.ControlTermination_HOLD},
+			{"HOLD", interchange.ControlTermination_HOLD},
+			{"off", interchange.ControlTermination_OFF},
+			{" Off ", interchange.ControlTermination_OFF},
+		}
+
+		for _, v := range valid {
+			test := v
+
+			g.It("parses \""+test.name+"\"", func() {
+				termination, e := ParseControlTermination(test.name)
+				g.Assert(e).Equal(nil)
+				g.Assert(termination).Equal(test.expected)
+			})
+		}
+
+		invalid := []string{"loop", "off!", "1"}
+
+		for _, v := range invalid {
+			name := v
+
+			g.It("rejects \""+name+"\"", func() {
+				_, e := ParseControlTermination(name)
+				g.Assert(e == defs.Error(defs.ErrInvalidControlTermination)).Equal(true)
+			})
+		}
+	})
+}
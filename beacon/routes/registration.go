@@ -11,6 +11,11 @@ import "github.com/dadleyy/beacon.api/beacon/device"
 import "github.com/dadleyy/beacon.api/beacon/logging"
 import "github.com/dadleyy/beacon.api/beacon/security"
 
+// DeviceDisconnector defines the interface used to close the connections a device holds in the control pool.
+type DeviceDisconnector interface {
+	Disconnect(string) int
+}
+
 // NewRegistrationAPI returns a constructed registration api
 func NewRegistrationAPI(stream device.RegistrationStream, registry device.Registry) *RegistrationAPI {
 	logger := logging.New(defs.RegistrationAPILogPrefix, logging.Green)
@@ -27,6 +32,38 @@ type RegistrationAPI struct {
 	logging.LeveledLogger
 	device.Registry
 	stream device.RegistrationStream
+
+	// CompressionThreshold is the payload size past which messages sent to registered devices are compressed.
+	CompressionThreshold int
+
+	// MaxDecompressedSize is the size compressed payloads received from devices may expand to; zero uses the default.
+	MaxDecompressedSize int
+
+	// Resumes, if provided, allows reconnecting devices to present a resume token and keep their previous device id.
+	Resumes device.ResumeStore
+
+	// AdminToken is the server admin token required to list pending registrations; the route is disabled if empty.
+	AdminToken string
+
+	// DeviceTLSMode determines whether client certificates presented by registering devices are verified (off by default).
+	DeviceTLSMode string
+
+	// Names, if provided, is used to check whether the name of a pre-registration is taken; when nil the registry is
+	// searched for a device w/ the name.
+	Names device.NameIndex
+
+	// Connections, if provided, opens the connection of registering devices; when nil the request is upgraded to a
+	// websocket compressed past the compression threshold.
+	Connections ConnectionFactory
+
+	// Pool, if provided, has the connections of devices whose registration has been reissued closed so that they
+	// reconnect w/ their new key.
+	Pool DeviceDisconnector
+}
+
+type reissueResult struct {
+	DeviceID     string `json:"device_id"`
+	Disconnected int    `json:"disconnected"`
 }
 
 // Preregister is used to submit a new registation request for a device
@@ -36,41 +73,50 @@ func (registrations *RegistrationAPI) Preregister(runtime *net.RequestRuntime) n
 		Name         string `json:"name"`
 	}{}
 
-	if e := runtime.ReadBody(&request); e != nil {
-		registrations.Warnf("invalid request: %s", e.Error())
-		return runtime.LogicError(defs.ErrBadRequestFormat)
+	e := runtime.ReadBody(&request)
+
+	if e == defs.Error(defs.ErrRequestTooLarge) {
+		registrations.Warnf("registration request body too large")
+		return runtime.LogicError(defs.ErrRequestTooLarge)
 	}
 
-	if valid := len(request.Name) > 1 && len(request.SharedSecret) > 1; !valid {
-		registrations.Warnf("invalid registration request: %v", request)
+	if e != nil {
+		registrations.Warnf("invalid request: %s", e.Error())
 		return runtime.LogicError(defs.ErrBadRequestFormat)
 	}
 
-	if _, e := registrations.FindDevice(request.Name); e == nil {
-		registrations.Warnf("duplicate device name registration: %v", request)
-		return runtime.LogicError(defs.ErrDuplicateRegistrationName)
+	fields := net.FieldErrors{}
+
+	if len(request.Name) < defs.SecurityDeviceNameMinLength {
+		fields["name"] = defs.ValidationTooShort
 	}
 
-	block, e := hex.DecodeString(request.SharedSecret)
+	if len(request.SharedSecret) <= 1 {
+		fields["shared_secret"] = defs.ValidationRequired
+	}
 
-	if e != nil {
-		registrations.Warnf("invalid shared secret (%s): %s", request.SharedSecret, e.Error())
-		return runtime.LogicError(defs.ErrInvalidDeviceSharedSecret)
+	if len(fields) > 0 {
+		registrations.Warnf("invalid registration request: %v", request)
+		return runtime.ValidationError(defs.ErrBadRequestFormat, fields)
 	}
 
-	pub, e := x509.ParsePKIXPublicKey(block)
+	taken, e := registrations.nameTaken(request.Name)
 
 	if e != nil {
-		registrations.Warnf("invalid shared secret: %s", e.Error())
-		return runtime.LogicError(defs.ErrInvalidDeviceSharedSecret)
+		registrations.Errorf("unable to check for duplicate device name: %s", e.Error())
+		return runtime.ServerError()
 	}
 
-	if _, ok := pub.(*rsa.PublicKey); ok != true {
-		registrations.Warnf("incorrect shared secret key, not rsa format: %s", request.SharedSecret)
-		return runtime.LogicError("bad-key-format")
+	if taken {
+		registrations.Warnf("duplicate device name registration: %v", request)
+		return runtime.LogicError(defs.ErrDuplicateRegistrationName)
 	}
 
-	details := device.RegistrationRequest(request)
+	if result, invalid := registrations.validateSecret(runtime, request.SharedSecret); invalid {
+		return result
+	}
+
+	details := device.RegistrationRequest{SharedSecret: request.SharedSecret, Name: request.Name}
 
 	if e := registrations.AllocateRegistration(details); e != nil {
 		registrations.Errorf("unable to allocate registration: %s", e.Error())
@@ -82,16 +128,120 @@ func (registrations *RegistrationAPI) Preregister(runtime *net.RequestRuntime) n
 	return net.HandlerResult{}
 }
 
+// CheckExists returns whether or not a device has been registered w/ the name or id in the query string, w/o any of
+// the device's details.
+func (registrations *RegistrationAPI) CheckExists(runtime *net.RequestRuntime) net.HandlerResult {
+	query := runtime.GetQueryParam("query")
+
+	if valid := len(query) > 1; !valid {
+		return runtime.LogicError(defs.ErrBadRequestFormat)
+	}
+
+	exists, e := registrations.DeviceExists(query)
+
+	if e != nil {
+		registrations.Errorf("unable to check device existence (query: %s): %s", query, e.Error())
+		return runtime.ServerError()
+	}
+
+	result := struct {
+		Exists bool `json:"exists"`
+	}{exists}
+
+	return net.HandlerResult{Results: result}
+}
+
+// ListPending returns the registration requests still awaiting a device, requiring the server admin token.
+func (registrations *RegistrationAPI) ListPending(runtime *net.RequestRuntime) net.HandlerResult {
+	if authorizeAdmin(registrations.AdminToken, runtime.HeaderValue(defs.APIUserTokenHeader)) != true {
+		registrations.Warnf("unauthorized attempt to list pending registrations")
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	pending, e := registrations.ListPendingRegistrations()
+
+	if e != nil {
+		registrations.Errorf("unable to list pending registrations: %s", e.Error())
+		return runtime.ServerError()
+	}
+
+	return net.HandlerResult{Results: pending}
+}
+
+// Reissue replaces the shared secret of the device in the path w/ the one in the request body, requiring the server
+// admin token. The device keeps its id and tokens; any connection it holds is closed so that it has to reconnect (and
+// handshake again) w/ the key of the new secret.
+func (registrations *RegistrationAPI) Reissue(runtime *net.RequestRuntime) net.HandlerResult {
+	if authorizeAdmin(registrations.AdminToken, runtime.HeaderValue(defs.APIUserTokenHeader)) != true {
+		registrations.Warnf("unauthorized attempt to reissue a registration")
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	request := struct {
+		SharedSecret string `json:"shared_secret"`
+	}{}
+
+	e := runtime.ReadBody(&request)
+
+	if e == defs.Error(defs.ErrRequestTooLarge) {
+		registrations.Warnf("reissue request body too large")
+		return runtime.LogicError(defs.ErrRequestTooLarge)
+	}
+
+	if e != nil {
+		registrations.Warnf("invalid reissue request: %s", e.Error())
+		return runtime.LogicError(defs.ErrBadRequestFormat)
+	}
+
+	if result, invalid := registrations.validateSecret(runtime, request.SharedSecret); invalid {
+		return result
+	}
+
+	query := runtime.Get("uuid")
+	details, e := registrations.FindDevice(query)
+
+	if e != nil {
+		registrations.Warnf("reissue w/ invalid device id: %s (%s)", query, e.Error())
+		return runtime.LookupError(e)
+	}
+
+	e = registrations.ReissueRegistration(details.DeviceID, request.SharedSecret)
+
+	if e == defs.Error(defs.ErrDeviceLocked) {
+		registrations.Warnf("unable to reissue registration of device %s while it is locked", details.DeviceID)
+		return runtime.LogicError(defs.ErrDeviceLocked)
+	}
+
+	if e != nil {
+		registrations.Errorf("unable to reissue registration of device %s: %s", details.DeviceID, e.Error())
+		return runtime.LookupError(e)
+	}
+
+	result := reissueResult{DeviceID: details.DeviceID}
+
+	if registrations.Pool != nil {
+		result.Disconnected = registrations.Pool.Disconnect(details.DeviceID)
+	}
+
+	registrations.Infof("reissued registration of device %s", details.DeviceID)
+	return net.HandlerResult{Results: result}
+}
+
 // Register is the route handler responsible for upgrating + registering connections
 func (registrations *RegistrationAPI) Register(runtime *net.RequestRuntime) net.HandlerResult {
-	connection, e := runtime.Websocket()
+	if e := registrations.verifyCertificate(runtime); e != nil {
+		registrations.Warnf("rejecting device registration: %s", e.Error())
+		return runtime.LogicError(e.Error())
+	}
+
+	connection, e := registrations.connections().OpenConnection(runtime)
 
 	if e != nil {
-		registrations.Warnf("unable to upgrade websocket: %s", e.Error())
+		registrations.Warnf("unable to open device connection: %s", e.Error())
 		return runtime.LogicError(e.Error())
 	}
 
-	encodedSecret, uuid := runtime.Header.Get(defs.APIDeviceRegistrationHeader), uuid.NewV4()
+	encodedSecret := runtime.Header.Get(defs.APIDeviceRegistrationHeader)
 
 	deviceKey, e := security.ParseDeviceKey(encodedSecret)
 
@@ -101,12 +251,162 @@ func (registrations *RegistrationAPI) Register(runtime *net.RequestRuntime) net.
 		return net.HandlerResult{NoRender: true}
 	}
 
-	if e := registrations.FillRegistration(encodedSecret, uuid.String()); e != nil {
+	filledID, resumed := registrations.resume(runtime.Header.Get(defs.APIDeviceResumeHeader), encodedSecret)
+
+	if resumed != true {
+		filledID, e = registrations.FillRegistration(encodedSecret, uuid.NewV4().String())
+	}
+
+	if e != nil {
 		registrations.Warnf("unable to push device id into store: %s", e.Error())
 		connection.Close()
 		return net.HandlerResult{NoRender: true}
 	}
 
-	registrations.stream <- device.NewStreamerConnection(connection, deviceKey, uuid)
+	// Retried registrations are filled w/ the id of the device the registration was originally filled w/.
+	deviceID, e := uuid.FromString(filledID)
+
+	if e != nil {
+		registrations.Errorf("invalid device id from registry (%s): %s", filledID, e.Error())
+		connection.Close()
+		return net.HandlerResult{NoRender: true}
+	}
+
+	registrations.stream <- connection.Attach(deviceKey, deviceID)
 	return net.HandlerResult{NoRender: true}
 }
+
+// connections returns the connection factory used to open the connection of registering devices.
+func (registrations *RegistrationAPI) connections() ConnectionFactory {
+	if registrations.Connections != nil {
+		return registrations.Connections
+	}
+
+	return WebsocketConnectionFactory{
+		CompressionThreshold: registrations.CompressionThreshold,
+		MaxDecompressedSize:  registrations.MaxDecompressedSize,
+	}
+}
+
+// resume attempts to redeem the resume token sent by a reconnecting device for the id it was previously registered w/.
+// Devices w/o a valid token are treated as a fresh registration.
+func (registrations *RegistrationAPI) resume(token, secret string) (string, bool) {
+	if registrations.Resumes == nil || token == "" {
+		return "", false
+	}
+
+	deviceID, e := registrations.Resumes.ResumeDevice(token, secret)
+
+	if e != nil {
+		registrations.Warnf("unable to resume device, registering as new device: %s", e.Error())
+		return "", false
+	}
+
+	registrations.Infof("resumed device[%s]", deviceID)
+	return deviceID, true
+}
+
+// verifyCertificate cross-checks the client certificate presented during the TLS handshake against the device key sent
+// in the registration header. The header key must match the shared secret the registration is filled w/, tying the
+// certificate to the device's stored secret.
+func (registrations *RegistrationAPI) verifyCertificate(runtime *net.RequestRuntime) error {
+	mode := registrations.DeviceTLSMode
+
+	if mode == "" || mode == defs.SecurityDeviceTLSModeOff {
+		return nil
+	}
+
+	if runtime.TLS == nil || len(runtime.TLS.PeerCertificates) == 0 {
+		if mode == defs.SecurityDeviceTLSModeRequired {
+			return defs.Error(defs.ErrDeviceCertificateRequired)
+		}
+
+		return nil
+	}
+
+	deviceKey, e := security.ParseDeviceKey(runtime.Header.Get(defs.APIDeviceRegistrationHeader))
+
+	if e != nil {
+		return defs.Error(defs.ErrInvalidDeviceSharedSecret)
+	}
+
+	if deviceKey.MatchesCertificate(runtime.TLS.PeerCertificates[0]) != true {
+		return defs.Error(defs.ErrDeviceCertificateMismatch)
+	}
+
+	return nil
+}
+
+// validateSecret returns the error result (and true) for shared secrets that are not the hex encoded, DER encoded rsa
+// public key of a device.
+func (registrations *RegistrationAPI) validateSecret(
+	runtime *net.RequestRuntime,
+	secret string,
+) (net.HandlerResult, bool) {
+	if validHex(secret) != true {
+		registrations.Warnf("shared secret is not valid hex (length: %d)", len(secret))
+		return runtime.ValidationError(defs.ErrInvalidDeviceSharedSecretHex, net.FieldErrors{
+			"shared_secret": defs.ValidationInvalidHex,
+		}), true
+	}
+
+	if len(secret) < defs.SecurityMinimumDeviceSharedSecretSize {
+		registrations.Warnf("shared secret too short (length: %d)", len(secret))
+		return runtime.ValidationError(defs.ErrDeviceSharedSecretTooShort, net.FieldErrors{
+			"shared_secret": defs.ValidationTooShort,
+		}), true
+	}
+
+	block, e := hex.DecodeString(secret)
+
+	if e != nil {
+		registrations.Warnf("invalid shared secret (%s): %s", secret, e.Error())
+		return runtime.LogicError(defs.ErrInvalidDeviceSharedSecret), true
+	}
+
+	pub, e := x509.ParsePKIXPublicKey(block)
+
+	if e != nil {
+		registrations.Warnf("invalid shared secret: %s", e.Error())
+		return runtime.ValidationError(defs.ErrInvalidDeviceSharedSecret, net.FieldErrors{
+			"shared_secret": defs.ValidationInvalidKey,
+		}), true
+	}
+
+	if _, ok := pub.(*rsa.PublicKey); ok != true {
+		registrations.Warnf("incorrect shared secret key, not rsa format: %s", secret)
+		return runtime.LogicError("bad-key-format"), true
+	}
+
+	return net.HandlerResult{}, false
+}
+
+// nameTaken returns whether a registered device already has the name.
+func (registrations *RegistrationAPI) nameTaken(name string) (bool, error) {
+	if registrations.Names != nil {
+		return registrations.Names.NameTaken(name)
+	}
+
+	_, e := registrations.FindDevice(name)
+
+	if e == defs.Error(defs.ErrNotFound) {
+		return false, nil
+	}
+
+	return e == nil, e
+}
+
+// validHex returns whether the value is an even length string made up only of hexadecimal characters.
+func validHex(value string) bool {
+	if len(value)%2 != 0 {
+		return false
+	}
+
+	for _, c := range value {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+
+	return true
+}
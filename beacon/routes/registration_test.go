@@ -3,14 +3,21 @@ package routes
 import "fmt"
 import "sync"
 import "bytes"
+import "strings"
 import "testing"
+import "crypto/rsa"
+import "crypto/tls"
+import "crypto/rand"
+import "crypto/x509"
 import "encoding/hex"
+import "encoding/json"
 import "net/http/httptest"
 
 import "github.com/franela/goblin"
 import "github.com/dadleyy/beacon.api/beacon/net"
 import "github.com/dadleyy/beacon.api/beacon/defs"
 import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/security"
 
 type registrationAPIScaffolding struct {
 	api      *RegistrationAPI
@@ -67,6 +74,13 @@ func Test_RegistrationAPI(t *testing.T) {
 			g.Assert(r.Errors[0].Error()).Equal(defs.ErrBadRequestFormat)
 		})
 
+		g.It("errors w/ a distinct error when the request body is too large", func() {
+			secret := strings.Repeat("a", defs.DefaultMaxRequestBodySize)
+			scaffold.body.Write([]byte(fmt.Sprintf(`{"name": "some-device", "shared_secret": "%s"}`, secret)))
+			r := scaffold.api.Preregister(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrRequestTooLarge)
+		})
+
 		g.It("errors with an invalid name", func() {
 			scaffold.body.Write([]byte(`
 			{
@@ -78,10 +92,29 @@ func Test_RegistrationAPI(t *testing.T) {
 			g.Assert(r.Errors[0].Error()).Equal(defs.ErrBadRequestFormat)
 		})
 
-		g.It("errors with an empty object", func() {
+		g.It("errors with a name shorter than the minimum device name length", func() {
+			name := strings.Repeat("a", defs.SecurityDeviceNameMinLength-1)
+			scaffold.body.Write([]byte(fmt.Sprintf(`{"name": "%s", "shared_secret": "%s"}`, name, secretValue)))
+			r := scaffold.api.Preregister(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrBadRequestFormat)
+			g.Assert(r.Fields).Equal(net.FieldErrors{"name": defs.ValidationTooShort})
+		})
+
+		g.It("accepts a name of the minimum device name length", func() {
+			name := strings.Repeat("a", defs.SecurityDeviceNameMinLength)
+			scaffold.body.Write([]byte(fmt.Sprintf(`{"name": "%s", "shared_secret": "%s"}`, name, secretValue)))
+			r := scaffold.api.Preregister(scaffold.runtime)
+			g.Assert(len(r.Errors)).Equal(0)
+		})
+
+		g.It("errors with an empty object, including the error of each invalid field", func() {
 			scaffold.body.Write([]byte(`{}`))
 			r := scaffold.api.Preregister(scaffold.runtime)
 			g.Assert(r.Errors[0].Error()).Equal(defs.ErrBadRequestFormat)
+			g.Assert(r.Fields).Equal(net.FieldErrors{
+				"name":          defs.ValidationTooShort,
+				"shared_secret": defs.ValidationRequired,
+			})
 		})
 
 		g.It("errors with an invalid secret", func() {
@@ -111,9 +144,79 @@ func Test_RegistrationAPI(t *testing.T) {
 				g.Assert(r.Errors[0].Error()).Equal(defs.ErrDuplicateRegistrationName)
 			})
 
-			g.It("fails if unable to parse the shared secret", func() {
+			g.It("fails w/ a server error if unable to check for a device by the same name", func() {
+				scaffold.registry.findErrors = append(scaffold.registry.findErrors, fmt.Errorf("bad-find"))
+				r := scaffold.api.Preregister(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			})
+
+			g.It("fails if the shared secret contains non-hex characters", func() {
 				r := scaffold.api.Preregister(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceSharedSecretHex)
+			})
+
+			g.Describe("having been given a name index", func() {
+				var names *testNameIndex
+
+				g.BeforeEach(func() {
+					names = &testNameIndex{taken: map[string]bool{}}
+					scaffold.api.Names = names
+				})
+
+				g.It("fails if the name index reports the name as taken", func() {
+					names.taken["some-device"] = true
+					r := scaffold.api.Preregister(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrDuplicateRegistrationName)
+					g.Assert(names.queries).Equal([]string{"some-device"})
+				})
+
+				g.It("does not search the registry for a device by the same name", func() {
+					scaffold.registry.activeRegistrations = append(scaffold.registry.activeRegistrations, device.RegistrationDetails{})
+					r := scaffold.api.Preregister(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceSharedSecretHex)
+				})
+
+				g.It("fails w/ a server error if unable to check the name index", func() {
+					names.errors = append(names.errors, fmt.Errorf("bad-sismember"))
+					r := scaffold.api.Preregister(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+				})
+			})
+		})
+
+		g.Describe("with a valid request body but a malformed shared secret", func() {
+			preregister := func(secret string) net.HandlerResult {
+				scaffold.body.Write([]byte(fmt.Sprintf(`{"name": "some-device", "shared_secret": "%s"}`, secret)))
+				return scaffold.api.Preregister(scaffold.runtime)
+			}
+
+			g.It("fails if the shared secret has an odd length", func() {
+				r := preregister(string(secretValue[1:]))
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceSharedSecretHex)
+				g.Assert(r.Fields).Equal(net.FieldErrors{"shared_secret": defs.ValidationInvalidHex})
+			})
+
+			g.It("fails if the shared secret contains non-hex characters", func() {
+				r := preregister("zz" + string(secretValue[2:]))
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceSharedSecretHex)
+				g.Assert(r.Fields).Equal(net.FieldErrors{"shared_secret": defs.ValidationInvalidHex})
+			})
+
+			g.It("fails if the shared secret is shorter than the minimum shared secret size", func() {
+				r := preregister(strings.Repeat("ab", defs.SecurityMinimumDeviceSharedSecretSize/2-1))
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrDeviceSharedSecretTooShort)
+				g.Assert(r.Fields).Equal(net.FieldErrors{"shared_secret": defs.ValidationTooShort})
+			})
+
+			g.It("fails if the shared secret is not a public key", func() {
+				r := preregister(hex.EncodeToString([]byte("a-very-long-shared-secret")))
 				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceSharedSecret)
+				g.Assert(r.Fields).Equal(net.FieldErrors{"shared_secret": defs.ValidationInvalidKey})
+			})
+
+			g.It("accepts a valid hex encoded rsa public key", func() {
+				r := preregister(string(secretValue))
+				g.Assert(len(r.Errors)).Equal(0)
 			})
 		})
 
@@ -162,6 +265,156 @@ func Test_RegistrationAPI(t *testing.T) {
 		})
 	})
 
+	g.Describe("CheckExists", func() {
+		var scaffold registrationAPIScaffolding
+
+		g.BeforeEach(func() {
+			scaffold = prepareRegistrationAPIScaffolding()
+			scaffold.runtime.URL.RawQuery = "query=some-device"
+		})
+
+		g.It("errors without a query", func() {
+			scaffold.runtime.URL.RawQuery = ""
+			r := scaffold.api.CheckExists(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrBadRequestFormat)
+		})
+
+		g.It("errors when unable to check the registry", func() {
+			scaffold.registry.existsErrors = append(scaffold.registry.existsErrors, fmt.Errorf("bad-exists"))
+			r := scaffold.api.CheckExists(scaffold.runtime)
+			g.Assert(len(r.Errors)).Equal(1)
+		})
+
+		g.It("returns only whether or not the device exists", func() {
+			scaffold.registry.activeRegistrations = []device.RegistrationDetails{
+				{Name: "some-device", DeviceID: "device-id", SharedSecret: "the-secret"},
+			}
+			r := scaffold.api.CheckExists(scaffold.runtime)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(r.Results).Equal(struct {
+				Exists bool `json:"exists"`
+			}{true})
+		})
+
+		g.It("returns false when the device does not exist", func() {
+			r := scaffold.api.CheckExists(scaffold.runtime)
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(r.Results).Equal(struct {
+				Exists bool `json:"exists"`
+			}{false})
+		})
+	})
+
+	g.Describe("ListPending", func() {
+		var scaffold registrationAPIScaffolding
+
+		g.BeforeEach(func() {
+			scaffold = prepareRegistrationAPIScaffolding()
+			scaffold.api.AdminToken = "admin-token"
+		})
+
+		g.It("fails without the server admin token", func() {
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-device-token")
+			r := scaffold.api.ListPending(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.It("fails when no server admin token has been configured", func() {
+			scaffold.api.AdminToken = ""
+			r := scaffold.api.ListPending(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.Describe("w/ the server admin token", func() {
+			g.BeforeEach(func() {
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "admin-token")
+			})
+
+			g.It("fails if unable to list the pending registrations", func() {
+				scaffold.registry.pendingErrors = append(scaffold.registry.pendingErrors, fmt.Errorf("bad-list"))
+				r := scaffold.api.ListPending(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			})
+
+			g.It("returns the pending registrations w/o their secrets", func() {
+				scaffold.registry.pending = []device.RegistrationRequest{
+					{Name: "kitchen", SharedSecret: "the-secret", Age: 30},
+				}
+				r := scaffold.api.ListPending(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				encoded, e := json.Marshal(r.Results)
+				g.Assert(e).Equal(nil)
+				g.Assert(string(encoded)).Equal(`[{"name":"kitchen","age":30}]`)
+			})
+		})
+	})
+
+	g.Describe("Reissue", func() {
+		var scaffold registrationAPIScaffolding
+		var pool *testDeviceDisconnector
+
+		reissue := func(body string) net.HandlerResult {
+			scaffold.body.Reset()
+			scaffold.body.Write([]byte(body))
+			return scaffold.api.Reissue(scaffold.runtime)
+		}
+
+		g.BeforeEach(func() {
+			scaffold = prepareRegistrationAPIScaffolding()
+			pool = &testDeviceDisconnector{connections: map[string]int{"device-1": 1}}
+			scaffold.api.AdminToken, scaffold.api.Pool = "admin-token", pool
+			scaffold.registry.activeRegistrations = []device.RegistrationDetails{{DeviceID: "device-1", Name: "kitchen"}}
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "admin-token")
+		})
+
+		g.It("fails without the server admin token", func() {
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-device-token")
+			r := reissue(fmt.Sprintf(`{"shared_secret": "%s"}`, secretValue))
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+			g.Assert(len(scaffold.registry.reissued)).Equal(0)
+		})
+
+		g.It("rejects secrets that are not an rsa public key", func() {
+			r := reissue(`{"shared_secret": "not-hex"}`)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceSharedSecretHex)
+			g.Assert(len(scaffold.registry.reissued)).Equal(0)
+			g.Assert(len(pool.disconnected)).Equal(0)
+		})
+
+		g.It("returns not found for unknown devices", func() {
+			scaffold.registry.activeRegistrations = nil
+			r := reissue(fmt.Sprintf(`{"shared_secret": "%s"}`, secretValue))
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.It("fails w/o disconnecting the device if unable to reissue its registration", func() {
+			scaffold.registry.reissueErrors = []error{fmt.Errorf("bad-reissue")}
+			r := reissue(fmt.Sprintf(`{"shared_secret": "%s"}`, secretValue))
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			g.Assert(len(pool.disconnected)).Equal(0)
+		})
+
+		g.It("fails w/ a logic error while the device is locked", func() {
+			scaffold.registry.reissueErrors = []error{defs.Error(defs.ErrDeviceLocked)}
+			r := reissue(fmt.Sprintf(`{"shared_secret": "%s"}`, secretValue))
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrDeviceLocked)
+		})
+
+		g.It("replaces the secret under the same device id, closing its live connection", func() {
+			r := reissue(fmt.Sprintf(`{"shared_secret": "%s"}`, secretValue))
+			g.Assert(len(r.Errors)).Equal(0)
+			g.Assert(scaffold.registry.reissued).Equal(map[string]string{"device-1": string(secretValue)})
+			g.Assert(pool.disconnected).Equal([]string{"device-1"})
+			g.Assert(r.Results).Equal(reissueResult{DeviceID: "device-1", Disconnected: 1})
+		})
+
+		g.It("reissues the registration w/o a pool", func() {
+			scaffold.api.Pool = nil
+			r := reissue(fmt.Sprintf(`{"shared_secret": "%s"}`, secretValue))
+			g.Assert(r.Results).Equal(reissueResult{DeviceID: "device-1"})
+		})
+	})
+
 	g.Describe("Register", func() {
 		var scaffold registrationAPIScaffolding
 
@@ -175,6 +428,46 @@ func Test_RegistrationAPI(t *testing.T) {
 			g.Assert(r.Errors[0].Error()).Equal("bad-open")
 		})
 
+		g.Describe("w/ a connection factory", func() {
+			var factory *testConnectionFactory
+
+			g.BeforeEach(func() {
+				factory = &testConnectionFactory{pending: &testPendingConnection{}}
+				scaffold.api.Connections = factory
+				scaffold.runtime.Header.Set(defs.APIDeviceRegistrationHeader, string(secretValue))
+				scaffold.registry.filledID = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+			})
+
+			g.It("pushes the connection from the factory onto the registration stream w/o a websocket", func() {
+				connections := make(chan device.Connection, 1)
+
+				go func() {
+					connections <- <-scaffold.stream
+				}()
+
+				r := scaffold.api.Register(scaffold.runtime)
+				g.Assert(r.NoRender).Equal(true)
+				connection := <-connections
+				g.Assert(connection).Equal(device.Connection(factory.pending.attached))
+				g.Assert(connection.GetID()).Equal(scaffold.registry.filledID)
+				g.Assert(len(scaffold.upgrader.connections)).Equal(0)
+			})
+
+			g.It("fails if the factory is unable to open a connection", func() {
+				factory.errors = append(factory.errors, fmt.Errorf("bad-open"))
+				r := scaffold.api.Register(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal("bad-open")
+			})
+
+			g.It("closes the pending connection w/o attaching it if unable to fill the registration", func() {
+				scaffold.registry.fillErrors = append(scaffold.registry.fillErrors, fmt.Errorf("invalid"))
+				r := scaffold.api.Register(scaffold.runtime)
+				g.Assert(r.NoRender).Equal(true)
+				g.Assert(factory.pending.closeCount).Equal(1)
+				g.Assert(factory.pending.attached == nil).Equal(true)
+			})
+		})
+
 		g.Describe("having been able to open a websocket", func() {
 			var connection testWebsocketConnection
 
@@ -218,6 +511,109 @@ func Test_RegistrationAPI(t *testing.T) {
 					g.Assert(r.NoRender).Equal(true)
 				})
 
+				g.It("uses the id of the device an already filled registration was filled w/", func() {
+					scaffold.registry.filledID = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+					connections := make(chan device.Connection, 1)
+
+					go func() {
+						connections <- <-scaffold.stream
+					}()
+
+					scaffold.api.Register(scaffold.runtime)
+					g.Assert((<-connections).GetID()).Equal(scaffold.registry.filledID)
+				})
+
+				g.Describe("w/ a resume token from a previous connection", func() {
+					var resumes *testResumeStore
+					var connections chan device.Connection
+
+					g.BeforeEach(func() {
+						resumes = &testResumeStore{deviceID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8"}
+						scaffold.api.Resumes = resumes
+						scaffold.runtime.Header.Set(defs.APIDeviceResumeHeader, "resume-token")
+						scaffold.registry.filledID = "6ba7b811-9dad-11d1-80b4-00c04fd430c8"
+						connections = make(chan device.Connection, 1)
+
+						go func() {
+							connections <- <-scaffold.stream
+						}()
+					})
+
+					g.It("reattaches the connection to the previous device id w/o filling a registration", func() {
+						scaffold.registry.fillErrors = append(scaffold.registry.fillErrors, fmt.Errorf("not-filled"))
+						scaffold.api.Register(scaffold.runtime)
+						g.Assert((<-connections).GetID()).Equal(resumes.deviceID)
+						g.Assert(resumes.secrets).Equal([]string{string(secretValue)})
+					})
+
+					g.It("treats a device w/ an invalid resume token as a fresh registration", func() {
+						resumes.resumeErrors = append(resumes.resumeErrors, defs.Error(defs.ErrInvalidResumeToken))
+						scaffold.api.Register(scaffold.runtime)
+						g.Assert((<-connections).GetID()).Equal(scaffold.registry.filledID)
+					})
+				})
+
+				g.It("closes the connection if the filled device id is invalid", func() {
+					scaffold.registry.filledID = "not-a-uuid"
+					r := scaffold.api.Register(scaffold.runtime)
+					g.Assert(connection.closeCount).Equal(1)
+					g.Assert(r.NoRender).Equal(true)
+				})
+
+				g.Describe("with device client certificates enabled", func() {
+					present := func(key *rsa.PublicKey) {
+						certificates := []*x509.Certificate{{PublicKey: key}}
+						scaffold.runtime.TLS = &tls.ConnectionState{PeerCertificates: certificates}
+					}
+
+					g.BeforeEach(func() {
+						scaffold.api.DeviceTLSMode = defs.SecurityDeviceTLSModeRequired
+					})
+
+					g.It("accepts a certificate matching the device's shared secret", func() {
+						deviceKey, e := security.ParseDeviceKey(string(secretValue))
+						g.Assert(e).Equal(nil)
+						present(deviceKey.PublicKey)
+						connections := make(chan device.Connection, 1)
+
+						go func() {
+							connections <- <-scaffold.stream
+						}()
+
+						r := scaffold.api.Register(scaffold.runtime)
+						g.Assert(r.NoRender).Equal(true)
+						g.Assert((<-connections) != nil).Equal(true)
+					})
+
+					g.It("rejects a certificate that does not match the device's shared secret", func() {
+						other, e := rsa.GenerateKey(rand.Reader, 1024)
+						g.Assert(e).Equal(nil)
+						present(&other.PublicKey)
+						r := scaffold.api.Register(scaffold.runtime)
+						g.Assert(r.Errors[0].Error()).Equal(defs.ErrDeviceCertificateMismatch)
+						g.Assert(connection.closeCount).Equal(0)
+					})
+
+					g.It("rejects devices w/o a certificate when certificates are required", func() {
+						r := scaffold.api.Register(scaffold.runtime)
+						g.Assert(r.Errors[0].Error()).Equal(defs.ErrDeviceCertificateRequired)
+						g.Assert(connection.closeCount).Equal(0)
+					})
+
+					g.It("accepts devices w/o a certificate when certificates are optional", func() {
+						scaffold.api.DeviceTLSMode = defs.SecurityDeviceTLSModeOptional
+						connections := make(chan device.Connection, 1)
+
+						go func() {
+							connections <- <-scaffold.stream
+						}()
+
+						r := scaffold.api.Register(scaffold.runtime)
+						g.Assert(r.NoRender).Equal(true)
+						g.Assert((<-connections) != nil).Equal(true)
+					})
+				})
+
 			})
 		})
 
@@ -2,6 +2,7 @@ package routes
 
 import "time"
 import "github.com/dadleyy/beacon.api/beacon/net"
+import "github.com/dadleyy/beacon.api/beacon/defs"
 
 // SystemInfo is a simple route that prints out a success result (no errors) w/ the current time in the metadata
 func SystemInfo(runtime *net.RequestRuntime) net.HandlerResult {
@@ -11,3 +12,25 @@ func SystemInfo(runtime *net.RequestRuntime) net.HandlerResult {
 
 	return net.HandlerResult{Metadata: meta}
 }
+
+// ControlBreaker defines the interface used to report the state of the breaker guarding the device control channel.
+type ControlBreaker interface {
+	State() string
+}
+
+// SystemAPI reports the system info along w/ the state of the device control channel.
+type SystemAPI struct {
+	// Control, if provided, is the breaker whose state is reported in the system info metadata.
+	Control ControlBreaker
+}
+
+// Info prints out the system info, adding the state of the control channel breaker to the metadata.
+func (system *SystemAPI) Info(runtime *net.RequestRuntime) net.HandlerResult {
+	result := SystemInfo(runtime)
+
+	if system.Control != nil {
+		result.Metadata[defs.SystemControlStateKey] = system.Control.State()
+	}
+
+	return result
+}
@@ -5,6 +5,13 @@ import "testing"
 import "net/http/httptest"
 import "github.com/franela/goblin"
 import "github.com/dadleyy/beacon.api/beacon/net"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+type testControlBreaker string
+
+func (b testControlBreaker) State() string {
+	return string(b)
+}
 
 type systemInfoScaffold struct {
 	body    *bytes.Buffer
@@ -32,5 +39,21 @@ func Test_SystemInfoRoute(t *testing.T) {
 			_, ok := r.Metadata["time"]
 			g.Assert(ok).Equal(true)
 		})
+
+		g.Describe("SystemAPI", func() {
+			g.It("includes the state of the control channel breaker", func() {
+				system := &SystemAPI{Control: testControlBreaker(defs.CircuitBreakerOpen)}
+				r := system.Info(scaffold.runtime)
+				g.Assert(r.Metadata[defs.SystemControlStateKey]).Equal(defs.CircuitBreakerOpen)
+				_, ok := r.Metadata["time"]
+				g.Assert(ok).Equal(true)
+			})
+
+			g.It("omits the control state w/o a breaker", func() {
+				system := &SystemAPI{}
+				_, ok := system.Info(scaffold.runtime).Metadata[defs.SystemControlStateKey]
+				g.Assert(ok).Equal(false)
+			})
+		})
 	})
 }
@@ -0,0 +1,79 @@
+package routes
+
+import "github.com/dadleyy/beacon.api/beacon/net"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+
+// NewTagsAPI returns the route engine used to group devices under tags.
+func NewTagsAPI(tags device.TagStore, index device.Index, tokens device.TokenStore) *TagsAPI {
+	logger := logging.New(defs.DeviceTagsAPILogPrefix, logging.Green)
+	return &TagsAPI{logger, tags, index, tokens}
+}
+
+type tagRequest struct {
+	DeviceID string `json:"device_id"`
+	Tag      string `json:"tag"`
+}
+
+// TagsAPI route engine is responsible for tagging devices and listing the devices w/ a given tag.
+type TagsAPI struct {
+	logging.LeveledLogger
+	device.TagStore
+	device.Index
+	device.TokenStore
+}
+
+// CreateTag adds the requested tag to a device, requiring a token w/ the device's admin permission.
+func (tags *TagsAPI) CreateTag(runtime *net.RequestRuntime) net.HandlerResult {
+	request := tagRequest{}
+
+	if e := runtime.ReadBody(&request); e != nil {
+		tags.Warnf("received invalid request: %s", e.Error())
+		return runtime.LogicError(defs.ErrInvalidDeviceTag)
+	}
+
+	if defs.DeviceTagPattern.MatchString(request.Tag) != true {
+		return runtime.LogicError(defs.ErrInvalidDeviceTag)
+	}
+
+	details, e := tags.FindDevice(request.DeviceID)
+
+	if e != nil {
+		tags.Warnf("invalid device id: %s", request.DeviceID)
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	token := runtime.HeaderValue(defs.APIUserTokenHeader)
+
+	if token == "" || tags.AuthorizeToken(details.DeviceID, token, defs.SecurityDeviceTokenPermissionAdmin) != true {
+		tags.Warnf("unauthorized attempt to tag device (token: %s, device: %s)", token, details.DeviceID)
+		return runtime.LogicError(defs.ErrNotFound)
+	}
+
+	if _, e := tags.AddDeviceTag(details.DeviceID, request.Tag); e != nil {
+		tags.Errorf("unable to tag device[%s]: %s", details.DeviceID, e.Error())
+		return runtime.ServerError()
+	}
+
+	tags.Infof("tagged device[%s] w/ %s", details.DeviceID, request.Tag)
+	return net.HandlerResult{}
+}
+
+// ListTags returns the devices that have been tagged w/ the tag provided in the query string.
+func (tags *TagsAPI) ListTags(runtime *net.RequestRuntime) net.HandlerResult {
+	tag := runtime.GetQueryParam("tag")
+
+	if defs.DeviceTagPattern.MatchString(tag) != true {
+		return runtime.LogicError(defs.ErrInvalidDeviceTag)
+	}
+
+	devices, e := tags.ListDevicesByTag(tag)
+
+	if e != nil {
+		tags.Errorf("unable to list devices w/ tag %s: %s", tag, e.Error())
+		return runtime.ServerError()
+	}
+
+	return net.HandlerResult{Results: devices}
+}
@@ -0,0 +1,131 @@
+package routes
+
+import "fmt"
+import "bytes"
+import "testing"
+import "net/http/httptest"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/net"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+
+type tagsAPIScaffolding struct {
+	api    *TagsAPI
+	tags   *testTagStore
+	index  *testDeviceIndex
+	tokens *testDeviceTokenStore
+	body   *bytes.Buffer
+	url    string
+}
+
+func (s *tagsAPIScaffolding) Reset() {
+	s.tags = &testTagStore{}
+	s.index = &testDeviceIndex{}
+	s.tokens = &testDeviceTokenStore{}
+	s.body = bytes.NewBuffer([]byte{})
+	s.url = "/device-tags"
+
+	s.api = &TagsAPI{
+		LeveledLogger: newTestRouteLogger(),
+		TagStore:      s.tags,
+		Index:         s.index,
+		TokenStore:    s.tokens,
+	}
+}
+
+func (s *tagsAPIScaffolding) runtime(method string) *net.RequestRuntime {
+	request := httptest.NewRequest(method, s.url, s.body)
+	request.Header.Set(defs.APIUserTokenHeader, "some-token")
+	return &net.RequestRuntime{Request: request}
+}
+
+func Test_TagsAPI(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("CreateTag", func() {
+		s := &tagsAPIScaffolding{}
+
+		g.BeforeEach(s.Reset)
+
+		g.It("returns an error if the request body is invalid", func() {
+			fmt.Fprintf(s.body, "}{")
+			r := s.api.CreateTag(s.runtime("POST"))
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceTag)
+		})
+
+		g.It("returns an error if the tag is invalid", func() {
+			fmt.Fprintf(s.body, `{"device_id": "device-1", "tag": "Not A Tag"}`)
+			r := s.api.CreateTag(s.runtime("POST"))
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceTag)
+		})
+
+		g.Describe("with a valid request", func() {
+			g.BeforeEach(func() {
+				fmt.Fprintf(s.body, `{"device_id": "device-1", "tag": "kitchen"}`)
+			})
+
+			g.It("returns not found if unable to find the device", func() {
+				s.index.findErrors = append(s.index.findErrors, fmt.Errorf("bad-find"))
+				r := s.api.CreateTag(s.runtime("POST"))
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+			})
+
+			g.Describe("having found the device", func() {
+				g.BeforeEach(func() {
+					s.index.foundDevices = append(s.index.foundDevices, device.RegistrationDetails{DeviceID: "device-1"})
+				})
+
+				g.It("returns not found if the token is not an admin token for the device", func() {
+					r := s.api.CreateTag(s.runtime("POST"))
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+					g.Assert(s.tokens.authorizationAttempts["device-1"]["some-token"]).Equal(
+						uint(defs.SecurityDeviceTokenPermissionAdmin),
+					)
+					g.Assert(len(s.tags.added)).Equal(0)
+				})
+
+				g.It("returns a server error if unable to tag the device", func() {
+					s.tokens.authorized = true
+					s.tags.addErrors = append(s.tags.addErrors, fmt.Errorf("bad-add"))
+					r := s.api.CreateTag(s.runtime("POST"))
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+				})
+
+				g.It("tags the device if the token is authorized", func() {
+					s.tokens.authorized = true
+					r := s.api.CreateTag(s.runtime("POST"))
+					g.Assert(len(r.Errors)).Equal(0)
+					g.Assert(s.tags.added["device-1"]).Equal([]string{"kitchen"})
+				})
+			})
+		})
+	})
+
+	g.Describe("ListTags", func() {
+		s := &tagsAPIScaffolding{}
+
+		g.BeforeEach(s.Reset)
+
+		g.It("returns an error if the tag is invalid", func() {
+			r := s.api.ListTags(s.runtime("GET"))
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceTag)
+		})
+
+		g.It("returns a server error if unable to list the devices", func() {
+			s.url = "/device-tags?tag=kitchen"
+			s.tags.listErrors = append(s.tags.listErrors, fmt.Errorf("bad-list"))
+			r := s.api.ListTags(s.runtime("GET"))
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+		})
+
+		g.It("returns the devices w/ the tag", func() {
+			s.url = "/device-tags?tag=kitchen"
+			s.tags.listResults = []device.RegistrationDetails{{DeviceID: "device-1"}}
+			r := s.api.ListTags(s.runtime("GET"))
+			results, _ := r.Results.([]device.RegistrationDetails)
+			g.Assert(len(results)).Equal(1)
+			g.Assert(results[0].DeviceID).Equal("device-1")
+		})
+	})
+}
@@ -1,21 +1,36 @@
 package routes
 
 import "fmt"
+import "strconv"
+import "crypto/subtle"
 import "github.com/dadleyy/beacon.api/beacon/net"
 import "github.com/dadleyy/beacon.api/beacon/defs"
 import "github.com/dadleyy/beacon.api/beacon/device"
 import "github.com/dadleyy/beacon.api/beacon/logging"
+import "github.com/dadleyy/beacon.api/beacon/security"
 
 // NewTokensAPI inititalizes a new token api.
-func NewTokensAPI(store device.TokenStore, index device.Index) *TokensAPI {
+func NewTokensAPI(store device.TokenStore, index device.Index, audit device.AuditLog) *TokensAPI {
 	logger := logging.New(defs.TokensAPILogPrefix, logging.Green)
-	return &TokensAPI{logger, store, index}
+	return &TokensAPI{LeveledLogger: logger, TokenStore: store, Index: index, AuditLog: audit}
 }
 
 type tokenRequest struct {
-	DeviceID   string `json:"device_id"`
-	Name       string `json:"name"`
-	Permission uint   `json:"permission"`
+	DeviceID    string   `json:"device_id"`
+	Name        string   `json:"name"`
+	Permission  uint     `json:"permission"`
+	Permissions []string `json:"permissions"`
+}
+
+type introspectionRequest struct {
+	Token string `json:"token"`
+}
+
+type tokenIntrospection struct {
+	Active      bool     `json:"active"`
+	DeviceID    string   `json:"device_id,omitempty"`
+	TokenID     string   `json:"token_id,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
 }
 
 // TokensAPI defines the api for creating/deleting device auth tokens.
@@ -23,31 +38,84 @@ type TokensAPI struct {
 	logging.LeveledLogger
 	device.TokenStore
 	device.Index
+	device.AuditLog
+
+	// AdminToken is the server admin token required to list the tokens of every device; the route is disabled if empty.
+	AdminToken string
+
+	// HierarchicalPermissions, when set, normalizes requested permissions so that admin implies controller and viewer.
+	HierarchicalPermissions bool
+
+	// FilterTokensByPermission, when set, allows callers w/o the admin permission to list the tokens of a device, only
+	// returning the tokens at or below the caller's own permission level.
+	FilterTokensByPermission bool
+
+	// Idempotency, if provided, records the token created for requests w/ an idempotency key so that retried requests
+	// return the original token rather than creating another.
+	Idempotency device.TokenIdempotencyStore
 }
 
 // CreateToken authenticates the incoming request and attempts to allocate a new auth token.
 func (tokens *TokensAPI) CreateToken(requestRuntime *net.RequestRuntime) net.HandlerResult {
 	request := tokenRequest{}
 
-	if e := requestRuntime.ReadBody(&request); e != nil {
+	e := requestRuntime.ReadBody(&request)
+
+	if e == defs.Error(defs.ErrRequestTooLarge) {
+		tokens.Warnf("token request body too large")
+		return requestRuntime.LogicError(defs.ErrRequestTooLarge)
+	}
+
+	if e != nil {
 		tokens.Warnf("received invalid request: %s", e.Error())
 		return requestRuntime.LogicError(defs.ErrInvalidTokenRequest)
 	}
 
-	if request.Permission&defs.SecurityDeviceTokenPermissionAll == 0 {
-		tokens.Infof("no permission found - defaulting to viewer")
-		request.Permission = defs.SecurityDeviceTokenPermissionViewer
+	named, e := security.ParsePermissions(request.Permissions)
+
+	if e != nil {
+		tokens.Warnf("received invalid permission names: %v", request.Permissions)
+		return requestRuntime.ValidationError(defs.ErrInvalidTokenPermission, net.FieldErrors{
+			"permissions": defs.ValidationUnknownPermission,
+		})
+	}
+
+	request.Permission |= named
+
+	// Bits outside of the known permissions are rejected rather than being persisted alongside the known ones.
+	if request.Permission&^defs.SecurityDeviceTokenPermissionAll != 0 {
+		tokens.Warnf("received permission mask w/ unknown bits: %b", request.Permission)
+		return requestRuntime.ValidationError(defs.ErrInvalidTokenPermission, net.FieldErrors{
+			"permission": defs.ValidationUnknownPermission,
+		})
 	}
 
+	// The normalized mask is what gets stored and checked for escalation; the response lists its formatted names.
+	request.Permission = security.NormalizePermissions(request.Permission, tokens.HierarchicalPermissions)
+
 	if (len(request.Name) >= defs.SecurityUserDeviceNameMinLength) != true {
-		return requestRuntime.LogicError(defs.ErrInvalidDeviceTokenName)
+		return requestRuntime.ValidationError(defs.ErrInvalidDeviceTokenName, net.FieldErrors{
+			"name": defs.ValidationTooShort,
+		})
+	}
+
+	idempotencyKey := requestRuntime.HeaderValue(defs.APIIdempotencyKeyHeader)
+
+	if idempotencyKey != "" && defs.IdempotencyKeyPattern.MatchString(idempotencyKey) != true {
+		tokens.Warnf("received invalid idempotency key")
+		return requestRuntime.LogicError(defs.ErrInvalidIdempotencyKey)
+	}
+
+	// Group tokens are not bound to any single device's shared secret; only the server admin token may create them.
+	if _, group := device.GroupTag(request.DeviceID); group {
+		return tokens.createGroup(requestRuntime, request, idempotencyKey)
 	}
 
 	registration, e := tokens.FindDevice(request.DeviceID)
 
 	if e != nil {
 		tokens.Warnf("unable to find device (device id: %s): %s", request.DeviceID, e.Error())
-		return requestRuntime.LogicError(defs.ErrNotFound)
+		return requestRuntime.LookupError(e)
 	}
 
 	token := requestRuntime.HeaderValue(defs.APIUserTokenHeader)
@@ -63,8 +131,28 @@ func (tokens *TokensAPI) CreateToken(requestRuntime *net.RequestRuntime) net.Han
 		return requestRuntime.LogicError(defs.ErrInvalidTokenRequest)
 	}
 
+	// Only the device's shared secret may grant any permission; other tokens may only grant permissions they hold.
+	if token != registration.SharedSecret {
+		creator, e := tokens.FindToken(token)
+
+		if e == defs.Error(defs.ErrNotFound) {
+			tokens.Warnf("unable to find authorized token (device: %s)", registration.DeviceID)
+			return requestRuntime.LogicError(defs.ErrInvalidTokenRequest)
+		}
+
+		if e != nil {
+			tokens.Errorf("unable to load authorized token (device: %s): %s", registration.DeviceID, e.Error())
+			return requestRuntime.ServerError()
+		}
+
+		if security.Escalates(request.Permission, creator.Permission, tokens.HierarchicalPermissions) {
+			tokens.Warnf("token %s attempted to grant %b (holds %b)", creator.TokenID, request.Permission, creator.Permission)
+			return requestRuntime.LogicError(defs.ErrPermissionEscalation)
+		}
+	}
+
 	tokens.Debugf("creating device token for device %s (permission: %b)", registration.DeviceID, request.Permission)
-	return tokens.create(registration.DeviceID, request.Name, request.Permission)
+	return tokens.create(requestRuntime, registration.DeviceID, request, token, idempotencyKey)
 }
 
 // ListTokens returns a set tokens based on the device id provided.
@@ -85,12 +173,14 @@ func (tokens *TokensAPI) ListTokens(requestRuntime *net.RequestRuntime) net.Hand
 	registration, e := tokens.FindDevice(id)
 
 	if e != nil {
-		return requestRuntime.LogicError(defs.ErrNotFound)
+		tokens.Warnf("unable to find device (device id: %s): %s", id, e.Error())
+		return requestRuntime.LookupError(e)
 	}
 
-	// Attempt to authorize the provided token against the admin permission.
-	if tokens.AuthorizeToken(registration.DeviceID, token, defs.SecurityDeviceTokenPermissionAdmin) != true {
-		tokens.Warnf("unauthorized attempt to create token (token: %s, device: %s)", token, registration.DeviceID)
+	visible, authorized := tokens.visiblePermissions(registration.DeviceID, token)
+
+	if authorized != true {
+		tokens.Warnf("unauthorized attempt to list tokens (token: %s, device: %s)", token, registration.DeviceID)
 		return requestRuntime.LogicError(defs.ErrNotFound)
 	}
 
@@ -101,18 +191,245 @@ func (tokens *TokensAPI) ListTokens(requestRuntime *net.RequestRuntime) net.Hand
 		return requestRuntime.ServerError()
 	}
 
-	return net.HandlerResult{Results: deviceTokens}
+	results := make([]device.TokenDetails, 0, len(deviceTokens))
+
+	for _, details := range deviceTokens {
+		if details.Permission&^visible != 0 {
+			continue
+		}
+
+		details.Permissions = security.FormatPermissions(details.Permission)
+		results = append(results, details)
+	}
+
+	return net.HandlerResult{Results: results}
 }
 
-func (tokens *TokensAPI) create(deviceID, name string, permission uint) net.HandlerResult {
-	token, e := tokens.TokenStore.CreateToken(deviceID, name, permission)
+// visiblePermissions returns the permissions of the tokens the caller may list, along w/ whether the caller may list
+// tokens at all. Admins (and the device's shared secret) see every token; w/ filtering enabled any other caller w/
+// access to the device sees the tokens w/in the (expanded) permissions of their own token.
+func (tokens *TokensAPI) visiblePermissions(deviceID, token string) (uint, bool) {
+	if tokens.AuthorizeToken(deviceID, token, defs.SecurityDeviceTokenPermissionAdmin) {
+		return defs.SecurityDeviceTokenPermissionAll, true
+	}
+
+	if tokens.FilterTokensByPermission != true {
+		return 0, false
+	}
+
+	caller, e := tokens.FindToken(token)
+
+	if e != nil || caller.Permission == 0 {
+		return 0, false
+	}
+
+	if tokens.AuthorizeToken(deviceID, token, caller.Permission) != true {
+		return 0, false
+	}
+
+	return security.ExpandPermissions(caller.Permission), true
+}
+
+// ListAllTokens returns the tokens of every device, requiring the server admin token. The amount of tokens returned is
+// capped by the `limit` query param.
+func (tokens *TokensAPI) ListAllTokens(requestRuntime *net.RequestRuntime) net.HandlerResult {
+	token := requestRuntime.HeaderValue(defs.APIUserTokenHeader)
+
+	if tokens.authorizeAdmin(token) != true {
+		tokens.Warnf("unauthorized attempt to list all tokens")
+		return requestRuntime.LogicError(defs.ErrNotFound)
+	}
+
+	limit, e := strconv.Atoi(requestRuntime.GetQueryParam("limit"))
+
+	if e != nil || limit < 1 {
+		limit = defs.DefaultTokenListLimit
+	}
+
+	if limit > defs.MaxTokenListLimit {
+		limit = defs.MaxTokenListLimit
+	}
+
+	allTokens, e := tokens.TokenStore.ListAllTokens(limit)
+
+	if e != nil {
+		tokens.Errorf("unable to list all tokens: %s", e.Error())
+		return requestRuntime.ServerError()
+	}
+
+	for i, details := range allTokens {
+		allTokens[i].Permissions = security.FormatPermissions(details.Permission)
+	}
+
+	return net.HandlerResult{Results: allTokens}
+}
+
+// Introspect reports whether the token in the request body is active, along w/ its device and permission names.
+// The request must carry the server admin token so the route can not be used to probe for tokens anonymously.
+func (tokens *TokensAPI) Introspect(requestRuntime *net.RequestRuntime) net.HandlerResult {
+	if tokens.authorizeAdmin(requestRuntime.HeaderValue(defs.APIUserTokenHeader)) != true {
+		tokens.Warnf("unauthorized attempt to introspect token")
+		return requestRuntime.LogicError(defs.ErrNotFound)
+	}
+
+	request := introspectionRequest{}
+
+	if e := requestRuntime.ReadBody(&request); e != nil || request.Token == "" {
+		return requestRuntime.LogicError(defs.ErrInvalidTokenRequest)
+	}
+
+	details, e := tokens.FindToken(request.Token)
+
+	if e == defs.Error(defs.ErrNotFound) {
+		tokens.Debugf("introspected inactive token")
+		return net.HandlerResult{Results: tokenIntrospection{Active: false}}
+	}
+
+	if e != nil {
+		tokens.Errorf("unable to introspect token: %s", e.Error())
+		return requestRuntime.ServerError()
+	}
+
+	result := tokenIntrospection{
+		Active:      true,
+		DeviceID:    details.DeviceID,
+		TokenID:     details.TokenID,
+		Permissions: security.FormatPermissions(details.Permission),
+	}
+
+	return net.HandlerResult{Results: result}
+}
+
+// authorizeAdmin compares the token against the server admin token in constant time.
+func (tokens *TokensAPI) authorizeAdmin(token string) bool {
+	return authorizeAdmin(tokens.AdminToken, token)
+}
+
+// authorizeAdmin compares the token against the configured server admin token in constant time, failing if either is
+// empty.
+func authorizeAdmin(adminToken, token string) bool {
+	if adminToken == "" || token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// createGroup allocates a token scoped to every device w/ the tag referenced by the request's group id, requiring the
+// server admin token.
+func (tokens *TokensAPI) createGroup(
+	requestRuntime *net.RequestRuntime,
+	request tokenRequest,
+	idempotencyKey string,
+) net.HandlerResult {
+	token := requestRuntime.HeaderValue(defs.APIUserTokenHeader)
+
+	if tokens.authorizeAdmin(token) != true {
+		tokens.Warnf("unauthorized attempt to create group token (group: %s)", request.DeviceID)
+		return requestRuntime.LogicError(defs.ErrInvalidTokenRequest)
+	}
+
+	tokens.Debugf("creating group token for %s (permission: %b)", request.DeviceID, request.Permission)
+	return tokens.create(requestRuntime, request.DeviceID, request, token, idempotencyKey)
+}
+
+// create allocates the token for the device, returning the token previously created w/ the idempotency key if any.
+func (tokens *TokensAPI) create(
+	requestRuntime *net.RequestRuntime,
+	deviceID string,
+	request tokenRequest,
+	actor, idempotencyKey string,
+) net.HandlerResult {
+	idempotent := idempotencyKey != "" && tokens.Idempotency != nil
+
+	if idempotent {
+		previous, e := tokens.Idempotency.RecallToken(deviceID, idempotencyKey)
+
+		if e == nil && (previous.Name != request.Name || previous.Permission != request.Permission) {
+			tokens.Warnf("idempotency key reused w/ a different token request (device: %s)", deviceID)
+			return requestRuntime.LogicError(defs.ErrIdempotencyKeyReused)
+		}
+
+		if e == nil {
+			tokens.Infof("returning token %s previously created w/ idempotency key", previous.TokenID)
+			return tokens.reveal(previous)
+		}
+
+		if e == defs.Error(defs.ErrNotFound) {
+			e = tokens.Idempotency.ReserveToken(deviceID, idempotencyKey)
+		}
+
+		// Concurrent requests w/ the same key are turned away until the request holding the reservation finishes.
+		if e == defs.Error(defs.ErrIdempotencyKeyPending) {
+			tokens.Warnf("idempotency key still pending for another token request (device: %s)", deviceID)
+			return requestRuntime.LogicError(defs.ErrIdempotencyKeyPending)
+		}
+
+		if e != nil {
+			tokens.Errorf("unable to reserve idempotent token (device: %s): %s", deviceID, e.Error())
+			return requestRuntime.ServerError()
+		}
+	}
+
+	token, e := tokens.TokenStore.CreateToken(deviceID, request.Name, request.Permission)
+
+	if e != nil && idempotent {
+		if e := tokens.Idempotency.ReleaseToken(deviceID, idempotencyKey); e != nil {
+			tokens.Warnf("unable to release idempotency key (device: %s): %s", deviceID, e.Error())
+		}
+	}
+
+	if e == defs.Error(defs.ErrTokenLimitReached) {
+		tokens.Warnf("token limit reached for device: %s", deviceID)
+		return net.HandlerResult{Errors: []error{e}}
+	}
+
+	if e == defs.Error(defs.ErrDuplicateTokenName) {
+		tokens.Warnf("duplicate token name for device: %s", deviceID)
+		return net.HandlerResult{Errors: []error{e}}
+	}
+
+	if e == defs.Error(defs.ErrInvalidTokenPermission) {
+		tokens.Warnf("invalid token permission for device: %s (%b)", deviceID, request.Permission)
+		return requestRuntime.ValidationError(defs.ErrInvalidTokenPermission, net.FieldErrors{
+			"permission": defs.ValidationUnknownPermission,
+		})
+	}
 
 	if e != nil {
 		tokens.Warnf("unable to create token: %s (got %v)", e.Error(), token)
 		return net.HandlerResult{Errors: []error{fmt.Errorf("server-error")}}
 	}
 
-	tokens.Debugf("created token: %v", token)
+	tokens.Debugf("created token: %s", token.TokenID)
+	tokens.audit(defs.AuditTokenCreatedAction, deviceID, token.TokenID, actor)
+
+	// The token has already been created; failing to record it only means a retried request will create another.
+	if idempotent {
+		if e := tokens.Idempotency.RememberToken(deviceID, idempotencyKey, token); e != nil {
+			tokens.Warnf("unable to record idempotent token %s: %s", token.TokenID, e.Error())
+		}
+	}
 
+	return tokens.reveal(token)
+}
+
+// reveal renders the token w/ the names of its permissions and its raw value. The raw token is only ever sent to the
+// client in the response to its creation (or to retries of the request that created it).
+func (tokens *TokensAPI) reveal(token device.TokenDetails) net.HandlerResult {
+	token.Permissions, token.Reveal = security.FormatPermissions(token.Permission), true
 	return net.HandlerResult{Results: []device.TokenDetails{token}}
 }
+
+// audit records the action in the audit log along w/ the id of the token that was used to authorize it.
+func (tokens *TokensAPI) audit(action, deviceID, tokenID, actor string) {
+	entry := device.AuditEntry{Action: action, DeviceID: deviceID, TokenID: tokenID}
+
+	if details, e := tokens.FindToken(actor); e == nil {
+		entry.ActorID = details.TokenID
+	}
+
+	if e := tokens.RecordAudit(entry); e != nil {
+		tokens.Warnf("unable to record audit entry (action: %s, device: %s): %s", action, deviceID, e.Error())
+	}
+}
@@ -2,9 +2,11 @@ package routes
 
 import "fmt"
 import "bytes"
+import "strings"
 import "testing"
 import "crypto/rand"
 import "encoding/hex"
+import "encoding/json"
 import "net/http/httptest"
 import "github.com/franela/goblin"
 import "github.com/dadleyy/beacon.api/beacon/net"
@@ -15,6 +17,7 @@ type tokensAPIScaffolding struct {
 	api     *TokensAPI
 	store   *testDeviceTokenStore
 	index   *testDeviceIndex
+	audit   *testAuditLog
 	runtime *net.RequestRuntime
 	body    *bytes.Buffer
 }
@@ -24,6 +27,7 @@ func (t *tokensAPIScaffolding) Reset() {
 
 	t.store = &testDeviceTokenStore{}
 	t.index = &testDeviceIndex{}
+	t.audit = &testAuditLog{}
 
 	t.body = bytes.NewBuffer([]byte{})
 
@@ -35,6 +39,7 @@ func (t *tokensAPIScaffolding) Reset() {
 		LeveledLogger: logger,
 		TokenStore:    t.store,
 		Index:         t.index,
+		AuditLog:      t.audit,
 	}
 }
 
@@ -72,11 +77,17 @@ func Test_TokensAPI(suite *testing.T) {
 				})
 
 				g.It("fails without finding a device associated with the id in the query string", func() {
-					scaffold.index.findErrors = append(scaffold.index.findErrors, fmt.Errorf("bad-find"))
+					scaffold.index.findErrors = append(scaffold.index.findErrors, defs.Error(defs.ErrNotFound))
 					r := scaffold.api.ListTokens(scaffold.runtime)
 					g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
 				})
 
+				g.It("fails w/ a server error if the device lookup itself fails", func() {
+					scaffold.index.findErrors = append(scaffold.index.findErrors, fmt.Errorf("bad-find"))
+					r := scaffold.api.ListTokens(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+				})
+
 				g.It("fails if unauthorized attempt", func() {
 					scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
 					r := scaffold.api.ListTokens(scaffold.runtime)
@@ -102,27 +113,268 @@ func Test_TokensAPI(suite *testing.T) {
 						g.Assert(len(r.Errors)).Equal(0)
 					})
 
+					g.It("includes the names of each token's permissions", func() {
+						scaffold.store.listedTokens = append(scaffold.store.listedTokens, device.TokenDetails{
+							Permission: defs.SecurityDeviceTokenPermissionViewer | defs.SecurityDeviceTokenPermissionAdmin,
+						})
+						r := scaffold.api.ListTokens(scaffold.runtime)
+						results, _ := r.Results.([]device.TokenDetails)
+						g.Assert(results[0].Permissions).Equal([]string{"viewer", "admin"})
+					})
+
+					g.It("never includes the raw token in the encoded response", func() {
+						scaffold.store.listedTokens = append(scaffold.store.listedTokens, device.TokenDetails{
+							TokenID: "token-id",
+							Token:   "raw-secret-token",
+						})
+						r := scaffold.api.ListTokens(scaffold.runtime)
+						encoded, e := json.Marshal(r.Results)
+						g.Assert(e).Equal(nil)
+						g.Assert(strings.Contains(string(encoded), "raw-secret-token")).Equal(false)
+						g.Assert(strings.Contains(string(encoded), "token-id")).Equal(true)
+					})
+
 				})
 
+				g.Describe("with permission filtering", func() {
+					viewer := device.TokenDetails{TokenID: "viewer", Permission: defs.SecurityDeviceTokenPermissionViewer}
+					controller := device.TokenDetails{
+						TokenID:    "controller",
+						Permission: defs.SecurityDeviceTokenPermissionController,
+					}
+					admin := device.TokenDetails{TokenID: "admin", Permission: defs.SecurityDeviceTokenPermissionAdmin}
+
+					listed := func() []string {
+						r := scaffold.api.ListTokens(scaffold.runtime)
+						g.Assert(len(r.Errors)).Equal(0)
+						ids := []string{}
+
+						for _, details := range r.Results.([]device.TokenDetails) {
+							ids = append(ids, details.TokenID)
+						}
+
+						return ids
+					}
+
+					g.BeforeEach(func() {
+						scaffold.api.FilterTokensByPermission = true
+						scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
+						scaffold.store.listedTokens = []device.TokenDetails{viewer, controller, admin}
+					})
+
+					g.It("returns every token to an admin caller", func() {
+						scaffold.store.authorized = true
+						g.Assert(listed()).Equal([]string{"viewer", "controller", "admin"})
+					})
+
+					g.It("returns only the viewer and controller tokens to a controller caller", func() {
+						scaffold.store.authorizedPermission = defs.SecurityDeviceTokenPermissionController
+						scaffold.store.foundTokens = []device.TokenDetails{controller}
+						g.Assert(listed()).Equal([]string{"viewer", "controller"})
+					})
+
+					g.It("returns only the viewer tokens to a viewer caller", func() {
+						scaffold.store.authorizedPermission = defs.SecurityDeviceTokenPermissionViewer
+						scaffold.store.foundTokens = []device.TokenDetails{viewer}
+						g.Assert(listed()).Equal([]string{"viewer"})
+					})
+
+					g.It("fails if the caller's token is not authorized for the device", func() {
+						scaffold.store.foundTokens = []device.TokenDetails{controller}
+						r := scaffold.api.ListTokens(scaffold.runtime)
+						g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+					})
+
+					g.It("only allows admin callers when disabled", func() {
+						scaffold.api.FilterTokensByPermission = false
+						scaffold.store.authorizedPermission = defs.SecurityDeviceTokenPermissionController
+						scaffold.store.foundTokens = []device.TokenDetails{controller}
+						r := scaffold.api.ListTokens(scaffold.runtime)
+						g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+					})
+				})
+
+			})
+
+		})
+
+	})
+
+	g.Describe("ListAllTokens", func() {
+
+		g.BeforeEach(func() {
+			scaffold.Reset()
+			scaffold.api.AdminToken = "server-admin-token"
+			scaffold.runtime = &net.RequestRuntime{
+				Request: httptest.NewRequest("GET", "/device-tokens/all", scaffold.body),
+			}
+		})
+
+		g.It("fails without the server admin token", func() {
+			r := scaffold.api.ListAllTokens(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.It("fails w/ a token other than the server admin token", func() {
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
+			r := scaffold.api.ListAllTokens(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.It("fails when no server admin token has been configured", func() {
+			scaffold.api.AdminToken = ""
+			scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "")
+			r := scaffold.api.ListAllTokens(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
+		})
+
+		g.Describe("w/ the server admin token", func() {
+			g.BeforeEach(func() {
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "server-admin-token")
+			})
+
+			g.It("fails if unable to list the tokens", func() {
+				scaffold.store.listedErrors = append(scaffold.store.listedErrors, fmt.Errorf("bad-list"))
+				r := scaffold.api.ListAllTokens(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
 			})
 
+			g.It("returns the tokens of every device", func() {
+				scaffold.store.listedTokens = []device.TokenDetails{
+					{DeviceID: "device-1", Permission: defs.SecurityDeviceTokenPermissionViewer},
+					{DeviceID: "device-2", Permission: defs.SecurityDeviceTokenPermissionAdmin},
+				}
+				r := scaffold.api.ListAllTokens(scaffold.runtime)
+				results, _ := r.Results.([]device.TokenDetails)
+				g.Assert(len(results)).Equal(2)
+				g.Assert(results[1].Permissions).Equal([]string{"admin"})
+				g.Assert(scaffold.store.listedLimits).Equal([]int{defs.DefaultTokenListLimit})
+			})
+
+			g.It("uses the limit from the query string, capped at the maximum", func() {
+				scaffold.runtime.URL.RawQuery = "limit=10"
+				scaffold.api.ListAllTokens(scaffold.runtime)
+				scaffold.runtime.URL.RawQuery = "limit=100000"
+				scaffold.api.ListAllTokens(scaffold.runtime)
+				g.Assert(scaffold.store.listedLimits).Equal([]int{10, defs.MaxTokenListLimit})
+			})
+		})
+	})
+
+	g.Describe("Introspect", func() {
+
+		g.BeforeEach(func() {
+			scaffold.Reset()
+			scaffold.api.AdminToken = "server-admin-token"
+			scaffold.runtime = &net.RequestRuntime{
+				Request: httptest.NewRequest("POST", "/introspect", scaffold.body),
+			}
+			scaffold.body.Write([]byte(`{"token": "some-token"}`))
+		})
+
+		g.It("fails without the server admin token", func() {
+			scaffold.store.foundTokens = []device.TokenDetails{{TokenID: "token-1"}}
+			r := scaffold.api.Introspect(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
 		})
 
+		g.Describe("w/ the server admin token", func() {
+			g.BeforeEach(func() {
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "server-admin-token")
+			})
+
+			g.It("fails if no token was provided in the request body", func() {
+				scaffold.body.Reset()
+				scaffold.body.Write([]byte(`{}`))
+				r := scaffold.api.Introspect(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidTokenRequest)
+			})
+
+			g.It("reports an unknown token as inactive", func() {
+				r := scaffold.api.Introspect(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				g.Assert(r.Results).Equal(tokenIntrospection{Active: false})
+			})
+
+			g.It("fails w/ a server error rather than reporting the token inactive if the lookup itself fails", func() {
+				scaffold.store.findErrors = append(scaffold.store.findErrors, fmt.Errorf("bad-find"))
+				r := scaffold.api.Introspect(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			})
+
+			g.It("reports an active token w/ its device and permission names", func() {
+				scaffold.store.foundTokens = []device.TokenDetails{{
+					TokenID:    "token-1",
+					DeviceID:   "device-1",
+					Permission: defs.SecurityDeviceTokenPermissionViewer,
+				}}
+				r := scaffold.api.Introspect(scaffold.runtime)
+				result, _ := r.Results.(tokenIntrospection)
+				g.Assert(result.Active).Equal(true)
+				g.Assert(result.DeviceID).Equal("device-1")
+				g.Assert(result.TokenID).Equal("token-1")
+				g.Assert(result.Permissions).Equal([]string{"viewer"})
+			})
+		})
 	})
 
 	g.Describe("CreateToken", func() {
 
 		g.BeforeEach(scaffold.Reset)
 
+		g.Describe("w/ a group id in the request", func() {
+			group := defs.SecurityDeviceGroupPrefix + "kitchen"
+
+			g.BeforeEach(func() {
+				scaffold.api.AdminToken = "server-admin-token"
+				scaffold.body.Write([]byte(fmt.Sprintf(`{"device_id": "%s", "name": "kitchen lights"}`, group)))
+			})
+
+			g.It("fails w/o the server admin token", func() {
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-device-token")
+				r := scaffold.api.CreateToken(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidTokenRequest)
+				g.Assert(len(scaffold.store.createdPermissions)).Equal(0)
+			})
+
+			g.It("creates the group token w/ the server admin token w/o looking up a device", func() {
+				scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "server-admin-token")
+				scaffold.store.createdTokens = append(scaffold.store.createdTokens, device.TokenDetails{DeviceID: group})
+				r := scaffold.api.CreateToken(scaffold.runtime)
+				g.Assert(len(r.Errors)).Equal(0)
+				results, _ := r.Results.([]device.TokenDetails)
+				g.Assert(results[0].DeviceID).Equal(group)
+			})
+		})
+
 		g.It("fails with an invalid request body", func() {
 			r := scaffold.api.CreateToken(scaffold.runtime)
 			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidTokenRequest)
 		})
 
+		g.It("fails w/ a distinct error when the request body is too large", func() {
+			scaffold.body.Write([]byte(fmt.Sprintf(`{"name": "%s"}`, strings.Repeat("a", defs.DefaultMaxRequestBodySize))))
+			r := scaffold.api.CreateToken(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrRequestTooLarge)
+		})
+
 		g.It("fails if the request's name value is invalid", func() {
 			scaffold.body.Write([]byte(`{}`))
 			r := scaffold.api.CreateToken(scaffold.runtime)
 			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceTokenName)
+			g.Assert(r.Fields).Equal(net.FieldErrors{"name": defs.ValidationTooShort})
+		})
+
+		g.It("applies the token name length rule at its boundary", func() {
+			name := strings.Repeat("a", defs.SecurityUserDeviceNameMinLength)
+			scaffold.body.Write([]byte(fmt.Sprintf(`{"name": "%s"}`, name[1:])))
+			r := scaffold.api.CreateToken(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidDeviceTokenName)
+			scaffold.body.Reset()
+			scaffold.body.Write([]byte(fmt.Sprintf(`{"name": "%s"}`, name)))
+			scaffold.index.findErrors = append(scaffold.index.findErrors, defs.Error(defs.ErrNotFound))
+			r = scaffold.api.CreateToken(scaffold.runtime)
+			g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
 		})
 
 		g.Describe("with a valid name field", func() {
@@ -135,11 +387,17 @@ func Test_TokensAPI(suite *testing.T) {
 			})
 
 			g.It("fails if it is unable to find the device associated with the request", func() {
-				scaffold.index.findErrors = append(scaffold.index.findErrors, fmt.Errorf("bad-find"))
+				scaffold.index.findErrors = append(scaffold.index.findErrors, defs.Error(defs.ErrNotFound))
 				r := scaffold.api.CreateToken(scaffold.runtime)
 				g.Assert(r.Errors[0].Error()).Equal(defs.ErrNotFound)
 			})
 
+			g.It("fails w/ a server error if the device lookup itself fails", func() {
+				scaffold.index.findErrors = append(scaffold.index.findErrors, fmt.Errorf("bad-find"))
+				r := scaffold.api.CreateToken(scaffold.runtime)
+				g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+			})
+
 			g.It("fails if no token was provided in the header", func() {
 				scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{})
 				r := scaffold.api.CreateToken(scaffold.runtime)
@@ -158,7 +416,8 @@ func Test_TokensAPI(suite *testing.T) {
 					scaffold.body.Write([]byte(json))
 					scaffold.runtime.Header.Set(defs.APIUserTokenHeader, "some-token")
 					scaffold.index.foundDevices = append(scaffold.index.foundDevices, device.RegistrationDetails{
-						DeviceID: deviceID,
+						DeviceID:     deviceID,
+						SharedSecret: "some-token",
 					})
 				})
 
@@ -176,6 +435,23 @@ func Test_TokensAPI(suite *testing.T) {
 					scaffold.store.authorized = true
 					r := scaffold.api.CreateToken(scaffold.runtime)
 					g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+					g.Assert(len(scaffold.audit.recorded)).Equal(0)
+				})
+
+				g.It("returns the limit error when the device has reached its max token count", func() {
+					scaffold.store.authorized = true
+					scaffold.store.creationErrors = append(scaffold.store.creationErrors, defs.Error(defs.ErrTokenLimitReached))
+					r := scaffold.api.CreateToken(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrTokenLimitReached)
+					g.Assert(len(scaffold.audit.recorded)).Equal(0)
+				})
+
+				g.It("returns the duplicate name error when the device already has a token w/ the name", func() {
+					scaffold.store.authorized = true
+					scaffold.store.creationErrors = append(scaffold.store.creationErrors, defs.Error(defs.ErrDuplicateTokenName))
+					r := scaffold.api.CreateToken(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrDuplicateTokenName)
+					g.Assert(len(scaffold.audit.recorded)).Equal(0)
 				})
 
 				g.It("succeeds if it is unable to create the token", func() {
@@ -184,6 +460,316 @@ func Test_TokensAPI(suite *testing.T) {
 					r := scaffold.api.CreateToken(scaffold.runtime)
 					g.Assert(len(r.Errors)).Equal(0)
 				})
+
+				g.It("includes the raw token exactly once in the encoded response", func() {
+					scaffold.store.authorized = true
+					scaffold.store.createdTokens = append(scaffold.store.createdTokens, device.TokenDetails{
+						TokenID: "token-id",
+						Token:   "raw-secret-token",
+					})
+					r := scaffold.api.CreateToken(scaffold.runtime)
+					encoded, e := json.Marshal(r.Results)
+					g.Assert(e).Equal(nil)
+					g.Assert(strings.Count(string(encoded), "raw-secret-token")).Equal(1)
+				})
+
+				g.It("fails if any of the requested permission names are unknown", func() {
+					json := `{"name": "some-token-name", "device_id": "some-device", "permissions": ["viewer", "root"]}`
+					scaffold.body.Reset()
+					scaffold.body.Write([]byte(json))
+					scaffold.store.authorized = true
+					r := scaffold.api.CreateToken(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidTokenPermission)
+					g.Assert(r.Fields).Equal(net.FieldErrors{"permissions": defs.ValidationUnknownPermission})
+					g.Assert(len(scaffold.store.createdPermissions)).Equal(0)
+				})
+
+				g.It("fails if the requested permission mask has bits outside of the known permissions", func() {
+					json := `{"name": "some-token-name", "device_id": "some-device", "permission": 9}`
+					scaffold.body.Reset()
+					scaffold.body.Write([]byte(json))
+					scaffold.store.authorized = true
+					r := scaffold.api.CreateToken(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidTokenPermission)
+					g.Assert(r.Fields).Equal(net.FieldErrors{"permission": defs.ValidationUnknownPermission})
+					g.Assert(len(scaffold.store.createdPermissions)).Equal(0)
+				})
+
+				g.It("creates the token w/ a numeric permission mask within the known permissions", func() {
+					json := `{"name": "some-token-name", "device_id": "some-device", "permission": 3}`
+					scaffold.body.Reset()
+					scaffold.body.Write([]byte(json))
+					scaffold.store.authorized = true
+					scaffold.store.createdTokens = append(scaffold.store.createdTokens, device.TokenDetails{Permission: 3})
+					r := scaffold.api.CreateToken(scaffold.runtime)
+					g.Assert(len(r.Errors)).Equal(0)
+					g.Assert(scaffold.store.createdPermissions).Equal([]uint{3})
+				})
+
+				g.It("returns a validation error if the store rejects the permission", func() {
+					scaffold.store.authorized = true
+					invalid := defs.Error(defs.ErrInvalidTokenPermission)
+					scaffold.store.creationErrors = append(scaffold.store.creationErrors, invalid)
+					r := scaffold.api.CreateToken(scaffold.runtime)
+					g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidTokenPermission)
+					g.Assert(r.Fields).Equal(net.FieldErrors{"permission": defs.ValidationUnknownPermission})
+				})
+
+				g.It("translates the requested permission names into the permission mask", func() {
+					json := `{"name": "some-token-name", "device_id": "some-device", "permissions": ["controller", "viewer"]}`
+					scaffold.body.Reset()
+					scaffold.body.Write([]byte(json))
+					scaffold.store.authorized = true
+					scaffold.store.createdTokens = append(scaffold.store.createdTokens, device.TokenDetails{
+						Permission: defs.SecurityDeviceTokenPermissionController | defs.SecurityDeviceTokenPermissionViewer,
+					})
+					r := scaffold.api.CreateToken(scaffold.runtime)
+					g.Assert(scaffold.store.createdPermissions).Equal([]uint{
+						defs.SecurityDeviceTokenPermissionController | defs.SecurityDeviceTokenPermissionViewer,
+					})
+					results, _ := r.Results.([]device.TokenDetails)
+					g.Assert(results[0].Permissions).Equal([]string{"viewer", "controller"})
+				})
+
+				g.Describe("w/ hierarchical permissions", func() {
+					g.BeforeEach(func() {
+						scaffold.api.HierarchicalPermissions = true
+						scaffold.store.authorized = true
+						scaffold.store.createdTokens = append(scaffold.store.createdTokens, device.TokenDetails{
+							Permission: defs.SecurityDeviceTokenPermissionAll,
+						})
+					})
+
+					g.It("normalizes an admin only request to admin, controller and viewer", func() {
+						json := `{"name": "some-token-name", "device_id": "some-device", "permissions": ["admin"]}`
+						scaffold.body.Reset()
+						scaffold.body.Write([]byte(json))
+						r := scaffold.api.CreateToken(scaffold.runtime)
+						g.Assert(scaffold.store.createdPermissions).Equal([]uint{defs.SecurityDeviceTokenPermissionAll})
+						results, _ := r.Results.([]device.TokenDetails)
+						g.Assert(results[0].Permissions).Equal([]string{"viewer", "controller", "admin"})
+					})
+
+					g.It("normalizes a raw numeric admin permission", func() {
+						json := fmt.Sprintf(`{"name": "some-token-name", "device_id": "some-device", "permission": %d}`,
+							defs.SecurityDeviceTokenPermissionAdmin)
+						scaffold.body.Reset()
+						scaffold.body.Write([]byte(json))
+						scaffold.api.CreateToken(scaffold.runtime)
+						g.Assert(scaffold.store.createdPermissions).Equal([]uint{defs.SecurityDeviceTokenPermissionAll})
+					})
+				})
+
+				g.It("stores the requested permission as-is w/o hierarchical permissions", func() {
+					json := fmt.Sprintf(`{"name": "some-token-name", "device_id": "some-device", "permission": %d}`,
+						defs.SecurityDeviceTokenPermissionAdmin)
+					scaffold.body.Reset()
+					scaffold.body.Write([]byte(json))
+					scaffold.store.authorized = true
+					scaffold.store.createdTokens = append(scaffold.store.createdTokens, device.TokenDetails{})
+					scaffold.api.CreateToken(scaffold.runtime)
+					g.Assert(scaffold.store.createdPermissions).Equal([]uint{defs.SecurityDeviceTokenPermissionAdmin})
+				})
+
+				g.It("records a single audit entry w/ the id of the token used to create it", func() {
+					scaffold.store.authorized = true
+					scaffold.store.createdTokens = append(scaffold.store.createdTokens, device.TokenDetails{
+						TokenID: "new-token-id",
+					})
+					scaffold.store.foundTokens = append(scaffold.store.foundTokens, device.TokenDetails{
+						TokenID: "admin-token-id",
+					})
+					scaffold.api.CreateToken(scaffold.runtime)
+					g.Assert(len(scaffold.audit.recorded)).Equal(1)
+					entry := scaffold.audit.recorded[0]
+					g.Assert(entry.Action).Equal(defs.AuditTokenCreatedAction)
+					g.Assert(entry.DeviceID).Equal(deviceID)
+					g.Assert(entry.TokenID).Equal("new-token-id")
+					g.Assert(entry.ActorID).Equal("admin-token-id")
+				})
+
+				g.Describe("w/ an idempotency key", func() {
+					var idempotency *testTokenIdempotencyStore
+
+					create := func(key string) (net.HandlerResult, string) {
+						body := `{"name": "some-token-name", "device_id": "some-device", "permissions": ["viewer"]}`
+						scaffold.body.Reset()
+						scaffold.body.Write([]byte(body))
+						scaffold.runtime.Header.Set(defs.APIIdempotencyKeyHeader, key)
+						r := scaffold.api.CreateToken(scaffold.runtime)
+						encoded, _ := json.Marshal(r.Results)
+						return r, string(encoded)
+					}
+
+					created := func(id string) {
+						scaffold.store.createdTokens = []device.TokenDetails{{
+							TokenID:    id,
+							Token:      "raw-" + id,
+							DeviceID:   deviceID,
+							Name:       "some-token-name",
+							Permission: defs.SecurityDeviceTokenPermissionViewer,
+						}}
+					}
+
+					g.BeforeEach(func() {
+						idempotency = &testTokenIdempotencyStore{}
+						scaffold.api.Idempotency = idempotency
+						scaffold.store.authorized = true
+						created("token-a")
+					})
+
+					g.It("creates a single token for repeated requests w/ the same key, responding identically", func() {
+						_, first := create("retry-key")
+						created("token-b")
+						_, second := create("retry-key")
+						g.Assert(len(scaffold.store.createdPermissions)).Equal(1)
+						g.Assert(second).Equal(first)
+						g.Assert(strings.Contains(second, "raw-token-a")).Equal(true)
+						g.Assert(len(scaffold.audit.recorded)).Equal(1)
+					})
+
+					g.It("creates distinct tokens for requests w/ different keys", func() {
+						_, first := create("first-key")
+						created("token-b")
+						_, second := create("second-key")
+						g.Assert(len(scaffold.store.createdPermissions)).Equal(2)
+						g.Assert(strings.Contains(first, "raw-token-a")).Equal(true)
+						g.Assert(strings.Contains(second, "raw-token-b")).Equal(true)
+					})
+
+					g.It("fails w/o creating a token if the key is reused for a different request", func() {
+						create("retry-key")
+						body := `{"name": "some-token-name", "device_id": "some-device", "permissions": ["admin"]}`
+						scaffold.body.Reset()
+						scaffold.body.Write([]byte(body))
+						r := scaffold.api.CreateToken(scaffold.runtime)
+						g.Assert(r.Errors[0].Error()).Equal(defs.ErrIdempotencyKeyReused)
+						g.Assert(len(scaffold.store.createdPermissions)).Equal(1)
+					})
+
+					g.It("fails w/o creating a token while the key is reserved by another request", func() {
+						idempotency.ReserveToken(deviceID, "retry-key")
+						r, _ := create("retry-key")
+						g.Assert(r.Errors[0].Error()).Equal(defs.ErrIdempotencyKeyPending)
+						g.Assert(len(scaffold.store.createdPermissions)).Equal(0)
+					})
+
+					g.It("fails w/o creating a token if another request claims the key first", func() {
+						idempotency.reserveErrors = append(idempotency.reserveErrors, defs.Error(defs.ErrIdempotencyKeyPending))
+						r, _ := create("retry-key")
+						g.Assert(r.Errors[0].Error()).Equal(defs.ErrIdempotencyKeyPending)
+						g.Assert(len(scaffold.store.createdPermissions)).Equal(0)
+					})
+
+					g.It("fails w/ a server error if unable to reserve the key", func() {
+						idempotency.reserveErrors = append(idempotency.reserveErrors, fmt.Errorf("bad-reserve"))
+						r, _ := create("retry-key")
+						g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+						g.Assert(len(scaffold.store.createdPermissions)).Equal(0)
+					})
+
+					g.It("releases the key if unable to create the token so that the request can be retried", func() {
+						scaffold.store.createdTokens = nil
+						scaffold.store.creationErrors = append(scaffold.store.creationErrors, fmt.Errorf("bad-create"))
+						create("retry-key")
+						g.Assert(idempotency.released).Equal([]string{deviceID + ":retry-key"})
+						g.Assert(idempotency.reserved[deviceID+":retry-key"]).Equal(false)
+					})
+
+					g.It("fails w/ an idempotency key that is not safe to store", func() {
+						r, _ := create("not a valid key!")
+						g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidIdempotencyKey)
+						g.Assert(len(scaffold.store.createdPermissions)).Equal(0)
+					})
+
+					g.It("fails w/ a server error if unable to recall the key", func() {
+						idempotency.recallErrors = append(idempotency.recallErrors, fmt.Errorf("bad-recall"))
+						r, _ := create("retry-key")
+						g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+						g.Assert(len(scaffold.store.createdPermissions)).Equal(0)
+					})
+
+					g.It("still returns the created token if unable to record the key", func() {
+						idempotency.rememberErrors = append(idempotency.rememberErrors, fmt.Errorf("bad-remember"))
+						r, encoded := create("retry-key")
+						g.Assert(len(r.Errors)).Equal(0)
+						g.Assert(strings.Contains(encoded, "raw-token-a")).Equal(true)
+					})
+				})
+
+				g.Describe("permission escalation", func() {
+					create := func(permissions string) net.HandlerResult {
+						json := fmt.Sprintf(`{"name": "new-token", "device_id": "%s", "permissions": [%s]}`, deviceID, permissions)
+						scaffold.body.Reset()
+						scaffold.body.Write([]byte(json))
+						return scaffold.api.CreateToken(scaffold.runtime)
+					}
+
+					g.BeforeEach(func() {
+						scaffold.store.authorized = true
+						scaffold.store.createdTokens = append(scaffold.store.createdTokens, device.TokenDetails{})
+					})
+
+					g.It("allows the device's shared secret to create an admin token", func() {
+						r := create(`"admin"`)
+						g.Assert(len(r.Errors)).Equal(0)
+						g.Assert(scaffold.store.createdPermissions).Equal([]uint{defs.SecurityDeviceTokenPermissionAdmin})
+					})
+
+					g.Describe("w/ a token other than the device's shared secret", func() {
+						g.BeforeEach(func() {
+							scaffold.index.foundDevices[0].SharedSecret = "device-secret"
+							scaffold.store.foundTokens = append(scaffold.store.foundTokens, device.TokenDetails{
+								TokenID:    "scoped-admin",
+								Permission: defs.SecurityDeviceTokenPermissionAdmin | defs.SecurityDeviceTokenPermissionViewer,
+							})
+						})
+
+						g.It("rejects granting a permission the creating token does not hold", func() {
+							r := create(`"viewer", "controller"`)
+							g.Assert(r.Errors[0].Error()).Equal(defs.ErrPermissionEscalation)
+							g.Assert(len(scaffold.store.createdPermissions)).Equal(0)
+						})
+
+						g.It("allows granting the same permissions as the creating token", func() {
+							r := create(`"admin", "viewer"`)
+							g.Assert(len(r.Errors)).Equal(0)
+						})
+
+						g.It("allows granting a subset of the creating token's permissions", func() {
+							r := create(`"viewer"`)
+							g.Assert(len(r.Errors)).Equal(0)
+							g.Assert(scaffold.store.createdPermissions).Equal([]uint{defs.SecurityDeviceTokenPermissionViewer})
+						})
+
+						g.It("expands the permissions of the creating token w/ hierarchical permissions", func() {
+							scaffold.api.HierarchicalPermissions = true
+							r := create(`"admin"`)
+							g.Assert(len(r.Errors)).Equal(0)
+							g.Assert(scaffold.store.createdPermissions).Equal([]uint{defs.SecurityDeviceTokenPermissionAll})
+						})
+
+						g.It("rejects an admin request from a viewer token w/ hierarchical permissions", func() {
+							scaffold.api.HierarchicalPermissions = true
+							scaffold.store.foundTokens[0].Permission = defs.SecurityDeviceTokenPermissionViewer
+							r := create(`"admin"`)
+							g.Assert(r.Errors[0].Error()).Equal(defs.ErrPermissionEscalation)
+						})
+
+						g.It("fails if unable to find the creating token", func() {
+							scaffold.store.foundTokens = nil
+							r := create(`"viewer"`)
+							g.Assert(r.Errors[0].Error()).Equal(defs.ErrInvalidTokenRequest)
+						})
+
+						g.It("fails w/ a server error if the creating token lookup itself fails", func() {
+							scaffold.store.findErrors = append(scaffold.store.findErrors, fmt.Errorf("bad-find"))
+							r := create(`"viewer"`)
+							g.Assert(r.Errors[0].Error()).Equal(defs.ErrServerError)
+							g.Assert(len(scaffold.store.createdPermissions)).Equal(0)
+						})
+					})
+				})
 			})
 
 		})
@@ -3,8 +3,12 @@ package routes
 import "io"
 import "fmt"
 import "log"
+import "time"
 import "bytes"
 import "net/http"
+import "io/ioutil"
+import "github.com/satori/go.uuid"
+import "github.com/dadleyy/beacon.api/beacon/net"
 import "github.com/dadleyy/beacon.api/beacon/defs"
 import "github.com/dadleyy/beacon.api/beacon/device"
 import "github.com/dadleyy/beacon.api/beacon/logging"
@@ -18,9 +22,12 @@ func newTestRouteLogger() *logging.Logger {
 }
 
 type testChannelPublisher struct {
+	published [][]byte
 }
 
-func (t *testChannelPublisher) PublishReader(string, io.Reader) error {
+func (t *testChannelPublisher) PublishReader(channel string, reader io.Reader) error {
+	data, _ := ioutil.ReadAll(reader)
+	t.published = append(t.published, data)
 	return nil
 }
 
@@ -34,13 +41,32 @@ type testFeedbackStore struct {
 	listResults []interchange.FeedbackMessage
 	listErrors  []error
 	logErrors   []error
+	batches     [][]interchange.FeedbackMessage
+	batchErrors []error
 	listCalls   []feedbackStoreListParams
+	levelCalls  []interchange.FeedbackLevel
+	statResults map[string]int
+	statErrors  []error
+	statWindows []time.Duration
+	queries     []device.FeedbackQuery
+	cursors     []string
+	nextCursor  string
 }
 
 func (t *testFeedbackStore) LogFeedback(interchange.FeedbackMessage) error {
 	return t.latestError(t.logErrors)
 }
 
+func (t *testFeedbackStore) RecordFeedback(interchange.FeedbackMessage) error {
+	return t.latestError(t.logErrors)
+}
+
+func (t *testFeedbackStore) LogFeedbackBatch(messages []interchange.FeedbackMessage) error {
+	t.batches = append(t.batches, messages)
+	return t.latestError(t.batchErrors)
+}
+
+// ListFeedback mirrors the registry in treating the count as the inclusive index of the last entry returned.
 func (t *testFeedbackStore) ListFeedback(d string, c int) ([]interchange.FeedbackMessage, error) {
 	t.listCalls = append(t.listCalls, feedbackStoreListParams{d, c})
 
@@ -48,6 +74,92 @@ func (t *testFeedbackStore) ListFeedback(d string, c int) ([]interchange.Feedbac
 		return nil, e
 	}
 
+	if c >= 0 && c+1 < len(t.listResults) {
+		return t.listResults[:c+1], nil
+	}
+
+	return t.listResults, nil
+}
+
+func (t *testFeedbackStore) ListFeedbackPage(d, cursor string, c int) ([]interchange.FeedbackMessage, string, error) {
+	t.cursors = append(t.cursors, cursor)
+	t.listCalls = append(t.listCalls, feedbackStoreListParams{d, c})
+
+	if e := t.latestError(t.listErrors); e != nil {
+		return nil, t.nextCursor, e
+	}
+
+	return t.listResults, t.nextCursor, nil
+}
+
+func (t *testFeedbackStore) ListFeedbackByLevel(
+	d string,
+	c int,
+	level interchange.FeedbackLevel,
+) ([]interchange.FeedbackMessage, error) {
+	t.levelCalls = append(t.levelCalls, level)
+	return t.ListFeedback(d, c)
+}
+
+func (t *testFeedbackStore) FeedbackStats(d string, window time.Duration) (map[string]int, error) {
+	t.statWindows = append(t.statWindows, window)
+
+	if e := t.latestError(t.statErrors); e != nil {
+		return nil, e
+	}
+
+	return t.statResults, nil
+}
+
+func (t *testFeedbackStore) QueryFeedback(d string, query device.FeedbackQuery) ([]interchange.FeedbackMessage, error) {
+	t.queries = append(t.queries, query)
+
+	if e := t.latestError(t.listErrors); e != nil {
+		return nil, e
+	}
+
+	return t.listResults, nil
+}
+
+type testFeedbackStream struct {
+	subscriptions []device.FeedbackSubscription
+	unsubscribed  []device.FeedbackSubscription
+	published     []interchange.FeedbackMessage
+}
+
+func (t *testFeedbackStream) Subscribe(string) device.FeedbackSubscription {
+	subscription := make(device.FeedbackSubscription)
+	t.subscriptions = append(t.subscriptions, subscription)
+	return subscription
+}
+
+func (t *testFeedbackStream) Unsubscribe(subscription device.FeedbackSubscription) {
+	t.unsubscribed = append(t.unsubscribed, subscription)
+}
+
+func (t *testFeedbackStream) Publish(message interchange.FeedbackMessage) {
+	t.published = append(t.published, message)
+}
+
+type testAuditLog struct {
+	recorded    []device.AuditEntry
+	listResults []device.AuditEntry
+	listErrors  []error
+	listLimits  []int
+}
+
+func (t *testAuditLog) RecordAudit(entry device.AuditEntry) error {
+	t.recorded = append(t.recorded, entry)
+	return nil
+}
+
+func (t *testAuditLog) ListAuditLog(limit int) ([]device.AuditEntry, error) {
+	t.listLimits = append(t.listLimits, limit)
+
+	if len(t.listErrors) >= 1 {
+		return nil, t.listErrors[0]
+	}
+
 	return t.listResults, nil
 }
 
@@ -58,13 +170,47 @@ type testDeviceRegistry struct {
 	fillErrors             []error
 	listRegistrationErrors []error
 	removalErrors          []error
+	existsErrors           []error
+	metaErrors             []error
+	meta                   map[string]string
+	filledID               string
 	activeRegistrations    []device.RegistrationDetails
+	pendingErrors          []error
+	pending                []device.RegistrationRequest
+	renameErrors           []error
+	renamed                []string
+	bulkRemovalErrors      []error
+	removalFailures        map[string]error
+	removed                []string
+	reissueErrors          []error
+	reissued               map[string]string
 }
 
 func (t *testDeviceRegistry) AllocateRegistration(device.RegistrationRequest) error {
 	return t.latestError(t.allocationErrors)
 }
 
+func (t *testDeviceRegistry) ReissueRegistration(deviceID, secret string) error {
+	if e := t.latestError(t.reissueErrors); e != nil {
+		return e
+	}
+
+	if t.reissued == nil {
+		t.reissued = make(map[string]string)
+	}
+
+	t.reissued[deviceID] = secret
+	return nil
+}
+
+func (t *testDeviceRegistry) ListPendingRegistrations() ([]device.RegistrationRequest, error) {
+	if e := t.latestError(t.pendingErrors); e != nil {
+		return nil, e
+	}
+
+	return t.pending, nil
+}
+
 func (t *testDeviceRegistry) FindDevice(string) (device.RegistrationDetails, error) {
 	if e := t.latestError(t.findErrors); e != nil {
 		return device.RegistrationDetails{}, e
@@ -74,17 +220,44 @@ func (t *testDeviceRegistry) FindDevice(string) (device.RegistrationDetails, err
 		return t.activeRegistrations[0], nil
 	}
 
-	return device.RegistrationDetails{}, fmt.Errorf("not-found")
+	return device.RegistrationDetails{}, defs.Error(defs.ErrNotFound)
 }
 
-func (t *testDeviceRegistry) FillRegistration(string, string) error {
-	return t.latestError(t.fillErrors)
+func (t *testDeviceRegistry) FillRegistration(secret, id string) (string, error) {
+	if e := t.latestError(t.fillErrors); e != nil {
+		return "", e
+	}
+
+	if t.filledID != "" {
+		return t.filledID, nil
+	}
+
+	return id, nil
 }
 
 func (t *testDeviceRegistry) RemoveDevice(string) error {
 	return t.latestError(t.removalErrors)
 }
 
+func (t *testDeviceRegistry) RemoveDevices(ids []string) (map[string]error, error) {
+	if e := t.latestError(t.bulkRemovalErrors); e != nil {
+		return nil, e
+	}
+
+	failures := make(map[string]error)
+
+	for _, id := range ids {
+		if e, failed := t.removalFailures[id]; failed {
+			failures[id] = e
+			continue
+		}
+
+		t.removed = append(t.removed, id)
+	}
+
+	return failures, nil
+}
+
 func (t *testDeviceRegistry) ListRegistrations() ([]device.RegistrationDetails, error) {
 	if e := t.latestError(t.listRegistrationErrors); e != nil {
 		return nil, e
@@ -93,6 +266,51 @@ func (t *testDeviceRegistry) ListRegistrations() ([]device.RegistrationDetails,
 	return t.activeRegistrations, nil
 }
 
+func (t *testDeviceRegistry) FindDevices(string) ([]device.RegistrationDetails, error) {
+	return nil, nil
+}
+
+func (t *testDeviceRegistry) SetDeviceMeta(deviceID string, meta map[string]string) error {
+	if e := t.latestError(t.metaErrors); e != nil {
+		return e
+	}
+
+	if t.meta == nil {
+		t.meta = make(map[string]string)
+	}
+
+	for key, value := range meta {
+		t.meta[key] = value
+	}
+
+	return nil
+}
+
+func (t *testDeviceRegistry) RenameDevice(deviceID, name string) error {
+	if e := t.latestError(t.renameErrors); e != nil {
+		return e
+	}
+
+	t.renamed = append(t.renamed, name)
+	return nil
+}
+
+func (t *testDeviceRegistry) GetDeviceMeta(string) (map[string]string, error) {
+	if e := t.latestError(t.metaErrors); e != nil {
+		return nil, e
+	}
+
+	return t.meta, nil
+}
+
+func (t *testDeviceRegistry) DeviceExists(string) (bool, error) {
+	if e := t.latestError(t.existsErrors); e != nil {
+		return false, e
+	}
+
+	return len(t.activeRegistrations) >= 1, nil
+}
+
 type testErrorStore struct {
 }
 
@@ -104,13 +322,78 @@ func (t *testErrorStore) latestError(errList []error) error {
 	return nil
 }
 
+type testDeviceLocker struct {
+	testErrorStore
+	mutator device.DeviceMutator
+	errors  []error
+	locked  []string
+}
+
+func (t *testDeviceLocker) LockDevice(deviceID string, mutations func(device.DeviceMutator) error) error {
+	if e := t.latestError(t.errors); e != nil {
+		return e
+	}
+
+	t.locked = append(t.locked, deviceID)
+	return mutations(t.mutator)
+}
+
+type testNameIndex struct {
+	testErrorStore
+	taken   map[string]bool
+	owners  map[string]string
+	errors  []error
+	queries []string
+}
+
+func (t *testNameIndex) NameTaken(name string) (bool, error) {
+	t.queries = append(t.queries, name)
+
+	if e := t.latestError(t.errors); e != nil {
+		return false, e
+	}
+
+	return t.taken[name], nil
+}
+
+func (t *testNameIndex) NameOwner(name string) (string, error) {
+	t.queries = append(t.queries, name)
+
+	if e := t.latestError(t.errors); e != nil {
+		return "", e
+	}
+
+	if owner, ok := t.owners[name]; ok {
+		return owner, nil
+	}
+
+	return "", defs.Error(defs.ErrNotFound)
+}
+
 type testDeviceTokenStore struct {
 	authorized            bool
+	authorizedPermission  uint
 	createdTokens         []device.TokenDetails
 	creationErrors        []error
 	listedTokens          []device.TokenDetails
 	listedErrors          []error
 	authorizationAttempts map[string]map[string]uint
+	foundTokens           []device.TokenDetails
+	createdPermissions    []uint
+	listedLimits          []int
+	findErrors            []error
+}
+
+func (t *testDeviceTokenStore) FindToken(string) (device.TokenDetails, error) {
+	if len(t.findErrors) >= 1 {
+		return device.TokenDetails{}, t.findErrors[0]
+	}
+
+	if len(t.foundTokens) >= 1 {
+		return t.foundTokens[0], nil
+	}
+
+	return device.TokenDetails{}, defs.Error(defs.ErrNotFound)
 }
 
 func (t *testDeviceTokenStore) AuthorizeToken(deviceID string, newToken string, level uint) bool {
@@ -120,6 +403,10 @@ func (t *testDeviceTokenStore) AuthorizeToken(deviceID string, newToken string,
 
 	t.authorizationAttempts[deviceID] = map[string]uint{newToken: level}
 
+	if t.authorizedPermission != 0 {
+		return level == t.authorizedPermission
+	}
+
 	return t.authorized
 }
 
@@ -131,7 +418,19 @@ func (t *testDeviceTokenStore) ListTokens(string) ([]device.TokenDetails, error)
 	return t.listedTokens, nil
 }
 
-func (t *testDeviceTokenStore) CreateToken(string, string, uint) (device.TokenDetails, error) {
+func (t *testDeviceTokenStore) ListAllTokens(limit int) ([]device.TokenDetails, error) {
+	t.listedLimits = append(t.listedLimits, limit)
+
+	if len(t.listedErrors) >= 1 {
+		return nil, t.listedErrors[0]
+	}
+
+	return t.listedTokens, nil
+}
+
+func (t *testDeviceTokenStore) CreateToken(deviceID string, name string, permission uint) (device.TokenDetails, error) {
+	t.createdPermissions = append(t.createdPermissions, permission)
+
 	if len(t.createdTokens) >= 1 {
 		return t.createdTokens[0], nil
 	}
@@ -143,6 +442,65 @@ func (t *testDeviceTokenStore) CreateToken(string, string, uint) (device.TokenDe
 	return device.TokenDetails{}, fmt.Errorf("not-found")
 }
 
+type testTokenIdempotencyStore struct {
+	remembered     map[string]device.TokenDetails
+	reserved       map[string]bool
+	released       []string
+	recallErrors   []error
+	reserveErrors  []error
+	rememberErrors []error
+}
+
+func (t *testTokenIdempotencyStore) RecallToken(deviceID, key string) (device.TokenDetails, error) {
+	if len(t.recallErrors) >= 1 {
+		return device.TokenDetails{}, t.recallErrors[0]
+	}
+
+	details, ok := t.remembered[deviceID+":"+key]
+
+	if ok == true {
+		return details, nil
+	}
+
+	if t.reserved[deviceID+":"+key] {
+		return device.TokenDetails{}, defs.Error(defs.ErrIdempotencyKeyPending)
+	}
+
+	return device.TokenDetails{}, defs.Error(defs.ErrNotFound)
+}
+
+func (t *testTokenIdempotencyStore) ReserveToken(deviceID, key string) error {
+	if len(t.reserveErrors) >= 1 {
+		return t.reserveErrors[0]
+	}
+
+	if t.reserved == nil {
+		t.reserved = make(map[string]bool)
+	}
+
+	t.reserved[deviceID+":"+key] = true
+	return nil
+}
+
+func (t *testTokenIdempotencyStore) ReleaseToken(deviceID, key string) error {
+	delete(t.reserved, deviceID+":"+key)
+	t.released = append(t.released, deviceID+":"+key)
+	return nil
+}
+
+func (t *testTokenIdempotencyStore) RememberToken(deviceID, key string, details device.TokenDetails) error {
+	if len(t.rememberErrors) >= 1 {
+		return t.rememberErrors[0]
+	}
+
+	if t.remembered == nil {
+		t.remembered = make(map[string]device.TokenDetails)
+	}
+
+	t.remembered[deviceID+":"+key] = details
+	return nil
+}
+
 type testDeviceIndex struct {
 	testErrorStore
 	foundDevices  []device.RegistrationDetails
@@ -196,3 +554,330 @@ func (t *testWebsocketConnection) Close() error {
 func (t *testWebsocketConnection) NextWriter(int) (io.WriteCloser, error) {
 	return nil, fmt.Errorf("not-implemented")
 }
+
+type testConnectionFactory struct {
+	testErrorStore
+	pending *testPendingConnection
+	errors  []error
+}
+
+func (t *testConnectionFactory) OpenConnection(*net.RequestRuntime) (PendingConnection, error) {
+	if e := t.latestError(t.errors); e != nil {
+		return nil, e
+	}
+
+	return t.pending, nil
+}
+
+type testPendingConnection struct {
+	closeCount int
+	attached   *testConnection
+}
+
+func (t *testPendingConnection) Attach(key defs.Signer, deviceID uuid.UUID) device.Connection {
+	t.attached = &testConnection{id: deviceID.String()}
+	return t.attached
+}
+
+func (t *testPendingConnection) Close() error {
+	t.closeCount++
+	return nil
+}
+
+type testConnection struct {
+	id string
+}
+
+func (t *testConnection) Send(interchange.DeviceMessage) error {
+	return nil
+}
+
+func (t *testConnection) Receive() (io.Reader, error) {
+	return nil, fmt.Errorf("not-implemented")
+}
+
+func (t *testConnection) GetID() string {
+	return t.id
+}
+
+func (t *testConnection) Close() error {
+	return nil
+}
+
+type testTagStore struct {
+	added       map[string][]string
+	removed     []string
+	addErrors   []error
+	listResults []device.RegistrationDetails
+	listErrors  []error
+}
+
+func (t *testTagStore) AddDeviceTag(deviceID, tag string) (bool, error) {
+	if len(t.addErrors) >= 1 {
+		return false, t.addErrors[0]
+	}
+
+	if t.added == nil {
+		t.added = make(map[string][]string)
+	}
+
+	for _, existing := range t.added[deviceID] {
+		if existing == tag {
+			return false, nil
+		}
+	}
+
+	t.added[deviceID] = append(t.added[deviceID], tag)
+	return true, nil
+}
+
+func (t *testTagStore) RemoveDeviceTag(deviceID, tag string) error {
+	t.removed = append(t.removed, tag)
+	return nil
+}
+
+func (t *testTagStore) ListDevicesByTag(string) ([]device.RegistrationDetails, error) {
+	if len(t.listErrors) >= 1 {
+		return nil, t.listErrors[0]
+	}
+
+	return t.listResults, nil
+}
+
+type testCommandStore struct {
+	testErrorStore
+	tracked      map[string]string
+	trackErrors  []error
+	statuses     []device.CommandStatus
+	statusErrors []error
+	updates      map[string]string
+}
+
+func (t *testCommandStore) TrackCommand(commandID, deviceID string) error {
+	if e := t.latestError(t.trackErrors); e != nil {
+		return e
+	}
+
+	if t.tracked == nil {
+		t.tracked = make(map[string]string)
+	}
+
+	t.tracked[commandID] = deviceID
+	return nil
+}
+
+func (t *testCommandStore) UpdateCommandStatus(commandID, deviceID, status string) error {
+	if t.updates == nil {
+		t.updates = make(map[string]string)
+	}
+
+	t.updates[commandID] = status
+	return nil
+}
+
+func (t *testCommandStore) GetCommandStatus(string) (device.CommandStatus, error) {
+	if e := t.latestError(t.statusErrors); e != nil {
+		return device.CommandStatus{}, e
+	}
+
+	if len(t.statuses) == 0 {
+		return device.CommandStatus{}, fmt.Errorf("not-found")
+	}
+
+	return t.statuses[0], nil
+}
+
+type testFirmwareStore struct {
+	testErrorStore
+	versions map[string]string
+	errors   []error
+	queries  []string
+}
+
+func (t *testFirmwareStore) GetDeviceFirmware(deviceID string) (string, error) {
+	if e := t.latestError(t.errors); e != nil {
+		return "", e
+	}
+
+	if version, ok := t.versions[deviceID]; ok {
+		return version, nil
+	}
+
+	return defs.DefaultFirmwareVersion, nil
+}
+
+func (t *testFirmwareStore) ListDevicesByFirmware(version string) ([]device.RegistrationDetails, error) {
+	t.queries = append(t.queries, version)
+
+	if e := t.latestError(t.errors); e != nil {
+		return nil, e
+	}
+
+	results := make([]device.RegistrationDetails, 0)
+
+	for id, reported := range t.versions {
+		if reported == version {
+			results = append(results, device.RegistrationDetails{DeviceID: id})
+		}
+	}
+
+	return results, nil
+}
+
+type testCommandHistory struct {
+	testErrorStore
+	recorded   map[string][]device.CommandHistoryEntry
+	errors     []error
+	listCounts []int
+}
+
+func (t *testCommandHistory) RecordCommand(deviceID string, entry device.CommandHistoryEntry) error {
+	if e := t.latestError(t.errors); e != nil {
+		return e
+	}
+
+	if t.recorded == nil {
+		t.recorded = make(map[string][]device.CommandHistoryEntry)
+	}
+
+	t.recorded[deviceID] = append([]device.CommandHistoryEntry{entry}, t.recorded[deviceID]...)
+	return nil
+}
+
+func (t *testCommandHistory) ListCommandHistory(deviceID string, count int) ([]device.CommandHistoryEntry, error) {
+	t.listCounts = append(t.listCounts, count)
+
+	if e := t.latestError(t.errors); e != nil {
+		return nil, e
+	}
+
+	return t.recorded[deviceID], nil
+}
+
+type testConnectionEventLog struct {
+	testErrorStore
+	events     map[string][]device.ConnectionEvent
+	errors     []error
+	listCounts []int
+}
+
+func (t *testConnectionEventLog) RecordConnectionEvent(deviceID string, event device.ConnectionEvent) error {
+	if t.events == nil {
+		t.events = make(map[string][]device.ConnectionEvent)
+	}
+
+	t.events[deviceID] = append([]device.ConnectionEvent{event}, t.events[deviceID]...)
+	return nil
+}
+
+func (t *testConnectionEventLog) ListConnectionEvents(deviceID string, count int) ([]device.ConnectionEvent, error) {
+	t.listCounts = append(t.listCounts, count)
+
+	if e := t.latestError(t.errors); e != nil {
+		return nil, e
+	}
+
+	return t.events[deviceID], nil
+}
+
+type testDevicePool struct {
+	connected map[string]bool
+}
+
+func (t *testDevicePool) Connected(deviceID string) bool {
+	return t.connected[deviceID]
+}
+
+type testDeviceDisconnector struct {
+	connections  map[string]int
+	disconnected []string
+}
+
+func (t *testDeviceDisconnector) Disconnect(deviceID string) int {
+	t.disconnected = append(t.disconnected, deviceID)
+	count := t.connections[deviceID]
+	delete(t.connections, deviceID)
+	return count
+}
+
+type testActivityStore struct {
+	testErrorStore
+	seen   map[string]time.Time
+	errors []error
+}
+
+func (t *testActivityStore) TouchDevice(deviceID string) error {
+	if t.seen == nil {
+		t.seen = make(map[string]time.Time)
+	}
+
+	t.seen[deviceID] = time.Now()
+	return nil
+}
+
+func (t *testActivityStore) LastSeen(deviceID string) (time.Time, error) {
+	if e := t.latestError(t.errors); e != nil {
+		return time.Time{}, e
+	}
+
+	return t.seen[deviceID], nil
+}
+
+func (t *testActivityStore) FlagIdleDevice(string) error {
+	return nil
+}
+
+type testStateStore struct {
+	testErrorStore
+	states    map[string]device.DeviceState
+	setErrors []error
+	getErrors []error
+}
+
+func (t *testStateStore) SetDeviceState(deviceID string, frame interchange.ControlFrame) error {
+	if e := t.latestError(t.setErrors); e != nil {
+		return e
+	}
+
+	if t.states == nil {
+		t.states = make(map[string]device.DeviceState)
+	}
+
+	t.states[deviceID] = device.DeviceState{DeviceID: deviceID, Red: frame.Red, Green: frame.Green, Blue: frame.Blue}
+	return nil
+}
+
+func (t *testStateStore) GetDeviceState(deviceID string) (device.DeviceState, error) {
+	if e := t.latestError(t.getErrors); e != nil {
+		return device.DeviceState{}, e
+	}
+
+	state, ok := t.states[deviceID]
+
+	if ok != true {
+		return device.DeviceState{}, defs.Error(defs.ErrNotFound)
+	}
+
+	return state, nil
+}
+
+type testResumeStore struct {
+	testErrorStore
+	deviceID     string
+	resumeErrors []error
+	secrets      []string
+}
+
+func (t *testResumeStore) IssueResumeToken(string) (string, error) {
+	return "resume-token", nil
+}
+
+func (t *testResumeStore) ResumeDevice(token, secret string) (string, error) {
+	t.secrets = append(t.secrets, secret)
+
+	if e := t.latestError(t.resumeErrors); e != nil {
+		return "", e
+	}
+
+	return t.deviceID, nil
+}
@@ -0,0 +1,303 @@
+package rpc
+
+import "golang.org/x/net/context"
+import "google.golang.org/grpc/codes"
+import "google.golang.org/grpc/status"
+import "google.golang.org/grpc/metadata"
+
+import "github.com/dadleyy/beacon.api/beacon/bg"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+import "github.com/dadleyy/beacon.api/beacon/security"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+// NewDeviceControlServer returns a grpc device control service backed by the same stores used by the http routes.
+func NewDeviceControlServer(
+	registry device.Registry,
+	tokens device.TokenStore,
+	feedback device.FeedbackStore,
+	audit device.AuditLog,
+	commands device.CommandStore,
+	states device.StateStore,
+	publisher bg.ChannelPublisher,
+) *DeviceControlServer {
+	logger := logging.New(defs.DeviceControlRPCLogPrefix, logging.Green)
+
+	return &DeviceControlServer{
+		LeveledLogger:    logger,
+		Registry:         registry,
+		TokenStore:       tokens,
+		FeedbackStore:    feedback,
+		AuditLog:         audit,
+		CommandStore:     commands,
+		StateStore:       states,
+		ChannelPublisher: publisher,
+	}
+}
+
+// DeviceControlServer implements the interchange.DeviceControlServer interface. Callers authenticate w/ a device token
+// sent in the request metadata under the same key used by the http api's user token header.
+type DeviceControlServer struct {
+	logging.LeveledLogger
+	device.Registry
+	device.TokenStore
+	device.FeedbackStore
+	device.AuditLog
+	device.CommandStore
+	device.StateStore
+	bg.ChannelPublisher
+
+	// History records the control commands sent to each device; when nil commands are not recorded.
+	History device.CommandHistory
+
+	// ListCount is the amount of feedback entries listed when a request does not provide a (positive) count, falling back
+	// to the default when not positive.
+	ListCount int
+
+	// MaxListCount is the most feedback entries a single list request can return; larger counts are clamped to it. Falls
+	// back to the default maximum when not positive.
+	MaxListCount int
+
+	// HierarchicalPermissions, when set, normalizes requested permissions so that admin implies controller and viewer.
+	HierarchicalPermissions bool
+}
+
+// UpdateColor sends a control message w/ the requested frame to the device, returning the id of the command. Like the
+// http api, the frame is recorded as the state of the device and in its command history once published.
+func (server *DeviceControlServer) UpdateColor(
+	ctx context.Context,
+	request *interchange.UpdateColorRequest,
+) (*interchange.UpdateColorResponse, error) {
+	details, e := server.FindDevice(request.DeviceID)
+
+	if e != nil {
+		server.Warnf("color update w/ invalid device id: %s (%s)", request.DeviceID, e.Error())
+		return nil, status.Error(codes.NotFound, defs.ErrNotFound)
+	}
+
+	if server.authorize(ctx, details.DeviceID, defs.SecurityDeviceTokenPermissionController) != true {
+		server.Warnf("unauthorized attempt to control device (device: %s)", details.DeviceID)
+		return nil, status.Error(codes.NotFound, defs.ErrNotFound)
+	}
+
+	frame := request.GetFrame()
+
+	if frame == nil {
+		frame = &interchange.ControlFrame{}
+	}
+
+	commandID, e := server.control().Send(server.ChannelPublisher, device.ControlCommand{
+		DeviceID: details.DeviceID,
+		Token:    server.token(ctx),
+		Frame:    *frame,
+	})
+
+	if e == defs.Error(defs.ErrDeviceBusy) {
+		server.Warnf("command channel full, unable to publish control message")
+		return nil, status.Error(codes.Unavailable, defs.ErrDeviceBusy)
+	}
+
+	if e == defs.Error(defs.ErrControlUnavailable) {
+		server.Warnf("control channel unavailable, unable to publish control message")
+		return nil, status.Error(codes.Unavailable, defs.ErrControlUnavailable)
+	}
+
+	if e != nil {
+		server.Errorf("unable to send control message: %s", e.Error())
+		return nil, status.Error(codes.Internal, defs.ErrServerError)
+	}
+
+	return &interchange.UpdateColorResponse{CommandID: commandID}, nil
+}
+
+// control returns the sender used to send control commands to devices w/ the stores of the service.
+func (server *DeviceControlServer) control() *device.ControlSender {
+	return &device.ControlSender{
+		LeveledLogger: server.LeveledLogger,
+		CommandStore:  server.CommandStore,
+		StateStore:    server.StateStore,
+		Tokens:        server.TokenStore,
+		History:       server.History,
+	}
+}
+
+// ListDevices returns the registrations in the registry.
+func (server *DeviceControlServer) ListDevices(
+	ctx context.Context,
+	request *interchange.ListDevicesRequest,
+) (*interchange.ListDevicesResponse, error) {
+	registrations, e := server.ListRegistrations()
+
+	if e != nil {
+		server.Errorf("unable to lookup device id list: %s", e.Error())
+		return nil, status.Error(codes.Internal, defs.ErrServerError)
+	}
+
+	devices := make([]*interchange.DeviceRegistration, 0, len(registrations))
+
+	for _, details := range registrations {
+		devices = append(devices, &interchange.DeviceRegistration{
+			DeviceID: details.DeviceID,
+			Name:     details.Name,
+		})
+	}
+
+	return &interchange.ListDevicesResponse{Devices: devices}, nil
+}
+
+// CreateToken allocates a new device token, requiring the caller to be authorized w/ the admin permission.
+func (server *DeviceControlServer) CreateToken(
+	ctx context.Context,
+	request *interchange.CreateTokenRequest,
+) (*interchange.CreateTokenResponse, error) {
+	permission := uint(request.Permission)
+
+	if permission&^defs.SecurityDeviceTokenPermissionAll != 0 {
+		server.Warnf("received permission mask w/ unknown bits: %b", permission)
+		return nil, status.Error(codes.InvalidArgument, defs.ErrInvalidTokenPermission)
+	}
+
+	// The normalized mask is what gets stored and checked for escalation, matching the http api.
+	permission = security.NormalizePermissions(permission, server.HierarchicalPermissions)
+
+	if (len(request.Name) >= defs.SecurityUserDeviceNameMinLength) != true {
+		return nil, status.Error(codes.InvalidArgument, defs.ErrInvalidDeviceTokenName)
+	}
+
+	details, e := server.FindDevice(request.DeviceID)
+
+	if e != nil {
+		server.Warnf("unable to find device (device id: %s): %s", request.DeviceID, e.Error())
+		return nil, status.Error(codes.NotFound, defs.ErrNotFound)
+	}
+
+	if server.authorize(ctx, details.DeviceID, defs.SecurityDeviceTokenPermissionAdmin) != true {
+		server.Warnf("unauthorized attempt to create token (device: %s)", details.DeviceID)
+		return nil, status.Error(codes.PermissionDenied, defs.ErrInvalidTokenRequest)
+	}
+
+	// Only the device's shared secret may grant any permission; other tokens may only grant permissions they hold.
+	if actor := server.token(ctx); actor != details.SharedSecret {
+		creator, e := server.FindToken(actor)
+
+		if e != nil {
+			server.Warnf("unable to find authorized token (device: %s): %s", details.DeviceID, e.Error())
+			return nil, status.Error(codes.PermissionDenied, defs.ErrInvalidTokenRequest)
+		}
+
+		if security.Escalates(permission, creator.Permission, server.HierarchicalPermissions) {
+			server.Warnf("token %s attempted to grant %b (holds %b)", creator.TokenID, permission, creator.Permission)
+			return nil, status.Error(codes.PermissionDenied, defs.ErrPermissionEscalation)
+		}
+	}
+
+	token, e := server.TokenStore.CreateToken(details.DeviceID, request.Name, permission)
+
+	if e == defs.Error(defs.ErrTokenLimitReached) {
+		server.Warnf("token limit reached (device: %s)", details.DeviceID)
+		return nil, status.Error(codes.ResourceExhausted, defs.ErrTokenLimitReached)
+	}
+
+	if e == defs.Error(defs.ErrDuplicateTokenName) {
+		server.Warnf("duplicate token name (device: %s)", details.DeviceID)
+		return nil, status.Error(codes.AlreadyExists, defs.ErrDuplicateTokenName)
+	}
+
+	if e == defs.Error(defs.ErrInvalidTokenPermission) {
+		server.Warnf("invalid token permission (device: %s): %b", details.DeviceID, permission)
+		return nil, status.Error(codes.InvalidArgument, defs.ErrInvalidTokenPermission)
+	}
+
+	if e != nil {
+		server.Warnf("unable to create token: %s", e.Error())
+		return nil, status.Error(codes.Internal, defs.ErrServerError)
+	}
+
+	server.audit(ctx, defs.AuditTokenCreatedAction, details.DeviceID, token.TokenID)
+
+	return &interchange.CreateTokenResponse{
+		Token: &interchange.DeviceToken{
+			TokenID:    token.TokenID,
+			DeviceID:   token.DeviceID,
+			Token:      token.Token,
+			Name:       token.Name,
+			Permission: uint32(token.Permission),
+		},
+	}, nil
+}
+
+// ListFeedback returns the latest feedback entries logged for the device, requiring the viewer permission.
+func (server *DeviceControlServer) ListFeedback(
+	ctx context.Context,
+	request *interchange.ListFeedbackRequest,
+) (*interchange.ListFeedbackResponse, error) {
+	count := device.FeedbackListCount(int(request.Count), server.ListCount, server.MaxListCount)
+
+	details, e := server.FindDevice(request.DeviceID)
+
+	if e != nil {
+		server.Warnf("invalid device id: %s", request.DeviceID)
+		return nil, status.Error(codes.NotFound, defs.ErrNotFound)
+	}
+
+	if server.authorize(ctx, details.DeviceID, defs.SecurityDeviceTokenPermissionViewer) != true {
+		server.Warnf("unauthorized attempt to list feedback (device: %s)", details.DeviceID)
+		return nil, status.Error(codes.NotFound, defs.ErrNotFound)
+	}
+
+	var entries []interchange.FeedbackMessage
+
+	if request.MinimumLevel != interchange.FeedbackLevel_LEVEL_INFO {
+		entries, e = server.ListFeedbackByLevel(details.DeviceID, count, request.MinimumLevel)
+	} else {
+		entries, e = server.FeedbackStore.ListFeedback(details.DeviceID, count-1)
+	}
+
+	if e != nil {
+		server.Warnf("unable to load device feedback: %s", e.Error())
+		return nil, status.Error(codes.Internal, defs.ErrServerError)
+	}
+
+	feedback := make([]*interchange.FeedbackMessage, 0, len(entries))
+
+	for i := range entries {
+		feedback = append(feedback, &entries[i])
+	}
+
+	return &interchange.ListFeedbackResponse{Feedback: feedback}, nil
+}
+
+func (server *DeviceControlServer) authorize(ctx context.Context, deviceID string, permission uint) bool {
+	token := server.token(ctx)
+	return token != "" && server.AuthorizeToken(deviceID, token, permission)
+}
+
+func (server *DeviceControlServer) audit(ctx context.Context, action, deviceID, tokenID string) {
+	entry := device.AuditEntry{Action: action, DeviceID: deviceID, TokenID: tokenID}
+
+	if details, e := server.FindToken(server.token(ctx)); e == nil {
+		entry.ActorID = details.TokenID
+	}
+
+	if e := server.RecordAudit(entry); e != nil {
+		server.Warnf("unable to record audit entry (action: %s, device: %s): %s", action, deviceID, e.Error())
+	}
+}
+
+// token returns the device token sent in the request metadata.
+func (server *DeviceControlServer) token(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+
+	if ok != true {
+		return ""
+	}
+
+	tokens := md[defs.APIUserTokenHeader]
+
+	if len(tokens) != 1 {
+		return ""
+	}
+
+	return tokens[0]
+}
@@ -0,0 +1,468 @@
+package rpc
+
+import "fmt"
+import "net"
+import "sync"
+import "time"
+import "strings"
+import "testing"
+import "github.com/franela/goblin"
+import "golang.org/x/net/context"
+import "google.golang.org/grpc"
+import "google.golang.org/grpc/codes"
+import "google.golang.org/grpc/status"
+import "google.golang.org/grpc/metadata"
+import "google.golang.org/grpc/test/bufconn"
+import "github.com/golang/protobuf/proto"
+
+import "github.com/dadleyy/beacon.api/beacon/bg"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+type deviceControlScaffold struct {
+	registry   *testRegistry
+	tokens     *testTokenStore
+	feedback   *testFeedbackStore
+	publisher  *testPublisher
+	audit      *testAuditLog
+	commands   *testCommandStore
+	states     *testStateStore
+	history    *testCommandHistory
+	service    *DeviceControlServer
+	processor  *Processor
+	connection *grpc.ClientConn
+	client     interchange.DeviceControlClient
+	wg         *sync.WaitGroup
+	kill       bg.KillSwitch
+}
+
+func (s *deviceControlScaffold) Start() {
+	s.registry = &testRegistry{}
+	s.tokens = &testTokenStore{}
+	s.feedback = &testFeedbackStore{}
+	s.publisher = &testPublisher{}
+	s.audit = &testAuditLog{}
+	s.commands = &testCommandStore{}
+	s.states = &testStateStore{}
+	s.history = &testCommandHistory{}
+
+	s.service = &DeviceControlServer{
+		LeveledLogger:    newTestLogger(),
+		Registry:         s.registry,
+		TokenStore:       s.tokens,
+		FeedbackStore:    s.feedback,
+		AuditLog:         s.audit,
+		CommandStore:     s.commands,
+		StateStore:       s.states,
+		ChannelPublisher: s.publisher,
+		History:          s.history,
+	}
+
+	listener := bufconn.Listen(1024 * 1024)
+	s.processor = NewProcessor(listener, s.service)
+	s.processor.LeveledLogger = newTestLogger()
+	s.wg, s.kill = &sync.WaitGroup{}, make(bg.KillSwitch)
+	s.wg.Add(1)
+	go s.processor.Start(s.wg, s.kill)
+
+	dialer := grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return listener.Dial()
+	})
+
+	s.connection, _ = grpc.Dial("bufnet", dialer, grpc.WithInsecure())
+	s.client = interchange.NewDeviceControlClient(s.connection)
+}
+
+func (s *deviceControlScaffold) Stop() {
+	s.connection.Close()
+	s.kill <- struct{}{}
+	s.wg.Wait()
+}
+
+func authorized() context.Context {
+	return metadata.NewOutgoingContext(context.Background(), metadata.Pairs(defs.APIUserTokenHeader, "some-token"))
+}
+
+func Test_DeviceControlServer(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("DeviceControlServer", func() {
+		s := &deviceControlScaffold{}
+
+		g.BeforeEach(s.Start)
+		g.AfterEach(s.Stop)
+
+		g.Describe("UpdateColor", func() {
+			g.It("returns not found if the device does not exist", func() {
+				s.registry.findErrors = append(s.registry.findErrors, fmt.Errorf("bad-find"))
+				_, e := s.client.UpdateColor(authorized(), &interchange.UpdateColorRequest{DeviceID: "123"})
+				g.Assert(status.Code(e)).Equal(codes.NotFound)
+			})
+
+			g.It("returns not found if the token is not authorized to control the device", func() {
+				_, e := s.client.UpdateColor(authorized(), &interchange.UpdateColorRequest{DeviceID: "123"})
+				g.Assert(status.Code(e)).Equal(codes.NotFound)
+				g.Assert(s.tokens.authorizations["some-token"]).Equal(uint(defs.SecurityDeviceTokenPermissionController))
+			})
+
+			g.It("returns not found without a token in the metadata", func() {
+				s.tokens.authorized = true
+				_, e := s.client.UpdateColor(context.Background(), &interchange.UpdateColorRequest{DeviceID: "123"})
+				g.Assert(status.Code(e)).Equal(codes.NotFound)
+			})
+
+			g.It("publishes a control message w/ the requested frame to the device", func() {
+				s.tokens.authorized = true
+				s.registry.foundDevices = append(s.registry.foundDevices, device.RegistrationDetails{DeviceID: "123"})
+				_, e := s.client.UpdateColor(authorized(), &interchange.UpdateColorRequest{
+					DeviceID: "123",
+					Frame:    &interchange.ControlFrame{Red: 10, Green: 20, Blue: 30},
+				})
+				g.Assert(e).Equal(nil)
+				g.Assert(len(s.publisher.published)).Equal(1)
+				message, control := interchange.DeviceMessage{}, interchange.ControlMessage{}
+				g.Assert(proto.Unmarshal(s.publisher.published[0], &message)).Equal(nil)
+				g.Assert(message.Authentication.DeviceID).Equal("123")
+				g.Assert(proto.Unmarshal(message.Payload, &control)).Equal(nil)
+				g.Assert(control.Frames[0].Green).Equal(uint32(20))
+			})
+
+			g.It("returns the id of the tracked command", func() {
+				s.tokens.authorized = true
+				s.registry.foundDevices = append(s.registry.foundDevices, device.RegistrationDetails{DeviceID: "123"})
+				r, e := s.client.UpdateColor(authorized(), &interchange.UpdateColorRequest{DeviceID: "123"})
+				g.Assert(e).Equal(nil)
+				g.Assert(r.CommandID == "").Equal(false)
+				g.Assert(s.commands.tracked[r.CommandID]).Equal("123")
+			})
+
+			g.It("records the frame as the state of the device and in its command history", func() {
+				s.tokens.authorized = true
+				s.registry.foundDevices = append(s.registry.foundDevices, device.RegistrationDetails{DeviceID: "123"})
+				s.tokens.foundTokens = append(s.tokens.foundTokens, device.TokenDetails{TokenID: "token-1"})
+				r, e := s.client.UpdateColor(authorized(), &interchange.UpdateColorRequest{
+					DeviceID: "123",
+					Frame:    &interchange.ControlFrame{Red: 10, Green: 20, Blue: 30},
+				})
+				g.Assert(e).Equal(nil)
+				g.Assert(s.states.states["123"].Green).Equal(uint32(20))
+				g.Assert(s.history.recorded).Equal([]device.CommandHistoryEntry{
+					{CommandID: r.CommandID, Red: 10, Green: 20, Blue: 30, TokenID: "token-1"},
+				})
+			})
+
+			g.It("returns an internal error w/o publishing if unable to track the command", func() {
+				s.tokens.authorized = true
+				s.commands.trackErrors = append(s.commands.trackErrors, fmt.Errorf("bad-track"))
+				_, e := s.client.UpdateColor(authorized(), &interchange.UpdateColorRequest{DeviceID: "123"})
+				g.Assert(status.Code(e)).Equal(codes.Internal)
+				g.Assert(len(s.publisher.published)).Equal(0)
+			})
+
+			g.It("does not record the state or history of a command that was not published", func() {
+				s.tokens.authorized = true
+				s.publisher.errors = append(s.publisher.errors, fmt.Errorf("bad-publish"))
+				s.client.UpdateColor(authorized(), &interchange.UpdateColorRequest{DeviceID: "123"})
+				g.Assert(len(s.states.states)).Equal(0)
+				g.Assert(len(s.history.recorded)).Equal(0)
+			})
+
+			g.It("marks the tracked command as failed if unable to publish the message", func() {
+				s.tokens.authorized = true
+				s.publisher.errors = append(s.publisher.errors, fmt.Errorf("bad-publish"))
+				s.client.UpdateColor(authorized(), &interchange.UpdateColorRequest{DeviceID: "123"})
+				g.Assert(len(s.commands.statuses)).Equal(1)
+
+				for _, value := range s.commands.statuses {
+					g.Assert(value).Equal(defs.CommandStatusFailed)
+				}
+			})
+
+			g.It("returns an internal error if unable to publish the message", func() {
+				s.tokens.authorized = true
+				s.publisher.errors = append(s.publisher.errors, fmt.Errorf("bad-publish"))
+				_, e := s.client.UpdateColor(authorized(), &interchange.UpdateColorRequest{DeviceID: "123"})
+				g.Assert(status.Code(e)).Equal(codes.Internal)
+			})
+
+			g.It("returns an unavailable error if the command channel is full", func() {
+				s.tokens.authorized = true
+				s.publisher.errors = append(s.publisher.errors, defs.Error(defs.ErrDeviceBusy))
+				_, e := s.client.UpdateColor(authorized(), &interchange.UpdateColorRequest{DeviceID: "123"})
+				g.Assert(status.Code(e)).Equal(codes.Unavailable)
+			})
+
+			g.It("returns an unavailable error while the control channel breaker is open", func() {
+				s.tokens.authorized = true
+				s.publisher.errors = append(s.publisher.errors, defs.Error(defs.ErrControlUnavailable))
+				_, e := s.client.UpdateColor(authorized(), &interchange.UpdateColorRequest{DeviceID: "123"})
+				g.Assert(status.Code(e)).Equal(codes.Unavailable)
+				g.Assert(status.Convert(e).Message()).Equal(defs.ErrControlUnavailable)
+			})
+		})
+
+		g.Describe("ListDevices", func() {
+			g.It("returns an internal error if unable to list the registrations", func() {
+				s.registry.listErrors = append(s.registry.listErrors, fmt.Errorf("bad-list"))
+				_, e := s.client.ListDevices(context.Background(), &interchange.ListDevicesRequest{})
+				g.Assert(status.Code(e)).Equal(codes.Internal)
+			})
+
+			g.It("returns the registrations from the registry", func() {
+				s.registry.registrations = append(s.registry.registrations, device.RegistrationDetails{
+					DeviceID: "123",
+					Name:     "office",
+				})
+				r, e := s.client.ListDevices(context.Background(), &interchange.ListDevicesRequest{})
+				g.Assert(e).Equal(nil)
+				g.Assert(r.Devices[0].Name).Equal("office")
+			})
+		})
+
+		g.Describe("CreateToken", func() {
+			g.It("returns an invalid argument error w/ a short token name", func() {
+				_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{DeviceID: "123"})
+				g.Assert(status.Code(e)).Equal(codes.InvalidArgument)
+			})
+
+			g.It("applies the token name length rule at its boundary", func() {
+				name := strings.Repeat("a", defs.SecurityUserDeviceNameMinLength)
+				_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{DeviceID: "123", Name: name[1:]})
+				g.Assert(status.Code(e)).Equal(codes.InvalidArgument)
+				_, e = s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{DeviceID: "123", Name: name})
+				g.Assert(status.Code(e)).Equal(codes.PermissionDenied)
+			})
+
+			g.It("returns permission denied if the token is not an admin token", func() {
+				_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{
+					DeviceID: "123",
+					Name:     "kitchen",
+				})
+				g.Assert(status.Code(e)).Equal(codes.PermissionDenied)
+				g.Assert(s.tokens.authorizations["some-token"]).Equal(uint(defs.SecurityDeviceTokenPermissionAdmin))
+			})
+
+			g.It("returns the created token", func() {
+				s.tokens.authorized = true
+				s.tokens.foundTokens = append(s.tokens.foundTokens, device.TokenDetails{
+					Permission: defs.SecurityDeviceTokenPermissionAll,
+				})
+				s.tokens.createdTokens = append(s.tokens.createdTokens, device.TokenDetails{Token: "new-token"})
+				r, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{
+					DeviceID: "123",
+					Name:     "kitchen",
+				})
+				g.Assert(e).Equal(nil)
+				g.Assert(r.Token.Token).Equal("new-token")
+			})
+
+			g.It("records a single audit entry for the created token", func() {
+				s.tokens.authorized = true
+				s.registry.foundDevices = append(s.registry.foundDevices, device.RegistrationDetails{DeviceID: "123"})
+				s.tokens.createdTokens = append(s.tokens.createdTokens, device.TokenDetails{TokenID: "new-id"})
+				s.tokens.foundTokens = append(s.tokens.foundTokens, device.TokenDetails{
+					TokenID:    "admin-id",
+					Permission: defs.SecurityDeviceTokenPermissionAll,
+				})
+				s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{DeviceID: "123", Name: "kitchen"})
+				g.Assert(len(s.audit.recorded)).Equal(1)
+				g.Assert(s.audit.recorded[0]).Equal(device.AuditEntry{
+					Action:   defs.AuditTokenCreatedAction,
+					DeviceID: "123",
+					TokenID:  "new-id",
+					ActorID:  "admin-id",
+				})
+			})
+
+			g.It("rejects granting a permission the creating token does not hold", func() {
+				s.tokens.authorized = true
+				s.tokens.foundTokens = append(s.tokens.foundTokens, device.TokenDetails{
+					Permission: defs.SecurityDeviceTokenPermissionAdmin | defs.SecurityDeviceTokenPermissionViewer,
+				})
+				_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{
+					DeviceID:   "123",
+					Name:       "kitchen",
+					Permission: defs.SecurityDeviceTokenPermissionController,
+				})
+				g.Assert(status.Code(e)).Equal(codes.PermissionDenied)
+				g.Assert(status.Convert(e).Message()).Equal(defs.ErrPermissionEscalation)
+				g.Assert(len(s.tokens.createdTokens)).Equal(0)
+			})
+
+			g.It("defaults to the viewer permission when no permission is requested", func() {
+				s.tokens.authorized = true
+				s.tokens.foundTokens = append(s.tokens.foundTokens, device.TokenDetails{
+					Permission: defs.SecurityDeviceTokenPermissionViewer,
+				})
+				_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{DeviceID: "123", Name: "kitchen"})
+				g.Assert(e).Equal(nil)
+				g.Assert(s.tokens.createdPermissions).Equal([]uint{defs.SecurityDeviceTokenPermissionViewer})
+			})
+
+			g.Describe("w/ hierarchical permissions", func() {
+				g.BeforeEach(func() {
+					s.service.HierarchicalPermissions = true
+					s.tokens.authorized = true
+					s.tokens.foundTokens = append(s.tokens.foundTokens, device.TokenDetails{
+						Permission: defs.SecurityDeviceTokenPermissionAdmin,
+					})
+				})
+
+				g.It("allows an admin token to grant the permissions implied by the admin permission", func() {
+					_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{
+						DeviceID:   "123",
+						Name:       "kitchen",
+						Permission: defs.SecurityDeviceTokenPermissionController,
+					})
+					g.Assert(e).Equal(nil)
+					g.Assert(s.tokens.createdPermissions).Equal([]uint{
+						defs.SecurityDeviceTokenPermissionController | defs.SecurityDeviceTokenPermissionViewer,
+					})
+				})
+
+				g.It("normalizes an admin only request to admin, controller and viewer", func() {
+					_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{
+						DeviceID:   "123",
+						Name:       "kitchen",
+						Permission: defs.SecurityDeviceTokenPermissionAdmin,
+					})
+					g.Assert(e).Equal(nil)
+					g.Assert(s.tokens.createdPermissions).Equal([]uint{defs.SecurityDeviceTokenPermissionAll})
+				})
+			})
+
+			g.It("allows the device's shared secret to grant any permission", func() {
+				s.tokens.authorized = true
+				s.registry.foundDevices = append(s.registry.foundDevices, device.RegistrationDetails{
+					DeviceID:     "123",
+					SharedSecret: "some-token",
+				})
+				s.tokens.createdTokens = append(s.tokens.createdTokens, device.TokenDetails{Token: "new-token"})
+				_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{
+					DeviceID:   "123",
+					Name:       "kitchen",
+					Permission: defs.SecurityDeviceTokenPermissionAdmin,
+				})
+				g.Assert(e).Equal(nil)
+			})
+
+			g.It("returns an invalid argument error w/ bits outside of the known permissions", func() {
+				s.tokens.authorized = true
+				_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{
+					DeviceID:   "123",
+					Name:       "kitchen",
+					Permission: defs.SecurityDeviceTokenPermissionAll + 1,
+				})
+				g.Assert(status.Code(e)).Equal(codes.InvalidArgument)
+				g.Assert(status.Convert(e).Message()).Equal(defs.ErrInvalidTokenPermission)
+				g.Assert(len(s.tokens.createdTokens)).Equal(0)
+			})
+
+			g.It("returns an invalid argument error if the store rejects the permission", func() {
+				s.tokens.authorized = true
+				s.tokens.foundTokens = append(s.tokens.foundTokens, device.TokenDetails{
+					Permission: defs.SecurityDeviceTokenPermissionAll,
+				})
+				invalid := defs.Error(defs.ErrInvalidTokenPermission)
+				s.tokens.creationErrors = append(s.tokens.creationErrors, invalid)
+				_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{
+					DeviceID: "123",
+					Name:     "kitchen",
+				})
+				g.Assert(status.Code(e)).Equal(codes.InvalidArgument)
+			})
+
+			g.It("returns an already exists error if the device has a token w/ the name", func() {
+				s.tokens.authorized = true
+				s.tokens.foundTokens = append(s.tokens.foundTokens, device.TokenDetails{
+					Permission: defs.SecurityDeviceTokenPermissionAll,
+				})
+				duplicate := defs.Error(defs.ErrDuplicateTokenName)
+				s.tokens.creationErrors = append(s.tokens.creationErrors, duplicate)
+				_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{
+					DeviceID: "123",
+					Name:     "kitchen",
+				})
+				g.Assert(status.Code(e)).Equal(codes.AlreadyExists)
+				g.Assert(status.Convert(e).Message()).Equal(defs.ErrDuplicateTokenName)
+			})
+
+			g.It("returns an internal error if unable to create the token", func() {
+				s.tokens.authorized = true
+				s.tokens.foundTokens = append(s.tokens.foundTokens, device.TokenDetails{
+					Permission: defs.SecurityDeviceTokenPermissionAll,
+				})
+				s.tokens.creationErrors = append(s.tokens.creationErrors, fmt.Errorf("bad-create"))
+				_, e := s.client.CreateToken(authorized(), &interchange.CreateTokenRequest{
+					DeviceID: "123",
+					Name:     "kitchen",
+				})
+				g.Assert(status.Code(e)).Equal(codes.Internal)
+			})
+		})
+
+		g.Describe("ListFeedback", func() {
+			g.It("returns not found if the token is not authorized to view the device", func() {
+				_, e := s.client.ListFeedback(authorized(), &interchange.ListFeedbackRequest{DeviceID: "123"})
+				g.Assert(status.Code(e)).Equal(codes.NotFound)
+				g.Assert(s.tokens.authorizations["some-token"]).Equal(uint(defs.SecurityDeviceTokenPermissionViewer))
+			})
+
+			g.It("returns the feedback entries from the feedback store", func() {
+				s.tokens.authorized = true
+				s.feedback.listResults = append(s.feedback.listResults, interchange.FeedbackMessage{
+					Payload: []byte("hello"),
+				})
+				r, e := s.client.ListFeedback(authorized(), &interchange.ListFeedbackRequest{DeviceID: "123", Count: 5})
+				g.Assert(e).Equal(nil)
+				g.Assert(string(r.Feedback[0].Payload)).Equal("hello")
+				g.Assert(s.feedback.listCounts).Equal([]int{4})
+			})
+
+			g.It("defaults the count when it is missing or not positive", func() {
+				s.tokens.authorized = true
+				s.client.ListFeedback(authorized(), &interchange.ListFeedbackRequest{DeviceID: "123"})
+				s.client.ListFeedback(authorized(), &interchange.ListFeedbackRequest{DeviceID: "123", Count: -4})
+				g.Assert(s.feedback.listCounts).Equal([]int{
+					defs.DefaultFeedbackListCount - 1,
+					defs.DefaultFeedbackListCount - 1,
+				})
+			})
+
+			g.It("clamps a count above the maximum list count", func() {
+				s.tokens.authorized = true
+				s.client.ListFeedback(authorized(), &interchange.ListFeedbackRequest{DeviceID: "123", Count: 1000})
+				g.Assert(s.feedback.listCounts).Equal([]int{defs.MaxFeedbackListCount - 1})
+			})
+
+			g.It("uses the configured default and maximum counts", func() {
+				s.tokens.authorized = true
+				s.service.ListCount, s.service.MaxListCount = 3, 40
+				s.client.ListFeedback(authorized(), &interchange.ListFeedbackRequest{DeviceID: "123"})
+				s.client.ListFeedback(authorized(), &interchange.ListFeedbackRequest{DeviceID: "123", Count: 50})
+				g.Assert(s.feedback.listCounts).Equal([]int{2, 39})
+			})
+
+			g.It("filters the feedback entries by the requested minimum level", func() {
+				s.tokens.authorized = true
+				request := &interchange.ListFeedbackRequest{
+					DeviceID:     "123",
+					Count:        5,
+					MinimumLevel: interchange.FeedbackLevel_LEVEL_ERROR,
+				}
+				_, e := s.client.ListFeedback(authorized(), request)
+				g.Assert(e).Equal(nil)
+				g.Assert(s.feedback.levelCalls).Equal([]interchange.FeedbackLevel{interchange.FeedbackLevel_LEVEL_ERROR})
+				g.Assert(s.feedback.listCounts).Equal([]int{5})
+			})
+
+			g.It("returns an internal error if unable to list the feedback", func() {
+				s.tokens.authorized = true
+				s.feedback.listErrors = append(s.feedback.listErrors, fmt.Errorf("bad-list"))
+				_, e := s.client.ListFeedback(authorized(), &interchange.ListFeedbackRequest{DeviceID: "123"})
+				g.Assert(status.Code(e)).Equal(codes.Internal)
+			})
+		})
+	})
+}
@@ -0,0 +1,42 @@
+package rpc
+
+import "net"
+import "sync"
+import "google.golang.org/grpc"
+
+import "github.com/dadleyy/beacon.api/beacon/bg"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+// NewProcessor returns a background processor that serves the device control service along the listener.
+func NewProcessor(listener net.Listener, service interchange.DeviceControlServer) *Processor {
+	logger := logging.New(defs.DeviceControlRPCLogPrefix, logging.Green)
+	server := grpc.NewServer()
+	interchange.RegisterDeviceControlServer(server, service)
+	return &Processor{logger, server, listener}
+}
+
+// Processor implements the bg.Processor interface, serving grpc requests until the kill switch is received.
+type Processor struct {
+	logging.LeveledLogger
+	*grpc.Server
+	listener net.Listener
+}
+
+// Start is the Processor#Start implementation
+func (processor *Processor) Start(wg *sync.WaitGroup, stop bg.KillSwitch) {
+	defer wg.Done()
+
+	go func() {
+		processor.Infof("grpc server listening on: %s", processor.listener.Addr().String())
+
+		if e := processor.Serve(processor.listener); e != nil {
+			processor.Warnf("grpc server stopped: %s", e.Error())
+		}
+	}()
+
+	<-stop
+	processor.Warnf("received kill signal, stopping grpc server")
+	processor.GracefulStop()
+}
@@ -0,0 +1,283 @@
+package rpc
+
+import "io"
+import "fmt"
+import "log"
+import "time"
+import "bytes"
+import "io/ioutil"
+
+import "github.com/dadleyy/beacon.api/beacon/device"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+import "github.com/dadleyy/beacon.api/beacon/interchange"
+
+func newTestLogger() *logging.Logger {
+	out := bytes.NewBuffer([]byte{})
+	logger := log.New(out, "", 0)
+	logger.SetFlags(0)
+	return &logging.Logger{Logger: logger}
+}
+
+type testRegistry struct {
+	foundDevices  []device.RegistrationDetails
+	findErrors    []error
+	registrations []device.RegistrationDetails
+	listErrors    []error
+}
+
+func (r *testRegistry) FindDevice(string) (device.RegistrationDetails, error) {
+	if len(r.findErrors) >= 1 {
+		return device.RegistrationDetails{}, r.findErrors[0]
+	}
+
+	if len(r.foundDevices) >= 1 {
+		return r.foundDevices[0], nil
+	}
+
+	return device.RegistrationDetails{}, nil
+}
+
+func (r *testRegistry) RemoveDevice(string) error {
+	return nil
+}
+
+func (r *testRegistry) RemoveDevices([]string) (map[string]error, error) {
+	return nil, nil
+}
+
+func (r *testRegistry) ReissueRegistration(string, string) error {
+	return nil
+}
+
+func (r *testRegistry) ListRegistrations() ([]device.RegistrationDetails, error) {
+	if len(r.listErrors) >= 1 {
+		return nil, r.listErrors[0]
+	}
+
+	return r.registrations, nil
+}
+
+func (r *testRegistry) FindDevices(string) ([]device.RegistrationDetails, error) {
+	return nil, nil
+}
+
+func (r *testRegistry) SetDeviceMeta(string, map[string]string) error {
+	return nil
+}
+
+func (r *testRegistry) RenameDevice(string, string) error {
+	return nil
+}
+
+func (r *testRegistry) GetDeviceMeta(string) (map[string]string, error) {
+	return nil, nil
+}
+
+func (r *testRegistry) DeviceExists(string) (bool, error) {
+	return len(r.registrations) >= 1, nil
+}
+
+func (r *testRegistry) AllocateRegistration(device.RegistrationRequest) error {
+	return nil
+}
+
+func (r *testRegistry) ListPendingRegistrations() ([]device.RegistrationRequest, error) {
+	return nil, nil
+}
+
+func (r *testRegistry) FillRegistration(secret, id string) (string, error) {
+	return id, nil
+}
+
+type testTokenStore struct {
+	authorized         bool
+	authorizations     map[string]uint
+	createdTokens      []device.TokenDetails
+	createdPermissions []uint
+	creationErrors     []error
+	foundTokens        []device.TokenDetails
+}
+
+func (t *testTokenStore) AuthorizeToken(deviceID string, token string, permission uint) bool {
+	if t.authorizations == nil {
+		t.authorizations = make(map[string]uint)
+	}
+
+	t.authorizations[token] = permission
+	return t.authorized
+}
+
+func (t *testTokenStore) FindToken(string) (device.TokenDetails, error) {
+	if len(t.foundTokens) >= 1 {
+		return t.foundTokens[0], nil
+	}
+
+	return device.TokenDetails{}, fmt.Errorf("not-found")
+}
+
+func (t *testTokenStore) ListTokens(string) ([]device.TokenDetails, error) {
+	return nil, nil
+}
+
+func (t *testTokenStore) ListAllTokens(int) ([]device.TokenDetails, error) {
+	return nil, nil
+}
+
+func (t *testTokenStore) CreateToken(deviceID string, name string, permission uint) (device.TokenDetails, error) {
+	t.createdPermissions = append(t.createdPermissions, permission)
+
+	if len(t.creationErrors) >= 1 {
+		return device.TokenDetails{}, t.creationErrors[0]
+	}
+
+	if len(t.createdTokens) >= 1 {
+		return t.createdTokens[0], nil
+	}
+
+	return device.TokenDetails{}, nil
+}
+
+type testFeedbackStore struct {
+	listResults []interchange.FeedbackMessage
+	listErrors  []error
+	listCounts  []int
+	levelCalls  []interchange.FeedbackLevel
+}
+
+func (t *testFeedbackStore) LogFeedback(interchange.FeedbackMessage) error {
+	return nil
+}
+
+func (t *testFeedbackStore) RecordFeedback(interchange.FeedbackMessage) error {
+	return nil
+}
+
+func (t *testFeedbackStore) LogFeedbackBatch([]interchange.FeedbackMessage) error {
+	return nil
+}
+
+func (t *testFeedbackStore) ListFeedback(deviceID string, count int) ([]interchange.FeedbackMessage, error) {
+	t.listCounts = append(t.listCounts, count)
+
+	if len(t.listErrors) >= 1 {
+		return nil, t.listErrors[0]
+	}
+
+	return t.listResults, nil
+}
+
+func (t *testFeedbackStore) ListFeedbackPage(
+	deviceID string,
+	_ string,
+	count int,
+) ([]interchange.FeedbackMessage, string, error) {
+	results, e := t.ListFeedback(deviceID, count)
+	return results, "", e
+}
+
+func (t *testFeedbackStore) ListFeedbackByLevel(
+	deviceID string,
+	count int,
+	level interchange.FeedbackLevel,
+) ([]interchange.FeedbackMessage, error) {
+	t.levelCalls = append(t.levelCalls, level)
+	return t.ListFeedback(deviceID, count)
+}
+
+func (t *testFeedbackStore) FeedbackStats(string, time.Duration) (map[string]int, error) {
+	return nil, nil
+}
+
+func (t *testFeedbackStore) QueryFeedback(string, device.FeedbackQuery) ([]interchange.FeedbackMessage, error) {
+	return nil, nil
+}
+
+type testAuditLog struct {
+	recorded []device.AuditEntry
+}
+
+func (t *testAuditLog) RecordAudit(entry device.AuditEntry) error {
+	t.recorded = append(t.recorded, entry)
+	return nil
+}
+
+func (t *testAuditLog) ListAuditLog(int) ([]device.AuditEntry, error) {
+	return t.recorded, nil
+}
+
+type testPublisher struct {
+	published [][]byte
+	errors    []error
+}
+
+func (p *testPublisher) PublishReader(channel string, reader io.Reader) error {
+	if len(p.errors) >= 1 {
+		return p.errors[0]
+	}
+
+	data, _ := ioutil.ReadAll(reader)
+	p.published = append(p.published, data)
+	return nil
+}
+
+type testCommandStore struct {
+	tracked     map[string]string
+	statuses    map[string]string
+	trackErrors []error
+}
+
+func (t *testCommandStore) TrackCommand(commandID, deviceID string) error {
+	if len(t.trackErrors) >= 1 {
+		return t.trackErrors[0]
+	}
+
+	if t.tracked == nil {
+		t.tracked = make(map[string]string)
+	}
+
+	t.tracked[commandID] = deviceID
+	return nil
+}
+
+func (t *testCommandStore) UpdateCommandStatus(commandID, deviceID, status string) error {
+	if t.statuses == nil {
+		t.statuses = make(map[string]string)
+	}
+
+	t.statuses[commandID] = status
+	return nil
+}
+
+func (t *testCommandStore) GetCommandStatus(string) (device.CommandStatus, error) {
+	return device.CommandStatus{}, nil
+}
+
+type testStateStore struct {
+	states map[string]interchange.ControlFrame
+}
+
+func (t *testStateStore) SetDeviceState(deviceID string, frame interchange.ControlFrame) error {
+	if t.states == nil {
+		t.states = make(map[string]interchange.ControlFrame)
+	}
+
+	t.states[deviceID] = frame
+	return nil
+}
+
+func (t *testStateStore) GetDeviceState(deviceID string) (device.DeviceState, error) {
+	return device.DeviceState{}, nil
+}
+
+type testCommandHistory struct {
+	recorded []device.CommandHistoryEntry
+}
+
+func (t *testCommandHistory) RecordCommand(deviceID string, entry device.CommandHistoryEntry) error {
+	t.recorded = append(t.recorded, entry)
+	return nil
+}
+
+func (t *testCommandHistory) ListCommandHistory(string, int) ([]device.CommandHistoryEntry, error) {
+	return t.recorded, nil
+}
@@ -27,6 +27,12 @@ func (key *DeviceKey) Sign(out io.Writer, data []byte) error {
 	return e
 }
 
+// MatchesCertificate returns true when the certificate was issued for the device's public key.
+func (key *DeviceKey) MatchesCertificate(certificate *x509.Certificate) bool {
+	public, ok := certificate.PublicKey.(*rsa.PublicKey)
+	return ok && public.E == key.E && public.N.Cmp(key.N) == 0
+}
+
 // ParseDeviceKey returns a parsed device key capable of encoding device messages from a hex encoded byte array
 func ParseDeviceKey(data string) (*DeviceKey, error) {
 	block, e := hex.DecodeString(data)
@@ -0,0 +1,90 @@
+package security
+
+import "fmt"
+import "strings"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+var permissionNames = []struct {
+	name string
+	mask uint
+}{
+	{defs.SecurityDeviceTokenPermissionViewerName, defs.SecurityDeviceTokenPermissionViewer},
+	{defs.SecurityDeviceTokenPermissionControllerName, defs.SecurityDeviceTokenPermissionController},
+	{defs.SecurityDeviceTokenPermissionAdminName, defs.SecurityDeviceTokenPermissionAdmin},
+}
+
+// ParsePermissions translates a list of permission names into the device token permission bitmask.
+func ParsePermissions(names []string) (uint, error) {
+	var mask uint
+
+	for _, name := range names {
+		found := false
+
+		for _, permission := range permissionNames {
+			if strings.ToLower(strings.TrimSpace(name)) != permission.name {
+				continue
+			}
+
+			mask, found = mask|permission.mask, true
+			break
+		}
+
+		if found != true {
+			return 0, fmt.Errorf(defs.ErrInvalidTokenPermission)
+		}
+	}
+
+	return mask, nil
+}
+
+// FormatPermissions returns the names of each permission set in the device token permission bitmask.
+func FormatPermissions(mask uint) []string {
+	names := make([]string, 0, len(permissionNames))
+
+	for _, permission := range permissionNames {
+		if mask&permission.mask == permission.mask {
+			names = append(names, permission.name)
+		}
+	}
+
+	return names
+}
+
+// ExpandPermissions treats the device token permissions as a hierarchy, returning the mask w/ every permission implied
+// by the ones it holds: admin implies controller, which in turn implies viewer.
+func ExpandPermissions(mask uint) uint {
+	if mask&defs.SecurityDeviceTokenPermissionAdmin != 0 {
+		mask |= defs.SecurityDeviceTokenPermissionController
+	}
+
+	if mask&defs.SecurityDeviceTokenPermissionController != 0 {
+		mask |= defs.SecurityDeviceTokenPermissionViewer
+	}
+
+	return mask
+}
+
+// NormalizePermissions returns the mask a device token is created w/: the viewer permission when none of the known
+// permissions are requested, expanded into the permissions it implies when permissions are hierarchical.
+func NormalizePermissions(mask uint, hierarchical bool) uint {
+	if mask&defs.SecurityDeviceTokenPermissionAll == 0 {
+		mask = defs.SecurityDeviceTokenPermissionViewer
+	}
+
+	if hierarchical {
+		mask = ExpandPermissions(mask)
+	}
+
+	return mask
+}
+
+// Escalates returns true if the requested mask holds any permission missing from the mask held by the token granting
+// it. Tokens created before hierarchical permissions were enabled hold the implied permissions all the same.
+func Escalates(requested uint, held uint, hierarchical bool) bool {
+	if hierarchical {
+		held = ExpandPermissions(held)
+	}
+
+	return requested&^held != 0
+}
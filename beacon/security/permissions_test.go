@@ -0,0 +1,114 @@
+package security
+
+import "testing"
+import "reflect"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+func Test_ParsePermissions(suite *testing.T) {
+	mask, e := ParsePermissions([]string{"viewer", "Admin"})
+
+	if e != nil {
+		suite.Fatalf("expected valid permission names to parse but got: %s", e.Error())
+	}
+
+	if mask != defs.SecurityDeviceTokenPermissionViewer|defs.SecurityDeviceTokenPermissionAdmin {
+		suite.Fatalf("expected viewer + admin mask but got %b", mask)
+	}
+
+	if _, e := ParsePermissions([]string{"viewer", "superuser"}); e == nil || e.Error() != defs.ErrInvalidTokenPermission {
+		suite.Fatalf("expected unknown permission name to be rejected")
+	}
+}
+
+func Test_FormatPermissions(suite *testing.T) {
+	names := FormatPermissions(defs.SecurityDeviceTokenPermissionAll)
+	expected := []string{"viewer", "controller", "admin"}
+
+	if reflect.DeepEqual(names, expected) != true {
+		suite.Fatalf("expected %v but got %v", expected, names)
+	}
+
+	if names := FormatPermissions(0); names == nil || len(names) != 0 {
+		suite.Fatalf("expected an empty list for an empty mask but got %v", names)
+	}
+
+	mask, e := ParsePermissions(FormatPermissions(defs.SecurityDeviceTokenPermissionController))
+
+	if e != nil || mask != defs.SecurityDeviceTokenPermissionController {
+		suite.Fatalf("expected format + parse round trip to preserve the mask but got %b", mask)
+	}
+}
+
+func Test_ExpandPermissions(suite *testing.T) {
+	viewer, controller, admin := uint(defs.SecurityDeviceTokenPermissionViewer),
+		uint(defs.SecurityDeviceTokenPermissionController),
+		uint(defs.SecurityDeviceTokenPermissionAdmin)
+
+	cases := []struct {
+		mask     uint
+		expected uint
+	}{
+		{0, 0},
+		{viewer, viewer},
+		{controller, controller | viewer},
+		{admin, admin | controller | viewer},
+		{admin | viewer, admin | controller | viewer},
+	}
+
+	for _, c := range cases {
+		if expanded := ExpandPermissions(c.mask); expanded != c.expected {
+			suite.Fatalf("expected %b to expand to %b but got %b", c.mask, c.expected, expanded)
+		}
+	}
+}
+
+func Test_NormalizePermissions(suite *testing.T) {
+	viewer, controller, admin := uint(defs.SecurityDeviceTokenPermissionViewer),
+		uint(defs.SecurityDeviceTokenPermissionController),
+		uint(defs.SecurityDeviceTokenPermissionAdmin)
+
+	cases := []struct {
+		mask         uint
+		hierarchical bool
+		expected     uint
+	}{
+		{0, false, viewer},
+		{0, true, viewer},
+		{admin, false, admin},
+		{admin, true, admin | controller | viewer},
+		{controller, true, controller | viewer},
+	}
+
+	for _, c := range cases {
+		if normalized := NormalizePermissions(c.mask, c.hierarchical); normalized != c.expected {
+			suite.Fatalf("expected %b to normalize to %b but got %b (%v)", c.mask, c.expected, normalized, c.hierarchical)
+		}
+	}
+}
+
+func Test_Escalates(suite *testing.T) {
+	viewer, controller, admin := uint(defs.SecurityDeviceTokenPermissionViewer),
+		uint(defs.SecurityDeviceTokenPermissionController),
+		uint(defs.SecurityDeviceTokenPermissionAdmin)
+
+	cases := []struct {
+		requested    uint
+		held         uint
+		hierarchical bool
+		expected     bool
+	}{
+		{viewer, viewer, false, false},
+		{controller, viewer, false, true},
+		{controller, admin, false, true},
+		{controller, admin, true, false},
+		{controller | viewer, admin, true, false},
+		{admin, controller, true, true},
+	}
+
+	for _, c := range cases {
+		if escalates := Escalates(c.requested, c.held, c.hierarchical); escalates != c.expected {
+			suite.Fatalf("expected %b granted by %b (%v) to escalate: %v", c.requested, c.held, c.hierarchical, c.expected)
+		}
+	}
+}
@@ -1,12 +1,19 @@
 package security
 
+import "io"
 import "fmt"
+import "crypto"
 import "io/ioutil"
 import "crypto/rsa"
+import "crypto/rand"
 import "crypto/x509"
+import "crypto/sha256"
+import "crypto/subtle"
 import "encoding/pem"
 import "encoding/hex"
 
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
 // ServerKey objects contain the rsa private key used to secure communications w/ the api
 type ServerKey struct {
 	*rsa.PrivateKey
@@ -23,6 +30,43 @@ func (key *ServerKey) SharedSecret() (string, error) {
 	return hex.EncodeToString(publicKeyData), nil
 }
 
+// Sign implements the signer interface, writing the PKCS #1 v1.5 signature of the sha256 digest w/ the private key so
+// that clients can verify the data came from the server using its shared secret.
+func (key *ServerKey) Sign(out io.Writer, digest []byte) error {
+	signature, e := rsa.SignPKCS1v15(rand.Reader, key.PrivateKey, crypto.SHA256, digest)
+
+	if e != nil {
+		return e
+	}
+
+	_, e = out.Write(signature)
+	return e
+}
+
+// Verify implements the verifier interface; the digest is expected to be the sha256 hash of the payload, encrypted by
+// the device w/ the public key sent to it as the shared secret.
+func (key *ServerKey) Verify(digest string, payload []byte) error {
+	block, e := hex.DecodeString(digest)
+
+	if e != nil {
+		return fmt.Errorf(defs.ErrBadInterchangeAuthentication)
+	}
+
+	decrypted, e := rsa.DecryptOAEP(sha256.New(), rand.Reader, key.PrivateKey, block, []byte(defs.DeviceMessageLabel))
+
+	if e != nil {
+		return fmt.Errorf(defs.ErrBadInterchangeAuthentication)
+	}
+
+	expected := sha256.Sum256(payload)
+
+	if subtle.ConstantTimeCompare(decrypted, expected[:]) != 1 {
+		return fmt.Errorf(defs.ErrBadInterchangeAuthentication)
+	}
+
+	return nil
+}
+
 // ReadServerKeyFromFile returns a new device key from a filename
 func ReadServerKeyFromFile(filename string) (*ServerKey, error) {
 	privateKeyData, e := ioutil.ReadFile(filename)
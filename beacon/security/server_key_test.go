@@ -0,0 +1,62 @@
+package security
+
+import "bytes"
+import "crypto"
+import "testing"
+import "crypto/rsa"
+import "crypto/rand"
+import "crypto/sha256"
+import "encoding/hex"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+func signedDigest(key *rsa.PrivateKey, payload []byte) string {
+	hash := sha256.Sum256(payload)
+	label := []byte(defs.DeviceMessageLabel)
+	encrypted, _ := rsa.EncryptOAEP(sha256.New(), rand.Reader, &key.PublicKey, hash[:], label)
+	return hex.EncodeToString(encrypted)
+}
+
+func Test_ServerKeyVerify(suite *testing.T) {
+	private, _ := rsa.GenerateKey(rand.Reader, 1024)
+	key := &ServerKey{PrivateKey: private}
+	payload := []byte("feedback")
+
+	if e := key.Verify(signedDigest(private, payload), payload); e != nil {
+		suite.Fatalf("expected valid digest to verify but got: %s", e.Error())
+	}
+
+	if e := key.Verify(signedDigest(private, []byte("other")), payload); e == nil {
+		suite.Fatalf("expected digest of a different payload to fail verification")
+	}
+
+	if e := key.Verify("not-hex", payload); e == nil {
+		suite.Fatalf("expected invalid hex digest to fail verification")
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	if e := key.Verify(signedDigest(other, payload), payload); e == nil {
+		suite.Fatalf("expected digest encrypted for another key to fail verification")
+	}
+}
+
+func Test_ServerKeySign(suite *testing.T) {
+	private, _ := rsa.GenerateKey(rand.Reader, 1024)
+	key, signature := &ServerKey{PrivateKey: private}, bytes.NewBuffer([]byte{})
+	digest := sha256.Sum256([]byte("feedback"))
+
+	if e := key.Sign(signature, digest[:]); e != nil {
+		suite.Fatalf("expected to sign digest but got: %s", e.Error())
+	}
+
+	if e := rsa.VerifyPKCS1v15(&private.PublicKey, crypto.SHA256, digest[:], signature.Bytes()); e != nil {
+		suite.Fatalf("expected signature to verify against the public key but got: %s", e.Error())
+	}
+
+	other := sha256.Sum256([]byte("other"))
+
+	if e := rsa.VerifyPKCS1v15(&private.PublicKey, crypto.SHA256, other[:], signature.Bytes()); e == nil {
+		suite.Fatalf("expected signature to fail verification against the digest of different data")
+	}
+}
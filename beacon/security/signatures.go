@@ -0,0 +1,26 @@
+package security
+
+import "crypto"
+import "crypto/rsa"
+import "crypto/sha256"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+// VerifySignature checks the PKCS #1 v1.5 signature of the sha256 digest of the payload against the hex encoded PKIX
+// public key, parsed the same way as the keys devices register w/. Keys that are unable to be parsed return the invalid
+// device key error, signatures that do not match the invalid signature error.
+func VerifySignature(publicKey string, payload, signature []byte) error {
+	key, e := ParseDeviceKey(publicKey)
+
+	if e != nil {
+		return defs.Error(defs.ErrInvalidDeviceKey)
+	}
+
+	digest := sha256.Sum256(payload)
+
+	if e := rsa.VerifyPKCS1v15(key.PublicKey, crypto.SHA256, digest[:], signature); e != nil {
+		return defs.Error(defs.ErrInvalidDeviceSignature)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package security
+
+import "crypto"
+import "testing"
+import "crypto/rsa"
+import "crypto/rand"
+import "crypto/ecdsa"
+import "crypto/x509"
+import "crypto/sha256"
+import "crypto/elliptic"
+import "encoding/hex"
+
+import "github.com/dadleyy/beacon.api/beacon/defs"
+
+func encodePublicKey(key interface{}) string {
+	data, _ := x509.MarshalPKIXPublicKey(key)
+	return hex.EncodeToString(data)
+}
+
+func Test_VerifySignatureRSA(suite *testing.T) {
+	private, _ := rsa.GenerateKey(rand.Reader, 1024)
+	payload := []byte("feedback")
+	digest := sha256.Sum256(payload)
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+	public := encodePublicKey(&private.PublicKey)
+
+	if e := VerifySignature(public, payload, signature); e != nil {
+		suite.Fatalf("expected valid signature to verify but got: %s", e.Error())
+	}
+
+	if e := VerifySignature(public, []byte("tampered"), signature); e != defs.Error(defs.ErrInvalidDeviceSignature) {
+		suite.Fatalf("expected signature of a different payload to fail verification, got: %v", e)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	if e := VerifySignature(encodePublicKey(&other.PublicKey), payload, signature); e == nil {
+		suite.Fatalf("expected signature made w/ another key to fail verification")
+	}
+}
+
+func Test_VerifySignatureECDSA(suite *testing.T) {
+	private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	payload := []byte("feedback")
+	digest := sha256.Sum256(payload)
+	signature, _ := private.Sign(rand.Reader, digest[:], crypto.SHA256)
+
+	public := encodePublicKey(&private.PublicKey)
+
+	// Devices are only able to register w/ RSA keys.
+	if e := VerifySignature(public, payload, signature); e != defs.Error(defs.ErrInvalidDeviceKey) {
+		suite.Fatalf("expected ecdsa key to be rejected, got: %v", e)
+	}
+}
+
+func Test_VerifySignatureInvalidKey(suite *testing.T) {
+	for _, key := range []string{"not-hex", hex.EncodeToString([]byte("not-a-key"))} {
+		if e := VerifySignature(key, []byte("feedback"), []byte("signature")); e != defs.Error(defs.ErrInvalidDeviceKey) {
+			suite.Fatalf("expected key %s to be rejected, got: %v", key, e)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package webhook
+
+import "time"
+
+// Event is the json document posted to the webhook url for each device event.
+type Event struct {
+	Type      string      `json:"type"`
+	DeviceID  string      `json:"device_id"`
+	Timestamp time.Time   `json:"ts"`
+	Payload   interface{} `json:"payload"`
+}
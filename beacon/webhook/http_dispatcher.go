@@ -0,0 +1,116 @@
+package webhook
+
+import "fmt"
+import "sync"
+import "time"
+import "bytes"
+import "net/http"
+import "encoding/json"
+
+import "github.com/dadleyy/beacon.api/beacon/bg"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+
+// NewHTTPDispatcher returns a dispatcher that will post events to the provided url.
+func NewHTTPDispatcher(url string) *HTTPDispatcher {
+	logger := logging.New(defs.WebhookDispatcherLogPrefix, logging.Blue)
+
+	return &HTTPDispatcher{
+		LeveledLogger: logger,
+		Client:        &http.Client{Timeout: defs.DefaultWebhookTimeout},
+		URL:           url,
+		MaxAttempts:   defs.DefaultWebhookMaxAttempts,
+		Backoff:       defs.DefaultWebhookBackoff,
+		events:        make(chan Event, defs.DefaultWebhookBufferSize),
+	}
+}
+
+// HTTPDispatcher implements the device.EventDispatcher interface by queuing events onto a buffered channel that is
+// drained by the dispatcher's Start method, which delivers each event to the webhook url w/ retries.
+type HTTPDispatcher struct {
+	logging.LeveledLogger
+	*http.Client
+	URL         string
+	MaxAttempts int
+	Backoff     time.Duration
+	events      chan Event
+}
+
+// Dispatch queues the event for delivery. If the buffer is full the event is dropped so callers are never blocked.
+func (dispatcher *HTTPDispatcher) Dispatch(eventType, deviceID string, payload interface{}) {
+	event := Event{
+		Type:      eventType,
+		DeviceID:  deviceID,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	}
+
+	select {
+	case dispatcher.events <- event:
+		dispatcher.Debugf("queued %s event for device[%s]", eventType, deviceID)
+	default:
+		dispatcher.Warnf("event buffer full, dropping %s event for device[%s]", eventType, deviceID)
+	}
+}
+
+// Start is the Processor#Start implementation, delivering queued events until the kill switch is sent.
+func (dispatcher *HTTPDispatcher) Start(wg *sync.WaitGroup, stop bg.KillSwitch) {
+	defer wg.Done()
+
+	dispatcher.Infof("webhook dispatcher starting")
+
+	for {
+		select {
+		case event := <-dispatcher.events:
+			if e := dispatcher.deliver(event); e != nil {
+				dispatcher.Errorf("unable to deliver %s event for device[%s]: %s", event.Type, event.DeviceID, e.Error())
+			}
+		case <-stop:
+			dispatcher.Warnf("received kill signal, breaking")
+			return
+		}
+	}
+}
+
+// deliver attempts to post the event, backing off between each failed attempt.
+func (dispatcher *HTTPDispatcher) deliver(event Event) error {
+	body, e := json.Marshal(event)
+
+	if e != nil {
+		return e
+	}
+
+	attempts, backoff := dispatcher.MaxAttempts, dispatcher.Backoff
+
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		e = dispatcher.post(body)
+
+		if e == nil || attempt >= attempts {
+			return e
+		}
+
+		dispatcher.Warnf("delivery attempt %d of %d failed: %s", attempt, attempts, e.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (dispatcher *HTTPDispatcher) post(body []byte) error {
+	response, e := dispatcher.Post(dispatcher.URL, defs.WebhookContentType, bytes.NewBuffer(body))
+
+	if e != nil {
+		return e
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf(defs.ErrWebhookDelivery)
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package webhook
+
+import "log"
+import "sync"
+import "time"
+import "bytes"
+import "testing"
+import "net/http"
+import "io/ioutil"
+import "encoding/json"
+import "net/http/httptest"
+import "github.com/franela/goblin"
+
+import "github.com/dadleyy/beacon.api/beacon/bg"
+import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/logging"
+
+type testWebhookServer struct {
+	sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	received chan struct{}
+}
+
+func (s *testWebhookServer) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	body, _ := ioutil.ReadAll(request.Body)
+	s.bodies = append(s.bodies, body)
+
+	status := http.StatusOK
+
+	if len(s.statuses) >= 1 {
+		status = s.statuses[0]
+		s.statuses = s.statuses[1:]
+	}
+
+	response.WriteHeader(status)
+	s.received <- struct{}{}
+}
+
+type httpDispatcherScaffold struct {
+	handler    *testWebhookServer
+	server     *httptest.Server
+	dispatcher *HTTPDispatcher
+	wg         *sync.WaitGroup
+	kill       bg.KillSwitch
+	log        *bytes.Buffer
+}
+
+func (s *httpDispatcherScaffold) Reset() {
+	s.handler = &testWebhookServer{received: make(chan struct{}, 10)}
+	s.server = httptest.NewServer(s.handler)
+	s.log = bytes.NewBuffer([]byte{})
+	s.wg = &sync.WaitGroup{}
+	s.kill = make(bg.KillSwitch)
+
+	logger := log.New(s.log, "", 0)
+
+	s.dispatcher = &HTTPDispatcher{
+		LeveledLogger: &logging.Logger{Logger: logger},
+		Client:        s.server.Client(),
+		URL:           s.server.URL,
+		MaxAttempts:   3,
+		Backoff:       time.Millisecond,
+		events:        make(chan Event, 1),
+	}
+}
+
+func (s *httpDispatcherScaffold) start() {
+	s.wg.Add(1)
+	go s.dispatcher.Start(s.wg, s.kill)
+}
+
+func (s *httpDispatcherScaffold) stop() {
+	s.kill <- struct{}{}
+	s.wg.Wait()
+	s.server.Close()
+}
+
+func (s *httpDispatcherScaffold) waitForRequests(count int) {
+	for i := 0; i < count; i++ {
+		<-s.handler.received
+	}
+}
+
+func Test_HTTPDispatcher(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	s := &httpDispatcherScaffold{}
+
+	g.Describe("HTTPDispatcher", func() {
+		g.BeforeEach(s.Reset)
+
+		g.It("posts the event type, device id and payload as json", func() {
+			s.start()
+			s.dispatcher.Dispatch(defs.WebhookDeviceRegisteredEvent, "device-123", map[string]string{"hello": "world"})
+			s.waitForRequests(1)
+			s.stop()
+
+			event := struct {
+				Type      string            `json:"type"`
+				DeviceID  string            `json:"device_id"`
+				Timestamp time.Time         `json:"ts"`
+				Payload   map[string]string `json:"payload"`
+			}{}
+
+			g.Assert(json.Unmarshal(s.handler.bodies[0], &event)).Equal(nil)
+			g.Assert(event.Type).Equal(defs.WebhookDeviceRegisteredEvent)
+			g.Assert(event.DeviceID).Equal("device-123")
+			g.Assert(event.Payload["hello"]).Equal("world")
+			g.Assert(event.Timestamp.IsZero()).Equal(false)
+		})
+
+		g.It("retries delivery when the webhook responds w/ a failure status", func() {
+			s.handler.statuses = []int{http.StatusInternalServerError, http.StatusBadGateway}
+			s.start()
+			s.dispatcher.Dispatch(defs.WebhookDeviceFeedbackEvent, "device-123", nil)
+			s.waitForRequests(3)
+			s.stop()
+			g.Assert(len(s.handler.bodies)).Equal(3)
+			g.Assert(bytes.Equal(s.handler.bodies[0], s.handler.bodies[2])).Equal(true)
+		})
+
+		g.It("gives up after the maximum amount of attempts", func() {
+			s.handler.statuses = []int{500, 500, 500, 500}
+			s.start()
+			s.dispatcher.Dispatch(defs.WebhookDeviceDisconnectedEvent, "device-123", nil)
+			s.waitForRequests(3)
+			s.stop()
+			g.Assert(len(s.handler.bodies)).Equal(3)
+			g.Assert(bytes.Contains(s.log.Bytes(), []byte(defs.ErrWebhookDelivery))).Equal(true)
+		})
+
+		g.It("drops events rather than blocking when the buffer is full", func() {
+			s.dispatcher.Dispatch(defs.WebhookDeviceFeedbackEvent, "device-123", nil)
+			s.dispatcher.Dispatch(defs.WebhookDeviceFeedbackEvent, "device-456", nil)
+			g.Assert(bytes.Contains(s.log.Bytes(), []byte("dropping"))).Equal(true)
+			s.server.Close()
+		})
+	})
+}
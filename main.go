@@ -6,27 +6,29 @@ import "fmt"
 import "log"
 import "flag"
 import "sync"
+import "time"
 import "context"
 import "syscall"
-import "net/url"
+import stdnet "net"
 import "net/http"
 import "os/signal"
 
-import "crypto/rand"
-import "encoding/hex"
+import "crypto/tls"
 
 import "github.com/joho/godotenv"
 import "github.com/gorilla/websocket"
-import "github.com/garyburd/redigo/redis"
 
 import "github.com/dadleyy/beacon.api/beacon/bg"
 import "github.com/dadleyy/beacon.api/beacon/net"
 import "github.com/dadleyy/beacon.api/beacon/defs"
+import "github.com/dadleyy/beacon.api/beacon/rpc"
+import "github.com/dadleyy/beacon.api/beacon/mqtt"
 import "github.com/dadleyy/beacon.api/beacon/routes"
 import "github.com/dadleyy/beacon.api/beacon/device"
 import "github.com/dadleyy/beacon.api/beacon/logging"
 import "github.com/dadleyy/beacon.api/beacon/security"
 import "github.com/dadleyy/beacon.api/beacon/version"
+import "github.com/dadleyy/beacon.api/beacon/webhook"
 
 func systemWatch(system chan os.Signal, killers []bg.KillSwitch, server *http.Server) {
 	<-system
@@ -39,19 +41,19 @@ func systemWatch(system chan os.Signal, killers []bg.KillSwitch, server *http.Se
 	server.Shutdown(context.Background())
 }
 
-// TokenGenerator is the used by the redis registry to generate random strings for device tokens.
-type TokenGenerator struct {
-}
+// reopenWatch reopens the log file each time the process is sent a SIGHUP, allowing it to be rotated externally.
+func reopenWatch(sink *logging.FileSink, logger *logging.Logger) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
 
-// GenerateToken returns a random hex string.
-func (t TokenGenerator) GenerateToken() (string, error) {
-	buffer := make([]byte, defs.SecurityUserDeviceTokenSize)
+	for range hangups {
+		if e := sink.Reopen(); e != nil {
+			logger.Errorf("unable to reopen log file: %s", e.Error())
+			continue
+		}
 
-	if _, e := rand.Read(buffer); e != nil {
-		return "", e
+		logger.Infof("reopened log file")
 	}
-
-	return hex.EncodeToString(buffer), nil
 }
 
 type wsUpgrader struct {
@@ -64,12 +66,61 @@ func (u *wsUpgrader) UpgradeWebsocket(w http.ResponseWriter, r *http.Request, h
 
 func main() {
 	options := struct {
-		port       string
-		hostname   string
-		envFile    string
-		redisURI   string
-		privateKey string
-	}{}
+		port            string
+		hostname        string
+		envFile         string
+		redisURI        string
+		privateKey      string
+		registrationTTL time.Duration
+		webhookURL      string
+		grpcAddress     string
+		mqttAddress     string
+		mqttClientID    string
+		drainTimeout    time.Duration
+		reapInterval    time.Duration
+		reapThreshold   time.Duration
+		reapAction      string
+		pool            device.PoolConfig
+		redisRetries    int
+		redisBackoff    time.Duration
+		compression     int
+		maxDecompressed int
+		gzipThreshold   int
+		maxBodySize     int64
+		signResponses   bool
+		maxTokens       int
+		uniqueTokens    bool
+		tokenSize       int
+		tokenEncoding   string
+		nameIndex       bool
+		lockTTL         time.Duration
+		lockWait        time.Duration
+		commandHistory  int
+		maxCommandAge   time.Duration
+		maxConnections  int
+		deviceConns     int
+		policy          string
+		coalesceWindow  time.Duration
+		controlWorkers  int
+		migrateFrom     int
+		commandBuffer   int
+		publishTimeout  time.Duration
+		tlsCert         string
+		tlsKey          string
+		deviceTLS       string
+		redisNamespace  string
+		redisCluster    bool
+		logFile         string
+		feedbackBackend string
+		adminToken      string
+		hierarchical    bool
+		filterTokens    bool
+		heartbeat       time.Duration
+		feedbackCount   int
+		feedbackMax     int
+		breakerLimit    int
+		breakerCooldown time.Duration
+	}{pool: device.DefaultPoolConfig()}
 
 	logger := logging.New(defs.MainLogPrefix, logging.Green)
 	flag.StringVar(&options.port, "port", defs.DefaultPort, "the port to attach the http listener to")
@@ -77,14 +128,120 @@ func main() {
 	flag.StringVar(&options.envFile, "envfile", ".env", "the environment variable file to load")
 	flag.StringVar(&options.redisURI, "redisuri", defs.DefaultRedisURI, "redis server uri")
 	flag.StringVar(&options.privateKey, "private-key", ".keys/private.pem", "pem encoded rsa private key")
+	flag.DurationVar(&options.registrationTTL, "registration-ttl", defs.DefaultRegistrationRequestTTL, "pending registration lifetime")
+	flag.StringVar(&options.webhookURL, "webhook-url", "", "url that device events will be posted to")
+	flag.StringVar(&options.grpcAddress, "grpc-address", "", "address the grpc device control service listens on")
+	flag.StringVar(&options.mqttAddress, "mqtt-address", "", "address of the mqtt broker devices register through")
+	flag.StringVar(&options.mqttClientID, "mqtt-client-id", defs.DefaultMQTTClientID, "client id sent to the mqtt broker")
+	flag.DurationVar(&options.drainTimeout, "drain-timeout", defs.DefaultControlDrainTimeout, "shutdown drain time")
+	flag.DurationVar(&options.reapInterval, "reap-interval", defs.DefaultReaperInterval, "idle device check interval")
+	flag.DurationVar(&options.reapThreshold, "reap-threshold", defs.DefaultReaperThreshold, "idle device threshold")
+	flag.DurationVar(&options.heartbeat, "heartbeat-interval", defs.DefaultHeartbeatInterval, "silent device threshold")
+	flag.StringVar(&options.reapAction, "reap-action", defs.ReaperActionFlag, "idle device action (flag or remove)")
+	flag.IntVar(&options.pool.MaxIdle, "redis-max-idle", options.pool.MaxIdle, "max idle redis connections")
+	flag.IntVar(&options.pool.MaxActive, "redis-max-active", options.pool.MaxActive, "max active redis connections")
+	flag.DurationVar(&options.pool.IdleTimeout, "redis-idle-timeout", options.pool.IdleTimeout, "redis idle conn lifetime")
+	flag.BoolVar(&options.pool.Wait, "redis-wait", options.pool.Wait, "wait for a redis connection when at max active")
+	flag.StringVar(&options.redisNamespace, "redis-namespace", "", "prefix prepended to every redis key")
+	flag.BoolVar(&options.redisCluster, "redis-cluster", false, "hash tag the keys of each device into a single slot")
+	flag.StringVar(&options.feedbackBackend, "feedback-backend", defs.FeedbackBackendList, "list or stream")
+	flag.IntVar(&options.feedbackCount, "feedback-list-count", defs.DefaultFeedbackListCount, "default feedback list size")
+	flag.IntVar(&options.feedbackMax, "max-feedback-list-count", defs.MaxFeedbackListCount, "max feedback list size")
+	flag.IntVar(&options.redisRetries, "redis-retries", defs.DefaultRedisRetries, "redis connection error retries")
+	flag.DurationVar(&options.redisBackoff, "redis-retry-backoff", defs.DefaultRedisRetryBackoff, "redis retry delay")
+	flag.IntVar(&options.maxTokens, "max-device-tokens", defs.DefaultMaxDeviceTokens, "max tokens per device (0 disables)")
+	flag.BoolVar(&options.uniqueTokens, "unique-token-names", false, "reject duplicate token names per device")
+	flag.IntVar(&options.tokenSize, "token-size", defs.SecurityUserDeviceTokenSize, "random bytes per device token")
+	flag.StringVar(&options.tokenEncoding, "token-encoding", defs.SecurityTokenEncodingHex, "device token encoding")
+	flag.BoolVar(&options.nameIndex, "device-name-index", false, "check taken device names w/ a set instead of a scan")
+	flag.DurationVar(&options.lockTTL, "device-lock-ttl", defs.DefaultDeviceLockTTL, "device mutation lock lifetime")
+	flag.DurationVar(&options.lockWait, "device-lock-wait", defs.DefaultDeviceLockWait, "device mutation lock wait")
+	flag.IntVar(&options.commandHistory, "command-history", defs.DefaultMaxCommandHistory, "commands kept per device")
+	flag.DurationVar(&options.maxCommandAge, "max-command-age", defs.DefaultMaxCommandAge, "max age of relayed commands")
+	flag.IntVar(&options.maxConnections, "max-connections", 0, "max pooled device connections (0 is unbounded)")
+	flag.IntVar(&options.deviceConns, "max-device-connections", defs.DefaultMaxDeviceConnections, "connections per device")
+	flag.StringVar(&options.policy, "device-connection-policy", defs.DeviceConnectionPolicyEvictOldest, "at limit action")
+	flag.DurationVar(&options.coalesceWindow, "coalesce-window", 0, "per device command coalescing window (0 disables)")
+	flag.IntVar(&options.controlWorkers, "control-workers", defs.DefaultDeviceControlWorkers, "device control workers")
+	flag.IntVar(&options.migrateFrom, "migrate-from", 0, "migrate registry records from schema version (0 skips)")
+	flag.IntVar(&options.commandBuffer, "command-buffer", defs.DefaultCommandBufferSize, "buffered command count")
+	flag.DurationVar(&options.publishTimeout, "publish-timeout", defs.DefaultChannelPublishTimeout, "full buffer wait")
+	flag.IntVar(&options.compression, "compression-threshold", 0, "compress device messages past this size (0 disables)")
+	flag.IntVar(&options.maxDecompressed, "max-decompressed-size", defs.DefaultMaxDecompressedSize, "max inflated size")
+	flag.IntVar(&options.gzipThreshold, "gzip-threshold", defs.DefaultGzipThreshold, "gzip larger responses (0 disables)")
+	flag.Int64Var(&options.maxBodySize, "max-body-size", defs.DefaultMaxRequestBodySize, "max request body size in bytes")
+	flag.BoolVar(&options.signResponses, "sign-responses", false, "sign feedback responses w/ the server key")
+	flag.StringVar(&options.adminToken, "admin-token", "", "server admin token required by admin only routes")
+	flag.IntVar(&options.breakerLimit, "control-breaker-threshold", defs.DefaultCircuitBreakerThreshold, "failure limit")
+	flag.DurationVar(&options.breakerCooldown, "control-breaker-cooldown", defs.DefaultCircuitBreakerCooldown, "open time")
+	flag.BoolVar(&options.hierarchical, "hierarchical-permissions", false, "admin implies controller implies viewer")
+	flag.BoolVar(&options.filterTokens, "filter-token-list", false, "list tokens at or below the caller's permission")
+	flag.StringVar(&options.tlsCert, "tls-cert", "", "pem encoded certificate used to serve https (requires tls-key)")
+	flag.StringVar(&options.tlsKey, "tls-key", "", "pem encoded private key for the tls certificate")
+	flag.StringVar(&options.deviceTLS, "device-tls", defs.SecurityDeviceTLSModeOff, "off, optional or required")
+	flag.StringVar(&options.logFile, "log-file", "", "file logs are written to along w/ stdout (reopened on SIGHUP)")
 	flag.Parse()
 
+	if options.logFile != "" {
+		sink, e := logging.OpenFileSink(options.logFile)
+
+		if e != nil {
+			logger.Errorf("unable to open log file %s: %s", options.logFile, e.Error())
+			return
+		}
+
+		defer sink.Close()
+		logging.SetOutput(os.Stdout, sink)
+		logger = logging.New(defs.MainLogPrefix, logging.Green)
+		go reopenWatch(sink, logger)
+	}
+
 	if valid := len(options.port) >= 1; !valid {
 		logger.Errorf("invalid port: %s", options.port)
 		flag.PrintDefaults()
 		return
 	}
 
+	// A negative buffer size would otherwise panic once the command channel is made.
+	if options.commandBuffer < 0 {
+		logger.Errorf("invalid command buffer: %d", options.commandBuffer)
+		flag.PrintDefaults()
+		return
+	}
+
+	if options.reapAction != defs.ReaperActionFlag && options.reapAction != defs.ReaperActionRemove {
+		logger.Errorf("invalid reap action: %s", options.reapAction)
+		flag.PrintDefaults()
+		return
+	}
+
+	if options.feedbackBackend != defs.FeedbackBackendList && options.feedbackBackend != defs.FeedbackBackendStream {
+		logger.Errorf("invalid feedback backend: %s", options.feedbackBackend)
+		flag.PrintDefaults()
+		return
+	}
+
+	if options.policy != defs.DeviceConnectionPolicyEvictOldest &&
+		options.policy != defs.DeviceConnectionPolicyRejectNew {
+		logger.Errorf("invalid device connection policy: %s", options.policy)
+		flag.PrintDefaults()
+		return
+	}
+
+	if options.deviceTLS != defs.SecurityDeviceTLSModeOff &&
+		options.deviceTLS != defs.SecurityDeviceTLSModeOptional &&
+		options.deviceTLS != defs.SecurityDeviceTLSModeRequired {
+		logger.Errorf("invalid device tls mode: %s", options.deviceTLS)
+		flag.PrintDefaults()
+		return
+	}
+
+	if options.deviceTLS != defs.SecurityDeviceTLSModeOff && (options.tlsCert == "" || options.tlsKey == "") {
+		logger.Errorf("device tls mode %s requires a tls certificate and key", options.deviceTLS)
+		flag.PrintDefaults()
+		return
+	}
+
 	if e := godotenv.Load(options.envFile); len(options.envFile) > 1 && e != nil {
 		logger.Errorf("failed loading env file: %s", e.Error())
 		return
@@ -102,19 +259,28 @@ func main() {
 		options.hostname = os.Getenv("HOSTNAME")
 	}
 
+	if os.Getenv("WEBHOOK_URL") != "" {
+		options.webhookURL = os.Getenv("WEBHOOK_URL")
+	}
+
+	if os.Getenv("ADMIN_TOKEN") != "" {
+		options.adminToken = os.Getenv("ADMIN_TOKEN")
+	}
+
+	if os.Getenv("GRPC_ADDRESS") != "" {
+		options.grpcAddress = os.Getenv("GRPC_ADDRESS")
+	}
+
+	if os.Getenv("MQTT_ADDRESS") != "" {
+		options.mqttAddress = os.Getenv("MQTT_ADDRESS")
+	}
+
 	logger.Debugf("permissions: (admin: %b) (controller %b) (viewer: %b)",
 		defs.SecurityDeviceTokenPermissionAdmin,
 		defs.SecurityDeviceTokenPermissionController,
 		defs.SecurityDeviceTokenPermissionViewer,
 	)
 
-	redisURL, e := url.Parse(options.redisURI)
-
-	if e != nil {
-		logger.Errorf("unable to establish connection to redis server: %s", e.Error())
-		return
-	}
-
 	serverKey, e := security.ReadServerKeyFromFile(options.privateKey)
 
 	if e != nil {
@@ -136,71 +302,181 @@ func main() {
 
 	// Create our two device channels - one for holding a connection to the device & one for processing messages from it.
 	publisher := bg.ChannelStore{
-		defs.DeviceControlChannelName:  make(chan io.Reader, 10),
-		defs.DeviceFeedbackChannelName: make(chan io.Reader, 10),
+		Channels: map[string]chan io.Reader{
+			defs.DeviceControlChannelName:  make(chan io.Reader, options.commandBuffer),
+			defs.DeviceFeedbackChannelName: make(chan io.Reader, 10),
+		},
+		Timeout: options.publishTimeout,
+	}
+
+	// Guard the control channel w/ a breaker so that requests fail fast while the control processor is not keeping up.
+	breaker := bg.CircuitBreaker{
+		ChannelPublisher: &publisher,
+		Channel:          defs.DeviceControlChannelName,
+		Threshold:        options.breakerLimit,
+		Cooldown:         options.breakerCooldown,
 	}
 
 	registrationStream := make(device.RegistrationStream, 10)
 
-	redisPool := redis.Pool{
-		Dial: func() (redis.Conn, error) {
-			c, err := redis.DialURL(options.redisURI)
+	tokens, e := device.NewRandomTokenGenerator(options.tokenSize, options.tokenEncoding)
 
-			if err != nil {
-				return nil, err
-			}
+	if e != nil {
+		logger.Errorf("invalid token generator: %s", e.Error())
+		return
+	}
 
-			password := redisURL.Query().Get("password")
+	// Create our device store - responsible for providing a persistence layer for connected device information.
+	registry, e := device.NewRedisRegistryFromURL(options.redisURI, options.pool, tokens)
 
-			if password == "" {
-				return c, nil
-			}
+	if e != nil {
+		logger.Errorf("invalid redis url: %s", e.Error())
+		return
+	}
 
-			if _, err := c.Do("AUTH", password); err != nil {
-				c.Close()
-				return nil, err
-			}
+	registry.AllocationTTL = options.registrationTTL
+	registry.Retries, registry.RetryBackoff = options.redisRetries, options.redisBackoff
+	registry.MaxTokens = options.maxTokens
+	registry.UniqueTokenNames = options.uniqueTokens
+	registry.NameIndex = options.nameIndex
+	registry.LockTTL = options.lockTTL
+	registry.LockWait = options.lockWait
+	registry.MaxCommandHistory = options.commandHistory
+	registry.Namespace = options.redisNamespace
+	registry.ClusterMode = options.redisCluster
+	registry.FeedbackBackend = options.feedbackBackend
+
+	defer registry.Close()
+
+	// Records written before the current schema version are upgraded before the server starts using them.
+	if options.migrateFrom > 0 {
+		if e := registry.MigrateRegistry(options.migrateFrom); e != nil {
+			logger.Errorf("unable to migrate registry from schema version %d: %s", options.migrateFrom, e.Error())
+			return
+		}
+	}
 
-			return c, nil
-		},
+	// The name index is rebuilt on start so that devices registered while the index was disabled are included.
+	if e := registry.RebuildNameIndex(); e != nil {
+		logger.Errorf("unable to rebuild device name index: %s", e.Error())
+		return
 	}
 
-	defer redisPool.Close()
+	var events device.EventDispatcher
+	var webhooks *webhook.HTTPDispatcher
 
-	// Create our device store - responsible for providing a persistence layer for connected device information.
-	registry := device.RedisRegistry{
-		Pool:           &redisPool,
-		Logger:         logging.New(defs.RegistryLogPrefix, logging.Green),
-		TokenGenerator: TokenGenerator{},
+	// If configured, device events will be posted to the webhook url by a background dispatcher.
+	if options.webhookURL != "" {
+		webhooks = webhook.NewHTTPDispatcher(options.webhookURL)
+		events, registry.Events = webhooks, webhooks
 	}
 
 	// Bundle our two message channels w/ the registration stream.
 	deviceChannels := bg.DeviceChannels{
-		Feedback:      publisher[defs.DeviceFeedbackChannelName],
-		Commands:      publisher[defs.DeviceControlChannelName],
+		Feedback:      publisher.Channels[defs.DeviceFeedbackChannelName],
+		Commands:      publisher.Channels[defs.DeviceControlChannelName],
 		Registrations: registrationStream,
 	}
 
 	// Create the main device controller that handles registrations & sending messages to the connected devices.
-	control := bg.NewDeviceControlProcessor(&deviceChannels, &registry, serverKey)
+	control := bg.NewDeviceControlProcessor(&deviceChannels, registry, serverKey, events)
+	control.DrainTimeout = options.drainTimeout
+	control.MaxCommandAge = options.maxCommandAge
+	control.MaxConnections = options.maxConnections
+	control.MaxDeviceConnections = options.deviceConns
+	control.DeviceConnectionPolicy = options.policy
+	control.CoalesceWindow = options.coalesceWindow
+	control.Workers = options.controlWorkers
+	control.Commands = registry
+	control.Resumes = registry
+	control.Feedback = registry
+	control.ConnectionEvents = registry
+
+	// The feedback broker relays feedback messages to clients streaming them from the feedback api.
+	feedbackBroker := bg.NewFeedbackBroker()
 
 	// Create the secondary processor that will receive messages from devices.
-	feedback := bg.NewDeviceFeedbackProcessor(publisher[defs.DeviceFeedbackChannelName])
+	feedback := bg.NewDeviceFeedbackProcessor(publisher.Channels[defs.DeviceFeedbackChannelName], feedbackBroker)
+
+	// Create the reaper that cleans up devices which have not been seen in a while.
+	reaper := bg.NewDeviceReaper(registry, registry, options.reapInterval, options.reapThreshold, options.reapAction)
+	reaper.Pool = control
 
-	processors := []bg.Processor{control, feedback}
+	processors := []bg.Processor{control, feedback, reaper}
 
-	deviceRoutes := routes.NewDevicesAPI(&registry, &registry)
-	registrationRoutes := routes.NewRegistrationAPI(registrationStream, &registry)
-	messageRoutes := routes.NewDeviceMessagesAPI(&registry, &registry)
-	feedbackRoutes := routes.NewFeedbackAPI(&registry, &registry)
-	tokenRoutes := routes.NewTokensAPI(&registry, &registry)
+	if webhooks != nil {
+		processors = append(processors, webhooks)
+	}
+
+	if options.grpcAddress != "" {
+		listener, e := stdnet.Listen("tcp", options.grpcAddress)
+
+		if e != nil {
+			logger.Errorf("unable to listen on grpc address: %s", e.Error())
+			return
+		}
+
+		service := rpc.NewDeviceControlServer(registry, registry, registry, registry, registry, registry, &breaker)
+		service.HierarchicalPermissions = options.hierarchical
+		service.History = registry
+		service.ListCount = options.feedbackCount
+		service.MaxListCount = options.feedbackMax
+		processors = append(processors, rpc.NewProcessor(listener, service))
+	}
+
+	if options.mqttAddress != "" {
+		client, e := mqtt.Dial(options.mqttAddress, options.mqttClientID, defs.DefaultMQTTKeepAlive)
+
+		if e != nil {
+			logger.Errorf("unable to connect to mqtt broker: %s", e.Error())
+			return
+		}
+
+		processors = append(processors, mqtt.NewBridge(client, registry, registrationStream))
+	}
+
+	deviceRoutes := routes.NewDevicesAPI(registry, registry, registry, registry)
+	deviceRoutes.Firmware = registry
+	deviceRoutes.History = registry
+	deviceRoutes.Tags = registry
+	deviceRoutes.Names = registry
+	deviceRoutes.Locks = registry
+	deviceRoutes.ConnectionEvents = registry
+	deviceRoutes.Pool = control
+	deviceRoutes.Activity = registry
+	deviceRoutes.HeartbeatInterval = options.heartbeat
+	deviceRoutes.AdminToken = options.adminToken
+	registrationRoutes := routes.NewRegistrationAPI(registrationStream, registry)
+	registrationRoutes.CompressionThreshold = options.compression
+	registrationRoutes.MaxDecompressedSize = options.maxDecompressed
+	registrationRoutes.DeviceTLSMode = options.deviceTLS
+	registrationRoutes.Resumes = registry
+	registrationRoutes.AdminToken = options.adminToken
+	registrationRoutes.Names = registry
+	registrationRoutes.Pool = control
+	messageRoutes := routes.NewDeviceMessagesAPI(registry, registry)
+	feedbackRoutes := routes.NewFeedbackAPI(registry, registry, registry, feedbackBroker)
+	feedbackRoutes.ListCount = options.feedbackCount
+	feedbackRoutes.MaxListCount = options.feedbackMax
+	tokenRoutes := routes.NewTokensAPI(registry, registry, registry)
+	tokenRoutes.AdminToken = options.adminToken
+	tokenRoutes.HierarchicalPermissions = options.hierarchical
+	tokenRoutes.FilterTokensByPermission = options.filterTokens
+	tokenRoutes.Idempotency = registry
+	auditRoutes := routes.NewAuditAPI(registry, registry, registry)
+	tagRoutes := routes.NewTagsAPI(registry, registry, registry)
+	systemRoutes := routes.SystemAPI{Control: &breaker}
+
+	// Device routes addressed by the device id (or name) in the path authorize their token before the handler is invoked.
+	deviceViewer := net.RequireToken(registry, registry, "uuid", defs.SecurityDeviceTokenPermissionViewer)
+	deviceAdmin := net.RequireToken(registry, registry, "uuid", defs.SecurityDeviceTokenPermissionAdmin)
 
 	routes := net.RouteConfigMapMatcher{
 		// [/system]
 		net.RouteConfig{
 			Method:  "GET",
 			Pattern: defs.SystemRoute,
-		}: routes.SystemInfo,
+		}: systemRoutes.Info,
 
 		// [/registration]
 		net.RouteConfig{
@@ -211,16 +487,44 @@ func main() {
 			Method:  "POST",
 			Pattern: defs.DeviceRegistrationRoute,
 		}: registrationRoutes.Preregister,
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.DeviceExistsRoute,
+		}: registrationRoutes.CheckExists,
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.PendingRegistrationsRoute,
+		}: registrationRoutes.ListPending,
+		net.RouteConfig{
+			Method:  "PUT",
+			Pattern: defs.DeviceReissueRoute,
+		}: registrationRoutes.Reissue,
 
 		// [/device-feedback]
 		net.RouteConfig{
 			Method:  "POST",
 			Pattern: defs.DeviceFeedbackRoute,
 		}: feedbackRoutes.CreateFeedback,
+		net.RouteConfig{
+			Method:  "POST",
+			Pattern: defs.DeviceFeedbackBatchRoute,
+		}: feedbackRoutes.CreateFeedbackBatch,
 		net.RouteConfig{
 			Method:  "GET",
 			Pattern: defs.DeviceFeedbackRoute,
 		}: feedbackRoutes.ListFeedback,
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.DeviceFeedbackStreamRoute,
+		}: feedbackRoutes.StreamFeedback,
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.DeviceFeedbackStatsRoute,
+		}: feedbackRoutes.FeedbackStats,
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.DeviceFeedbackQueryRoute,
+		}: feedbackRoutes.QueryFeedback,
 
 		// [/tokens]
 		net.RouteConfig{
@@ -231,6 +535,30 @@ func main() {
 			Method:  "GET",
 			Pattern: defs.DeviceTokensRoute,
 		}: tokenRoutes.ListTokens,
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.AllDeviceTokensRoute,
+		}: tokenRoutes.ListAllTokens,
+		net.RouteConfig{
+			Method:  "POST",
+			Pattern: defs.TokenIntrospectionRoute,
+		}: tokenRoutes.Introspect,
+
+		// [/device-tags]
+		net.RouteConfig{
+			Method:  "POST",
+			Pattern: defs.DeviceTagsRoute,
+		}: tagRoutes.CreateTag,
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.DeviceTagsRoute,
+		}: tagRoutes.ListTags,
+
+		// [/audit-log]
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.AuditLogRoute,
+		}: auditRoutes.ListAuditLog,
 
 		// [/device-messages]
 		net.RouteConfig{
@@ -244,19 +572,63 @@ func main() {
 			Pattern: defs.DeviceShorthandRoute,
 		}: deviceRoutes.UpdateShorthand,
 
+		// [/devices/:id]
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.DeviceDetailsRoute,
+		}: deviceViewer(deviceRoutes.GetDevice),
+		net.RouteConfig{
+			Method:  "PATCH",
+			Pattern: defs.DeviceDetailsRoute,
+		}: deviceRoutes.Patch,
+
+		// [/devices/:id/state]
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.DeviceStateRoute,
+		}: deviceViewer(deviceRoutes.GetState),
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.DeviceCommandHistoryRoute,
+		}: deviceAdmin(deviceRoutes.ListCommandHistory),
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.DeviceConnectionEventsRoute,
+		}: deviceViewer(deviceRoutes.ListConnectionEvents),
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.DeviceFeedbackListRoute,
+		}: feedbackRoutes.List,
+
+		// [/device-commands/:id]
+		net.RouteConfig{
+			Method:  "GET",
+			Pattern: defs.DeviceCommandRoute,
+		}: deviceRoutes.GetCommandStatus,
+
 		// [/devices]
 		net.RouteConfig{
 			Method:  "GET",
 			Pattern: defs.DeviceListRoute,
 		}: deviceRoutes.ListDevices,
+		net.RouteConfig{
+			Method:  "DELETE",
+			Pattern: defs.DeviceListRoute,
+		}: deviceRoutes.DeleteDevices,
 	}
 
 	runtime := net.ServerRuntime{
 		Logger:             logging.New(defs.ServerRuntimeLogPrefix, logging.Magenta),
 		WebsocketUpgrader:  &websocket,
 		Multiplexer:        &routes,
-		ChannelPublisher:   &publisher,
+		ChannelPublisher:   &breaker,
 		ApplicationVersion: version.Semver,
+		GzipThreshold:      options.gzipThreshold,
+		MaxBodySize:        options.maxBodySize,
+	}
+
+	if options.signResponses {
+		runtime.ResponseSigner = serverKey
 	}
 
 	wg, signalChan, killers := sync.WaitGroup{}, make(chan os.Signal, 1), make([]bg.KillSwitch, 0)
@@ -276,7 +648,16 @@ func main() {
 
 	logger.Infof("server (version %s) starting, binding on: %s\n", version.Semver, serverAddress)
 
-	if e := server.ListenAndServe(); e != nil {
+	listen := server.ListenAndServe
+
+	if options.tlsCert != "" {
+		// Client certificates are requested but not required by the handshake so non-device clients can still connect;
+		// the registration route decides whether a device's certificate is required.
+		server.TLSConfig = &tls.Config{ClientAuth: tls.RequestClientCert}
+		listen = func() error { return server.ListenAndServeTLS(options.tlsCert, options.tlsKey) }
+	}
+
+	if e := listen(); e != nil {
 		logger.Debugf("server shutdown: %s", e.Error())
 	}
 